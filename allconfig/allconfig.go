@@ -0,0 +1,56 @@
+// Package allconfig runs the allconfig maker-checker workflow: configs are written through approval
+// requests a maker submits and a checker approves or rejects, or directly by admins. ConfigService holds
+// the rules of the workflow and leaves the statements run on each database to a Store.
+package allconfig
+
+import (
+	"context"
+	"errors"
+)
+
+// Operations of an approval request
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// Statuses of an approval request, and of the response to a submitted one
+const (
+	StatusPending   = "pending"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusSubmitted = "submitted_for_approval"
+)
+
+var (
+	// ErrConfigNotFound is returned for keys no approved config is stored under
+	ErrConfigNotFound = errors.New("config not found")
+	// ErrConfigExists is returned when creating a config under a key that is taken
+	ErrConfigExists = errors.New("config already exists")
+	// ErrRequestNotFound is returned for approval requests that do not exist or are no longer pending
+	ErrRequestNotFound = errors.New("pending approval request not found")
+	// ErrMakerIDRequired is returned when submitting a change without a maker
+	ErrMakerIDRequired = errors.New("a maker ID is required")
+	// ErrCheckerIDRequired is returned when deciding on a request without a checker
+	ErrCheckerIDRequired = errors.New("a checker ID is required")
+)
+
+// Approval is the approval request whose change is being applied
+type Approval struct {
+	RequestID string
+	CheckerID string
+}
+
+type approvalKey struct{}
+
+// WithApproval returns a copy of ctx attributing the writes made with it to an approval
+func WithApproval(ctx context.Context, approval Approval) context.Context {
+	return context.WithValue(ctx, approvalKey{}, approval)
+}
+
+// ApprovalFrom returns the approval stored in ctx, reporting whether there is one
+func ApprovalFrom(ctx context.Context) (Approval, bool) {
+	approval, ok := ctx.Value(approvalKey{}).(Approval)
+	return approval, ok
+}
@@ -0,0 +1,173 @@
+package allconfig
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// approvalLatencyBuckets are the upper bounds of the approval latency buckets, in seconds: from a minute
+// to a week
+var approvalLatencyBuckets = []float64{60, 300, 900, 1800, 3600, 4 * 3600, 12 * 3600, 24 * 3600, 3 * 24 * 3600, 7 * 24 * 3600}
+
+// LatencyBucket counts the approvals that waited up to its upper bound
+type LatencyBucket struct {
+	LeSeconds float64 `json:"le_seconds"`
+	Count     int64   `json:"count"` // Cumulative, so it includes the buckets below
+}
+
+// ApprovalLatency reports how long approved requests waited, from requested_at to their approval.
+// Latencies above the last bucket count in Count only.
+type ApprovalLatency struct {
+	Count      int64           `json:"count"`
+	SumSeconds float64         `json:"sum_seconds"`
+	Buckets    []LatencyBucket `json:"buckets"`
+}
+
+// TableStats reports the maker-checker activity on one allconfig table since the server started
+type TableStats struct {
+	Submitted       map[string]int64 `json:"submitted"` // Requests submitted, by operation
+	Approved        map[string]int64 `json:"approved"`  // Requests approved, by operation
+	Rejected        int64            `json:"rejected"`
+	ApprovalLatency ApprovalLatency  `json:"approval_latency"`
+	Pending         *int64           `json:"pending,omitempty"` // Requests pending when last counted; nil until counted
+}
+
+// tableMetrics holds the counters of one table
+type tableMetrics struct {
+	submitted  map[string]int64
+	approved   map[string]int64
+	rejected   int64
+	latencies  []int64 // Per bucket, not cumulative, and one more for latencies above the last
+	latencySum float64
+	pending    *int64
+}
+
+// tableKey names a table on a connection: tables of the same name on different databases count apart
+type tableKey struct {
+	connection string
+	table      string
+}
+
+// Metrics counts the requests a ConfigService submits, approves and rejects on each table of each
+// connection, how long the approved ones waited, and the pending requests of each table as last counted
+// with SetPending. A nil Metrics counts nothing.
+type Metrics struct {
+	mu     sync.Mutex
+	tables map[tableKey]*tableMetrics
+	now    func() time.Time // Clock approvals are timed with
+}
+
+// NewMetrics returns metrics counting nothing yet
+func NewMetrics() *Metrics {
+	return &Metrics{tables: map[tableKey]*tableMetrics{}, now: time.Now}
+}
+
+// SetPending records the number of requests pending on table of connection
+func (m *Metrics) SetPending(connection, table string, count int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table(connection, table).pending = &count
+}
+
+// Stats returns the counters of each table, by connection and then by table
+func (m *Metrics) Stats() map[string]map[string]TableStats {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := map[string]map[string]TableStats{}
+	for key, t := range m.tables {
+		table := TableStats{
+			Submitted: copyCounts(t.submitted),
+			Approved:  copyCounts(t.approved),
+			Rejected:  t.rejected,
+			ApprovalLatency: ApprovalLatency{
+				SumSeconds: t.latencySum,
+				Buckets:    make([]LatencyBucket, len(approvalLatencyBuckets)),
+			},
+		}
+		latency := &table.ApprovalLatency
+		for i, le := range approvalLatencyBuckets {
+			latency.Count += t.latencies[i]
+			latency.Buckets[i] = LatencyBucket{LeSeconds: le, Count: latency.Count}
+		}
+		latency.Count += t.latencies[len(approvalLatencyBuckets)]
+		if t.pending != nil {
+			pending := *t.pending
+			table.Pending = &pending
+		}
+		if stats[key.connection] == nil {
+			stats[key.connection] = map[string]TableStats{}
+		}
+		stats[key.connection][key.table] = table
+	}
+	return stats
+}
+
+// submitted counts a request submitted on table of connection
+func (m *Metrics) submitted(connection, table, operation string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table(connection, table).submitted[operation]++
+}
+
+// approved counts a request approved on table of connection, timing how long it waited when its submission
+// time is known
+func (m *Metrics) approved(connection, table, operation string, requestedAt *time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.table(connection, table)
+	t.approved[operation]++
+	if requestedAt == nil {
+		return
+	}
+	// The database clock stamped requested_at; one running ahead of the server's counts as no wait
+	seconds := max(m.now().Sub(*requestedAt).Seconds(), 0)
+	t.latencies[sort.SearchFloat64s(approvalLatencyBuckets, seconds)]++
+	t.latencySum += seconds
+}
+
+// rejected counts a request rejected on table of connection
+func (m *Metrics) rejected(connection, table string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table(connection, table).rejected++
+}
+
+// table returns the counters of table on connection, creating them on first use; m.mu must be held
+func (m *Metrics) table(connection, name string) *tableMetrics {
+	key := tableKey{connection: connection, table: name}
+	t, ok := m.tables[key]
+	if !ok {
+		t = &tableMetrics{
+			submitted: map[string]int64{},
+			approved:  map[string]int64{},
+			latencies: make([]int64, len(approvalLatencyBuckets)+1),
+		}
+		m.tables[key] = t
+	}
+	return t
+}
+
+// copyCounts returns a copy of counts
+func copyCounts(counts map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(counts))
+	for key, count := range counts {
+		copied[key] = count
+	}
+	return copied
+}
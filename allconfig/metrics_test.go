@@ -0,0 +1,125 @@
+package allconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsCountDecisions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	metrics := NewMetrics()
+	metrics.now = func() time.Time { return now }
+	store := newMemoryStore()
+	service := NewConfigService(store, nil, metrics).ForConnection("primary")
+
+	for _, operation := range []string{OperationCreate, OperationUpdate, OperationUpdate} {
+		_, err := service.Submit(ctx, nil, SubmitRequest{Table: "settings", Operation: operation, Key: "feature.flag", Value: "on", MakerID: "bob"})
+		require.NoError(t, err)
+	}
+
+	// Approved after 2 minutes and after 3 hours
+	requested := now.Add(-2 * time.Minute)
+	store.pending["req-1"] = &ApprovalRequest{RequestID: "req-1", Operation: OperationCreate, Key: "a", Value: "on", RequestedAt: &requested}
+	_, err := service.Approve(ctx, nil, DecisionRequest{Table: "settings", RequestID: "req-1", CheckerID: "carol"})
+	require.NoError(t, err)
+	requested = now.Add(-3 * time.Hour)
+	store.pending["req-2"] = &ApprovalRequest{RequestID: "req-2", Operation: OperationUpdate, Key: "a", Value: "off", RequestedAt: &requested}
+	_, err = service.Approve(ctx, nil, DecisionRequest{Table: "settings", RequestID: "req-2", CheckerID: "carol"})
+	require.NoError(t, err)
+
+	// An approval of unknown age counts without a latency, and failures count nothing
+	store.pending["req-3"] = &ApprovalRequest{RequestID: "req-3", Operation: OperationDelete, Key: "a"}
+	_, err = service.Approve(ctx, nil, DecisionRequest{Table: "settings", RequestID: "req-3", CheckerID: "carol"})
+	require.NoError(t, err)
+	_, err = service.Approve(ctx, nil, DecisionRequest{Table: "settings", RequestID: "req-9", CheckerID: "carol"})
+	assert.ErrorIs(t, err, ErrRequestNotFound)
+	_, err = service.Reject(ctx, nil, DecisionRequest{Table: "settings", RequestID: "req-9", CheckerID: "carol"})
+	assert.ErrorIs(t, err, ErrRequestNotFound)
+
+	store.pending["req-4"] = &ApprovalRequest{RequestID: "req-4", Operation: OperationCreate, Key: "b"}
+	_, err = service.Decide(ctx, nil, DecisionRequest{Table: "settings", RequestID: "req-4", CheckerID: "carol"}, false)
+	require.NoError(t, err)
+
+	stats := metrics.Stats()["primary"]["settings"]
+	assert.Equal(t, map[string]int64{OperationCreate: 1, OperationUpdate: 2}, stats.Submitted)
+	assert.Equal(t, map[string]int64{OperationCreate: 1, OperationUpdate: 1, OperationDelete: 1}, stats.Approved)
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Nil(t, stats.Pending)
+
+	latency := stats.ApprovalLatency
+	assert.Equal(t, int64(2), latency.Count)
+	assert.Equal(t, float64(120+3*3600), latency.SumSeconds)
+	assert.Equal(t, LatencyBucket{LeSeconds: 60, Count: 0}, latency.Buckets[0])
+	assert.Equal(t, LatencyBucket{LeSeconds: 300, Count: 1}, latency.Buckets[1])
+	assert.Equal(t, LatencyBucket{LeSeconds: 3600, Count: 1}, latency.Buckets[4])
+	assert.Equal(t, LatencyBucket{LeSeconds: 4 * 3600, Count: 2}, latency.Buckets[5])
+}
+
+func TestMetricsLatencyBounds(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	metrics := NewMetrics()
+	metrics.now = func() time.Time { return now }
+
+	// A request stamped ahead of the server's clock waited no time; one older than a week counts above the buckets
+	ahead, old := now.Add(time.Minute), now.Add(-30*24*time.Hour)
+	metrics.approved("primary", "settings", OperationCreate, &ahead)
+	metrics.approved("primary", "settings", OperationCreate, &old)
+
+	latency := metrics.Stats()["primary"]["settings"].ApprovalLatency
+	assert.Equal(t, int64(2), latency.Count)
+	assert.Equal(t, (30 * 24 * time.Hour).Seconds(), latency.SumSeconds)
+	assert.Equal(t, int64(1), latency.Buckets[0].Count)
+	assert.Equal(t, int64(1), latency.Buckets[len(latency.Buckets)-1].Count)
+}
+
+func TestMetricsPending(t *testing.T) {
+	metrics := NewMetrics()
+	assert.Empty(t, metrics.Stats())
+
+	metrics.SetPending("primary", "settings", 3)
+	metrics.SetPending("primary", "settings", 2)
+	stats := metrics.Stats()
+	require.Contains(t, stats["primary"], "settings")
+	assert.Equal(t, int64(2), *stats["primary"]["settings"].Pending)
+	assert.Empty(t, stats["primary"]["settings"].Submitted)
+
+	// The stats are a copy
+	*stats["primary"]["settings"].Pending = 10
+	assert.Equal(t, int64(2), *metrics.Stats()["primary"]["settings"].Pending)
+}
+
+func TestMetricsByConnection(t *testing.T) {
+	ctx := context.Background()
+	metrics := NewMetrics()
+	store := newMemoryStore()
+	primary := NewConfigService(store, nil, metrics).ForConnection("primary")
+	replica := primary.ForConnection("replica")
+
+	// The same table on two connections counts apart
+	for _, service := range []*ConfigService{primary, primary, replica} {
+		_, err := service.Submit(ctx, nil, SubmitRequest{Table: "allconfig", Operation: OperationCreate, Key: "feature.flag", Value: "on", MakerID: "bob"})
+		require.NoError(t, err)
+	}
+	metrics.SetPending("primary", "allconfig", 2)
+	metrics.SetPending("replica", "allconfig", 1)
+
+	stats := metrics.Stats()
+	assert.Equal(t, map[string]int64{OperationCreate: 2}, stats["primary"]["allconfig"].Submitted)
+	assert.Equal(t, map[string]int64{OperationCreate: 1}, stats["replica"]["allconfig"].Submitted)
+	assert.Equal(t, int64(2), *stats["primary"]["allconfig"].Pending)
+	assert.Equal(t, int64(1), *stats["replica"]["allconfig"].Pending)
+}
+
+func TestNilMetrics(t *testing.T) {
+	var metrics *Metrics
+	metrics.SetPending("primary", "settings", 1)
+	metrics.submitted("primary", "settings", OperationCreate)
+	metrics.approved("primary", "settings", OperationCreate, nil)
+	metrics.rejected("primary", "settings")
+	assert.Nil(t, metrics.Stats())
+}
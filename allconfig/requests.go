@@ -0,0 +1,100 @@
+package allconfig
+
+import "time"
+
+// ReadRequest names the config stored under Key in Table
+type ReadRequest struct {
+	Table string
+	Key   string
+}
+
+// ListRequest pages through the configs or approval requests of Table
+type ListRequest struct {
+	Table   string
+	MakerID string // Maker whose requests MyRequests lists
+	Limit   int    // Most entries returned; 0 returns every one
+	Offset  int    // Entries skipped before the first returned
+}
+
+// SearchRequest pages through the approved configs of Table matching every criterion given
+type SearchRequest struct {
+	Table   string
+	Term    string                 // Case-insensitive substring of the key, value or description
+	Filter  map[string]interface{} // Column values configs must equal
+	TagsAny []string               // Configs carrying at least one of these tags
+	TagsAll []string               // Configs carrying every one of these tags
+	Limit   int
+	Offset  int
+}
+
+// SetRequest writes the config stored under Key
+type SetRequest struct {
+	Table       string
+	Key         string
+	Value       interface{}
+	Description string
+	Tags        []string   // Nil leaves the tags of an updated config as they are
+	ExpiresAt   *time.Time // When the config stops being read; nil never
+	MakerID     string
+}
+
+// DeleteRequest deletes the config stored under Key
+type DeleteRequest struct {
+	Table       string
+	Key         string
+	Description string // Why the delete is submitted for approval
+	MakerID     string
+}
+
+// SubmitRequest submits a change of the config stored under Key for approval
+type SubmitRequest struct {
+	Table       string
+	Operation   string // OperationCreate, OperationUpdate or OperationDelete
+	Key         string
+	Value       interface{}
+	Description string
+	Tags        []string
+	ExpiresAt   *time.Time
+	MakerID     string
+}
+
+// DecisionRequest approves or rejects the pending approval request RequestID of Table
+type DecisionRequest struct {
+	Table     string
+	RequestID string
+	CheckerID string
+	Comment   string
+}
+
+// ApprovalRequest is a pending approval request as a Store reads it
+type ApprovalRequest struct {
+	RequestID   string
+	Operation   string
+	Key         string
+	Value       interface{}
+	Description string
+	Tags        []string
+	ExpiresAt   *time.Time
+	MakerID     string
+	RequestedAt *time.Time // When it was submitted, by the database clock; nil when the store does not read it
+}
+
+// Submitted is the response to a submitted approval request
+type Submitted struct {
+	RequestID string      `json:"request_id"`
+	Status    string      `json:"status"` // Always StatusSubmitted
+	Operation string      `json:"operation"`
+	Key       string      `json:"config_key"`
+	MakerID   string      `json:"maker_id"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"` // In UTC
+	Result    interface{} `json:"result"`               // What the store returned for the insert
+}
+
+// Decision is the response to an approved or rejected request
+type Decision struct {
+	RequestID     string      `json:"request_id"`
+	Status        string      `json:"status"` // StatusApproved or StatusRejected
+	CheckerID     string      `json:"checker_id"`
+	Comment       string      `json:"approval_comment"`
+	AppliedResult interface{} `json:"applied_result,omitempty"` // What the store returned for the approved change
+}
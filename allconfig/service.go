@@ -0,0 +1,335 @@
+package allconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"db-connectors/connectors"
+	"db-connectors/requestid"
+)
+
+// ConfigService runs allconfig and maker-checker operations on the database a connector is connected to.
+//
+// Submit, Approve, Reject, Create, Update, Delete and the reads take their requests as they are, for
+// callers that have checked them already. Get, DirectSet, DirectDelete, SubmitSet, SubmitDelete and Decide
+// resolve keys and check writes with the policy first, and look up what they change, so a config missing
+// or a request no longer pending is reported before anything is written.
+type ConfigService struct {
+	store      Store
+	policy     Policy
+	metrics    *Metrics
+	connection string // Connection the metrics count the requests under
+}
+
+// NewConfigService returns a service running its statements with store and checking writes with policy,
+// or taking keys as given and letting every write through when policy is nil. The requests it submits,
+// approves and rejects are counted in metrics unless it is nil.
+func NewConfigService(store Store, policy Policy, metrics *Metrics) *ConfigService {
+	if policy == nil {
+		policy = openPolicy{}
+	}
+	return &ConfigService{store: store, policy: policy, metrics: metrics}
+}
+
+// ForConnection returns a copy of the service counting its requests in the metrics under connection, such
+// as the name of the profile or the address of the database its connectors are connected to
+func (s *ConfigService) ForConnection(connection string) *ConfigService {
+	service := *s
+	service.connection = connection
+	return &service
+}
+
+// Submit submits a change for approval under a new request ID
+func (s *ConfigService) Submit(ctx context.Context, connector connectors.DBConnector, req SubmitRequest) (*Submitted, error) {
+	switch req.Operation {
+	case OperationCreate, OperationUpdate, OperationDelete:
+	default:
+		return nil, fmt.Errorf("unsupported operation: %s", req.Operation)
+	}
+	requestID := requestid.New()
+	result, err := s.store.Submit(ctx, connector, requestID, req)
+	if err != nil {
+		return nil, err
+	}
+	s.metrics.submitted(s.connection, req.Table, req.Operation)
+	submitted := &Submitted{
+		RequestID: requestID,
+		Status:    StatusSubmitted,
+		Operation: req.Operation,
+		Key:       req.Key,
+		MakerID:   req.MakerID,
+		Result:    result,
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		submitted.ExpiresAt = &expiresAt
+	}
+	return submitted, nil
+}
+
+// Approve applies the change of a pending request and marks it approved, returning ErrRequestNotFound
+// when the request is not pending
+func (s *ConfigService) Approve(ctx context.Context, connector connectors.DBConnector, req DecisionRequest) (*Decision, error) {
+	request, err := s.store.PendingRequest(ctx, connector, req.Table, req.RequestID)
+	if err != nil {
+		if errors.Is(err, ErrRequestNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get pending request: %w", err)
+	}
+
+	// The change is attributed to the approval. The store checks the value again, as its rules may have
+	// changed since the request was submitted.
+	ctx = WithApproval(ctx, Approval{RequestID: req.RequestID, CheckerID: req.CheckerID})
+	change := SetRequest{
+		Table:       req.Table,
+		Key:         request.Key,
+		Value:       request.Value,
+		Description: request.Description,
+		Tags:        request.Tags,
+		ExpiresAt:   request.ExpiresAt,
+		MakerID:     request.MakerID,
+	}
+	var applied interface{}
+	switch request.Operation {
+	case OperationCreate:
+		applied, err = s.store.Create(ctx, connector, change)
+	case OperationUpdate:
+		applied, err = s.store.Update(ctx, connector, change)
+	case OperationDelete:
+		applied, err = s.store.Delete(ctx, connector, DeleteRequest{Table: req.Table, Key: request.Key, MakerID: request.MakerID})
+	default:
+		return nil, fmt.Errorf("unsupported operation: %s", request.Operation)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply approved change: %w", err)
+	}
+
+	if err := s.store.Decide(ctx, connector, req, StatusApproved); err != nil {
+		return nil, fmt.Errorf("failed to update approval request status: %w", err)
+	}
+	s.metrics.approved(s.connection, req.Table, request.Operation, request.RequestedAt)
+	return &Decision{RequestID: req.RequestID, Status: StatusApproved, CheckerID: req.CheckerID, Comment: req.Comment, AppliedResult: applied}, nil
+}
+
+// Reject marks a pending request rejected, leaving its config as it is
+func (s *ConfigService) Reject(ctx context.Context, connector connectors.DBConnector, req DecisionRequest) (*Decision, error) {
+	if err := s.store.Decide(ctx, connector, req, StatusRejected); err != nil {
+		return nil, fmt.Errorf("failed to update approval request status: %w", err)
+	}
+	s.metrics.rejected(s.connection, req.Table)
+	return &Decision{RequestID: req.RequestID, Status: StatusRejected, CheckerID: req.CheckerID, Comment: req.Comment}, nil
+}
+
+// Create writes a new config directly, bypassing approval
+func (s *ConfigService) Create(ctx context.Context, connector connectors.DBConnector, req SetRequest) (interface{}, error) {
+	return s.store.Create(ctx, connector, req)
+}
+
+// Update rewrites a config directly, bypassing approval
+func (s *ConfigService) Update(ctx context.Context, connector connectors.DBConnector, req SetRequest) (interface{}, error) {
+	return s.store.Update(ctx, connector, req)
+}
+
+// Delete deletes a config directly, bypassing approval
+func (s *ConfigService) Delete(ctx context.Context, connector connectors.DBConnector, req DeleteRequest) (interface{}, error) {
+	return s.store.Delete(ctx, connector, req)
+}
+
+// Read returns the approved config stored under the key as the store reads it, or ErrConfigNotFound
+func (s *ConfigService) Read(ctx context.Context, connector connectors.DBConnector, req ReadRequest) (interface{}, error) {
+	return s.store.Read(ctx, connector, req)
+}
+
+// Exists reports whether an approved config is stored under the key
+func (s *ConfigService) Exists(ctx context.Context, connector connectors.DBConnector, req ReadRequest) (bool, error) {
+	return s.store.Exists(ctx, connector, req)
+}
+
+// ReadAll lists the approved configs in key order
+func (s *ConfigService) ReadAll(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.store.ReadAll(ctx, connector, req)
+}
+
+// Search lists the approved configs matching the search in key order
+func (s *ConfigService) Search(ctx context.Context, connector connectors.DBConnector, req SearchRequest) (interface{}, error) {
+	return s.store.Search(ctx, connector, req)
+}
+
+// Pending lists the pending approval requests, oldest first
+func (s *ConfigService) Pending(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.store.Pending(ctx, connector, req)
+}
+
+// MyRequests lists the approval requests of req.MakerID, newest first
+func (s *ConfigService) MyRequests(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.store.MyRequests(ctx, connector, req)
+}
+
+// History lists the approved and rejected requests, most recently decided first
+func (s *ConfigService) History(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.store.History(ctx, connector, req)
+}
+
+// Get returns the approved config stored under the resolved key, or ErrConfigNotFound
+func (s *ConfigService) Get(ctx context.Context, connector connectors.DBConnector, req ReadRequest) (interface{}, error) {
+	key, err := s.policy.ResolveKey(ctx, connector, req.Table, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.store.Read(ctx, connector, ReadRequest{Table: req.Table, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	config, _ := FirstConfig(result)
+	return config, nil
+}
+
+// DirectSet creates or updates the config under the resolved key directly, bypassing approval, and
+// reports whether it was created
+func (s *ConfigService) DirectSet(ctx context.Context, connector connectors.DBConnector, req SetRequest) (interface{}, bool, error) {
+	req, exists, err := s.checkSet(ctx, connector, req)
+	if err != nil {
+		return nil, false, err
+	}
+	if exists {
+		result, err := s.store.Update(ctx, connector, req)
+		return result, false, err
+	}
+	result, err := s.store.Create(ctx, connector, req)
+	return result, true, err
+}
+
+// DirectDelete deletes the config under the resolved key directly, bypassing approval, returning
+// ErrConfigNotFound when none is stored
+func (s *ConfigService) DirectDelete(ctx context.Context, connector connectors.DBConnector, req DeleteRequest) (interface{}, error) {
+	key, err := s.mustExist(ctx, connector, req.Table, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	req.Key = key
+	return s.store.Delete(ctx, connector, req)
+}
+
+// SubmitSet submits creating or updating the config under the resolved key for approval; the operation
+// of the submitted request tells which
+func (s *ConfigService) SubmitSet(ctx context.Context, connector connectors.DBConnector, req SetRequest) (*Submitted, error) {
+	if req.MakerID == "" {
+		return nil, ErrMakerIDRequired
+	}
+	req, exists, err := s.checkSet(ctx, connector, req)
+	if err != nil {
+		return nil, err
+	}
+	operation := OperationCreate
+	if exists {
+		operation = OperationUpdate
+	}
+	return s.Submit(ctx, connector, SubmitRequest{
+		Table:       req.Table,
+		Operation:   operation,
+		Key:         req.Key,
+		Value:       req.Value,
+		Description: req.Description,
+		Tags:        req.Tags,
+		ExpiresAt:   req.ExpiresAt,
+		MakerID:     req.MakerID,
+	})
+}
+
+// SubmitDelete submits deleting the config under the resolved key for approval, returning
+// ErrConfigNotFound when none is stored
+func (s *ConfigService) SubmitDelete(ctx context.Context, connector connectors.DBConnector, req DeleteRequest) (*Submitted, error) {
+	if req.MakerID == "" {
+		return nil, ErrMakerIDRequired
+	}
+	key, err := s.mustExist(ctx, connector, req.Table, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Submit(ctx, connector, SubmitRequest{Table: req.Table, Operation: OperationDelete, Key: key, Description: req.Description, MakerID: req.MakerID})
+}
+
+// Decide approves or rejects a pending request, returning ErrRequestNotFound unwrapped when it is not
+// pending
+func (s *ConfigService) Decide(ctx context.Context, connector connectors.DBConnector, req DecisionRequest, approve bool) (*Decision, error) {
+	if req.CheckerID == "" {
+		return nil, ErrCheckerIDRequired
+	}
+	if _, err := s.store.PendingRequest(ctx, connector, req.Table, req.RequestID); err != nil {
+		if errors.Is(err, ErrRequestNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read approval request: %w", err)
+	}
+	if approve {
+		return s.Approve(ctx, connector, req)
+	}
+	return s.Reject(ctx, connector, req)
+}
+
+// checkSet resolves the key of a write and checks it with the policy, reporting whether a config is
+// stored under the key. A key the write would create is checked as a new one.
+func (s *ConfigService) checkSet(ctx context.Context, connector connectors.DBConnector, req SetRequest) (SetRequest, bool, error) {
+	key, err := s.policy.ResolveKey(ctx, connector, req.Table, req.Key)
+	if err != nil {
+		return req, false, err
+	}
+	req.Key = key
+	if err := s.policy.CheckWrite(req.Key, req.Value, req.Description, req.Tags); err != nil {
+		return req, false, err
+	}
+	exists, err := s.exists(ctx, connector, req.Table, req.Key)
+	if err != nil {
+		return req, false, err
+	}
+	if !exists {
+		if err := s.policy.CheckNewKey(req.Key); err != nil {
+			return req, false, err
+		}
+	}
+	return req, exists, nil
+}
+
+// mustExist returns the resolved key, or ErrConfigNotFound unless an approved config is stored under it
+func (s *ConfigService) mustExist(ctx context.Context, connector connectors.DBConnector, table, key string) (string, error) {
+	key, err := s.policy.ResolveKey(ctx, connector, table, key)
+	if err != nil {
+		return "", err
+	}
+	exists, err := s.exists(ctx, connector, table, key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrConfigNotFound, key)
+	}
+	return key, nil
+}
+
+// exists reports whether an approved config is stored under a resolved key
+func (s *ConfigService) exists(ctx context.Context, connector connectors.DBConnector, table, key string) (bool, error) {
+	exists, err := s.store.Exists(ctx, connector, ReadRequest{Table: table, Key: key})
+	if err != nil {
+		return false, fmt.Errorf("failed to check config: %w", err)
+	}
+	return exists, nil
+}
+
+// FirstConfig unwraps a single-config read: the first SQL row or the MongoDB document, reporting whether
+// there is one
+func FirstConfig(result interface{}) (interface{}, bool) {
+	switch v := result.(type) {
+	case nil:
+		return nil, false
+	case []map[string]interface{}:
+		if len(v) == 0 {
+			return nil, false
+		}
+		return v[0], true
+	case map[string]interface{}:
+		return v, v != nil
+	}
+	return result, true
+}
@@ -0,0 +1,302 @@
+package allconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"db-connectors/connectors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a Store keeping the configs and pending requests of every table in maps, and
+// the approvals the writes it applied were made with
+type memoryStore struct {
+	configs   map[string]interface{}
+	pending   map[string]*ApprovalRequest
+	decided   map[string]string
+	approvals []Approval
+	err       error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{configs: map[string]interface{}{}, pending: map[string]*ApprovalRequest{}, decided: map[string]string{}}
+}
+
+func (s *memoryStore) Submit(ctx context.Context, connector connectors.DBConnector, requestID string, req SubmitRequest) (interface{}, error) {
+	s.pending[requestID] = &ApprovalRequest{
+		RequestID: requestID,
+		Operation: req.Operation,
+		Key:       req.Key,
+		Value:     req.Value,
+		MakerID:   req.MakerID,
+	}
+	return map[string]interface{}{"inserted_id": requestID}, nil
+}
+
+func (s *memoryStore) PendingRequest(ctx context.Context, connector connectors.DBConnector, table, requestID string) (*ApprovalRequest, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	request, ok := s.pending[requestID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRequestNotFound, requestID)
+	}
+	return request, nil
+}
+
+func (s *memoryStore) Decide(ctx context.Context, connector connectors.DBConnector, req DecisionRequest, status string) error {
+	if _, ok := s.pending[req.RequestID]; !ok {
+		return fmt.Errorf("%w: %s", ErrRequestNotFound, req.RequestID)
+	}
+	delete(s.pending, req.RequestID)
+	s.decided[req.RequestID] = status
+	return nil
+}
+
+func (s *memoryStore) Create(ctx context.Context, connector connectors.DBConnector, req SetRequest) (interface{}, error) {
+	if _, ok := s.configs[req.Key]; ok {
+		return nil, ErrConfigExists
+	}
+	s.recordApproval(ctx)
+	s.configs[req.Key] = req.Value
+	return "created", nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, connector connectors.DBConnector, req SetRequest) (interface{}, error) {
+	if _, ok := s.configs[req.Key]; !ok {
+		return nil, ErrConfigNotFound
+	}
+	s.recordApproval(ctx)
+	s.configs[req.Key] = req.Value
+	return "updated", nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, connector connectors.DBConnector, req DeleteRequest) (interface{}, error) {
+	if _, ok := s.configs[req.Key]; !ok {
+		return nil, ErrConfigNotFound
+	}
+	s.recordApproval(ctx)
+	delete(s.configs, req.Key)
+	return "deleted", nil
+}
+
+func (s *memoryStore) Read(ctx context.Context, connector connectors.DBConnector, req ReadRequest) (interface{}, error) {
+	value, ok := s.configs[req.Key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, req.Key)
+	}
+	return []map[string]interface{}{{"config_key": req.Key, "config_value": value}}, nil
+}
+
+func (s *memoryStore) Exists(ctx context.Context, connector connectors.DBConnector, req ReadRequest) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	_, ok := s.configs[req.Key]
+	return ok, nil
+}
+
+func (s *memoryStore) ReadAll(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.configs, nil
+}
+
+func (s *memoryStore) Search(ctx context.Context, connector connectors.DBConnector, req SearchRequest) (interface{}, error) {
+	return s.configs, nil
+}
+
+func (s *memoryStore) Pending(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.pending, nil
+}
+
+func (s *memoryStore) MyRequests(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.pending, nil
+}
+
+func (s *memoryStore) History(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error) {
+	return s.decided, nil
+}
+
+func (s *memoryStore) recordApproval(ctx context.Context) {
+	if approval, ok := ApprovalFrom(ctx); ok {
+		s.approvals = append(s.approvals, approval)
+	}
+}
+
+// lowerPolicy lowercases keys and rejects new keys starting with "reserved."
+type lowerPolicy struct{}
+
+func (lowerPolicy) ResolveKey(ctx context.Context, connector connectors.DBConnector, table, key string) (string, error) {
+	return strings.ToLower(key), nil
+}
+
+func (lowerPolicy) CheckWrite(key string, value interface{}, description string, tags []string) error {
+	if value == nil {
+		return errors.New("a value is required")
+	}
+	return nil
+}
+
+func (lowerPolicy) CheckNewKey(key string) error {
+	if strings.HasPrefix(key, "reserved.") {
+		return errors.New("reserved key")
+	}
+	return nil
+}
+
+func TestSubmitAndApprove(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.configs["feature.old"] = "on"
+	service := NewConfigService(store, nil, nil)
+
+	for _, req := range []SubmitRequest{
+		{Operation: OperationCreate, Key: "feature.flag", Value: "on", MakerID: "bob"},
+		{Operation: OperationUpdate, Key: "feature.flag", Value: "off", MakerID: "bob"},
+		{Operation: OperationDelete, Key: "feature.old", MakerID: "bob"},
+	} {
+		submitted, err := service.Submit(ctx, nil, req)
+		require.NoError(t, err)
+		assert.Equal(t, StatusSubmitted, submitted.Status)
+		assert.Equal(t, req.Operation, submitted.Operation)
+		assert.Len(t, submitted.RequestID, 32)
+
+		decision, err := service.Approve(ctx, nil, DecisionRequest{RequestID: submitted.RequestID, CheckerID: "carol", Comment: "LGTM"})
+		require.NoError(t, err)
+		assert.Equal(t, StatusApproved, decision.Status)
+		assert.Equal(t, "LGTM", decision.Comment)
+		assert.Equal(t, req.Operation+"d", decision.AppliedResult)
+		assert.Equal(t, Approval{RequestID: submitted.RequestID, CheckerID: "carol"}, store.approvals[len(store.approvals)-1])
+	}
+	assert.Equal(t, map[string]interface{}{"feature.flag": "off"}, store.configs)
+
+	_, err := service.Submit(ctx, nil, SubmitRequest{Operation: "upsert", Key: "feature.flag"})
+	assert.EqualError(t, err, "unsupported operation: upsert")
+}
+
+func TestApproveErrors(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	service := NewConfigService(store, nil, nil)
+
+	_, err := service.Approve(ctx, nil, DecisionRequest{RequestID: "req-9", CheckerID: "carol"})
+	assert.EqualError(t, err, "pending approval request not found: req-9")
+
+	// A change that no longer applies leaves the request pending
+	store.pending["req-1"] = &ApprovalRequest{RequestID: "req-1", Operation: OperationUpdate, Key: "missing"}
+	_, err = service.Approve(ctx, nil, DecisionRequest{RequestID: "req-1", CheckerID: "carol"})
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	assert.Contains(t, store.pending, "req-1")
+
+	store.err = errors.New("connection reset")
+	_, err = service.Approve(ctx, nil, DecisionRequest{RequestID: "req-1", CheckerID: "carol"})
+	assert.EqualError(t, err, "failed to get pending request: connection reset")
+}
+
+func TestDecide(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.pending["req-1"] = &ApprovalRequest{RequestID: "req-1", Operation: OperationCreate, Key: "feature.flag", Value: "on"}
+	service := NewConfigService(store, nil, nil)
+
+	_, err := service.Decide(ctx, nil, DecisionRequest{RequestID: "req-1"}, false)
+	assert.ErrorIs(t, err, ErrCheckerIDRequired)
+
+	decision, err := service.Decide(ctx, nil, DecisionRequest{RequestID: "req-1", CheckerID: "carol"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRejected, decision.Status)
+	assert.Nil(t, decision.AppliedResult)
+	assert.Equal(t, StatusRejected, store.decided["req-1"])
+	assert.Empty(t, store.configs)
+
+	_, err = service.Decide(ctx, nil, DecisionRequest{RequestID: "req-1", CheckerID: "carol"}, true)
+	assert.EqualError(t, err, "pending approval request not found: req-1")
+
+	store.err = errors.New("connection reset")
+	_, err = service.Decide(ctx, nil, DecisionRequest{RequestID: "req-1", CheckerID: "carol"}, true)
+	assert.EqualError(t, err, "failed to read approval request: connection reset")
+}
+
+func TestDirectWrites(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	service := NewConfigService(store, lowerPolicy{}, nil)
+
+	result, created, err := service.DirectSet(ctx, nil, SetRequest{Key: "Feature.Flag", Value: "on"})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "created", result)
+
+	_, created, err = service.DirectSet(ctx, nil, SetRequest{Key: "FEATURE.FLAG", Value: "off"})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, map[string]interface{}{"feature.flag": "off"}, store.configs)
+	assert.Empty(t, store.approvals)
+
+	config, err := service.Get(ctx, nil, ReadRequest{Key: "Feature.FLAG"})
+	require.NoError(t, err)
+	assert.Equal(t, "off", config.(map[string]interface{})["config_value"])
+
+	_, _, err = service.DirectSet(ctx, nil, SetRequest{Key: "feature.flag"})
+	assert.EqualError(t, err, "a value is required")
+	_, _, err = service.DirectSet(ctx, nil, SetRequest{Key: "reserved.flag", Value: "on"})
+	assert.EqualError(t, err, "reserved key")
+
+	_, err = service.DirectDelete(ctx, nil, DeleteRequest{Key: "Feature.Flag"})
+	require.NoError(t, err)
+	_, err = service.DirectDelete(ctx, nil, DeleteRequest{Key: "Feature.Flag"})
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	assert.EqualError(t, err, "config not found: feature.flag")
+
+	store.err = errors.New("connection reset")
+	_, _, err = service.DirectSet(ctx, nil, SetRequest{Key: "feature.flag", Value: "on"})
+	assert.EqualError(t, err, "failed to check config: connection reset")
+}
+
+func TestSubmitChecked(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.configs["feature.flag"] = "on"
+	service := NewConfigService(store, lowerPolicy{}, nil)
+
+	_, err := service.SubmitSet(ctx, nil, SetRequest{Key: "feature.flag", Value: "off"})
+	assert.ErrorIs(t, err, ErrMakerIDRequired)
+	_, err = service.SubmitDelete(ctx, nil, DeleteRequest{Key: "feature.flag"})
+	assert.ErrorIs(t, err, ErrMakerIDRequired)
+
+	submitted, err := service.SubmitSet(ctx, nil, SetRequest{Key: "Feature.Flag", Value: "off", MakerID: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, OperationUpdate, submitted.Operation)
+	assert.Equal(t, "feature.flag", submitted.Key)
+
+	submitted, err = service.SubmitSet(ctx, nil, SetRequest{Key: "feature.new", Value: "on", MakerID: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, OperationCreate, submitted.Operation)
+
+	_, err = service.SubmitDelete(ctx, nil, DeleteRequest{Key: "missing", MakerID: "bob"})
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	assert.Len(t, store.pending, 2)
+}
+
+func TestFirstConfig(t *testing.T) {
+	row := map[string]interface{}{"config_key": "feature.flag"}
+
+	config, ok := FirstConfig([]map[string]interface{}{row})
+	assert.True(t, ok)
+	assert.Equal(t, row, config)
+
+	config, ok = FirstConfig(row)
+	assert.True(t, ok)
+	assert.Equal(t, row, config)
+
+	_, ok = FirstConfig([]map[string]interface{}{})
+	assert.False(t, ok)
+	_, ok = FirstConfig(nil)
+	assert.False(t, ok)
+	_, ok = FirstConfig(map[string]interface{}(nil))
+	assert.False(t, ok)
+}
@@ -0,0 +1,67 @@
+package allconfig
+
+import (
+	"context"
+
+	"db-connectors/connectors"
+)
+
+// Store runs the statements of the allconfig operations on the database a connector is connected to.
+// Results are returned as the database gives them: SQL rows or MongoDB documents and write results.
+type Store interface {
+	// Submit stores a pending approval request with the ID
+	Submit(ctx context.Context, connector connectors.DBConnector, requestID string, req SubmitRequest) (interface{}, error)
+	// PendingRequest reads a pending approval request, returning ErrRequestNotFound when none is pending
+	PendingRequest(ctx context.Context, connector connectors.DBConnector, table, requestID string) (*ApprovalRequest, error)
+	// Decide records the status of a pending approval request, returning ErrRequestNotFound when none is pending
+	Decide(ctx context.Context, connector connectors.DBConnector, req DecisionRequest, status string) error
+
+	// Create writes a new approved config, returning ErrConfigExists when the key is taken
+	Create(ctx context.Context, connector connectors.DBConnector, req SetRequest) (interface{}, error)
+	// Update rewrites an approved config, returning ErrConfigNotFound when none is stored under the key
+	Update(ctx context.Context, connector connectors.DBConnector, req SetRequest) (interface{}, error)
+	// Delete deletes a config, returning ErrConfigNotFound when none is stored under the key
+	Delete(ctx context.Context, connector connectors.DBConnector, req DeleteRequest) (interface{}, error)
+
+	// Read reads an approved config that has not expired, returning ErrConfigNotFound when there is none
+	Read(ctx context.Context, connector connectors.DBConnector, req ReadRequest) (interface{}, error)
+	// Exists reports whether an approved config that has not expired is stored under the key
+	Exists(ctx context.Context, connector connectors.DBConnector, req ReadRequest) (bool, error)
+	// ReadAll lists the approved configs that have not expired in key order
+	ReadAll(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error)
+	// Search lists the approved configs that have not expired matching the search in key order
+	Search(ctx context.Context, connector connectors.DBConnector, req SearchRequest) (interface{}, error)
+
+	// Pending lists the pending approval requests, oldest first
+	Pending(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error)
+	// MyRequests lists the approval requests of a maker, newest first
+	MyRequests(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error)
+	// History lists the approved and rejected requests, most recently decided first
+	History(ctx context.Context, connector connectors.DBConnector, req ListRequest) (interface{}, error)
+}
+
+// Policy resolves the keys and checks the writes of the ConfigService methods taking requests that have
+// not been checked already
+type Policy interface {
+	// ResolveKey returns the key stored for key, such as its normalized form
+	ResolveKey(ctx context.Context, connector connectors.DBConnector, table, key string) (string, error)
+	// CheckWrite checks the value, description and tags written under a key
+	CheckWrite(key string, value interface{}, description string, tags []string) error
+	// CheckNewKey checks a key a write would create
+	CheckNewKey(key string) error
+}
+
+// openPolicy takes keys as given and lets every write through
+type openPolicy struct{}
+
+func (openPolicy) ResolveKey(ctx context.Context, connector connectors.DBConnector, table, key string) (string, error) {
+	return key, nil
+}
+
+func (openPolicy) CheckWrite(key string, value interface{}, description string, tags []string) error {
+	return nil
+}
+
+func (openPolicy) CheckNewKey(key string) error {
+	return nil
+}
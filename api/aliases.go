@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isAlias reports whether the operation names the spec by one of its aliases rather than its canonical name
+func (s *operationSpec) isAlias(operation string) bool {
+	return operation != s.Name
+}
+
+// aliasDeprecation returns the warning of a request naming the operation of spec by an alias. Aliases of
+// direct operations are called out as bypassing approval, as names such as update read like the audited path.
+func aliasDeprecation(spec *operationSpec, alias string) string {
+	warning := fmt.Sprintf("operation %q is a deprecated alias of %s; use %s", alias, spec.Name, spec.Name)
+	if strings.HasPrefix(spec.Name, "direct_") {
+		warning += ", which writes without approval"
+	}
+	return warning
+}
+
+// checkStrictOperation rejects a request naming its operation by an alias when strict_operations is set
+func (a *API) checkStrictOperation(req *AllConfigOperationRequest, spec *operationSpec) error {
+	if !a.strictOperations || !spec.isAlias(req.Operation) {
+		return nil
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeUnsupportedOperation,
+		Message: fmt.Sprintf("operation %q is an alias of %s, which strict_operations rejects: use %s", req.Operation, spec.Name, spec.Name),
+		Details: map[string]interface{}{"operation": req.Operation, "canonical": spec.Name},
+	}
+}
+
+// operationAliases describes the canonical name of each aliased operation for the OpenAPI specification
+func operationAliases(specs []operationSpec) string {
+	var mappings []string
+	for _, spec := range specs {
+		if len(spec.Aliases) > 0 {
+			mappings = append(mappings, fmt.Sprintf("%s (%s)", spec.Name, strings.Join(spec.Aliases, ", ")))
+		}
+	}
+	return "Canonical operation names, with their deprecated aliases in parentheses: " + strings.Join(mappings, "; ") +
+		". A request naming an alias is answered with a deprecation warning, or rejected when the server sets strict_operations"
+}
+
+// sendAllConfigSuccess responds with the result of an allconfig operation, warning in deprecation when the
+// request named the operation by an alias
+func (a *API) sendAllConfigSuccess(w http.ResponseWriter, req *AllConfigOperationRequest, spec *operationSpec, data interface{}, message string) {
+	response := DatabaseResponse{
+		Success:   true,
+		Message:   message,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	if spec.isAlias(req.Operation) {
+		response.Deprecation = aliasDeprecation(spec, req.Operation)
+	}
+	a.sendJSON(w, http.StatusOK, response)
+}
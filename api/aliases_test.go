@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// aliasRead returns a read of feature.flag named by operation and a connector serving it
+func aliasRead(t *testing.T, operation string) (*AllConfigOperationRequest, *connectortest.MockDBConnector) {
+	conn := newServiceConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("WHERE config_key = ?"), []interface{}{"feature.flag"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature.flag", "on"}), nil).Maybe()
+	req := &AllConfigOperationRequest{Operation: operation, Key: "feature.flag"}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	return req, conn
+}
+
+func TestOperationAliasesAccepted(t *testing.T) {
+	for _, operation := range []string{"read", "get_config"} {
+		req, conn := aliasRead(t, operation)
+		result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, req)
+		require.NoError(t, err, operation)
+		config, _ := allconfig.FirstConfig(result)
+		assert.Equal(t, "on", config.(map[string]interface{})["config_value"], operation)
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestAliasDeprecation(t *testing.T) {
+	respond := func(operation string) map[string]interface{} {
+		req := &AllConfigOperationRequest{Operation: operation}
+		spec := lookupOperation(allConfigOperationSpecs, operation, "mysql")
+		require.NotNil(t, spec, operation)
+		rr := httptest.NewRecorder()
+		NewAPI().sendAllConfigSuccess(rr, req, spec, map[string]interface{}{}, "done")
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response
+	}
+
+	assert.NotContains(t, respond("direct_update"), "deprecation")
+	assert.Equal(t, `operation "update" is a deprecated alias of direct_update; use direct_update, which writes without approval`,
+		respond("update")["deprecation"])
+	assert.Equal(t, `operation "get_config" is a deprecated alias of read; use read`, respond("get_config")["deprecation"])
+}
+
+func TestStrictOperations(t *testing.T) {
+	api := NewAPI()
+	api.strictOperations = true
+
+	req, conn := aliasRead(t, "get_config")
+	_, err := api.executeAllConfigOperation(context.Background(), conn, req)
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeUnsupportedOperation, apiErr.Code)
+	assert.Equal(t, `operation "get_config" is an alias of read, which strict_operations rejects: use read`, apiErr.Message)
+	assert.Equal(t, "read", apiErr.Details["canonical"])
+	conn.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything)
+
+	// Canonical names still run
+	req, conn = aliasRead(t, "read")
+	_, err = api.executeAllConfigOperation(context.Background(), conn, req)
+	assert.NoError(t, err)
+}
+
+func TestOperationAliasesDescribed(t *testing.T) {
+	description := operationAliases(allConfigOperationSpecs)
+	assert.Contains(t, description, "direct_create (create, set_config)")
+	assert.Contains(t, description, "direct_update (update)")
+	assert.Contains(t, description, "read (get_config)")
+	assert.NotContains(t, description, "submit_update")
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSQLArgs is the most placeholders a MySQL or PostgreSQL statement can bind
+const MaxSQLArgs = 65535
+
+// Types of the {"type": ..., "value": ...} wrappers an arg can be passed as
+var argTypes = []string{"int64", "float64", "decimal", "bytes", "timestamp"}
+
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// SQLArgs are the args bound to the placeholders of a SQL statement. Their numbers are decoded as written,
+// so that integers beyond the 2^53 a float64 holds exactly keep every digit until normalizeArgs binds them.
+type SQLArgs []interface{}
+
+// UnmarshalJSON decodes the args, keeping numbers as json.Number
+func (args *SQLArgs) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return err
+	}
+	*args = values
+	return nil
+}
+
+// normalizeArgs converts the args of a SQL statement to the values bound to its placeholders: integers to
+// int64, other numbers to float64 and wrapped values to their type. Arrays, objects other than wrappers and
+// more than MaxSQLArgs args fail with a 400 naming the offending arg.
+func normalizeArgs(args SQLArgs) (SQLArgs, error) {
+	if len(args) > MaxSQLArgs {
+		return nil, &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: fmt.Sprintf("at most %d args can be bound to a statement, got %d", MaxSQLArgs, len(args)),
+			Details: map[string]interface{}{"max_args": MaxSQLArgs, "args": len(args)},
+		}
+	}
+	if len(args) == 0 {
+		return args, nil
+	}
+	normalized := make(SQLArgs, len(args))
+	for i, arg := range args {
+		value, err := normalizeArg(arg)
+		if err != nil {
+			return nil, &apiError{
+				Status:  http.StatusBadRequest,
+				Code:    ErrorCodeValidation,
+				Message: fmt.Sprintf("args[%d]: %v", i, err),
+				Details: map[string]interface{}{"index": i},
+			}
+		}
+		normalized[i] = value
+	}
+	return normalized, nil
+}
+
+// normalizeArg converts one arg to the value bound to its placeholder
+func normalizeArg(arg interface{}) (interface{}, error) {
+	switch v := arg.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n, nil
+		}
+		if !strings.ContainsAny(string(v), ".eE") {
+			return nil, fmt.Errorf(`integer %s does not fit in 64 bits; pass it as {"type": "decimal", "value": "%s"}`, v, v)
+		}
+		return v.Float64()
+	case float64:
+		return integerValue(v), nil
+	case map[string]interface{}:
+		return unwrapArg(v)
+	case []interface{}:
+		return nil, fmt.Errorf(`arrays cannot be bound to a placeholder; pass each element as an arg`)
+	}
+	return arg, nil
+}
+
+// unwrapArg converts an arg passed as {"type": ..., "value": ...}, which carries values JSON has no exact
+// form for, such as integers beyond 2^53 as strings
+func unwrapArg(wrapper map[string]interface{}) (interface{}, error) {
+	argType, ok := wrapper["type"].(string)
+	value, hasValue := wrapper["value"]
+	if !ok || !hasValue || len(wrapper) != 2 {
+		return nil, fmt.Errorf(`objects cannot be bound to a placeholder; wrap a value as {"type": "int64", "value": "9007199254740993"}`)
+	}
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = string(v)
+	default:
+		return nil, fmt.Errorf("the value of a %s must be a string or a number", argType)
+	}
+
+	switch argType {
+	case "int64":
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int64 %q", text)
+		}
+		return n, nil
+	case "float64":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float64 %q", text)
+		}
+		return f, nil
+	case "decimal":
+		// Bound as text, which the database converts to its exact numeric type
+		if !decimalPattern.MatchString(text) {
+			return nil, fmt.Errorf("invalid decimal %q", text)
+		}
+		return text, nil
+	case "bytes":
+		b, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 bytes: %v", err)
+		}
+		return b, nil
+	case "timestamp":
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RFC 3339 timestamp %q", text)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported arg type %q, must be one of: %s", argType, strings.Join(argTypes, ", "))
+}
+
+// integerValue returns v as an int64 when it is a float64 holding an integer, so that it is bound and
+// formatted as one rather than in exponent form such as 1.5e+07; other values are returned as they are
+func integerValue(v interface{}) interface{} {
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) || math.Abs(f) >= math.MaxInt64 {
+		return v
+	}
+	return int64(f)
+}
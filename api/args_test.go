@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"db-connectors/allconfig"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeArgs decodes the args of an /execute request body
+func decodeArgs(t *testing.T, args string) SQLArgs {
+	t.Helper()
+	var req DatabaseOperationRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"args": `+args+`}`), &req))
+	return req.Args
+}
+
+func TestNormalizeArgs(t *testing.T) {
+	args, err := normalizeArgs(decodeArgs(t, `[9007199254740993, -42, 1.5, 2e3, "9007199254740993", true, null]`))
+	require.NoError(t, err)
+	assert.Equal(t, SQLArgs{int64(9007199254740993), int64(-42), 1.5, 2000.0, "9007199254740993", true, nil}, args)
+
+	// Args built in code rather than decoded bind whole floats as integers
+	args, err = normalizeArgs(SQLArgs{float64(7), 7.25, "seven"})
+	require.NoError(t, err)
+	assert.Equal(t, SQLArgs{int64(7), 7.25, "seven"}, args)
+
+	args, err = normalizeArgs(nil)
+	require.NoError(t, err)
+	assert.Empty(t, args)
+}
+
+func TestNormalizeWrappedArgs(t *testing.T) {
+	args, err := normalizeArgs(decodeArgs(t, `[
+		{"type": "int64", "value": "9223372036854775807"},
+		{"type": "int64", "value": 12},
+		{"type": "decimal", "value": "123456789012345678901234.5678"},
+		{"type": "float64", "value": "0.1"},
+		{"type": "bytes", "value": "aGVsbG8="},
+		{"type": "timestamp", "value": "2024-01-02T03:04:05Z"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, SQLArgs{
+		int64(9223372036854775807),
+		int64(12),
+		"123456789012345678901234.5678",
+		0.1,
+		[]byte("hello"),
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, args)
+}
+
+func TestNormalizeArgsRejects(t *testing.T) {
+	tests := []struct {
+		args    string
+		message string
+	}{
+		{`[1, [1, 2]]`, "args[1]: arrays cannot be bound to a placeholder; pass each element as an arg"},
+		{`["a", "b", {"id": 1}]`, `args[2]: objects cannot be bound to a placeholder; wrap a value as {"type": "int64", "value": "9007199254740993"}`},
+		{`[{"type": "int64", "value": "12.5"}]`, `args[0]: invalid int64 "12.5"`},
+		{`[{"type": "decimal", "value": "1e5"}]`, `args[0]: invalid decimal "1e5"`},
+		{`[{"type": "uuid", "value": "x"}]`, `args[0]: unsupported arg type "uuid", must be one of: int64, float64, decimal, bytes, timestamp`},
+		{`[{"type": "int64", "value": true}]`, "args[0]: the value of a int64 must be a string or a number"},
+		{`[18446744073709551616]`, `args[0]: integer 18446744073709551616 does not fit in 64 bits; pass it as {"type": "decimal", "value": "18446744073709551616"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			_, err := normalizeArgs(decodeArgs(t, tt.args))
+			var apiErr *apiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+			assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+			assert.Equal(t, tt.message, apiErr.Message)
+		})
+	}
+
+	_, err := normalizeArgs(make(SQLArgs, MaxSQLArgs+1))
+	assert.EqualError(t, err, fmt.Sprintf("at most %d args can be bound to a statement, got %d", MaxSQLArgs, MaxSQLArgs+1))
+}
+
+func TestExecuteBindsBigIntegers(t *testing.T) {
+	var req DatabaseOperationRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"operation": "insert",
+		"query": "INSERT INTO ledger (id, amount) VALUES (?, ?)",
+		"args": [9007199254740993, {"type": "decimal", "value": "10.05"}]
+	}`), &req))
+	_, err := runWrite(t, "mysql", &req, func(mockDB sqlmock.Sqlmock) {
+		mockDB.ExpectExec("INSERT INTO ledger").WithArgs(int64(9007199254740993), "10.05").WillReturnResult(sqlmock.NewResult(0, 1))
+	})
+	require.NoError(t, err)
+
+	// Rejected args name their index before anything runs
+	req.Args = SQLArgs{1, []interface{}{2, 3}}
+	_, err = runWrite(t, "mysql", &req, func(mockDB sqlmock.Sqlmock) {})
+	assert.EqualError(t, err, "args[1]: arrays cannot be bound to a placeholder; pass each element as an arg")
+}
+
+func TestBatchNormalizesArgs(t *testing.T) {
+	api := NewAPI()
+	req := BatchRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mysql", Host: "localhost", Port: 3306, Username: "app", Database: "shop"},
+		Statements: []BatchStatement{
+			{Query: "INSERT INTO ledger VALUES (?)", Args: decodeArgs(t, `[9007199254740993]`)},
+			{Query: "INSERT INTO ledger VALUES (?)", Args: decodeArgs(t, `[{"id": 1}]`)},
+		},
+	}
+	err := api.validateBatchRequest(&req)
+	assert.ErrorContains(t, err, "statement 1: args[0]: objects cannot be bound")
+	assert.Equal(t, SQLArgs{int64(9007199254740993)}, req.Statements[0].Args)
+}
+
+func TestConfigValuesBindIntegers(t *testing.T) {
+	api := NewAPI()
+	conn := newServiceConnector("mysql")
+	conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(map[string]interface{}{"rows_affected": 1}, nil)
+
+	// Whole numbers are stored as integers rather than in exponent form
+	_, err := api.submitConfigForApproval(context.Background(), conn, "req-1", allconfig.SubmitRequest{
+		Table: "allconfig", Operation: allconfig.OperationUpdate, Key: "limits.rows", Value: float64(15000000), MakerID: "bob",
+	})
+	require.NoError(t, err)
+	args := executedArgs(t, conn, "INSERT INTO allconfig_approval_requests")
+	assert.Equal(t, "15000000", args[2])
+	assert.Equal(t, int64(15), integerValue(15.0))
+	assert.Equal(t, 1.5, integerValue(1.5))
+	assert.Equal(t, "on", integerValue("on"))
+}
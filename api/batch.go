@@ -0,0 +1,409 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// BatchStatement is a single statement of an /execute-batch request
+type BatchStatement struct {
+	Operation string                 `json:"operation,omitempty"` // query, select, insert, update, delete, execute; inferred from the SQL when empty
+	Query     string                 `json:"query,omitempty"`     // For SQL databases
+	Args      SQLArgs                `json:"args,omitempty"`      // Query arguments for SQL
+	Params    map[string]interface{} `json:"params,omitempty"`    // For MongoDB operations
+}
+
+// BatchRequest represents a request to run several statements on one connection
+type BatchRequest struct {
+	DatabaseConnectionRequest
+	Statements    []BatchStatement `json:"statements"`
+	Transactional bool             `json:"transactional,omitempty"` // Run all statements in one transaction (SQL only)
+	StopOnError   *bool            `json:"stop_on_error,omitempty"` // Skip remaining statements after a failure, defaults to true
+	// For replaying retries
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // Alternative to the Idempotency-Key header
+}
+
+// BatchStatementResult reports the outcome of one batch statement
+type BatchStatementResult struct {
+	Index        int                      `json:"index"`
+	Operation    string                   `json:"operation"`
+	Success      bool                     `json:"success"`
+	Skipped      bool                     `json:"skipped,omitempty"`
+	Rows         []map[string]interface{} `json:"rows,omitempty"`
+	RowCount     *int                     `json:"row_count,omitempty"`
+	RowsAffected *int64                   `json:"rows_affected,omitempty"`
+	LastInsertID *int64                   `json:"last_insert_id,omitempty"`
+	Result       interface{}              `json:"result,omitempty"` // MongoDB operation result
+	Error        string                   `json:"error,omitempty"`
+	DurationMs   float64                  `json:"duration_ms"`
+}
+
+// BatchResult reports the outcome of a whole batch
+type BatchResult struct {
+	Transactional bool                   `json:"transactional"`
+	Committed     bool                   `json:"committed,omitempty"`
+	RolledBack    bool                   `json:"rolled_back,omitempty"`
+	Succeeded     int                    `json:"succeeded"`
+	Failed        int                    `json:"failed"`
+	Skipped       int                    `json:"skipped"`
+	Statements    []BatchStatementResult `json:"statements"`
+	DurationMs    float64                `json:"duration_ms"`
+}
+
+// maxBatchStatements limits the number of statements in one batch
+const maxBatchStatements = 100
+
+// sqlRunner is satisfied by both *sql.Conn and *sql.Tx
+type sqlRunner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ExecuteBatchHandler runs an ordered list of statements on a single connection
+func (a *API) ExecuteBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+
+	if err := a.validateBatchRequest(&req); err != nil {
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			a.sendError(w, policyErr.StatusCode, policyErr.Code, policyErr.Message)
+			return
+		}
+		a.sendRequestError(w, err)
+		return
+	}
+
+	connector, err := a.createConnector(&req.DatabaseConnectionRequest)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
+		return
+	}
+
+	release, ok := a.acquireSlot(w, r, a.connectionKey(&req.DatabaseConnectionRequest))
+	if !ok {
+		return
+	}
+	defer release()
+
+	if err := a.connectWithin(r.Context(), connector, &req.DatabaseConnectionRequest); err != nil {
+		a.sendDatabaseError(w, "Connection failed", err)
+		return
+	}
+	defer connector.Close(r.Context())
+
+	// executeBatch releases the connection and transaction before returning,
+	// so a failure while encoding the response cannot leak them
+	op := a.operationPhase(r.Context(), &req.DatabaseConnectionRequest)
+	defer op.cancel()
+	result, err := a.executeBatch(a.limitResults(op.ctx), connector, &req)
+	if req.writes() {
+		a.invalidateQueryCache(&req.DatabaseConnectionRequest)
+	}
+	if err != nil {
+		a.sendError(w, http.StatusInternalServerError, ErrorCodeDBError, fmt.Sprintf("Batch failed: %v", op.err(err)))
+		return
+	}
+
+	// Sensitive columns are masked unless the caller has the bypass role
+	if m := a.masker(r, a.connectionName(&req.DatabaseConnectionRequest)); m != nil {
+		for i := range result.Statements {
+			stmt := &result.Statements[i]
+			source := req.operationRequest(&req.Statements[stmt.Index]).maskSource()
+			if stmt.Rows != nil {
+				stmt.Rows = m.rows(source, stmt.Rows).([]map[string]interface{})
+			}
+			stmt.Result = m.rows(source, stmt.Result)
+		}
+	}
+
+	response := DatabaseResponse{
+		Success:   result.Failed == 0,
+		Data:      result,
+		Timestamp: time.Now(),
+	}
+	if result.Failed == 0 {
+		response.Message = "Batch executed successfully"
+	} else {
+		response.Error = fmt.Sprintf("%d of %d statements failed", result.Failed, len(result.Statements))
+	}
+	a.sendJSON(w, http.StatusOK, response)
+}
+
+// validateBatchRequest checks the connection fields, statements and statement policy
+func (a *API) validateBatchRequest(req *BatchRequest) error {
+	if err := a.validateConnectionRequest(&req.DatabaseConnectionRequest); err != nil {
+		return err
+	}
+	if len(req.Statements) == 0 {
+		return fmt.Errorf("at least one statement is required")
+	}
+	if len(req.Statements) > maxBatchStatements {
+		return fmt.Errorf("batch exceeds the limit of %d statements", maxBatchStatements)
+	}
+	if req.Transactional && req.Type == "mongodb" {
+		return fmt.Errorf("transactional batches are not supported for MongoDB")
+	}
+
+	for i := range req.Statements {
+		stmt := &req.Statements[i]
+		if req.Type == "mongodb" {
+			if stmt.Operation == "" {
+				return fmt.Errorf("statement %d: operation is required", i)
+			}
+		} else if stmt.Query == "" {
+			return fmt.Errorf("statement %d: query is required", i)
+		}
+		if isSQLType(req.Type) {
+			args, err := normalizeArgs(stmt.Args)
+			if err != nil {
+				return fmt.Errorf("statement %d: %w", i, err)
+			}
+			stmt.Args = args
+		}
+		if stmt.Operation != "" && isBuiltinType(req.Type) {
+			if _, err := checkOperation(batchOperationSpecs, stmt.Operation, req.Type, stmt, stmt.Params); err != nil {
+				return fmt.Errorf("statement %d: %w", i, err)
+			}
+		}
+
+		if err := a.policy.Check(req.operationRequest(stmt)); err != nil {
+			var policyErr *PolicyError
+			if errors.As(err, &policyErr) {
+				return &PolicyError{
+					StatusCode: policyErr.StatusCode,
+					Code:       policyErr.Code,
+					Message:    fmt.Sprintf("statement %d: %s", i, policyErr.Message),
+				}
+			}
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// operationRequest returns a statement of the batch as an /execute request
+func (req *BatchRequest) operationRequest(stmt *BatchStatement) *DatabaseOperationRequest {
+	return &DatabaseOperationRequest{
+		DatabaseConnectionRequest: req.DatabaseConnectionRequest,
+		Operation:                 stmt.Operation,
+		Query:                     stmt.Query,
+		Args:                      stmt.Args,
+		Params:                    stmt.Params,
+	}
+}
+
+// writes reports whether any statement of the batch may write
+func (req *BatchRequest) writes() bool {
+	for i := range req.Statements {
+		if class, _ := classifyOperation(req.operationRequest(&req.Statements[i])); class != StatementRead {
+			return true
+		}
+	}
+	return false
+}
+
+// executeBatch runs the batch and returns once every connection resource has been released
+func (a *API) executeBatch(ctx context.Context, connector connectors.DBConnector, req *BatchRequest) (*BatchResult, error) {
+	start := time.Now()
+	stopOnError := req.StopOnError == nil || *req.StopOnError
+
+	var (
+		result *BatchResult
+		err    error
+	)
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		result, err = a.executeSQLBatch(ctx, connector, req, stopOnError)
+	case "mongodb":
+		result = a.executeMongoBatch(ctx, connector, req, stopOnError)
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range result.Statements {
+		switch {
+		case stmt.Skipped:
+			result.Skipped++
+		case stmt.Success:
+			result.Succeeded++
+		default:
+			result.Failed++
+		}
+	}
+	result.DurationMs = durationMs(time.Since(start))
+	return result, nil
+}
+
+// executeSQLBatch runs SQL statements on one pooled connection, optionally inside a transaction
+func (a *API) executeSQLBatch(ctx context.Context, connector connectors.DBConnector, req *BatchRequest, stopOnError bool) (*BatchResult, error) {
+	sqlConnector, ok := connector.(connectors.SQLConnector)
+	if !ok || sqlConnector.DB() == nil {
+		return nil, fmt.Errorf("%s connector does not expose a SQL connection", connector.GetType())
+	}
+
+	// A dedicated connection keeps session state such as temporary tables between statements
+	conn, err := sqlConnector.DB().Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	result := &BatchResult{Transactional: req.Transactional}
+	if !req.Transactional {
+		a.runSQLStatements(ctx, conn, connector.GetType(), req.Statements, stopOnError, result)
+		return result, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Roll back on any early return or panic; a no-op after Commit
+	defer func() {
+		if !result.Committed {
+			if rbErr := tx.Rollback(); rbErr == nil {
+				result.RolledBack = true
+			}
+		}
+	}()
+
+	// A failed statement aborts the whole transaction, so remaining statements are always skipped
+	if failed := a.runSQLStatements(ctx, tx, connector.GetType(), req.Statements, true, result); failed {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	result.Committed = true
+	return result, nil
+}
+
+// runSQLStatements appends a result per statement and reports whether any statement failed
+func (a *API) runSQLStatements(ctx context.Context, runner sqlRunner, dbType string, statements []BatchStatement, stopOnError bool, result *BatchResult) bool {
+	failed := false
+	for i, stmt := range statements {
+		operation := stmt.Operation
+		if operation == "" {
+			operation = "execute"
+			if class, _ := ClassifySQL(dbType, stmt.Query); class == StatementRead {
+				operation = "query"
+			}
+		}
+
+		stmtResult := BatchStatementResult{Index: i, Operation: operation}
+		if failed && stopOnError {
+			stmtResult.Skipped = true
+			result.Statements = append(result.Statements, stmtResult)
+			continue
+		}
+
+		start := time.Now()
+		if err := a.runSQLStatement(ctx, runner, operation, stmt, &stmtResult); err != nil {
+			stmtResult.Error = err.Error()
+			failed = true
+		} else {
+			stmtResult.Success = true
+		}
+		stmtResult.DurationMs = durationMs(time.Since(start))
+		result.Statements = append(result.Statements, stmtResult)
+	}
+	return failed
+}
+
+// runSQLStatement executes one statement and fills in its result
+func (a *API) runSQLStatement(ctx context.Context, runner sqlRunner, operation string, stmt BatchStatement, stmtResult *BatchStatementResult) error {
+	switch operation {
+	case "query", "select":
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		rows, err := runner.QueryContext(ctx, stmt.Query, stmt.Args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		data, err := a.readResult(ctx, rows, cancel)
+		if err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		count := len(data)
+		stmtResult.Rows = data
+		stmtResult.RowCount = &count
+		return nil
+
+	case "insert", "update", "delete", "execute":
+		res, err := runner.ExecContext(ctx, stmt.Query, stmt.Args...)
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err == nil {
+			stmtResult.RowsAffected = &affected
+		}
+		// PostgreSQL does not support LastInsertId
+		if id, err := res.LastInsertId(); err == nil {
+			stmtResult.LastInsertID = &id
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported SQL operation: %s", operation)
+	}
+}
+
+// executeMongoBatch runs MongoDB operations in order through the connector
+func (a *API) executeMongoBatch(ctx context.Context, connector connectors.DBConnector, req *BatchRequest, stopOnError bool) *BatchResult {
+	result := &BatchResult{}
+	failed := false
+	for i, stmt := range req.Statements {
+		stmtResult := BatchStatementResult{Index: i, Operation: stmt.Operation}
+		if failed && stopOnError {
+			stmtResult.Skipped = true
+			result.Statements = append(result.Statements, stmtResult)
+			continue
+		}
+
+		params := stmt.Params
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+
+		start := time.Now()
+		data, err := connector.Execute(ctx, stmt.Operation, params)
+		if err != nil {
+			stmtResult.Error = err.Error()
+			failed = true
+		} else {
+			stmtResult.Success = true
+			stmtResult.Result = data
+		}
+		stmtResult.DurationMs = durationMs(time.Since(start))
+		result.Statements = append(result.Statements, stmtResult)
+	}
+	return result
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
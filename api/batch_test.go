@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// sqlMockConnector is a SQL connector backed by a sqlmock database
+type sqlMockConnector struct {
+	connectortest.MockDBConnector
+	dbType string
+	db     *sql.DB
+}
+
+func (c *sqlMockConnector) GetType() string { return c.dbType }
+func (c *sqlMockConnector) DB() *sql.DB     { return c.db }
+
+func (c *sqlMockConnector) Dialect() connectors.Dialect {
+	d, _ := connectors.DialectFor(c.dbType)
+	return d
+}
+
+func newSQLMockConnector(t *testing.T, dbType string) (*sqlMockConnector, sqlmock.Sqlmock) {
+	db, mockDB, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return &sqlMockConnector{dbType: dbType, db: db}, mockDB
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestExecuteBatchTransactionCommit(t *testing.T) {
+	api := NewAPI()
+	connector, mockDB := newSQLMockConnector(t, "mysql")
+
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec("CREATE TEMPORARY TABLE tmp").WillReturnResult(sqlmock.NewResult(0, 0))
+	mockDB.ExpectExec("INSERT INTO tmp").WithArgs(1).WillReturnResult(sqlmock.NewResult(7, 1))
+	mockDB.ExpectQuery("SELECT id FROM tmp").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mockDB.ExpectCommit()
+
+	result, err := api.executeBatch(context.Background(), connector, &BatchRequest{
+		Transactional: true,
+		Statements: []BatchStatement{
+			{Query: "CREATE TEMPORARY TABLE tmp (id INT)"},
+			{Operation: "insert", Query: "INSERT INTO tmp VALUES (?)", Args: []interface{}{1}},
+			{Query: "SELECT id FROM tmp"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, result.Committed)
+	assert.False(t, result.RolledBack)
+	assert.Equal(t, 3, result.Succeeded)
+	assert.Equal(t, 0, result.Failed)
+	require.Len(t, result.Statements, 3)
+	assert.Equal(t, "execute", result.Statements[0].Operation)
+	assert.Equal(t, int64(1), *result.Statements[1].RowsAffected)
+	assert.Equal(t, int64(7), *result.Statements[1].LastInsertID)
+	assert.Equal(t, "query", result.Statements[2].Operation)
+	assert.Equal(t, 1, *result.Statements[2].RowCount)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestExecuteBatchTransactionRollbackOnFailure(t *testing.T) {
+	api := NewAPI()
+	connector, mockDB := newSQLMockConnector(t, "postgresql")
+
+	mockDB.ExpectBegin()
+	mockDB.ExpectExec("INSERT INTO accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mockDB.ExpectExec("UPDATE accounts").WillReturnError(errors.New("constraint violation"))
+	mockDB.ExpectRollback()
+
+	// stop_on_error=false is ignored inside a transaction because the failure aborts it
+	result, err := api.executeBatch(context.Background(), connector, &BatchRequest{
+		Transactional: true,
+		StopOnError:   boolPtr(false),
+		Statements: []BatchStatement{
+			{Query: "INSERT INTO accounts VALUES (1)"},
+			{Query: "UPDATE accounts SET balance = -1"},
+			{Query: "SELECT * FROM accounts"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.False(t, result.Committed)
+	assert.True(t, result.RolledBack)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, "constraint violation", result.Statements[1].Error)
+	assert.True(t, result.Statements[2].Skipped)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestExecuteBatchStopOnError(t *testing.T) {
+	statements := []BatchStatement{
+		{Query: "UPDATE a SET x = 1"},
+		{Query: "UPDATE b SET x = 1"},
+		{Query: "UPDATE c SET x = 1"},
+	}
+
+	t.Run("continues when stop_on_error is false", func(t *testing.T) {
+		api := NewAPI()
+		connector, mockDB := newSQLMockConnector(t, "mysql")
+		mockDB.ExpectExec("UPDATE a").WillReturnResult(sqlmock.NewResult(0, 1))
+		mockDB.ExpectExec("UPDATE b").WillReturnError(errors.New("table b is locked"))
+		mockDB.ExpectExec("UPDATE c").WillReturnResult(sqlmock.NewResult(0, 2))
+
+		result, err := api.executeBatch(context.Background(), connector, &BatchRequest{
+			StopOnError: boolPtr(false),
+			Statements:  statements,
+		})
+		require.NoError(t, err)
+
+		assert.False(t, result.Transactional)
+		assert.Equal(t, 2, result.Succeeded)
+		assert.Equal(t, 1, result.Failed)
+		assert.Equal(t, 0, result.Skipped)
+		assert.Equal(t, int64(2), *result.Statements[2].RowsAffected)
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+
+	t.Run("stops by default", func(t *testing.T) {
+		api := NewAPI()
+		connector, mockDB := newSQLMockConnector(t, "mysql")
+		mockDB.ExpectExec("UPDATE a").WillReturnError(errors.New("table a is locked"))
+
+		result, err := api.executeBatch(context.Background(), connector, &BatchRequest{Statements: statements})
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, result.Failed)
+		assert.Equal(t, 2, result.Skipped)
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+}
+
+func TestExecuteBatchMongo(t *testing.T) {
+	api := NewAPI()
+	connector := new(connectortest.MockDBConnector)
+	connector.On("GetType").Return("mongodb")
+	connector.On("Execute", mock.Anything, "insert", mock.Anything).Return(map[string]interface{}{"inserted_id": "1"}, nil)
+	connector.On("Execute", mock.Anything, "find", mock.Anything).Return(nil, errors.New("bad filter"))
+
+	result, err := api.executeBatch(context.Background(), connector, &BatchRequest{
+		StopOnError: boolPtr(false),
+		Statements: []BatchStatement{
+			{Operation: "insert", Params: map[string]interface{}{"collection": "users"}},
+			{Operation: "find"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, "bad filter", result.Statements[1].Error)
+	connector.AssertExpectations(t)
+}
+
+func TestValidateBatchRequest(t *testing.T) {
+	base := DatabaseConnectionRequest{Type: "mysql", Host: "localhost", Port: 3306, Database: "testdb"}
+	mongo := DatabaseConnectionRequest{Type: "mongodb", Host: "localhost", Port: 27017, Database: "testdb"}
+
+	api := NewAPI()
+	assert.NoError(t, api.validateBatchRequest(&BatchRequest{
+		DatabaseConnectionRequest: base,
+		Statements:                []BatchStatement{{Query: "SELECT 1"}},
+	}))
+	assert.Error(t, api.validateBatchRequest(&BatchRequest{DatabaseConnectionRequest: base}))
+	assert.Error(t, api.validateBatchRequest(&BatchRequest{
+		DatabaseConnectionRequest: base,
+		Statements:                []BatchStatement{{Operation: "query"}},
+	}))
+	assert.Error(t, api.validateBatchRequest(&BatchRequest{
+		DatabaseConnectionRequest: mongo,
+		Transactional:             true,
+		Statements:                []BatchStatement{{Operation: "find"}},
+	}))
+
+	// Every statement is checked against the statement policy
+	err := api.validateBatchRequest(&BatchRequest{
+		DatabaseConnectionRequest: base,
+		Statements:                []BatchStatement{{Query: "SELECT 1"}, {Query: "DROP TABLE users"}},
+	})
+	var policyErr *PolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, http.StatusForbidden, policyErr.StatusCode)
+	assert.Contains(t, policyErr.Message, "statement 1")
+}
+
+func TestExecuteBatchHandlerRejectsInvalidRequests(t *testing.T) {
+	api := NewAPI()
+
+	rr := httptest.NewRecorder()
+	api.ExecuteBatchHandler(rr, httptest.NewRequest(http.MethodGet, "/execute-batch", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	body := `{"type":"mysql","host":"localhost","port":3306,"database":"testdb","statements":[]}`
+	api.ExecuteBatchHandler(rr, httptest.NewRequest(http.MethodPost, "/execute-batch", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestSendJSONEncodingFailure(t *testing.T) {
+	api := NewAPI()
+	rr := httptest.NewRecorder()
+
+	api.sendSuccess(rr, map[string]interface{}{"value": math.NaN()}, "ok")
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to encode response")
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// bodyLimitMiddleware rejects requests whose declared Content-Length exceeds the limit with
+// 413 Request Entity Too Large and caps the bytes read from bodies of unknown length
+func (a *API) bodyLimitMiddleware(next http.Handler) http.Handler {
+	if a.maxRequestBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > a.maxRequestBytes {
+			a.sendError(w, http.StatusRequestEntityTooLarge, ErrorCodePayloadTooLarge, fmt.Sprintf("Request body exceeds the limit of %d bytes", a.maxRequestBytes))
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, a.maxRequestBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
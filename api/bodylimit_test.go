@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	api := NewAPI()
+	api.maxRequestBytes = 16
+	var read string
+	handler := api.bodyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			api.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+			return
+		}
+		read = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"type":"mysql"}`)))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, `{"type":"mysql"}`, read)
+
+	// A declared length over the limit is rejected before the handler runs
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"type":"postgresql"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodePayloadTooLarge, response.ErrorCode)
+	assert.Equal(t, "Request body exceeds the limit of 16 bytes", response.Error)
+
+	// Bodies of unknown length are cut off at the limit
+	req := httptest.NewRequest(http.MethodPost, "/execute", io.NopCloser(strings.NewReader(`{"type":"postgresql"}`)))
+	req.ContentLength = -1
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "request body too large")
+}
+
+func TestBodyLimitDisabledByDefault(t *testing.T) {
+	body := strings.Repeat("x", 1<<20)
+	rr := httptest.NewRecorder()
+	SetupRoutes(NewAPI()).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/execute", strings.NewReader(body)))
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
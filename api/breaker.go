@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"    // Requests connect as usual
+	CircuitOpen     = "open"      // Requests fail right away with CIRCUIT_OPEN
+	CircuitHalfOpen = "half_open" // One probe request connects; the others fail right away
+)
+
+// Default circuit breaker settings
+const (
+	DefaultBreakerFailureRate = 0.5
+	DefaultBreakerMinRequests = 5
+	DefaultBreakerWindow      = 20
+	DefaultBreakerCooldown    = 30 * time.Second
+)
+
+// CircuitBreaker configures the breakers guarding the connections to each database. A breaker opens once
+// the share of connects failing to reach the database among the last Window reaches FailureRate, after
+// which requests fail right away instead of each waiting out the connect timeout. After Cooldown it lets a
+// probe request through, whose success closes it again and whose failure opens it for another Cooldown.
+type CircuitBreaker struct {
+	FailureRate float64       // Zero keeps the default
+	MinRequests int           // Connects in the window before the breaker may open; zero keeps the default
+	Window      int           // Latest connects the failure rate is computed over; zero keeps the default
+	Cooldown    time.Duration // Zero keeps the default; negative disables the breakers
+	IdleTTL     time.Duration // Closed breakers without connects for this long are forgotten; zero keeps DefaultLimiterIdleTTL
+}
+
+// BreakerStats reports the breaker of one connection
+type BreakerStats struct {
+	State        string     `json:"state"`
+	Requests     int        `json:"requests"` // Connects in the window
+	Failures     int        `json:"failures"` // Connects in the window that failed to reach the database
+	OpenedAt     *time.Time `json:"opened_at,omitempty"`
+	RetryAfterMs int64      `json:"retry_after_ms,omitempty"` // Until a probe is let through, while open
+	LastError    string     `json:"last_error,omitempty"`     // Of the last failed connect
+}
+
+// breaker is the state of the breaker of one connection
+type breaker struct {
+	state     string
+	outcomes  []bool // Latest connects in order, true for failures
+	failures  int
+	openedAt  time.Time
+	probing   bool // A probe is connecting while half open
+	lastError string
+	lastUsed  time.Time
+}
+
+// circuitBreakers holds the breaker of each connection, keyed by connectionKey
+type circuitBreakers struct {
+	CircuitBreaker
+	now       func() time.Time
+	mu        sync.Mutex
+	breakers  map[string]*breaker
+	lastSweep time.Time
+}
+
+// newCircuitBreakers creates the breakers, filling unset settings with their defaults; a negative Cooldown
+// returns nil, which lets every request through
+func newCircuitBreakers(cb CircuitBreaker) *circuitBreakers {
+	if cb.Cooldown < 0 {
+		return nil
+	}
+	if cb.FailureRate <= 0 {
+		cb.FailureRate = DefaultBreakerFailureRate
+	}
+	if cb.MinRequests <= 0 {
+		cb.MinRequests = DefaultBreakerMinRequests
+	}
+	if cb.Window <= 0 {
+		cb.Window = DefaultBreakerWindow
+	}
+	cb.MinRequests = min(cb.MinRequests, cb.Window)
+	if cb.Cooldown == 0 {
+		cb.Cooldown = DefaultBreakerCooldown
+	}
+	if cb.IdleTTL <= 0 {
+		cb.IdleTTL = DefaultLimiterIdleTTL
+	}
+	return &circuitBreakers{CircuitBreaker: cb, now: time.Now, breakers: map[string]*breaker{}}
+}
+
+// allow reports whether a request may connect to the connection named key, returning a CIRCUIT_OPEN
+// error when its breaker is open. Once the cooldown has passed the request is let through as the probe.
+func (c *circuitBreakers) allow(key string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[key]
+	if !ok {
+		return nil
+	}
+	b.lastUsed = c.now()
+	switch b.state {
+	case CircuitOpen:
+		if wait := c.retryAfter(b); wait > 0 {
+			return c.open(key, b, wait)
+		}
+		b.state, b.probing = CircuitHalfOpen, true
+	case CircuitHalfOpen:
+		if b.probing {
+			return c.open(key, b, 0)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record counts the outcome of a connect to the connection named key allowed by allow, returning the state
+// the breaker moved to, if any. Only failures to reach the database count against it; a database rejecting
+// the credentials is still up. Connects the caller gave up on count neither way.
+func (c *circuitBreakers) record(key string, err error) (state string, changed bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[key]
+	if errors.Is(err, context.Canceled) {
+		if ok {
+			// Let the next request probe instead
+			b.probing = false
+		}
+		return "", false
+	}
+	failed := unreachable(err)
+	if !ok {
+		if !failed {
+			return "", false
+		}
+		c.sweep(c.now())
+		b = &breaker{state: CircuitClosed}
+		c.breakers[key] = b
+	}
+	b.lastUsed = c.now()
+	if failed {
+		b.lastError = connectionFailureMessage("Connection failed", err)
+	}
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.probing = false
+		if failed {
+			b.state, b.openedAt = CircuitOpen, c.now()
+			return CircuitOpen, true
+		}
+		b.state, b.outcomes, b.failures = CircuitClosed, nil, 0
+		return CircuitClosed, true
+	case CircuitClosed:
+		b.outcomes = append(b.outcomes, failed)
+		if failed {
+			b.failures++
+		}
+		if len(b.outcomes) > c.Window {
+			if b.outcomes[0] {
+				b.failures--
+			}
+			b.outcomes = b.outcomes[1:]
+		}
+		if len(b.outcomes) >= c.MinRequests && float64(b.failures) >= c.FailureRate*float64(len(b.outcomes)) {
+			b.state, b.openedAt = CircuitOpen, c.now()
+			return CircuitOpen, true
+		}
+	}
+	return "", false
+}
+
+// sweep forgets closed breakers without connects for IdleTTL, at most once per IdleTTL, so that a client
+// failing to reach ever new databases cannot grow the breakers without bound; callers hold c.mu. Open and
+// half-open breakers are kept, as forgetting them would let requests through to a database that is down.
+func (c *circuitBreakers) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.IdleTTL {
+		return
+	}
+	c.lastSweep = now
+	for key, b := range c.breakers {
+		if b.state == CircuitClosed && now.Sub(b.lastUsed) >= c.IdleTTL {
+			delete(c.breakers, key)
+		}
+	}
+}
+
+// retryAfter returns how long an open breaker keeps rejecting requests
+func (c *circuitBreakers) retryAfter(b *breaker) time.Duration {
+	return max(b.openedAt.Add(c.Cooldown).Sub(c.now()), 0)
+}
+
+// open returns the CIRCUIT_OPEN error of a request rejected by the breaker of the connection named key.
+// Requests rejected while a probe connects are told to retry in a second.
+func (c *circuitBreakers) open(key string, b *breaker, wait time.Duration) error {
+	if wait <= 0 {
+		wait = time.Second
+	}
+	return &apiError{
+		Status:  http.StatusServiceUnavailable,
+		Code:    ErrorCodeCircuitOpen,
+		Message: fmt.Sprintf("Circuit breaker for %s is %s after repeated connection failures, retry after %s", key, b.state, wait.Round(time.Millisecond)),
+		Details: map[string]interface{}{
+			"connection":     key,
+			"state":          b.state,
+			"retry_after_ms": wait.Milliseconds(),
+			"last_error":     b.lastError,
+		},
+		RetryAfter: wait,
+	}
+}
+
+// stats returns the breaker of every connection that failed to connect so far, by connectionKey
+func (c *circuitBreakers) stats() map[string]BreakerStats {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make(map[string]BreakerStats, len(c.breakers))
+	for key, b := range c.breakers {
+		s := BreakerStats{State: b.state, Requests: len(b.outcomes), Failures: b.failures, LastError: b.lastError}
+		if b.state != CircuitClosed {
+			openedAt := b.openedAt
+			s.OpenedAt = &openedAt
+		}
+		if b.state == CircuitOpen {
+			s.RetryAfterMs = c.retryAfter(b).Milliseconds()
+		}
+		stats[key] = s
+	}
+	return stats
+}
+
+// unreachable reports whether a connect failed to reach the database at all
+func unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var phaseErr *phaseTimeoutError
+	if errors.As(err, &phaseErr) {
+		return true
+	}
+	switch connectors.ClassifyError(err) {
+	case connectors.ErrorClassDNS, connectors.ErrorClassHostUnreachable, connectors.ErrorClassTimeout:
+		return true
+	}
+	return false
+}
+
+// guardConnect connects through the circuit breaker of the connection named key, failing right away with
+// CIRCUIT_OPEN while it is open. A profile whose breaker opens is marked unhealthy until it closes.
+func (a *API) guardConnect(key string, connect func() error) error {
+	if err := a.breakers.allow(key); err != nil {
+		return err
+	}
+	err := connect()
+	if state, changed := a.breakers.record(key, err); changed {
+		if state == CircuitOpen {
+			a.registry.MarkHealth(key, err)
+		} else {
+			a.registry.MarkHealth(key, nil)
+		}
+	}
+	return err
+}
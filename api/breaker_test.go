@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// breakersAt returns breakers whose clock reads *now
+func breakersAt(cb CircuitBreaker, now *time.Time) *circuitBreakers {
+	c := newCircuitBreakers(cb)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+// requireCircuitOpen asserts that err is a CIRCUIT_OPEN rejection asking to retry after wait
+func requireCircuitOpen(t *testing.T, err error, wait time.Duration) {
+	t.Helper()
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.Status)
+	assert.Equal(t, ErrorCodeCircuitOpen, apiErr.Code)
+	assert.Equal(t, wait, apiErr.RetryAfter)
+}
+
+func TestCircuitBreakerStateMachine(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := breakersAt(CircuitBreaker{FailureRate: 0.5, MinRequests: 3, Window: 4, Cooldown: 10 * time.Second}, &now)
+
+	// Successes alone leave no breaker behind
+	c.record("primary", nil)
+	assert.Empty(t, c.stats())
+
+	// Closed until the window holds enough connects failing at the rate
+	c.record("primary", refused)
+	c.record("primary", nil)
+	require.NoError(t, c.allow("primary"))
+	c.record("primary", refused)
+	stats := c.stats()["primary"]
+	assert.Equal(t, CircuitOpen, stats.State)
+	assert.Equal(t, 3, stats.Requests)
+	assert.Equal(t, 2, stats.Failures)
+	assert.Equal(t, int64(10000), stats.RetryAfterMs)
+	assert.Contains(t, stats.LastError, "connection refused")
+
+	// Open rejects requests until the cooldown passes
+	now = now.Add(4 * time.Second)
+	requireCircuitOpen(t, c.allow("primary"), 6*time.Second)
+
+	// Half open lets a single probe through; its failure opens the breaker again
+	now = now.Add(6 * time.Second)
+	require.NoError(t, c.allow("primary"))
+	assert.Equal(t, CircuitHalfOpen, c.stats()["primary"].State)
+	requireCircuitOpen(t, c.allow("primary"), time.Second)
+	c.record("primary", refused)
+	assert.Equal(t, CircuitOpen, c.stats()["primary"].State)
+	requireCircuitOpen(t, c.allow("primary"), 10*time.Second)
+
+	// A successful probe closes it with an empty window
+	now = now.Add(10 * time.Second)
+	require.NoError(t, c.allow("primary"))
+	c.record("primary", nil)
+	assert.Equal(t, BreakerStats{State: CircuitClosed, LastError: stats.LastError}, c.stats()["primary"])
+	require.NoError(t, c.allow("primary"))
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	now := time.Now()
+	c := breakersAt(CircuitBreaker{FailureRate: 0.75, MinRequests: 2, Window: 4}, &now)
+
+	// Failures slide out of the window as connects succeed
+	c.record("primary", refused)
+	for i := 0; i < 4; i++ {
+		c.record("primary", nil)
+	}
+	assert.Equal(t, BreakerStats{State: CircuitClosed, Requests: 4, LastError: c.stats()["primary"].LastError}, c.stats()["primary"])
+	c.record("primary", refused)
+	c.record("primary", refused)
+	assert.Equal(t, CircuitClosed, c.stats()["primary"].State, "2 of 4 is below the rate")
+	c.record("primary", refused)
+	assert.Equal(t, CircuitOpen, c.stats()["primary"].State)
+}
+
+func TestCircuitBreakerEvictsIdle(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := breakersAt(CircuitBreaker{FailureRate: 0.75, MinRequests: 2, Window: 2, Cooldown: time.Hour, IdleTTL: time.Minute}, &now)
+
+	c.record("mysql://db-1:3306/app", refused)
+	c.record("mysql://db-1:3306/app", nil)
+	assert.Equal(t, CircuitClosed, c.stats()["mysql://db-1:3306/app"].State)
+	c.record("mysql://db-2:3306/app", refused)
+	c.record("mysql://db-2:3306/app", refused)
+	assert.Equal(t, CircuitOpen, c.stats()["mysql://db-2:3306/app"].State)
+
+	// The closed breaker is forgotten once idle, the open one is kept so the database stays guarded
+	now = now.Add(2 * time.Minute)
+	c.record("mysql://db-3:3306/app", refused)
+	assert.NotContains(t, c.stats(), "mysql://db-1:3306/app")
+	assert.Equal(t, CircuitOpen, c.stats()["mysql://db-2:3306/app"].State)
+	requireCircuitOpen(t, c.allow("mysql://db-2:3306/app"), 58*time.Minute)
+}
+
+func TestCircuitBreakerIgnores(t *testing.T) {
+	now := time.Now()
+	c := breakersAt(CircuitBreaker{MinRequests: 1}, &now)
+
+	// A database rejecting the credentials is up
+	c.record("primary", &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'app'"})
+	assert.Empty(t, c.stats())
+
+	// A probe the caller gave up on lets the next request probe
+	c.record("primary", refused)
+	now = now.Add(DefaultBreakerCooldown)
+	require.NoError(t, c.allow("primary"))
+	c.record("primary", context.Canceled)
+	require.NoError(t, c.allow("primary"))
+
+	// Disabled breakers let everything through
+	c = newCircuitBreakers(CircuitBreaker{Cooldown: -1})
+	assert.Nil(t, c)
+	c.record("primary", refused)
+	assert.NoError(t, c.allow("primary"))
+	assert.Nil(t, c.stats())
+
+	c = newCircuitBreakers(CircuitBreaker{})
+	assert.Equal(t, DefaultLimiterIdleTTL, c.IdleTTL)
+}
+
+func TestExecuteCircuitBreaker(t *testing.T) {
+	// The database refuses two connects, then is back
+	fakeDriverConnector = new(connectortest.MockDBConnector)
+	fakeDriverConnector.On("Connect", mock.Anything).Return(refused).Twice()
+	fakeDriverConnector.On("Connect", mock.Anything).Return(nil)
+	fakeDriverConnector.On("Close").Return(nil)
+	fakeDriverConnector.On("GetType").Return(fakeDriver)
+	fakeDriverConnector.On("Execute", mock.Anything, "get", mock.Anything).Return(map[string]interface{}{"value": "alice"}, nil)
+
+	api := NewServer(config.ServerConfig{}, WithCircuitBreaker(CircuitBreaker{MinRequests: 2})).API()
+	now := time.Now()
+	api.breakers.now = func() time.Time { return now }
+	handler := SetupRoutes(api)
+	execute := func() *httptest.ResponseRecorder {
+		data, err := json.Marshal(map[string]interface{}{
+			"type": fakeDriver, "host": "kv.internal", "port": 7000, "database": "sessions",
+			"operation": "get", "params": map[string]interface{}{"key": "user:1"},
+		})
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewReader(data)))
+		return rr
+	}
+
+	assert.Equal(t, http.StatusBadGateway, execute().Code)
+	assert.Equal(t, http.StatusBadGateway, execute().Code)
+
+	// The breaker is open, so the next request fails without connecting
+	rr := execute()
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeCircuitOpen, response.ErrorCode)
+	assert.Equal(t, "fakekv://kv.internal:7000/sessions", response.Details["connection"])
+	assert.Equal(t, CircuitOpen, response.Details["state"])
+	fakeDriverConnector.AssertNumberOfCalls(t, "Connect", 2)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var metrics struct {
+		Data Metrics `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &metrics))
+	assert.Equal(t, CircuitOpen, metrics.Data.Circuits["fakekv://kv.internal:7000/sessions"].State)
+
+	// After the cooldown a probe reaches the database and closes the breaker
+	now = now.Add(DefaultBreakerCooldown)
+	rr = execute()
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, CircuitClosed, api.breakers.stats()["fakekv://kv.internal:7000/sessions"].State)
+}
+
+func TestProfileCircuitBreaker(t *testing.T) {
+	conn := new(connectortest.MockDBConnector)
+	conn.On("IsConnected").Return(false)
+	conn.On("GetType").Return("mysql")
+	conn.On("Connect", mock.Anything).Return(refused)
+	api := NewServer(config.ServerConfig{},
+		WithCircuitBreaker(CircuitBreaker{MinRequests: 1}),
+		WithProfile(ConnectionProfile{Name: "primary", Connector: conn}),
+	).API()
+	handler := SetupRoutes(api)
+
+	rr := serveConfigs(handler, http.MethodGet, "/v1/configs", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), ErrorCodeHostUnreachable)
+
+	rr = serveConfigs(handler, http.MethodGet, "/v1/configs", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), ErrorCodeCircuitOpen)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	conn.AssertNumberOfCalls(t, "Connect", 1)
+
+	// /v1/connections shows the breaker of the profile
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/connections", nil))
+	var response struct {
+		Data []ConnectionInfo `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Data, 1)
+	require.NotNil(t, response.Data[0].Circuit)
+	assert.Equal(t, CircuitOpen, response.Data[0].Circuit.State)
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"db-connectors/connectors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultUpsertChunkSize is the number of config items written by one upsert statement or bulkWrite when the
+// request does not set chunk_size
+const defaultUpsertChunkSize = 500
+
+// maxBulkWriteOperations is the most writes MongoDB accepts in one bulkWrite
+const maxBulkWriteOperations = 100000
+
+// upsertArgsPerRow is the number of bind parameters of each row of a multi-row upsert: the key, value,
+// description, tags and maker; the status and timestamps are literals
+const upsertArgsPerRow = 5
+
+// BulkUpsertResult counts the configs written by the multi-row upserts of a batch
+type BulkUpsertResult struct {
+	ChunkSize  int   `json:"chunk_size"` // Items per statement or bulkWrite
+	Statements int   `json:"statements"` // Statements (SQL) or bulkWrite commands (MongoDB) run
+	Inserted   int64 `json:"inserted"`
+	Updated    int64 `json:"updated"`
+}
+
+// sqlUpsertDialect builds the multi-row upserts of a SQL database
+type sqlUpsertDialect struct {
+	connectors.Dialect
+	maxPlaceholders int    // Bind parameters one statement may hold
+	returning       string // Clause reporting whether each row was inserted, when supported
+}
+
+// sqlUpsertDialects holds the upsert helper of each SQL database type; other types write one config at a time
+var sqlUpsertDialects = map[string]*sqlUpsertDialect{
+	"mysql": {
+		Dialect:         connectors.MySQLDialect{},
+		maxPlaceholders: 65535,
+	},
+	"postgresql": {
+		Dialect:         connectors.PostgreSQLDialect{},
+		maxPlaceholders: 65535,
+		returning:       "RETURNING (xmax = 0) AS inserted",
+	},
+}
+
+// conflict returns the clause updating the rows of the table whose key already exists. Items without
+// tags keep the tags already stored.
+func (d *sqlUpsertDialect) conflict(table string) string {
+	now := d.NowFunc()
+	return d.UpsertClause([]string{"config_key"},
+		"config_value = "+d.Excluded("config_value"),
+		"description = "+d.Excluded("description"),
+		"tags = COALESCE("+d.Excluded("tags")+", "+table+".tags)",
+		"status = 'approved'",
+		"maker_id = "+d.Excluded("maker_id"),
+		"updated_at = "+now,
+		"approved_at = "+now)
+}
+
+// chunkRows returns the rows of each statement for the requested chunk size, capped so that a statement
+// never holds more bind parameters than the database accepts
+func (d *sqlUpsertDialect) chunkRows(requested int) int {
+	if requested <= 0 {
+		requested = defaultUpsertChunkSize
+	}
+	if max := d.maxPlaceholders / upsertArgsPerRow; requested > max {
+		return max
+	}
+	return requested
+}
+
+// statement builds the upsert of items into table with its args
+func (d *sqlUpsertDialect) statement(table string, items []ConfigItem) (string, []interface{}) {
+	var query strings.Builder
+	query.WriteString("INSERT INTO " + table + " (config_key, config_value, description, tags, status, maker_id, created_at, updated_at, approved_at) VALUES ")
+	args := make([]interface{}, 0, len(items)*upsertArgsPerRow)
+	for i, item := range items {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n, now := len(args), d.NowFunc()
+		fmt.Fprintf(&query, "(%s, %s, %s, %s, 'approved', %s, %s, %s, %s)",
+			d.Placeholder(n+1), d.Placeholder(n+2), d.Placeholder(n+3), d.Placeholder(n+4), d.Placeholder(n+5), now, now, now)
+		args = append(args, item.Key, integerValue(item.Value), item.Description, tagsArg(item.Tags), item.MakerID)
+	}
+	query.WriteString(" " + d.conflict(table))
+	if d.returning != "" {
+		query.WriteString(" " + d.returning)
+	}
+	return query.String(), args
+}
+
+// configMapItems returns the configs of a map as items in key order
+func configMapItems(configs map[string]interface{}) []ConfigItem {
+	keys := sortedConfigKeys(configs)
+	items := make([]ConfigItem, len(keys))
+	for i, key := range keys {
+		items[i] = ConfigItem{Key: key, Value: configs[key]}
+	}
+	return items
+}
+
+// upsertMultipleConfigsDirect creates or updates multiple configurations directly with approved status, writing
+// each chunk of items with one multi-row statement (SQL) or bulkWrite (MongoDB). Database types without an
+// upsert helper fall back to creating one config at a time.
+func (a *API) upsertMultipleConfigsDirect(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem, chunkSize int, opts configBatchOptions) (interface{}, error) {
+	dialect := sqlUpsertDialects[connector.GetType()]
+	switch {
+	case dialect != nil:
+		chunkSize = dialect.chunkRows(chunkSize)
+	case connector.GetType() == "mongodb":
+		if chunkSize <= 0 {
+			chunkSize = defaultUpsertChunkSize
+		}
+		if chunkSize > maxBulkWriteOperations {
+			chunkSize = maxBulkWriteOperations
+		}
+	default:
+		return a.createMultipleConfigsDirect(ctx, connector, tableName, configs, opts)
+	}
+
+	var mu sync.Mutex
+	counts := &BulkUpsertResult{ChunkSize: chunkSize}
+	result, err := a.runConfigChunks(ctx, connector, configItemKeys(configs), opts, chunkSize, func(ctx context.Context, connector connectors.DBConnector, lo, hi int) (interface{}, error) {
+		previous := a.previousValueHashes(ctx, connector, tableName, configs[lo:hi])
+		inserted, updated, err := a.upsertConfigChunk(ctx, connector, dialect, tableName, configs[lo:hi])
+		if err != nil {
+			return nil, err
+		}
+		a.recordConfigWrites(ctx, connector, tableName, configs[lo:hi], previous)
+		mu.Lock()
+		defer mu.Unlock()
+		counts.Statements++
+		counts.Inserted += inserted
+		counts.Updated += updated
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.RolledBack {
+		counts.Inserted, counts.Updated = 0, 0
+	}
+	result.Upserts = counts
+	return result, nil
+}
+
+// upsertConfigChunk writes items with one statement or bulkWrite, returning how many were inserted and updated
+func (a *API) upsertConfigChunk(ctx context.Context, connector connectors.DBConnector, dialect *sqlUpsertDialect, tableName string, items []ConfigItem) (int64, int64, error) {
+	n := int64(len(items))
+
+	// A dry run records the write instead of running it, so count the keys it would update up front
+	if _, dryRun := connector.(*dryRunConnector); dryRun {
+		existing, err := a.countExistingConfigs(ctx, connector, tableName, configItemKeys(items))
+		if err != nil {
+			return 0, 0, err
+		}
+		if dialect != nil {
+			query, args := dialect.statement(sqlTable(ctx, tableName), items)
+			_, err = connector.Execute(ctx, "execute", map[string]interface{}{"query": query, "args": args})
+		} else {
+			_, err = connector.Execute(ctx, "bulkWrite", upsertBulkWriteParams(tableName, items))
+		}
+		return n - existing, existing, err
+	}
+
+	if dialect == nil {
+		result, err := connector.Execute(ctx, "bulkWrite", upsertBulkWriteParams(tableName, items))
+		if err != nil {
+			return 0, 0, err
+		}
+		bulk, ok := result.(*mongo.BulkWriteResult)
+		if !ok {
+			return 0, 0, fmt.Errorf("unexpected bulkWrite result: %T", result)
+		}
+		return bulk.UpsertedCount, bulk.MatchedCount, nil
+	}
+
+	query, args := dialect.statement(sqlTable(ctx, tableName), items)
+	if dialect.returning != "" {
+		return countReturnedInserts(ctx, connector, query, args)
+	}
+	result, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": query, "args": args})
+	if err != nil {
+		return 0, 0, err
+	}
+	// MySQL reports one affected row per insert and two per update; a row rewritten with the values it
+	// already has within the same second reports none, and is counted as an insert
+	affected, _ := affectedCount(result)
+	updated := affected - n
+	if updated < 0 {
+		updated = 0
+	}
+	if updated > n {
+		updated = n
+	}
+	return n - updated, updated, nil
+}
+
+// countReturnedInserts runs an upsert returning one inserted flag per row and counts the flags
+func countReturnedInserts(ctx context.Context, connector connectors.DBConnector, query string, args []interface{}) (int64, int64, error) {
+	rows, err := connector.Query(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	var inserted, updated int64
+	for rows.Next() {
+		var isInsert bool
+		if err := rows.Scan(&isInsert); err != nil {
+			return 0, 0, err
+		}
+		if isInsert {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	return inserted, updated, rows.Err()
+}
+
+// upsertBulkWriteParams returns the bulkWrite params upserting each item by key
+func upsertBulkWriteParams(tableName string, items []ConfigItem) map[string]interface{} {
+	operations := make([]interface{}, len(items))
+	now := mongoNow()
+	for i, item := range items {
+		set := map[string]interface{}{
+			"config_key":   item.Key,
+			"config_value": item.Value,
+			"description":  item.Description,
+			"status":       "approved",
+			"maker_id":     item.MakerID,
+		}
+		if item.Tags != nil {
+			set["tags"] = item.Tags
+		}
+		operations[i] = map[string]interface{}{
+			"updateOne": map[string]interface{}{
+				"filter": map[string]interface{}{"config_key": item.Key},
+				"update": map[string]interface{}{
+					"$set":         set,
+					"$currentDate": currentDate("updated_at", "approved_at"),
+					"$setOnInsert": map[string]interface{}{"created_at": now},
+				},
+				"upsert": true,
+			},
+		}
+	}
+
+	params := map[string]interface{}{"collection": tableName, "operations": operations}
+	return params
+}
+
+// countExistingConfigs counts the keys already stored in the table
+func (a *API) countExistingConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, keys []string) (int64, error) {
+	if connector.GetType() == "mongodb" {
+		params := map[string]interface{}{
+			"collection": tableName,
+			"filter":     map[string]interface{}{"config_key": map[string]interface{}{"$in": keys}},
+		}
+		result, err := connector.Execute(ctx, "count", params)
+		if err != nil {
+			return 0, err
+		}
+		count, _ := result.(int64)
+		return count, nil
+	}
+
+	dialect := sqlDialect(connector)
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		placeholders[i] = dialect.Placeholder(i + 1)
+		args[i] = key
+	}
+	rows, err := connector.Query(ctx, "SELECT COUNT(*) FROM "+sqlTable(ctx, tableName)+" WHERE config_key IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, rows.Err()
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSQLUpsertStatement(t *testing.T) {
+	items := []ConfigItem{{Key: "a", Value: "1"}, {Key: "b", Value: "2", Description: "second", Tags: []string{"pii"}, MakerID: "alice"}}
+
+	query, args := sqlUpsertDialects["mysql"].statement("allconfig", items)
+	assert.Equal(t, "INSERT INTO allconfig (config_key, config_value, description, tags, status, maker_id, created_at, updated_at, approved_at) VALUES "+
+		"(?, ?, ?, ?, 'approved', ?, NOW(), NOW(), NOW()), (?, ?, ?, ?, 'approved', ?, NOW(), NOW(), NOW()) "+
+		"ON DUPLICATE KEY UPDATE config_value = VALUES(config_value), description = VALUES(description), "+
+		"tags = COALESCE(VALUES(tags), allconfig.tags), status = 'approved', maker_id = VALUES(maker_id), updated_at = NOW(), approved_at = NOW()", query)
+	assert.Equal(t, []interface{}{"a", "1", "", nil, "", "b", "2", "second", `["pii"]`, "alice"}, args)
+
+	query, args = sqlUpsertDialects["postgresql"].statement("allconfig", items)
+	assert.Contains(t, query, "VALUES ($1, $2, $3, $4, 'approved', $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), "+
+		"($6, $7, $8, $9, 'approved', $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) ON CONFLICT (config_key) DO UPDATE SET")
+	// Items without tags keep the tags already stored
+	assert.Contains(t, query, "tags = COALESCE(EXCLUDED.tags, allconfig.tags)")
+	assert.True(t, strings.HasSuffix(query, " RETURNING (xmax = 0) AS inserted"))
+	assert.Len(t, args, 10)
+}
+
+func TestSQLUpsertChunks(t *testing.T) {
+	for dbType, dialect := range sqlUpsertDialects {
+		for requested, rows := range map[int]int{0: 500, 1: 1, 1000: 1000, 13107: 13107, 20000: 13107} {
+			assert.Equal(t, rows, dialect.chunkRows(requested), "%s chunk_size %d", dbType, requested)
+
+			// The largest chunk stays within the placeholder limit
+			query, args := dialect.statement("allconfig", configItems(rows))
+			assert.Len(t, args, rows*upsertArgsPerRow)
+			assert.LessOrEqual(t, len(args), dialect.maxPlaceholders)
+			assert.Equal(t, int64(rows), insertedRows(query))
+			if dbType == "postgresql" {
+				assert.Equal(t, len(args), strings.Count(query, "$"))
+			} else {
+				assert.Equal(t, len(args), strings.Count(query, "?"))
+			}
+		}
+	}
+}
+
+func TestUpsertMultipleConfigs(t *testing.T) {
+	t.Run("mysql counts from affected rows", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		upsert := mock.MatchedBy(func(params map[string]interface{}) bool {
+			return strings.Contains(params["query"].(string), "ON DUPLICATE KEY UPDATE")
+		})
+		conn.On("Execute", mock.Anything, "execute", upsert).Return(sqlmock.NewResult(0, 3), nil).Twice()
+		conn.On("Execute", mock.Anything, "execute", upsert).Return(sqlmock.NewResult(0, 1), nil).Once()
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(5), Upsert: true, ChunkSize: 2})
+		var argCounts []int
+		for _, call := range conn.Calls {
+			if call.Method == "Execute" {
+				argCounts = append(argCounts, len(call.Arguments.Get(2).(map[string]interface{})["args"].([]interface{})))
+			}
+		}
+		assert.Equal(t, []int{10, 10, 5}, argCounts)
+		assert.Equal(t, 5, result.SuccessCount)
+		// Each chunk of two affected three rows, one insert and one update; the last chunk inserted its row
+		assert.Equal(t, &BulkUpsertResult{ChunkSize: 2, Statements: 3, Inserted: 3, Updated: 2}, result.Upserts)
+	})
+
+	t.Run("postgresql counts returned rows", func(t *testing.T) {
+		conn := newServiceConnector("postgresql")
+		conn.On("Query", mock.Anything, queryContaining("RETURNING (xmax = 0) AS inserted"), mock.Anything).
+			Return(newMockRows(t, []string{"inserted"}, []driver.Value{true}, []driver.Value{false}, []driver.Value{true}), nil)
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "create_batch", Configs: map[string]interface{}{
+			"b": "2", "a": "1", "c": "3",
+		}, Upsert: true})
+		assert.Equal(t, &BulkUpsertResult{ChunkSize: 500, Statements: 1, Inserted: 2, Updated: 1}, result.Upserts)
+		assert.Equal(t, []string{"a", "b", "c"}, []string{result.Items[0].Key, result.Items[1].Key, result.Items[2].Key})
+	})
+
+	t.Run("mongodb bulkWrite", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "bulkWrite", mock.MatchedBy(func(params map[string]interface{}) bool {
+			operations := params["operations"].([]interface{})
+			upsert := operations[0].(map[string]interface{})["updateOne"].(map[string]interface{})
+			_, database := params["database"]
+			return len(operations) == 2 && upsert["upsert"] == true && !database
+		})).Return(&mongo.BulkWriteResult{UpsertedCount: 1, MatchedCount: 1}, nil)
+
+		req := AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(2), Upsert: true}
+		req.Database = "app"
+		result := runConfigBatchRequest(t, conn, req)
+		assert.Equal(t, &BulkUpsertResult{ChunkSize: 500, Statements: 1, Inserted: 1, Updated: 1}, result.Upserts)
+	})
+
+	t.Run("failed chunk", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "bulkWrite", mock.Anything).Return(&mongo.BulkWriteResult{UpsertedCount: 2}, nil).Once()
+		conn.On("Execute", mock.Anything, "bulkWrite", mock.Anything).Return(nil, driver.ErrBadConn).Once()
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(5), Upsert: true, ChunkSize: 2})
+		assert.True(t, result.Aborted)
+		assert.Equal(t, []string{ConfigItemSucceeded, ConfigItemSucceeded, ConfigItemFailed, ConfigItemFailed, ConfigItemSkipped}, itemStatuses(result))
+		assert.Equal(t, []string{"key-2", "key-3", "key-4"}, result.ResumeToken)
+		assert.Equal(t, int64(2), result.Upserts.Inserted)
+	})
+}
+
+func TestUpsertMultipleConfigsAtomic(t *testing.T) {
+	conn, mockDB := newSQLMockConnector(t, "postgresql")
+	mockDB.ExpectBegin()
+	mockDB.ExpectQuery("INSERT INTO allconfig").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true).AddRow(true))
+	mockDB.ExpectQuery("INSERT INTO allconfig").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mockDB.ExpectCommit()
+
+	result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(3), Upsert: true, ChunkSize: 2, Atomic: true})
+	assert.True(t, result.Committed)
+	assert.Equal(t, &BulkUpsertResult{ChunkSize: 2, Statements: 2, Inserted: 2, Updated: 1}, result.Upserts)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestUpsertMultipleConfigsDryRun(t *testing.T) {
+	conn := newServiceConnector("mysql")
+	for i := 0; i < 3; i++ {
+		conn.On("Query", mock.Anything, queryContaining("SELECT config_key, config_value"), mock.Anything).
+			Return(newMockRows(t, []string{"config_key"}), nil).Once()
+	}
+	conn.On("Query", mock.Anything, "SELECT COUNT(*) FROM allconfig WHERE config_key IN (?, ?, ?)", []interface{}{"key-0", "key-1", "key-2"}).
+		Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{1}), nil)
+
+	req := AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(3), Upsert: true, DryRun: true}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, &req)
+	require.NoError(t, err)
+	assertNothingWritten(t, conn)
+
+	dryRun := result.(*AllConfigDryRun)
+	require.Len(t, dryRun.Writes, 1)
+	assert.Equal(t, int64(3), dryRun.Affected)
+	assert.Equal(t, &BulkUpsertResult{ChunkSize: 500, Statements: 1, Inserted: 2, Updated: 1}, dryRun.Result.(*ConfigBatchResult).Upserts)
+}
+
+func TestCheckUpsertOptions(t *testing.T) {
+	for name, req := range map[string]AllConfigOperationRequest{
+		"not a create batch":   {Operation: "update_batch", ConfigItems: configItems(1), Upsert: true},
+		"chunk without upsert": {Operation: "create_batch", ConfigItems: configItems(1), ChunkSize: 10},
+		"negative chunk":       {Operation: "create_batch", ConfigItems: configItems(1), Upsert: true, ChunkSize: -1},
+		"duplicate key":        {Operation: "create_batch", ConfigItems: append(configItems(2), ConfigItem{Key: "key-0"}), Upsert: true},
+	} {
+		_, err := checkAllConfigOperation(&req, "mysql")
+		var apiErr *apiError
+		require.ErrorAs(t, err, &apiErr, name)
+		assert.Equal(t, ErrorCodeValidation, apiErr.Code, name)
+	}
+
+	// Without upsert a batch may still create the same key twice, failing the second item
+	req := AllConfigOperationRequest{Operation: "create_batch", ConfigItems: append(configItems(2), ConfigItem{Key: "key-0"})}
+	_, err := checkAllConfigOperation(&req, "mysql")
+	assert.NoError(t, err)
+}
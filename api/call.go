@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"db-connectors/connectors"
+)
+
+// CallResult is the result of the call operation: each result set the routine returned with its columns, in
+// the requested result format, and the warnings it raised
+type CallResult struct {
+	ResultSets []*QueryResult          `json:"result_sets"`
+	Warnings   []connectors.SQLWarning `json:"warnings"`
+}
+
+// call runs a stored routine through the call operation of the connector: the statement of a MySQL request,
+// such as CALL proc(...), or the PostgreSQL procedure or function named by params.routine
+func (a *API) call(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest) (*CallResult, error) {
+	params := map[string]interface{}{
+		"query": req.Query,
+		"args":  []interface{}(req.Args),
+	}
+	if connector.GetType() == "postgresql" {
+		params["routine"] = req.Params["routine"]
+		params["routine_type"] = routineType(req)
+	}
+	result, err := connector.Execute(ctx, "call", params)
+	if err != nil {
+		return nil, err
+	}
+	called, ok := result.(*connectors.CallResult)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result of call: %T", result)
+	}
+	sets := make([]*QueryResult, len(called.ResultSets))
+	for i, set := range called.ResultSets {
+		sets[i] = &QueryResult{Columns: columnsOf(set.Columns), Rows: set.Rows, Tabular: req.resultFormat() == ResultFormatTabular}
+	}
+	return &CallResult{ResultSets: sets, Warnings: called.Warnings}, nil
+}
+
+// callsRoutine reports whether a request calls a PostgreSQL routine by name rather than running a statement
+func callsRoutine(req *DatabaseOperationRequest) bool {
+	return req.Operation == "call" && req.Type == "postgresql"
+}
+
+// routineType returns the params.routine_type of a PostgreSQL call, a procedure unless set
+func routineType(req *DatabaseOperationRequest) string {
+	if t, ok := req.Params["routine_type"].(string); ok && t != "" {
+		return t
+	}
+	return connectors.RoutineProcedure
+}
+
+// checkRoutine validates the routine named by a PostgreSQL call and its type
+func checkRoutine(req *DatabaseOperationRequest) error {
+	var message string
+	if routine, ok := req.Params["routine"].(string); !ok || routine == "" {
+		message = "params.routine must name a procedure or function, such as billing.close_month"
+	} else if t := routineType(req); t != connectors.RoutineProcedure && t != connectors.RoutineFunction {
+		message = fmt.Sprintf("params.routine_type must be %s or %s, got %q", connectors.RoutineProcedure, connectors.RoutineFunction, t)
+	} else {
+		return nil
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: message,
+		Details: map[string]interface{}{"operation": "call", "type": req.Type},
+	}
+}
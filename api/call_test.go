@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"db-connectors/connectors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// callingConnector answers the call operation with every result set of the statement run on its sqlmock
+// database, and the warnings it was given
+type callingConnector struct {
+	*sqlMockConnector
+	warnings []connectors.SQLWarning
+}
+
+func (c callingConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	args, _ := params["args"].([]interface{})
+	rows, err := c.db.QueryContext(ctx, params["query"].(string), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := &connectors.CallResult{Warnings: c.warnings}
+	for {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return nil, err
+		}
+		set := connectors.ResultSet{Columns: types}
+		rowsOfSet, err := NewAPI().rowsToMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		set.Rows = rowsOfSet
+		result.ResultSets = append(result.ResultSets, set)
+		if !rows.NextResultSet() {
+			return result, nil
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	connector, mockDB := newSQLMockConnector(t, "mysql")
+	mockDB.ExpectQuery(`CALL order_report\(\?\)`).WithArgs(int64(7)).WillReturnRows(
+		sqlmock.NewRows([]string{"status", "id"}).AddRow("paid", 1),
+		sqlmock.NewRows([]string{"total"}).AddRow(42.5),
+	)
+	conn := callingConnector{connector, []connectors.SQLWarning{{Level: "Note", Code: 1305, Message: "PROCEDURE audit does not exist"}}}
+
+	req := &DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mysql"},
+		Operation:                 "call",
+		Query:                     "CALL order_report(?)",
+		Args:                      decodeArgs(t, `[7]`),
+	}
+	require.NoError(t, checkExecuteOperation(req, "mysql"))
+	result, err := NewAPI().executeOperation(context.Background(), conn, req)
+	require.NoError(t, err)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+
+	// Each result set keeps its columns and their order
+	encoded, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"result_sets": [
+			{"columns": [{"name": "status", "type": "", "scan_type": "interface {}"}, {"name": "id", "type": "", "scan_type": "interface {}"}], "rows": [{"status": "paid", "id": 1}]},
+			{"columns": [{"name": "total", "type": "", "scan_type": "interface {}"}], "rows": [{"total": 42.5}]}
+		],
+		"warnings": [{"level": "Note", "code": 1305, "message": "PROCEDURE audit does not exist"}]
+	}`, string(encoded))
+	assert.Contains(t, string(encoded), `"rows":[{"status":"paid","id":1}]`)
+
+	// Masking applies to the rows of every result set
+	masked := newMaskingAPI(MaskingRule{Column: "total", Action: MaskRedact}).masker(maskingRequest(""), "").rows(req.Query, result)
+	assert.Equal(t, MaskedValue, masked.(*CallResult).ResultSets[1].Rows[0]["total"])
+	assert.Equal(t, 42.5, result.(*CallResult).ResultSets[1].Rows[0]["total"])
+}
+
+func TestCallTabular(t *testing.T) {
+	connector, mockDB := newSQLMockConnector(t, "mysql")
+	mockDB.ExpectQuery("CALL").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Ada"))
+	req := &DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mysql"},
+		Operation:                 "call",
+		Query:                     "CALL customers()",
+		ResultFormat:              ResultFormatTabular,
+	}
+	require.NoError(t, checkResultFormat(req))
+	result, err := NewAPI().executeOperation(context.Background(), callingConnector{sqlMockConnector: connector}, req)
+	require.NoError(t, err)
+	encoded, err := json.Marshal(result.(*CallResult).ResultSets[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"rows":[[1,"Ada"]]`)
+}
+
+func TestCallRoutine(t *testing.T) {
+	conn := newServiceConnector("postgresql")
+	conn.On("Execute", mock.Anything, "call", mock.Anything).Return(&connectors.CallResult{
+		ResultSets: []connectors.ResultSet{{Rows: []map[string]interface{}{{"closed": int64(42)}}}},
+		Warnings:   []connectors.SQLWarning{},
+	}, nil)
+	req := &DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "postgresql"},
+		Operation:                 "call",
+		Params:                    map[string]interface{}{"routine": "billing.close_month"},
+		Args:                      SQLArgs{"2024-05", nil},
+	}
+	result, err := NewAPI().executeOperation(context.Background(), conn, req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), result.(*CallResult).ResultSets[0].Rows[0]["closed"])
+	conn.AssertCalled(t, "Execute", mock.Anything, "call", map[string]interface{}{
+		"query":        "",
+		"args":         []interface{}{"2024-05", nil},
+		"routine":      "billing.close_month",
+		"routine_type": "procedure",
+	})
+}
+
+func TestCheckRoutine(t *testing.T) {
+	newRequest := func(params map[string]interface{}) *DatabaseOperationRequest {
+		return &DatabaseOperationRequest{
+			DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "postgresql"},
+			Operation:                 "call",
+			Params:                    params,
+			Args:                      decodeArgs(t, `[9007199254740993]`),
+		}
+	}
+	req := newRequest(map[string]interface{}{"routine": "billing.close_month"})
+	require.NoError(t, checkExecuteOperation(req, "postgresql"))
+	assert.Equal(t, SQLArgs{int64(9007199254740993)}, req.Args)
+	assert.Equal(t, connectors.RoutineProcedure, routineType(req))
+	assert.Equal(t, connectors.RoutineFunction, routineType(newRequest(map[string]interface{}{"routine_type": "function"})))
+
+	assert.EqualError(t, checkExecuteOperation(newRequest(nil), "postgresql"), "params.routine is required for call operation")
+	assert.EqualError(t, checkExecuteOperation(newRequest(map[string]interface{}{"routine": 7}), "postgresql"),
+		"params.routine must name a procedure or function, such as billing.close_month")
+	err := checkExecuteOperation(newRequest(map[string]interface{}{"routine": "audit", "routine_type": "trigger"}), "postgresql")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	assert.Equal(t, `params.routine_type must be procedure or function, got "trigger"`, apiErr.Message)
+
+	// MySQL calls run a statement instead
+	assert.EqualError(t, checkExecuteOperation(&DatabaseOperationRequest{Operation: "call"}, "mysql"), "query is required for call operation")
+}
+
+func TestCallRoutinePolicy(t *testing.T) {
+	req := &DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "postgresql"},
+		Operation:                 "call",
+		Params:                    map[string]interface{}{"routine": "order_totals", "routine_type": "function"},
+	}
+	// Routines may write whatever their type, and the CALL keyword denies them
+	assert.NoError(t, DefaultStatementPolicy().Check(req))
+	var policyErr *PolicyError
+	require.ErrorAs(t, StatementPolicy{ReadOnly: true}.Check(req), &policyErr)
+	assert.Equal(t, ErrorCodeForbidden, policyErr.Code)
+	require.ErrorAs(t, StatementPolicy{DeniedStatements: []string{"CALL"}}.Check(req), &policyErr)
+	assert.Equal(t, "CALL statements are not allowed", policyErr.Message)
+}
+
+func TestCallRoutineNotFound(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewAPI().sendDatabaseError(rec, "Operation failed", &connectors.RoutineNotFoundError{
+		Routine:     "billing.clse_month",
+		Type:        connectors.RoutineProcedure,
+		Suggestions: []string{"billing.close_month"},
+	})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, ErrorCodeNotFound, response.ErrorCode)
+	assert.Equal(t, "Operation failed: procedure billing.clse_month does not exist; did you mean billing.close_month?", response.Error)
+	assert.Equal(t, map[string]interface{}{
+		"routine":      "billing.clse_month",
+		"routine_type": "procedure",
+		"suggestions":  []interface{}{"billing.close_month"},
+	}, response.Details)
+}
+
+func TestMultiStatementsGate(t *testing.T) {
+	newRequest := func(dbType string) *DatabaseOperationRequest {
+		return &DatabaseOperationRequest{
+			DatabaseConnectionRequest: DatabaseConnectionRequest{Type: dbType, Host: "db", Port: 3306, Database: "shop", MultiStatements: true},
+			Operation:                 "call",
+			Query:                     "CALL refresh(); SELECT 1",
+		}
+	}
+
+	// Off unless the server allows it
+	api := NewAPI()
+	assert.EqualError(t, api.validateOperationRequest(newRequest("mysql")),
+		"multi_statements is disabled on this server; enable server.allow_multi_statements to allow it")
+	// Nor through the DSN of a URI
+	viaURI := newRequest("mysql")
+	viaURI.MultiStatements = false
+	viaURI.URI = "app:secret@tcp(db:3306)/shop?multiStatements=true"
+	assert.EqualError(t, api.validateOperationRequest(viaURI), "uri must not set multiStatements; set multi_statements instead")
+
+	api.policy.AllowMultiStatements = true
+	req := newRequest("mysql")
+	require.NoError(t, api.validateOperationRequest(req))
+	assert.True(t, req.connectionConfig().MultiStatements)
+	assert.EqualError(t, api.validateOperationRequest(newRequest("postgresql")), "multi_statements is only supported for MySQL")
+
+	// Every statement of the query is still checked by the statement policy
+	req.Query = "CALL refresh(); DROP TABLE orders"
+	err := api.policy.Check(req)
+	var policyErr *PolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, "DROP statements are not allowed", policyErr.Message)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Result formats of SQL queries: rows as objects keyed by column name, or as arrays of values in column
+// order next to the columns
+const (
+	ResultFormatObjects = "objects"
+	ResultFormatTabular = "tabular"
+)
+
+// resultFormats lists the accepted values of result_format
+var resultFormats = []string{ResultFormatObjects, ResultFormatTabular}
+
+// Column describes a column of a query result
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`                // Database type name, such as VARCHAR or INT4
+	Nullable *bool  `json:"nullable,omitempty"`  // Unset when the driver cannot tell
+	ScanType string `json:"scan_type,omitempty"` // Go type the driver scans values into, such as sql.NullInt64
+}
+
+// QueryResult is the result of a query sent with include_columns or the tabular result format. It
+// encodes as its columns and rows, each row an object with the keys in column order or, when tabular,
+// an array of the values in column order.
+type QueryResult struct {
+	Columns []Column
+	Rows    []map[string]interface{}
+	Tabular bool
+}
+
+func (r *QueryResult) MarshalJSON() ([]byte, error) {
+	rows := make([]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		if !r.Tabular {
+			rows[i] = orderedRow{columns: r.Columns, values: row}
+			continue
+		}
+		values := make([]interface{}, len(r.Columns))
+		for j, column := range r.Columns {
+			values[j] = row[column.Name]
+		}
+		rows[i] = values
+	}
+	return json.Marshal(struct {
+		Columns []Column      `json:"columns"`
+		Rows    []interface{} `json:"rows"`
+	}{r.Columns, rows})
+}
+
+// orderedRow encodes a row as an object with its keys in column order
+type orderedRow struct {
+	columns []Column
+	values  map[string]interface{}
+}
+
+func (r orderedRow) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, column := range r.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.values[column.Name])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// wantsColumns reports whether a request asks for the columns of its result
+func (r *DatabaseOperationRequest) wantsColumns() bool {
+	return r.IncludeColumns || r.ResultFormat == ResultFormatTabular
+}
+
+// resultFormat returns the result format of a request, objects unless it asks for tabular
+func (r *DatabaseOperationRequest) resultFormat() string {
+	if r.ResultFormat == ResultFormatTabular {
+		return ResultFormatTabular
+	}
+	return ResultFormatObjects
+}
+
+// checkResultFormat rejects unknown result formats, and columns asked of operations other than SQL queries
+func checkResultFormat(req *DatabaseOperationRequest) error {
+	switch req.ResultFormat {
+	case "", ResultFormatObjects, ResultFormatTabular:
+	default:
+		return fmt.Errorf("result_format must be one of: %s", strings.Join(resultFormats, ", "))
+	}
+	if req.wantsColumns() && (!isSQLType(req.Type) || !sqlReadOperations[req.Operation] && req.Operation != "call") {
+		return fmt.Errorf("include_columns and result_format %s are only supported for the query, select and call operations on SQL databases", ResultFormatTabular)
+	}
+	return nil
+}
+
+// readColumns reads rows like readResult into a QueryResult with their columns, which are known even when
+// there are no rows
+func (a *API) readColumns(ctx context.Context, rows *sql.Rows, cancel context.CancelFunc, tabular bool) (*QueryResult, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	results, err := a.readResult(ctx, rows, cancel)
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []map[string]interface{}{}
+	}
+	return &QueryResult{Columns: columnsOf(types), Rows: results, Tabular: tabular}, nil
+}
+
+// columnsOf describes the columns of a result
+func columnsOf(types []*sql.ColumnType) []Column {
+	columns := make([]Column, len(types))
+	for i, t := range types {
+		columns[i] = Column{Name: t.Name(), Type: t.DatabaseTypeName()}
+		if nullable, ok := t.Nullable(); ok {
+			columns[i].Nullable = &nullable
+		}
+		if scanType := t.ScanType(); scanType != nil {
+			columns[i].ScanType = scanType.String()
+		}
+	}
+	return columns
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unorderedRows returns rows whose columns are not in alphabetical order; the driver cannot tell whether
+// amount is nullable
+func unorderedRows() *sqlmock.Rows {
+	return sqlmock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("zone").OfType("VARCHAR", "").Nullable(true),
+		sqlmock.NewColumn("id").OfType("BIGINT", int64(0)).Nullable(false),
+		sqlmock.NewColumn("amount").OfType("DECIMAL", ""),
+	)
+}
+
+func runColumnsQuery(t *testing.T, rows *sqlmock.Rows, req *DatabaseOperationRequest) []byte {
+	connector, mockDB := newSQLMockConnector(t, "postgresql")
+	mockDB.ExpectQuery("SELECT zone, id, amount FROM orders").WillReturnRows(rows)
+
+	req.Operation = "query"
+	req.Query = "SELECT zone, id, amount FROM orders"
+	result, err := NewAPI().executeOperation(context.Background(), queryingConnector{connector}, req)
+	require.NoError(t, err)
+	require.IsType(t, &QueryResult{}, result)
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	return data
+}
+
+func TestQueryIncludeColumns(t *testing.T) {
+	data := runColumnsQuery(t, unorderedRows().AddRow("eu", int64(7), "9.50").AddRow(nil, int64(8), "1.25"), &DatabaseOperationRequest{IncludeColumns: true})
+
+	// Rows keep the column order rather than the alphabetical order of maps
+	assert.JSONEq(t, `{
+		"columns": [
+			{"name": "zone", "type": "VARCHAR", "nullable": true, "scan_type": "string"},
+			{"name": "id", "type": "BIGINT", "nullable": false, "scan_type": "int64"},
+			{"name": "amount", "type": "DECIMAL", "scan_type": "string"}
+		],
+		"rows": [{"zone": "eu", "id": 7, "amount": "9.50"}, {"zone": null, "id": 8, "amount": "1.25"}]
+	}`, string(data))
+	assert.Contains(t, string(data), `"rows":[{"zone":"eu","id":7,"amount":"9.50"},{"zone":null,"id":8,"amount":"1.25"}]`)
+}
+
+func TestQueryTabularFormat(t *testing.T) {
+	data := runColumnsQuery(t, unorderedRows().AddRow("eu", int64(7), "9.50"), &DatabaseOperationRequest{ResultFormat: ResultFormatTabular})
+	assert.Contains(t, string(data), `"rows":[["eu",7,"9.50"]]`)
+	assert.Contains(t, string(data), `"columns":[{"name":"zone"`)
+}
+
+func TestQueryColumnsOfEmptyResult(t *testing.T) {
+	for _, req := range []*DatabaseOperationRequest{{IncludeColumns: true}, {ResultFormat: ResultFormatTabular}} {
+		data := runColumnsQuery(t, unorderedRows(), req)
+
+		var result struct {
+			Columns []Column      `json:"columns"`
+			Rows    []interface{} `json:"rows"`
+		}
+		require.NoError(t, json.Unmarshal(data, &result))
+		require.Len(t, result.Columns, 3)
+		assert.Equal(t, []string{"zone", "id", "amount"}, []string{result.Columns[0].Name, result.Columns[1].Name, result.Columns[2].Name})
+		assert.NotNil(t, result.Rows)
+		assert.Empty(t, result.Rows)
+	}
+}
+
+func TestCheckResultFormat(t *testing.T) {
+	sqlQuery := func(req DatabaseOperationRequest) *DatabaseOperationRequest {
+		req.Type = "mysql"
+		req.Operation = "query"
+		return &req
+	}
+	assert.NoError(t, checkResultFormat(sqlQuery(DatabaseOperationRequest{})))
+	assert.NoError(t, checkResultFormat(sqlQuery(DatabaseOperationRequest{IncludeColumns: true, ResultFormat: ResultFormatObjects})))
+	assert.NoError(t, checkResultFormat(sqlQuery(DatabaseOperationRequest{ResultFormat: ResultFormatTabular})))
+	assert.EqualError(t, checkResultFormat(sqlQuery(DatabaseOperationRequest{ResultFormat: "csv"})), "result_format must be one of: objects, tabular")
+
+	insert := sqlQuery(DatabaseOperationRequest{IncludeColumns: true})
+	insert.Operation = "insert"
+	assert.EqualError(t, checkResultFormat(insert), "include_columns and result_format tabular are only supported for the query, select and call operations on SQL databases")
+	find := &DatabaseOperationRequest{Operation: "find", ResultFormat: ResultFormatTabular}
+	find.Type = "mongodb"
+	assert.Error(t, checkResultFormat(find))
+}
+
+func TestExecuteColumnsFromCache(t *testing.T) {
+	api := newMaskingAPI(MaskingRule{Column: "ssn", Action: MaskRedact})
+	handler := SetupRoutes(api)
+	body := map[string]interface{}{
+		"type": "mysql", "host": "db.invalid", "port": 3306, "username": "app", "password": "secret", "database": "app",
+		"operation": "query", "query": "SELECT ssn, id FROM people", "cache_ttl_seconds": 30, "result_format": "tabular",
+	}
+	connection := DatabaseConnectionRequest{Type: "mysql", Host: "db.invalid", Port: 3306, Username: "app", Password: "secret", Database: "app"}
+	key, _ := queryCacheKey(connectionHash(&connection), "SELECT ssn, id FROM people", nil)
+	api.queryCache.put(key+":"+ResultFormatTabular, connectionHash(&connection), &QueryResult{
+		Columns: []Column{{Name: "ssn", Type: "VARCHAR"}, {Name: "id", Type: "INT"}},
+		Rows:    []map[string]interface{}{{"id": 1, "ssn": "123-45-6789"}},
+		Tabular: true,
+	}, time.Minute)
+
+	// Results with columns are cached apart from plain rows, and masked the same way
+	rr := serveConfigs(handler, http.MethodPost, "/v1/execute", body, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"data":{"columns":[{"name":"ssn","type":"VARCHAR"},{"name":"id","type":"INT"}],"rows":[["`+MaskedValue+`",1]]}`)
+	assert.Contains(t, rr.Body.String(), `"cached":true`)
+
+	body["result_format"] = "xml"
+	rr = serveConfigs(handler, http.MethodPost, "/v1/execute", body, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "result_format must be one of: objects, tabular")
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/logging"
+)
+
+// DefaultQueueTimeout is how long an operation waits for a free slot on its connection before failing
+const DefaultQueueTimeout = time.Second
+
+// ConcurrencyLimit bounds the operations running at once on each database connection. Operations beyond
+// the limit queue in arrival order and fail with 503 once they have waited QueueTimeout, rather than
+// piling up on a database that is already struggling.
+type ConcurrencyLimit struct {
+	MaxOperations int           // Per connection; zero keeps connectors.DefaultMaxOpenConns, negative disables the limit
+	QueueTimeout  time.Duration // Longest an operation waits for a slot; zero keeps the default
+	IdleTTL       time.Duration // Connections without operations for this long are forgotten; zero keeps DefaultLimiterIdleTTL
+}
+
+// ConcurrencyStats reports the operations of one connection
+type ConcurrencyStats struct {
+	MaxOperations int   `json:"max_operations"`
+	InFlight      int   `json:"in_flight"`
+	Queued        int   `json:"queued"`
+	Rejected      int64 `json:"rejected"` // Operations that gave up waiting for a slot
+}
+
+// connectionSlots counts the operations running on one connection and holds those waiting for a slot
+type connectionSlots struct {
+	inFlight int
+	waiting  []chan struct{} // In arrival order; closing one hands it the slot of a finished operation
+	rejected int64
+	lastUsed time.Time
+}
+
+// operationLimiter holds the slots of each connection, keyed by connectionKey
+type operationLimiter struct {
+	ConcurrencyLimit
+	now         func() time.Time
+	mu          sync.Mutex
+	connections map[string]*connectionSlots
+	lastSweep   time.Time
+}
+
+// newOperationLimiter creates a limiter, filling unset settings with their defaults; a negative
+// MaxOperations returns nil, which limits nothing
+func newOperationLimiter(limit ConcurrencyLimit) *operationLimiter {
+	if limit.MaxOperations < 0 {
+		return nil
+	}
+	if limit.MaxOperations == 0 {
+		limit.MaxOperations = connectors.DefaultMaxOpenConns
+	}
+	if limit.QueueTimeout <= 0 {
+		limit.QueueTimeout = DefaultQueueTimeout
+	}
+	if limit.IdleTTL <= 0 {
+		limit.IdleTTL = DefaultLimiterIdleTTL
+	}
+	return &operationLimiter{ConcurrencyLimit: limit, now: time.Now, connections: map[string]*connectionSlots{}}
+}
+
+// acquire takes a slot on the connection named key, waiting behind the operations queued before it for up
+// to the queue timeout. The returned function frees the slot and must be called once the operation is done.
+func (l *operationLimiter) acquire(ctx context.Context, key string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	now := l.now()
+	l.sweep(now)
+	slots, ok := l.connections[key]
+	if !ok {
+		slots = &connectionSlots{}
+		l.connections[key] = slots
+	}
+	slots.lastUsed = now
+	release := func() { l.release(slots) }
+	if slots.inFlight < l.MaxOperations && len(slots.waiting) == 0 {
+		slots.inFlight++
+		l.mu.Unlock()
+		return release, nil
+	}
+	ready := make(chan struct{})
+	slots.waiting = append(slots.waiting, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.QueueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return release, nil
+	case <-timer.C:
+		err = l.overloaded(key)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-ready:
+		// A slot was handed over just as the wait ended
+		return release, nil
+	default:
+	}
+	for i, waiting := range slots.waiting {
+		if waiting == ready {
+			slots.waiting = append(slots.waiting[:i], slots.waiting[i+1:]...)
+			break
+		}
+	}
+	slots.rejected++
+	return nil, err
+}
+
+// release frees a slot, handing it to the operation waiting longest
+func (l *operationLimiter) release(slots *connectionSlots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(slots.waiting) > 0 {
+		close(slots.waiting[0])
+		slots.waiting = slots.waiting[1:]
+		return
+	}
+	slots.inFlight--
+	slots.lastUsed = l.now()
+}
+
+// sweep forgets connections without operations for IdleTTL, at most once per IdleTTL, so that a client
+// sending ever new connection settings cannot grow the limiter without bound; callers hold l.mu
+func (l *operationLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.IdleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, slots := range l.connections {
+		if slots.inFlight == 0 && len(slots.waiting) == 0 && now.Sub(slots.lastUsed) >= l.IdleTTL {
+			delete(l.connections, key)
+		}
+	}
+}
+
+// overloaded returns the 503 of an operation that found no free slot on the connection named key
+func (l *operationLimiter) overloaded(key string) error {
+	return &apiError{
+		Status:  http.StatusServiceUnavailable,
+		Code:    ErrorCodeUnavailable,
+		Message: fmt.Sprintf("Too many concurrent operations on %s: no slot freed up within %s", key, l.QueueTimeout),
+		Details: map[string]interface{}{
+			"connection":       key,
+			"max_operations":   l.MaxOperations,
+			"queue_timeout_ms": l.QueueTimeout.Milliseconds(),
+		},
+		RetryAfter: l.QueueTimeout,
+	}
+}
+
+// stats returns the operations of every connection used so far, by connectionKey
+func (l *operationLimiter) stats() map[string]ConcurrencyStats {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make(map[string]ConcurrencyStats, len(l.connections))
+	for key, slots := range l.connections {
+		stats[key] = ConcurrencyStats{
+			MaxOperations: l.MaxOperations,
+			InFlight:      slots.inFlight,
+			Queued:        len(slots.waiting),
+			Rejected:      slots.rejected,
+		}
+	}
+	return stats
+}
+
+// connectionKey names the connection of a request for the concurrency limit and circuit breaker: the
+// profile its settings point at, or else the database they reach, so that requests to the same database
+// share them
+func (a *API) connectionKey(req *DatabaseConnectionRequest) string {
+	if name := a.connectionName(req); name != "" {
+		return name
+	}
+	if req.URI != "" {
+		return logging.RedactDSN(req.URI)
+	}
+	return fmt.Sprintf("%s://%s:%d/%s", req.Type, req.Host, req.Port, req.Database)
+}
+
+// acquireSlot waits for a slot to run an operation on the connection named key. When none frees up in
+// time it answers with 503 and a Retry-After hint and returns false; otherwise the caller must call release.
+func (a *API) acquireSlot(w http.ResponseWriter, r *http.Request, key string) (release func(), ok bool) {
+	release, err := a.operations.acquire(r.Context(), key)
+	if err != nil {
+		a.sendDatabaseError(w, "Operation rejected", err)
+		return nil, false
+	}
+	return release, true
+}
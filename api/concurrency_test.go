@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingDriver is a driver whose connectors block in Execute until released
+const blockingDriver = "blockingkv"
+
+// blockingDriverConnector is the connector returned for blockingDriver requests
+var blockingDriverConnector *blockingConnector
+
+func init() {
+	connectors.RegisterDriver(blockingDriver, func(config *connectors.ConnectionConfig, opts ...connectors.Option) connectors.DBConnector {
+		return blockingDriverConnector
+	})
+}
+
+// blockingConnector signals started when Execute is called, then blocks until unblock is closed
+type blockingConnector struct {
+	connectortest.MockDBConnector
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func newBlockingConnector() *blockingConnector {
+	return &blockingConnector{started: make(chan struct{}, 10), unblock: make(chan struct{})}
+}
+
+func (c *blockingConnector) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (c *blockingConnector) Close(ctx context.Context) error {
+	return nil
+}
+
+func (c *blockingConnector) GetType() string {
+	return blockingDriver
+}
+
+func (c *blockingConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	c.started <- struct{}{}
+	select {
+	case <-c.unblock:
+		return map[string]interface{}{"value": "alice"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// executeBlocking sends an execute request for a blockingDriver database
+func executeBlocking(t *testing.T, handler http.Handler) *httptest.ResponseRecorder {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      blockingDriver,
+		"host":      "kv.internal",
+		"port":      7000,
+		"database":  "sessions",
+		"operation": "get",
+		"params":    map[string]interface{}{"key": "user:1"},
+	})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewReader(data)))
+	return rr
+}
+
+// waitQueued waits until n operations are queued on the connection named key
+func waitQueued(t *testing.T, l *operationLimiter, key string, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return l.stats()[key].Queued == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestOperationLimiterQueues(t *testing.T) {
+	l := newOperationLimiter(ConcurrencyLimit{MaxOperations: 2, QueueTimeout: time.Second})
+	first, err := l.acquire(context.Background(), "primary")
+	require.NoError(t, err)
+	_, err = l.acquire(context.Background(), "primary")
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := l.acquire(context.Background(), "primary")
+		if err == nil {
+			close(acquired)
+			release()
+		}
+	}()
+	waitQueued(t, l, "primary", 1)
+	assert.Equal(t, ConcurrencyStats{MaxOperations: 2, InFlight: 2, Queued: 1}, l.stats()["primary"])
+
+	// Other connections have slots of their own
+	release, err := l.acquire(context.Background(), "reporting")
+	require.NoError(t, err)
+	release()
+
+	first()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the queued operation did not get the freed slot")
+	}
+	require.Eventually(t, func() bool {
+		return l.stats()["primary"] == ConcurrencyStats{MaxOperations: 2, InFlight: 1}
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, ConcurrencyStats{MaxOperations: 2}, l.stats()["reporting"])
+}
+
+func TestOperationLimiterTimeout(t *testing.T) {
+	l := newOperationLimiter(ConcurrencyLimit{MaxOperations: 1, QueueTimeout: 20 * time.Millisecond})
+	_, err := l.acquire(context.Background(), "primary")
+	require.NoError(t, err)
+
+	_, err = l.acquire(context.Background(), "primary")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.Status)
+	assert.Equal(t, ErrorCodeUnavailable, apiErr.Code)
+	assert.Equal(t, "Too many concurrent operations on primary: no slot freed up within 20ms", apiErr.Message)
+	assert.Equal(t, ConcurrencyStats{MaxOperations: 1, InFlight: 1, Rejected: 1}, l.stats()["primary"])
+
+	// A request going away stops waiting as well
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = l.acquire(ctx, "primary")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, l.stats()["primary"].Queued)
+}
+
+func TestOperationLimiterFairness(t *testing.T) {
+	l := newOperationLimiter(ConcurrencyLimit{MaxOperations: 1, QueueTimeout: time.Second})
+	hold, err := l.acquire(context.Background(), "primary")
+	require.NoError(t, err)
+
+	// Operations get the slot in the order they queued for it
+	order := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			release, err := l.acquire(context.Background(), "primary")
+			if err != nil {
+				order <- -1
+				return
+			}
+			order <- i
+			release()
+		}(i)
+		waitQueued(t, l, "primary", i+1)
+	}
+	hold()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, i, <-order)
+	}
+	assert.Equal(t, ConcurrencyStats{MaxOperations: 1}, l.stats()["primary"])
+}
+
+func TestOperationLimiterDisabled(t *testing.T) {
+	assert.Nil(t, newOperationLimiter(ConcurrencyLimit{MaxOperations: -1}))
+	var l *operationLimiter
+	release, err := l.acquire(context.Background(), "primary")
+	require.NoError(t, err)
+	release()
+	assert.Nil(t, l.stats())
+
+	l = newOperationLimiter(ConcurrencyLimit{})
+	assert.Equal(t, connectors.DefaultMaxOpenConns, l.MaxOperations)
+	assert.Equal(t, DefaultQueueTimeout, l.QueueTimeout)
+	assert.Equal(t, DefaultLimiterIdleTTL, l.IdleTTL)
+}
+
+func TestOperationLimiterEvictsIdleConnections(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := newOperationLimiter(ConcurrencyLimit{MaxOperations: 1, IdleTTL: time.Minute})
+	l.now = clock.now
+
+	release, err := l.acquire(context.Background(), "mysql://db-1:3306/app")
+	require.NoError(t, err)
+	release()
+	hold, err := l.acquire(context.Background(), "mysql://db-2:3306/app")
+	require.NoError(t, err)
+
+	// The idle connection is forgotten, the one running an operation is kept however long it runs
+	clock.advance(2 * time.Minute)
+	release, err = l.acquire(context.Background(), "mysql://db-3:3306/app")
+	require.NoError(t, err)
+	release()
+	assert.NotContains(t, l.stats(), "mysql://db-1:3306/app")
+	assert.Equal(t, ConcurrencyStats{MaxOperations: 1, InFlight: 1}, l.stats()["mysql://db-2:3306/app"])
+
+	// Once released it idles from then on
+	hold()
+	clock.advance(30 * time.Second)
+	_, err = l.acquire(context.Background(), "primary")
+	require.NoError(t, err)
+	clock.advance(45 * time.Second)
+	release, err = l.acquire(context.Background(), "reporting")
+	require.NoError(t, err)
+	release()
+	assert.Contains(t, l.stats(), "primary")
+	assert.NotContains(t, l.stats(), "mysql://db-2:3306/app")
+	assert.NotContains(t, l.stats(), "mysql://db-3:3306/app")
+}
+
+func TestExecuteConcurrencyLimit(t *testing.T) {
+	blockingDriverConnector = newBlockingConnector()
+	api := NewServer(config.ServerConfig{}, WithConcurrencyLimit(ConcurrencyLimit{MaxOperations: 1, QueueTimeout: 20 * time.Millisecond})).API()
+	handler := SetupRoutes(api)
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- executeBlocking(t, handler) }()
+	<-blockingDriverConnector.started
+
+	// The second operation on the same database finds no free slot
+	rr := executeBlocking(t, handler)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeUnavailable, response.ErrorCode)
+	key := "blockingkv://kv.internal:7000/sessions"
+	assert.Equal(t, map[string]interface{}{"connection": key, "max_operations": float64(1), "queue_timeout_ms": float64(20)}, response.Details)
+
+	// /metrics reports the operation in flight and the one rejected
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var metrics struct {
+		Data Metrics `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &metrics))
+	assert.Equal(t, ConcurrencyStats{MaxOperations: 1, InFlight: 1, Rejected: 1}, metrics.Data.Concurrency[key])
+
+	close(blockingDriverConnector.unblock)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, ConcurrencyStats{MaxOperations: 1, Rejected: 1}, api.operations.stats()[key])
+}
@@ -0,0 +1,397 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"syscall"
+
+	"db-connectors/connectors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// maxConfigBatchConcurrency limits the number of items of a batch allconfig operation run at once
+const maxConfigBatchConcurrency = 32
+
+// Outcomes of the items of a batch allconfig operation
+const (
+	ConfigItemSucceeded  = "succeeded"
+	ConfigItemFailed     = "failed"
+	ConfigItemSkipped    = "skipped"     // Not run because the batch aborted first
+	ConfigItemRolledBack = "rolled_back" // Run, then undone by the rollback of an atomic batch
+)
+
+// ConfigBatchItem reports the outcome of one item of a batch allconfig operation
+type ConfigBatchItem struct {
+	Index     int         `json:"index"`
+	Key       string      `json:"key"`
+	Status    string      `json:"status"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ErrorCode string      `json:"error_code,omitempty"`
+}
+
+// ConfigBatchResult reports the outcome of a batch allconfig operation
+type ConfigBatchResult struct {
+	TotalItems   int                    `json:"total_items"`
+	SuccessCount int                    `json:"success_count"`
+	FailureCount int                    `json:"failure_count"`
+	SkippedCount int                    `json:"skipped_count"` // Items skipped or rolled back
+	Results      map[string]interface{} `json:"results"`       // Outcome of each key
+	Items        []ConfigBatchItem      `json:"items"`         // Outcome of each item, in request order
+	Atomic       bool                   `json:"atomic,omitempty"`
+	Committed    bool                   `json:"committed,omitempty"`
+	RolledBack   bool                   `json:"rolled_back,omitempty"`
+	Aborted      bool                   `json:"aborted,omitempty"`      // A failure stopped the batch before every item ran
+	ResumeToken  []string               `json:"resume_token,omitempty"` // Keys of the items not applied, in request order, to send again
+	Upserts      *BulkUpsertResult      `json:"upserts,omitempty"`      // Counts of a batch written with multi-row upserts
+	OperationID  string                 `json:"operation_id,omitempty"` // Looks up the keys and outcomes with get_operation
+}
+
+// configBatchOptions controls how the items of a batch allconfig operation are run
+type configBatchOptions struct {
+	concurrency     int  // Items run at once
+	continueOnError bool // Whether items keep running after one fails
+	atomic          bool // Whether the batch runs in one transaction (SQL only)
+}
+
+// configBatchOptionsOf returns the batch options of a request; items run one at a time and keep running
+// after a failure unless the request says otherwise
+func configBatchOptionsOf(req *AllConfigOperationRequest) configBatchOptions {
+	opts := configBatchOptions{
+		concurrency:     req.Concurrency,
+		continueOnError: req.ContinueOnError == nil || *req.ContinueOnError,
+		atomic:          req.Atomic,
+	}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+	if opts.atomic {
+		opts.concurrency = 1
+		opts.continueOnError = false
+	}
+	return opts
+}
+
+// checkConfigBatchOptions rejects batch options set on an operation that does not run a batch, or that
+// cannot be combined
+func checkConfigBatchOptions(req *AllConfigOperationRequest, spec *operationSpec, dbType string) error {
+	invalid := func(message string) error {
+		return &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: message,
+			Details: map[string]interface{}{"operation": req.Operation},
+		}
+	}
+
+	if !spec.Batch {
+		if req.Concurrency != 0 || req.ContinueOnError != nil || req.Atomic {
+			return invalid(fmt.Sprintf("concurrency, continue_on_error and atomic apply to batch operations only, not %s", req.Operation))
+		}
+	}
+	if spec.Name == "import" {
+		if req.Upsert || req.ChunkSize < 0 || req.ChunkSize > maxImportChunkSize {
+			return invalid(fmt.Sprintf("import takes a chunk_size between 1 and %d and cannot upsert", maxImportChunkSize))
+		}
+		return nil
+	}
+	if spec.Name == "prune_history" {
+		if req.Upsert || req.ChunkSize < 0 || req.ChunkSize > maxPruneChunkSize {
+			return invalid(fmt.Sprintf("prune_history takes a chunk_size between 1 and %d and cannot upsert", maxPruneChunkSize))
+		}
+		return nil
+	}
+	if (req.Upsert || req.ChunkSize != 0) && spec.Name != "direct_create_batch" {
+		return invalid(fmt.Sprintf("upsert and chunk_size apply to direct_create_batch only, not %s", req.Operation))
+	}
+	if !spec.Batch {
+		return nil
+	}
+	if req.Concurrency < 0 || req.Concurrency > maxConfigBatchConcurrency {
+		return invalid(fmt.Sprintf("concurrency must be between 1 and %d", maxConfigBatchConcurrency))
+	}
+	if req.ChunkSize != 0 && (!req.Upsert || req.ChunkSize < 0) {
+		return invalid("chunk_size must be positive and requires upsert")
+	}
+	if req.Upsert {
+		// A multi-row upsert cannot write the same key twice
+		seen := make(map[string]bool, len(req.ConfigItems))
+		for _, item := range req.ConfigItems {
+			if seen[item.Key] {
+				err := invalid(fmt.Sprintf("config_items has key %s more than once, which upsert cannot write", item.Key)).(*apiError)
+				err.Details["key"] = item.Key
+				return err
+			}
+			seen[item.Key] = true
+		}
+	}
+	if !req.Atomic {
+		return nil
+	}
+	switch {
+	case dbType != "mysql" && dbType != "postgresql":
+		return invalid(fmt.Sprintf("atomic batches are only supported for MySQL and PostgreSQL, not %s", dbType))
+	case req.Concurrency > 1:
+		return invalid("atomic batches run in one transaction and cannot set concurrency")
+	case req.ContinueOnError != nil && *req.ContinueOnError:
+		return invalid("atomic batches stop at the first failure and cannot set continue_on_error")
+	}
+	return nil
+}
+
+// configItemFunc runs the item at index i of a batch against connector
+type configItemFunc func(ctx context.Context, connector connectors.DBConnector, i int) (interface{}, error)
+
+// configChunkFunc runs the items from lo up to hi of a batch against connector at once
+type configChunkFunc func(ctx context.Context, connector connectors.DBConnector, lo, hi int) (interface{}, error)
+
+// configItemKeys returns the key of each config item
+func configItemKeys(items []ConfigItem) []string {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	return keys
+}
+
+// sortedConfigKeys returns the keys of a configs map in order, so its items run in a stable order
+func sortedConfigKeys(configs map[string]interface{}) []string {
+	keys := make([]string, 0, len(configs))
+	for key := range configs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runConfigBatch runs the items of a batch allconfig operation, one per key, with the options given. Up to
+// concurrency items run at once, in request order. A failure stops further items from starting unless
+// continueOnError is set, and a lost connection always does; the keys that were not applied are returned
+// as the resume token. An atomic batch runs in one transaction that any failure rolls back.
+func (a *API) runConfigBatch(ctx context.Context, connector connectors.DBConnector, keys []string, opts configBatchOptions, run configItemFunc) (interface{}, error) {
+	result, err := a.runConfigChunks(ctx, connector, keys, opts, 1, func(ctx context.Context, connector connectors.DBConnector, lo, hi int) (interface{}, error) {
+		return run(ctx, connector, lo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// runConfigChunks runs the items of a batch like runConfigBatch, chunkSize items per call of run. The items of
+// a chunk succeed or fail together, and only single items report the result of their call. The outcomes are
+// kept under the operation ID of ctx, if any, for get_operation.
+func (a *API) runConfigChunks(ctx context.Context, connector connectors.DBConnector, keys []string, opts configBatchOptions, chunkSize int, run configChunkFunc) (*ConfigBatchResult, error) {
+	var result *ConfigBatchResult
+	if opts.atomic {
+		var err error
+		if result, err = a.runAtomicConfigChunks(ctx, connector, keys, chunkSize, run); err != nil {
+			return nil, err
+		}
+	} else {
+		result = newConfigBatchResult(keys)
+		runConfigItems(ctx, connector, result, opts, chunkSize, run)
+		result.summarize()
+	}
+	result.OperationID = operationID(ctx)
+	a.finishConfigOperation(ctx, result.Items)
+	return result, nil
+}
+
+// runAtomicConfigChunks runs the chunks one at a time in a transaction, committing only when all succeed
+func (a *API) runAtomicConfigChunks(ctx context.Context, connector connectors.DBConnector, keys []string, chunkSize int, run configChunkFunc) (*ConfigBatchResult, error) {
+	sqlConnector, ok := connector.(connectors.SQLConnector)
+	if !ok || sqlConnector.DB() == nil {
+		return nil, fmt.Errorf("%s connector does not expose a SQL connection", connector.GetType())
+	}
+
+	tx, err := sqlConnector.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	result := newConfigBatchResult(keys)
+	result.Atomic = true
+	// Roll back on any early return or panic; a no-op after Commit
+	defer func() {
+		if !result.Committed && !result.RolledBack {
+			tx.Rollback()
+		}
+	}()
+
+	// Config changes are only published once the transaction commits
+	txCtx, pending := withPendingEvents(ctx)
+	runConfigItems(txCtx, &txConnector{DBConnector: connector, tx: tx}, result, configBatchOptions{concurrency: 1}, chunkSize, run)
+	if !result.Aborted {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		a.publishPending(pending)
+		result.Committed = true
+		result.summarize()
+		return result, nil
+	}
+
+	// Should the rollback fail with the connection, the server discards the transaction anyway
+	tx.Rollback()
+	result.RolledBack = true
+	for i := range result.Items {
+		if result.Items[i].Status == ConfigItemSucceeded {
+			result.Items[i].Status = ConfigItemRolledBack
+		}
+	}
+	result.summarize()
+	return result, nil
+}
+
+// newConfigBatchResult returns a result with every key skipped until its item runs
+func newConfigBatchResult(keys []string) *ConfigBatchResult {
+	result := &ConfigBatchResult{
+		TotalItems: len(keys),
+		Results:    make(map[string]interface{}, len(keys)),
+		Items:      make([]ConfigBatchItem, len(keys)),
+	}
+	for i, key := range keys {
+		result.Items[i] = ConfigBatchItem{Index: i, Key: key, Status: ConfigItemSkipped}
+	}
+	return result
+}
+
+// runConfigItems runs the items of result in chunks on a bounded pool of goroutines, recording each outcome
+// at its index and marking the result aborted when a failure stops the batch
+func runConfigItems(ctx context.Context, connector connectors.DBConnector, result *ConfigBatchResult, opts configBatchOptions, chunkSize int, run configChunkFunc) {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		slot = make(chan struct{}, opts.concurrency)
+	)
+	aborted := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return result.Aborted
+	}
+
+	for lo := 0; lo < len(result.Items); lo += chunkSize {
+		hi := lo + chunkSize
+		if hi > len(result.Items) {
+			hi = len(result.Items)
+		}
+
+		// Waiting for a free slot first means a chunk never starts after the failure that aborts the batch
+		slot <- struct{}{}
+		if aborted() || ctx.Err() != nil {
+			<-slot
+			mu.Lock()
+			result.Aborted = true
+			mu.Unlock()
+			break
+		}
+
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer func() {
+				<-slot
+				wg.Done()
+			}()
+			value, err := run(ctx, connector, lo, hi)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && (!opts.continueOnError || abortsConfigBatch(ctx, err)) {
+				result.Aborted = true
+			}
+			for i := lo; i < hi; i++ {
+				item := &result.Items[i]
+				if err != nil {
+					_, item.ErrorCode = classifyDatabaseError(err)
+					item.Status, item.Error = ConfigItemFailed, err.Error()
+					continue
+				}
+				item.Status = ConfigItemSucceeded
+				if chunkSize == 1 {
+					item.Result = value
+				}
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+}
+
+// abortsConfigBatch reports whether an item failed because the connection was lost or the request ended,
+// so that the remaining items would fail the same way
+func abortsConfigBatch(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	for _, connErr := range []error{driver.ErrBadConn, sql.ErrConnDone, sql.ErrTxDone, mysql.ErrInvalidConn, io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.EPIPE} {
+		if errors.Is(err, connErr) {
+			return true
+		}
+	}
+	switch connectors.ClassifyError(err) {
+	case connectors.ErrorClassDNS, connectors.ErrorClassHostUnreachable, connectors.ErrorClassTimeout:
+		return true
+	}
+	return false
+}
+
+// summarize counts the outcomes, fills in the results by key and, for an aborted batch, the resume token
+func (r *ConfigBatchResult) summarize() {
+	r.SuccessCount, r.FailureCount, r.SkippedCount = 0, 0, 0
+	r.ResumeToken = nil
+	for _, item := range r.Items {
+		switch item.Status {
+		case ConfigItemSucceeded:
+			r.SuccessCount++
+			r.Results[item.Key] = map[string]interface{}{"success": true, "result": item.Result}
+		case ConfigItemFailed:
+			r.FailureCount++
+			r.Results[item.Key] = map[string]interface{}{"error": item.Error, "error_code": item.ErrorCode}
+		default:
+			r.SkippedCount++
+			r.Results[item.Key] = map[string]interface{}{item.Status: true}
+		}
+		if r.Aborted && item.Status != ConfigItemSucceeded {
+			r.ResumeToken = append(r.ResumeToken, item.Key)
+		}
+	}
+}
+
+// txConnector runs the queries and statements of allconfig operations in a transaction
+type txConnector struct {
+	connectors.DBConnector
+	tx *sql.Tx
+}
+
+// Labels returns the labels of the connector running the transaction
+func (c *txConnector) Labels() map[string]string {
+	return connectors.LabelsOf(c.DBConnector)
+}
+
+// Query runs a query in the transaction
+func (c *txConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.tx.QueryContext(ctx, query, args...)
+}
+
+// Execute runs the query of a SQL operation in the transaction
+func (c *txConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	query, ok := params["query"].(string)
+	if !ok {
+		return nil, fmt.Errorf("query parameter required for operation: %s", operation)
+	}
+	args, _ := params["args"].([]interface{})
+	switch operation {
+	case "query", "select":
+		return c.tx.QueryContext(ctx, query, args...)
+	default:
+		return c.tx.ExecContext(ctx, query, args...)
+	}
+}
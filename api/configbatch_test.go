@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// latencyConnector is a MongoDB connector whose every command matches one document after a delay
+type latencyConnector struct {
+	connectortest.MockDBConnector
+	latency time.Duration
+}
+
+func (c *latencyConnector) GetType() string { return "mongodb" }
+
+func (c *latencyConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	time.Sleep(c.latency)
+	if operation == "findOne" {
+		return map[string]interface{}{"updated_at": primitive.NewDateTimeFromTime(writtenAt)}, nil
+	}
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+// configItems returns n config items keyed key-0, key-1 and so on
+func configItems(n int) []ConfigItem {
+	items := make([]ConfigItem, n)
+	for i := range items {
+		items[i] = ConfigItem{Key: fmt.Sprintf("key-%d", i), Value: "on"}
+	}
+	return items
+}
+
+// runConfigBatchRequest runs a batch allconfig operation against the allconfig table
+func runConfigBatchRequest(t *testing.T, conn connectors.DBConnector, req AllConfigOperationRequest) *ConfigBatchResult {
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, &req)
+	require.NoError(t, err)
+	return result.(*ConfigBatchResult)
+}
+
+func TestConfigBatchConcurrency(t *testing.T) {
+	conn := &latencyConnector{latency: 5 * time.Millisecond}
+	items := configItems(40)
+
+	start := time.Now()
+	result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_update_batch", ConfigItems: items, Concurrency: 8})
+	// Sequentially the items would take at least 200ms
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+
+	assert.Equal(t, 40, result.SuccessCount)
+	assert.False(t, result.Aborted)
+	assert.Empty(t, result.ResumeToken)
+	require.Len(t, result.Items, 40)
+	for i, item := range result.Items {
+		assert.Equal(t, i, item.Index)
+		assert.Equal(t, items[i].Key, item.Key)
+		assert.Equal(t, ConfigItemSucceeded, item.Status)
+	}
+}
+
+func TestConfigBatchStopsOnError(t *testing.T) {
+	missing := &mongo.DeleteResult{DeletedCount: 0}
+	deleted := &mongo.DeleteResult{DeletedCount: 1}
+	filter := func(key string) interface{} {
+		return mock.MatchedBy(func(params map[string]interface{}) bool {
+			return params["filter"].(map[string]interface{})["config_key"] == key
+		})
+	}
+
+	t.Run("continue_on_error false", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "delete", filter("key-1")).Return(missing, nil)
+		conn.On("Execute", mock.Anything, "delete", mock.Anything).Return(deleted, nil)
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{
+			Operation: "direct_delete_batch", ConfigItems: configItems(4), ContinueOnError: boolPtr(false),
+		})
+		assert.True(t, result.Aborted)
+		assert.Equal(t, []string{ConfigItemSucceeded, ConfigItemFailed, ConfigItemSkipped, ConfigItemSkipped}, itemStatuses(result))
+		assert.Equal(t, ErrorCodeNotFound, result.Items[1].ErrorCode)
+		assert.Equal(t, []string{"key-1", "key-2", "key-3"}, result.ResumeToken)
+		assert.Equal(t, map[string]interface{}{"skipped": true}, result.Results["key-3"])
+		assert.Equal(t, []int{1, 1, 2}, []int{result.SuccessCount, result.FailureCount, result.SkippedCount})
+		conn.AssertNumberOfCalls(t, "Execute", 2)
+	})
+
+	t.Run("continue_on_error by default", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "delete", filter("key-1")).Return(missing, nil)
+		conn.On("Execute", mock.Anything, "delete", mock.Anything).Return(deleted, nil)
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_delete_batch", ConfigItems: configItems(4)})
+		assert.False(t, result.Aborted)
+		assert.Equal(t, []string{ConfigItemSucceeded, ConfigItemFailed, ConfigItemSucceeded, ConfigItemSucceeded}, itemStatuses(result))
+		assert.Empty(t, result.ResumeToken)
+	})
+
+	t.Run("lost connection", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "delete", filter("key-2")).Return(nil, driver.ErrBadConn)
+		conn.On("Execute", mock.Anything, "delete", mock.Anything).Return(deleted, nil)
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_delete_batch", ConfigItems: configItems(5)})
+		assert.True(t, result.Aborted)
+		assert.Equal(t, []string{"key-2", "key-3", "key-4"}, result.ResumeToken)
+		conn.AssertNumberOfCalls(t, "Execute", 3)
+	})
+}
+
+func TestConfigBatchAtomic(t *testing.T) {
+	insert := "INSERT INTO allconfig"
+
+	t.Run("commit", func(t *testing.T) {
+		conn, mockDB := newSQLMockConnector(t, "mysql")
+		mockDB.ExpectBegin()
+		mockDB.ExpectExec(insert).WithArgs("key-0", "on", "", nil, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mockDB.ExpectQuery("SELECT created_at").WithArgs("key-0").WillReturnRows(timestampRows())
+		mockDB.ExpectExec(insert).WithArgs("key-1", "on", "", nil, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mockDB.ExpectQuery("SELECT created_at").WithArgs("key-1").WillReturnRows(timestampRows())
+		mockDB.ExpectCommit()
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(2), Atomic: true})
+		assert.True(t, result.Atomic)
+		assert.True(t, result.Committed)
+		assert.Equal(t, 2, result.SuccessCount)
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		conn, mockDB := newSQLMockConnector(t, "mysql")
+		mockDB.ExpectBegin()
+		mockDB.ExpectExec(insert).WithArgs("key-0", "on", "", nil, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mockDB.ExpectQuery("SELECT created_at").WithArgs("key-0").WillReturnRows(timestampRows())
+		mockDB.ExpectExec(insert).WithArgs("key-1", "on", "", nil, "").WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+		mockDB.ExpectRollback()
+
+		result := runConfigBatchRequest(t, conn, AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(3), Atomic: true})
+		assert.True(t, result.RolledBack)
+		assert.False(t, result.Committed)
+		assert.Equal(t, []string{ConfigItemRolledBack, ConfigItemFailed, ConfigItemSkipped}, itemStatuses(result))
+		assert.Equal(t, ErrorCodeConflict, result.Items[1].ErrorCode)
+		// Nothing was applied, so every key has to be sent again
+		assert.Equal(t, []string{"key-0", "key-1", "key-2"}, result.ResumeToken)
+		assert.Equal(t, []int{0, 1, 2}, []int{result.SuccessCount, result.FailureCount, result.SkippedCount})
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+}
+
+func TestCheckConfigBatchOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		dbType  string
+		req     AllConfigOperationRequest
+		message string
+	}{
+		{"not a batch", "mysql", AllConfigOperationRequest{Operation: "direct_update", Key: "k", Concurrency: 4}, "batch operations only"},
+		{"concurrency too high", "mysql", AllConfigOperationRequest{Operation: "update_batch", ConfigItems: configItems(1), Concurrency: 33}, "between 1 and 32"},
+		{"negative concurrency", "mysql", AllConfigOperationRequest{Operation: "update_batch", ConfigItems: configItems(1), Concurrency: -1}, "between 1 and 32"},
+		{"atomic on MongoDB", "mongodb", AllConfigOperationRequest{Operation: "delete_batch", ConfigItems: configItems(1), Atomic: true}, "MySQL and PostgreSQL"},
+		{"atomic with concurrency", "postgresql", AllConfigOperationRequest{Operation: "create_batch", ConfigItems: configItems(1), Atomic: true, Concurrency: 4}, "cannot set concurrency"},
+		{"atomic with continue_on_error", "postgresql", AllConfigOperationRequest{Operation: "create_batch", ConfigItems: configItems(1), Atomic: true, ContinueOnError: boolPtr(true)}, "cannot set continue_on_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkAllConfigOperation(&tt.req, tt.dbType)
+			var apiErr *apiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+			assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+			assert.Contains(t, apiErr.Message, tt.message)
+		})
+	}
+
+	req := AllConfigOperationRequest{Operation: "create_batch", ConfigItems: configItems(1), Atomic: true, ContinueOnError: boolPtr(false)}
+	_, err := checkAllConfigOperation(&req, "mysql")
+	assert.NoError(t, err)
+}
+
+// itemStatuses returns the status of each item of a batch result
+func itemStatuses(result *ConfigBatchResult) []string {
+	statuses := make([]string, len(result.Items))
+	for i, item := range result.Items {
+		statuses[i] = item.Status
+	}
+	return statuses
+}
+
+// BenchmarkConfigBatch updates 1000 configs against a connector taking 1ms per command, one at a time
+// and with a pool of workers
+func BenchmarkConfigBatch(b *testing.B) {
+	conn := &latencyConnector{latency: time.Millisecond}
+	items := configItems(1000)
+
+	for _, concurrency := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			req := AllConfigOperationRequest{Operation: "direct_update_batch", ConfigItems: items, Concurrency: concurrency}
+			req.TableName = "allconfig"
+			for i := 0; i < b.N; i++ {
+				result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, &req)
+				if err != nil || result.(*ConfigBatchResult).SuccessCount != len(items) {
+					b.Fatalf("batch failed: %v", err)
+				}
+			}
+		})
+	}
+}
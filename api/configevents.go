@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors"
+	"db-connectors/events"
+	"db-connectors/requestid"
+)
+
+// pendingEventsKey carries the config changes of an atomic batch, published once its transaction commits
+type pendingEventsKey struct{}
+
+type pendingEvents struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+// withPendingEvents returns a context holding back the config changes recorded with it
+func withPendingEvents(ctx context.Context) (context.Context, *pendingEvents) {
+	pending := &pendingEvents{}
+	return context.WithValue(ctx, pendingEventsKey{}, pending), pending
+}
+
+// publishesEvents reports whether config changes written through connector are published: a publisher
+// is set and the connector does not dry-run its writes
+func (a *API) publishesEvents(connector connectors.DBConnector) bool {
+	if a.events == nil {
+		return false
+	}
+	_, dryRun := connector.(*dryRunConnector)
+	return !dryRun
+}
+
+// recordConfigChange publishes a config change applied through connector, holding it back while the
+// transaction of an atomic batch is open
+func (a *API) recordConfigChange(ctx context.Context, connector connectors.DBConnector, event events.Event) {
+	if !a.publishesEvents(connector) {
+		return
+	}
+	event.Timestamp = time.Now().UTC()
+	event.RequestID = requestid.FromContext(ctx)
+	event.OperationID = operationID(ctx)
+	event.Labels = connectors.LabelsOf(connector)
+	if approval, ok := allconfig.ApprovalFrom(ctx); ok {
+		event.ApprovalRequestID, event.ApprovedBy = approval.RequestID, approval.CheckerID
+	}
+	if pending, ok := ctx.Value(pendingEventsKey{}).(*pendingEvents); ok {
+		pending.mu.Lock()
+		pending.events = append(pending.events, event)
+		pending.mu.Unlock()
+		return
+	}
+	a.events.Publish(event)
+}
+
+// publishPending publishes the changes held back by an atomic batch whose transaction committed
+func (a *API) publishPending(pending *pendingEvents) {
+	if a.events == nil {
+		return
+	}
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	a.events.Publish(pending.events...)
+}
+
+// previousValueHash returns the hash of the value stored under key before a change, reporting whether a
+// config is stored. Nothing is read unless changes are published; a failed read reports no config.
+func (a *API) previousValueHash(ctx context.Context, connector connectors.DBConnector, tableName, key string) (string, bool) {
+	if !a.publishesEvents(connector) {
+		return "", false
+	}
+	config, err := a.readConfig(ctx, connector, tableName, key)
+	if err != nil {
+		return "", false
+	}
+	row, found := allconfig.FirstConfig(config)
+	if !found {
+		return "", false
+	}
+	stored, _ := row.(map[string]interface{})
+	return valueHash(stored["config_value"]), true
+}
+
+// previousValueHashes returns the hashes of the values stored under the keys of items before they are
+// written, leaving out keys with no config
+func (a *API) previousValueHashes(ctx context.Context, connector connectors.DBConnector, tableName string, items []ConfigItem) map[string]string {
+	if !a.publishesEvents(connector) {
+		return nil
+	}
+	hashes := make(map[string]string, len(items))
+	for _, item := range items {
+		if hash, found := a.previousValueHash(ctx, connector, tableName, item.Key); found {
+			hashes[item.Key] = hash
+		}
+	}
+	return hashes
+}
+
+// recordConfigWrites records the writes of items that created or updated configs, telling them apart by
+// the hashes of the values stored before
+func (a *API) recordConfigWrites(ctx context.Context, connector connectors.DBConnector, tableName string, items []ConfigItem, previous map[string]string) {
+	for _, item := range items {
+		event := events.Event{Table: tableName, Key: item.Key, Operation: events.OperationCreate, NewValueHash: valueHash(item.Value), Actor: item.MakerID}
+		if hash, found := previous[item.Key]; found {
+			event.Operation, event.OldValueHash = events.OperationUpdate, hash
+		}
+		a.recordConfigChange(ctx, connector, event)
+	}
+}
+
+// valueHash returns the hex SHA-256 of a config value, as sent in events
+func valueHash(value interface{}) string {
+	sum := sha256.Sum256([]byte(valueText(value)))
+	return hex.EncodeToString(sum[:])
+}
+
+// EventStats reports the config change events published, failed and dropped; nil when events are not
+// published
+func (a *API) EventStats() *events.Stats {
+	if a.events == nil {
+		return nil
+	}
+	stats := a.events.Stats()
+	return &stats
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+	"db-connectors/events"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEventsAPI returns an API publishing config change events to memory, and a function returning the
+// events once every queued one has been published
+func newEventsAPI(t *testing.T) (*API, func() []events.Event) {
+	memory := events.NewMemory()
+	api := NewAPI()
+	api.events = events.NewAsync(memory, events.Options{})
+	return api, func() []events.Event {
+		require.NoError(t, api.events.Close(context.Background()))
+		return memory.Events()
+	}
+}
+
+// runAllConfig runs allconfig operations on the allconfig table, requiring each to succeed
+func runAllConfig(t *testing.T, api *API, conn connectors.DBConnector, reqs ...AllConfigOperationRequest) {
+	for _, req := range reqs {
+		req.TableName = "allconfig"
+		_, err := api.executeAllConfigOperation(context.Background(), conn, &req)
+		require.NoError(t, err, req.Operation)
+	}
+}
+
+// withoutTimestamps checks that every event has a timestamp and clears it, so events can be compared
+func withoutTimestamps(t *testing.T, published []events.Event) []events.Event {
+	for i := range published {
+		assert.False(t, published[i].Timestamp.IsZero(), "event %d has no timestamp", i)
+		published[i].Timestamp = time.Time{}
+	}
+	return published
+}
+
+func TestConfigEventsDirectWrites(t *testing.T) {
+	api, published := newEventsAPI(t)
+	runAllConfig(t, api, connectortest.NewFake(),
+		AllConfigOperationRequest{Operation: "direct_create", Key: "feature.flag", Value: "on", MakerID: "alice"},
+		AllConfigOperationRequest{Operation: "direct_update", Key: "feature.flag", Value: "off", MakerID: "bob"},
+		AllConfigOperationRequest{Operation: "direct_delete", Key: "feature.flag", MakerID: "carol"},
+	)
+
+	assert.Equal(t, []events.Event{
+		{Table: "allconfig", Key: "feature.flag", Operation: events.OperationCreate, NewValueHash: valueHash("on"), Actor: "alice"},
+		{Table: "allconfig", Key: "feature.flag", Operation: events.OperationUpdate, OldValueHash: valueHash("on"), NewValueHash: valueHash("off"), Actor: "bob"},
+		{Table: "allconfig", Key: "feature.flag", Operation: events.OperationDelete, OldValueHash: valueHash("off"), Actor: "carol"},
+	}, withoutTimestamps(t, published()))
+}
+
+// labeledDocumentConnector is a fake MongoDB connector carrying connection labels
+type labeledDocumentConnector struct {
+	*connectortest.Fake
+	labels map[string]string
+}
+
+func (c labeledDocumentConnector) Labels() map[string]string { return c.labels }
+
+func TestConfigEventsLabels(t *testing.T) {
+	api, published := newEventsAPI(t)
+	conn := labeledDocumentConnector{connectortest.NewFake(), map[string]string{"connection": "settings", "environment": "prod"}}
+	runAllConfig(t, api, conn, AllConfigOperationRequest{Operation: "direct_create", Key: "feature.flag", Value: "on", MakerID: "alice"})
+
+	events := published()
+	require.Len(t, events, 1)
+	assert.Equal(t, map[string]string{"connection": "settings", "environment": "prod"}, events[0].Labels)
+}
+
+func TestConfigEventsApproval(t *testing.T) {
+	api, published := newEventsAPI(t)
+	conn := connectortest.NewFake()
+	conn.Insert("allconfig", map[string]interface{}{"config_key": "feature.flag", "config_value": "on"})
+	for _, id := range []string{"req-1", "req-2"} {
+		conn.Insert("allconfig_approval_requests", map[string]interface{}{
+			"request_id": id, "status": "pending", "operation": "update", "config_key": "feature.flag",
+			"config_value": "off", "description": "", "maker_id": "bob",
+		})
+	}
+	runAllConfig(t, api, conn,
+		AllConfigOperationRequest{Operation: "submit_update", Key: "feature.flag", Value: "maybe", MakerID: "bob"},
+		AllConfigOperationRequest{Operation: "approve_request", RequestID: "req-1", CheckerID: "carol"},
+		AllConfigOperationRequest{Operation: "reject_request", RequestID: "req-2", CheckerID: "carol"},
+	)
+
+	// Submitting and rejecting change no config
+	assert.Equal(t, []events.Event{{
+		Table: "allconfig", Key: "feature.flag", Operation: events.OperationUpdate, OldValueHash: valueHash("on"), NewValueHash: valueHash("off"),
+		Actor: "bob", ApprovalRequestID: "req-1", ApprovedBy: "carol",
+	}}, withoutTimestamps(t, published()))
+}
+
+func TestConfigEventsBatches(t *testing.T) {
+	api, published := newEventsAPI(t)
+	conn := connectortest.NewFake()
+	conn.Insert("allconfig", map[string]interface{}{"config_key": "a", "config_value": "old-a"})
+	conn.Insert("allconfig", map[string]interface{}{"config_key": "c", "config_value": "old-c"})
+	runAllConfig(t, api, conn,
+		AllConfigOperationRequest{Operation: "set_multiple", Configs: map[string]interface{}{"a": "new-a", "b": "new-b"}},
+		AllConfigOperationRequest{Operation: "direct_create_batch", Upsert: true, ConfigItems: []ConfigItem{
+			{Key: "c", Value: "new-c", MakerID: "alice"},
+			{Key: "d", Value: "new-d", MakerID: "alice"},
+		}},
+		AllConfigOperationRequest{Operation: "direct_delete_all", Confirm: "allconfig"},
+	)
+
+	got := withoutTimestamps(t, published())
+	require.Len(t, got, 8)
+	// The changes of each batch share its operation ID
+	first, second := got[0].OperationID, got[2].OperationID
+	assert.NotEmpty(t, first)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, []events.Event{
+		{Table: "allconfig", Key: "a", Operation: events.OperationUpdate, OldValueHash: valueHash("old-a"), NewValueHash: valueHash("new-a"), OperationID: first},
+		{Table: "allconfig", Key: "b", Operation: events.OperationCreate, NewValueHash: valueHash("new-b"), OperationID: first},
+		{Table: "allconfig", Key: "c", Operation: events.OperationUpdate, OldValueHash: valueHash("old-c"), NewValueHash: valueHash("new-c"), Actor: "alice", OperationID: second},
+		{Table: "allconfig", Key: "d", Operation: events.OperationCreate, NewValueHash: valueHash("new-d"), Actor: "alice", OperationID: second},
+	}, got[:4])
+	// Deleting every config sends a delete for each
+	assert.ElementsMatch(t, []events.Event{
+		{Table: "allconfig", Key: "a", Operation: events.OperationDelete, OldValueHash: valueHash("new-a")},
+		{Table: "allconfig", Key: "b", Operation: events.OperationDelete, OldValueHash: valueHash("new-b")},
+		{Table: "allconfig", Key: "c", Operation: events.OperationDelete, OldValueHash: valueHash("new-c")},
+		{Table: "allconfig", Key: "d", Operation: events.OperationDelete, OldValueHash: valueHash("new-d")},
+	}, got[4:])
+}
+
+func TestConfigEventsDryRun(t *testing.T) {
+	api, published := newEventsAPI(t)
+	conn := connectortest.NewFake()
+	conn.Insert("allconfig", map[string]interface{}{"config_key": "feature.flag", "config_value": "on"})
+	runAllConfig(t, api, conn,
+		AllConfigOperationRequest{Operation: "direct_update", Key: "feature.flag", Value: "off", DryRun: true},
+		AllConfigOperationRequest{Operation: "direct_delete_all", Confirm: "allconfig", DryRun: true},
+	)
+	assert.Empty(t, published())
+}
+
+func TestConfigEventsAtomicBatch(t *testing.T) {
+	insert := "INSERT INTO allconfig"
+
+	t.Run("commit", func(t *testing.T) {
+		api, published := newEventsAPI(t)
+		conn, mockDB := newSQLMockConnector(t, "mysql")
+		mockDB.ExpectBegin()
+		mockDB.ExpectExec(insert).WithArgs("key-0", "on", "", nil, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mockDB.ExpectQuery("SELECT created_at").WithArgs("key-0").WillReturnRows(timestampRows())
+		mockDB.ExpectCommit()
+
+		req := AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(1), Atomic: true}
+		req.TableName = "allconfig"
+		req.LegacyMode = boolPtr(false)
+		result, err := api.executeAllConfigOperation(context.Background(), conn, &req)
+		require.NoError(t, err)
+		id := result.(*ConfigBatchResult).OperationID
+		assert.NotEmpty(t, id)
+		assert.Equal(t, []events.Event{
+			{Table: "allconfig", Key: "key-0", Operation: events.OperationCreate, NewValueHash: valueHash("on"), OperationID: id},
+		}, withoutTimestamps(t, published()))
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		api, published := newEventsAPI(t)
+		conn, mockDB := newSQLMockConnector(t, "mysql")
+		mockDB.ExpectBegin()
+		mockDB.ExpectExec(insert).WithArgs("key-0", "on", "", nil, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mockDB.ExpectQuery("SELECT created_at").WithArgs("key-0").WillReturnRows(timestampRows())
+		mockDB.ExpectExec(insert).WithArgs("key-1", "on", "", nil, "").WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+		mockDB.ExpectRollback()
+
+		req := AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: configItems(2), Atomic: true}
+		req.TableName = "allconfig"
+		req.LegacyMode = boolPtr(false)
+		_, err := api.executeAllConfigOperation(context.Background(), conn, &req)
+		require.NoError(t, err)
+		// The rolled back create never happened
+		assert.Empty(t, published())
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	})
+}
+
+func TestEventStats(t *testing.T) {
+	assert.Nil(t, NewAPI().EventStats())
+
+	api, published := newEventsAPI(t)
+	runAllConfig(t, api, connectortest.NewFake(), AllConfigOperationRequest{Operation: "direct_create", Key: "feature.flag", Value: "on"})
+	published()
+	assert.Equal(t, &events.Stats{Published: 1}, api.EventStats())
+}
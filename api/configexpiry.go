@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/events"
+)
+
+// expiringOperations are the operations taking an expires_at
+var expiringOperations = []string{"direct_create", "direct_update", "submit_create", "submit_update"}
+
+// ExpiredConfigs is the result of expire_configs: the keys of the configs it deleted
+type ExpiredConfigs struct {
+	Expired int      `json:"expired"`
+	Keys    []string `json:"keys"`
+}
+
+// checkExpiry rejects an expires_at on an operation not taking one, or one that has already passed
+func checkExpiry(req *AllConfigOperationRequest, spec *operationSpec) error {
+	if req.ExpiresAt == nil {
+		return nil
+	}
+	invalid := func(message string) error {
+		return &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: message,
+			Details: map[string]interface{}{"operation": req.Operation, "expires_at": req.ExpiresAt},
+		}
+	}
+	if !slices.Contains(expiringOperations, spec.Name) {
+		return invalid(fmt.Sprintf("expires_at applies to %s only, not %s", strings.Join(expiringOperations, ", "), req.Operation))
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		return invalid(fmt.Sprintf("expires_at must be in the future, got %s", req.ExpiresAt.UTC().Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// expiryArg returns an expiry in UTC, as the TIMESTAMP and DATETIME expires_at columns store it
+func expiryArg(expiresAt *time.Time) time.Time {
+	return expiresAt.UTC()
+}
+
+// expiryColumns returns the column and placeholder an insert adds for expiresAt, or none when it is nil so
+// that configs without an expiry are written as they were before configs could expire
+func expiryColumns(expiresAt *time.Time) (string, string) {
+	if expiresAt == nil {
+		return "", ""
+	}
+	return ", expires_at", ", ?"
+}
+
+// expiryOf returns the expires_at of an approval request row or document, or nil when it has none
+func expiryOf(request map[string]interface{}) *time.Time {
+	return mongoTime(request["expires_at"])
+}
+
+// sqlUnexpired returns the condition keeping out the configs whose expiry, held by column, has passed by
+// the database's clock. Reads hide expired configs before expire_configs deletes them.
+func sqlUnexpired(d connectors.Dialect, column string) string {
+	return "(" + column + " IS NULL OR " + column + " > " + d.UTCNowFunc() + ")"
+}
+
+// mongoUnexpired returns the condition on expires_at keeping out the MongoDB configs expired by now. The
+// TTL index deletes expired documents only about once a minute.
+func mongoUnexpired(now time.Time) map[string]interface{} {
+	return map[string]interface{}{"$not": map[string]interface{}{"$lte": now.UTC()}}
+}
+
+// unexpired adds to a MongoDB filter of configs the condition keeping out the expired ones, returning the
+// filter
+func (a *API) unexpired(filter map[string]interface{}) map[string]interface{} {
+	filter["expires_at"] = mongoUnexpired(a.now())
+	return filter
+}
+
+// expireConfigs deletes the configs of tableName whose expires_at has passed, recording each deletion as a
+// config change
+func (a *API) expireConfigs(ctx context.Context, connector connectors.DBConnector, tableName string) (*ExpiredConfigs, error) {
+	keys, err := a.expiredConfigKeys(ctx, connector, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired configs: %w", err)
+	}
+	expired := &ExpiredConfigs{Keys: []string{}}
+	for _, key := range keys {
+		deleted, err := a.deleteExpiredConfig(ctx, connector, tableName, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expire config %s: %w", key, err)
+		}
+		// Updated with a later expiry since it was listed
+		if !deleted {
+			continue
+		}
+		expired.Expired++
+		expired.Keys = append(expired.Keys, key)
+	}
+	return expired, nil
+}
+
+// expiredConfigKeys lists the keys of the configs of tableName whose expires_at has passed, in key order
+func (a *API) expiredConfigKeys(ctx context.Context, connector connectors.DBConnector, tableName string) ([]string, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		query := "SELECT config_key FROM " + sqlTable(ctx, tableName) + " WHERE expires_at <= " + sqlDialect(connector).UTCNowFunc() + " ORDER BY config_key"
+		rows, err := connector.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var keys []string
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		return keys, rows.Err()
+
+	case "mongodb":
+		result, err := connector.Execute(ctx, "find", map[string]interface{}{
+			"collection": tableName,
+			"filter":     map[string]interface{}{"expires_at": map[string]interface{}{"$lte": a.now().UTC()}},
+			"sort":       map[string]interface{}{"config_key": 1},
+		})
+		if err != nil {
+			return nil, err
+		}
+		docs, _ := result.([]map[string]interface{})
+		keys := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			keys = append(keys, asString(doc["config_key"]))
+		}
+		return keys, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+}
+
+// deleteExpiredConfig deletes the config under key when its expires_at has passed, reporting whether it did
+func (a *API) deleteExpiredConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string) (bool, error) {
+	oldHash, _ := a.previousValueHash(ctx, connector, tableName, key)
+	var result interface{}
+	var err error
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		result, err = connector.Execute(ctx, "execute", map[string]interface{}{
+			"query": connectors.Bind(d, "DELETE FROM "+sqlTable(ctx, tableName)+" WHERE config_key = ? AND expires_at <= "+d.UTCNowFunc()),
+			"args":  []interface{}{key},
+		})
+
+	case "mongodb":
+		result, err = connector.Execute(ctx, "delete", map[string]interface{}{
+			"collection": tableName,
+			"filter": map[string]interface{}{
+				"config_key": key,
+				"expires_at": map[string]interface{}{"$lte": a.now().UTC()},
+			},
+		})
+
+	default:
+		return false, fmt.Errorf("unsupported database type")
+	}
+	if err != nil {
+		return false, err
+	}
+	if deleted, _ := affectedCount(result); deleted == 0 {
+		return false, nil
+	}
+	a.recordConfigChange(ctx, connector, events.Event{Table: tableName, Key: key, Operation: events.OperationDelete, OldValueHash: oldHash})
+	return true, nil
+}
+
+// SweepExpiredConfigs runs expire_configs on the allconfig table of every connected SQL profile each
+// interval until ctx is done. MongoDB profiles are left to the TTL index of their collection.
+func (a *API) SweepExpiredConfigs(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, p := range a.profileList() {
+				a.sweepProfile(ctx, p)
+			}
+		}
+	}()
+}
+
+// sweepProfile deletes the expired configs of the allconfig table of p. A profile that has not connected
+// yet has served no configs and is skipped, as are legacy tables, which have no expires_at column.
+func (a *API) sweepProfile(ctx context.Context, p *profile) {
+	p.mu.Lock()
+	connected := p.connected
+	p.mu.Unlock()
+	if !connected || !isSQLType(p.connector().GetType()) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.phaseTimeouts.Operation)
+	defer cancel()
+	req := &AllConfigOperationRequest{Operation: "expire_configs"}
+	req.TableName = a.tableName(p.TableName)
+	req.Type = p.connector().GetType()
+	req.Schema = a.configSchema(req.Type, "")
+	if a.legacyMode(ctx, p.connector(), &req.AllConfigRequest) {
+		return
+	}
+	result, err := a.executeAllConfigOperation(ctx, p.connector(), req)
+	if err != nil {
+		a.logger.Warn("failed to expire configs", "profile", p.Name, "table", req.TableName, "error", err)
+		return
+	}
+	if expired := result.(*ExpiredConfigs); expired.Expired > 0 {
+		a.logger.Info("expired configs", "profile", p.Name, "table", req.TableName, "keys", expired.Keys)
+	}
+}
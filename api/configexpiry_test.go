@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// expiryTestNow is the time stopClock stops the clock at
+var expiryTestNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// stopClock stops the clock of api at expiryTestNow, so that its MongoDB reads put mongoUnexpired(expiryTestNow)
+// on expires_at
+func stopClock(api *API) *API {
+	api.now = func() time.Time { return expiryTestNow }
+	return api
+}
+
+func TestExpiredConfigsHiddenFromReads(t *testing.T) {
+	reads := []AllConfigOperationRequest{
+		{Operation: "read", Key: "feature.flag"},
+		{Operation: "read", Key: "feature.flag", FallbackKeys: []string{"feature"}},
+		{Operation: "read_all"},
+		{Operation: "search", SearchTerm: "feature"},
+		{Operation: "filter", Filter: map[string]interface{}{"maker_id": "alice"}},
+		{Operation: "count"},
+		{Operation: "exists", Key: "feature.flag"},
+	}
+
+	for dbType, condition := range map[string]string{
+		"mysql":      "(expires_at IS NULL OR expires_at > UTC_TIMESTAMP())",
+		"postgresql": "(expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'))",
+	} {
+		t.Run(dbType, func(t *testing.T) {
+			api := NewAPI()
+			for _, req := range reads {
+				conn := &statementConnector{t: t, dbType: dbType}
+				req.TableName = "allconfig"
+				req.LegacyMode = boolPtr(false)
+				api.executeAllConfigOperation(context.Background(), conn, &req)
+				require.Len(t, conn.statements, 1, req.Operation)
+				assert.Contains(t, conn.statements[0], "status = 'approved' AND "+condition, req.Operation)
+			}
+		})
+	}
+
+	t.Run("mongodb", func(t *testing.T) {
+		api := stopClock(NewAPI())
+		conn := connectortest.NewFake()
+		conn.Insert("allconfig", map[string]interface{}{"config_key": "feature.flag", "config_value": "on", "status": "approved", "expires_at": expiryTestNow})
+		conn.Insert("allconfig", map[string]interface{}{"config_key": "feature.eu", "config_value": "eu", "status": "approved", "expires_at": expiryTestNow.Add(time.Minute)})
+		conn.Insert("allconfig", map[string]interface{}{"config_key": "feature", "config_value": "off", "status": "approved"})
+		run := func(req AllConfigOperationRequest) (interface{}, error) {
+			req.TableName = "allconfig"
+			return api.executeAllConfigOperation(context.Background(), conn, &req)
+		}
+
+		// Expired at the instant of expires_at, as the TTL index deletes it
+		_, err := run(reads[0])
+		assert.ErrorIs(t, err, ErrConfigNotFound)
+		resolved, err := run(reads[1])
+		require.NoError(t, err)
+		assert.Equal(t, "feature", resolved.(map[string]interface{})["source"])
+
+		listed, err := run(reads[2])
+		require.NoError(t, err)
+		require.Len(t, listed, 2)
+		searched, err := run(reads[3])
+		require.NoError(t, err)
+		assert.Len(t, searched, 2)
+		counted, err := run(reads[5])
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, counted)
+		exists, err := run(reads[6])
+		require.NoError(t, err)
+		assert.Equal(t, false, exists.(map[string]interface{})["exists"])
+
+		// The admin reads still show it until it is deleted
+		admin, err := run(AllConfigOperationRequest{Operation: "read_all_admin"})
+		require.NoError(t, err)
+		assert.Len(t, admin, 3)
+	})
+}
+
+func TestExpireConfigs(t *testing.T) {
+	t.Run("mysql", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, "SELECT config_key FROM allconfig WHERE expires_at <= UTC_TIMESTAMP() ORDER BY config_key", []interface{}(nil)).
+			Return(newMockRows(t, []string{"config_key"}, []driver.Value{"feature.a"}, []driver.Value{"feature.b"}), nil).Once()
+		expire := "DELETE FROM allconfig WHERE config_key = ? AND expires_at <= UTC_TIMESTAMP()"
+		conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": expire, "args": []interface{}{"feature.a"}}).
+			Return(sqlmock.NewResult(0, 1), nil).Once()
+		// Given a later expiry since it was listed
+		conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": expire, "args": []interface{}{"feature.b"}}).
+			Return(sqlmock.NewResult(0, 0), nil).Once()
+
+		req := &AllConfigOperationRequest{Operation: "expire_configs"}
+		req.TableName = "allconfig"
+		req.LegacyMode = boolPtr(false)
+		result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, req)
+		require.NoError(t, err)
+		assert.Equal(t, &ExpiredConfigs{Expired: 1, Keys: []string{"feature.a"}}, result)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("mongodb", func(t *testing.T) {
+		api, published := newEventsAPI(t)
+		stopClock(api)
+		conn := connectortest.NewFake()
+		conn.Insert("allconfig", map[string]interface{}{"config_key": "feature.a", "config_value": "on", "status": "approved", "expires_at": expiryTestNow.Add(-time.Hour)})
+		conn.Insert("allconfig", map[string]interface{}{"config_key": "feature.b", "config_value": "on", "status": "approved", "expires_at": expiryTestNow.Add(time.Hour)})
+
+		req := &AllConfigOperationRequest{Operation: "expire_configs"}
+		req.TableName = "allconfig"
+		result, err := api.executeAllConfigOperation(context.Background(), conn, req)
+		require.NoError(t, err)
+		assert.Equal(t, &ExpiredConfigs{Expired: 1, Keys: []string{"feature.a"}}, result)
+		require.Len(t, conn.Documents("allconfig"), 1)
+		assert.Equal(t, "feature.b", conn.Documents("allconfig")[0]["config_key"])
+
+		announced := published()
+		require.Len(t, announced, 1)
+		assert.Equal(t, "feature.a", announced[0].Key)
+		assert.Equal(t, "delete", announced[0].Operation)
+		assert.Equal(t, valueHash("on"), announced[0].OldValueHash)
+	})
+}
+
+func TestCreateOverExpiredConfig(t *testing.T) {
+	conn := newServiceConnector("mysql")
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	insert := mock.MatchedBy(func(params map[string]interface{}) bool {
+		args, _ := params["args"].([]interface{})
+		return len(args) == 6 && args[5] == expiresAt
+	})
+	conn.On("Execute", mock.Anything, "execute", insert).
+		Return(nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'feature.flag' for key 'config_key'"}).Once()
+	conn.On("Execute", mock.Anything, "execute", map[string]interface{}{
+		"query": "DELETE FROM allconfig WHERE config_key = ? AND expires_at <= UTC_TIMESTAMP()",
+		"args":  []interface{}{"feature.flag"},
+	}).Return(sqlmock.NewResult(0, 1), nil).Once()
+	conn.On("Execute", mock.Anything, "execute", insert).Return(sqlmock.NewResult(0, 1), nil).Once()
+	conn.On("Query", mock.Anything, "SELECT created_at, updated_at, approved_at FROM allconfig WHERE config_key = ?", []interface{}{"feature.flag"}).
+		Return(newMockRows(t, []string{"created_at", "updated_at", "approved_at"}, []driver.Value{expiryTestNow, expiryTestNow, expiryTestNow}), nil).Once()
+
+	// The expired config holding the key is deleted to make way for the new one
+	result, err := NewAPI().createConfigDirect(context.Background(), conn, "allconfig", "feature.flag", "on", "", nil, &expiresAt, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, &expiresAt, result.(*ConfigWrite).ExpiresAt)
+	conn.AssertExpectations(t)
+
+	// A config that has not expired keeps its key
+	conn = newServiceConnector("mysql")
+	conn.On("Execute", mock.Anything, "execute", mock.Anything).
+		Return(nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'feature.flag' for key 'config_key'"}).Once()
+	conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(sqlmock.NewResult(0, 0), nil).Once()
+	_, err = NewAPI().createConfigDirect(context.Background(), conn, "allconfig", "feature.flag", "on", "", nil, nil, "alice")
+	assert.ErrorIs(t, err, ErrConfigExists)
+}
+
+func TestExpiringConfigApproval(t *testing.T) {
+	api := stopClock(NewAPI())
+	conn := connectortest.NewFake()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	run := func(req AllConfigOperationRequest) (interface{}, error) {
+		req.TableName = "allconfig"
+		return api.executeAllConfigOperation(context.Background(), conn, &req)
+	}
+
+	submitted, err := run(AllConfigOperationRequest{Operation: "submit_create", Key: "incident.override", Value: "on", MakerID: "bob", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	request := submitted.(*allconfig.Submitted)
+	assert.Equal(t, expiresAt.UTC(), *request.ExpiresAt)
+
+	_, err = run(AllConfigOperationRequest{Operation: "approve_request", RequestID: request.RequestID, CheckerID: "carol"})
+	require.NoError(t, err)
+	config, err := run(AllConfigOperationRequest{Operation: "read", Key: "incident.override"})
+	require.NoError(t, err)
+	assert.Equal(t, expiresAt.UTC(), config.(map[string]interface{})["expires_at"])
+}
+
+func TestCheckExpiry(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	_, err := checkAllConfigOperation(&AllConfigOperationRequest{Operation: "direct_create", Key: "k", ExpiresAt: &future}, "mysql")
+	assert.NoError(t, err)
+
+	_, err = checkAllConfigOperation(&AllConfigOperationRequest{Operation: "direct_create", Key: "k", ExpiresAt: &past}, "mysql")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	assert.Contains(t, apiErr.Message, "expires_at must be in the future")
+
+	_, err = checkAllConfigOperation(&AllConfigOperationRequest{Operation: "read", Key: "k", ExpiresAt: &future}, "mysql")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "expires_at applies to direct_create, direct_update, submit_create, submit_update only, not read", apiErr.Message)
+}
+
+func TestCreateTableTTLIndex(t *testing.T) {
+	conn := newServiceConnector("mongodb")
+	conn.On("Execute", mock.Anything, "insert", mock.Anything).Return(nil, nil).Once()
+	conn.On("Execute", mock.Anything, "createIndex", mock.Anything).Return(map[string]interface{}{"name": "config_key_1"}, nil).Twice()
+	conn.On("Execute", mock.Anything, "createIndex", map[string]interface{}{
+		"collection": "allconfig",
+		"index":      map[string]interface{}{"expires_at": 1},
+		"options":    map[string]interface{}{"expireAfterSeconds": 0},
+	}).Return(map[string]interface{}{"name": "expires_at_1"}, nil).Once()
+
+	result, err := NewAPI().createAllConfigTable(context.Background(), conn, "", "allconfig")
+	require.NoError(t, err)
+	assert.Equal(t, true, result.(map[string]interface{})["index_created"])
+	conn.AssertExpectations(t)
+}
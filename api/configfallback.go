@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"db-connectors/connectors"
+)
+
+// defaultSource is the source of a read resolved to its default_value
+const defaultSource = "default"
+
+// resolvesFallback reports whether a read tries fallback keys or a default value rather than its key alone
+func resolvesFallback(req *AllConfigOperationRequest) bool {
+	return len(req.FallbackKeys) > 0 || req.DefaultValue != nil
+}
+
+// checkFallback rejects fallback_keys and default_value on an operation other than read, and empty fallback keys
+func checkFallback(req *AllConfigOperationRequest, spec *operationSpec) error {
+	if !resolvesFallback(req) {
+		return nil
+	}
+	invalid := func(message string) error {
+		return &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: message,
+			Details: map[string]interface{}{"operation": req.Operation, "fallback_keys": req.FallbackKeys},
+		}
+	}
+	if spec.Name != "read" {
+		return invalid(fmt.Sprintf("fallback_keys and default_value apply to read only, not %s", req.Operation))
+	}
+	if slices.Contains(req.FallbackKeys, "") {
+		return invalid("fallback_keys must not hold empty keys")
+	}
+	return nil
+}
+
+// fallbackKeys returns the keys a read tries in order: its key, then each fallback key not tried before
+func fallbackKeys(req *AllConfigOperationRequest) []string {
+	keys := []string{req.Key}
+	for _, key := range req.FallbackKeys {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// resolveConfig reads the first of keys holding an approved config, looking all of them up with one query.
+// The config carries source, the key that supplied it. When none of the keys is stored, defaultValue is
+// returned as the value of the first key with the source "default", and ErrConfigNotFound when it is nil.
+func (a *API) resolveConfig(ctx context.Context, connector connectors.DBConnector, tableName string, keys []string, defaultValue interface{}) (interface{}, error) {
+	var found []map[string]interface{}
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		in := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+		priority := make([]string, len(keys))
+		args := make([]interface{}, 0, 2*len(keys))
+		for _, key := range keys {
+			args = append(args, key)
+		}
+		for i, key := range keys {
+			priority[i] = fmt.Sprintf("WHEN ? THEN %d", i)
+			args = append(args, key)
+		}
+		query := "SELECT config_key, config_value, description, tags, created_at, updated_at, maker_id, checker_id, approved_at, expires_at FROM " + sqlTable(ctx, tableName) +
+			" WHERE config_key IN (" + in + ") AND status = 'approved' AND " + sqlUnexpired(d, "expires_at") + " ORDER BY CASE config_key " + strings.Join(priority, " ") + " END"
+		rows, err := connector.Query(ctx, pageQuery(d, connectors.Bind(d, query), 1, 0), args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		if found, err = a.configRows(rows); err != nil {
+			return nil, err
+		}
+
+	case "mongodb":
+		result, err := connector.Execute(ctx, "find", map[string]interface{}{
+			"collection": tableName,
+			"filter": a.unexpired(map[string]interface{}{
+				"config_key": map[string]interface{}{"$in": keys},
+				"status":     "approved",
+			}),
+		})
+		if err != nil {
+			return nil, err
+		}
+		found, _ = result.([]map[string]interface{})
+		// MongoDB returns the configs in no particular order
+		slices.SortFunc(found, func(x, y map[string]interface{}) int {
+			return slices.Index(keys, asString(x["config_key"])) - slices.Index(keys, asString(y["config_key"]))
+		})
+
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+
+	if len(found) > 0 {
+		config := found[0]
+		config["source"] = config["config_key"]
+		return config, nil
+	}
+	if defaultValue == nil {
+		return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, strings.Join(keys, ", "))
+	}
+	return map[string]interface{}{
+		"config_key":   keys[0],
+		"config_value": defaultValue,
+		"source":       defaultSource,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackKeys(t *testing.T) {
+	req := &AllConfigOperationRequest{Operation: "read", Key: "feature.eu", FallbackKeys: []string{"feature", "feature.eu", "feature"}}
+	assert.Equal(t, []string{"feature.eu", "feature"}, fallbackKeys(req))
+	assert.True(t, resolvesFallback(req))
+	assert.True(t, resolvesFallback(&AllConfigOperationRequest{Key: "k", DefaultValue: false}))
+	assert.False(t, resolvesFallback(&AllConfigOperationRequest{Key: "k"}))
+}
+
+func TestCheckFallback(t *testing.T) {
+	_, err := checkAllConfigOperation(&AllConfigOperationRequest{Operation: "get_config", Key: "k", FallbackKeys: []string{"j"}, DefaultValue: "d"}, "mysql")
+	assert.NoError(t, err)
+
+	_, err = checkAllConfigOperation(&AllConfigOperationRequest{Operation: "exists", Key: "k", DefaultValue: "d"}, "mysql")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	assert.Equal(t, "fallback_keys and default_value apply to read only, not exists", apiErr.Message)
+
+	_, err = checkAllConfigOperation(&AllConfigOperationRequest{Operation: "read", Key: "k", FallbackKeys: []string{""}}, "mysql")
+	assert.EqualError(t, err, "fallback_keys must not hold empty keys")
+}
+
+func TestResolveConfigSQL(t *testing.T) {
+	columns := []string{"config_key", "config_value"}
+	tests := []struct {
+		dbType string
+		query  string
+	}{
+		{
+			dbType: "mysql",
+			query: "SELECT config_key, config_value, description, tags, created_at, updated_at, maker_id, checker_id, approved_at, expires_at FROM allconfig " +
+				"WHERE config_key IN (?, ?) AND status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP()) ORDER BY CASE config_key WHEN ? THEN 0 WHEN ? THEN 1 END LIMIT 1",
+		},
+		{
+			dbType: "postgresql",
+			query: "SELECT config_key, config_value, description, tags, created_at, updated_at, maker_id, checker_id, approved_at, expires_at FROM allconfig " +
+				"WHERE config_key IN ($1, $2) AND status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) ORDER BY CASE config_key WHEN $3 THEN 0 WHEN $4 THEN 1 END LIMIT 1",
+		},
+	}
+	keys := []string{"feature.eu", "feature"}
+	args := []interface{}{"feature.eu", "feature", "feature.eu", "feature"}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			api := NewAPI()
+			ctx := context.Background()
+			resolve := func(found []driver.Value, defaultValue interface{}) (interface{}, error) {
+				m := new(connectortest.MockDBConnector)
+				m.On("GetType").Return(tt.dbType)
+				if found != nil {
+					m.On("Query", mock.Anything, tt.query, args).Return(newMockRows(t, columns, found), nil).Once()
+				} else {
+					m.On("Query", mock.Anything, tt.query, args).Return(newMockRows(t, columns), nil).Once()
+				}
+				defer m.AssertExpectations(t)
+				return api.resolveConfig(ctx, m, "allconfig", keys, defaultValue)
+			}
+
+			result, err := resolve([]driver.Value{"feature.eu", "eu"}, "off")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"config_key": "feature.eu", "config_value": "eu", "source": "feature.eu"}, result)
+
+			result, err = resolve([]driver.Value{"feature", "on"}, nil)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"config_key": "feature", "config_value": "on", "source": "feature"}, result)
+
+			result, err = resolve(nil, "off")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"config_key": "feature.eu", "config_value": "off", "source": "default"}, result)
+
+			_, err = resolve(nil, nil)
+			assert.ErrorIs(t, err, ErrConfigNotFound)
+			assert.ErrorContains(t, err, "feature.eu, feature")
+		})
+	}
+}
+
+func TestResolveConfigMongoDB(t *testing.T) {
+	api := stopClock(NewAPI())
+	find := map[string]interface{}{
+		"collection": "allconfig",
+		"filter": map[string]interface{}{
+			"config_key": map[string]interface{}{"$in": []string{"feature.eu", "feature"}},
+			"status":     "approved",
+			"expires_at": mongoUnexpired(expiryTestNow),
+		},
+	}
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("mongodb")
+	m.On("Execute", mock.Anything, "find", find).Return([]map[string]interface{}{
+		{"config_key": "feature", "config_value": "on"},
+		{"config_key": "feature.eu", "config_value": "eu"},
+	}, nil).Once()
+	m.On("Execute", mock.Anything, "find", find).Return([]map[string]interface{}{}, nil).Twice()
+
+	// The earliest key wins whatever order the configs come back in
+	result, err := api.resolveConfig(context.Background(), m, "allconfig", []string{"feature.eu", "feature"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "eu", result.(map[string]interface{})["config_value"])
+	assert.Equal(t, "feature.eu", result.(map[string]interface{})["source"])
+
+	result, err = api.resolveConfig(context.Background(), m, "allconfig", []string{"feature.eu", "feature"}, 3.0)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"config_key": "feature.eu", "config_value": 3.0, "source": "default"}, result)
+
+	_, err = api.resolveConfig(context.Background(), m, "allconfig", []string{"feature.eu", "feature"}, nil)
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	m.AssertExpectations(t)
+}
+
+func TestReadWithFallbackRouting(t *testing.T) {
+	api := NewAPI()
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("mysql")
+	m.On("Query", mock.Anything, queryContaining("WHERE config_key IN (?, ?)"), []interface{}{"feature.eu", "feature", "feature.eu", "feature"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature", "on"}), nil)
+
+	req := &AllConfigOperationRequest{Operation: "read", Key: "feature.eu", FallbackKeys: []string{"feature"}}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	result, err := api.executeAllConfigOperation(context.Background(), m, req)
+	require.NoError(t, err)
+	assert.Equal(t, "feature", result.(map[string]interface{})["source"])
+	m.AssertExpectations(t)
+
+	req.LegacyMode = boolPtr(true)
+	_, err = api.executeAllConfigOperation(context.Background(), m, req)
+	assert.EqualError(t, err, "fallback_keys and default_value are not supported on legacy tables")
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultKeyMaxLength is the longest config key accepted by default, the size of the config_key column
+const DefaultKeyMaxLength = 255
+
+// DefaultKeyPattern matches the config keys accepted by default: letters, digits and . _ - /
+var DefaultKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// Rules of the key policy, named by the validation errors of keys breaking them
+const (
+	KeyRuleWhitespace = "whitespace" // No leading or trailing whitespace
+	KeyRuleMaxLength  = "max_length" // At most MaxLength characters
+	KeyRulePattern    = "pattern"    // Matches Pattern
+	KeyRuleUnique     = "unique"     // Distinct from the other keys of a batch once lowercased
+)
+
+// KeyPolicy restricts the keys operations may create configs under and optionally lowercases keys.
+// Updates, deletes and reads take existing keys as they are, so configs stored before a rule was
+// tightened can still be fixed or removed.
+type KeyPolicy struct {
+	MaxLength int            // Longest key in characters; zero uses DefaultKeyMaxLength
+	Pattern   *regexp.Regexp // Keys must match it; nil uses DefaultKeyPattern
+	Lowercase bool           // Lowercase keys in every operation, so keys differing in case are the same config
+
+	// Look keys up regardless of case, so every operation works on the stored config whose key differs in
+	// case only; requests may override it with case_insensitive
+	CaseInsensitive bool
+}
+
+// DefaultKeyPolicy returns the policy accepting keys of up to 255 letters, digits and . _ - / as given
+func DefaultKeyPolicy() KeyPolicy {
+	return KeyPolicy{MaxLength: DefaultKeyMaxLength, Pattern: DefaultKeyPattern}
+}
+
+// keyViolation is a config key of a batch breaking a rule of the key policy
+type keyViolation struct {
+	Index   int    `json:"index"` // Position of the item in the batch, in key order for a configs map
+	Key     string `json:"key"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// normalize returns key as the policy stores it
+func (p KeyPolicy) normalize(key string) string {
+	if p.Lowercase {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+// check returns the rule key breaks and why, or empty strings when the policy accepts it
+func (p KeyPolicy) check(key string) (string, string) {
+	maxLength := p.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultKeyMaxLength
+	}
+	pattern := p.Pattern
+	if pattern == nil {
+		pattern = DefaultKeyPattern
+	}
+
+	switch length := utf8.RuneCountInString(key); {
+	case strings.TrimSpace(key) != key:
+		return KeyRuleWhitespace, "must not start or end with whitespace"
+	case length > maxLength:
+		return KeyRuleMaxLength, fmt.Sprintf("must be at most %d characters, not %d", maxLength, length)
+	case !pattern.MatchString(key):
+		return KeyRulePattern, fmt.Sprintf("must match %s", pattern)
+	}
+	return "", ""
+}
+
+// checkKey returns a validation error naming the rule key breaks, or nil when the policy accepts it
+func (p KeyPolicy) checkKey(key string) error {
+	rule, message := p.check(key)
+	if rule == "" {
+		return nil
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: fmt.Sprintf("invalid config key %q: %s %s", key, rule, message),
+		Details: map[string]interface{}{"key": key, "rule": rule},
+	}
+}
+
+// normalizeRequest lowercases the keys of req, fallback keys included, when the policy asks for it, rejecting
+// a configs map holding two keys that differ only in case
+func (p KeyPolicy) normalizeRequest(req *AllConfigOperationRequest) error {
+	if !p.Lowercase {
+		return nil
+	}
+	req.Key = p.normalize(req.Key)
+	if len(req.FallbackKeys) > 0 {
+		keys := make([]string, len(req.FallbackKeys))
+		for i, key := range req.FallbackKeys {
+			keys[i] = p.normalize(key)
+		}
+		req.FallbackKeys = keys
+	}
+
+	if len(req.ConfigItems) > 0 {
+		items := make([]ConfigItem, len(req.ConfigItems))
+		for i, item := range req.ConfigItems {
+			item.Key = p.normalize(item.Key)
+			items[i] = item
+		}
+		req.ConfigItems = items
+	}
+
+	if len(req.Configs) > 0 {
+		configs := make(map[string]interface{}, len(req.Configs))
+		var violations []keyViolation
+		for i, key := range sortedConfigKeys(req.Configs) {
+			normalized := p.normalize(key)
+			if _, taken := configs[normalized]; taken {
+				violations = append(violations, keyViolation{
+					Index: i, Key: key, Rule: KeyRuleUnique, Message: fmt.Sprintf("is the same key as %s once lowercased", normalized),
+				})
+				continue
+			}
+			configs[normalized] = req.Configs[key]
+		}
+		if len(violations) > 0 {
+			return invalidKeysError(req.Operation, "configs", violations)
+		}
+		req.Configs = configs
+	}
+	return nil
+}
+
+// checkRequest checks every key of req against the policy, reporting all the invalid keys of a batch at once
+func (p KeyPolicy) checkRequest(req *AllConfigOperationRequest) error {
+	if req.Key != "" {
+		if err := p.checkKey(req.Key); err != nil {
+			err.(*apiError).Details["operation"] = req.Operation
+			return err
+		}
+	}
+
+	field, keys := "config_items", configItemKeys(req.ConfigItems)
+	if len(keys) == 0 {
+		field, keys = "configs", sortedConfigKeys(req.Configs)
+	}
+	var violations []keyViolation
+	for i, key := range keys {
+		if rule, message := p.check(key); rule != "" {
+			violations = append(violations, keyViolation{Index: i, Key: key, Rule: rule, Message: message})
+		}
+	}
+	if len(violations) > 0 {
+		return invalidKeysError(req.Operation, field, violations)
+	}
+	return nil
+}
+
+// invalidKeysError returns the validation error of a batch whose field holds invalid keys, naming each key
+// and the rule it breaks
+func invalidKeysError(operation, field string, violations []keyViolation) error {
+	described := make([]string, len(violations))
+	for i, v := range violations {
+		described[i] = fmt.Sprintf("%q (%s)", v.Key, v.Rule)
+	}
+	noun := "keys"
+	if len(violations) == 1 {
+		noun = "key"
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: fmt.Sprintf("%s has %d invalid config %s: %s", field, len(violations), noun, strings.Join(described, ", ")),
+		Details: map[string]interface{}{"operation": operation, "invalid_keys": violations},
+	}
+}
+
+// checkAllConfigRequest normalizes the keys of an /allconfig-operation request and checks it against the
+// registry and strict_operations, its tags, the value limits and value rules of writes and, for operations that can create configs, the key policy
+func (a *API) checkAllConfigRequest(req *AllConfigOperationRequest, dbType string) (*operationSpec, error) {
+	if err := a.keys.normalizeRequest(req); err != nil {
+		return nil, err
+	}
+	spec, err := checkAllConfigOperation(req, dbType)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkStrictOperation(req, spec); err != nil {
+		return nil, err
+	}
+	if err := checkRequestTags(req); err != nil {
+		return nil, err
+	}
+	if spec.CreatesKeys {
+		if err := a.keys.checkRequest(req); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Mutates {
+		if err := a.values.checkRequest(req); err != nil {
+			return nil, err
+		}
+		if err := a.rules.checkRequest(req); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"db-connectors/allconfig"
+	"db-connectors/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// requireKeyError asserts that err is a validation error of a single key breaking rule
+func requireKeyError(t *testing.T, err error, rule string) {
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	assert.Equal(t, rule, apiErr.Details["rule"])
+	assert.Contains(t, apiErr.Message, rule)
+}
+
+func TestKeyPolicyRules(t *testing.T) {
+	policy := DefaultKeyPolicy()
+	for _, key := range []string{"feature.flag", "app/db-host", "LIMITS_v2", strings.Repeat("k", DefaultKeyMaxLength)} {
+		assert.NoError(t, policy.checkKey(key), key)
+	}
+
+	for key, rule := range map[string]string{
+		" feature.flag":  KeyRuleWhitespace,
+		"feature.flag\n": KeyRuleWhitespace,
+		strings.Repeat("k", DefaultKeyMaxLength+1): KeyRuleMaxLength,
+		"feature flag": KeyRulePattern,
+		"feature:flag": KeyRulePattern,
+		"":             KeyRulePattern,
+	} {
+		requireKeyError(t, policy.checkKey(key), rule)
+	}
+
+	// Length counts characters rather than bytes
+	policy = KeyPolicy{MaxLength: 3, Pattern: regexp.MustCompile(`^\p{L}+$`)}
+	assert.NoError(t, policy.checkKey("äöü"))
+	requireKeyError(t, policy.checkKey("äöüß"), KeyRuleMaxLength)
+	requireKeyError(t, policy.checkKey("ab1"), KeyRulePattern)
+
+	// The zero policy is the default one
+	assert.NoError(t, KeyPolicy{}.checkKey("feature.flag"))
+	requireKeyError(t, KeyPolicy{}.checkKey("feature flag"), KeyRulePattern)
+}
+
+func TestCheckAllConfigRequestKeys(t *testing.T) {
+	api := NewAPI()
+
+	req := &AllConfigOperationRequest{Operation: "direct_create", Key: "feature flag"}
+	_, err := api.checkAllConfigRequest(req, "mysql")
+	requireKeyError(t, err, KeyRulePattern)
+	assert.Equal(t, "direct_create", err.(*apiError).Details["operation"])
+
+	// Updates and deletes take existing keys as they are
+	for _, operation := range []string{"direct_update", "direct_delete", "submit_update", "read"} {
+		req := &AllConfigOperationRequest{Operation: operation, Key: "legacy key", Value: "on", MakerID: "alice"}
+		_, err := api.checkAllConfigRequest(req, "mysql")
+		assert.NoError(t, err, operation)
+	}
+
+	t.Run("batch reports every invalid key", func(t *testing.T) {
+		items := append(configItems(2), ConfigItem{Key: " padded"}, ConfigItem{Key: "key-3"}, ConfigItem{Key: "bad key"})
+		_, err := api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "create_batch", ConfigItems: items}, "mysql")
+		var apiErr *apiError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+		assert.Equal(t, []keyViolation{
+			{Index: 2, Key: " padded", Rule: KeyRuleWhitespace, Message: "must not start or end with whitespace"},
+			{Index: 4, Key: "bad key", Rule: KeyRulePattern, Message: "must match " + DefaultKeyPattern.String()},
+		}, apiErr.Details["invalid_keys"])
+		assert.Contains(t, apiErr.Message, "config_items has 2 invalid config keys")
+
+		_, err = api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "set_multiple", Configs: map[string]interface{}{"ok": 1, "not ok": 2}}, "mysql")
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, []keyViolation{{Index: 0, Key: "not ok", Rule: KeyRulePattern, Message: "must match " + DefaultKeyPattern.String()}}, apiErr.Details["invalid_keys"])
+	})
+
+	t.Run("lowercase", func(t *testing.T) {
+		api := NewAPI()
+		api.keys.Lowercase = true
+
+		items := []ConfigItem{{Key: "Feature.Flag"}, {Key: "LIMITS"}}
+		req := &AllConfigOperationRequest{Operation: "create_batch", ConfigItems: items}
+		_, err := api.checkAllConfigRequest(req, "mysql")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"feature.flag", "limits"}, configItemKeys(req.ConfigItems))
+		assert.Equal(t, "Feature.Flag", items[0].Key, "the caller's items are left as they were")
+
+		req = &AllConfigOperationRequest{Operation: "direct_update", Key: "Feature.Flag", Value: "on"}
+		_, err = api.checkAllConfigRequest(req, "mysql")
+		require.NoError(t, err)
+		assert.Equal(t, "feature.flag", req.Key)
+
+		req = &AllConfigOperationRequest{Operation: "read", Key: "Feature.EU", FallbackKeys: []string{"Feature"}}
+		_, err = api.checkAllConfigRequest(req, "mysql")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"feature.eu", "feature"}, fallbackKeys(req))
+
+		req = &AllConfigOperationRequest{Operation: "create_batch", Configs: map[string]interface{}{"A": 1, "b": 2}}
+		_, err = api.checkAllConfigRequest(req, "mysql")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, req.Configs)
+
+		// Keys differing only in case are the same config
+		req = &AllConfigOperationRequest{Operation: "create_batch", Configs: map[string]interface{}{"Key": 1, "key": 2, "KEY": 3}}
+		_, err = api.checkAllConfigRequest(req, "mysql")
+		var apiErr *apiError
+		require.ErrorAs(t, err, &apiErr)
+		violations := apiErr.Details["invalid_keys"].([]keyViolation)
+		require.Len(t, violations, 2)
+		assert.Equal(t, KeyRuleUnique, violations[0].Rule)
+	})
+}
+
+func TestAllConfigOperationRejectsInvalidKeys(t *testing.T) {
+	// Rejected before connecting, so the unresolvable host is never reached
+	body, err := json.Marshal(map[string]interface{}{
+		"type": "mysql", "host": "db.invalid", "port": 3306, "database": "app",
+		"operation": "direct_create", "key": strings.Repeat("k", 300), "value": "on",
+	})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	NewServer(config.ServerConfig{}, WithKeyPolicy(KeyPolicy{MaxLength: 64})).routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/allconfig-operation", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeValidation, response.ErrorCode)
+	assert.Equal(t, KeyRuleMaxLength, response.Details["rule"])
+	assert.Contains(t, response.Error, "must be at most 64 characters, not 300")
+}
+
+func TestConfigServiceKeys(t *testing.T) {
+	ctx := context.Background()
+	existsRows := func(count int) interface{} {
+		return newMockRows(t, []string{"COUNT(*)"}, []driver.Value{count})
+	}
+
+	t.Run("creating an invalid key", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(0), nil).Once()
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodPut, "/v1/configs/feature%20flag", ConfigWriteRequest{Value: "on"},
+			map[string]string{UserIDHeader: "alice", UserRoleHeader: AdminRole})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"rule":"pattern"`)
+		assertNothingWritten(t, conn)
+
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(0), nil).Once()
+		_, err := NewAPI().ConfigService().SubmitSet(ctx, conn, allconfig.SetRequest{Table: "allconfig", Key: "feature flag", Value: "on", MakerID: "bob"})
+		requireKeyError(t, err, KeyRulePattern)
+		assertNothingWritten(t, conn)
+	})
+
+	t.Run("updating a legacy key", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(1), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(map[string]interface{}{"rows_affected": 1}, nil)
+		expectConfigTimestamps(t, conn, 1)
+
+		_, created, err := NewAPI().ConfigService().DirectSet(ctx, conn, allconfig.SetRequest{Table: "allconfig", Key: "legacy key", Value: "on", MakerID: "alice"})
+		require.NoError(t, err)
+		assert.False(t, created)
+	})
+
+	t.Run("lowercase", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), []interface{}{"feature.flag"}).Return(existsRows(0), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+			return params["args"].([]interface{})[0] == "feature.flag"
+		})).Return(map[string]interface{}{"rows_affected": 1}, nil)
+		expectConfigTimestamps(t, conn, 1)
+
+		server := NewServer(config.ServerConfig{}, WithKeyPolicy(KeyPolicy{Lowercase: true}))
+		result, created, err := server.API().ConfigService().DirectSet(ctx, conn, allconfig.SetRequest{Table: "allconfig", Key: "Feature.Flag", Value: "on", MakerID: "alice"})
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, "feature.flag", result.(*ConfigWrite).Key)
+	})
+}
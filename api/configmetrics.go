@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors"
+)
+
+// AllConfigStats returns the maker-checker counters of each allconfig table, by connection and then by
+// table. A connection is named by its profile, or else by the database it reaches.
+func (a *API) AllConfigStats() map[string]map[string]allconfig.TableStats {
+	return a.configMetrics.Stats()
+}
+
+// countPendingApprovals counts the pending approval requests of the allconfig table tableName
+func (a *API) countPendingApprovals(ctx context.Context, connector connectors.DBConnector, tableName string) (int64, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		rows, err := connector.Query(ctx, "SELECT COUNT(*) FROM "+sqlTable(ctx, a.approvalTable(tableName))+" WHERE status = 'pending'")
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+
+		var count int64
+		if rows.Next() {
+			if err := rows.Scan(&count); err != nil {
+				return 0, err
+			}
+		}
+		return count, rows.Err()
+
+	case "mongodb":
+		result, err := connector.Execute(ctx, "count", map[string]interface{}{
+			"collection": a.approvalTable(tableName),
+			"filter":     map[string]interface{}{"status": "pending"},
+		})
+		if err != nil {
+			return 0, err
+		}
+		switch count := result.(type) {
+		case int64:
+			return count, nil
+		case int:
+			return int64(count), nil
+		}
+		return 0, fmt.Errorf("unexpected count result: %T", result)
+
+	default:
+		return 0, fmt.Errorf("unsupported database type")
+	}
+}
+
+// RefreshPendingCounts runs count_pending on the allconfig table of every connected profile each interval
+// until ctx is done, reporting the counts as the pending backlog of each table in /metrics
+func (a *API) RefreshPendingCounts(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, p := range a.profileList() {
+				a.refreshPending(ctx, p)
+			}
+		}
+	}()
+}
+
+// refreshPending counts the pending requests of the allconfig table of p. A profile that has not connected
+// yet is skipped, as are legacy tables, which have no approval requests. A failed count leaves the last one
+// reported.
+func (a *API) refreshPending(ctx context.Context, p *profile) {
+	p.mu.Lock()
+	connected := p.connected
+	p.mu.Unlock()
+	if !connected {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.phaseTimeouts.Operation)
+	defer cancel()
+	req := &AllConfigOperationRequest{Operation: "count_pending"}
+	req.TableName = a.tableName(p.TableName)
+	req.Type = p.connector().GetType()
+	req.Schema = a.configSchema(req.Type, "")
+	if a.legacyMode(ctx, p.connector(), &req.AllConfigRequest) {
+		return
+	}
+	result, err := a.executeAllConfigOperation(ctx, p.connector(), req)
+	count, ok := result.(int64)
+	if err == nil && !ok {
+		err = fmt.Errorf("unexpected count result: %T", result)
+	}
+	if err != nil {
+		a.logger.Warn("failed to count pending approval requests", "profile", p.Name, "table", req.TableName, "error", err)
+		return
+	}
+	a.configMetrics.SetPending(p.Name, req.TableName, count)
+}
+
+// prometheusLabel escapes a label value of the Prometheus text format
+var prometheusLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// configSeries is the stats of one allconfig table of a connection, labelled for Prometheus
+type configSeries struct {
+	labels string
+	stats  allconfig.TableStats
+}
+
+// writeAllConfigPrometheus writes stats in the Prometheus text format: the requests submitted and approved
+// by connection, table and operation and rejected by connection and table as counters, the approval
+// latency of each table as a histogram, and the pending requests of each table counted so far as a gauge
+func writeAllConfigPrometheus(w io.Writer, stats map[string]map[string]allconfig.TableStats) {
+	connections := make([]string, 0, len(stats))
+	for connection := range stats {
+		connections = append(connections, connection)
+	}
+	sort.Strings(connections)
+	var series []configSeries
+	for _, connection := range connections {
+		tables := make([]string, 0, len(stats[connection]))
+		for table := range stats[connection] {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			labels := `connection="` + prometheusLabel.Replace(connection) + `",table="` + prometheusLabel.Replace(table) + `"`
+			series = append(series, configSeries{labels: labels, stats: stats[connection][table]})
+		}
+	}
+
+	byOperation := func(name, help string, counts func(allconfig.TableStats) map[string]int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, s := range series {
+			operations := counts(s.stats)
+			names := make([]string, 0, len(operations))
+			for operation := range operations {
+				names = append(names, operation)
+			}
+			sort.Strings(names)
+			for _, operation := range names {
+				fmt.Fprintf(w, "%s{%s,operation=\"%s\"} %d\n", name, s.labels, prometheusLabel.Replace(operation), operations[operation])
+			}
+		}
+	}
+
+	byOperation("allconfig_requests_submitted_total", "Approval requests submitted.",
+		func(s allconfig.TableStats) map[string]int64 { return s.Submitted })
+	byOperation("allconfig_requests_approved_total", "Approval requests approved.",
+		func(s allconfig.TableStats) map[string]int64 { return s.Approved })
+
+	fmt.Fprint(w, "# HELP allconfig_requests_rejected_total Approval requests rejected.\n# TYPE allconfig_requests_rejected_total counter\n")
+	for _, s := range series {
+		fmt.Fprintf(w, "allconfig_requests_rejected_total{%s} %d\n", s.labels, s.stats.Rejected)
+	}
+
+	fmt.Fprint(w, "# HELP allconfig_approval_latency_seconds Time from requested_at to approval.\n# TYPE allconfig_approval_latency_seconds histogram\n")
+	for _, s := range series {
+		latency := s.stats.ApprovalLatency
+		for _, bucket := range latency.Buckets {
+			fmt.Fprintf(w, "allconfig_approval_latency_seconds_bucket{%s,le=\"%s\"} %d\n", s.labels, strconv.FormatFloat(bucket.LeSeconds, 'g', -1, 64), bucket.Count)
+		}
+		fmt.Fprintf(w, "allconfig_approval_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", s.labels, latency.Count)
+		fmt.Fprintf(w, "allconfig_approval_latency_seconds_sum{%s} %s\n", s.labels, strconv.FormatFloat(latency.SumSeconds, 'g', -1, 64))
+		fmt.Fprintf(w, "allconfig_approval_latency_seconds_count{%s} %d\n", s.labels, latency.Count)
+	}
+
+	fmt.Fprint(w, "# HELP allconfig_pending_requests Approval requests pending when last counted.\n# TYPE allconfig_pending_requests gauge\n")
+	for _, s := range series {
+		if pending := s.stats.Pending; pending != nil {
+			fmt.Fprintf(w, "allconfig_pending_requests{%s} %d\n", s.labels, *pending)
+		}
+	}
+}
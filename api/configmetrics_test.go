@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors/connectortest"
+	"db-connectors/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllConfigMetrics(t *testing.T) {
+	api := NewAPI()
+	conn := connectortest.NewFake()
+	run := func(req AllConfigOperationRequest) interface{} {
+		req.TableName = "allconfig"
+		req.Type, req.Host, req.Port, req.Database = "mongodb", "config-db", 27017, "app"
+		result, err := api.executeAllConfigOperation(context.Background(), conn, &req)
+		require.NoError(t, err)
+		return result
+	}
+
+	created := run(AllConfigOperationRequest{Operation: "submit_create", Key: "feature.flag", Value: "on", MakerID: "bob"}).(*allconfig.Submitted)
+	updated := run(AllConfigOperationRequest{Operation: "submit_update", Key: "feature.flag", Value: "off", MakerID: "bob"}).(*allconfig.Submitted)
+	run(AllConfigOperationRequest{Operation: "approve_request", RequestID: created.RequestID, CheckerID: "carol"})
+	run(AllConfigOperationRequest{Operation: "reject_request", RequestID: updated.RequestID, CheckerID: "carol"})
+
+	// Dry runs are left out
+	_, err := api.dryRunAllConfigOperation(context.Background(), conn, &AllConfigOperationRequest{
+		AllConfigRequest: AllConfigRequest{TableName: "allconfig"},
+		Operation:        "submit_delete",
+		Key:              "feature.flag",
+		MakerID:          "bob",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(0), run(AllConfigOperationRequest{Operation: "count_pending"}))
+	run(AllConfigOperationRequest{Operation: "submit_delete", Key: "feature.flag", MakerID: "bob"})
+	assert.Equal(t, int64(1), run(AllConfigOperationRequest{Operation: "count_pending"}))
+
+	// Requests not made through a profile count under the database they reach
+	const connection = "mongodb://config-db:27017/app"
+	stats := api.AllConfigStats()[connection]["allconfig"]
+	assert.Equal(t, map[string]int64{"create": 1, "update": 1, "delete": 1}, stats.Submitted)
+	assert.Equal(t, map[string]int64{"create": 1}, stats.Approved)
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, int64(1), stats.ApprovalLatency.Count)
+
+	rr := httptest.NewRecorder()
+	api.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var response struct {
+		Data Metrics `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, int64(1), response.Data.AllConfig[connection]["allconfig"].Rejected)
+
+	rr = httptest.NewRecorder()
+	api.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics?format=prometheus", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `allconfig_requests_submitted_total{connection="mongodb://config-db:27017/app",table="allconfig",operation="delete"} 1`)
+	assert.Contains(t, rr.Body.String(), `allconfig_requests_rejected_total{connection="mongodb://config-db:27017/app",table="allconfig"} 1`)
+
+	rr = httptest.NewRecorder()
+	api.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Unsupported metrics format: xml")
+}
+
+func TestWriteAllConfigPrometheus(t *testing.T) {
+	pending := int64(2)
+	stats := map[string]map[string]allconfig.TableStats{
+		"primary": {"settings": {
+			Submitted: map[string]int64{"update": 3, "create": 1},
+			Approved:  map[string]int64{"create": 1},
+			Rejected:  1,
+			ApprovalLatency: allconfig.ApprovalLatency{
+				Count:      2,
+				SumSeconds: 90.5,
+				Buckets:    []allconfig.LatencyBucket{{LeSeconds: 60, Count: 1}, {LeSeconds: 300, Count: 1}},
+			},
+			Pending: &pending,
+		}},
+		"replica": {`odd"table`: {Submitted: map[string]int64{}, Approved: map[string]int64{}}},
+	}
+
+	var out bytes.Buffer
+	writeAllConfigPrometheus(&out, stats)
+	assert.Equal(t, `# HELP allconfig_requests_submitted_total Approval requests submitted.
+# TYPE allconfig_requests_submitted_total counter
+allconfig_requests_submitted_total{connection="primary",table="settings",operation="create"} 1
+allconfig_requests_submitted_total{connection="primary",table="settings",operation="update"} 3
+# HELP allconfig_requests_approved_total Approval requests approved.
+# TYPE allconfig_requests_approved_total counter
+allconfig_requests_approved_total{connection="primary",table="settings",operation="create"} 1
+# HELP allconfig_requests_rejected_total Approval requests rejected.
+# TYPE allconfig_requests_rejected_total counter
+allconfig_requests_rejected_total{connection="primary",table="settings"} 1
+allconfig_requests_rejected_total{connection="replica",table="odd\"table"} 0
+# HELP allconfig_approval_latency_seconds Time from requested_at to approval.
+# TYPE allconfig_approval_latency_seconds histogram
+allconfig_approval_latency_seconds_bucket{connection="primary",table="settings",le="60"} 1
+allconfig_approval_latency_seconds_bucket{connection="primary",table="settings",le="300"} 1
+allconfig_approval_latency_seconds_bucket{connection="primary",table="settings",le="+Inf"} 2
+allconfig_approval_latency_seconds_sum{connection="primary",table="settings"} 90.5
+allconfig_approval_latency_seconds_count{connection="primary",table="settings"} 2
+allconfig_approval_latency_seconds_bucket{connection="replica",table="odd\"table",le="+Inf"} 0
+allconfig_approval_latency_seconds_sum{connection="replica",table="odd\"table"} 0
+allconfig_approval_latency_seconds_count{connection="replica",table="odd\"table"} 0
+# HELP allconfig_pending_requests Approval requests pending when last counted.
+# TYPE allconfig_pending_requests gauge
+allconfig_pending_requests{connection="primary",table="settings"} 2
+`, out.String())
+}
+
+func TestCountPendingApprovalsSQL(t *testing.T) {
+	conn := newServiceConnector("postgresql")
+	conn.On("Query", mock.Anything, "SELECT COUNT(*) FROM allconfig_approval_requests WHERE status = 'pending'", []interface{}(nil)).
+		Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{4}), nil)
+
+	count, err := NewAPI().countPendingApprovals(context.Background(), conn, "allconfig")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+}
+
+func TestRefreshPending(t *testing.T) {
+	ctx := context.Background()
+	var logs bytes.Buffer
+	api := NewAPI()
+	api.logger = logging.New(logging.Options{Level: "info", Format: logging.FormatJSON, Output: &logs})
+
+	fake := connectortest.NewFake()
+	fake.Insert("settings_approval_requests", map[string]interface{}{"request_id": "req-1", "status": "pending"})
+	fake.Insert("settings_approval_requests", map[string]interface{}{"request_id": "req-2", "status": "approved"})
+	failing := newProfileConnector("mongodb")
+	failing.On("Execute", mock.Anything, "count", mock.Anything).Return(nil, errors.New("connection reset"))
+	idle := newProfileConnector("mongodb")
+
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: fake, TableName: "settings"})
+	api.addProfile(ConnectionProfile{Name: "replica", Connector: failing, TableName: "replica_settings"})
+	api.addProfile(ConnectionProfile{Name: "idle", Connector: idle, TableName: "idle_settings"})
+	for _, name := range []string{"primary", "replica"} {
+		p, _ := api.lookupProfile(name)
+		p.connected = true
+	}
+
+	for _, p := range api.profileList() {
+		api.refreshPending(ctx, p)
+	}
+	stats := api.AllConfigStats()
+	require.Contains(t, stats["primary"], "settings")
+	assert.Equal(t, int64(1), *stats["primary"]["settings"].Pending)
+	assert.NotContains(t, stats, "replica")
+	assert.NotContains(t, stats, "idle")
+	assert.Contains(t, logs.String(), "failed to count pending approval requests")
+	idle.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+
+	// A failed count leaves the last one in place
+	api.configMetrics.SetPending("replica", "replica_settings", 7)
+	p, _ := api.lookupProfile("replica")
+	api.refreshPending(ctx, p)
+	assert.Equal(t, int64(7), *api.AllConfigStats()["replica"]["replica_settings"].Pending)
+}
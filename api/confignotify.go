@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"db-connectors/connectors"
+)
+
+// maxConfigChannel bounds channel names so that the trigger and function named after them stay within
+// PostgreSQL's 63 byte identifiers
+const maxConfigChannel = 63 - len("_notify")
+
+// ConfigChange is the payload notified on the channel of an allconfig table for every row changed
+type ConfigChange struct {
+	Table     string `json:"table"`
+	Key       string `json:"key"`
+	Operation string `json:"operation"` // insert, update or delete
+}
+
+// configChangeChannel returns the channel changes to an allconfig table are notified on: the table name,
+// lowercased with characters other than letters, digits and '_' replaced, followed by "_changes". Names
+// too long for an identifier are cut and end with a hash of the table name instead.
+func configChangeChannel(tableName string) string {
+	channel := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(tableName)) + "_changes"
+	if len(channel) <= maxConfigChannel {
+		return channel
+	}
+	sum := sha256.Sum256([]byte(tableName))
+	hash := hex.EncodeToString(sum[:4])
+	return channel[:maxConfigChannel-len(hash)-1] + "_" + hash
+}
+
+// configNotifySQL creates the trigger notifying the changes to a PostgreSQL allconfig table. NOTIFY is
+// sent by the transaction applying a change and delivered once it commits, so listeners never hear of a
+// change that was rolled back. The channel is named after tableName whichever schema qualifies it as table.
+func configNotifySQL(tableName, table string) string {
+	return fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]s_notify() RETURNS trigger AS $$
+DECLARE
+    changed_key TEXT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed_key := OLD.config_key;
+    ELSE
+        changed_key := NEW.config_key;
+    END IF;
+    PERFORM pg_notify('%[1]s', json_build_object('table', TG_TABLE_NAME, 'key', changed_key, 'operation', lower(TG_OP))::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS %[1]s_notify ON %[2]s;
+
+CREATE TRIGGER %[1]s_notify AFTER INSERT OR UPDATE OR DELETE ON %[2]s
+    FOR EACH ROW EXECUTE PROCEDURE %[1]s_notify();`, configChangeChannel(tableName), table)
+}
+
+// parseConfigChange decodes the payload of a config change notification
+func parseConfigChange(payload string) (ConfigChange, error) {
+	var change ConfigChange
+	if err := json.Unmarshal([]byte(payload), &change); err != nil {
+		return ConfigChange{}, fmt.Errorf("invalid config change notification %q: %w", payload, err)
+	}
+	if change.Key == "" || change.Operation == "" {
+		return ConfigChange{}, fmt.Errorf("invalid config change notification %q: key and operation are required", payload)
+	}
+	return change, nil
+}
+
+// createConfigNotifyTrigger adds the trigger notifying changes to a PostgreSQL allconfig table when config
+// change notifications are enabled; create_table runs it on new and existing tables alike
+func (a *API) createConfigNotifyTrigger(ctx context.Context, connector connectors.DBConnector, tableName string) error {
+	if !a.notifyConfigChanges || connector.GetType() != "postgresql" {
+		return nil
+	}
+	if _, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": configNotifySQL(tableName, sqlTable(ctx, tableName))}); err != nil {
+		return fmt.Errorf("failed to create the change notification trigger of %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// ListenConfigChanges listens for the changes to the allconfig table of every profile whose connector
+// receives notifications, until ctx is done. Every change, and every reconnection of a listener after
+// which changes may have been missed, drops the cached query results.
+func (a *API) ListenConfigChanges(ctx context.Context) {
+	for _, p := range a.profileList() {
+		p.mu.Lock()
+		a.listenProfile(ctx, p)
+		p.mu.Unlock()
+	}
+}
+
+// listenProfile listens for the changes to the allconfig table of p until ctx is done, unless its connector
+// receives no notifications. Callers hold p.mu.
+func (a *API) listenProfile(ctx context.Context, p *profile) {
+	listener, ok := p.Connector.(connectors.Listener)
+	if !ok {
+		return
+	}
+	listenCtx, cancel := context.WithCancel(ctx)
+	p.stopListening, p.listening = cancel, ctx
+	go a.listenConfigChanges(listenCtx, p.Name, listener, a.tableName(p.TableName))
+}
+
+// listenConfigChanges listens for the changes to the allconfig table of one profile
+func (a *API) listenConfigChanges(ctx context.Context, profile string, listener connectors.Listener, tableName string) {
+	channel := configChangeChannel(tableName)
+	err := listener.Listen(ctx, channel, func(n connectors.Notification) {
+		a.configChanged(ctx, profile, n)
+	})
+	if err != nil {
+		a.logger.Error("failed to listen for config changes", "profile", profile, "channel", channel, "error", err)
+	}
+}
+
+// configChanged handles a notification of the allconfig table of profile. The query cache does not know
+// which tables its results read, so all of them are dropped.
+func (a *API) configChanged(ctx context.Context, profile string, n connectors.Notification) {
+	if n.Resync {
+		a.logger.InfoContext(ctx, "config listener resynced", "profile", profile, "channel", n.Channel)
+	} else {
+		change, err := parseConfigChange(n.Payload)
+		if err != nil {
+			a.logger.WarnContext(ctx, "ignoring config change notification", "profile", profile, "error", err)
+			return
+		}
+		a.logger.DebugContext(ctx, "config changed", "profile", profile, "table", change.Table, "key", change.Key, "operation", change.Operation)
+	}
+	if a.queryCache != nil {
+		a.queryCache.invalidateAll()
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyingConnector is a connector whose Listen delivers the notifications sent on its channel
+type notifyingConnector struct {
+	*connectortest.MockDBConnector
+	notifications chan connectors.Notification
+	channels      chan string // Receives the channel listened on
+}
+
+func (c *notifyingConnector) Listen(ctx context.Context, channel string, handle func(connectors.Notification)) error {
+	c.channels <- channel
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-c.notifications:
+			handle(n)
+		}
+	}
+}
+
+func TestConfigChangeChannel(t *testing.T) {
+	assert.Equal(t, "allconfig_changes", configChangeChannel("allconfig"))
+	assert.Equal(t, "app_cfg_allconfig_changes", configChangeChannel("App.cfg_AllConfig"))
+
+	long := configChangeChannel(strings.Repeat("t", 80))
+	assert.Len(t, long, maxConfigChannel)
+	assert.NotEqual(t, long, configChangeChannel(strings.Repeat("t", 81)))
+}
+
+func TestConfigNotifySQL(t *testing.T) {
+	ddl := configNotifySQL("cfg_allconfig", "cfg_allconfig")
+	assert.Contains(t, ddl, "CREATE OR REPLACE FUNCTION cfg_allconfig_changes_notify() RETURNS trigger")
+	assert.Contains(t, ddl, "pg_notify('cfg_allconfig_changes', json_build_object('table', TG_TABLE_NAME, 'key', changed_key, 'operation', lower(TG_OP))::text)")
+	assert.Contains(t, ddl, "DROP TRIGGER IF EXISTS cfg_allconfig_changes_notify ON cfg_allconfig;")
+	assert.Contains(t, ddl, "AFTER INSERT OR UPDATE OR DELETE ON cfg_allconfig")
+}
+
+func TestParseConfigChange(t *testing.T) {
+	// As json_build_object formats it
+	change, err := parseConfigChange(`{"table" : "allconfig", "key" : "feature.flag", "operation" : "delete"}`)
+	require.NoError(t, err)
+	assert.Equal(t, ConfigChange{Table: "allconfig", Key: "feature.flag", Operation: "delete"}, change)
+
+	_, err = parseConfigChange("feature.flag")
+	assert.ErrorContains(t, err, `invalid config change notification "feature.flag"`)
+	_, err = parseConfigChange(`{"table": "allconfig"}`)
+	assert.ErrorContains(t, err, "key and operation are required")
+}
+
+func TestCreateConfigNotifyTrigger(t *testing.T) {
+	ctx := context.Background()
+	api := NewAPI()
+
+	// Disabled, nothing is created
+	require.NoError(t, api.createConfigNotifyTrigger(ctx, newProfileConnector("postgresql"), "allconfig"))
+
+	api.notifyConfigChanges = true
+	require.NoError(t, api.createConfigNotifyTrigger(ctx, newProfileConnector("mysql"), "allconfig"))
+
+	conn := newProfileConnector("postgresql")
+	conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["query"] == configNotifySQL("allconfig", "allconfig")
+	})).Return(nil, nil).Once()
+	require.NoError(t, api.createConfigNotifyTrigger(ctx, conn, "allconfig"))
+	conn.AssertNumberOfCalls(t, "Execute", 1)
+
+	failing := newProfileConnector("postgresql")
+	failing.On("Execute", mock.Anything, "execute", mock.Anything).Return(nil, errors.New("permission denied"))
+	err := api.createConfigNotifyTrigger(ctx, failing, "allconfig")
+	assert.EqualError(t, err, "failed to create the change notification trigger of allconfig: permission denied")
+}
+
+func TestListenConfigChanges(t *testing.T) {
+	api := NewAPI()
+	conn := &notifyingConnector{
+		MockDBConnector: newProfileConnector("postgresql"),
+		notifications:   make(chan connectors.Notification),
+		channels:        make(chan string, 1),
+	}
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: conn, TableName: "cfg_allconfig"})
+	api.addProfile(ConnectionProfile{Name: "reporting", Connector: newProfileConnector("mysql")})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	api.ListenConfigChanges(ctx)
+	select {
+	case channel := <-conn.channels:
+		assert.Equal(t, "cfg_allconfig_changes", channel)
+	case <-time.After(time.Second):
+		t.Fatal("profile is not listened on")
+	}
+
+	cached := func() {
+		api.queryCache.put("a", "one", 1, time.Minute)
+		api.queryCache.put("b", "two", 2, time.Minute)
+	}
+	cached()
+	conn.notifications <- connectors.Notification{Channel: "cfg_allconfig_changes", Payload: "not json"}
+	conn.notifications <- connectors.Notification{Channel: "cfg_allconfig_changes", Payload: `{"table": "cfg_allconfig", "key": "feature.flag", "operation": "update"}`}
+	// Each notification is received once the one before has been handled
+	conn.notifications <- connectors.Notification{Channel: "cfg_allconfig_changes", Resync: true}
+	stats := api.QueryCacheStats()
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(2), stats.Invalidations)
+
+	// A resync drops the results cached since, whatever changed while disconnected
+	cached()
+	conn.notifications <- connectors.Notification{Channel: "cfg_allconfig_changes", Resync: true}
+	conn.notifications <- connectors.Notification{Channel: "cfg_allconfig_changes", Resync: true}
+	stats = api.QueryCacheStats()
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(4), stats.Invalidations)
+}
+
+func TestQueryCacheInvalidateAll(t *testing.T) {
+	cache := newQueryCache(1024)
+	cache.put("a", "one", 1, time.Minute)
+	cache.put("b", "two", 2, time.Minute)
+	cache.invalidateAll()
+
+	_, _, hit := cache.get("a", time.Minute)
+	assert.False(t, hit)
+	stats := cache.snapshot()
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(0), stats.Bytes)
+	assert.Equal(t, int64(2), stats.Invalidations)
+}
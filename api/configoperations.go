@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"db-connectors/requestid"
+)
+
+// maxConfigOperations bounds the batch and import operations kept for get_operation; the oldest is forgotten
+// first
+const maxConfigOperations = 1000
+
+// ConfigOperation reports the keys written by a batch or import allconfig operation and the outcome of each
+type ConfigOperation struct {
+	OperationID string            `json:"operation_id"`
+	Operation   string            `json:"operation"`
+	Table       string            `json:"table"`
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  time.Time         `json:"finished_at"`
+	Items       []ConfigBatchItem `json:"items"` // In request order, without the result of each write
+}
+
+// configOperationKey carries the batch or import operation whose config changes are being written
+type configOperationKey struct{}
+
+// configOperationLog keeps the most recent batch and import operations in memory, by operation ID
+type configOperationLog struct {
+	mu    sync.Mutex
+	limit int
+	byID  map[string]*ConfigOperation
+	order []string // IDs, oldest first
+}
+
+// newConfigOperationLog returns a log keeping up to limit operations
+func newConfigOperationLog(limit int) *configOperationLog {
+	return &configOperationLog{limit: limit, byID: make(map[string]*ConfigOperation)}
+}
+
+// add keeps a finished operation, forgetting the oldest once the log is full
+func (l *configOperationLog) add(op *ConfigOperation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.byID[op.OperationID]; !ok {
+		l.order = append(l.order, op.OperationID)
+	}
+	l.byID[op.OperationID] = op
+	for len(l.order) > l.limit {
+		delete(l.byID, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+// get returns the operation with the ID, if it is still kept
+func (l *configOperationLog) get(id string) (*ConfigOperation, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	op, ok := l.byID[id]
+	return op, ok
+}
+
+// withConfigOperation returns a context under which the writes of a batch or import operation on tableName
+// are attributed to a new operation ID
+func withConfigOperation(ctx context.Context, operation, tableName string) context.Context {
+	return context.WithValue(ctx, configOperationKey{}, &ConfigOperation{
+		OperationID: requestid.New(),
+		Operation:   operation,
+		Table:       tableName,
+		StartedAt:   time.Now().UTC(),
+	})
+}
+
+// operationID returns the ID of the batch or import operation of ctx, or "" outside of one
+func operationID(ctx context.Context) string {
+	if op, ok := ctx.Value(configOperationKey{}).(*ConfigOperation); ok {
+		return op.OperationID
+	}
+	return ""
+}
+
+// finishConfigOperation keeps the outcome of each item of the operation of ctx for get_operation. Nothing is
+// kept outside of an operation.
+func (a *API) finishConfigOperation(ctx context.Context, items []ConfigBatchItem) {
+	started, ok := ctx.Value(configOperationKey{}).(*ConfigOperation)
+	if !ok {
+		return
+	}
+	op := *started
+	op.FinishedAt = time.Now().UTC()
+	op.Items = make([]ConfigBatchItem, len(items))
+	for i, item := range items {
+		item.Result = nil
+		op.Items[i] = item
+	}
+	a.configOperations.add(&op)
+}
+
+// getConfigOperation returns the keys and outcomes of an operation on tableName. Operations are kept in the
+// memory of the server that ran them, so an unknown ID, or one of another table, is not found.
+func (a *API) getConfigOperation(tableName, id string) (*ConfigOperation, error) {
+	op, ok := a.configOperations.get(id)
+	if !ok || op.Table != tableName {
+		return nil, &apiError{
+			Status:  http.StatusNotFound,
+			Code:    ErrorCodeNotFound,
+			Message: fmt.Sprintf("operation %s not found; operations are kept for the last %d batches and imports of this server", id, a.configOperations.limit),
+			Details: map[string]interface{}{"operation_id": id},
+		}
+	}
+	return op, nil
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigOperationLog(t *testing.T) {
+	log := newConfigOperationLog(2)
+	for _, id := range []string{"op-1", "op-2", "op-3"} {
+		log.add(&ConfigOperation{OperationID: id})
+	}
+	// The oldest operation is forgotten first
+	_, ok := log.get("op-1")
+	assert.False(t, ok)
+	op, ok := log.get("op-3")
+	require.True(t, ok)
+	assert.Equal(t, "op-3", op.OperationID)
+}
+
+func TestGetOperation(t *testing.T) {
+	api, published := newEventsAPI(t)
+	conn := connectortest.NewFake()
+	conn.Insert("allconfig", map[string]interface{}{"config_key": "a", "config_value": "old-a", "status": "approved"})
+	conn.Insert("allconfig", map[string]interface{}{"config_key": "c", "config_value": "old-c", "status": "approved"})
+
+	run := func(req AllConfigOperationRequest) (interface{}, error) {
+		req.TableName = "allconfig"
+		return api.executeAllConfigOperation(context.Background(), conn, &req)
+	}
+	result, err := run(AllConfigOperationRequest{Operation: "direct_update_batch", ConfigItems: []ConfigItem{
+		{Key: "a", Value: "new-a"},
+		{Key: "b", Value: "new-b"},
+		{Key: "c", Value: "new-c"},
+	}})
+	require.NoError(t, err)
+	batch := result.(*ConfigBatchResult)
+	require.NotEmpty(t, batch.OperationID)
+
+	// Every change of the batch carries its ID
+	announced := published()
+	require.Len(t, announced, 2)
+	for _, event := range announced {
+		assert.Equal(t, batch.OperationID, event.OperationID, event.Key)
+	}
+
+	found, err := run(AllConfigOperationRequest{Operation: "get_operation", OperationID: batch.OperationID})
+	require.NoError(t, err)
+	op := found.(*ConfigOperation)
+	assert.Equal(t, batch.OperationID, op.OperationID)
+	assert.Equal(t, "direct_update_batch", op.Operation)
+	assert.Equal(t, "allconfig", op.Table)
+	assert.False(t, op.FinishedAt.Before(op.StartedAt))
+	require.Len(t, op.Items, 3)
+	for i, key := range []string{"a", "b", "c"} {
+		assert.Equal(t, key, op.Items[i].Key)
+		assert.Nil(t, op.Items[i].Result)
+	}
+	assert.Equal(t, ConfigItemSucceeded, op.Items[0].Status)
+	assert.Equal(t, ConfigItemFailed, op.Items[1].Status)
+	assert.Equal(t, ErrorCodeNotFound, op.Items[1].ErrorCode)
+	assert.Equal(t, ConfigItemSucceeded, op.Items[2].Status)
+
+	// Operations are only found on their own table
+	_, err = api.executeAllConfigOperation(context.Background(), conn, &AllConfigOperationRequest{
+		AllConfigRequest: AllConfigRequest{TableName: "other"},
+		Operation:        "get_operation",
+		OperationID:      batch.OperationID,
+	})
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeNotFound, apiErr.Code)
+	_, err = run(AllConfigOperationRequest{Operation: "get_operation", OperationID: "unknown"})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, map[string]interface{}{"operation_id": "unknown"}, apiErr.Details)
+	_, err = run(AllConfigOperationRequest{Operation: "get_operation"})
+	assert.EqualError(t, err, "operation_id is required for get_operation operation")
+
+	// A dry run writes nothing, so it has no operation
+	result, err = run(AllConfigOperationRequest{Operation: "direct_delete_batch", ConfigItems: []ConfigItem{{Key: "a"}}, DryRun: true})
+	require.NoError(t, err)
+	assert.Empty(t, result.(*AllConfigDryRun).Result.(*ConfigBatchResult).OperationID)
+}
+
+func TestImportConfigsOperation(t *testing.T) {
+	api := NewAPI()
+	inserter := newFakeInserter("mysql", "taken").describe(t, configImportColumns...)
+	items := []ConfigItem{{Key: "taken"}, {Key: "feature.a"}, {Key: "feature.b"}}
+
+	ctx := withConfigOperation(context.Background(), "import", "allconfig")
+	result, err := api.importConfigs(ctx, inserter, "", "allconfig", items, 2)
+	require.NoError(t, err)
+	imported := result.(*ImportResult)
+	assert.Equal(t, operationID(ctx), imported.OperationID)
+
+	// The keys of a failed chunk fail together
+	op, ok := api.configOperations.get(imported.OperationID)
+	require.True(t, ok)
+	assert.Equal(t, []ConfigBatchItem{
+		{Index: 0, Key: "taken", Status: ConfigItemFailed, Error: "duplicate key taken"},
+		{Index: 1, Key: "feature.a", Status: ConfigItemFailed, Error: "duplicate key taken"},
+		{Index: 2, Key: "feature.b", Status: ConfigItemSucceeded},
+	}, op.Items)
+}
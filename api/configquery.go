@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// Columns returned by the list operations: the approved ones, and the admin ones which also show who wrote
+// each config and whether it is approved
+const (
+	configListColumns         = "config_key, %s, description, tags, created_at, updated_at"
+	approvedConfigListColumns = configListColumns + ", maker_id, checker_id, approved_at, expires_at"
+	adminConfigListColumns    = configListColumns + ", status, maker_id, checker_id, approved_at, approval_comment, expires_at"
+	legacyConfigListColumns   = "config_key, %s, description, created_at, updated_at"
+)
+
+// configStatuses are the statuses a config may have
+var configStatuses = []string{"approved", "pending", "rejected"}
+
+// statusFilterOperations are the admin operations taking a status filter
+var statusFilterOperations = []string{"read_all_admin", "search_admin", "count_admin"}
+
+// configQuery selects the configs of the search, filter and count operations. The list and count of a
+// query always select the same configs, as both build their WHERE clause or filter from it.
+type configQuery struct {
+	ApprovedOnly bool                   // Only configs with status approved that have not expired
+	Legacy       bool                   // Lists only the columns of legacy tables
+	Status       string                 // Only configs with this status, for the admin operations
+	SearchTerm   string                 // Case-insensitive substring of the key, value or description
+	Filter       map[string]interface{} // Column values configs must equal
+	Tags         TagMatch
+}
+
+// configQueryOf returns the query of a search, filter or count request
+func configQueryOf(req *AllConfigOperationRequest, approvedOnly bool) configQuery {
+	q := configQuery{ApprovedOnly: approvedOnly, SearchTerm: req.SearchTerm, Filter: req.Filter, Tags: tagMatchOf(req)}
+	if !approvedOnly {
+		q.Status = req.Status
+	}
+	return q
+}
+
+// checkStatusFilter rejects a status filter on an operation not taking one, or naming an unknown status
+func checkStatusFilter(req *AllConfigOperationRequest) error {
+	if req.Status == "" {
+		return nil
+	}
+	invalid := func(message string) error {
+		return &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: message,
+			Details: map[string]interface{}{"operation": req.Operation, "status": req.Status},
+		}
+	}
+	if !slices.Contains(statusFilterOperations, req.Operation) {
+		return invalid(fmt.Sprintf("status applies to %s only, not %s", strings.Join(statusFilterOperations, ", "), req.Operation))
+	}
+	if !slices.Contains(configStatuses, req.Status) {
+		return invalid(fmt.Sprintf("status must be one of %s, got %q", strings.Join(configStatuses, ", "), req.Status))
+	}
+	return nil
+}
+
+// sqlWhere returns the WHERE clause selecting the configs of the query with its args, or an empty clause
+// when it selects every config. Filter columns are quoted, and matched in name order so the clause is stable.
+func (q configQuery) sqlWhere(dbType string) (string, []interface{}) {
+	d, _ := connectors.DialectFor(dbType)
+	var conditions []string
+	var args []interface{}
+	bind := func(value interface{}) string {
+		args = append(args, value)
+		return d.Placeholder(len(args))
+	}
+
+	if q.ApprovedOnly {
+		conditions = append(conditions, "status = 'approved'", sqlUnexpired(d, "expires_at"))
+	}
+	if q.Status != "" {
+		conditions = append(conditions, "status = "+bind(q.Status))
+	}
+	if q.SearchTerm != "" {
+		like := "LIKE"
+		if dbType == "postgresql" {
+			like = "ILIKE"
+		}
+		pattern := "%" + q.SearchTerm + "%"
+		conditions = append(conditions, fmt.Sprintf("(config_key %[1]s %[2]s OR config_value %[1]s %[3]s OR description %[1]s %[4]s)",
+			like, bind(pattern), bind(pattern), bind(pattern)))
+	}
+	for _, column := range sortedConfigKeys(q.Filter) {
+		conditions = append(conditions, fmt.Sprintf("%s = %s", d.QuoteIdent(column), bind(q.Filter[column])))
+	}
+	if !q.Tags.empty() {
+		condition, tagArgs := sqlTagCondition(dbType, q.Tags, len(args)+1)
+		conditions = append(conditions, condition)
+		args = append(args, tagArgs...)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// mongoFilter returns the MongoDB filter selecting the configs of the query, with those expired by now
+// left out of an approved-only query
+func (q configQuery) mongoFilter(now time.Time) map[string]interface{} {
+	filter := map[string]interface{}{}
+	for k, v := range q.Filter {
+		filter[k] = v
+	}
+	if q.Status != "" {
+		filter["status"] = q.Status
+	}
+	if q.ApprovedOnly {
+		filter["status"] = "approved"
+		filter["expires_at"] = mongoUnexpired(now)
+	}
+	if q.SearchTerm != "" {
+		filter["$or"] = []map[string]interface{}{
+			{"config_key": map[string]interface{}{"$regex": q.SearchTerm, "$options": "i"}},
+			{"config_value": map[string]interface{}{"$regex": q.SearchTerm, "$options": "i"}},
+			{"description": map[string]interface{}{"$regex": q.SearchTerm, "$options": "i"}},
+		}
+	}
+	if !q.Tags.empty() {
+		filter["tags"] = mongoTagFilter(q.Tags)
+	}
+	return filter
+}
+
+// findConfigs lists the configs selected by the query in key order, with the admin, approved or legacy columns
+func (a *API) findConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, q configQuery, limit, offset int) (interface{}, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		columns := adminConfigListColumns
+		if q.ApprovedOnly {
+			columns = approvedConfigListColumns
+		} else if q.Legacy {
+			columns = legacyConfigListColumns
+		}
+		where, args := q.sqlWhere(connector.GetType())
+		query := fmt.Sprintf("SELECT "+columns+" FROM %s", a.listedValue("config_value"), sqlTable(ctx, tableName))
+		if where != "" {
+			query += " " + where
+		}
+		query = pageQuery(sqlDialect(connector), query+" ORDER BY config_key", limit, offset)
+
+		rows, err := connector.Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		return a.markLargeValues(a.configRows(rows))
+
+	case "mongodb":
+		params := map[string]interface{}{
+			"collection": tableName,
+			"filter":     q.mongoFilter(a.now()),
+			"sort":       map[string]interface{}{"config_key": 1},
+		}
+		if limit > 0 {
+			params["limit"] = limit
+		}
+		if offset > 0 {
+			params["skip"] = offset
+		}
+		return a.markLargeValues(connector.Execute(ctx, "find", params))
+
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+}
+
+// countMatchingConfigs counts the configs selected by the query without reading them
+func (a *API) countMatchingConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, q configQuery) (int64, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		where, args := q.sqlWhere(connector.GetType())
+		query := "SELECT COUNT(*) FROM " + sqlTable(ctx, tableName)
+		if where != "" {
+			query += " " + where
+		}
+		rows, err := connector.Query(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+
+		var count int64
+		if rows.Next() {
+			if err := rows.Scan(&count); err != nil {
+				return 0, err
+			}
+		}
+		return count, rows.Err()
+
+	case "mongodb":
+		result, err := connector.Execute(ctx, "count", map[string]interface{}{
+			"collection": tableName,
+			"filter":     q.mongoFilter(a.now()),
+		})
+		if err != nil {
+			return 0, err
+		}
+		switch count := result.(type) {
+		case int64:
+			return count, nil
+		case int:
+			return int64(count), nil
+		}
+		return 0, fmt.Errorf("unexpected count result: %T", result)
+
+	default:
+		return 0, fmt.Errorf("unsupported database type")
+	}
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// selectionConnector answers list and count queries with as many configs as the selection they were given
+// implies, so that a list and a count agree only when they select configs the same way
+type selectionConnector struct {
+	connectortest.MockDBConnector
+	t      *testing.T
+	dbType string
+}
+
+// matching returns the number of configs a WHERE clause and its args, or a MongoDB filter, stand for
+func matching(selection ...interface{}) int {
+	return len(fmt.Sprint(selection...)) % 11
+}
+
+func (c *selectionConnector) GetType() string { return c.dbType }
+
+func (c *selectionConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	where := ""
+	if i := strings.Index(query, " WHERE "); i >= 0 {
+		where = strings.SplitN(query[i:], " ORDER BY ", 2)[0]
+	}
+	n := matching(where, args)
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		return newMockRows(c.t, []string{"count"}, []driver.Value{int64(n)}), nil
+	}
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = []driver.Value{fmt.Sprintf("key-%d", i)}
+	}
+	return newMockRows(c.t, []string{"config_key"}, rows...), nil
+}
+
+func (c *selectionConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	n := matching(params["filter"])
+	if operation == "count" {
+		return int64(n), nil
+	}
+	docs := make([]map[string]interface{}, n)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"config_key": fmt.Sprintf("key-%d", i)}
+	}
+	return docs, nil
+}
+
+func TestConfigQuerySQLWhere(t *testing.T) {
+	q := configQuery{
+		ApprovedOnly: true,
+		SearchTerm:   "flag",
+		Filter:       map[string]interface{}{"maker_id": "alice", "checker_id": "bob"},
+		Tags:         TagMatch{All: []string{"prod"}},
+	}
+
+	where, args := q.sqlWhere("postgresql")
+	assert.Equal(t, "WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) AND (config_key ILIKE $1 OR config_value ILIKE $2 OR description ILIKE $3) "+
+		"AND \"checker_id\" = $4 AND \"maker_id\" = $5 AND tags @> $6::jsonb", where)
+	assert.Equal(t, []interface{}{"%flag%", "%flag%", "%flag%", "bob", "alice", `["prod"]`}, args)
+
+	where, _ = q.sqlWhere("mysql")
+	assert.Equal(t, "WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP()) AND (config_key LIKE ? OR config_value LIKE ? OR description LIKE ?) "+
+		"AND `checker_id` = ? AND `maker_id` = ? AND JSON_CONTAINS(tags, ?)", where)
+
+	where, args = configQuery{}.sqlWhere("mysql")
+	assert.Empty(t, where)
+	assert.Empty(t, args)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, map[string]interface{}{
+		"status":     "approved",
+		"expires_at": map[string]interface{}{"$not": map[string]interface{}{"$lte": now}},
+		"maker_id":   "alice",
+		"$or": []map[string]interface{}{
+			{"config_key": map[string]interface{}{"$regex": "flag", "$options": "i"}},
+			{"config_value": map[string]interface{}{"$regex": "flag", "$options": "i"}},
+			{"description": map[string]interface{}{"$regex": "flag", "$options": "i"}},
+		},
+	}, configQuery{ApprovedOnly: true, SearchTerm: "flag", Filter: map[string]interface{}{"maker_id": "alice"}}.mongoFilter(now))
+}
+
+func TestConfigQueryStatus(t *testing.T) {
+	q := configQuery{Status: "pending", SearchTerm: "flag"}
+	where, args := q.sqlWhere("postgresql")
+	assert.Equal(t, "WHERE status = $1 AND (config_key ILIKE $2 OR config_value ILIKE $3 OR description ILIKE $4)", where)
+	assert.Equal(t, []interface{}{"pending", "%flag%", "%flag%", "%flag%"}, args)
+
+	where, args = configQuery{Status: "rejected"}.sqlWhere("mysql")
+	assert.Equal(t, "WHERE status = ?", where)
+	assert.Equal(t, []interface{}{"rejected"}, args)
+	assert.Equal(t, map[string]interface{}{"status": "rejected"}, configQuery{Status: "rejected"}.mongoFilter(time.Now()))
+
+	// Only the admin operations filter by status; the others only ever see approved configs
+	req := &AllConfigOperationRequest{Status: "pending"}
+	assert.Equal(t, "pending", configQueryOf(req, false).Status)
+	assert.Empty(t, configQueryOf(req, true).Status)
+}
+
+func TestCheckStatusFilter(t *testing.T) {
+	for _, operation := range []string{"read_all_admin", "search_admin", "count_admin"} {
+		assert.NoError(t, checkStatusFilter(&AllConfigOperationRequest{Operation: operation, Status: "rejected"}))
+	}
+	assert.NoError(t, checkStatusFilter(&AllConfigOperationRequest{Operation: "read_all"}))
+
+	err := checkStatusFilter(&AllConfigOperationRequest{Operation: "read_all", Status: "pending"})
+	assert.EqualError(t, err, "status applies to read_all_admin, search_admin, count_admin only, not read_all")
+	err = checkStatusFilter(&AllConfigOperationRequest{Operation: "read_all_admin", Status: "draft"})
+	assert.EqualError(t, err, `status must be one of approved, pending, rejected, got "draft"`)
+
+	_, err = checkAllConfigOperation(&AllConfigOperationRequest{Operation: "search", SearchTerm: "x", Status: "pending"}, "mysql")
+	assert.Error(t, err)
+}
+
+func TestAdminListsIncludeAuditColumns(t *testing.T) {
+	api := NewAPI()
+	requests := map[string]struct {
+		req     AllConfigOperationRequest
+		columns string
+		args    []interface{}
+	}{
+		"read_all_admin": {
+			req:     AllConfigOperationRequest{Operation: "read_all_admin", Status: "pending"},
+			columns: ", status, maker_id, checker_id, approved_at, approval_comment, expires_at FROM allconfig WHERE status = ? ORDER BY",
+			args:    []interface{}{"pending"},
+		},
+		"search_admin": {
+			req:     AllConfigOperationRequest{Operation: "search_admin", SearchTerm: "flag"},
+			columns: ", status, maker_id, checker_id, approved_at, approval_comment, expires_at FROM allconfig WHERE (",
+			args:    []interface{}{"%flag%", "%flag%", "%flag%"},
+		},
+		"search": {
+			req:     AllConfigOperationRequest{Operation: "search", SearchTerm: "flag"},
+			columns: ", updated_at, maker_id, checker_id, approved_at, expires_at FROM allconfig WHERE status = 'approved'",
+			args:    []interface{}{"%flag%", "%flag%", "%flag%"},
+		},
+	}
+	for name, tc := range requests {
+		t.Run(name, func(t *testing.T) {
+			m := new(connectortest.MockDBConnector)
+			m.On("GetType").Return("mysql")
+			m.On("Query", mock.Anything, mock.MatchedBy(func(query string) bool {
+				return strings.Contains(query, tc.columns)
+			}), tc.args).Return(newMockRows(t,
+				[]string{"config_key", "config_value", "status", "maker_id", "checker_id", "approved_at", "approval_comment"},
+				[]driver.Value{"feature.flag", "on", "pending", "bob", nil, nil, nil},
+			), nil)
+
+			req := tc.req
+			req.TableName = "allconfig"
+			req.LegacyMode = boolPtr(false)
+			result, err := api.executeAllConfigOperation(context.Background(), m, &req)
+			require.NoError(t, err)
+			rows := result.([]map[string]interface{})
+			require.Len(t, rows, 1)
+			assert.Equal(t, "pending", rows[0]["status"])
+			assert.Equal(t, "bob", rows[0]["maker_id"])
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+// Filter values bind to sequential placeholders from the first, after those of the search term when there is one
+func TestConfigQueryFilterPlaceholders(t *testing.T) {
+	filters := []map[string]interface{}{
+		{"maker_id": "alice"},
+		{"maker_id": "alice", "checker_id": "bob"},
+		{"maker_id": "alice", "checker_id": "bob", "config_value": "on"},
+	}
+	want := map[string][]string{
+		"mysql": {
+			"WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP()) AND `maker_id` = ?",
+			"WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP()) AND `checker_id` = ? AND `maker_id` = ?",
+			"WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP()) AND `checker_id` = ? AND `config_value` = ? AND `maker_id` = ?",
+		},
+		"postgresql": {
+			`WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) AND "maker_id" = $1`,
+			`WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) AND "checker_id" = $1 AND "maker_id" = $2`,
+			`WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) AND "checker_id" = $1 AND "config_value" = $2 AND "maker_id" = $3`,
+		},
+	}
+	wantArgs := [][]interface{}{
+		{"alice"},
+		{"bob", "alice"},
+		{"bob", "on", "alice"},
+	}
+
+	for dbType, clauses := range want {
+		for i, filter := range filters {
+			where, args := configQuery{ApprovedOnly: true, Filter: filter}.sqlWhere(dbType)
+			assert.Equal(t, clauses[i], where, "%s with %d filters", dbType, i+1)
+			assert.Equal(t, wantArgs[i], args, "%s with %d filters", dbType, i+1)
+		}
+	}
+
+	where, args := configQuery{SearchTerm: "x", Filter: filters[1]}.sqlWhere("postgresql")
+	assert.True(t, strings.HasSuffix(where, `AND "checker_id" = $4 AND "maker_id" = $5`), where)
+	assert.Equal(t, []interface{}{"%x%", "%x%", "%x%", "bob", "alice"}, args)
+}
+
+func TestCountMatchesList(t *testing.T) {
+	requests := []struct {
+		list  AllConfigOperationRequest
+		count AllConfigOperationRequest
+	}{
+		{
+			list:  AllConfigOperationRequest{Operation: "search", SearchTerm: "flag"},
+			count: AllConfigOperationRequest{Operation: "count", SearchTerm: "flag"},
+		},
+		{
+			list:  AllConfigOperationRequest{Operation: "filter", Filter: map[string]interface{}{"maker_id": "alice", "checker_id": "bob"}},
+			count: AllConfigOperationRequest{Operation: "count", Filter: map[string]interface{}{"maker_id": "alice", "checker_id": "bob"}},
+		},
+		{
+			list:  AllConfigOperationRequest{Operation: "filter", TagsAny: []string{"pii", "prod"}, TagsAll: []string{"team:payments"}},
+			count: AllConfigOperationRequest{Operation: "count", TagsAny: []string{"pii", "prod"}, TagsAll: []string{"team:payments"}},
+		},
+		{
+			list:  AllConfigOperationRequest{Operation: "search_admin", SearchTerm: "limit"},
+			count: AllConfigOperationRequest{Operation: "count_admin", SearchTerm: "limit"},
+		},
+		{
+			list:  AllConfigOperationRequest{Operation: "read_all_admin"},
+			count: AllConfigOperationRequest{Operation: "count_admin"},
+		},
+		{
+			list:  AllConfigOperationRequest{Operation: "read_all_admin", Status: "pending"},
+			count: AllConfigOperationRequest{Operation: "count_admin", Status: "pending"},
+		},
+		{
+			list:  AllConfigOperationRequest{Operation: "search_admin", SearchTerm: "limit", Status: "rejected"},
+			count: AllConfigOperationRequest{Operation: "count_admin", SearchTerm: "limit", Status: "rejected"},
+		},
+	}
+
+	api := stopClock(NewAPI())
+	for _, dbType := range []string{"mysql", "postgresql", "mongodb"} {
+		for _, r := range requests {
+			t.Run(dbType+" "+r.count.Operation+" "+r.list.Operation, func(t *testing.T) {
+				ctx := context.Background()
+				conn := &selectionConnector{t: t, dbType: dbType}
+				list, count := r.list, r.count
+				list.TableName, count.TableName = "allconfig", "allconfig"
+				list.LegacyMode, count.LegacyMode = boolPtr(false), boolPtr(false)
+
+				listed, err := api.executeAllConfigOperation(ctx, conn, &list)
+				require.NoError(t, err)
+				counted, err := api.executeAllConfigOperation(ctx, conn, &count)
+				require.NoError(t, err)
+				assert.EqualValues(t, len(listed.([]map[string]interface{})), counted)
+			})
+		}
+	}
+
+	t.Run("counts differ from lists of other selections", func(t *testing.T) {
+		conn := &selectionConnector{t: t, dbType: "mysql"}
+		all, err := api.countMatchingConfigs(context.Background(), conn, "allconfig", configQuery{})
+		require.NoError(t, err)
+		approved, err := api.countMatchingConfigs(context.Background(), conn, "allconfig", configQuery{ApprovedOnly: true})
+		require.NoError(t, err)
+		assert.NotEqual(t, all, approved)
+	})
+}
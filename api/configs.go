@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-connectors/allconfig"
+)
+
+// Headers identifying the caller of the RESTful config endpoints
+const (
+	UserIDHeader   = "X-User-ID"
+	UserRoleHeader = "X-User-Role"
+)
+
+// AdminRole is the X-User-Role whose config changes bypass maker-checker approval
+const AdminRole = "admin"
+
+// ConfigWriteRequest is the body of PUT and DELETE /v1/configs/{key}
+type ConfigWriteRequest struct {
+	Value       interface{} `json:"value,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`     // Left as they are on update when absent
+	MakerID     string      `json:"maker_id,omitempty"` // Used when the X-User-ID header is absent
+}
+
+// ApprovalDecisionRequest is the body of POST /v1/approvals/{id}/approve and /reject
+type ApprovalDecisionRequest struct {
+	CheckerID string `json:"checker_id,omitempty"` // Used when the X-User-ID header is absent
+	Comment   string `json:"comment,omitempty"`
+}
+
+// withProfile resolves the request's tenant and connection profile and connects the profile, then calls fn
+// with the tenant and the server's allconfig schema in its context. Requests reaching beyond their tenant are 403s, other failures to resolve the profile are 400s and failures to connect are 503s, with the error
+// code of the failure since the profile's settings are the server's rather than the caller's.
+func (a *API) withProfile(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context, p *profile)) {
+	tenant, err := a.resolveTenant(r)
+	if err != nil {
+		a.sendRequestError(w, err)
+		return
+	}
+	p, err := a.tenantProfile(r, tenant)
+	if err != nil {
+		a.sendRequestError(w, err)
+		return
+	}
+	a.onProfile(w, r, p, func(ctx context.Context, p *profile) {
+		fn(withConfigSchema(withTenant(ctx, tenant), p.connector(), a.allConfigSchema), p)
+	})
+}
+
+// onProfile takes a slot on a profile and connects it through its circuit breaker, then calls fn, sending a
+// 503 when no slot frees up in time, the breaker is open or the profile cannot connect
+func (a *API) onProfile(w http.ResponseWriter, r *http.Request, p *profile, fn func(ctx context.Context, p *profile)) {
+	release, ok := a.acquireSlot(w, r, p.Name)
+	if !ok {
+		return
+	}
+	defer release()
+
+	conn := startPhase(r.Context(), phaseConnect, a.phaseTimeouts.Connect)
+	defer conn.cancel()
+
+	err := a.guardConnect(p.Name, func() error {
+		return conn.err(p.connect(conn.ctx))
+	})
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		a.sendDatabaseError(w, fmt.Sprintf("Connection to profile %s rejected", p.Name), err)
+		return
+	}
+	if err != nil {
+		_, code := classifyDatabaseError(err)
+		a.sendJSON(w, http.StatusServiceUnavailable, DatabaseResponse{
+			Success:   false,
+			Error:     connectionFailureMessage(fmt.Sprintf("Connection to profile %s failed", p.Name), err),
+			ErrorCode: code,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	op := startPhase(r.Context(), phaseOperation, a.phaseTimeouts.Operation)
+	defer op.cancel()
+	fn(op.ctx, p)
+}
+
+// ListConfigsHandler lists approved configs, optionally filtered by ?search= and paginated by ?limit= and ?offset=
+func (a *API) ListConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+	search := r.URL.Query().Get("search")
+
+	a.withProfile(w, r, func(ctx context.Context, p *profile) {
+		service, table := a.ConfigService(), a.configTable(ctx, p)
+		var result interface{}
+		var err error
+		if search != "" {
+			result, err = service.Search(ctx, p.connector(), allconfig.SearchRequest{Table: table, Term: search, Limit: limit, Offset: offset})
+		} else {
+			result, err = service.ReadAll(ctx, p.connector(), allconfig.ListRequest{Table: table, Limit: limit, Offset: offset})
+		}
+		if err != nil {
+			a.sendError(w, http.StatusInternalServerError, ErrorCodeDBError, fmt.Sprintf("Failed to list configs: %v", err))
+			return
+		}
+		a.sendSuccess(w, a.masker(r, p.Name).configs(result), "Configs retrieved")
+	})
+}
+
+// GetConfigHandler returns the approved config stored under the path key
+func (a *API) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	a.withProfile(w, r, func(ctx context.Context, p *profile) {
+		config, err := a.ConfigService().Get(ctx, p.connector(), allconfig.ReadRequest{Table: a.configTable(ctx, p), Key: key})
+		if err != nil {
+			a.sendConfigError(w, "Failed to read config", err)
+			return
+		}
+		a.sendSuccess(w, a.masker(r, p.Name).configs(config), "Config retrieved")
+	})
+}
+
+// PutConfigHandler creates or updates the config under the path key. Admins write directly;
+// everyone else submits the change for maker-checker approval and gets 202 Accepted.
+func (a *API) PutConfigHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	var req ConfigWriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	makerID := actorID(r, req.MakerID)
+	if makerID == "" {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("A user ID is required; set the %s header or maker_id", UserIDHeader))
+		return
+	}
+
+	a.withProfile(w, r, func(ctx context.Context, p *profile) {
+		service := a.ConfigService().ForConnection(p.Name)
+		write := allconfig.SetRequest{Table: a.configTable(ctx, p), Key: key, Value: req.Value, Description: req.Description, Tags: req.Tags, MakerID: makerID}
+		if !isAdmin(r) {
+			submitted, err := service.SubmitSet(ctx, p.connector(), write)
+			if err != nil {
+				a.sendConfigError(w, "Failed to submit config", err)
+				return
+			}
+			a.sendJSON(w, http.StatusAccepted, DatabaseResponse{
+				Success:   true,
+				Message:   fmt.Sprintf("Config %s submitted for approval", submitted.Operation),
+				Data:      submitted,
+				Timestamp: time.Now(),
+			})
+			return
+		}
+
+		result, created, err := service.DirectSet(ctx, p.connector(), write)
+		if err != nil {
+			a.sendConfigError(w, "Failed to write config", err)
+			return
+		}
+		status, message := http.StatusOK, "Config updated"
+		if created {
+			status, message = http.StatusCreated, "Config created"
+		}
+		a.sendJSON(w, status, DatabaseResponse{
+			Success:   true,
+			Message:   message,
+			Data:      result,
+			Timestamp: time.Now(),
+		})
+	})
+}
+
+// DeleteConfigHandler deletes the config under the path key, directly for admins and
+// through maker-checker approval for everyone else
+func (a *API) DeleteConfigHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	var req ConfigWriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	makerID := actorID(r, req.MakerID)
+	if makerID == "" {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("A user ID is required; set the %s header or maker_id", UserIDHeader))
+		return
+	}
+
+	a.withProfile(w, r, func(ctx context.Context, p *profile) {
+		service := a.ConfigService().ForConnection(p.Name)
+		remove := allconfig.DeleteRequest{Table: a.configTable(ctx, p), Key: key, Description: req.Description, MakerID: makerID}
+		if !isAdmin(r) {
+			result, err := service.SubmitDelete(ctx, p.connector(), remove)
+			if err != nil {
+				a.sendConfigError(w, "Failed to submit config", err)
+				return
+			}
+			a.sendJSON(w, http.StatusAccepted, DatabaseResponse{
+				Success:   true,
+				Message:   "Config delete submitted for approval",
+				Data:      result,
+				Timestamp: time.Now(),
+			})
+			return
+		}
+
+		result, err := service.DirectDelete(ctx, p.connector(), remove)
+		if err != nil {
+			a.sendConfigError(w, "Failed to delete config", err)
+			return
+		}
+		a.sendSuccess(w, result, "Config deleted")
+	})
+}
+
+// ListApprovalsHandler lists pending approval requests, paginated by ?limit= and ?offset=
+func (a *API) ListApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+
+	a.withProfile(w, r, func(ctx context.Context, p *profile) {
+		result, err := a.ConfigService().Pending(ctx, p.connector(), allconfig.ListRequest{Table: a.configTable(ctx, p), Limit: limit, Offset: offset})
+		if err != nil {
+			a.sendError(w, http.StatusInternalServerError, ErrorCodeDBError, fmt.Sprintf("Failed to list approvals: %v", err))
+			return
+		}
+		a.sendSuccess(w, a.masker(r, p.Name).configs(result), "Pending approvals retrieved")
+	})
+}
+
+// ApproveHandler approves the pending approval request with the path id and applies its change
+func (a *API) ApproveHandler(w http.ResponseWriter, r *http.Request) {
+	a.decideApproval(w, r, true)
+}
+
+// RejectHandler rejects the pending approval request with the path id
+func (a *API) RejectHandler(w http.ResponseWriter, r *http.Request) {
+	a.decideApproval(w, r, false)
+}
+
+// decideApproval approves or rejects a pending request, returning 404 when it is not pending
+func (a *API) decideApproval(w http.ResponseWriter, r *http.Request, approve bool) {
+	requestID := r.PathValue("id")
+	var req ApprovalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	checkerID := actorID(r, req.CheckerID)
+	if checkerID == "" {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("A user ID is required; set the %s header or checker_id", UserIDHeader))
+		return
+	}
+
+	a.withProfile(w, r, func(ctx context.Context, p *profile) {
+		decision := allconfig.DecisionRequest{Table: a.configTable(ctx, p), RequestID: requestID, CheckerID: checkerID, Comment: req.Comment}
+		result, err := a.ConfigService().ForConnection(p.Name).Decide(ctx, p.connector(), decision, approve)
+		if err != nil {
+			a.sendConfigError(w, "Failed to record decision", err)
+			return
+		}
+		a.sendSuccess(w, result, "Request "+result.Status)
+	})
+}
+
+// sendConfigError sends 400 for invalid keys, 413 for oversized values and descriptions, 404 for
+// configs and approval requests that do not exist, 409 for configs that already exist and 500 otherwise
+func (a *API) sendConfigError(w http.ResponseWriter, prefix string, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		a.sendRequestError(w, err)
+		return
+	}
+	if status, code := classifyDatabaseError(err); status == http.StatusNotFound || status == http.StatusConflict {
+		message := err.Error()
+		a.sendError(w, status, code, strings.ToUpper(message[:1])+message[1:])
+		return
+	}
+	a.sendError(w, http.StatusInternalServerError, ErrorCodeDBError, fmt.Sprintf("%s: %v", prefix, err))
+}
+
+// pagination parses the optional limit and offset query parameters
+func pagination(r *http.Request) (limit, offset int, err error) {
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("limit must be a non-negative integer")
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// actorID returns the X-User-ID header, falling back to the ID given in the body
+func actorID(r *http.Request, fallback string) string {
+	if id := r.Header.Get(UserIDHeader); id != "" {
+		return id
+	}
+	return fallback
+}
+
+// isAdmin reports whether the caller's X-User-Role allows direct config writes
+func isAdmin(r *http.Request) bool {
+	return r.Header.Get(UserRoleHeader) == AdminRole
+}
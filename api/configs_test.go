@@ -0,0 +1,449 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newProfileConnector returns a connected mock connector of the given type
+func newProfileConnector(dbType string) *connectortest.MockDBConnector {
+	conn := new(connectortest.MockDBConnector)
+	conn.On("IsConnected").Return(true)
+	conn.On("GetType").Return(dbType)
+	return conn
+}
+
+// newConfigsHandler serves the routes with conn registered as the default "primary" profile
+func newConfigsHandler(conn *connectortest.MockDBConnector) http.Handler {
+	api := NewAPI()
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: conn, Database: "app"})
+	api.defaultProfile = "primary"
+	return SetupRoutes(api)
+}
+
+// queryContaining matches a SQL query containing fragment
+func queryContaining(fragment string) interface{} {
+	return mock.MatchedBy(func(query string) bool { return strings.Contains(query, fragment) })
+}
+
+func serveConfigs(handler http.Handler, method, target string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestResolveProfile(t *testing.T) {
+	api := NewAPI()
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: new(connectortest.MockDBConnector)})
+	api.addProfile(ConnectionProfile{Name: "reporting", Connector: new(connectortest.MockDBConnector), TableName: "settings"})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/configs", nil)
+	_, err := api.resolveProfile(req)
+	assert.Error(t, err, "several profiles and no default")
+
+	api.defaultProfile = "primary"
+	p, err := api.resolveProfile(req)
+	require.NoError(t, err)
+	assert.Equal(t, "primary", p.Name)
+	assert.Equal(t, "allconfig", api.tableName(p.TableName))
+
+	req.Header.Set(ProfileHeader, "reporting")
+	p, err = api.resolveProfile(req)
+	require.NoError(t, err)
+	assert.Equal(t, "reporting", p.Name)
+	assert.Equal(t, "settings", p.TableName)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/configs?profile=primary", nil)
+	req.Header.Set(ProfileHeader, "reporting")
+	p, err = api.resolveProfile(req)
+	require.NoError(t, err)
+	assert.Equal(t, "primary", p.Name, "query parameter wins over header")
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/configs?profile=missing", nil)
+	_, err = api.resolveProfile(req)
+	assert.EqualError(t, err, "unknown connection profile: missing")
+
+	single := NewAPI()
+	single.addProfile(ConnectionProfile{Name: "only", Connector: new(connectortest.MockDBConnector)})
+	p, err = single.resolveProfile(httptest.NewRequest(http.MethodGet, "/v1/configs", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "only", p.Name)
+}
+
+func TestConfigsProfileErrors(t *testing.T) {
+	rr := serveConfigs(SetupRoutes(NewAPI()), http.MethodGet, "/v1/configs", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	conn := newProfileConnector("mysql")
+	rr = serveConfigs(newConfigsHandler(conn), http.MethodGet, "/v1/configs?profile=missing", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"error_code":"VALIDATION_ERROR"`)
+
+	down := new(connectortest.MockDBConnector)
+	down.On("IsConnected").Return(false)
+	down.On("Connect", mock.Anything).Return(errors.New("connection refused"))
+	rr = serveConfigs(newConfigsHandler(down), http.MethodGet, "/v1/configs", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestProfileConnectsOnce(t *testing.T) {
+	conn := new(connectortest.MockDBConnector)
+	conn.On("IsConnected").Return(false).Once()
+	conn.On("Connect", mock.Anything).Return(nil).Once()
+	conn.On("IsConnected").Return(true)
+
+	p := &profile{ConnectionProfile: ConnectionProfile{Name: "primary", Connector: conn}}
+	require.NoError(t, p.connect(context.Background()))
+	require.NoError(t, p.connect(context.Background()))
+	conn.AssertNumberOfCalls(t, "Connect", 1)
+}
+
+func TestListConfigsHandler(t *testing.T) {
+	conn := newProfileConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("ORDER BY config_key LIMIT 10 OFFSET 20"), mock.Anything).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature.flag", "on"}), nil).Once()
+	conn.On("Query", mock.Anything, queryContaining("LIKE ?"), mock.Anything).
+		Return(newMockRows(t, []string{"config_key", "config_value"}), nil).Once()
+	handler := newConfigsHandler(conn)
+
+	rr := serveConfigs(handler, http.MethodGet, "/v1/configs?limit=10&offset=20", nil, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	rows := response.Data.([]interface{})
+	assert.Equal(t, "feature.flag", rows[0].(map[string]interface{})["config_key"])
+
+	rr = serveConfigs(handler, http.MethodGet, "/v1/configs?search=feature", nil, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serveConfigs(handler, http.MethodGet, "/v1/configs?limit=-1", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	conn.AssertExpectations(t)
+}
+
+func TestGetConfigHandler(t *testing.T) {
+	conn := newProfileConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("WHERE config_key = ?"), []interface{}{"feature.flag"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature.flag", "on"}), nil).Once()
+	conn.On("Query", mock.Anything, queryContaining("WHERE config_key = ?"), []interface{}{"missing"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}), nil).Once()
+	handler := newConfigsHandler(conn)
+
+	rr := serveConfigs(handler, http.MethodGet, "/v1/configs/feature.flag", nil, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "on", response.Data.(map[string]interface{})["config_value"])
+
+	rr = serveConfigs(handler, http.MethodGet, "/v1/configs/missing", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"error_code":"NOT_FOUND"`)
+	assert.Contains(t, rr.Body.String(), "Config not found: missing")
+}
+
+func TestGetConfigHandlerMongoNotFound(t *testing.T) {
+	conn := newProfileConnector("mongodb")
+	conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(nil, connectors.ErrNotFound)
+
+	rr := serveConfigs(newConfigsHandler(conn), http.MethodGet, "/v1/configs/missing", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestPutConfigHandler(t *testing.T) {
+	existsRows := func(count int) interface{} {
+		return newMockRows(t, []string{"COUNT(*)"}, []driver.Value{count})
+	}
+	admin := map[string]string{UserIDHeader: "alice", UserRoleHeader: AdminRole}
+	body := ConfigWriteRequest{Value: "on", Description: "Feature flag"}
+
+	t.Run("admin creates", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(0), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+			return strings.HasPrefix(params["query"].(string), "INSERT INTO allconfig ")
+		})).Return(map[string]interface{}{"rows_affected": 1}, nil)
+		expectConfigTimestamps(t, conn, 1)
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodPut, "/v1/configs/feature.flag", body, admin)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("admin updates", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(1), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+			return strings.HasPrefix(params["query"].(string), "UPDATE allconfig ")
+		})).Return(map[string]interface{}{"rows_affected": 1}, nil)
+		expectConfigTimestamps(t, conn, 1)
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodPut, "/v1/configs/feature.flag", body, admin)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("maker submits for approval", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(1), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+			args := params["args"].([]interface{})
+			return strings.Contains(params["query"].(string), "allconfig_approval_requests") && args[4] == "update" && args[5] == "bob"
+		})).Return(map[string]interface{}{"rows_affected": 1}, nil)
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodPut, "/v1/configs/feature.flag", body, map[string]string{UserIDHeader: "bob"})
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		var response DatabaseResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, "submitted_for_approval", response.Data.(map[string]interface{})["status"])
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("requires a user", func(t *testing.T) {
+		rr := serveConfigs(newConfigsHandler(newProfileConnector("mysql")), http.MethodPut, "/v1/configs/feature.flag", body, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"error_code":"VALIDATION_ERROR"`)
+	})
+
+	t.Run("maker_id in the body", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(0), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(map[string]interface{}{"rows_affected": 1}, nil)
+
+		withMaker := body
+		withMaker.MakerID = "carol"
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodPut, "/v1/configs/feature.flag", withMaker, nil)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+	})
+}
+
+func TestDeleteConfigHandler(t *testing.T) {
+	existsRows := func(count int) interface{} {
+		return newMockRows(t, []string{"COUNT(*)"}, []driver.Value{count})
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(0), nil)
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodDelete, "/v1/configs/missing", nil, map[string]string{UserIDHeader: "alice", UserRoleHeader: AdminRole})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		conn.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin deletes", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(1), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+			return strings.HasPrefix(params["query"].(string), "DELETE FROM allconfig ")
+		})).Return(map[string]interface{}{"rows_affected": 1}, nil)
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodDelete, "/v1/configs/feature.flag", nil, map[string]string{UserIDHeader: "alice", UserRoleHeader: AdminRole})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("maker submits for approval", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(1), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+			return params["args"].([]interface{})[4] == "delete"
+		})).Return(map[string]interface{}{"rows_affected": 1}, nil)
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodDelete, "/v1/configs/feature.flag", nil, map[string]string{UserIDHeader: "bob"})
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		conn.AssertExpectations(t)
+	})
+}
+
+func TestConfigKeyWithSlash(t *testing.T) {
+	conn := connectortest.NewFake()
+	conn.Insert("allconfig", map[string]interface{}{"config_key": "team/feature.flag", "config_value": "on", "status": "approved"})
+	api := NewAPI()
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: conn})
+	handler := SetupRoutes(api)
+	admin := map[string]string{UserIDHeader: "alice", UserRoleHeader: AdminRole}
+
+	// A key holding a slash is sent escaped and reaches the config routes as one segment
+	rr := serveConfigs(handler, http.MethodGet, "/v1/configs/team%2Ffeature.flag", nil, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "team/feature.flag", response.Data.(map[string]interface{})["config_key"])
+
+	rr = serveConfigs(handler, http.MethodPut, "/v1/configs/team%2Ffeature.flag", ConfigWriteRequest{Value: "off"}, admin)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	docs := conn.Documents("allconfig")
+	require.Len(t, docs, 1)
+	assert.Equal(t, "off", docs[0]["config_value"])
+
+	rr = serveConfigs(handler, http.MethodDelete, "/v1/configs/team%2Ffeature.flag", nil, admin)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Empty(t, conn.Documents("allconfig"))
+
+	// Unescaped, the slash separates segments
+	rr = serveConfigs(handler, http.MethodGet, "/v1/configs/team/feature.flag", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestListApprovalsHandler(t *testing.T) {
+	conn := newProfileConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("WHERE status = 'pending'"), mock.Anything).
+		Return(newMockRows(t, []string{"request_id", "config_key"}, []driver.Value{"req-1", "feature.flag"}), nil)
+
+	rr := serveConfigs(newConfigsHandler(conn), http.MethodGet, "/v1/approvals?limit=5", nil, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response.Data.([]interface{}), 1)
+}
+
+func TestApprovalDecisionHandlers(t *testing.T) {
+	pending := map[string]interface{}{
+		"request_id":   "req-1",
+		"config_key":   "feature.flag",
+		"config_value": "on",
+		"description":  "Feature flag",
+		"operation":    "create",
+		"maker_id":     "bob",
+	}
+	checker := map[string]string{UserIDHeader: "alice"}
+
+	t.Run("approve", func(t *testing.T) {
+		conn := newProfileConnector("mongodb")
+		conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(pending, nil)
+		conn.On("Execute", mock.Anything, "insert", mock.Anything).Return(map[string]interface{}{"inserted_id": "1"}, nil)
+		conn.On("Execute", mock.Anything, "update", mock.Anything).Return(map[string]interface{}{"modified_count": 1}, nil)
+
+		rr := serveConfigs(newConfigsHandler(conn), http.MethodPost, "/v1/approvals/req-1/approve", ApprovalDecisionRequest{Comment: "LGTM"}, checker)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var response DatabaseResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		data := response.Data.(map[string]interface{})
+		assert.Equal(t, "approved", data["status"])
+		assert.Equal(t, "alice", data["checker_id"])
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		conn := newProfileConnector("mongodb")
+		conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(pending, nil)
+		conn.On("Execute", mock.Anything, "update", mock.Anything).Return(map[string]interface{}{"modified_count": 1}, nil)
+
+		api := NewAPI()
+		api.addProfile(ConnectionProfile{Name: "primary", Connector: conn, Database: "app"})
+		api.defaultProfile = "primary"
+		rr := serveConfigs(SetupRoutes(api), http.MethodPost, "/v1/approvals/req-1/reject", nil, checker)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"status":"rejected"`)
+
+		// Decisions count under the profile
+		assert.Equal(t, int64(1), api.AllConfigStats()["primary"]["allconfig"].Rejected)
+	})
+
+	t.Run("unknown request", func(t *testing.T) {
+		conn := newProfileConnector("mongodb")
+		conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(nil, connectors.ErrNotFound)
+
+		for _, action := range []string{"approve", "reject"} {
+			rr := serveConfigs(newConfigsHandler(conn), http.MethodPost, "/v1/approvals/missing/"+action, nil, checker)
+			assert.Equal(t, http.StatusNotFound, rr.Code, action)
+		}
+	})
+
+	t.Run("requires a checker", func(t *testing.T) {
+		rr := serveConfigs(newConfigsHandler(newProfileConnector("mongodb")), http.MethodPost, "/v1/approvals/req-1/approve", nil, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestConfiguredAllConfigTables(t *testing.T) {
+	newHandler := func(conn *connectortest.MockDBConnector) http.Handler {
+		api := NewAPI()
+		WithAllConfigTables("cfg_allconfig", "_pending")(&Server{api: api})
+		api.addProfile(ConnectionProfile{Name: "primary", Connector: conn, Database: "app"})
+		api.defaultProfile = "primary"
+		return SetupRoutes(api)
+	}
+	collection := func(name string) interface{} {
+		return mock.MatchedBy(func(params map[string]interface{}) bool { return params["collection"] == name })
+	}
+
+	t.Run("submit", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("FROM cfg_allconfig WHERE"), mock.Anything).
+			Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{0}), nil)
+		conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+			return strings.HasPrefix(params["query"].(string), "INSERT INTO cfg_allconfig_pending ")
+		})).Return(map[string]interface{}{"rows_affected": 1}, nil)
+
+		rr := serveConfigs(newHandler(conn), http.MethodPut, "/v1/configs/feature.flag", ConfigWriteRequest{Value: "on"}, map[string]string{UserIDHeader: "bob"})
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("approve", func(t *testing.T) {
+		conn := newProfileConnector("mongodb")
+		conn.On("Execute", mock.Anything, "findOne", collection("cfg_allconfig_pending")).Return(map[string]interface{}{
+			"request_id": "req-1", "config_key": "feature.flag", "config_value": "on", "description": "Feature flag", "operation": "create", "maker_id": "bob",
+		}, nil)
+		conn.On("Execute", mock.Anything, "insert", collection("cfg_allconfig")).Return(map[string]interface{}{"inserted_id": "1"}, nil)
+		conn.On("Execute", mock.Anything, "update", collection("cfg_allconfig_pending")).Return(map[string]interface{}{"modified_count": 1}, nil)
+
+		rr := serveConfigs(newHandler(conn), http.MethodPost, "/v1/approvals/req-1/approve", nil, map[string]string{UserIDHeader: "alice"})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		conn := newProfileConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("FROM cfg_allconfig WHERE config_key = ?"), mock.Anything).
+			Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature.flag", "on"}), nil)
+
+		rr := serveConfigs(newHandler(conn), http.MethodGet, "/v1/configs/feature.flag", nil, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("create table", func(t *testing.T) {
+		api := NewAPI()
+		WithAllConfigTables("", "_pending")(&Server{api: api})
+		ddl := api.getCreateTableSQL(context.Background(), "postgresql", api.tableName(""))
+		assert.Contains(t, ddl, "CREATE TABLE allconfig (")
+		assert.Contains(t, ddl, "CREATE TABLE allconfig_pending (")
+		assert.Contains(t, ddl, "ON allconfig_pending (status)")
+		assert.NotContains(t, ddl, "_approval_requests")
+	})
+}
+
+func TestConfigRoutesAreVersionedOnly(t *testing.T) {
+	rr := serveConfigs(newConfigsHandler(newProfileConnector("mysql")), http.MethodGet, "/configs", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serveConfigs(newConfigsHandler(newProfileConnector("mysql")), http.MethodPost, "/v1/configs/feature.flag", nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, PUT", rr.Header().Get("Allow"))
+}
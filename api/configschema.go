@@ -0,0 +1,416 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"db-connectors/connectors"
+)
+
+// ConfigTableHealth reports how an allconfig or approval table differs from the one create_table creates
+type ConfigTableHealth struct {
+	Table          string   `json:"table"`
+	Role           string   `json:"role"` // config or approval
+	Exists         bool     `json:"exists"`
+	MissingColumns []string `json:"missing_columns"`
+	MissingIndexes []string `json:"missing_indexes"`
+	RepairSQL      []string `json:"repair_sql,omitempty"` // Statements adding only what is missing, in order
+
+	indexes []configIndex // The missing indexes, to create on MongoDB
+}
+
+// Healthy reports whether the table exists with every expected column and index
+func (h *ConfigTableHealth) Healthy() bool {
+	return h.Exists && len(h.MissingColumns) == 0 && len(h.MissingIndexes) == 0
+}
+
+// ConfigSchemaHealth reports the drift of the allconfig table and its approval table
+type ConfigSchemaHealth struct {
+	Healthy bool                `json:"healthy"`
+	Tables  []ConfigTableHealth `json:"tables"`
+}
+
+// configColumn is a column create_table creates, with the definition adding it
+type configColumn struct {
+	Name       string
+	Definition string
+}
+
+// configIndex is an index create_table creates. An existing index on the same columns stands in for it
+// whatever its name, provided it is unique when the expected one is.
+type configIndex struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	TTL     bool   // A MongoDB index deleting each document once the date in its field has passed
+	Inline  bool   // Created by a PRIMARY KEY column along with the table
+	Create  string // Statement creating the index on its own
+}
+
+// configTableSpec is an allconfig or approval table as create_table creates it
+type configTableSpec struct {
+	Table     string
+	Qualified string // Table as the statements creating and altering it name it
+	Role      string
+	Columns   []configColumn
+	Indexes   []configIndex
+}
+
+// createTableSQL returns the CREATE TABLE of the spec without its indexes
+func (s *configTableSpec) createTableSQL() string {
+	definitions := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		definitions[i] = "    " + column.Definition
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n)", s.Qualified, strings.Join(definitions, ",\n"))
+}
+
+// withoutPrimaryKey returns the spec without its primary key column, which cannot be added to an existing
+// table keyed by another column
+func (s *configTableSpec) withoutPrimaryKey() configTableSpec {
+	stripped := *s
+	stripped.Columns = nil
+	for _, column := range s.Columns {
+		if !strings.Contains(column.Definition, "PRIMARY KEY") {
+			stripped.Columns = append(stripped.Columns, column)
+		}
+	}
+	return stripped
+}
+
+// sqlIndex returns the expected index of table on columns with its CREATE INDEX statement
+func sqlIndex(name, table string, unique bool, columns ...string) configIndex {
+	create := "CREATE INDEX "
+	if unique {
+		create = "CREATE UNIQUE INDEX "
+	}
+	return configIndex{
+		Name:    name,
+		Columns: columns,
+		Unique:  unique,
+		Create:  create + name + " ON " + table + " (" + strings.Join(columns, ", ") + ")",
+	}
+}
+
+// mongoIndex returns the expected single field index of a collection with its createIndex call
+func mongoIndex(collection, field string, unique bool) configIndex {
+	create := fmt.Sprintf(`db.%s.createIndex({"%s": 1})`, collection, field)
+	if unique {
+		create = fmt.Sprintf(`db.%s.createIndex({"%s": 1}, {"unique": true})`, collection, field)
+	}
+	return configIndex{Name: field + "_1", Columns: []string{field}, Unique: unique, Create: create}
+}
+
+// ttlIndex returns the expected TTL index of a collection, which deletes each document once the date in
+// field has passed, with its createIndex call
+func ttlIndex(collection, field string) configIndex {
+	create := fmt.Sprintf(`db.%s.createIndex({"%s": 1}, {"expireAfterSeconds": 0})`, collection, field)
+	return configIndex{Name: field + "_1", Columns: []string{field}, TTL: true, Create: create}
+}
+
+// inlineIndex marks an index as created by the CREATE TABLE of its table
+func inlineIndex(index configIndex) configIndex {
+	index.Inline = true
+	return index
+}
+
+// expectedConfigTables returns the allconfig table and its approval table as create_table creates them on
+// dbType, their SQL statements qualified with the schema of ctx; MongoDB collections have no columns to expect
+func (a *API) expectedConfigTables(ctx context.Context, dbType, tableName string) []configTableSpec {
+	approvalTable := a.approvalTable(tableName)
+	table, approval := sqlTable(ctx, tableName), sqlTable(ctx, approvalTable)
+	switch dbType {
+	case "mysql":
+		return []configTableSpec{
+			{
+				Table:     tableName,
+				Qualified: table,
+				Role:      "config",
+				Columns: []configColumn{
+					{"id", "id INT AUTO_INCREMENT PRIMARY KEY"},
+					{"config_key", "config_key VARCHAR(255) NOT NULL"},
+					{"config_value", "config_value TEXT"},
+					{"description", "description TEXT"},
+					{"tags", "tags JSON"},
+					{"status", "status ENUM('approved', 'pending', 'rejected') DEFAULT 'approved'"},
+					{"maker_id", "maker_id VARCHAR(255)"},
+					{"checker_id", "checker_id VARCHAR(255)"},
+					{"created_at", "created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+					{"updated_at", "updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"},
+					{"approved_at", "approved_at TIMESTAMP NULL"},
+					{"approval_comment", "approval_comment TEXT"},
+					{"expires_at", "expires_at DATETIME NULL"},
+				},
+				Indexes: []configIndex{
+					sqlIndex("config_key", table, true, "config_key"),
+					sqlIndex("idx_config_key", table, false, "config_key"),
+					sqlIndex("idx_status", table, false, "status"),
+					sqlIndex("idx_maker_id", table, false, "maker_id"),
+					sqlIndex("idx_expires_at", table, false, "expires_at"),
+				},
+			},
+			{
+				Table:     approvalTable,
+				Qualified: approval,
+				Role:      "approval",
+				Columns: []configColumn{
+					{"request_id", "request_id VARCHAR(36) PRIMARY KEY"},
+					{"config_key", "config_key VARCHAR(255) NOT NULL"},
+					{"config_value", "config_value TEXT"},
+					{"description", "description TEXT"},
+					{"tags", "tags JSON"},
+					{"operation", "operation ENUM('create', 'update', 'delete') NOT NULL"},
+					{"maker_id", "maker_id VARCHAR(255) NOT NULL"},
+					{"checker_id", "checker_id VARCHAR(255)"},
+					{"status", "status ENUM('pending', 'approved', 'rejected') DEFAULT 'pending'"},
+					{"requested_at", "requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+					{"processed_at", "processed_at TIMESTAMP NULL"},
+					{"approval_comment", "approval_comment TEXT"},
+					{"previous_value", "previous_value TEXT"},
+					{"expires_at", "expires_at DATETIME NULL"},
+				},
+				Indexes: []configIndex{
+					inlineIndex(sqlIndex("request_id", approval, true, "request_id")),
+					sqlIndex("idx_status", approval, false, "status"),
+					sqlIndex("idx_maker_id", approval, false, "maker_id"),
+					sqlIndex("idx_checker_id", approval, false, "checker_id"),
+					sqlIndex("idx_config_key", approval, false, "config_key"),
+				},
+			},
+		}
+
+	case "postgresql":
+		tags := sqlIndex("idx_"+tableName+"_tags", table, false, "tags")
+		tags.Create = fmt.Sprintf("CREATE INDEX idx_%s_tags ON %s USING GIN (tags)", tableName, table)
+		return []configTableSpec{
+			{
+				Table:     tableName,
+				Qualified: table,
+				Role:      "config",
+				Columns: []configColumn{
+					{"id", "id SERIAL PRIMARY KEY"},
+					{"config_key", "config_key VARCHAR(255) NOT NULL"},
+					{"config_value", "config_value TEXT"},
+					{"description", "description TEXT"},
+					{"tags", "tags JSONB"},
+					{"status", "status VARCHAR(20) DEFAULT 'approved' CHECK (status IN ('approved', 'pending', 'rejected'))"},
+					{"maker_id", "maker_id VARCHAR(255)"},
+					{"checker_id", "checker_id VARCHAR(255)"},
+					{"created_at", "created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+					{"updated_at", "updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+					{"approved_at", "approved_at TIMESTAMP"},
+					{"approval_comment", "approval_comment TEXT"},
+					{"expires_at", "expires_at TIMESTAMP"},
+				},
+				Indexes: []configIndex{
+					sqlIndex(tableName+"_config_key_key", table, true, "config_key"),
+					sqlIndex("idx_"+tableName+"_config_key", table, false, "config_key"),
+					sqlIndex("idx_"+tableName+"_status", table, false, "status"),
+					sqlIndex("idx_"+tableName+"_maker_id", table, false, "maker_id"),
+					tags,
+					sqlIndex("idx_"+tableName+"_expires_at", table, false, "expires_at"),
+				},
+			},
+			{
+				Table:     approvalTable,
+				Qualified: approval,
+				Role:      "approval",
+				Columns: []configColumn{
+					{"request_id", "request_id VARCHAR(36) PRIMARY KEY"},
+					{"config_key", "config_key VARCHAR(255) NOT NULL"},
+					{"config_value", "config_value TEXT"},
+					{"description", "description TEXT"},
+					{"tags", "tags JSONB"},
+					{"operation", "operation VARCHAR(20) NOT NULL CHECK (operation IN ('create', 'update', 'delete'))"},
+					{"maker_id", "maker_id VARCHAR(255) NOT NULL"},
+					{"checker_id", "checker_id VARCHAR(255)"},
+					{"status", "status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected'))"},
+					{"requested_at", "requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+					{"processed_at", "processed_at TIMESTAMP"},
+					{"approval_comment", "approval_comment TEXT"},
+					{"previous_value", "previous_value TEXT"},
+					{"expires_at", "expires_at TIMESTAMP"},
+				},
+				Indexes: []configIndex{
+					inlineIndex(sqlIndex(approvalTable+"_pkey", approval, true, "request_id")),
+					sqlIndex("idx_"+tableName+"_approval_status", approval, false, "status"),
+					sqlIndex("idx_"+tableName+"_approval_maker", approval, false, "maker_id"),
+					sqlIndex("idx_"+tableName+"_approval_checker", approval, false, "checker_id"),
+				},
+			},
+		}
+
+	case "mongodb":
+		return []configTableSpec{
+			{
+				Table: tableName,
+				Role:  "config",
+				Indexes: []configIndex{
+					mongoIndex(tableName, "config_key", true),
+					mongoIndex(tableName, "tags", false),
+					ttlIndex(tableName, "expires_at"),
+				},
+			},
+			{
+				Table: approvalTable,
+				Role:  "approval",
+				Indexes: []configIndex{
+					mongoIndex(approvalTable, "request_id", true),
+					mongoIndex(approvalTable, "status", false),
+					mongoIndex(approvalTable, "maker_id", false),
+					mongoIndex(approvalTable, "config_key", false),
+				},
+			},
+		}
+	}
+	return nil
+}
+
+// configTableDrift compares a table, its columns and its indexes with spec, and lists the statements
+// adding what is missing: the whole table when it does not exist
+func configTableDrift(dbType string, spec *configTableSpec, exists bool, columns []ColumnInfo, indexes []IndexInfo) ConfigTableHealth {
+	health := ConfigTableHealth{
+		Table:          spec.Table,
+		Role:           spec.Role,
+		Exists:         exists,
+		MissingColumns: []string{},
+		MissingIndexes: []string{},
+	}
+	if !exists {
+		if dbType != "mongodb" {
+			health.RepairSQL = append(health.RepairSQL, spec.createTableSQL())
+		}
+		for _, index := range spec.Indexes {
+			if !index.Inline {
+				health.RepairSQL = append(health.RepairSQL, index.Create)
+				health.indexes = append(health.indexes, index)
+			}
+		}
+		return health
+	}
+
+	present := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		present[strings.ToLower(column.Name)] = true
+	}
+	for _, column := range spec.Columns {
+		if !present[column.Name] {
+			health.MissingColumns = append(health.MissingColumns, column.Name)
+			health.RepairSQL = append(health.RepairSQL, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", spec.Qualified, column.Definition))
+		}
+	}
+	for _, index := range spec.Indexes {
+		if !hasIndex(indexes, index) {
+			health.MissingIndexes = append(health.MissingIndexes, index.Name)
+			health.RepairSQL = append(health.RepairSQL, index.Create)
+			health.indexes = append(health.indexes, index)
+		}
+	}
+	return health
+}
+
+// hasIndex reports whether one of indexes covers the columns of expected, and is unique if expected is
+func hasIndex(indexes []IndexInfo, expected configIndex) bool {
+	for _, index := range indexes {
+		if expected.Unique && !index.Unique && !index.Primary {
+			continue
+		}
+		if strings.EqualFold(strings.Join(index.Columns, ","), strings.Join(expected.Columns, ",")) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfigSchema compares the allconfig table and its approval table with those create_table creates
+func (a *API) checkConfigSchema(ctx context.Context, connector connectors.DBConnector, schema, tableName string) (*ConfigSchemaHealth, error) {
+	return a.inspectConfigSchema(ctx, connector, schema, tableName, false)
+}
+
+// inspectConfigSchema compares the allconfig table and its approval table with those create_table creates.
+// Migrating leaves out the primary key columns missing from existing tables.
+func (a *API) inspectConfigSchema(ctx context.Context, connector connectors.DBConnector, schema, tableName string, migrating bool) (*ConfigSchemaHealth, error) {
+	dbType := connector.GetType()
+	specs := a.expectedConfigTables(ctx, dbType, tableName)
+	if specs == nil {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	result := &ConfigSchemaHealth{Healthy: true}
+	for i := range specs {
+		spec := &specs[i]
+		exists, err := a.checkTableExists(ctx, connector, schema, spec.Table)
+		if err != nil {
+			return nil, err
+		}
+		var columns []ColumnInfo
+		var indexes []IndexInfo
+		if exists {
+			if migrating {
+				stripped := spec.withoutPrimaryKey()
+				spec = &stripped
+			}
+			if dbType != "mongodb" {
+				if columns, err = a.describeTable(ctx, connector, schema, spec.Table); err != nil {
+					return nil, err
+				}
+			}
+			if indexes, err = a.listIndexes(ctx, connector, schema, spec.Table); err != nil {
+				return nil, err
+			}
+		}
+		health := configTableDrift(dbType, spec, exists, columns, indexes)
+		result.Healthy = result.Healthy && health.Healthy()
+		result.Tables = append(result.Tables, health)
+	}
+	return result, nil
+}
+
+// repairConfigSchema adds the tables, columns and indexes missing from the allconfig table and its approval
+// table, returning the statements it ran
+func (a *API) repairConfigSchema(ctx context.Context, connector connectors.DBConnector, schema, tableName string) ([]string, error) {
+	health, err := a.checkConfigSchema(ctx, connector, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return a.applyConfigSchema(ctx, connector, tableName, health)
+}
+
+// applyConfigSchema adds the tables, columns and indexes health found missing, returning the statements it ran
+func (a *API) applyConfigSchema(ctx context.Context, connector connectors.DBConnector, tableName string, health *ConfigSchemaHealth) ([]string, error) {
+	applied := []string{}
+	for _, table := range health.Tables {
+		if connector.GetType() == "mongodb" {
+			for _, index := range table.indexes {
+				options := map[string]interface{}{"unique": index.Unique}
+				if index.TTL {
+					options["expireAfterSeconds"] = 0
+				}
+				_, err := connector.Execute(ctx, "createIndex", map[string]interface{}{
+					"collection": table.Table,
+					"index":      map[string]interface{}{index.Columns[0]: 1},
+					"options":    options,
+				})
+				if err != nil {
+					return applied, fmt.Errorf("failed to create index %s on %s: %w", index.Name, table.Table, err)
+				}
+				applied = append(applied, index.Create)
+			}
+			continue
+		}
+
+		for _, statement := range table.RepairSQL {
+			if _, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": statement}); err != nil {
+				return applied, fmt.Errorf("failed to repair %s: %w", table.Table, err)
+			}
+			applied = append(applied, statement)
+		}
+		if table.Role == "config" && !table.Exists {
+			if err := a.createConfigNotifyTrigger(ctx, connector, tableName); err != nil {
+				return applied, err
+			}
+		}
+	}
+	return applied, nil
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaConnector serves the catalog queries of the drift check from tables held in memory, and records
+// the statements and createIndex calls run on it
+type schemaConnector struct {
+	connectortest.MockDBConnector
+	t        *testing.T
+	dbType   string
+	columns  map[string][]string    // Columns by table; a table exists when it has an entry
+	indexes  map[string][]IndexInfo // Indexes by table
+	executed []string
+}
+
+// newSchemaConnector returns a connector holding the tables create_table creates on dbType
+func newSchemaConnector(t *testing.T, api *API, dbType string) *schemaConnector {
+	c := &schemaConnector{t: t, dbType: dbType, columns: map[string][]string{}, indexes: map[string][]IndexInfo{}}
+	for _, spec := range api.expectedConfigTables(context.Background(), dbType, "allconfig") {
+		c.columns[spec.Table] = []string{}
+		for _, column := range spec.Columns {
+			c.columns[spec.Table] = append(c.columns[spec.Table], column.Name)
+		}
+		for _, index := range spec.Indexes {
+			c.indexes[spec.Table] = append(c.indexes[spec.Table], IndexInfo{Name: index.Name, Columns: index.Columns, Unique: index.Unique})
+		}
+	}
+	return c
+}
+
+// drop removes a table
+func (c *schemaConnector) drop(table string) {
+	delete(c.columns, table)
+	delete(c.indexes, table)
+}
+
+// dropColumns removes the named columns from table
+func (c *schemaConnector) dropColumns(table string, names ...string) {
+	columns := []string{}
+	for _, column := range c.columns[table] {
+		if !slices.Contains(names, column) {
+			columns = append(columns, column)
+		}
+	}
+	c.columns[table] = columns
+}
+
+// dropIndexes removes the named indexes from table
+func (c *schemaConnector) dropIndexes(table string, names ...string) {
+	indexes := []IndexInfo{}
+	for _, index := range c.indexes[table] {
+		if !slices.Contains(names, index.Name) {
+			indexes = append(indexes, index)
+		}
+	}
+	c.indexes[table] = indexes
+}
+
+func (c *schemaConnector) GetType() string { return c.dbType }
+
+func (c *schemaConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	table := fmt.Sprint(args[len(args)-1])
+	_, exists := c.columns[table]
+	switch {
+	case strings.Contains(query, "information_schema.tables"):
+		var values [][]driver.Value
+		if exists {
+			values = append(values, []driver.Value{"app", table, "BASE TABLE"})
+		}
+		return newMockRows(c.t, []string{"table_schema", "table_name", "table_type"}, values...), nil
+	case strings.Contains(query, "information_schema.columns"):
+		var values [][]driver.Value
+		for _, column := range c.columns[table] {
+			values = append(values, []driver.Value{column, "text", "YES", nil, "", ""})
+		}
+		return newMockRows(c.t, []string{"column_name", "column_type", "is_nullable", "column_default", "column_key", "extra"}, values...), nil
+	default:
+		var values [][]driver.Value
+		for _, index := range c.indexes[table] {
+			for _, column := range index.Columns {
+				values = append(values, []driver.Value{index.Name, column, index.Unique, index.Primary})
+			}
+		}
+		return newMockRows(c.t, []string{"index_name", "column_name", "is_unique", "is_primary"}, values...), nil
+	}
+}
+
+func (c *schemaConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	switch operation {
+	case "listCollections":
+		name := params["filter"].(map[string]interface{})["name"].(string)
+		if _, ok := c.columns[name]; !ok {
+			return []map[string]interface{}{}, nil
+		}
+		return []map[string]interface{}{{"name": name, "type": "collection"}}, nil
+	case "listIndexes":
+		specs := []map[string]interface{}{}
+		for _, index := range c.indexes[params["collection"].(string)] {
+			specs = append(specs, map[string]interface{}{"name": index.Name, "keys": index.Columns, "unique": index.Unique})
+		}
+		return specs, nil
+	case "createIndex":
+		c.executed = append(c.executed, fmt.Sprintf("%s %v %v", params["collection"], params["index"], params["options"]))
+		return nil, nil
+	case "updateMany":
+		c.executed = append(c.executed, fmt.Sprintf("%s updateMany %v %v", params["collection"], params["filter"], params["update"]))
+		return nil, nil
+	default:
+		c.executed = append(c.executed, params["query"].(string))
+		return nil, nil
+	}
+}
+
+func TestCheckConfigSchemaHealthy(t *testing.T) {
+	api := NewAPI()
+	for _, dbType := range []string{"mysql", "postgresql", "mongodb"} {
+		t.Run(dbType, func(t *testing.T) {
+			health, err := api.checkConfigSchema(context.Background(), newSchemaConnector(t, api, dbType), "", "allconfig")
+			require.NoError(t, err)
+			assert.True(t, health.Healthy)
+			require.Len(t, health.Tables, 2)
+			assert.Equal(t, ConfigTableHealth{
+				Table:          "allconfig_approval_requests",
+				Role:           "approval",
+				Exists:         true,
+				MissingColumns: []string{},
+				MissingIndexes: []string{},
+			}, health.Tables[1])
+		})
+	}
+}
+
+func TestCheckConfigSchemaMissingApprovalTable(t *testing.T) {
+	api := NewAPI()
+	tests := map[string][]string{
+		"mysql": {
+			"CREATE TABLE allconfig_approval_requests (\n    request_id VARCHAR(36) PRIMARY KEY,",
+			"CREATE INDEX idx_status ON allconfig_approval_requests (status)",
+			"CREATE INDEX idx_maker_id ON allconfig_approval_requests (maker_id)",
+			"CREATE INDEX idx_checker_id ON allconfig_approval_requests (checker_id)",
+			"CREATE INDEX idx_config_key ON allconfig_approval_requests (config_key)",
+		},
+		"postgresql": {
+			"CREATE TABLE allconfig_approval_requests (\n    request_id VARCHAR(36) PRIMARY KEY,",
+			"CREATE INDEX idx_allconfig_approval_status ON allconfig_approval_requests (status)",
+			"CREATE INDEX idx_allconfig_approval_maker ON allconfig_approval_requests (maker_id)",
+			"CREATE INDEX idx_allconfig_approval_checker ON allconfig_approval_requests (checker_id)",
+		},
+		"mongodb": {
+			`db.allconfig_approval_requests.createIndex({"request_id": 1}, {"unique": true})`,
+			`db.allconfig_approval_requests.createIndex({"status": 1})`,
+			`db.allconfig_approval_requests.createIndex({"maker_id": 1})`,
+			`db.allconfig_approval_requests.createIndex({"config_key": 1})`,
+		},
+	}
+	for dbType, repair := range tests {
+		t.Run(dbType, func(t *testing.T) {
+			connector := newSchemaConnector(t, api, dbType)
+			connector.drop("allconfig_approval_requests")
+
+			health, err := api.checkConfigSchema(context.Background(), connector, "", "allconfig")
+			require.NoError(t, err)
+			assert.False(t, health.Healthy)
+			assert.True(t, health.Tables[0].Healthy())
+
+			approval := health.Tables[1]
+			assert.False(t, approval.Exists)
+			assert.Empty(t, approval.MissingColumns)
+			assert.Empty(t, approval.MissingIndexes)
+			require.Len(t, approval.RepairSQL, len(repair))
+			for i, statement := range repair {
+				assert.True(t, strings.HasPrefix(approval.RepairSQL[i], statement), approval.RepairSQL[i])
+			}
+		})
+	}
+}
+
+func TestCheckConfigSchemaMissingColumnsAndIndexes(t *testing.T) {
+	api := NewAPI()
+	tests := []struct {
+		dbType  string
+		columns []string
+		indexes []string
+		repair  []string
+	}{
+		{
+			dbType:  "mysql",
+			columns: []string{"tags", "approved_at"},
+			indexes: []string{"config_key", "idx_status"},
+			repair: []string{
+				"ALTER TABLE allconfig ADD COLUMN tags JSON",
+				"ALTER TABLE allconfig ADD COLUMN approved_at TIMESTAMP NULL",
+				"CREATE UNIQUE INDEX config_key ON allconfig (config_key)",
+				"CREATE INDEX idx_status ON allconfig (status)",
+			},
+		},
+		{
+			dbType:  "postgresql",
+			columns: []string{"tags"},
+			indexes: []string{"idx_allconfig_tags"},
+			repair: []string{
+				"ALTER TABLE allconfig ADD COLUMN tags JSONB",
+				"CREATE INDEX idx_allconfig_tags ON allconfig USING GIN (tags)",
+			},
+		},
+		{
+			dbType:  "mongodb",
+			columns: []string{},
+			indexes: []string{"config_key_1"},
+			repair:  []string{`db.allconfig.createIndex({"config_key": 1}, {"unique": true})`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			connector := newSchemaConnector(t, api, tt.dbType)
+			connector.dropColumns("allconfig", tt.columns...)
+			connector.dropIndexes("allconfig", tt.indexes...)
+
+			health, err := api.checkConfigSchema(context.Background(), connector, "", "allconfig")
+			require.NoError(t, err)
+			assert.False(t, health.Healthy)
+			assert.Equal(t, ConfigTableHealth{
+				Table:          "allconfig",
+				Role:           "config",
+				Exists:         true,
+				MissingColumns: tt.columns,
+				MissingIndexes: tt.indexes,
+				RepairSQL:      tt.repair,
+				indexes:        health.Tables[0].indexes,
+			}, health.Tables[0])
+			assert.True(t, health.Tables[1].Healthy())
+		})
+	}
+}
+
+func TestCheckConfigSchemaMatchesIndexesByColumns(t *testing.T) {
+	api := NewAPI()
+	connector := newSchemaConnector(t, api, "postgresql")
+	// A hand-made table whose indexes have other names; config_key is indexed but not unique
+	connector.indexes["allconfig"] = []IndexInfo{
+		{Name: "allconfig_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+		{Name: "by_key", Columns: []string{"config_key"}},
+		{Name: "by_status", Columns: []string{"status"}},
+		{Name: "by_maker", Columns: []string{"maker_id"}},
+		{Name: "by_tags", Columns: []string{"tags"}},
+		{Name: "by_expiry", Columns: []string{"expires_at"}},
+	}
+
+	health, err := api.checkConfigSchema(context.Background(), connector, "", "allconfig")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"allconfig_config_key_key"}, health.Tables[0].MissingIndexes)
+	assert.Equal(t, []string{"CREATE UNIQUE INDEX allconfig_config_key_key ON allconfig (config_key)"}, health.Tables[0].RepairSQL)
+
+	// A primary key stands in for a unique index
+	connector.indexes["allconfig_approval_requests"][0] = IndexInfo{Name: "pk", Columns: []string{"request_id"}, Primary: true}
+	health, err = api.checkConfigSchema(context.Background(), connector, "", "allconfig")
+	require.NoError(t, err)
+	assert.True(t, health.Tables[1].Healthy())
+}
+
+func TestCheckConfigSchemaBothTablesMissing(t *testing.T) {
+	api := NewAPI()
+	connector := newSchemaConnector(t, api, "mysql")
+	connector.drop("allconfig")
+	connector.drop("allconfig_approval_requests")
+
+	health, err := api.checkConfigSchema(context.Background(), connector, "", "allconfig")
+	require.NoError(t, err)
+	assert.False(t, health.Healthy)
+	assert.False(t, health.Tables[0].Exists)
+	assert.False(t, health.Tables[1].Exists)
+	// The unique config_key index is created apart from the table, and the primary key with it
+	assert.Equal(t, "CREATE UNIQUE INDEX config_key ON allconfig (config_key)", health.Tables[0].RepairSQL[1])
+	assert.Len(t, health.Tables[1].RepairSQL, 5)
+}
+
+func TestRepairConfigSchema(t *testing.T) {
+	api := NewAPI()
+	connector := newSchemaConnector(t, api, "postgresql")
+	connector.dropColumns("allconfig", "tags")
+	connector.drop("allconfig_approval_requests")
+
+	applied, err := api.repairConfigSchema(context.Background(), connector, "", "allconfig")
+	require.NoError(t, err)
+	assert.Equal(t, connector.executed, applied)
+	require.Len(t, applied, 5)
+	assert.Equal(t, "ALTER TABLE allconfig ADD COLUMN tags JSONB", applied[0])
+	assert.True(t, strings.HasPrefix(applied[1], "CREATE TABLE allconfig_approval_requests ("))
+
+	// A healthy schema needs no repair
+	applied, err = api.repairConfigSchema(context.Background(), newSchemaConnector(t, api, "postgresql"), "", "allconfig")
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+func TestRepairConfigSchemaMongoDB(t *testing.T) {
+	api := NewAPI()
+	connector := newSchemaConnector(t, api, "mongodb")
+	connector.dropIndexes("allconfig", "tags_1")
+	connector.dropIndexes("allconfig_approval_requests", "request_id_1")
+
+	applied, err := api.repairConfigSchema(context.Background(), connector, "", "allconfig")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`db.allconfig.createIndex({"tags": 1})`,
+		`db.allconfig_approval_requests.createIndex({"request_id": 1}, {"unique": true})`,
+	}, applied)
+	assert.Equal(t, []string{
+		"allconfig map[tags:1] map[unique:false]",
+		"allconfig_approval_requests map[request_id:1] map[unique:true]",
+	}, connector.executed)
+}
+
+func TestExpectedConfigTablesMatchCreateTableSQL(t *testing.T) {
+	api := NewAPI()
+	for _, dbType := range []string{"mysql", "postgresql", "mongodb"} {
+		script := api.getCreateTableSQL(context.Background(), dbType, "allconfig")
+		for _, spec := range api.expectedConfigTables(context.Background(), dbType, "allconfig") {
+			for _, column := range spec.Columns {
+				assert.Contains(t, script, column.Definition, "%s %s", dbType, spec.Table)
+			}
+			for _, index := range spec.Indexes {
+				if dbType == "mongodb" {
+					assert.Contains(t, script, index.Create, "%s %s", dbType, spec.Table)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors"
+)
+
+// configStore runs the statements of the ConfigService with the allconfig methods of the API, on the
+// tables and in the schema they resolve
+type configStore struct {
+	api *API
+}
+
+func (s configStore) Submit(ctx context.Context, connector connectors.DBConnector, requestID string, req allconfig.SubmitRequest) (interface{}, error) {
+	return s.api.submitConfigForApproval(ctx, connector, requestID, req)
+}
+
+func (s configStore) PendingRequest(ctx context.Context, connector connectors.DBConnector, table, requestID string) (*allconfig.ApprovalRequest, error) {
+	request, err := s.api.getPendingRequestByID(ctx, connector, table, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return approvalRequestOf(request), nil
+}
+
+func (s configStore) Decide(ctx context.Context, connector connectors.DBConnector, req allconfig.DecisionRequest, status string) error {
+	return s.api.updateApprovalRequestStatus(ctx, connector, req.Table, req.RequestID, status, req.CheckerID, req.Comment)
+}
+
+func (s configStore) Create(ctx context.Context, connector connectors.DBConnector, req allconfig.SetRequest) (interface{}, error) {
+	return s.api.createConfigDirect(ctx, connector, req.Table, req.Key, req.Value, req.Description, req.Tags, req.ExpiresAt, req.MakerID)
+}
+
+func (s configStore) Update(ctx context.Context, connector connectors.DBConnector, req allconfig.SetRequest) (interface{}, error) {
+	return s.api.updateConfigDirect(ctx, connector, req.Table, req.Key, req.Value, req.Description, req.Tags, req.ExpiresAt, req.MakerID)
+}
+
+func (s configStore) Delete(ctx context.Context, connector connectors.DBConnector, req allconfig.DeleteRequest) (interface{}, error) {
+	return s.api.deleteConfigDirect(ctx, connector, req.Table, req.Key, req.MakerID)
+}
+
+func (s configStore) Read(ctx context.Context, connector connectors.DBConnector, req allconfig.ReadRequest) (interface{}, error) {
+	return s.api.readApprovedConfig(ctx, connector, req.Table, req.Key)
+}
+
+func (s configStore) Exists(ctx context.Context, connector connectors.DBConnector, req allconfig.ReadRequest) (bool, error) {
+	result, err := s.api.configExistsApproved(ctx, connector, req.Table, req.Key)
+	if err != nil {
+		return false, err
+	}
+	exists, _ := result.(map[string]interface{})["exists"].(bool)
+	return exists, nil
+}
+
+func (s configStore) ReadAll(ctx context.Context, connector connectors.DBConnector, req allconfig.ListRequest) (interface{}, error) {
+	return s.api.readAllApprovedConfigs(ctx, connector, req.Table, req.Limit, req.Offset)
+}
+
+func (s configStore) Search(ctx context.Context, connector connectors.DBConnector, req allconfig.SearchRequest) (interface{}, error) {
+	q := configQuery{ApprovedOnly: true, SearchTerm: req.Term, Filter: req.Filter, Tags: TagMatch{Any: req.TagsAny, All: req.TagsAll}}
+	return s.api.findConfigs(ctx, connector, req.Table, q, req.Limit, req.Offset)
+}
+
+func (s configStore) Pending(ctx context.Context, connector connectors.DBConnector, req allconfig.ListRequest) (interface{}, error) {
+	return s.api.getPendingApprovals(ctx, connector, req.Table, req.Limit, req.Offset)
+}
+
+func (s configStore) MyRequests(ctx context.Context, connector connectors.DBConnector, req allconfig.ListRequest) (interface{}, error) {
+	return s.api.getMyRequests(ctx, connector, req.Table, req.MakerID, req.Limit, req.Offset)
+}
+
+func (s configStore) History(ctx context.Context, connector connectors.DBConnector, req allconfig.ListRequest) (interface{}, error) {
+	return s.api.getApprovalHistory(ctx, connector, req.Table, req.Limit, req.Offset)
+}
+
+// approvalRequestOf returns the pending request of an approval request row or document. Fields it lacks,
+// or stores as null, are empty.
+func approvalRequestOf(request map[string]interface{}) *allconfig.ApprovalRequest {
+	approval := &allconfig.ApprovalRequest{
+		Value:       request["config_value"],
+		Tags:        tagsOf(request["tags"]),
+		ExpiresAt:   expiryOf(request),
+		RequestedAt: mongoTime(request["requested_at"]),
+	}
+	approval.RequestID, _ = request["request_id"].(string)
+	approval.Operation, _ = request["operation"].(string)
+	approval.Key, _ = request["config_key"].(string)
+	approval.Description, _ = request["description"].(string)
+	approval.MakerID, _ = request["maker_id"].(string)
+	return approval
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	goldenRequestID = regexp.MustCompile(`"[0-9a-f]{32}"`)
+	goldenTime      = regexp.MustCompile(`"\d{4}-\d\d-\d\dT[0-9:.]+(Z|[+-]\d\d:\d\d)"`)
+)
+
+// goldenJSON returns result encoded as the allconfig endpoint sends it, with the random request IDs and
+// the times taken from the wall clock replaced
+func goldenJSON(t *testing.T, result interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(utcTimes(result))
+	require.NoError(t, err)
+	data = goldenRequestID.ReplaceAll(data, []byte(`"<request-id>"`))
+	return string(goldenTime.ReplaceAll(data, []byte(`"<time>"`)))
+}
+
+// submittedRequestID returns the request ID of a submit response, or an empty one for other responses
+func submittedRequestID(t *testing.T, result interface{}) string {
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	var submitted struct {
+		RequestID string `json:"request_id"`
+		Status    string `json:"status"`
+	}
+	if json.Unmarshal(data, &submitted) != nil || submitted.Status != "submitted_for_approval" {
+		return ""
+	}
+	return submitted.RequestID
+}
+
+// lastSubmitted stands for the ID of the request submitted last in a golden flow
+const lastSubmitted = "<last-submitted>"
+
+// TestAllConfigGoldenMongoDB runs the maker-checker and direct operations on an in-memory MongoDB,
+// checking each response against the one the allconfig endpoint has always sent
+func TestAllConfigGoldenMongoDB(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	api := stopClock(NewAPI())
+	conn := connectortest.NewFake()
+	conn.SetNow(func() time.Time { return expiryTestNow })
+
+	steps := []struct {
+		req  AllConfigOperationRequest
+		want string
+	}{
+		{
+			AllConfigOperationRequest{Operation: "create_table"},
+			`{"collection_created":true,"index_created":true}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "submit_create", Key: "feature.flag", Value: "on", Description: "d", Tags: []string{"pii"}, ExpiresAt: &expiresAt, MakerID: "alice"},
+			`{"config_key":"feature.flag","expires_at":"<time>","maker_id":"alice","operation":"create","request_id":"<request-id>","result":{"InsertedID":"000000000000000000000002"},"status":"submitted_for_approval"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "get_pending_approvals"},
+			`[{"_id":"000000000000000000000002","config_key":"feature.flag","config_value":"on","description":"d","expires_at":"<time>","maker_id":"alice","operation":"create","previous_value":null,"previous_value_truncated":false,"request_id":"<request-id>","requested_at":"<time>","status":"pending","tags":["pii"],"value_size":2,"value_truncated":false}]`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "approve_request", RequestID: lastSubmitted, CheckerID: "carol", ApprovalComment: "ok"},
+			`{"applied_result":{"config_key":"feature.flag","created_at":"<time>","updated_at":"<time>","approved_at":"<time>","expires_at":"<time>"},"approval_comment":"ok","checker_id":"carol","request_id":"<request-id>","status":"approved"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "read", Key: "feature.flag"},
+			`{"_id":"000000000000000000000003","approved_at":"<time>","config_key":"feature.flag","config_value":"on","created_at":"<time>","description":"d","expires_at":"<time>","maker_id":"alice","status":"approved","tags":["pii"],"updated_at":"<time>"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "read_all"},
+			`[{"_id":"000000000000000000000003","approved_at":"<time>","config_key":"feature.flag","config_value":"on","created_at":"<time>","description":"d","expires_at":"<time>","maker_id":"alice","status":"approved","tags":["pii"],"updated_at":"<time>","value_size":2,"value_truncated":false}]`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "search", SearchTerm: "feature"},
+			`[{"_id":"000000000000000000000003","approved_at":"<time>","config_key":"feature.flag","config_value":"on","created_at":"<time>","description":"d","expires_at":"<time>","maker_id":"alice","status":"approved","tags":["pii"],"updated_at":"<time>","value_size":2,"value_truncated":false}]`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "exists", Key: "feature.flag"},
+			`{"exists":true,"key":"feature.flag"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "submit_update", Key: "feature.flag", Value: "off", MakerID: "alice"},
+			`{"config_key":"feature.flag","maker_id":"alice","operation":"update","request_id":"<request-id>","result":{"InsertedID":"000000000000000000000004"},"status":"submitted_for_approval"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "reject_request", RequestID: lastSubmitted, CheckerID: "carol", ApprovalComment: "no"},
+			`{"approval_comment":"no","checker_id":"carol","request_id":"<request-id>","status":"rejected"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "direct_create", Key: "other.flag", Value: 3, MakerID: "bob"},
+			`{"config_key":"other.flag","created_at":"<time>","updated_at":"<time>","approved_at":"<time>"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "direct_update", Key: "other.flag", Value: 4, MakerID: "bob"},
+			`{"config_key":"other.flag","created_at":"<time>","updated_at":"<time>","approved_at":"<time>"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "submit_delete", Key: "other.flag", MakerID: "bob"},
+			`{"config_key":"other.flag","maker_id":"bob","operation":"delete","request_id":"<request-id>","result":{"InsertedID":"000000000000000000000006"},"status":"submitted_for_approval"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "approve_request", RequestID: lastSubmitted, CheckerID: "carol"},
+			`{"applied_result":{"DeletedCount":1},"approval_comment":"","checker_id":"carol","request_id":"<request-id>","status":"approved"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "direct_delete", Key: "feature.flag", MakerID: "bob"},
+			`{"DeletedCount":1}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "get_my_requests", MakerID: "alice"},
+			`[{"_id":"000000000000000000000004","approval_comment":"no","checker_id":"carol","config_key":"feature.flag","config_value":"off","description":"","maker_id":"alice","operation":"update","previous_value":null,"previous_value_truncated":false,"processed_at":"<time>","request_id":"<request-id>","requested_at":"<time>","status":"rejected","value_size":3,"value_truncated":false},` +
+				`{"_id":"000000000000000000000002","approval_comment":"ok","checker_id":"carol","config_key":"feature.flag","config_value":"on","description":"d","expires_at":"<time>","maker_id":"alice","operation":"create","previous_value":null,"previous_value_truncated":false,"processed_at":"<time>","request_id":"<request-id>","requested_at":"<time>","status":"approved","tags":["pii"],"value_size":2,"value_truncated":false}]`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "get_approval_history", Limit: 1},
+			`[{"_id":"000000000000000000000002","approval_comment":"ok","checker_id":"carol","config_key":"feature.flag","config_value":"on","description":"d","expires_at":"<time>","maker_id":"alice","operation":"create","previous_value":null,"previous_value_truncated":false,"processed_at":"<time>","request_id":"<request-id>","requested_at":"<time>","status":"approved","tags":["pii"],"value_size":2,"value_truncated":false}]`,
+		},
+	}
+
+	var submitted string
+	for _, step := range steps {
+		req := step.req
+		req.TableName = "allconfig"
+		if req.RequestID == lastSubmitted {
+			req.RequestID = submitted
+		}
+		result, err := api.executeAllConfigOperation(context.Background(), conn, &req)
+		require.NoError(t, err, req.Operation)
+		if id := submittedRequestID(t, result); id != "" {
+			submitted = id
+			// requested_at has millisecond precision; keep the requests in order when sorted by it
+			time.Sleep(2 * time.Millisecond)
+		}
+		assert.JSONEq(t, step.want, goldenJSON(t, result), req.Operation)
+	}
+}
+
+// TestAllConfigGoldenSQL runs the maker-checker and direct operations on MySQL, checking each response
+// against the one the allconfig endpoint has always sent
+func TestAllConfigGoldenSQL(t *testing.T) {
+	connector := func() *connectortest.MockDBConnector {
+		conn := newServiceConnector("mysql")
+		conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(sqlmock.NewResult(0, 1), nil)
+		return conn
+	}
+	pendingRequest := func(operation string) *connectortest.MockDBConnector {
+		conn := connector()
+		conn.On("Query", mock.Anything, queryContaining("WHERE request_id = ? AND status = 'pending'"), []interface{}{"req-1"}).
+			Return(newMockRows(t, []string{"request_id", "config_key", "config_value", "description", "tags", "operation", "maker_id", "previous_value", "expires_at"},
+				[]driver.Value{"req-1", "feature.flag", "on", "d", `["pii"]`, operation, "alice", nil, nil}), nil).Once()
+		return conn
+	}
+	storedConfig := func() *connectortest.MockDBConnector {
+		conn := connector()
+		conn.On("Query", mock.Anything, queryContaining("status = 'approved'"), mock.Anything).
+			Return(newMockRows(t, []string{"config_key", "config_value", "description", "tags", "created_at", "updated_at", "maker_id", "checker_id", "approved_at", "expires_at"},
+				[]driver.Value{"feature.flag", "on", "d", `["pii"]`, writtenAt, writtenAt, "alice", "carol", writtenAt, nil}), nil).Once()
+		return conn
+	}
+	written := func() *connectortest.MockDBConnector {
+		conn := connector()
+		expectConfigTimestamps(t, conn, 1)
+		return conn
+	}
+
+	steps := []struct {
+		req  AllConfigOperationRequest
+		conn func() *connectortest.MockDBConnector
+		want string
+	}{
+		{
+			AllConfigOperationRequest{Operation: "submit_create", Key: "feature.flag", Value: "on", Description: "d", Tags: []string{"pii"}, MakerID: "alice"},
+			connector,
+			`{"config_key":"feature.flag","maker_id":"alice","operation":"create","request_id":"<request-id>","result":{},"status":"submitted_for_approval"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "submit_delete", Key: "feature.flag", MakerID: "bob"},
+			connector,
+			`{"config_key":"feature.flag","maker_id":"bob","operation":"delete","request_id":"<request-id>","result":{},"status":"submitted_for_approval"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "approve_request", RequestID: "req-1", CheckerID: "carol", ApprovalComment: "ok"},
+			func() *connectortest.MockDBConnector {
+				conn := pendingRequest("update")
+				expectConfigTimestamps(t, conn, 1)
+				return conn
+			},
+			`{"applied_result":{"config_key":"feature.flag","created_at":"<time>","updated_at":"<time>","approved_at":"<time>"},"approval_comment":"ok","checker_id":"carol","request_id":"req-1","status":"approved"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "approve_request", RequestID: "req-1", CheckerID: "carol"},
+			func() *connectortest.MockDBConnector { return pendingRequest("delete") },
+			`{"applied_result":{},"approval_comment":"","checker_id":"carol","request_id":"req-1","status":"approved"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "reject_request", RequestID: "req-1", CheckerID: "carol", ApprovalComment: "no"},
+			connector,
+			`{"approval_comment":"no","checker_id":"carol","request_id":"req-1","status":"rejected"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "read", Key: "feature.flag"},
+			storedConfig,
+			`[{"approved_at":"<time>","checker_id":"carol","config_key":"feature.flag","config_value":"on","created_at":"<time>","description":"d","expires_at":null,"maker_id":"alice","tags":["pii"],"updated_at":"<time>"}]`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "read_all", Limit: 10},
+			storedConfig,
+			`[{"approved_at":"<time>","checker_id":"carol","config_key":"feature.flag","config_value":"on","created_at":"<time>","description":"d","expires_at":null,"maker_id":"alice","tags":["pii"],"updated_at":"<time>","value_size":2,"value_truncated":false}]`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "exists", Key: "feature.flag"},
+			func() *connectortest.MockDBConnector {
+				conn := connector()
+				conn.On("Query", mock.Anything, queryContaining("SELECT COUNT(*)"), mock.Anything).
+					Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{1}), nil).Once()
+				return conn
+			},
+			`{"exists":true,"key":"feature.flag"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "direct_create", Key: "feature.flag", Value: "on", MakerID: "alice"},
+			written,
+			`{"config_key":"feature.flag","created_at":"<time>","updated_at":"<time>","approved_at":"<time>"}`,
+		},
+		{
+			AllConfigOperationRequest{Operation: "direct_delete", Key: "feature.flag", MakerID: "alice"},
+			connector,
+			`{}`,
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.req.Operation, func(t *testing.T) {
+			req := step.req
+			req.TableName = "allconfig"
+			req.LegacyMode = boolPtr(false)
+			conn := step.conn()
+			result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, &req)
+			require.NoError(t, err)
+			assert.JSONEq(t, step.want, goldenJSON(t, result))
+		})
+	}
+}
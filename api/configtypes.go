@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configValueTypes are the types expected_type coerces config values to
+var configValueTypes = []string{"string", "bool", "int", "float", "duration", "json"}
+
+// Outcomes of a read whose value does not parse as its expected_type, set in on_type_error
+const (
+	TypeErrorRaw  = "raw"  // return the stored value with parse_error, the default
+	TypeErrorFail = "fail" // fail the read with TYPE_MISMATCH
+)
+
+// coerceConfigValue parses a config value as typ. Values stored as text are parsed; values MongoDB stores
+// natively are converted when they fit. Durations are returned in milliseconds and JSON as decoded.
+func coerceConfigValue(value interface{}, typ string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	text, isText := value.(string)
+	invalid := func(err error) error {
+		if isText {
+			return fmt.Errorf("%q is not a valid %s: %w", text, typ, err)
+		}
+		return fmt.Errorf("%v (%T) is not a valid %s: %w", value, value, typ, err)
+	}
+
+	switch typ {
+	case "string":
+		if isText {
+			return text, nil
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return string(encoded), nil
+
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		if !isText {
+			return nil, invalid(fmt.Errorf("not true or false"))
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return b, nil
+
+	case "int":
+		if isText {
+			n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+			if err != nil {
+				return nil, invalid(err)
+			}
+			return n, nil
+		}
+		f, ok := asNumber(value)
+		if !ok || f != math.Trunc(f) {
+			return nil, invalid(fmt.Errorf("not a whole number"))
+		}
+		return int64(f), nil
+
+	case "float":
+		if isText {
+			f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			if err != nil {
+				return nil, invalid(err)
+			}
+			return f, nil
+		}
+		f, ok := asNumber(value)
+		if !ok {
+			return nil, invalid(fmt.Errorf("not a number"))
+		}
+		return f, nil
+
+	case "duration":
+		if !isText {
+			return nil, invalid(fmt.Errorf("not a duration string such as 300ms"))
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(text))
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return float64(d) / float64(time.Millisecond), nil
+
+	case "json":
+		if !isText {
+			return value, nil
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(text), &decoded); err != nil {
+			return nil, invalid(err)
+		}
+		return decoded, nil
+
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+}
+
+// asNumber converts a numeric value to a float64
+func asNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// checkExpectedType rejects expected_type on an operation other than read, an unknown type or on_type_error,
+// and a default_value that does not parse as the expected type
+func checkExpectedType(req *AllConfigOperationRequest, spec *operationSpec) error {
+	if req.ExpectedType == "" && req.OnTypeError == "" {
+		return nil
+	}
+	invalid := func(message string) error {
+		return &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: message,
+			Details: map[string]interface{}{"operation": req.Operation, "expected_type": req.ExpectedType},
+		}
+	}
+	if spec.Name != "read" {
+		return invalid(fmt.Sprintf("expected_type applies to read only, not %s", req.Operation))
+	}
+	if !slices.Contains(configValueTypes, req.ExpectedType) {
+		return invalid(fmt.Sprintf("expected_type must be one of %s, got %q", strings.Join(configValueTypes, ", "), req.ExpectedType))
+	}
+	if req.OnTypeError != "" && req.OnTypeError != TypeErrorRaw && req.OnTypeError != TypeErrorFail {
+		return invalid(fmt.Sprintf("on_type_error must be %s or %s, got %q", TypeErrorRaw, TypeErrorFail, req.OnTypeError))
+	}
+	if _, err := coerceConfigValue(req.DefaultValue, req.ExpectedType); err != nil {
+		return invalid("default_value " + err.Error())
+	}
+	return nil
+}
+
+// configTyping is the expected_type and on_type_error of a read
+type configTyping struct {
+	Type    string
+	OnError string
+}
+
+// typingOf returns the typing of the configs read by req
+func typingOf(req *AllConfigOperationRequest) configTyping {
+	return configTyping{Type: req.ExpectedType, OnError: req.OnTypeError}
+}
+
+// apply replaces the config_value of each config read with its value parsed as the expected type. A value
+// that does not parse is left as stored with parse_error set, or fails the read with TYPE_MISMATCH when
+// on_type_error is fail.
+func (t configTyping) apply(result interface{}, err error) (interface{}, error) {
+	if err != nil || t.Type == "" {
+		return result, err
+	}
+	var configs []map[string]interface{}
+	switch r := result.(type) {
+	case map[string]interface{}:
+		configs = []map[string]interface{}{r}
+	case []map[string]interface{}:
+		configs = r
+	}
+	for _, config := range configs {
+		typed, err := coerceConfigValue(config["config_value"], t.Type)
+		if err == nil {
+			config["config_value"] = typed
+			continue
+		}
+		if t.OnError == TypeErrorFail {
+			return nil, &apiError{
+				Status:  http.StatusUnprocessableEntity,
+				Code:    ErrorCodeTypeMismatch,
+				Message: fmt.Sprintf("config %s: %v", asString(config["config_key"]), err),
+				Details: map[string]interface{}{"key": config["config_key"], "expected_type": t.Type},
+			}
+		}
+		config["parse_error"] = err.Error()
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoerceConfigValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		typ   string
+		want  interface{}
+	}{
+		{"on", "string", "on"},
+		{[]byte("on"), "string", "on"},
+		{int32(5), "string", "5"},
+		{map[string]interface{}{"a": 1}, "string", `{"a":1}`},
+		{"true", "bool", true},
+		{" 0 ", "bool", false},
+		{true, "bool", true},
+		{"42", "int", int64(42)},
+		{"-7", "int", int64(-7)},
+		{int32(42), "int", int64(42)},
+		{42.0, "int", int64(42)},
+		{"2.5", "float", 2.5},
+		{int64(3), "float", 3.0},
+		{"300ms", "duration", 300.0},
+		{"1m30s", "duration", 90000.0},
+		{"1.5us", "duration", 0.0015},
+		{`{"retries": 3}`, "json", map[string]interface{}{"retries": 3.0}},
+		{"[1, 2]", "json", []interface{}{1.0, 2.0}},
+		{map[string]interface{}{"a": 1}, "json", map[string]interface{}{"a": 1}},
+		{nil, "int", nil},
+	}
+	for _, tt := range tests {
+		got, err := coerceConfigValue(tt.value, tt.typ)
+		require.NoError(t, err, "%v as %s", tt.value, tt.typ)
+		assert.Equal(t, tt.want, got, "%v as %s", tt.value, tt.typ)
+	}
+
+	for _, tt := range []struct {
+		value   interface{}
+		typ     string
+		message string
+	}{
+		{"yes please", "bool", `"yes please" is not a valid bool`},
+		{int64(1), "bool", "1 (int64) is not a valid bool: not true or false"},
+		{"4.2", "int", `"4.2" is not a valid int`},
+		{4.2, "int", "4.2 (float64) is not a valid int: not a whole number"},
+		{"fast", "float", `"fast" is not a valid float`},
+		{"300", "duration", `"300" is not a valid duration`},
+		{int64(300), "duration", "300 (int64) is not a valid duration"},
+		{"{broken", "json", `"{broken" is not a valid json`},
+	} {
+		_, err := coerceConfigValue(tt.value, tt.typ)
+		assert.ErrorContains(t, err, tt.message)
+	}
+}
+
+func TestCheckExpectedType(t *testing.T) {
+	check := func(req *AllConfigOperationRequest) error {
+		_, err := checkAllConfigOperation(req, "mysql")
+		return err
+	}
+	assert.NoError(t, check(&AllConfigOperationRequest{Operation: "read", Key: "k", ExpectedType: "duration", DefaultValue: "5s", OnTypeError: TypeErrorFail}))
+	assert.NoError(t, check(&AllConfigOperationRequest{Operation: "read", Key: "k", ExpectedType: "int", DefaultValue: 10.0}))
+
+	err := check(&AllConfigOperationRequest{Operation: "read_all", ExpectedType: "int"})
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	assert.Equal(t, "expected_type applies to read only, not read_all", apiErr.Message)
+
+	assert.EqualError(t, check(&AllConfigOperationRequest{Operation: "read", Key: "k", ExpectedType: "date"}),
+		`expected_type must be one of string, bool, int, float, duration, json, got "date"`)
+	assert.EqualError(t, check(&AllConfigOperationRequest{Operation: "read", Key: "k", OnTypeError: TypeErrorFail}),
+		`expected_type must be one of string, bool, int, float, duration, json, got ""`)
+	assert.EqualError(t, check(&AllConfigOperationRequest{Operation: "read", Key: "k", ExpectedType: "int", OnTypeError: "ignore"}),
+		`on_type_error must be raw or fail, got "ignore"`)
+	assert.ErrorContains(t, check(&AllConfigOperationRequest{Operation: "read", Key: "k", ExpectedType: "bool", DefaultValue: "maybe"}),
+		`default_value "maybe" is not a valid bool`)
+}
+
+func TestConfigTypingApply(t *testing.T) {
+	configs := func() []map[string]interface{} {
+		return []map[string]interface{}{{"config_key": "timeout", "config_value": "soon"}}
+	}
+
+	result, err := configTyping{}.apply(configs(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, configs(), result, "reads without an expected type are left as they are")
+
+	result, err = configTyping{Type: "duration"}.apply(configs(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "soon", result.([]map[string]interface{})[0]["config_value"])
+	assert.Contains(t, result.([]map[string]interface{})[0]["parse_error"], `"soon" is not a valid duration`)
+
+	_, err = configTyping{Type: "duration", OnError: TypeErrorFail}.apply(configs(), nil)
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 422, apiErr.Status)
+	assert.Equal(t, ErrorCodeTypeMismatch, apiErr.Code)
+	assert.Equal(t, map[string]interface{}{"key": "timeout", "expected_type": "duration"}, apiErr.Details)
+
+	result, err = configTyping{Type: "int"}.apply(map[string]interface{}{"config_key": "retries", "config_value": "3"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"config_key": "retries", "config_value": int64(3)}, result)
+
+	_, err = configTyping{Type: "int"}.apply(nil, ErrConfigNotFound)
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+}
+
+func TestTypedRead(t *testing.T) {
+	api := NewAPI()
+	ctx := context.Background()
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("mysql")
+	m.On("Query", mock.Anything, queryContaining("WHERE config_key = ? AND status = 'approved'"), []interface{}{"flag"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"flag", "true"}), nil).Once()
+	m.On("Query", mock.Anything, queryContaining("WHERE config_key IN (?, ?)"), mock.Anything).
+		Return(newMockRows(t, []string{"config_key", "config_value"}), nil).Once()
+
+	req := &AllConfigOperationRequest{Operation: "read", Key: "flag", ExpectedType: "bool"}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	result, err := api.executeAllConfigOperation(ctx, m, req)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"config_key": "flag", "config_value": true}}, result)
+
+	// Defaults are typed like stored values
+	req = &AllConfigOperationRequest{Operation: "read", Key: "timeout.eu", FallbackKeys: []string{"timeout"}, DefaultValue: "2s", ExpectedType: "duration"}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	result, err = api.executeAllConfigOperation(ctx, m, req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"config_key": "timeout.eu", "config_value": 2000.0, "source": "default"}, result)
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// ConnectionInfo describes a registered connection without its credentials
+type ConnectionInfo struct {
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	Host         string            `json:"host,omitempty"`
+	Port         int               `json:"port,omitempty"`
+	Database     string            `json:"database,omitempty"`
+	URI          string            `json:"uri,omitempty"` // Password redacted
+	Labels       map[string]string `json:"labels,omitempty"`
+	Connected    bool              `json:"connected"`
+	RegisteredAt time.Time         `json:"registered_at"`
+	LastPing     *time.Time        `json:"last_ping,omitempty"`  // Last successful ping
+	Pool         *PoolStats        `json:"pool,omitempty"`       // SQL connectors only, once connected
+	Operations   *ConcurrencyStats `json:"operations,omitempty"` // Once an operation has run on the connection
+	Circuit      *BreakerStats     `json:"circuit,omitempty"`    // Once connecting has failed
+
+	LastKeepAlive  *time.Time `json:"last_keepalive,omitempty"`  // Last keepalive ping, whether it succeeded or not
+	Healthy        *bool      `json:"healthy,omitempty"`         // Whether the last keepalive ping succeeded
+	KeepAliveError string     `json:"keepalive_error,omitempty"` // Error of the last keepalive ping
+}
+
+// PoolStats summarizes a database/sql connection pool
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMS     int64 `json:"wait_duration_ms"`
+}
+
+// connectionInfo builds the description of a registry record, probing its connection within ctx
+func connectionInfo(ctx context.Context, record connectors.ConnectorRecord) ConnectionInfo {
+	info := ConnectionInfo{
+		Name:         record.Name,
+		Type:         record.Connector.GetType(),
+		Host:         record.Host,
+		Port:         record.Port,
+		Database:     record.Database,
+		URI:          record.URI,
+		Labels:       record.Labels,
+		Connected:    record.Connector.IsConnected(ctx),
+		RegisteredAt: record.RegisteredAt,
+	}
+	if !record.LastPing.IsZero() {
+		lastPing := record.LastPing
+		info.LastPing = &lastPing
+	}
+	if !record.LastKeepAlive.IsZero() {
+		lastKeepAlive := record.LastKeepAlive
+		healthy := record.KeepAliveError == ""
+		info.LastKeepAlive, info.Healthy, info.KeepAliveError = &lastKeepAlive, &healthy, record.KeepAliveError
+	}
+	if sqlConnector, ok := record.Connector.(connectors.SQLConnector); ok {
+		if db := sqlConnector.DB(); db != nil {
+			stats := db.Stats()
+			info.Pool = &PoolStats{
+				MaxOpenConnections: stats.MaxOpenConnections,
+				OpenConnections:    stats.OpenConnections,
+				InUse:              stats.InUse,
+				Idle:               stats.Idle,
+				WaitCount:          stats.WaitCount,
+				WaitDurationMS:     stats.WaitDuration.Milliseconds(),
+			}
+		}
+	}
+	return info
+}
+
+// ListConnectionsHandler lists the registered connections with their state, pool statistics and the
+// operations running and queued on them and their circuit breakers
+func (a *API) ListConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	records := a.registry.Records()
+	operations, circuits := a.operations.stats(), a.breakers.stats()
+	infos := make([]ConnectionInfo, 0, len(records))
+	for _, record := range records {
+		info := connectionInfo(r.Context(), record)
+		if stats, ok := operations[record.Name]; ok {
+			info.Operations = &stats
+		}
+		if stats, ok := circuits[record.Name]; ok {
+			info.Circuit = &stats
+		}
+		infos = append(infos, info)
+	}
+	a.sendSuccess(w, infos, fmt.Sprintf("%d connections registered", len(infos)))
+}
+
+// PingConnectionHandler connects the named connection if needed and pings it,
+// returning 503 when the ping fails
+func (a *API) PingConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, ok := a.lookupProfile(name)
+	if !ok {
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Unknown connection: %s", name))
+		return
+	}
+
+	status := a.readiness.ping(context.WithoutCancel(r.Context()), p)
+	if status.Status != "up" {
+		a.sendJSON(w, http.StatusServiceUnavailable, DatabaseResponse{
+			Success:   false,
+			Error:     status.Error,
+			ErrorCode: ErrorCodeUnavailable,
+			Data:      status,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	a.registry.MarkPinged(name)
+	a.sendSuccess(w, status, "Ping succeeded")
+}
+
+// RefreshConnectionHandler rebuilds the named connection with freshly resolved credentials and connects it,
+// as after a password rotation, closing the connection it replaces. Connections are rebuilt on their own
+// once the database rejects their credentials; this forces it.
+func (a *API) RefreshConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, ok := a.lookupProfile(name)
+	if !ok {
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Unknown connection: %s", name))
+		return
+	}
+
+	conn := startPhase(context.WithoutCancel(r.Context()), phaseConnect, a.phaseTimeouts.Connect)
+	defer conn.cancel()
+	err := conn.err(p.refresh(conn.ctx))
+	if errors.Is(err, errNotRebuildable) {
+		a.sendError(w, http.StatusConflict, ErrorCodeConflict, fmt.Sprintf("Connection %s cannot be rebuilt; it was not configured by the server", name))
+		return
+	}
+	if err != nil {
+		_, code := classifyDatabaseError(err)
+		a.sendJSON(w, http.StatusServiceUnavailable, DatabaseResponse{
+			Success:   false,
+			Error:     connectionFailureMessage(fmt.Sprintf("Rebuilding connection %s failed", name), err),
+			ErrorCode: code,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	a.sendSuccess(w, map[string]string{"name": name}, "Connection rebuilt")
+}
+
+// DeleteConnectionHandler closes the named connection and removes it from the server;
+// requests naming its profile fail afterwards
+func (a *API) DeleteConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, ok := a.removeProfile(name)
+	if !ok {
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Unknown connection: %s", name))
+		return
+	}
+
+	// Hold the profile lock so that a request connecting it concurrently finishes first
+	p.mu.Lock()
+	if p.stopListening != nil {
+		p.stopListening()
+	}
+	if p.stopKeepAlive != nil {
+		p.stopKeepAlive()
+	}
+	err := a.registry.Remove(r.Context(), name)
+	p.mu.Unlock()
+	if err != nil && !errors.Is(err, connectors.ErrConnectorNotFound) {
+		a.logger.Warn("failed to close connection", "name", name, "error", err)
+	}
+	a.sendSuccess(w, map[string]string{"name": name}, "Connection closed and removed")
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy controls which browser origins may call the API
+type CORSPolicy struct {
+	AllowedOrigins   []string // Exact origins, "*" for any, or a single "*" wildcard such as "https://*.example.com"
+	AllowedMethods   []string
+	AllowedHeaders   []string // "*" echoes whatever headers the preflight requests
+	AllowCredentials bool
+	MaxAge           time.Duration // Zero leaves preflight caching to the browser default
+}
+
+// DefaultCORSPolicy returns the permissive policy used when nothing is configured
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Request-ID", ProfileHeader, TenantHeader, UserIDHeader, UserRoleHeader, IdempotencyKeyHeader},
+	}
+}
+
+// AllowsAnyOrigin reports whether the policy accepts every origin
+func (p CORSPolicy) AllowsAnyOrigin() bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsOrigin reports whether origin matches an allowed origin exactly or by wildcard
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok {
+			lower := strings.ToLower(origin)
+			if len(lower) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(lower, strings.ToLower(prefix)) &&
+				strings.HasSuffix(lower, strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsMethod reports whether a preflight may request method
+func (p CORSPolicy) allowsMethod(method string) bool {
+	for _, allowed := range p.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedMethodsOf returns the methods of the policy among those a path may be requested with, for the
+// Access-Control-Allow-Methods of a preflight
+func (p CORSPolicy) allowedMethodsOf(pathMethods []string) []string {
+	var methods []string
+	for _, method := range p.AllowedMethods {
+		if slices.Contains(pathMethods, strings.ToUpper(method)) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// allowedHeaders returns the Access-Control-Allow-Headers value for a preflight
+func (p CORSPolicy) allowedHeaders(requested string) string {
+	for _, allowed := range p.AllowedHeaders {
+		if allowed == "*" {
+			return requested
+		}
+	}
+	return strings.Join(p.AllowedHeaders, ", ")
+}
+
+// corsResponseHeaders are the headers corsMiddleware sets on responses that are not preflights
+var corsResponseHeaders = []string{
+	"Access-Control-Allow-Origin",
+	"Access-Control-Allow-Credentials",
+	"Access-Control-Expose-Headers",
+	"Vary",
+}
+
+// corsMiddleware applies the configured CORS policy and answers preflight requests with the methods router
+// has for their path. Other OPTIONS requests are left to router.
+func (s *Server) corsMiddleware(router *Router, next http.Handler) http.Handler {
+	policy := s.api.cors
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			// Not a cross-origin request
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !policy.allowsOrigin(origin) {
+			if preflight {
+				s.api.sendError(w, http.StatusForbidden, ErrorCodeForbidden, "Origin not allowed")
+				return
+			}
+			// Serve the request without CORS headers so the browser withholds the response
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Any origin gets a literal "*", which browsers never combine with credentials: echoing the origin
+		// with credentials would let every site read responses with the user's cookies
+		if policy.AllowsAnyOrigin() {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !policy.allowsMethod(method) {
+			s.api.sendError(w, http.StatusForbidden, ErrorCodeForbidden, "Method not allowed by CORS policy")
+			return
+		}
+		pathMethods := router.Allowed(r.URL.EscapedPath())
+		if pathMethods == nil {
+			s.api.sendError(w, http.StatusNotFound, ErrorCodeNotFound, "Not found: "+r.URL.Path)
+			return
+		}
+		if !slices.Contains(pathMethods, strings.ToUpper(method)) {
+			w.Header().Set("Allow", strings.Join(pathMethods, ", "))
+			s.api.sendError(w, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.allowedMethodsOf(pathMethods), ", "))
+		if headers := policy.allowedHeaders(r.Header.Get("Access-Control-Request-Headers")); headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		if policy.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCORSHandler(policy CORSPolicy) http.Handler {
+	api := NewAPI()
+	api.cors = policy
+	return SetupRoutes(api)
+}
+
+func restrictedCORSPolicy() CORSPolicy {
+	policy := DefaultCORSPolicy()
+	policy.AllowedOrigins = []string{"https://admin.example.org", "https://*.example.com"}
+	policy.AllowCredentials = true
+	policy.MaxAge = 10 * time.Minute
+	return policy
+}
+
+func TestCORSDefaultAllowsAnyOrigin(t *testing.T) {
+	handler := newCORSHandler(DefaultCORSPolicy())
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Origin", "https://anywhere.test")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	handler := newCORSHandler(restrictedCORSPolicy())
+
+	for _, origin := range []string{"https://admin.example.org", "https://app.example.com", "https://a.b.example.com"} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, origin, rr.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, rr.Header().Values("Vary"), "Origin")
+	}
+}
+
+func TestCORSAnyOriginWithoutCredentials(t *testing.T) {
+	policy := DefaultCORSPolicy()
+	policy.AllowedOrigins = []string{"https://admin.example.org", "*"}
+	policy.AllowCredentials = true
+	handler := newCORSHandler(policy)
+
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		req := httptest.NewRequest(method, "/v1/health", nil)
+		req.Header.Set("Origin", "https://evil.test")
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"), method)
+		assert.Empty(t, rr.Header().Get("Access-Control-Allow-Credentials"), method)
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	handler := newCORSHandler(restrictedCORSPolicy())
+
+	for _, origin := range []string{"https://evil.test", "https://example.com", "http://app.example.com", "https://app.example.com.evil.test"} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, origin)
+		assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler := newCORSHandler(restrictedCORSPolicy())
+
+	req := httptest.NewRequest(http.MethodOptions, "/execute", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	// Only the methods /execute is served with, in the order of the policy
+	assert.Equal(t, "POST, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, Authorization, X-Request-ID, X-Connection-Profile, X-Tenant-ID, X-User-ID, X-User-Role, Idempotency-Key", rr.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+
+	// Disallowed method
+	req = httptest.NewRequest(http.MethodOptions, "/execute", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Methods"))
+
+	// Disallowed origin
+	req = httptest.NewRequest(http.MethodOptions, "/execute", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSWildcardHeaders(t *testing.T) {
+	policy := DefaultCORSPolicy()
+	policy.AllowedHeaders = []string{"*"}
+	handler := newCORSHandler(policy)
+
+	req := httptest.NewRequest(http.MethodOptions, "/execute", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-Api-Key, Content-Type")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "X-Api-Key, Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, rr.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSPreflightRouteMethods(t *testing.T) {
+	handler := newCORSHandler(restrictedCORSPolicy())
+	preflight := func(path, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", method)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := preflight("/v1/jobs/abc", http.MethodDelete)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "GET, DELETE, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+	rr = preflight("/v1/configs/feature.flag/", http.MethodPut)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "GET, PUT, DELETE, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+
+	// Allowed by the policy but not served on the path
+	rr = preflight("/execute", http.MethodGet)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "OPTIONS, POST", rr.Header().Get("Allow"))
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Methods"))
+
+	rr = preflight("/v1/unknown", http.MethodPost)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Methods"))
+
+	// OPTIONS without a preflight is answered by the route
+	req := httptest.NewRequest(http.MethodOptions, "/v1/health", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"db-connectors/connectors"
+)
+
+// ClearedTable is the result of drop_table, direct_delete_all and truncate_approvals
+type ClearedTable struct {
+	Table   string `json:"table"`
+	Deleted int64  `json:"deleted"`           // Rows (SQL) or documents (MongoDB) removed
+	Dropped *bool  `json:"dropped,omitempty"` // drop_table: whether the table existed
+}
+
+// checkConfirm requires the operations clearing or dropping a table to name the allconfig table in confirm,
+// so a request sent to the wrong table or with a mistyped operation removes nothing. Dry runs need it too,
+// as they preview the request they are given.
+func checkConfirm(req *AllConfigOperationRequest, spec *operationSpec) error {
+	if !spec.Confirms || req.Confirm == req.TableName {
+		return nil
+	}
+	message := fmt.Sprintf("%s removes the data of table %s: set confirm to %q to run it", spec.Name, req.TableName, req.TableName)
+	if req.Confirm != "" {
+		message = fmt.Sprintf("confirm %q does not match table %s that %s would clear", req.Confirm, req.TableName, spec.Name)
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: message,
+		Details: map[string]interface{}{"operation": spec.Name, "table": req.TableName, "confirm": req.Confirm},
+	}
+}
+
+// deleteAllRows deletes every row (SQL) or document (MongoDB) of a table, counting them from the result
+func deleteAllRows(ctx context.Context, connector connectors.DBConnector, tableName string) (int64, error) {
+	var result interface{}
+	var err error
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		result, err = connector.Execute(ctx, "execute", map[string]interface{}{
+			"query": "DELETE FROM " + sqlTable(ctx, tableName),
+		})
+	case "mongodb":
+		result, err = connector.Execute(ctx, "deleteMany", map[string]interface{}{
+			"collection": tableName,
+			"filter":     map[string]interface{}{},
+		})
+	default:
+		return 0, fmt.Errorf("unsupported database type")
+	}
+	if err != nil {
+		return 0, err
+	}
+	deleted, _ := affectedCount(result)
+	return deleted, nil
+}
+
+// truncateApprovals deletes the whole approval history of an allconfig table, pending requests included
+func (a *API) truncateApprovals(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
+	approvalTable := a.approvalTable(tableName)
+	deleted, err := deleteAllRows(ctx, connector, approvalTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to truncate approval requests: %w", err)
+	}
+	cleared := &ClearedTable{Table: approvalTable, Deleted: deleted}
+	a.logClearedTable(ctx, connector, "truncate_approvals", cleared)
+	return cleared, nil
+}
+
+// logClearedTable records a table cleared or dropped at warn level, which the request log alone would
+// report as any other allconfig operation. Dry runs are not logged.
+func (a *API) logClearedTable(ctx context.Context, connector connectors.DBConnector, operation string, cleared *ClearedTable) {
+	if _, dryRun := connector.(*dryRunConnector); dryRun {
+		return
+	}
+	attrs := []interface{}{"operation", operation, "table", cleared.Table, "deleted", cleared.Deleted, "database_type", connector.GetType()}
+	if cleared.Dropped != nil {
+		attrs = append(attrs, "dropped", *cleared.Dropped)
+	}
+	a.logger.WarnContext(ctx, "allconfig table cleared", attrs...)
+}
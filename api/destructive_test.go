@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+	"db-connectors/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClearingNeedsConfirm(t *testing.T) {
+	for _, operation := range []string{"drop_table", "direct_delete_all", "delete_all", "truncate_approvals"} {
+		for _, confirm := range []string{"", "settings", "ALLCONFIG"} {
+			conn := newServiceConnector("mysql")
+			req := &AllConfigOperationRequest{Operation: operation, Confirm: confirm}
+			req.TableName = "allconfig"
+			req.LegacyMode = boolPtr(false)
+
+			_, err := NewAPI().executeAllConfigOperation(context.Background(), conn, req)
+			var apiErr *apiError
+			require.ErrorAs(t, err, &apiErr, "%s with confirm %q", operation, confirm)
+			assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+			assert.Equal(t, "allconfig", apiErr.Details["table"])
+			conn.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything)
+			conn.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+		}
+	}
+
+	_, err := checkAllConfigOperation(&AllConfigOperationRequest{Operation: "drop_table", AllConfigRequest: AllConfigRequest{TableName: "allconfig"}}, "mysql")
+	assert.EqualError(t, err, `drop_table removes the data of table allconfig: set confirm to "allconfig" to run it`)
+	_, err = checkAllConfigOperation(&AllConfigOperationRequest{Operation: "delete_all", Confirm: "settings", AllConfigRequest: AllConfigRequest{TableName: "allconfig"}}, "mysql")
+	assert.EqualError(t, err, `confirm "settings" does not match table allconfig that direct_delete_all would clear`)
+
+	// Other operations ignore confirm
+	_, err = checkAllConfigOperation(&AllConfigOperationRequest{Operation: "read_all", AllConfigRequest: AllConfigRequest{TableName: "allconfig"}}, "mysql")
+	assert.NoError(t, err)
+}
+
+func TestClearedTableCounts(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	api := NewAPI()
+	api.logger = logging.New(logging.Options{Level: "info", Format: logging.FormatJSON, Output: &buf})
+	run := func(conn *connectortest.MockDBConnector, operation string) *ClearedTable {
+		t.Helper()
+		req := &AllConfigOperationRequest{Operation: operation, Confirm: "allconfig"}
+		req.TableName = "allconfig"
+		req.LegacyMode = boolPtr(false)
+		result, err := api.executeAllConfigOperation(ctx, conn, req)
+		require.NoError(t, err, operation)
+		conn.AssertExpectations(t)
+		return result.(*ClearedTable)
+	}
+	exists := true
+
+	conn := newServiceConnector("mysql")
+	conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": "DELETE FROM allconfig"}).Return(driver.RowsAffected(12), nil).Once()
+	assert.Equal(t, &ClearedTable{Table: "allconfig", Deleted: 12}, run(conn, "delete_all"))
+
+	conn = newServiceConnector("postgresql")
+	conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": "DELETE FROM allconfig_approval_requests"}).Return(driver.RowsAffected(30), nil).Once()
+	assert.Equal(t, &ClearedTable{Table: "allconfig_approval_requests", Deleted: 30}, run(conn, "truncate_approvals"))
+
+	// drop_table counts the configs before dropping the table
+	conn = newServiceConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("information_schema.tables"), mock.Anything).
+		Return(newMockRows(t, []string{"table_schema", "table_name", "table_type"}, []driver.Value{"app", "allconfig", "BASE TABLE"}), nil).Once()
+	conn.On("Query", mock.Anything, "SELECT COUNT(*) FROM allconfig", []interface{}(nil)).
+		Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{7}), nil).Once()
+	conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": "DROP TABLE IF EXISTS allconfig"}).Return(driver.RowsAffected(0), nil).Once()
+	assert.Equal(t, &ClearedTable{Table: "allconfig", Deleted: 7, Dropped: &exists}, run(conn, "drop_table"))
+
+	conn = newServiceConnector("mongodb")
+	conn.On("Execute", mock.Anything, "deleteMany", map[string]interface{}{"collection": "allconfig", "filter": map[string]interface{}{}}).
+		Return(&mongo.DeleteResult{DeletedCount: 4}, nil).Once()
+	assert.Equal(t, &ClearedTable{Table: "allconfig", Deleted: 4}, run(conn, "direct_delete_all"))
+
+	conn = newServiceConnector("mongodb")
+	conn.On("Execute", mock.Anything, "deleteMany", map[string]interface{}{"collection": "allconfig_approval_requests", "filter": map[string]interface{}{}}).
+		Return(&mongo.DeleteResult{DeletedCount: 9}, nil).Once()
+	assert.Equal(t, &ClearedTable{Table: "allconfig_approval_requests", Deleted: 9}, run(conn, "truncate_approvals"))
+
+	// A missing collection is reported as not dropped
+	conn = newServiceConnector("mongodb")
+	conn.On("Execute", mock.Anything, "listCollections", mock.Anything).Return([]map[string]interface{}{}, nil).Once()
+	conn.On("Execute", mock.Anything, "drop", map[string]interface{}{"collection": "allconfig"}).Return(nil, nil).Once()
+	missing := false
+	assert.Equal(t, &ClearedTable{Table: "allconfig", Dropped: &missing}, run(conn, "drop_table"))
+
+	// Each is logged at warn level with what it removed
+	decoder := json.NewDecoder(&buf)
+	var operations []string
+	for decoder.More() {
+		var record map[string]interface{}
+		require.NoError(t, decoder.Decode(&record))
+		assert.Equal(t, "WARN", record["level"])
+		assert.Equal(t, "allconfig table cleared", record["msg"])
+		assert.Contains(t, record, "deleted")
+		operations = append(operations, record["operation"].(string))
+	}
+	assert.Equal(t, []string{"direct_delete_all", "truncate_approvals", "drop_table", "direct_delete_all", "truncate_approvals", "drop_table"}, operations)
+}
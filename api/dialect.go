@@ -0,0 +1,24 @@
+package api
+
+import (
+	"db-connectors/connectors"
+)
+
+// sqlDialect returns the SQL dialect of a connector, or nil for databases that do not speak SQL. Connectors
+// that wrap another, such as dry runs, speak the dialect of their database type.
+func sqlDialect(connector connectors.DBConnector) connectors.Dialect {
+	if c, ok := connector.(interface{ Dialect() connectors.Dialect }); ok {
+		return c.Dialect()
+	}
+	d, _ := connectors.DialectFor(connector.GetType())
+	return d
+}
+
+// pageQuery appends the dialect's LIMIT and OFFSET clause to a SELECT, leaving it unpaged when limit is
+// not positive
+func pageQuery(d connectors.Dialect, query string, limit, offset int) string {
+	if clause := d.LimitOffset(limit, offset); clause != "" {
+		return query + " " + clause
+	}
+	return query
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statementConnector records the SQL of every statement it runs, with whitespace collapsed, answering
+// counts with one and other queries with no rows
+type statementConnector struct {
+	connectortest.MockDBConnector
+	t          *testing.T
+	dbType     string
+	statements []string
+}
+
+func (c *statementConnector) GetType() string { return c.dbType }
+
+func (c *statementConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.statements = append(c.statements, strings.Join(strings.Fields(query), " "))
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		return newMockRows(c.t, []string{"count"}, []driver.Value{int64(1)}), nil
+	}
+	return newMockRows(c.t, []string{"config_key"}), nil
+}
+
+func (c *statementConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	c.statements = append(c.statements, strings.Join(strings.Fields(params["query"].(string)), " "))
+	return sqlmock.NewResult(0, 1), nil
+}
+
+func TestDialectStatements(t *testing.T) {
+	api := NewAPI()
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		run       func(conn *statementConnector)
+		mysql     string
+		postgres  string
+		paginated bool // Statements end in the page clause of limit 10, offset 20
+	}{
+		{
+			name:     "get",
+			run:      func(conn *statementConnector) { api.getConfig(ctx, conn, "allconfig", "k") },
+			mysql:    "SELECT config_key, config_value, description, tags, created_at, updated_at FROM allconfig WHERE config_key = ?",
+			postgres: "SELECT config_key, config_value, description, tags, created_at, updated_at FROM allconfig WHERE config_key = $1",
+		},
+		{
+			name: "set",
+			run:  func(conn *statementConnector) { api.setConfig(ctx, conn, "allconfig", "k", "v") },
+			mysql: "INSERT INTO allconfig (config_key, config_value, created_at, updated_at) VALUES (?, ?, NOW(), NOW()) " +
+				"ON DUPLICATE KEY UPDATE config_value = VALUES(config_value), updated_at = NOW()",
+			postgres: "INSERT INTO allconfig (config_key, config_value, created_at, updated_at) VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) " +
+				"ON CONFLICT (config_key) DO UPDATE SET config_value = EXCLUDED.config_value, updated_at = CURRENT_TIMESTAMP",
+		},
+		{
+			name:     "update",
+			run:      func(conn *statementConnector) { api.updateConfig(ctx, conn, "allconfig", "k", "v", "d") },
+			mysql:    "UPDATE allconfig SET config_value = ?, description = ?, updated_at = NOW() WHERE config_key = ?",
+			postgres: "UPDATE allconfig SET config_value = $1, description = $2, updated_at = CURRENT_TIMESTAMP WHERE config_key = $3",
+		},
+		{
+			name:     "exists",
+			run:      func(conn *statementConnector) { api.configExistsApproved(ctx, conn, "allconfig", "k") },
+			mysql:    "SELECT COUNT(*) FROM allconfig WHERE config_key = ? AND status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP())",
+			postgres: "SELECT COUNT(*) FROM allconfig WHERE config_key = $1 AND status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'))",
+		},
+		{
+			name: "direct create",
+			run: func(conn *statementConnector) {
+				api.createConfigDirect(ctx, conn, "allconfig", "k", "v", "d", nil, nil, "alice")
+			},
+			mysql: "INSERT INTO allconfig (config_key, config_value, description, tags, status, maker_id, created_at, updated_at, approved_at) " +
+				"VALUES (?, ?, ?, ?, 'approved', ?, NOW(), NOW(), NOW())",
+			postgres: "INSERT INTO allconfig (config_key, config_value, description, tags, status, maker_id, created_at, updated_at, approved_at) " +
+				"VALUES ($1, $2, $3, $4, 'approved', $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) RETURNING created_at, updated_at, approved_at",
+		},
+		{
+			name: "direct update",
+			run: func(conn *statementConnector) {
+				api.updateConfigDirect(ctx, conn, "allconfig", "k", "v", "d", nil, nil, "alice")
+			},
+			mysql: "UPDATE allconfig SET config_value = ?, description = ?, status = 'approved', maker_id = ?, tags = COALESCE(?, tags), " +
+				"updated_at = NOW(), approved_at = NOW() WHERE config_key = ?",
+			postgres: "UPDATE allconfig SET config_value = $1, description = $2, status = 'approved', maker_id = $3, tags = COALESCE($4, tags), " +
+				"updated_at = CURRENT_TIMESTAMP, approved_at = CURRENT_TIMESTAMP WHERE config_key = $5 RETURNING created_at, updated_at, approved_at",
+		},
+		{
+			name:     "direct delete",
+			run:      func(conn *statementConnector) { api.deleteConfigDirect(ctx, conn, "allconfig", "k", "alice") },
+			mysql:    "DELETE FROM allconfig WHERE config_key = ?",
+			postgres: "DELETE FROM allconfig WHERE config_key = $1",
+		},
+		{
+			name: "submit",
+			run: func(conn *statementConnector) {
+				api.submitConfigForApproval(ctx, conn, "req-1", allconfig.SubmitRequest{
+					Table: "allconfig", Operation: allconfig.OperationCreate, Key: "k", Value: "v", Description: "d", MakerID: "bob",
+				})
+			},
+			mysql: "INSERT INTO allconfig_approval_requests (request_id, config_key, config_value, description, operation, maker_id, status, requested_at, previous_value, tags) " +
+				"VALUES (?, ?, ?, ?, ?, ?, 'pending', NOW(), ?, ?)",
+			postgres: "INSERT INTO allconfig_approval_requests (request_id, config_key, config_value, description, operation, maker_id, status, requested_at, previous_value, tags) " +
+				"VALUES ($1, $2, $3, $4, $5, $6, 'pending', CURRENT_TIMESTAMP, $7, $8)",
+		},
+		{
+			name: "decide",
+			run: func(conn *statementConnector) {
+				api.updateApprovalRequestStatus(ctx, conn, "allconfig", "req-1", "approved", "carol", "")
+			},
+			mysql: "UPDATE allconfig_approval_requests SET status = ?, checker_id = ?, approval_comment = ?, processed_at = NOW() " +
+				"WHERE request_id = ? AND status = 'pending'",
+			postgres: "UPDATE allconfig_approval_requests SET status = $1, checker_id = $2, approval_comment = $3, processed_at = CURRENT_TIMESTAMP " +
+				"WHERE request_id = $4 AND status = 'pending'",
+		},
+		{
+			name:      "my requests",
+			run:       func(conn *statementConnector) { api.getMyRequests(ctx, conn, "allconfig", "bob", 10, 20) },
+			mysql:     "WHERE maker_id = ? ORDER BY requested_at DESC LIMIT 10 OFFSET 20",
+			postgres:  "WHERE maker_id = $1 ORDER BY requested_at DESC LIMIT 10 OFFSET 20",
+			paginated: true,
+		},
+		{
+			name:      "read all",
+			run:       func(conn *statementConnector) { api.readAllApprovedConfigs(ctx, conn, "allconfig", 10, 0) },
+			mysql:     "WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP()) ORDER BY config_key LIMIT 10",
+			postgres:  "WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) ORDER BY config_key LIMIT 10",
+			paginated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		for dbType, want := range map[string]string{"mysql": tt.mysql, "postgresql": tt.postgres} {
+			t.Run(dbType+" "+tt.name, func(t *testing.T) {
+				conn := &statementConnector{t: t, dbType: dbType}
+				tt.run(conn)
+				require.NotEmpty(t, conn.statements)
+				if tt.paginated {
+					assert.True(t, strings.HasSuffix(conn.statements[0], want), conn.statements[0])
+					return
+				}
+				assert.Equal(t, want, conn.statements[0])
+			})
+		}
+	}
+}
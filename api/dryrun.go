@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AllConfigDryRun is the result of an allconfig operation run with dry_run
+type AllConfigDryRun struct {
+	DryRun    bool                   `json:"dry_run"`
+	Operation string                 `json:"operation"`
+	Writes    []PlannedWrite         `json:"writes"`            // Writes the operation would execute, in order
+	Affected  int64                  `json:"affected"`          // Rows or documents the writes would affect in total
+	Current   map[string]interface{} `json:"current,omitempty"` // Stored config of each key written, null when missing
+	Result    interface{}            `json:"result,omitempty"`  // What the operation would report, such as per-key batch results
+}
+
+// PlannedWrite is a statement (SQL) or command (MongoDB) a dry run did not execute
+type PlannedWrite struct {
+	Operation string                 `json:"operation"`
+	Params    map[string]interface{} `json:"params"`   // The query and args, or the collection, filter and document
+	Affected  int64                  `json:"affected"` // Rows or documents the write would affect
+}
+
+// dryRunConnector passes reads through to the connector and records writes, with the rows or documents
+// they would affect, instead of executing them
+type dryRunConnector struct {
+	connectors.DBConnector
+	api    *API
+	schema string // Schema tables are looked up in, see tableSchema
+	writes []PlannedWrite
+}
+
+// Execute runs read operations and records any other operation with its estimated effect, returning
+// a result reporting that effect like the driver would
+func (c *dryRunConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	if spec := lookupOperation(executeOperationSpecs, operation, c.GetType()); spec != nil && !spec.Mutates {
+		return c.DBConnector.Execute(ctx, operation, params)
+	}
+
+	var affected int64
+	var err error
+	if c.GetType() == "mongodb" {
+		affected, err = c.estimateDocuments(ctx, operation, params)
+	} else {
+		affected, err = c.estimateRows(ctx, params)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate the effect of %s: %w", operation, err)
+	}
+	c.writes = append(c.writes, PlannedWrite{Operation: operation, Params: params, Affected: affected})
+
+	switch operation {
+	case "update", "updateMany", "upsert":
+		return &mongo.UpdateResult{MatchedCount: affected, ModifiedCount: affected}, nil
+	case "delete", "deleteMany":
+		if c.GetType() == "mongodb" {
+			return &mongo.DeleteResult{DeletedCount: affected}, nil
+		}
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+var (
+	deleteStatement     = regexp.MustCompile(`(?is)^\s*DELETE\s+FROM\s+(\S+)(?:\s+WHERE\s+(.+?))?\s*;?\s*$`)
+	updateStatement     = regexp.MustCompile(`(?is)^\s*UPDATE\s+(\S+)\s+SET\s+.+\s+WHERE\s+(.+?)\s*;?\s*$`)
+	dropTableStatement  = regexp.MustCompile(`(?is)^\s*DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?(\S+?)\s*;?\s*$`)
+	insertStatement     = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s`)
+	valuesKeyword       = regexp.MustCompile(`(?i)\bVALUES\s*`)
+	postgresPlaceholder = regexp.MustCompile(`\$(\d+)`)
+)
+
+// estimateRows counts the rows a statement would affect by rewriting the UPDATE, DELETE and DROP TABLE
+// statements of the allconfig operations into a SELECT COUNT(*) over the same rows. An INSERT affects
+// the row it inserts.
+func (c *dryRunConnector) estimateRows(ctx context.Context, params map[string]interface{}) (int64, error) {
+	query, _ := params["query"].(string)
+	args, _ := params["args"].([]interface{})
+
+	var table, where string
+	switch {
+	case insertStatement.MatchString(query):
+		return insertedRows(query), nil
+	case deleteStatement.MatchString(query):
+		match := deleteStatement.FindStringSubmatch(query)
+		table, where = match[1], match[2]
+	case updateStatement.MatchString(query):
+		match := updateStatement.FindStringSubmatch(query)
+		table, where = match[1], match[2]
+	case dropTableStatement.MatchString(query):
+		table = dropTableStatement.FindStringSubmatch(query)[1]
+		// The statement names the table qualified with its schema, which the existence check takes apart
+		exists, err := c.api.checkTableExists(ctx, c.DBConnector, c.schema, table[strings.LastIndex(table, ".")+1:])
+		if err != nil || !exists {
+			return 0, err
+		}
+		args = nil
+	default:
+		return 0, fmt.Errorf("cannot preview statement: %s", strings.TrimSpace(query))
+	}
+
+	count := "SELECT COUNT(*) FROM " + table
+	if where != "" {
+		where, args = whereArgs(c.GetType(), where, args)
+		count += " WHERE " + where
+	}
+	rows, err := c.Query(ctx, count, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var affected int64
+	if rows.Next() {
+		if err := rows.Scan(&affected); err != nil {
+			return 0, err
+		}
+	}
+	return affected, rows.Err()
+}
+
+// insertedRows counts the rows of the VALUES list of an INSERT, at least one
+func insertedRows(query string) int64 {
+	values := valuesKeyword.FindStringIndex(query)
+	if values == nil {
+		return 1
+	}
+
+	var rows int64
+	depth, quoted := 0, false
+	for _, c := range query[values[1]:] {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			if depth == 0 {
+				rows++
+			}
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && c != ',' && !unicode.IsSpace(c):
+			// The list ends at the first clause following it, such as ON DUPLICATE KEY UPDATE
+			return max(rows, 1)
+		}
+	}
+	return max(rows, 1)
+}
+
+// whereArgs returns the WHERE clause of a statement with the args it references, the trailing args for
+// MySQL placeholders and the numbered ones, renumbered from $1, for PostgreSQL
+func whereArgs(dbType, where string, args []interface{}) (string, []interface{}) {
+	if dbType != "postgresql" {
+		n := strings.Count(where, "?")
+		if n > len(args) {
+			n = len(args)
+		}
+		return where, args[len(args)-n:]
+	}
+
+	var whereArgs []interface{}
+	where = postgresPlaceholder.ReplaceAllStringFunc(where, func(placeholder string) string {
+		var i int
+		fmt.Sscanf(placeholder, "$%d", &i)
+		if i < 1 || i > len(args) {
+			return placeholder
+		}
+		whereArgs = append(whereArgs, args[i-1])
+		return fmt.Sprintf("$%d", len(whereArgs))
+	})
+	return where, whereArgs
+}
+
+// estimateDocuments counts the documents a MongoDB command would affect with CountDocuments on its filter
+func (c *dryRunConnector) estimateDocuments(ctx context.Context, operation string, params map[string]interface{}) (int64, error) {
+	switch operation {
+	case "insert":
+		return 1, nil
+	case "insertMany":
+		if documents := reflect.ValueOf(params["documents"]); documents.Kind() == reflect.Slice {
+			return int64(documents.Len()), nil
+		}
+		return 0, nil
+	case "bulkWrite":
+		// Each upsert of the allconfig batches writes one document
+		if operations, ok := params["operations"].([]interface{}); ok {
+			return int64(len(operations)), nil
+		}
+		return 0, nil
+	case "update", "updateMany", "upsert", "delete", "deleteMany", "drop":
+	default:
+		return 0, nil
+	}
+
+	filter := params["filter"]
+	if filter == nil {
+		filter = map[string]interface{}{}
+	}
+	result, err := c.DBConnector.Execute(ctx, "count", map[string]interface{}{"collection": params["collection"], "filter": filter})
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	switch n := result.(type) {
+	case int64:
+		count = n
+	case int:
+		count = int64(n)
+	}
+	switch {
+	case operation == "upsert":
+		// An upsert updates the first match or inserts a document
+		return 1, nil
+	case (operation == "update" || operation == "delete") && count > 1:
+		return 1, nil
+	}
+	return count, nil
+}
+
+// dryRunAllConfigOperation runs an allconfig operation against a dryRunConnector, so the existence checks
+// and lookups run as usual while the writes are only reported
+func (a *API) dryRunAllConfigOperation(ctx context.Context, connector connectors.DBConnector, req *AllConfigOperationRequest) (interface{}, error) {
+	current, err := a.currentConfigs(ctx, connector, req)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun := &dryRunConnector{DBConnector: connector, api: a, schema: req.tableSchema()}
+	// Items are previewed one at a time, outside any transaction, as the connector records writes in order
+	preview := *req
+	preview.DryRun = false
+	preview.Concurrency = 0
+	preview.Atomic = false
+	if req.Atomic {
+		stopOnError := false
+		preview.ContinueOnError = &stopOnError
+	}
+	result, err := a.executeAllConfigOperation(ctx, dryRun, &preview)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AllConfigDryRun{
+		DryRun:    true,
+		Operation: req.Operation,
+		Writes:    dryRun.writes,
+		Current:   current,
+		Result:    result,
+	}
+	if response.Writes == nil {
+		response.Writes = []PlannedWrite{}
+	}
+	for _, write := range dryRun.writes {
+		response.Affected += write.Affected
+	}
+	return response, nil
+}
+
+// currentConfigs looks up the stored config of every key the operation writes, mapping missing keys to nil
+func (a *API) currentConfigs(ctx context.Context, connector connectors.DBConnector, req *AllConfigOperationRequest) (map[string]interface{}, error) {
+	var keys []string
+	if req.Key != "" {
+		keys = append(keys, req.Key)
+	}
+	for _, item := range req.ConfigItems {
+		keys = append(keys, item.Key)
+	}
+	if len(req.ConfigItems) == 0 {
+		for key := range req.Configs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	current := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		config, err := a.getConfig(ctx, connector, req.TableName, key)
+		if errors.Is(err, ErrConfigNotFound) {
+			current[key] = nil
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up config %s: %w", key, err)
+		}
+		current[key], _ = allconfig.FirstConfig(config)
+	}
+	return current, nil
+}
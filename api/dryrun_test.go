@@ -0,0 +1,246 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// assertNothingWritten checks that no write reached the connector
+func assertNothingWritten(t *testing.T, conn *connectortest.MockDBConnector) {
+	for _, operation := range []string{"execute", "insert", "update", "delete", "deleteMany", "upsert", "drop"} {
+		conn.AssertNotCalled(t, "Execute", mock.Anything, operation, mock.Anything)
+	}
+}
+
+func TestDryRunAllConfigOperation(t *testing.T) {
+	configColumns := []string{"config_key", "config_value", "description", "created_at", "updated_at"}
+	countRows := func(t *testing.T, count int) interface{} {
+		return newMockRows(t, []string{"COUNT(*)"}, []driver.Value{count})
+	}
+
+	tests := []struct {
+		name     string
+		dbType   string
+		req      AllConfigOperationRequest
+		setup    func(t *testing.T, conn *connectortest.MockDBConnector)
+		err      error
+		writes   []string // Query (SQL) or operation (MongoDB) of each planned write
+		affected int64
+		current  map[string]interface{}
+	}{
+		{
+			name:   "mysql update",
+			dbType: "mysql",
+			req:    AllConfigOperationRequest{Operation: "direct_update", Key: "feature.flag", Value: "off"},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				conn.On("Query", mock.Anything, queryContaining("SELECT config_key, config_value"), []interface{}{"feature.flag"}).
+					Return(newMockRows(t, configColumns, []driver.Value{"feature.flag", "on", "", nil, nil}), nil)
+				conn.On("Query", mock.Anything, "SELECT COUNT(*) FROM allconfig WHERE config_key = ?", []interface{}{"feature.flag"}).
+					Return(countRows(t, 1), nil)
+			},
+			writes:   []string{"UPDATE allconfig SET config_value = ?, description = ?, status = 'approved', maker_id = ?, tags = COALESCE(?, tags), updated_at = NOW(), approved_at = NOW() WHERE config_key = ?"},
+			affected: 1,
+			current: map[string]interface{}{"feature.flag": map[string]interface{}{
+				"config_key": "feature.flag", "config_value": "on", "description": "", "created_at": nil, "updated_at": nil,
+			}},
+		},
+		{
+			name:   "postgresql update renumbers the WHERE placeholders",
+			dbType: "postgresql",
+			req:    AllConfigOperationRequest{Operation: "update", Key: "feature.flag", Value: "off"},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				conn.On("Query", mock.Anything, queryContaining("SELECT config_key, config_value"), mock.Anything).
+					Return(newMockRows(t, configColumns, []driver.Value{"feature.flag", "on", "", nil, nil}), nil)
+				conn.On("Query", mock.Anything, "SELECT COUNT(*) FROM allconfig WHERE config_key = $1", []interface{}{"feature.flag"}).
+					Return(countRows(t, 1), nil)
+			},
+			writes:   []string{"UPDATE allconfig SET config_value = $1, description = $2, status = 'approved', maker_id = $3, tags = COALESCE($4, tags), updated_at = CURRENT_TIMESTAMP, approved_at = CURRENT_TIMESTAMP WHERE config_key = $5"},
+			affected: 1,
+		},
+		{
+			name:   "postgresql delete of a missing key",
+			dbType: "postgresql",
+			req:    AllConfigOperationRequest{Operation: "direct_delete", Key: "missing"},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				conn.On("Query", mock.Anything, queryContaining("SELECT config_key, config_value"), mock.Anything).
+					Return(newMockRows(t, configColumns), nil)
+				conn.On("Query", mock.Anything, "SELECT COUNT(*) FROM allconfig WHERE config_key = $1", []interface{}{"missing"}).
+					Return(countRows(t, 0), nil)
+			},
+			err: ErrConfigNotFound,
+		},
+		{
+			name:   "mysql submit",
+			dbType: "mysql",
+			req:    AllConfigOperationRequest{Operation: "submit_delete", Key: "feature.flag", MakerID: "bob"},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				conn.On("Query", mock.Anything, queryContaining("SELECT config_key, config_value"), mock.Anything).
+					Return(newMockRows(t, configColumns, []driver.Value{"feature.flag", "on", "", nil, nil}), nil)
+			},
+			writes:   []string{"INSERT"},
+			affected: 1,
+		},
+		{
+			name:   "mysql drop table",
+			dbType: "mysql",
+			req:    AllConfigOperationRequest{Operation: "drop_table", Confirm: "allconfig"},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				// Looked up by drop_table to report what it removes, then by the estimate of the DROP
+				for i := 0; i < 2; i++ {
+					conn.On("Query", mock.Anything, queryContaining("information_schema.tables"), mock.Anything).
+						Return(newMockRows(t, []string{"table_schema", "table_name", "table_type"}, []driver.Value{"app", "allconfig", "BASE TABLE"}), nil).Once()
+					conn.On("Query", mock.Anything, "SELECT COUNT(*) FROM allconfig", []interface{}(nil)).Return(countRows(t, 7), nil).Once()
+				}
+			},
+			writes:   []string{"DROP TABLE IF EXISTS allconfig"},
+			affected: 7,
+		},
+		{
+			name:   "mongodb delete all",
+			dbType: "mongodb",
+			req:    AllConfigOperationRequest{Operation: "direct_delete_all", Confirm: "allconfig"},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				conn.On("Execute", mock.Anything, "count", map[string]interface{}{"collection": "allconfig", "filter": map[string]interface{}{}}).
+					Return(int64(5), nil)
+			},
+			writes:   []string{"deleteMany"},
+			affected: 5,
+		},
+		{
+			name:   "mongodb create of an existing key",
+			dbType: "mongodb",
+			req:    AllConfigOperationRequest{Operation: "direct_create", Key: "feature.flag", Value: "on"},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(map[string]interface{}{"config_key": "feature.flag"}, nil)
+				conn.On("Execute", mock.Anything, "count", mock.Anything).Return(int64(1), nil)
+			},
+			err: ErrConfigExists,
+		},
+		{
+			name:   "mongodb update batch",
+			dbType: "mongodb",
+			req: AllConfigOperationRequest{Operation: "direct_update_batch", ConfigItems: []ConfigItem{
+				{Key: "feature.flag", Value: "off"}, {Key: "missing", Value: "on"},
+			}},
+			setup: func(t *testing.T, conn *connectortest.MockDBConnector) {
+				conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(nil, connectors.ErrNotFound)
+				conn.On("Execute", mock.Anything, "count", map[string]interface{}{
+					"collection": "allconfig", "filter": map[string]interface{}{"config_key": "feature.flag"},
+				}).Return(int64(1), nil)
+				conn.On("Execute", mock.Anything, "count", mock.Anything).Return(int64(0), nil)
+			},
+			writes:   []string{"update", "update"},
+			affected: 1,
+			current:  map[string]interface{}{"feature.flag": nil, "missing": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newServiceConnector(tt.dbType)
+			tt.setup(t, conn)
+			req := tt.req
+			req.TableName = "allconfig"
+			req.DryRun = true
+			req.LegacyMode = boolPtr(false)
+
+			result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, &req)
+			assertNothingWritten(t, conn)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			dryRun := result.(*AllConfigDryRun)
+			assert.True(t, dryRun.DryRun)
+			assert.Equal(t, tt.affected, dryRun.Affected)
+			require.Len(t, dryRun.Writes, len(tt.writes))
+			for i, write := range dryRun.Writes {
+				if query, ok := write.Params["query"].(string); ok {
+					assert.Contains(t, query, tt.writes[i])
+				} else {
+					assert.Equal(t, tt.writes[i], write.Operation)
+				}
+			}
+			if tt.current != nil {
+				assert.Equal(t, tt.current, dryRun.Current)
+			}
+		})
+	}
+}
+
+func TestDryRunBatchReportsItemErrors(t *testing.T) {
+	conn := newServiceConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("SELECT config_key, config_value"), mock.Anything).
+		Return(newMockRows(t, []string{"config_key"}), nil).Once()
+	conn.On("Query", mock.Anything, queryContaining("SELECT config_key, config_value"), mock.Anything).
+		Return(newMockRows(t, []string{"config_key"}), nil).Once()
+	conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), []interface{}{"taken"}).
+		Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{1}), nil)
+	conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), []interface{}{"new"}).
+		Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{0}), nil)
+
+	req := AllConfigOperationRequest{Operation: "direct_create_batch", DryRun: true, ConfigItems: []ConfigItem{
+		{Key: "taken", Value: "on"}, {Key: "new", Value: "on"},
+	}}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, &req)
+	require.NoError(t, err)
+	assertNothingWritten(t, conn)
+
+	dryRun := result.(*AllConfigDryRun)
+	require.Len(t, dryRun.Writes, 1)
+	assert.Equal(t, []interface{}{"new", "on", "", nil, ""}, dryRun.Writes[0].Params["args"])
+	items := dryRun.Result.(*ConfigBatchResult).Items
+	assert.Equal(t, ConfigItemFailed, items[0].Status)
+	assert.Equal(t, ErrorCodeConflict, items[0].ErrorCode)
+	assert.Equal(t, ConfigItemSucceeded, items[1].Status)
+}
+
+func TestDryRunUnsupportedOperation(t *testing.T) {
+	req := AllConfigOperationRequest{Operation: "approve_request", RequestID: "req-1", CheckerID: "alice", DryRun: true}
+	_, err := checkAllConfigOperation(&req, "mysql")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeUnsupportedOperation, apiErr.Code)
+	assert.Equal(t, dryRunOperations, apiErr.Details["supported"])
+	assert.Contains(t, dryRunOperations, "delete_all")
+	assert.NotContains(t, dryRunOperations, "read")
+
+	// Rejected before connecting, so the unresolvable host is never reached
+	body, err := json.Marshal(map[string]interface{}{
+		"type": "mysql", "host": "db.invalid", "port": 3306, "database": "app",
+		"operation": "create_table", "dry_run": true,
+	})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	SetupRoutes(NewAPI()).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/allconfig-operation", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeUnsupportedOperation, response.ErrorCode)
+}
+
+func TestWhereArgs(t *testing.T) {
+	where, args := whereArgs("mysql", "config_key = ?", []interface{}{"on", "", "alice", "feature.flag"})
+	assert.Equal(t, "config_key = ?", where)
+	assert.Equal(t, []interface{}{"feature.flag"}, args)
+
+	where, args = whereArgs("postgresql", "config_key = $4 AND status = $2", []interface{}{"on", "approved", "alice", "feature.flag"})
+	assert.Equal(t, "config_key = $1 AND status = $2", where)
+	assert.Equal(t, []interface{}{"feature.flag", "approved"}, args)
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// Error codes set in error_code on every failure; clients should match on these rather than on messages
+const (
+	ErrorCodeValidation           = "VALIDATION_ERROR"
+	ErrorCodeUnsupportedOperation = "UNSUPPORTED_OPERATION"
+	ErrorCodeNotFound             = "NOT_FOUND"
+	ErrorCodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	ErrorCodeForbidden            = "FORBIDDEN"
+	ErrorCodeConflict             = "CONFLICT"
+	ErrorCodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	ErrorCodeResultTooLarge       = "RESULT_TOO_LARGE"
+	ErrorCodeTypeMismatch         = "TYPE_MISMATCH"
+	ErrorCodeRateLimited          = "RATE_LIMITED"
+	ErrorCodeUnavailable          = "UNAVAILABLE"
+	ErrorCodeCircuitOpen          = "CIRCUIT_OPEN"
+	ErrorCodeDBError              = "DB_ERROR"
+	ErrorCodeInternal             = "INTERNAL_ERROR"
+	ErrorCodeClientClosed         = "CLIENT_CLOSED_REQUEST"
+
+	// Connection failures classified from the driver error
+	ErrorCodeAuthFailed      = "AUTH_FAILED"
+	ErrorCodeDBNotFound      = "DB_NOT_FOUND"
+	ErrorCodeHostUnreachable = "HOST_UNREACHABLE"
+	ErrorCodeTimeout         = "TIMEOUT"
+)
+
+// StatusClientClosedRequest is the non-standard status, after nginx's, recorded for requests whose client
+// disconnected before the response; the client never reads it
+const StatusClientClosedRequest = 499
+
+// errorCodeDocs documents each error code with the status it is usually sent with, in the order
+// listed by the OpenAPI specification
+var errorCodeDocs = []struct {
+	code        string
+	status      int
+	description string
+}{
+	{ErrorCodeValidation, http.StatusBadRequest, "the request is malformed or a field is missing or invalid; details.errors lists each problem when there are several and details.missing the fields an operation requires"},
+	{ErrorCodeUnsupportedOperation, http.StatusBadRequest, "the operation is not supported for the database type; details.supported lists the supported operations when known"},
+	{ErrorCodeDBNotFound, http.StatusBadRequest, "the database does not exist"},
+	{ErrorCodeAuthFailed, http.StatusUnauthorized, "the database rejected the credentials"},
+	{ErrorCodeForbidden, http.StatusForbidden, "rejected by the read-only mode, statement denylist or CORS policy"},
+	{ErrorCodeNotFound, http.StatusNotFound, "the path, config, approval request, connection or job does not exist, or a MongoDB findOne matched no document"},
+	{ErrorCodeMethodNotAllowed, http.StatusMethodNotAllowed, "the path does not accept the method"},
+	{ErrorCodeConflict, http.StatusConflict, "the config or another unique key already exists, or the resource is not in a state that allows the request"},
+	{ErrorCodePayloadTooLarge, http.StatusRequestEntityTooLarge, "the request body, or a config value or description, exceeds the configured limit; details.limit and details.size give both in bytes, and details.oversized lists each field of a batch"},
+	{ErrorCodeResultTooLarge, http.StatusUnprocessableEntity, "the query result grew past the server's max_result_bytes and the query was cancelled; details.limit, details.rows_read and details.bytes_read tell how far it got, so narrow the query or run it as a job"},
+	{ErrorCodeTypeMismatch, http.StatusUnprocessableEntity, "a config value read with expected_type and on_type_error fail does not parse as that type; details.key and details.expected_type name both"},
+	{ErrorCodeRateLimited, http.StatusTooManyRequests, "the client exceeded the rate limit"},
+	{ErrorCodeClientClosed, StatusClientClosedRequest, "the client disconnected before the response, so its operation was cancelled; recorded in the request log, as the client never reads the response"},
+	{ErrorCodeDBError, http.StatusInternalServerError, "the database failed the operation"},
+	{ErrorCodeInternal, http.StatusInternalServerError, "the server failed to handle the request"},
+	{ErrorCodeHostUnreachable, http.StatusBadGateway, "the database host could not be resolved or reached"},
+	{ErrorCodeUnavailable, http.StatusServiceUnavailable, "a connection profile, database or the job queue is unavailable, or a connection is running its most concurrent operations and none finished within the queue timeout; details.max_operations and details.queue_timeout_ms give both, and Retry-After when to try again"},
+	{ErrorCodeCircuitOpen, http.StatusServiceUnavailable, "recent connections to the database failed, so the request failed right away without trying it; details.retry_after_ms and Retry-After tell when the breaker next lets a probe request through"},
+	{ErrorCodeTimeout, http.StatusGatewayTimeout, "timed out reaching the database; details.phase tells whether connecting (connect) or running the operation (operation) ran out of time, and details.timeout_ms how long it had"},
+}
+
+// errorCodes returns every error code
+func errorCodes() []string {
+	codes := make([]string, len(errorCodeDocs))
+	for i, doc := range errorCodeDocs {
+		codes[i] = doc.code
+	}
+	return codes
+}
+
+// errorCodeDescription describes the error codes and their statuses for the OpenAPI specification
+func errorCodeDescription() string {
+	lines := make([]string, len(errorCodeDocs))
+	for i, doc := range errorCodeDocs {
+		lines[i] = fmt.Sprintf("%s (%d): %s", doc.code, doc.status, doc.description)
+	}
+	return "Machine-readable error code, set on every failure. " + strings.Join(lines, "; ")
+}
+
+// apiError is a failure the caller caused, reported with its own status and error code
+// rather than as a database failure
+type apiError struct {
+	Status     int
+	Code       string
+	Message    string
+	Details    map[string]interface{}
+	RetryAfter time.Duration // Sent as the Retry-After header, rounded up to seconds, when set
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// unsupportedOperationError returns a 400 UNSUPPORTED_OPERATION failure listing the supported operations
+func unsupportedOperationError(operation string, supported []string) error {
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeUnsupportedOperation,
+		Message: fmt.Sprintf("unsupported operation: %s. Supported operations: %s", operation, strings.Join(supported, ", ")),
+		Details: map[string]interface{}{"operation": operation, "supported": supported},
+	}
+}
+
+// missingFieldsError returns a 400 VALIDATION_ERROR failure naming the request fields the operation
+// requires, all of them or, with anyOf, at least one
+func missingFieldsError(operation string, fields []string, anyOf bool) error {
+	var message string
+	switch {
+	case anyOf:
+		message = fmt.Sprintf("one of %s is required for %s operation", strings.Join(fields, ", "), operation)
+	case len(fields) == 1:
+		message = fmt.Sprintf("%s is required for %s operation", fields[0], operation)
+	default:
+		message = fmt.Sprintf("%s and %s are required for %s operation", strings.Join(fields[:len(fields)-1], ", "), fields[len(fields)-1], operation)
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: message,
+		Details: map[string]interface{}{"operation": operation, "missing": fields},
+	}
+}
+
+// classifyDatabaseError returns the HTTP status and error code of a failed connect, ping or operation.
+// Wrong credentials, database names and operations, missing configs and requests and duplicate keys are
+// client errors, unreachable or slow servers are gateway errors and anything else is a database error.
+func classifyDatabaseError(err error) (int, string) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status, apiErr.Code
+	}
+	var phaseErr *phaseTimeoutError
+	if errors.As(err, &phaseErr) {
+		return http.StatusGatewayTimeout, ErrorCodeTimeout
+	}
+	if errors.Is(err, connectors.ErrUnsupportedOperation) {
+		return http.StatusBadRequest, ErrorCodeUnsupportedOperation
+	}
+	if errors.Is(err, connectors.ErrInvalidExtendedJSON) {
+		return http.StatusBadRequest, ErrorCodeValidation
+	}
+	if errors.Is(err, ErrConfigNotFound) || errors.Is(err, ErrRequestNotFound) || errors.Is(err, connectors.ErrNotFound) {
+		return http.StatusNotFound, ErrorCodeNotFound
+	}
+	if errors.Is(err, ErrConfigExists) || connectors.IsDuplicateKey(err) {
+		return http.StatusConflict, ErrorCodeConflict
+	}
+	var tooLarge *connectors.ResultTooLargeError
+	if errors.As(err, &tooLarge) {
+		return http.StatusUnprocessableEntity, ErrorCodeResultTooLarge
+	}
+	if errors.Is(err, context.Canceled) {
+		return StatusClientClosedRequest, ErrorCodeClientClosed
+	}
+
+	switch connectors.ClassifyError(err) {
+	case connectors.ErrorClassAuth:
+		return http.StatusUnauthorized, ErrorCodeAuthFailed
+	case connectors.ErrorClassDatabaseMissing:
+		return http.StatusBadRequest, ErrorCodeDBNotFound
+	case connectors.ErrorClassDNS, connectors.ErrorClassHostUnreachable:
+		return http.StatusBadGateway, ErrorCodeHostUnreachable
+	case connectors.ErrorClassTimeout:
+		return http.StatusGatewayTimeout, ErrorCodeTimeout
+	default:
+		return http.StatusInternalServerError, ErrorCodeDBError
+	}
+}
+
+// notFound reports a lookup of id that matched nothing as sentinel, naming what was looked up, and
+// returns other errors as they are
+func notFound(err, sentinel error, id string) error {
+	if errors.Is(err, connectors.ErrNotFound) {
+		return fmt.Errorf("%w: %s", sentinel, id)
+	}
+	return err
+}
+
+// sendDatabaseError responds to a failed connect, ping or operation with the status and error code of
+// its class and a message hinting at the setting to check
+func (a *API) sendDatabaseError(w http.ResponseWriter, prefix string, err error) {
+	status, code := classifyDatabaseError(err)
+	response := DatabaseResponse{
+		Success:   false,
+		Error:     connectionFailureMessage(prefix, err),
+		ErrorCode: code,
+		Timestamp: time.Now(),
+	}
+	var apiErr *apiError
+	var phaseErr *phaseTimeoutError
+	var tooLarge *connectors.ResultTooLargeError
+	var noRoutine *connectors.RoutineNotFoundError
+	switch {
+	case errors.As(err, &apiErr):
+		response.Details = apiErr.Details
+		setRetryAfter(w, apiErr.RetryAfter)
+	case errors.As(err, &phaseErr):
+		response.Details = map[string]interface{}{"phase": phaseErr.Phase, "timeout_ms": phaseErr.Timeout.Milliseconds()}
+	case errors.As(err, &tooLarge):
+		response.Details = map[string]interface{}{"limit": tooLarge.Limit, "rows_read": tooLarge.Rows, "bytes_read": tooLarge.Bytes}
+	case errors.As(err, &noRoutine):
+		response.Details = map[string]interface{}{"routine": noRoutine.Routine, "routine_type": noRoutine.Type, "suggestions": noRoutine.Suggestions}
+	}
+	a.sendJSON(w, status, response)
+}
+
+// sendRequestError responds to an invalid request with the status, code and details of its apiError, or
+// as a validation error
+func (a *API) sendRequestError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		a.sendValidationError(w, err)
+		return
+	}
+	setRetryAfter(w, apiErr.RetryAfter)
+	a.sendJSON(w, apiErr.Status, DatabaseResponse{
+		Success:   false,
+		Error:     err.Error(),
+		ErrorCode: apiErr.Code,
+		Details:   apiErr.Details,
+		Timestamp: time.Now(),
+	})
+}
+
+// setRetryAfter tells the client to retry after d, in whole seconds and at least one; zero sets nothing
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClassifyDatabaseError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{
+			name:   "mysql access denied",
+			err:    fmt.Errorf("failed to ping MySQL: %w", &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'root'@'localhost'"}),
+			status: http.StatusUnauthorized,
+			code:   ErrorCodeAuthFailed,
+		},
+		{
+			name:   "postgres invalid password",
+			err:    fmt.Errorf("failed to ping PostgreSQL: %w", &pq.Error{Code: "28P01", Message: "password authentication failed"}),
+			status: http.StatusUnauthorized,
+			code:   ErrorCodeAuthFailed,
+		},
+		{
+			name:   "mongodb authentication failed",
+			err:    fmt.Errorf("failed to connect to MongoDB: %w", mongo.CommandError{Code: 18, Name: "AuthenticationFailed"}),
+			status: http.StatusUnauthorized,
+			code:   ErrorCodeAuthFailed,
+		},
+		{
+			name:   "postgres missing database",
+			err:    fmt.Errorf("failed to ping PostgreSQL: %w", &pq.Error{Code: "3D000", Message: "database \"missing\" does not exist"}),
+			status: http.StatusBadRequest,
+			code:   ErrorCodeDBNotFound,
+		},
+		{
+			name:   "mysql unknown database",
+			err:    fmt.Errorf("failed to ping MySQL: %w", &mysql.MySQLError{Number: 1049, Message: "Unknown database 'missing'"}),
+			status: http.StatusBadRequest,
+			code:   ErrorCodeDBNotFound,
+		},
+		{
+			name:   "unresolvable host",
+			err:    fmt.Errorf("failed to ping MySQL: %w", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "db.invalid"}}),
+			status: http.StatusBadGateway,
+			code:   ErrorCodeHostUnreachable,
+		},
+		{
+			name:   "connection refused",
+			err:    fmt.Errorf("failed to ping PostgreSQL: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}),
+			status: http.StatusBadGateway,
+			code:   ErrorCodeHostUnreachable,
+		},
+		{
+			name:   "deadline exceeded",
+			err:    fmt.Errorf("failed to ping MySQL: %w", context.DeadlineExceeded),
+			status: http.StatusGatewayTimeout,
+			code:   ErrorCodeTimeout,
+		},
+		{
+			name:   "client disconnected",
+			err:    fmt.Errorf("failed to execute query: %w", context.Canceled),
+			status: StatusClientClosedRequest,
+			code:   ErrorCodeClientClosed,
+		},
+		{
+			name:   "sql syntax error",
+			err:    fmt.Errorf("query failed: %w", &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}),
+			status: http.StatusInternalServerError,
+			code:   ErrorCodeDBError,
+		},
+		{
+			name:   "unclassified",
+			err:    errors.New("driver: bad connection"),
+			status: http.StatusInternalServerError,
+			code:   ErrorCodeDBError,
+		},
+		{
+			name:   "unsupported connector operation",
+			err:    fmt.Errorf("%w: aggregate", connectors.ErrUnsupportedOperation),
+			status: http.StatusBadRequest,
+			code:   ErrorCodeUnsupportedOperation,
+		},
+		{
+			name:   "malformed extended json",
+			err:    fmt.Errorf("%w in filter: $oid \"xyz\" is not 24 hexadecimal digits", connectors.ErrInvalidExtendedJSON),
+			status: http.StatusBadRequest,
+			code:   ErrorCodeValidation,
+		},
+		{
+			name:   "validation error",
+			err:    missingFieldsError("select", []string{"query"}, false),
+			status: http.StatusBadRequest,
+			code:   ErrorCodeValidation,
+		},
+		{
+			name:   "missing config",
+			err:    fmt.Errorf("failed to update config: %w", fmt.Errorf("%w: feature.flag", ErrConfigNotFound)),
+			status: http.StatusNotFound,
+			code:   ErrorCodeNotFound,
+		},
+		{
+			name:   "missing approval request",
+			err:    fmt.Errorf("%w: req-9", ErrRequestNotFound),
+			status: http.StatusNotFound,
+			code:   ErrorCodeNotFound,
+		},
+		{
+			name:   "existing config",
+			err:    fmt.Errorf("%w: feature.flag", ErrConfigExists),
+			status: http.StatusConflict,
+			code:   ErrorCodeConflict,
+		},
+		{
+			name:   "duplicate key",
+			err:    fmt.Errorf("failed to insert: %w", &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}),
+			status: http.StatusConflict,
+			code:   ErrorCodeConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := classifyDatabaseError(tt.err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestSendDatabaseError(t *testing.T) {
+	api := NewAPI()
+
+	rr := httptest.NewRecorder()
+	api.sendDatabaseError(rr, "Connection failed", &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'root'@'localhost'"})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeAuthFailed, response.ErrorCode)
+	assert.Contains(t, response.Error, "check the username and password")
+
+	rr = httptest.NewRecorder()
+	api.sendDatabaseError(rr, "Operation failed", errors.New("table users is locked"))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeDBError, response.ErrorCode)
+	assert.Equal(t, "Operation failed: table users is locked", response.Error)
+
+	rr = httptest.NewRecorder()
+	api.sendDatabaseError(rr, "Operation failed", unsupportedOperationError("upsert", []string{"select", "insert"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	response = DatabaseResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeUnsupportedOperation, response.ErrorCode)
+	assert.Equal(t, "upsert", response.Details["operation"])
+	assert.Equal(t, []interface{}{"select", "insert"}, response.Details["supported"])
+}
+
+// TestExecuteErrorCodes checks that /execute reports failures the caller caused as client errors
+func TestExecuteErrorCodes(t *testing.T) {
+	send := func(operation string) DatabaseResponse {
+		data, err := json.Marshal(map[string]interface{}{
+			"type":      fakeDriver,
+			"host":      "kv.internal",
+			"port":      7000,
+			"database":  "sessions",
+			"operation": operation,
+		})
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		SetupRoutes(NewAPI()).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewReader(data)))
+		require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		var response DatabaseResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response
+	}
+
+	fakeDriverConnector = new(connectortest.MockDBConnector)
+	fakeDriverConnector.On("Connect", mock.Anything).Return(nil)
+	fakeDriverConnector.On("Close").Return(nil)
+	fakeDriverConnector.On("GetType").Return(fakeDriver)
+	fakeDriverConnector.On("Execute", mock.Anything, "scan", mock.Anything).
+		Return(nil, fmt.Errorf("%w: scan", connectors.ErrUnsupportedOperation))
+
+	response := send("scan")
+	assert.Equal(t, ErrorCodeUnsupportedOperation, response.ErrorCode)
+	assert.Contains(t, response.Error, "unsupported operation: scan")
+
+	response = send("")
+	assert.Equal(t, ErrorCodeValidation, response.ErrorCode)
+	assert.Equal(t, "Operation is required", response.Error)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"db-connectors/connectors"
+)
+
+// explainOperation is the /execute operation reporting the query plan of a SQL statement or MongoDB query
+const explainOperation = "explain"
+
+// checkExplain refuses to explain several statements at once, statements that write unless allow_writes
+// is set, since analyze executes them, and analyze on databases that cannot report it
+func checkExplain(req *DatabaseOperationRequest, dbType string) error {
+	var (
+		class    StatementClass
+		keywords []string
+	)
+	if dialect, ok := connectors.DialectFor(dbType); ok {
+		if statements := len(splitSQLStatements(tokenizeSQL(dbType, req.Query))); statements > 1 {
+			return &apiError{
+				Status:  http.StatusBadRequest,
+				Code:    ErrorCodeValidation,
+				Message: fmt.Sprintf("explain accepts a single statement, got %d", statements),
+				Details: map[string]interface{}{"operation": explainOperation, "type": dbType},
+			}
+		}
+		if _, err := dialect.Explain(req.Query, req.Analyze); err != nil {
+			return &apiError{
+				Status:  http.StatusBadRequest,
+				Code:    ErrorCodeValidation,
+				Message: err.Error(),
+				Details: map[string]interface{}{"operation": explainOperation, "type": dbType},
+			}
+		}
+		class, keywords = ClassifySQL(dbType, req.Query)
+	} else {
+		class = ClassifyMongoOperation(explainOperation, req.Params)
+		keywords = []string{"aggregate with $out or $merge"}
+	}
+
+	if class == StatementRead || req.AllowWrites {
+		return nil
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: fmt.Sprintf("explain only accepts read statements, got %s; set allow_writes to explain statements that write", strings.Join(keywords, ", ")),
+		Details: map[string]interface{}{"operation": explainOperation, "allow_writes": false},
+	}
+}
+
+// explain reports the query plan of an explain operation. SQL statements are prefixed with the dialect's
+// EXPLAIN returning JSON; MongoDB runs its find or aggregate as an explain command.
+func (a *API) explain(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest) (interface{}, error) {
+	dialect, ok := connectors.DialectFor(connector.GetType())
+	if !ok {
+		params := make(map[string]interface{}, len(req.Params)+1)
+		for k, v := range req.Params {
+			params[k] = v
+		}
+		if req.Analyze {
+			params["verbosity"] = "executionStats"
+		}
+		plan, err := connector.Execute(ctx, explainOperation, params)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"plan": plan}, nil
+	}
+
+	statement, err := dialect.Explain(req.Query, req.Analyze)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := connector.Query(ctx, statement, req.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var raw interface{}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s returned no plan", statement)
+	}
+	if err := rows.Scan(&raw); err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var text []byte
+	switch v := raw.(type) {
+	case []byte:
+		text = v
+	case string:
+		text = []byte(v)
+	default:
+		return nil, fmt.Errorf("unexpected plan of type %T", raw)
+	}
+	var plan interface{}
+	if err := json.Unmarshal(text, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	return map[string]interface{}{"statement": statement, "plan": plan}, nil
+}
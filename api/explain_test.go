@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// queryingConnector runs queries on its sqlmock database
+type queryingConnector struct {
+	*sqlMockConnector
+}
+
+func (c queryingConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+func TestExplainSQL(t *testing.T) {
+	tests := []struct {
+		dbType    string
+		analyze   bool
+		statement string
+	}{
+		{dbType: "mysql", statement: "EXPLAIN FORMAT=JSON SELECT * FROM users WHERE id = ?"},
+		{dbType: "postgresql", statement: "EXPLAIN (FORMAT JSON) SELECT * FROM users WHERE id = ?"},
+		{dbType: "postgresql", analyze: true, statement: "EXPLAIN (ANALYZE, FORMAT JSON) SELECT * FROM users WHERE id = ?"},
+	}
+	for _, tt := range tests {
+		connector, mockDB := newSQLMockConnector(t, tt.dbType)
+		mockDB.ExpectQuery(regexp.QuoteMeta(tt.statement)).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(`[{"Plan":{"Node Type":"Index Scan"}}]`)))
+
+		req := &DatabaseOperationRequest{Operation: "explain", Query: "SELECT * FROM users WHERE id = ?", Args: []interface{}{7}, Analyze: tt.analyze}
+		result, err := NewAPI().executeOperation(context.Background(), queryingConnector{connector}, req)
+		require.NoError(t, err, tt.statement)
+		assert.Equal(t, map[string]interface{}{
+			"statement": tt.statement,
+			"plan":      []interface{}{map[string]interface{}{"Plan": map[string]interface{}{"Node Type": "Index Scan"}}},
+		}, result)
+		assert.NoError(t, mockDB.ExpectationsWereMet())
+	}
+}
+
+func TestExplainMongoDB(t *testing.T) {
+	connector := new(connectortest.MockDBConnector)
+	connector.On("GetType").Return("mongodb")
+	plan := map[string]interface{}{"queryPlanner": map[string]interface{}{"namespace": "app.users"}}
+	connector.On("Execute", mock.Anything, "explain", map[string]interface{}{
+		"collection": "users",
+		"filter":     map[string]interface{}{"age": 30.0},
+		"verbosity":  "executionStats",
+	}).Return(plan, nil)
+
+	params := map[string]interface{}{"collection": "users", "filter": map[string]interface{}{"age": 30.0}}
+	req := &DatabaseOperationRequest{Operation: "explain", Params: params, Analyze: true}
+	result, err := NewAPI().executeOperation(context.Background(), connector, req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"plan": plan}, result)
+	// The request's params are left as they are
+	assert.NotContains(t, params, "verbosity")
+	connector.AssertExpectations(t)
+}
+
+func TestCheckExplain(t *testing.T) {
+	out := map[string]interface{}{
+		"collection": "users",
+		"pipeline":   []interface{}{map[string]interface{}{"$out": "copy"}},
+	}
+	tests := []struct {
+		name   string
+		dbType string
+		req    DatabaseOperationRequest
+		err    string
+	}{
+		{name: "select", dbType: "postgresql", req: DatabaseOperationRequest{Query: "SELECT 1", Analyze: true}},
+		{
+			name:   "delete",
+			dbType: "postgresql",
+			req:    DatabaseOperationRequest{Query: "DELETE FROM users"},
+			err:    "explain only accepts read statements, got DELETE; set allow_writes to explain statements that write",
+		},
+		{name: "delete with allow_writes", dbType: "postgresql", req: DatabaseOperationRequest{Query: "DELETE FROM users", Analyze: true, AllowWrites: true}},
+		{
+			name:   "several statements",
+			dbType: "postgresql",
+			req:    DatabaseOperationRequest{Query: "SELECT 1; DELETE FROM users", AllowWrites: true},
+			err:    "explain accepts a single statement, got 2",
+		},
+		{
+			name:   "statement in mysql executable comment",
+			dbType: "mysql",
+			req:    DatabaseOperationRequest{Query: "SELECT 1 /*!; DELETE FROM users */", AllowWrites: true},
+			err:    "explain accepts a single statement, got 2",
+		},
+		{name: "trailing semicolon", dbType: "postgresql", req: DatabaseOperationRequest{Query: "SELECT ';'; "}},
+		{
+			name:   "mysql update",
+			dbType: "mysql",
+			req:    DatabaseOperationRequest{Query: "UPDATE users SET age = 1"},
+			err:    "explain only accepts read statements, got UPDATE; set allow_writes to explain statements that write",
+		},
+		{
+			name:   "mysql analyze",
+			dbType: "mysql",
+			req:    DatabaseOperationRequest{Query: "SELECT 1", Analyze: true},
+			err:    "MySQL cannot report EXPLAIN ANALYZE as JSON",
+		},
+		{name: "find", dbType: "mongodb", req: DatabaseOperationRequest{Params: map[string]interface{}{"collection": "users"}}},
+		{
+			name:   "aggregate with $out",
+			dbType: "mongodb",
+			req:    DatabaseOperationRequest{Params: out},
+			err:    "explain only accepts read statements, got aggregate with $out or $merge; set allow_writes to explain statements that write",
+		},
+		{name: "aggregate with $out and allow_writes", dbType: "mongodb", req: DatabaseOperationRequest{Params: out, AllowWrites: true}},
+	}
+	for _, tt := range tests {
+		tt.req.Operation = "explain"
+		err := checkExecuteOperation(&tt.req, tt.dbType)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.name)
+			continue
+		}
+		var apiErr *apiError
+		require.ErrorAs(t, err, &apiErr, tt.name)
+		assert.Equal(t, http.StatusBadRequest, apiErr.Status, tt.name)
+		assert.Equal(t, tt.err, apiErr.Message, tt.name)
+	}
+}
+
+func TestExplainPolicy(t *testing.T) {
+	policy := StatementPolicy{ReadOnly: true}
+
+	// Plans of writes are computed without running them
+	assert.NoError(t, policy.Check(&DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "postgresql"},
+		Operation:                 "explain",
+		Query:                     "DELETE FROM users",
+		AllowWrites:               true,
+	}))
+
+	// Analyze runs them, which read-only mode refuses
+	err := policy.Check(&DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "postgresql"},
+		Operation:                 "explain",
+		Query:                     "DELETE FROM users",
+		Analyze:                   true,
+		AllowWrites:               true,
+	})
+	assert.EqualError(t, err, "server is in read-only mode: write operations are not allowed")
+
+	// A statement after the explained one would run
+	err = policy.Check(&DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "postgresql"},
+		Operation:                 "explain",
+		Query:                     "SELECT 1; DELETE FROM users",
+		AllowWrites:               true,
+	})
+	assert.EqualError(t, err, "server is in read-only mode: write operations are not allowed")
+
+	assert.Equal(t, StatementRead, ClassifyMongoOperation("explain", map[string]interface{}{"collection": "users"}))
+}
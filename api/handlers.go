@@ -2,15 +2,24 @@ package api
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"db-connectors/allconfig"
 	"db-connectors/connectors"
+	"db-connectors/events"
+	"db-connectors/jobs"
+	"db-connectors/logging"
+	"db-connectors/requestid"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // DatabaseConnectionRequest represents the request to connect to a database
@@ -20,8 +29,17 @@ type DatabaseConnectionRequest struct {
 	Port     int    `json:"port" validate:"required"`
 	Username string `json:"username"`                     // Optional for MongoDB
 	Password string `json:"password"`                     // Optional for MongoDB
-	Database string `json:"database" validate:"required"`
+	Database string `json:"database" validate:"required"` // Database connected to
+	Schema   string `json:"schema,omitempty"`             // PostgreSQL search_path, or the schema (SQL) or database (MongoDB) of schema operations
 	SSLMode  string `json:"ssl_mode,omitempty"` // For PostgreSQL
+	URI      string `json:"uri,omitempty"`      // Connection URI or DSN used instead of the fields above
+	Label    string `json:"label,omitempty"`    // Names the connection in logs, metrics and config change events
+	// Override the server's phase timeouts, up to their maximums
+	ConnectTimeoutMs   int `json:"connect_timeout_ms,omitempty"`   // Connecting, ping included
+	OperationTimeoutMs int `json:"operation_timeout_ms,omitempty"` // Running the operation
+	IncludeTimings     bool `json:"include_timings,omitempty"`     // Return timings_ms, the time each phase of the request took
+	// Let a MySQL query run several statements separated by semicolons; rejected unless the server allows it
+	MultiStatements bool `json:"multi_statements,omitempty"`
 }
 
 // DatabaseOperationRequest represents a request to execute a database operation
@@ -29,14 +47,36 @@ type DatabaseOperationRequest struct {
 	DatabaseConnectionRequest
 	Operation string                 `json:"operation" validate:"required"` // query, insert, update, delete, find, etc.
 	Query     string                 `json:"query,omitempty"`               // For SQL databases
-	Args      []interface{}          `json:"args,omitempty"`                // Query arguments for SQL
+	Args      SQLArgs                `json:"args,omitempty"`                // Query arguments for SQL
 	Params    map[string]interface{} `json:"params,omitempty"`              // For MongoDB operations
+	Table     string                 `json:"table,omitempty"`               // Table/collection for describe_table and list_indexes
+	Name      string                 `json:"name,omitempty"`                // Query run by named_query, whose params are passed in params
+	// For MySQL sessions
+	UseDatabase string `json:"use_database,omitempty"` // Database the session switches to, as USE does, for this operation
+	// For explain
+	Analyze     bool `json:"analyze,omitempty"`      // Run the statement to report actual costs (EXPLAIN ANALYZE, or executionStats on MongoDB)
+	AllowWrites bool `json:"allow_writes,omitempty"` // Explain statements that write, which analyze executes
+	// For caching the results of read queries
+	CacheTTLSeconds int `json:"cache_ttl_seconds,omitempty"` // Serve the result from the query cache for this long
+	// For the shape of query results
+	IncludeColumns bool   `json:"include_columns,omitempty"` // Return the columns of the result next to rows keyed in column order
+	ResultFormat   string `json:"result_format,omitempty"`   // objects (the default) or tabular
+	// For insert, update, delete and execute
+	Returning bool `json:"returning,omitempty"` // Return the rows of a RETURNING clause, or the ID a MySQL insert generated
+	// For list_databases
+	IncludeSystem bool `json:"include_system,omitempty"` // Include system databases such as mysql, template0 or admin
+	// For replaying retries
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // Alternative to the Idempotency-Key header
 }
 
 // AllConfigRequest represents a request to work with allconfig table
 type AllConfigRequest struct {
 	DatabaseConnectionRequest
-	TableName string `json:"table_name,omitempty"` // Custom table name for allconfig, defaults to "allconfig"
+	TableName string `json:"table_name,omitempty"` // Custom table name for allconfig, defaults to the server's allconfig table
+	Repair    bool   `json:"repair,omitempty"`     // On /allconfig, add the tables, columns and indexes found missing
+	// Run the operations that need no status or maker columns, for tables created without them;
+	// detected from the table when absent
+	LegacyMode *bool `json:"legacy_mode,omitempty"`
 }
 
 // AllConfigOperationRequest represents operations on allconfig table
@@ -46,12 +86,31 @@ type AllConfigOperationRequest struct {
 	Key         string                 `json:"key,omitempty"`                 // Configuration key
 	Value       interface{}            `json:"value,omitempty"`               // Configuration value
 	Description string                 `json:"description,omitempty"`         // Configuration description
+	Tags        []string               `json:"tags,omitempty"`                // Labels such as "team:payments"; left as they are on update when absent
+	// Time the config expires at, after which reads no longer return it; left as it is on update when absent
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 	Configs     map[string]interface{} `json:"configs,omitempty"`             // Multiple configurations
+	// Match the keys to stored keys regardless of case; defaults to the server's key policy
+	CaseInsensitive *bool `json:"case_insensitive,omitempty"`
 	// For batch operations
-	ConfigItems []ConfigItem `json:"config_items,omitempty"` // Array of config items for batch operations
+	ConfigItems     []ConfigItem `json:"config_items,omitempty"`      // Array of config items for batch operations
+	Concurrency     int          `json:"concurrency,omitempty"`       // Items run at once, 1 by default
+	ContinueOnError *bool        `json:"continue_on_error,omitempty"` // Keep running items after one fails, defaults to true
+	Atomic          bool         `json:"atomic,omitempty"`            // Run the whole batch in one transaction (SQL only)
+	Upsert          bool         `json:"upsert,omitempty"`            // Create or update the batch with multi-row upserts (direct_create_batch)
+	ChunkSize       int          `json:"chunk_size,omitempty"`        // Items per upsert statement or bulkWrite, per bulk insert of import, or per deletion of prune_history
 	// For search/filter operations
 	SearchTerm string                 `json:"search_term,omitempty"` // Search term for filtering
 	Filter     map[string]interface{} `json:"filter,omitempty"`      // Filter criteria
+	TagsAny    []string               `json:"tags_any,omitempty"`    // filter: configs carrying any of these tags
+	TagsAll    []string               `json:"tags_all,omitempty"`    // filter: configs carrying all of these tags
+	Status     string                 `json:"status,omitempty"`      // read_all_admin, search_admin, count_admin: only configs with this status
+	// For reads falling back to other keys
+	FallbackKeys []string    `json:"fallback_keys,omitempty"` // read: keys tried in order when key holds no approved config
+	DefaultValue interface{} `json:"default_value,omitempty"` // read: value returned when none of the keys holds one
+	// For typed reads
+	ExpectedType string `json:"expected_type,omitempty"` // read: string, bool, int, float, duration (in milliseconds) or json
+	OnTypeError  string `json:"on_type_error,omitempty"` // read: raw (the default) returns the stored value with parse_error, fail a 422
 	Limit      int                    `json:"limit,omitempty"`       // Limit results
 	Offset     int                    `json:"offset,omitempty"`      // Offset for pagination
 	// For maker-checker workflow
@@ -59,6 +118,19 @@ type AllConfigOperationRequest struct {
 	CheckerID       string `json:"checker_id,omitempty"`       // ID of user approving the change
 	ApprovalComment string `json:"approval_comment,omitempty"` // Comment for approval/rejection
 	RequestID       string `json:"request_id,omitempty"`       // ID of pending request for approval
+	// For pruning the approval history
+	OlderThan    string   `json:"older_than,omitempty"`     // prune_history: RFC 3339 timestamp, duration ("720h") or days ("90d")
+	Statuses     []string `json:"statuses,omitempty"`       // prune_history: statuses removed, approved and rejected by default
+	ChunkDelayMS *int     `json:"chunk_delay_ms,omitempty"` // prune_history: pause between chunks, 100 by default
+	Archive      bool     `json:"archive,omitempty"`        // prune_history: copy the requests to the archive table first
+	// For clearing tables
+	Confirm string `json:"confirm,omitempty"` // drop_table, direct_delete_all, truncate_approvals: the table_name, as a safeguard
+	// For previewing writes
+	DryRun bool `json:"dry_run,omitempty"` // Report the writes and the rows they would affect without executing them
+	// For replaying retries
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // Alternative to the Idempotency-Key header
+	// For looking up batches and imports
+	OperationID string `json:"operation_id,omitempty"` // get_operation: ID returned by a batch or import operation
 }
 
 // ConfigItem represents a single configuration item
@@ -66,6 +138,7 @@ type ConfigItem struct {
 	Key         string      `json:"key" validate:"required"`
 	Value       interface{} `json:"value"`
 	Description string      `json:"description,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
 	// For maker-checker workflow
 	MakerID string `json:"maker_id,omitempty"`
 }
@@ -76,6 +149,7 @@ type ApprovalRequest struct {
 	ConfigKey       string      `json:"config_key"`
 	ConfigValue     interface{} `json:"config_value"`
 	Description     string      `json:"description,omitempty"`
+	Tags            []string    `json:"tags,omitempty"`
 	Operation       string      `json:"operation"`        // create, update, delete
 	MakerID         string      `json:"maker_id"`
 	CheckerID       string      `json:"checker_id,omitempty"`
@@ -92,179 +166,411 @@ type DatabaseResponse struct {
 	Message   string      `json:"message,omitempty"`
 	Data      interface{} `json:"data,omitempty"`
 	Error     string      `json:"error,omitempty"`
+	ErrorCode string      `json:"error_code,omitempty"` // Set on every failure, such as VALIDATION_ERROR or AUTH_FAILED
+	Details   map[string]interface{} `json:"details,omitempty"` // Structured context of a failure, such as each validation problem
+	RequestID string      `json:"request_id,omitempty"`
+	Cached     bool     `json:"cached,omitempty"`       // Data was served from the query cache
+	CacheAgeMs *float64 `json:"cache_age_ms,omitempty"` // Age of the cached data
+	Deprecation string `json:"deprecation,omitempty"` // Warns that the request named its operation by a deprecated alias
+	Timings *Timings `json:"timings_ms,omitempty"` // Time each phase of the request took, when it set include_timings
 	Timestamp time.Time   `json:"timestamp"`
 }
 
 // API represents the HTTP API server
 type API struct {
-	registry *connectors.ConnectorRegistry
-}
+	registry       *connectors.ConnectorRegistry
+	policy         StatementPolicy
+	cors           CORSPolicy
+	limiter        *rateLimiter  // nil unless rate limiting is enabled
+	jobs           *jobs.Manager // nil unless asynchronous jobs are enabled
+	profiles       map[string]*profile
+	profilesMu     sync.RWMutex // Guards profiles, which DELETE /v1/connections/{name} removes from
+	defaultProfile string
+	readiness      *readinessChecker
+	startup        startupState
+	keepAlive      keepAliver
+	logger         *slog.Logger
+	build          BuildInfo
+
+	maxRequestBytes int64 // Zero leaves request bodies unlimited
+
+	idempotency IdempotencyStore // nil disables replaying requests by Idempotency-Key
+
+	allConfigTable  string // Used when a request or profile names no table
+	allConfigSchema string // Schema of the SQL allconfig tables when a request names none; empty leaves them unqualified
+	approvalSuffix  string // Appended to the allconfig table name to name its approval requests table
+	keys            KeyPolicy
+	values          ValueLimits
+	rules           ValueRules
+
+	namedQueries   map[string]NamedQuery
+	namedQueriesMu sync.RWMutex // Guards namedQueries, which SetNamedQueries replaces on reload
+
+	legacyTables   map[string]bool // Whether each allconfig table looked up lacks the status column, by legacyTableKey
+	legacyTablesMu sync.Mutex
+
+	queryCache     *queryCache   // nil disables caching the results of read queries
+	maxResultBytes int64         // Approximate JSON size allowed for the rows of one query; zero or less is unlimited
+	streamFlushRows int          // Lines a format=jsonl response writes between flushes
+	phaseTimeouts  PhaseTimeouts
+	masking        MaskingPolicy
+	events         *events.Async // nil publishes no config change events
+	statements     *connectors.StatementLogger
+	latencies      latencyHistograms // Phases of the requests of each operation
+	operations     *operationLimiter // Slots of each connection; nil leaves operations unbounded
+	breakers       *circuitBreakers  // Circuit breaker of each connection; nil lets every request connect
+	alerts         *healthAlerter    // Notifies the changes of health of the connection profiles
+
+	configOperations *configOperationLog // Recent batch and import operations, looked up by get_operation
+	configMetrics    *allconfig.Metrics  // Requests submitted, approved and rejected, and pending, by connection and table
+
+	notifyConfigChanges bool // create_table adds a trigger notifying changes to PostgreSQL allconfig tables
+	strictOperations    bool // Reject allconfig operations named by an alias instead of their canonical name
+
+	tenants map[string]*Tenant // By ID; nil leaves the allconfig tables to the requests
+
+	now func() time.Time // Clock MongoDB reads compare expires_at with
+}
+
+// Default allconfig table name and approval requests table suffix
+const (
+	DefaultAllConfigTable = "allconfig"
+	DefaultApprovalSuffix = "_approval_requests"
+)
 
 // NewAPI creates a new API instance
 func NewAPI() *API {
-	return &API{
+	a := &API{
 		registry: connectors.NewConnectorRegistry(),
+		policy:   DefaultStatementPolicy(),
+		cors:     DefaultCORSPolicy(),
+		logger:   slog.Default(),
+
+		readiness:      newReadinessChecker(DefaultReadyTimeout, DefaultReadyCacheTTL),
+		keepAlive:      newKeepAliver(KeepAlive{}),
+		idempotency:    NewMemoryIdempotencyStore(DefaultIdempotencyTTL),
+		queryCache:     newQueryCache(DefaultQueryCacheBytes),
+		maxResultBytes: DefaultMaxResultBytes,
+		streamFlushRows: DefaultStreamFlushRows,
+		phaseTimeouts:  DefaultPhaseTimeouts(),
+		operations:     newOperationLimiter(ConcurrencyLimit{}),
+		breakers:       newCircuitBreakers(CircuitBreaker{}),
+		alerts:         newHealthAlerter(HealthAlerts{}),
+		statements:     connectors.NewStatementLogger(connectors.StatementLogOptions{}),
+		build:          BuildInfo{Version: "dev", Commit: "unknown", BuildDate: "unknown"},
+
+		allConfigTable: DefaultAllConfigTable,
+		approvalSuffix: DefaultApprovalSuffix,
+		keys:           DefaultKeyPolicy(),
+		values:         DefaultValueLimits(),
+		legacyTables:   map[string]bool{},
+
+		configOperations: newConfigOperationLog(maxConfigOperations),
+		configMetrics:    allconfig.NewMetrics(),
+
+		now: time.Now,
+	}
+	a.registry.OnHealthChange(a.healthChanged)
+	return a
+}
+
+// tableName returns the allconfig table to use for a request or profile naming table, which may be empty
+func (a *API) tableName(table string) string {
+	if table == "" {
+		return a.allConfigTable
 	}
+	return table
+}
+
+// approvalTable returns the approval requests table belonging to an allconfig table
+func (a *API) approvalTable(tableName string) string {
+	return tableName + a.approvalSuffix
 }
 
 // TestConnectionHandler tests a database connection
 func (a *API) TestConnectionHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		a.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if !a.allowMethod(w, r, http.MethodPost) {
 		return
 	}
+	w, r = a.timeRequest(w, r)
 
 	var req DatabaseConnectionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
 		return
 	}
 
 	// Validate request
 	if err := a.validateConnectionRequest(&req); err != nil {
-		a.sendError(w, http.StatusBadRequest, err.Error())
+		a.sendValidationError(w, err)
 		return
 	}
+	timeOperation(r, "test_connection", req.IncludeTimings)
 
 	// Create connector
 	connector, err := a.createConnector(&req)
 	if err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Failed to create connector: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
 		return
 	}
 
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Test connection; connecting and pinging share the connect timeout
+	conn := a.connectPhase(r.Context(), &req)
+	defer conn.cancel()
+	connectStart := time.Now()
 
-	if err := connector.Connect(ctx); err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Connection failed: %v", err))
+	if err := connector.Connect(conn.ctx); err != nil {
+		a.sendDatabaseError(w, "Connection failed", conn.err(err))
 		return
 	}
-	defer connector.Close()
+	defer connector.Close(r.Context())
 
-	if err := connector.Ping(ctx); err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Ping failed: %v", err))
+	pingStart := time.Now()
+	if err := connector.Ping(conn.ctx); err != nil {
+		a.sendDatabaseError(w, "Ping failed", conn.err(err))
 		return
 	}
+	pingLatency := time.Since(pingStart)
+	addConnect(r.Context(), time.Since(connectStart))
 
-	a.sendSuccess(w, map[string]interface{}{
+	op := a.operationPhase(r.Context(), &req)
+	defer op.cancel()
+	ctx := op.ctx
+
+	data := map[string]interface{}{
 		"connection_status": "success",
 		"database_type":     connector.GetType(),
-		"connected":         connector.IsConnected(),
-	}, "Database connection successful")
+		"connected":         connector.IsConnected(ctx),
+		"ping_latency_ms":   durationMs(pingLatency),
+	}
+
+	// Diagnostics are best effort; a reachable server is still a successful test
+	if info, err := connector.GetServerInfo(ctx); err != nil {
+		data["server_info_error"] = err.Error()
+	} else {
+		data["server_info"] = info
+	}
+
+	a.sendSuccess(w, data, "Database connection successful")
+}
+
+// connectionFailureMessage prefixes a driver error with a hint about which setting is wrong
+func connectionFailureMessage(prefix string, err error) string {
+	// Drivers may quote the connection URI they failed to parse
+	message := logging.RedactDSN(err.Error())
+	class := connectors.ClassifyError(err)
+	if class == connectors.ErrorClassUnknown {
+		return fmt.Sprintf("%s: %s", prefix, message)
+	}
+	return fmt.Sprintf("%s (%s): %s: %s", prefix, class, class.Description(), message)
 }
 
 // ExecuteOperationHandler executes a database operation
 func (a *API) ExecuteOperationHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		a.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if !a.allowMethod(w, r, http.MethodPost) {
 		return
 	}
 
+	w, r = a.timeRequest(w, r)
+
 	var req DatabaseOperationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+
+	if err := checkResultFormat(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+	if err := checkReturning(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+	if err := checkStreamFormat(&req, r.URL.Query().Get("format")); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+
+	// Named queries run on the connection profile of the server configuration rather than the request's
+	if req.Operation == namedQueryOperation {
+		a.executeNamedQuery(w, r, &req)
 		return
 	}
 
 	// Validate request
-	if err := a.validateConnectionRequest(&req.DatabaseConnectionRequest); err != nil {
-		a.sendError(w, http.StatusBadRequest, err.Error())
+	if err := a.validateOperationRequest(&req); err != nil {
+		a.sendValidationError(w, err)
 		return
 	}
 
 	if req.Operation == "" {
-		a.sendError(w, http.StatusBadRequest, "Operation is required")
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, "Operation is required")
+		return
+	}
+
+	// Reject unknown operations and missing fields before connecting
+	if err := ValidateOperation(&req); err != nil {
+		a.sendRequestError(w, err)
+		return
+	}
+	if err := checkQueryCache(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+	timeOperation(r, req.Operation, req.IncludeTimings)
+
+	// Enforce read-only mode and the statement denylist before touching the database
+	if err := a.policy.Check(&req); err != nil {
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			a.sendError(w, policyErr.StatusCode, policyErr.Code, policyErr.Message)
+			return
+		}
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+
+	// Listing databases happens before a database is chosen, so connect to the server's default one
+	if req.Operation == "list_databases" && req.Database == "" {
+		req.Database = defaultServerDatabase(req.Type)
+	}
+	req.switchDatabase()
+
+	// Sensitive columns are masked unless the caller has the bypass role
+	m := a.masker(r, a.connectionName(&req.DatabaseConnectionRequest))
+
+	// Stream the rows of reads sent with format=jsonl as they are read instead of in one response
+	if r.URL.Query().Get("format") == StreamFormatJSONL {
+		a.streamOperation(w, r, &req, m)
+		return
+	}
+
+	// Serve read queries sent with cache_ttl_seconds from the query cache without connecting
+	cached, age, cacheKey, hit := a.cachedResult(&req)
+	if hit {
+		a.sendCachedSuccess(w, m.rows(req.maskSource(), cached), age)
 		return
 	}
 
 	// Create connector
 	connector, err := a.createConnector(&req.DatabaseConnectionRequest)
 	if err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Failed to create connector: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
 		return
 	}
 
-	// Connect to database
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Wait for a free slot on the connection
+	release, ok := a.acquireSlot(w, r, a.connectionKey(&req.DatabaseConnectionRequest))
+	if !ok {
+		return
+	}
+	defer release()
 
-	if err := connector.Connect(ctx); err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Connection failed: %v", err))
+	// Connect to database
+	if err := a.connectWithin(r.Context(), connector, &req.DatabaseConnectionRequest); err != nil {
+		a.sendDatabaseError(w, "Connection failed", err)
 		return
 	}
-	defer connector.Close()
+	defer connector.Close(r.Context())
 
 	// Execute operation
-	result, err := a.executeOperation(ctx, connector, &req)
+	op := a.operationPhase(r.Context(), &req.DatabaseConnectionRequest)
+	defer op.cancel()
+	result, err := a.executeCached(a.limitResults(op.ctx), connector, &req, cacheKey)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Operation failed: %v", err))
+		a.sendDatabaseError(w, "Operation failed", op.err(err))
 		return
 	}
 
-	a.sendSuccess(w, result, "Operation executed successfully")
+	a.sendSuccess(w, m.rows(req.maskSource(), result), "Operation executed successfully")
 }
 
 // HealthHandler provides health check endpoint
 func (a *API) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		a.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if !a.allowMethod(w, r, http.MethodGet) {
 		return
 	}
 
 	a.sendSuccess(w, map[string]interface{}{
-		"status":  "healthy",
-		"service": "db-connectors-api",
-		"version": "1.0.0",
+		"status":     "healthy",
+		"service":    "db-connectors-api",
+		"version":    a.build.Version,
+		"commit":     a.build.Commit,
+		"build_date": a.build.BuildDate,
 	}, "Service is healthy")
 }
 
 // AllConfigHandler checks for allconfig table and provides information
 func (a *API) AllConfigHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		a.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if !a.allowMethod(w, r, http.MethodPost) {
 		return
 	}
 
+	w, r = a.timeRequest(w, r)
+
 	var req AllConfigRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
 		return
 	}
 
-	// Set default table name if not provided
-	if req.TableName == "" {
-		req.TableName = "allconfig"
+	// Set default table name if not provided, or the tenant's whatever the request names
+	tenant, err := a.resolveTenant(r)
+	if err != nil {
+		a.sendRequestError(w, err)
+		return
 	}
+	req.TableName = a.tenantTable(tenant, req.TableName)
+	req.Schema = a.configSchema(req.Type, req.Schema)
 
 	// Validate connection request
 	if err := a.validateConnectionRequest(&req.DatabaseConnectionRequest); err != nil {
-		a.sendError(w, http.StatusBadRequest, err.Error())
+		a.sendValidationError(w, err)
 		return
 	}
+	timeOperation(r, "allconfig_check", req.IncludeTimings)
 
 	// Create connector
 	connector, err := a.createConnector(&req.DatabaseConnectionRequest)
 	if err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Failed to create connector: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
 		return
 	}
 
-	// Connect to database
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Wait for a free slot on the connection
+	release, ok := a.acquireSlot(w, r, a.connectionKey(&req.DatabaseConnectionRequest))
+	if !ok {
+		return
+	}
+	defer release()
 
-	if err := connector.Connect(ctx); err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Connection failed: %v", err))
+	// Connect to database
+	if err := a.connectWithin(r.Context(), connector, &req.DatabaseConnectionRequest); err != nil {
+		a.sendDatabaseError(w, "Connection failed", err)
 		return
 	}
-	defer connector.Close()
+	defer connector.Close(r.Context())
+
+	op := a.operationPhase(r.Context(), &req.DatabaseConnectionRequest)
+	defer op.cancel()
+	ctx := withConfigSchema(op.ctx, connector, req.Schema)
+
+	// Repair first, so the rest of the check reports the repaired tables
+	var repaired []string
+	if req.Repair {
+		repaired, err = a.repairConfigSchema(ctx, connector, req.tableSchema(), req.TableName)
+		a.forgetLegacyTable(&req)
+		if err != nil {
+			a.sendDatabaseError(w, "Failed to repair allconfig tables", op.err(err))
+			return
+		}
+	}
 
 	// Check if allconfig table exists
-	exists, err := a.checkTableExists(ctx, connector, req.Database, req.TableName)
+	exists, err := a.checkTableExists(ctx, connector, req.tableSchema(), req.TableName)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to check table existence: %v", err))
+		a.sendDatabaseError(w, "Failed to check table existence", op.err(err))
 		return
 	}
 
@@ -276,7 +582,7 @@ func (a *API) AllConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 	if exists {
 		// Get table structure
-		structure, err := a.getTableStructure(ctx, connector, req.Database, req.TableName)
+		structure, err := a.getTableStructure(ctx, connector, req.tableSchema(), req.TableName)
 		if err != nil {
 			response["warning"] = fmt.Sprintf("Table exists but couldn't get structure: %v", err)
 		} else {
@@ -291,7 +597,19 @@ func (a *API) AllConfigHandler(w http.ResponseWriter, r *http.Request) {
 			response["config_count"] = count
 		}
 	} else {
-		response["create_table_sql"] = a.getCreateTableSQL(connector.GetType(), req.TableName)
+		response["create_table_sql"] = a.getCreateTableSQL(ctx, connector.GetType(), req.TableName)
+	}
+
+	// Compare both tables with those create_table creates, down to their columns and indexes
+	health, err := a.checkConfigSchema(ctx, connector, req.tableSchema(), req.TableName)
+	if err != nil {
+		response["warning"] = fmt.Sprintf("Couldn't check the tables for drift: %v", err)
+	} else {
+		response["schema"] = health
+		response["legacy_mode"] = health.legacy()
+	}
+	if req.Repair {
+		response["repaired"] = repaired
 	}
 
 	a.sendSuccess(w, response, "AllConfig table check completed")
@@ -299,141 +617,243 @@ func (a *API) AllConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 // AllConfigOperationHandler handles operations on allconfig table
 func (a *API) AllConfigOperationHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		a.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if !a.allowMethod(w, r, http.MethodPost) {
 		return
 	}
 
+	w, r = a.timeRequest(w, r)
+
 	var req AllConfigOperationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
 		return
 	}
 
-	// Set default table name if not provided
-	if req.TableName == "" {
-		req.TableName = "allconfig"
+	// Set default table name if not provided, or the tenant's whatever the request names
+	tenant, err := a.resolveTenant(r)
+	if err != nil {
+		a.sendRequestError(w, err)
+		return
 	}
+	req.TableName = a.tenantTable(tenant, req.TableName)
+	req.Schema = a.configSchema(req.Type, req.Schema)
 
 	// Validate connection request
 	if err := a.validateConnectionRequest(&req.DatabaseConnectionRequest); err != nil {
-		a.sendError(w, http.StatusBadRequest, err.Error())
+		a.sendValidationError(w, err)
 		return
 	}
 
 	if req.Operation == "" {
-		a.sendError(w, http.StatusBadRequest, "Operation is required")
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, "Operation is required")
+		return
+	}
+
+	// Reject unknown operations and missing fields before connecting
+	spec, err := a.checkAllConfigRequest(&req, req.Type)
+	if err != nil {
+		a.sendRequestError(w, err)
 		return
 	}
+	if err := checkConfigStreamFormat(spec, r.URL.Query().Get("format")); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+	timeOperation(r, spec.Name, req.IncludeTimings)
 
 	// Create connector
 	connector, err := a.createConnector(&req.DatabaseConnectionRequest)
 	if err != nil {
-		a.sendError(w, http.StatusBadRequest, fmt.Sprintf("Failed to create connector: %v", err))
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
 		return
 	}
 
-	// Connect to database
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Wait for a free slot on the connection
+	release, ok := a.acquireSlot(w, r, a.connectionKey(&req.DatabaseConnectionRequest))
+	if !ok {
+		return
+	}
+	defer release()
 
-	if err := connector.Connect(ctx); err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Connection failed: %v", err))
+	// Connect to database
+	if err := a.connectWithin(r.Context(), connector, &req.DatabaseConnectionRequest); err != nil {
+		a.sendDatabaseError(w, "Connection failed", err)
 		return
 	}
-	defer connector.Close()
+	defer connector.Close(r.Context())
 
 	// Execute allconfig operation
-	result, err := a.executeAllConfigOperation(ctx, connector, &req)
+	op := a.operationPhase(r.Context(), &req.DatabaseConnectionRequest)
+	defer op.cancel()
+	result, err := a.executeAllConfigOperation(op.ctx, connector, &req)
+	if spec.Mutates && !req.DryRun {
+		a.invalidateQueryCache(&req.DatabaseConnectionRequest)
+	}
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Operation failed: %v", err))
+		a.sendDatabaseError(w, "Operation failed", op.err(err))
 		return
 	}
 
-	a.sendSuccess(w, result, fmt.Sprintf("AllConfig operation '%s' completed", req.Operation))
+	// Values of sensitive keys are masked unless the caller has the bypass role
+	result = a.masker(r, a.connectionName(&req.DatabaseConnectionRequest)).configs(result)
+	if r.URL.Query().Get("format") == StreamFormatJSONL {
+		a.streamConfigs(r.Context(), w, result)
+		return
+	}
+	if req.DryRun {
+		a.sendAllConfigSuccess(w, &req, spec, result, fmt.Sprintf("AllConfig operation '%s' previewed, nothing was written", req.Operation))
+		return
+	}
+	a.sendAllConfigSuccess(w, &req, spec, result, fmt.Sprintf("AllConfig operation '%s' completed", req.Operation))
 }
 
 // Helper methods
 
 func (a *API) validateConnectionRequest(req *DatabaseConnectionRequest) error {
-	if req.Type == "" {
-		return fmt.Errorf("database type is required")
+	return a.validateConnectionFields(req, true)
+}
+
+// validateOperationRequest validates the connection details of an /execute request.
+// The database name is optional for list_databases since it enumerates the databases on the host.
+func (a *API) validateOperationRequest(req *DatabaseOperationRequest) error {
+	return a.validateConnectionFields(&req.DatabaseConnectionRequest, req.Operation != "list_databases", checkUseDatabase(req)...)
+}
+
+// validateConnectionFields checks the database type and the connection settings, reporting
+// every problem, after those already found, in a single connectors.ValidationError
+func (a *API) validateConnectionFields(req *DatabaseConnectionRequest, requireDatabase bool, problems ...string) error {
+	switch {
+	case req.Type == "":
+		problems = append(problems, "database type is required")
+	case !connectors.IsRegistered(req.Type):
+		problems = append(problems, fmt.Sprintf("unsupported database type: %s", req.Type))
 	}
-	if req.Type != "mysql" && req.Type != "postgresql" && req.Type != "mongodb" {
-		return fmt.Errorf("unsupported database type: %s", req.Type)
+
+	config := req.connectionConfig()
+	validate := config.Validate
+	if !requireDatabase {
+		validate = config.ValidateServer
 	}
-	if req.Host == "" {
-		return fmt.Errorf("host is required")
+	var invalid *connectors.ValidationError
+	if err := validate(); errors.As(err, &invalid) {
+		problems = append(problems, invalid.Problems...)
+	} else if err != nil {
+		problems = append(problems, err.Error())
 	}
-	if req.Port <= 0 {
-		return fmt.Errorf("valid port is required")
+	if connectors.IsRegistered(req.Type) {
+		if err := config.CheckURI(req.Type); err != nil {
+			problems = append(problems, err.Error())
+		}
 	}
-	if req.Database == "" {
-		return fmt.Errorf("database name is required")
+	problems = append(problems, a.phaseTimeouts.checkTimeouts(req)...)
+	problems = append(problems, a.policy.checkMultiStatements(req)...)
+
+	if len(problems) > 0 {
+		return &connectors.ValidationError{Problems: problems}
 	}
 	return nil
 }
 
-func (a *API) createConnector(req *DatabaseConnectionRequest) (connectors.DBConnector, error) {
-	config := &connectors.ConnectionConfig{
+// connectionConfig converts the request into the connector configuration
+func (req *DatabaseConnectionRequest) connectionConfig() *connectors.ConnectionConfig {
+	return &connectors.ConnectionConfig{
 		Host:     req.Host,
 		Port:     req.Port,
 		Username: req.Username,
 		Password: req.Password,
 		Database: req.Database,
+		Schema:   req.Schema,
 		SSLMode:  req.SSLMode,
+		URI:      req.URI,
+		Labels:   req.labels(),
+
+		MultiStatements: req.MultiStatements,
 	}
+}
 
-	switch req.Type {
-	case "mysql":
-		return connectors.NewMySQLConnector(config), nil
-	case "postgresql":
-		return connectors.NewPostgreSQLConnector(config), nil
-	case "mongodb":
-		return connectors.NewMongoDBConnector(config), nil
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", req.Type)
+// labels returns the labels of a request's connection: its label, as the connection label
+func (req *DatabaseConnectionRequest) labels() map[string]string {
+	if req.Label == "" {
+		return nil
+	}
+	return map[string]string{connectors.ConnectionLabel: req.Label}
+}
+
+// tableSchema returns the schema the allconfig tables are looked up in: schema when set, otherwise
+// PostgreSQL's public schema or, left empty, the MySQL database connected to
+func (req *DatabaseConnectionRequest) tableSchema() string {
+	if req.Schema == "" && req.Type == "postgresql" {
+		return "public"
 	}
+	return req.Schema
+}
+
+func (a *API) createConnector(req *DatabaseConnectionRequest) (connectors.DBConnector, error) {
+	return connectors.New(req.Type, req.connectionConfig(), connectors.WithLogger(a.logger), connectors.WithConnectTimeout(a.phaseTimeouts.connectTimeout(req)),
+		connectors.WithStatementLogger(a.statements))
 }
 
 func (a *API) executeOperation(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest) (interface{}, error) {
+	if err := checkExecuteOperation(req, connector.GetType()); err != nil {
+		return nil, err
+	}
+	if isSchemaOperation(req.Operation) {
+		return a.executeSchemaOperation(ctx, connector, req)
+	}
+	if req.Operation == "list_databases" {
+		return a.listDatabases(ctx, connector, req.IncludeSystem)
+	}
+	if req.Operation == explainOperation && isBuiltinType(connector.GetType()) {
+		return a.explain(ctx, connector, req)
+	}
+
 	switch connector.GetType() {
 	case "mysql", "postgresql":
 		return a.executeSQLOperation(ctx, connector, req)
-	case "mongodb":
-		return a.executeMongoOperation(ctx, connector, req)
 	default:
-		return nil, fmt.Errorf("unsupported database type")
+		// MongoDB and registered custom drivers receive the operation and params as they are
+		return a.executeMongoOperation(ctx, connector, req)
 	}
 }
 
 func (a *API) executeSQLOperation(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest) (interface{}, error) {
 	switch req.Operation {
 	case "query", "select":
-		if req.Query == "" {
-			return nil, fmt.Errorf("query is required for SQL select operation")
-		}
-		
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
 		rows, err := connector.Query(ctx, req.Query, req.Args...)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
 
-		return a.rowsToMap(rows)
+		if req.wantsColumns() {
+			result, err := a.readColumns(ctx, rows, cancel, req.resultFormat() == ResultFormatTabular)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+		return a.readResult(ctx, rows, cancel)
 		
 	case "insert", "update", "delete", "execute":
-		if req.Query == "" {
-			return nil, fmt.Errorf("query is required for SQL operation")
+		if req.returnsRows() {
+			result, err := a.executeReturning(ctx, connector, req)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
 		}
-		
 		return connector.Execute(ctx, req.Operation, map[string]interface{}{
 			"query": req.Query,
-			"args":  req.Args,
+			"args":  []interface{}(req.Args),
 		})
 		
+	case "call":
+		return a.call(ctx, connector, req)
+		
 	default:
-		return nil, fmt.Errorf("unsupported SQL operation: %s", req.Operation)
+		return nil, unsupportedOperationError(req.Operation, sqlOperations)
 	}
 }
 
@@ -446,12 +866,24 @@ func (a *API) executeMongoOperation(ctx context.Context, connector connectors.DB
 }
 
 func (a *API) rowsToMap(rows *sql.Rows) ([]map[string]interface{}, error) {
-	columns, err := rows.Columns()
+	var results []map[string]interface{}
+	err := a.scanRows(rows, func(row map[string]interface{}) error {
+		results = append(results, row)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return results, nil
+}
+
+// scanRows calls fn with each row as a column-name map, converting []byte values to strings
+func (a *API) scanRows(rows *sql.Rows, fn func(row map[string]interface{}) error) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
 
-	var results []map[string]interface{}
 	for rows.Next() {
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -460,7 +892,7 @@ func (a *API) rowsToMap(rows *sql.Rows) ([]map[string]interface{}, error) {
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, err
+			return err
 		}
 
 		row := make(map[string]interface{})
@@ -469,12 +901,17 @@ func (a *API) rowsToMap(rows *sql.Rows) ([]map[string]interface{}, error) {
 			if b, ok := val.([]byte); ok {
 				val = string(b)
 			}
+			if t, ok := val.(time.Time); ok {
+				val = t.UTC()
+			}
 			row[col] = val
 		}
-		results = append(results, row)
+		if err := fn(row); err != nil {
+			return err
+		}
 	}
 
-	return results, nil
+	return nil
 }
 
 func (a *API) sendSuccess(w http.ResponseWriter, data interface{}, message string) {
@@ -487,184 +924,101 @@ func (a *API) sendSuccess(w http.ResponseWriter, data interface{}, message strin
 	a.sendJSON(w, http.StatusOK, response)
 }
 
-func (a *API) sendError(w http.ResponseWriter, statusCode int, errorMsg string) {
+// sendCachedSuccess responds with data served from the query cache and its age
+func (a *API) sendCachedSuccess(w http.ResponseWriter, data interface{}, age time.Duration) {
+	ageMs := durationMs(age)
+	response := DatabaseResponse{
+		Success:    true,
+		Message:    "Operation executed successfully",
+		Data:       data,
+		Cached:     true,
+		CacheAgeMs: &ageMs,
+		Timestamp:  time.Now(),
+	}
+	a.sendJSON(w, http.StatusOK, response)
+}
+
+// sendError responds with a failure; code is one of the ErrorCode constants
+func (a *API) sendError(w http.ResponseWriter, statusCode int, code string, errorMsg string) {
 	response := DatabaseResponse{
 		Success:   false,
 		Error:     errorMsg,
+		ErrorCode: code,
 		Timestamp: time.Now(),
 	}
 	a.sendJSON(w, statusCode, response)
 }
 
+// sendValidationError responds with 400, listing each problem of a connectors.ValidationError in details.errors
+func (a *API) sendValidationError(w http.ResponseWriter, err error) {
+	response := DatabaseResponse{
+		Success:   false,
+		Error:     err.Error(),
+		ErrorCode: ErrorCodeValidation,
+		Timestamp: time.Now(),
+	}
+	var invalid *connectors.ValidationError
+	if errors.As(err, &invalid) {
+		response.Details = map[string]interface{}{"errors": invalid.Problems}
+	}
+	a.sendJSON(w, http.StatusBadRequest, response)
+}
+
 func (a *API) sendJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	// Echo the request ID set by requestIDMiddleware in the body as well as the header
+	if response, ok := data.(DatabaseResponse); ok && response.RequestID == "" {
+		response.RequestID = w.Header().Get(requestid.Header)
+		data = response
+	}
+	if tw, ok := w.(*timedWriter); ok {
+		if response, ok := data.(DatabaseResponse); ok {
+			data = a.finishTimings(tw.timer, response)
+		}
+	}
+	data = utcTimes(data)
+
+	// Encode before writing the header so an encoding failure still yields a well-formed error response
+	body, err := json.Marshal(data)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		body, _ = json.Marshal(DatabaseResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to encode response: %v", err),
+			ErrorCode: ErrorCodeInternal,
+			RequestID: w.Header().Get(requestid.Header),
+			Timestamp: time.Now(),
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(data)
+	w.Write(append(body, '\n'))
 }
 
 // AllConfig helper functions
 
-func (a *API) checkTableExists(ctx context.Context, connector connectors.DBConnector, databaseName string, tableName string) (bool, error) {
-	switch connector.GetType() {
-	case "mysql":
-		// Use specific database name from API input instead of DATABASE()
-		query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?"
-		rows, err := connector.Query(ctx, query, databaseName, tableName)
-		if err != nil {
-			return false, fmt.Errorf("failed to check table existence in MySQL: %w", err)
-		}
-		defer rows.Close()
-		
-		if rows.Next() {
-			var count int
-			if err := rows.Scan(&count); err != nil {
-				return false, fmt.Errorf("failed to scan table count: %w", err)
-			}
-			return count > 0, nil
-		}
-		return false, nil
-		
-	case "postgresql":
-		// For PostgreSQL, check in the specified database
-		// If databaseName is provided, use it as schema, otherwise use 'public'
-		schema := "public"
-		if databaseName != "" {
-			// In PostgreSQL, we can check if a specific schema exists and use it
-			schemaCheckQuery := "SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = $1"
-			schemaRows, err := connector.Query(ctx, schemaCheckQuery, databaseName)
-			if err == nil {
-				defer schemaRows.Close()
-				if schemaRows.Next() {
-					var schemaCount int
-					if err := schemaRows.Scan(&schemaCount); err == nil && schemaCount > 0 {
-						schema = databaseName
-					}
-				}
-			}
-		}
-		
-		query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = $1 AND table_name = $2"
-		rows, err := connector.Query(ctx, query, schema, tableName)
-		if err != nil {
-			return false, fmt.Errorf("failed to check table existence in PostgreSQL: %w", err)
-		}
-		defer rows.Close()
-		
-		if rows.Next() {
-			var count int
-			if err := rows.Scan(&count); err != nil {
-				return false, fmt.Errorf("failed to scan table count: %w", err)
-			}
-			return count > 0, nil
-		}
-		return false, nil
-		
-	case "mongodb":
-		// For MongoDB, we need to check collections in the specific database
-		// MongoDB client can access multiple databases, so we'll pass the database name as a parameter
-		params := map[string]interface{}{
-			"filter": map[string]interface{}{"name": tableName},
-		}
-		
-		// If a specific database name is provided, include it in the params
-		if databaseName != "" {
-			params["database"] = databaseName
-		}
-		
-		result, err := connector.Execute(ctx, "listCollections", params)
-		if err != nil {
-			return false, fmt.Errorf("failed to check collection existence in MongoDB: %w", err)
-		}
-		
-		// Handle different result types from MongoDB
-		switch v := result.(type) {
-		case []interface{}:
-			return len(v) > 0, nil
-		case []map[string]interface{}:
-			return len(v) > 0, nil
-		case map[string]interface{}:
-			// If it's a map, check if it has collections array
-			if cols, exists := v["collections"]; exists {
-				if colArray, ok := cols.([]interface{}); ok {
-					return len(colArray) > 0, nil
-				}
-			}
-			return false, nil
-		default:
-			return false, fmt.Errorf("unexpected result type from MongoDB listCollections: %T", v)
-		}
-		
-	default:
-		return false, fmt.Errorf("unsupported database type: %s", connector.GetType())
+// checkTableExists reports whether a table exists in schema; see tableSchema
+func (a *API) checkTableExists(ctx context.Context, connector connectors.DBConnector, schema string, tableName string) (bool, error) {
+	tables, err := a.listTables(ctx, connector, schema, tableName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check table existence: %w", err)
 	}
+	return len(tables) > 0, nil
 }
 
-func (a *API) getTableStructure(ctx context.Context, connector connectors.DBConnector, databaseName string, tableName string) (interface{}, error) {
-	switch connector.GetType() {
-	case "mysql":
-		// For MySQL, we can use the database.table format or just table if connected to right database
-		var query string
-		if databaseName != "" {
-			query = "DESCRIBE " + databaseName + "." + tableName
-		} else {
-			query = "DESCRIBE " + tableName
-		}
-		rows, err := connector.Query(ctx, query)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get table structure for MySQL: %w", err)
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "postgresql":
-		// For PostgreSQL, check in the specified schema
-		schema := "public"
-		if databaseName != "" {
-			// Check if the schema exists
-			schemaCheckQuery := "SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = $1"
-			schemaRows, err := connector.Query(ctx, schemaCheckQuery, databaseName)
-			if err == nil {
-				defer schemaRows.Close()
-				if schemaRows.Next() {
-					var schemaCount int
-					if err := schemaRows.Scan(&schemaCount); err == nil && schemaCount > 0 {
-						schema = databaseName
-					}
-				}
-			}
-		}
-		
-		query := `SELECT column_name, data_type, is_nullable, column_default 
-				  FROM information_schema.columns 
-				  WHERE table_schema = $1 AND table_name = $2 ORDER BY ordinal_position`
-		rows, err := connector.Query(ctx, query, schema, tableName)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get table structure for PostgreSQL: %w", err)
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "mongodb":
-		// For MongoDB, we'll sample documents to infer structure
-		// The database name is already handled by the connection
-		result, err := connector.Execute(ctx, "find", map[string]interface{}{
-			"collection": tableName,
-			"limit":      1,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get collection structure for MongoDB: %w", err)
-		}
-		return result, nil
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", connector.GetType())
+// getTableStructure returns the normalized columns of a table, the same shape for every database
+func (a *API) getTableStructure(ctx context.Context, connector connectors.DBConnector, schema string, tableName string) (interface{}, error) {
+	columns, err := a.describeTable(ctx, connector, schema, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table structure: %w", err)
 	}
+	return columns, nil
 }
 
 func (a *API) getConfigCount(ctx context.Context, connector connectors.DBConnector, tableName string) (int64, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := "SELECT COUNT(*) FROM " + tableName
+		query := "SELECT COUNT(*) FROM " + sqlTable(ctx, tableName)
 		rows, err := connector.Query(ctx, query)
 		if err != nil {
 			return 0, err
@@ -702,7 +1056,9 @@ func (a *API) getConfigCount(ctx context.Context, connector connectors.DBConnect
 	}
 }
 
-func (a *API) getCreateTableSQL(dbType, tableName string) string {
+func (a *API) getCreateTableSQL(ctx context.Context, dbType, tableName string) string {
+	approvalTable := a.approvalTable(tableName)
+	table, approval := sqlTable(ctx, tableName), sqlTable(ctx, approvalTable)
 	switch dbType {
 	case "mysql":
 		return fmt.Sprintf(`CREATE TABLE %s (
@@ -710,6 +1066,7 @@ func (a *API) getCreateTableSQL(dbType, tableName string) string {
     config_key VARCHAR(255) NOT NULL UNIQUE,
     config_value TEXT,
     description TEXT,
+    tags JSON,
     status ENUM('approved', 'pending', 'rejected') DEFAULT 'approved',
     maker_id VARCHAR(255),
     checker_id VARCHAR(255),
@@ -717,16 +1074,19 @@ func (a *API) getCreateTableSQL(dbType, tableName string) string {
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     approved_at TIMESTAMP NULL,
     approval_comment TEXT,
+    expires_at DATETIME NULL,
     INDEX idx_config_key (config_key),
     INDEX idx_status (status),
-    INDEX idx_maker_id (maker_id)
+    INDEX idx_maker_id (maker_id),
+    INDEX idx_expires_at (expires_at)
 );
 
-CREATE TABLE %s_approval_requests (
+CREATE TABLE %s (
     request_id VARCHAR(36) PRIMARY KEY,
     config_key VARCHAR(255) NOT NULL,
     config_value TEXT,
     description TEXT,
+    tags JSON,
     operation ENUM('create', 'update', 'delete') NOT NULL,
     maker_id VARCHAR(255) NOT NULL,
     checker_id VARCHAR(255),
@@ -735,32 +1095,39 @@ CREATE TABLE %s_approval_requests (
     processed_at TIMESTAMP NULL,
     approval_comment TEXT,
     previous_value TEXT,
+    expires_at DATETIME NULL,
     INDEX idx_status (status),
     INDEX idx_maker_id (maker_id),
     INDEX idx_checker_id (checker_id),
     INDEX idx_config_key (config_key)
-);`, tableName, tableName)
+);
+
+-- case_insensitive lookups compare config_key with its collation, case-insensitive by default, and use its index.
+-- A case-sensitive (_bin or _cs) collation makes them miss keys differing in case.`, table, approval)
 		
 	case "postgresql":
-		return fmt.Sprintf(`CREATE TABLE %s (
+		return fmt.Sprintf(`CREATE TABLE %[2]s (
     id SERIAL PRIMARY KEY,
     config_key VARCHAR(255) NOT NULL UNIQUE,
     config_value TEXT,
     description TEXT,
+    tags JSONB,
     status VARCHAR(20) DEFAULT 'approved' CHECK (status IN ('approved', 'pending', 'rejected')),
     maker_id VARCHAR(255),
     checker_id VARCHAR(255),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     approved_at TIMESTAMP,
-    approval_comment TEXT
+    approval_comment TEXT,
+    expires_at TIMESTAMP
 );
 
-CREATE TABLE %s_approval_requests (
+CREATE TABLE %[3]s (
     request_id VARCHAR(36) PRIMARY KEY,
     config_key VARCHAR(255) NOT NULL,
     config_value TEXT,
     description TEXT,
+    tags JSONB,
     operation VARCHAR(20) NOT NULL CHECK (operation IN ('create', 'update', 'delete')),
     maker_id VARCHAR(255) NOT NULL,
     checker_id VARCHAR(255),
@@ -768,15 +1135,22 @@ CREATE TABLE %s_approval_requests (
     requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     processed_at TIMESTAMP,
     approval_comment TEXT,
-    previous_value TEXT
+    previous_value TEXT,
+    expires_at TIMESTAMP
 );
 
-CREATE INDEX idx_%s_config_key ON %s (config_key);
-CREATE INDEX idx_%s_status ON %s (status);
-CREATE INDEX idx_%s_maker_id ON %s (maker_id);
-CREATE INDEX idx_%s_approval_status ON %s_approval_requests (status);
-CREATE INDEX idx_%s_approval_maker ON %s_approval_requests (maker_id);
-CREATE INDEX idx_%s_approval_checker ON %s_approval_requests (checker_id);`, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName)
+CREATE INDEX idx_%[1]s_config_key ON %[2]s (config_key);
+CREATE INDEX idx_%[1]s_status ON %[2]s (status);
+CREATE INDEX idx_%[1]s_maker_id ON %[2]s (maker_id);
+CREATE INDEX idx_%[1]s_tags ON %[2]s USING GIN (tags);
+CREATE INDEX idx_%[1]s_expires_at ON %[2]s (expires_at);
+CREATE INDEX idx_%[1]s_approval_status ON %[3]s (status);
+CREATE INDEX idx_%[1]s_approval_maker ON %[3]s (maker_id);
+CREATE INDEX idx_%[1]s_approval_checker ON %[3]s (checker_id);
+
+-- case_insensitive lookups compare LOWER(config_key), which the config_key indexes do not serve.
+-- Where they are common, add an expression index:
+-- CREATE INDEX idx_%[1]s_config_key_lower ON %[2]s (LOWER(config_key));`, tableName, table, approval)
 		
 	case "mongodb":
 		return fmt.Sprintf(`// MongoDB collection '%s' with sample document:
@@ -785,22 +1159,25 @@ CREATE INDEX idx_%s_approval_checker ON %s_approval_requests (checker_id);`, tab
     "config_key": "unique_key_name",
     "config_value": "configuration_value",
     "description": "Description of the configuration",
+    "tags": ["team:payments", "pii"],
     "status": "approved",
     "maker_id": "user123",
     "checker_id": "admin456",
     "created_at": new Date(),
     "updated_at": new Date(),
     "approved_at": new Date(),
-    "approval_comment": "Approved by checker"
+    "approval_comment": "Approved by checker",
+    "expires_at": new Date()
 }
 
-// MongoDB collection '%s_approval_requests' with sample document:
+// MongoDB collection '%s' with sample document:
 {
     "_id": ObjectId(),
     "request_id": "uuid-string",
     "config_key": "configuration_key",
     "config_value": "new_value",
     "description": "Description",
+    "tags": ["team:payments"],
     "operation": "create",
     "maker_id": "user123",
     "checker_id": "admin456",
@@ -808,17 +1185,24 @@ CREATE INDEX idx_%s_approval_checker ON %s_approval_requests (checker_id);`, tab
     "requested_at": new Date(),
     "processed_at": new Date(),
     "approval_comment": "Looks good",
-    "previous_value": "old_value"
+    "previous_value": "old_value",
+    "expires_at": new Date()
 }
 
 // Create indexes:
 db.%s.createIndex({"config_key": 1}, {"unique": true});
 db.%s.createIndex({"status": 1});
 db.%s.createIndex({"maker_id": 1});
-db.%s_approval_requests.createIndex({"request_id": 1}, {"unique": true});
-db.%s_approval_requests.createIndex({"status": 1});
-db.%s_approval_requests.createIndex({"maker_id": 1});
-db.%s_approval_requests.createIndex({"config_key": 1});`, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName, tableName)
+db.%s.createIndex({"tags": 1});
+db.%s.createIndex({"expires_at": 1}, {"expireAfterSeconds": 0});
+db.%s.createIndex({"request_id": 1}, {"unique": true});
+db.%s.createIndex({"status": 1});
+db.%s.createIndex({"maker_id": 1});
+db.%s.createIndex({"config_key": 1});
+
+// case_insensitive lookups match config_key with a case-insensitive collation, which only an index with the
+// same collation serves. Where they are common, add one:
+// db.%[1]s.createIndex({"config_key": 1}, {"name": "config_key_ci", "collation": {"locale": "en", "strength": 2}});`, tableName, approvalTable, tableName, tableName, tableName, tableName, tableName, approvalTable, approvalTable, approvalTable, approvalTable)
 		
 	default:
 		return "Unsupported database type"
@@ -826,159 +1210,197 @@ db.%s_approval_requests.createIndex({"config_key": 1});`, tableName, tableName,
 }
 
 func (a *API) executeAllConfigOperation(ctx context.Context, connector connectors.DBConnector, req *AllConfigOperationRequest) (interface{}, error) {
-	switch req.Operation {
+	spec, err := a.checkAllConfigRequest(req, connector.GetType())
+	if err != nil {
+		return nil, err
+	}
+	req.Schema = a.configSchema(connector.GetType(), req.Schema)
+	ctx = withConfigSchema(ctx, connector, req.Schema)
+	if a.caseInsensitive(req) {
+		if err := a.resolveKeyCase(ctx, connector, req); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Name == "get_operation" {
+		return a.getConfigOperation(req.TableName, req.OperationID)
+	}
+	// The writes of a batch or import share an operation ID, returned with its result; a dry run writes nothing
+	if _, dryRun := connector.(*dryRunConnector); (spec.Batch || spec.Name == "import") && !req.DryRun && !dryRun {
+		ctx = withConfigOperation(ctx, spec.Name, req.TableName)
+	}
+	if spec.Name == "create_table" || spec.Name == "drop_table" || spec.Name == "migrate_table" {
+		a.forgetLegacyTable(&req.AllConfigRequest)
+	} else if a.legacyMode(ctx, connector, &req.AllConfigRequest) {
+		return a.executeLegacyConfigOperation(ctx, connector, req, spec)
+	}
+	if req.DryRun {
+		return a.dryRunAllConfigOperation(ctx, connector, req)
+	}
+
+	switch spec.Name {
 	// Table management
 	case "create_table":
-		return a.createAllConfigTable(ctx, connector, req.TableName)
+		return a.createAllConfigTable(ctx, connector, req.tableSchema(), req.TableName)
 	case "drop_table":
-		return a.dropAllConfigTable(ctx, connector, req.TableName)
+		return a.dropAllConfigTable(ctx, connector, req.tableSchema(), req.TableName)
+	case "migrate_table":
+		return a.migrateConfigTable(ctx, connector, req.tableSchema(), req.TableName)
 		
 	// MAKER-CHECKER CREATE operations
-	case "submit_create":
-		if req.Key == "" || req.MakerID == "" {
-			return nil, fmt.Errorf("config key and maker_id are required for submit_create operation")
+	case "submit_create", "submit_update", "submit_delete":
+		service := a.configService(connector).ForConnection(a.connectionKey(&req.DatabaseConnectionRequest))
+		submitted, err := service.Submit(ctx, connector, submitRequestOf(req, strings.TrimPrefix(spec.Name, "submit_")))
+		if err != nil {
+			return nil, err
 		}
-		return a.submitConfigForApproval(ctx, connector, req.TableName, "create", req.Key, req.Value, req.Description, req.MakerID, nil)
+		return submitted, nil
 		
-	case "submit_update":
-		if req.Key == "" || req.MakerID == "" {
-			return nil, fmt.Errorf("config key and maker_id are required for submit_update operation")
+	// CHECKER APPROVAL operations
+	case "approve_request", "reject_request":
+		service := a.ConfigService().ForConnection(a.connectionKey(&req.DatabaseConnectionRequest))
+		decide := service.Approve
+		if spec.Name == "reject_request" {
+			decide = service.Reject
 		}
-		return a.submitConfigForApproval(ctx, connector, req.TableName, "update", req.Key, req.Value, req.Description, req.MakerID, nil)
-		
-	case "submit_delete":
-		if req.Key == "" || req.MakerID == "" {
-			return nil, fmt.Errorf("config key and maker_id are required for submit_delete operation")
-		}
-		return a.submitConfigForApproval(ctx, connector, req.TableName, "delete", req.Key, nil, req.Description, req.MakerID, nil)
-		
-	// CHECKER APPROVAL operations
-	case "approve_request":
-		if req.RequestID == "" || req.CheckerID == "" {
-			return nil, fmt.Errorf("request_id and checker_id are required for approve_request operation")
-		}
-		return a.approveRequest(ctx, connector, req.Database, req.TableName, req.RequestID, req.CheckerID, req.ApprovalComment)
-		
-	case "reject_request":
-		if req.RequestID == "" || req.CheckerID == "" {
-			return nil, fmt.Errorf("request_id and checker_id are required for reject_request operation")
+		decision, err := decide(ctx, connector, decisionRequestOf(req))
+		if err != nil {
+			return nil, err
 		}
-		return a.rejectRequest(ctx, connector, req.Database, req.TableName, req.RequestID, req.CheckerID, req.ApprovalComment)
+		return decision, nil
 		
 	case "get_pending_approvals":
-		return a.getPendingApprovals(ctx, connector, req.TableName, req.Limit, req.Offset)
+		return a.ConfigService().Pending(ctx, connector, listRequestOf(req))
+		
+	case "get_pending_with_current":
+		return a.getPendingWithCurrent(ctx, connector, req.TableName, req.Key, req.Limit, req.Offset)
 		
 	case "get_my_requests":
-		if req.MakerID == "" {
-			return nil, fmt.Errorf("maker_id is required for get_my_requests operation")
-		}
-		return a.getMyRequests(ctx, connector, req.TableName, req.MakerID, req.Limit, req.Offset)
+		return a.ConfigService().MyRequests(ctx, connector, listRequestOf(req))
 		
 	case "get_approval_history":
-		return a.getApprovalHistory(ctx, connector, req.TableName, req.Limit, req.Offset)
+		return a.ConfigService().History(ctx, connector, listRequestOf(req))
 		
 	// LEGACY DIRECT operations (bypass approval - for admin use)
-	case "direct_create", "create", "set_config":
-		if req.Key == "" {
-			return nil, fmt.Errorf("config key is required for create operation")
-		}
-		return a.createConfigDirect(ctx, connector, req.Database, req.TableName, req.Key, req.Value, req.Description, req.MakerID)
-		
-	case "direct_create_batch", "create_batch", "set_multiple":
-		if req.ConfigItems != nil && len(req.ConfigItems) > 0 {
-			return a.createMultipleConfigsDirect(ctx, connector, req.Database, req.TableName, req.ConfigItems)
+	case "direct_create":
+		return a.ConfigService().Create(ctx, connector, setRequestOf(req))
+		
+	case "direct_create_batch":
+		if req.Upsert {
+			items := req.ConfigItems
+			if len(items) == 0 {
+				items = configMapItems(req.Configs)
+			}
+			return a.upsertMultipleConfigsDirect(ctx, connector, req.TableName, items, req.ChunkSize, configBatchOptionsOf(req))
 		}
-		if req.Configs != nil && len(req.Configs) > 0 {
-			return a.setMultipleConfigs(ctx, connector, req.TableName, req.Configs)
+		if len(req.ConfigItems) > 0 {
+			return a.createMultipleConfigsDirect(ctx, connector, req.TableName, req.ConfigItems, configBatchOptionsOf(req))
 		}
-		return nil, fmt.Errorf("config_items or configs are required for batch create operation")
+		return a.setMultipleConfigs(ctx, connector, req.TableName, req.Configs, configBatchOptionsOf(req))
+		
+	case "import":
+		return a.importConfigs(ctx, connector, req.tableSchema(), req.TableName, req.ConfigItems, req.ChunkSize)
 		
 	// READ operations (only show APPROVED configs)
-	case "read", "get_config":
-		if req.Key == "" {
-			return nil, fmt.Errorf("config key is required for read operation")
+	case "read":
+		if resolvesFallback(req) {
+			return typingOf(req).apply(a.resolveConfig(ctx, connector, req.TableName, fallbackKeys(req), req.DefaultValue))
 		}
-		return a.readApprovedConfig(ctx, connector, req.Database, req.TableName, req.Key)
+		return typingOf(req).apply(a.ConfigService().Read(ctx, connector, readRequestOf(req)))
 		
-	case "read_all", "get_all":
-		return a.readAllApprovedConfigs(ctx, connector, req.Database, req.TableName, req.Limit, req.Offset)
-		
-	case "search":
-		if req.SearchTerm == "" {
-			return nil, fmt.Errorf("search_term is required for search operation")
-		}
-		return a.searchApprovedConfigs(ctx, connector, req.TableName, req.SearchTerm, req.Limit, req.Offset)
+	case "read_all":
+		return a.ConfigService().ReadAll(ctx, connector, listRequestOf(req))
 		
-	case "filter":
-		if req.Filter == nil || len(req.Filter) == 0 {
-			return nil, fmt.Errorf("filter criteria is required for filter operation")
-		}
-		return a.filterApprovedConfigs(ctx, connector, req.TableName, req.Filter, req.Limit, req.Offset)
+	case "search", "filter":
+		return a.ConfigService().Search(ctx, connector, searchRequestOf(req))
 		
 	// ADMIN READ operations (show ALL configs including pending)
 	case "read_all_admin":
-		return a.readAllConfigs(ctx, connector, req.TableName, req.Limit, req.Offset)
+		return a.findConfigs(ctx, connector, req.TableName, configQuery{Status: req.Status}, req.Limit, req.Offset)
 		
 	case "search_admin":
-		if req.SearchTerm == "" {
-			return nil, fmt.Errorf("search_term is required for search operation")
-		}
-		return a.searchConfigs(ctx, connector, req.TableName, req.SearchTerm, req.Limit, req.Offset)
+		return a.findConfigs(ctx, connector, req.TableName, configQueryOf(req, false), req.Limit, req.Offset)
 		
 	// DIRECT UPDATE operations (bypass approval - for admin use)
-	case "direct_update", "update":
-		if req.Key == "" {
-			return nil, fmt.Errorf("config key is required for update operation")
-		}
-		return a.updateConfigDirect(ctx, connector, req.Database, req.TableName, req.Key, req.Value, req.Description, req.MakerID)
+	case "direct_update":
+		return a.ConfigService().Update(ctx, connector, setRequestOf(req))
 		
-	case "direct_update_batch", "update_batch":
-		if req.ConfigItems == nil || len(req.ConfigItems) == 0 {
-			return nil, fmt.Errorf("config_items are required for batch update operation")
-		}
-		return a.updateMultipleConfigsDirect(ctx, connector, req.Database, req.TableName, req.ConfigItems)
+	case "direct_update_batch":
+		return a.updateMultipleConfigsDirect(ctx, connector, req.TableName, req.ConfigItems, configBatchOptionsOf(req))
 		
 	// DIRECT DELETE operations (bypass approval - for admin use)
-	case "direct_delete", "delete", "delete_config":
-		if req.Key == "" {
-			return nil, fmt.Errorf("config key is required for delete operation")
-		}
-		return a.deleteConfigDirect(ctx, connector, req.TableName, req.Key, req.MakerID)
+	case "direct_delete":
+		return a.ConfigService().Delete(ctx, connector, deleteRequestOf(req))
 		
-	case "direct_delete_batch", "delete_batch":
-		if req.ConfigItems == nil || len(req.ConfigItems) == 0 {
-			return nil, fmt.Errorf("config_items with keys are required for batch delete operation")
-		}
-		return a.deleteMultipleConfigsDirect(ctx, connector, req.TableName, req.ConfigItems)
+	case "direct_delete_batch":
+		return a.deleteMultipleConfigsDirect(ctx, connector, req.TableName, req.ConfigItems, configBatchOptionsOf(req))
 		
-	case "direct_delete_all", "delete_all":
+	case "direct_delete_all":
 		return a.deleteAllConfigs(ctx, connector, req.TableName)
 		
+	case "truncate_approvals":
+		return a.truncateApprovals(ctx, connector, req.TableName)
+		
+	case "prune_history":
+		pruning, err := historyPruningOf(req, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return a.pruneHistory(ctx, connector, req.TableName, pruning)
+		
+	case "expire_configs":
+		return a.expireConfigs(ctx, connector, req.TableName)
+		
 	// UTILITY operations
+	case "count_pending":
+		return a.countPendingApprovals(ctx, connector, req.TableName)
+		
 	case "count":
-		return a.countApprovedConfigs(ctx, connector, req.TableName)
+		return a.countMatchingConfigs(ctx, connector, req.TableName, configQueryOf(req, true))
 		
 	case "count_admin":
-		return a.countConfigs(ctx, connector, req.TableName)
+		return a.countMatchingConfigs(ctx, connector, req.TableName, configQueryOf(req, false))
 		
 	case "exists":
-		if req.Key == "" {
-			return nil, fmt.Errorf("config key is required for exists operation")
+		exists, err := a.ConfigService().Exists(ctx, connector, readRequestOf(req))
+		if err != nil {
+			return nil, err
 		}
-		return a.configExistsApproved(ctx, connector, req.TableName, req.Key)
+		return map[string]interface{}{"exists": exists, "key": req.Key}, nil
 		
 	default:
-		return nil, fmt.Errorf("unsupported operation: %s. Supported operations: submit_create, submit_update, submit_delete, approve_request, reject_request, get_pending_approvals, get_my_requests, get_approval_history, read, read_all, search, filter, count, exists, create_table, drop_table", req.Operation)
+		return nil, unsupportedOperationError(req.Operation, allConfigOperations)
 	}
 }
 
-func (a *API) createAllConfigTable(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
+// createAllConfigTable creates the allconfig and approval tables, or adds the columns introduced since
+// they were created when they already exist. A PostgreSQL schema qualifying them is created when missing.
+func (a *API) createAllConfigTable(ctx context.Context, connector connectors.DBConnector, schema, tableName string) (interface{}, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		sql := a.getCreateTableSQL(connector.GetType(), tableName)
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": sql,
-		})
+		if quoted := quotedConfigSchema(ctx); quoted != "" && connector.GetType() == "postgresql" {
+			if _, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": "CREATE SCHEMA IF NOT EXISTS " + quoted}); err != nil {
+				return nil, fmt.Errorf("failed to create schema %s: %w", schema, err)
+			}
+		}
+		exists, err := a.checkTableExists(ctx, connector, schema, tableName)
+		if err != nil {
+			return nil, err
+		}
+		var result interface{}
+		if exists {
+			result, err = a.upgradeAllConfigTables(ctx, connector, schema, tableName)
+		} else {
+			result, err = connector.Execute(ctx, "execute", map[string]interface{}{
+				"query": a.getCreateTableSQL(ctx, connector.GetType(), tableName),
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := a.createConfigNotifyTrigger(ctx, connector, tableName); err != nil {
+			return nil, err
+		}
+		return result, nil
 		
 	case "mongodb":
 		// For MongoDB, create the collection and index
@@ -988,8 +1410,8 @@ func (a *API) createAllConfigTable(ctx context.Context, connector connectors.DBC
 				"config_key":   "_init",
 				"config_value": "collection_created",
 				"description":  "Initial document to create collection",
-				"created_at":   time.Now(),
-				"updated_at":   time.Now(),
+				"created_at":   mongoNow(),
+				"updated_at":   mongoNow(),
 			},
 		})
 		if err != nil {
@@ -1002,6 +1424,20 @@ func (a *API) createAllConfigTable(ctx context.Context, connector connectors.DBC
 			"index":      map[string]interface{}{"config_key": 1},
 			"options":    map[string]interface{}{"unique": true},
 		})
+		if err == nil {
+			_, err = connector.Execute(ctx, "createIndex", map[string]interface{}{
+				"collection": tableName,
+				"index":      map[string]interface{}{"tags": 1},
+			})
+		}
+		// MongoDB deletes the configs once their expires_at passes
+		if err == nil {
+			_, err = connector.Execute(ctx, "createIndex", map[string]interface{}{
+				"collection": tableName,
+				"index":      map[string]interface{}{"expires_at": 1},
+				"options":    map[string]interface{}{"expireAfterSeconds": 0},
+			})
+		}
 		
 		return map[string]interface{}{
 			"collection_created": true,
@@ -1013,16 +1449,17 @@ func (a *API) createAllConfigTable(ctx context.Context, connector connectors.DBC
 	}
 }
 
+// getAllConfigs lists the configs in key order whatever their status, with the columns legacy tables have
 func (a *API) getAllConfigs(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := "SELECT config_key, config_value, description, created_at, updated_at FROM " + tableName + " ORDER BY config_key"
+		query := "SELECT " + legacyConfigColumns + " FROM " + sqlTable(ctx, tableName) + " ORDER BY config_key"
 		rows, err := connector.Query(ctx, query)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		return a.rowsToMap(rows)
+		return a.configRows(rows)
 		
 	case "mongodb":
 		return connector.Execute(ctx, "find", map[string]interface{}{
@@ -1036,31 +1473,31 @@ func (a *API) getAllConfigs(ctx context.Context, connector connectors.DBConnecto
 	}
 }
 
+// getConfig reads the config stored under key whatever its status, returning ErrConfigNotFound when none is
 func (a *API) getConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string) (interface{}, error) {
 	switch connector.GetType() {
-	case "mysql":
-		query := "SELECT config_key, config_value, description, created_at, updated_at FROM " + tableName + " WHERE config_key = ?"
+	case "mysql", "postgresql":
+		query := connectors.Bind(sqlDialect(connector), "SELECT config_key, config_value, description, tags, created_at, updated_at FROM " + sqlTable(ctx, tableName) + " WHERE config_key = ?")
 		rows, err := connector.Query(ctx, query, key)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "postgresql":
-		query := "SELECT config_key, config_value, description, created_at, updated_at FROM " + tableName + " WHERE config_key = $1"
-		rows, err := connector.Query(ctx, query, key)
+		results, err := a.matchedRows(rows)
 		if err != nil {
-			return nil, err
+			return nil, notFound(err, ErrConfigNotFound, key)
 		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
+		return results, nil
 		
 	case "mongodb":
-		return connector.Execute(ctx, "findOne", map[string]interface{}{
+		result, err := connector.Execute(ctx, "findOne", map[string]interface{}{
 			"collection": tableName,
 			"filter":     map[string]interface{}{"config_key": key},
 		})
+		if err != nil {
+			return nil, notFound(err, ErrConfigNotFound, key)
+		}
+		return result, nil
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
@@ -1068,24 +1505,27 @@ func (a *API) getConfig(ctx context.Context, connector connectors.DBConnector, t
 }
 
 func (a *API) setConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string, value interface{}) (interface{}, error) {
+	items := []ConfigItem{{Key: key, Value: value}}
+	previous := a.previousValueHashes(ctx, connector, tableName, items)
+	result, err := a.writeConfig(ctx, connector, tableName, key, value)
+	if err != nil {
+		return nil, err
+	}
+	a.recordConfigWrites(ctx, connector, tableName, items, previous)
+	return result, nil
+}
+
+// writeConfig creates or updates the config stored under key
+func (a *API) writeConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string, value interface{}) (interface{}, error) {
 	switch connector.GetType() {
-	case "mysql":
-		query := `INSERT INTO ` + tableName + ` (config_key, config_value, updated_at) 
-				  VALUES (?, ?, NOW()) 
-				  ON DUPLICATE KEY UPDATE config_value = VALUES(config_value), updated_at = NOW()`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{key, value},
-		})
-		
-	case "postgresql":
-		query := `INSERT INTO ` + tableName + ` (config_key, config_value, created_at, updated_at) 
-				  VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-				  ON CONFLICT (config_key) DO UPDATE SET 
-				  config_value = EXCLUDED.config_value, updated_at = CURRENT_TIMESTAMP`
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		query := connectors.Bind(d, `INSERT INTO ` + sqlTable(ctx, tableName) + ` (config_key, config_value, created_at, updated_at) 
+				  VALUES (?, ?, ` + d.NowFunc() + `, ` + d.NowFunc() + `) 
+				  ` + d.UpsertClause([]string{"config_key"}, "config_value = " + d.Excluded("config_value"), "updated_at = " + d.NowFunc()))
 		return connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
-			"args":  []interface{}{key, value},
+			"args":  []interface{}{key, integerValue(value)},
 		})
 		
 	case "mongodb":
@@ -1096,10 +1536,10 @@ func (a *API) setConfig(ctx context.Context, connector connectors.DBConnector, t
 				"$set": map[string]interface{}{
 					"config_key":   key,
 					"config_value": value,
-					"updated_at":   time.Now(),
 				},
+				"$currentDate": currentDate("updated_at"),
 				"$setOnInsert": map[string]interface{}{
-					"created_at": time.Now(),
+					"created_at": mongoNow(),
 				},
 			},
 		})
@@ -1109,432 +1549,208 @@ func (a *API) setConfig(ctx context.Context, connector connectors.DBConnector, t
 	}
 }
 
-func (a *API) setMultipleConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, configs map[string]interface{}) (interface{}, error) {
-	results := make(map[string]interface{})
-	
-	for key, value := range configs {
-		result, err := a.setConfig(ctx, connector, tableName, key, value)
-		if err != nil {
-			results[key] = map[string]interface{}{"error": err.Error()}
-		} else {
-			results[key] = map[string]interface{}{"success": true, "result": result}
-		}
-	}
-	
-	return results, nil
-}
-
-func (a *API) deleteConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string) (interface{}, error) {
-	switch connector.GetType() {
-	case "mysql":
-		query := "DELETE FROM " + tableName + " WHERE config_key = ?"
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{key},
-		})
-		
-	case "postgresql":
-		query := "DELETE FROM " + tableName + " WHERE config_key = $1"
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{key},
-		})
-		
-	case "mongodb":
-		return connector.Execute(ctx, "delete", map[string]interface{}{
-			"collection": tableName,
-			"filter":     map[string]interface{}{"config_key": key},
-		})
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type")
-	}
+func (a *API) setMultipleConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, configs map[string]interface{}, opts configBatchOptions) (interface{}, error) {
+	keys := sortedConfigKeys(configs)
+	return a.runConfigBatch(ctx, connector, keys, opts, func(ctx context.Context, connector connectors.DBConnector, i int) (interface{}, error) {
+		return a.setConfig(ctx, connector, tableName, keys[i], configs[keys[i]])
+	})
 }
 
-// Enhanced CRUD Operations
+// Legacy operations, which neither read nor write the status and maker columns
 
-// CREATE operations
+// createConfig creates a config in a legacy table, returning ErrConfigExists when the key is taken
 func (a *API) createConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string, value interface{}, description string) (interface{}, error) {
+	var result interface{}
+	var err error
 	switch connector.GetType() {
-	case "mysql":
-		query := `INSERT INTO ` + tableName + ` (config_key, config_value, description, created_at, updated_at) 
-				  VALUES (?, ?, ?, NOW(), NOW())`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{key, value, description},
-		})
-		
-	case "postgresql":
-		query := `INSERT INTO ` + tableName + ` (config_key, config_value, description, created_at, updated_at) 
-				  VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		query := connectors.Bind(d, `INSERT INTO ` + sqlTable(ctx, tableName) + ` (config_key, config_value, description, created_at, updated_at) 
+				  VALUES (?, ?, ?, ` + d.NowFunc() + `, ` + d.NowFunc() + `)`)
+		result, err = connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
-			"args":  []interface{}{key, value, description},
+			"args":  []interface{}{key, integerValue(value), description},
 		})
 		
 	case "mongodb":
-		return connector.Execute(ctx, "insert", map[string]interface{}{
+		result, err = connector.Execute(ctx, "insert", map[string]interface{}{
 			"collection": tableName,
 			"document": map[string]interface{}{
 				"config_key":   key,
 				"config_value": value,
 				"description":  description,
-				"created_at":   time.Now(),
-				"updated_at":   time.Now(),
+				"created_at":   mongoNow(),
+				"updated_at":   mongoNow(),
 			},
 		})
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
-}
 
-func (a *API) createMultipleConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem) (interface{}, error) {
-	results := make(map[string]interface{})
-	successCount := 0
-	
-	for _, config := range configs {
-		result, err := a.createConfig(ctx, connector, tableName, config.Key, config.Value, config.Description)
-		if err != nil {
-			results[config.Key] = map[string]interface{}{"error": err.Error()}
-		} else {
-			results[config.Key] = map[string]interface{}{"success": true, "result": result}
-			successCount++
-		}
+	if connectors.IsDuplicateKey(err) {
+		return nil, fmt.Errorf("%w: %s", ErrConfigExists, key)
 	}
-	
-	return map[string]interface{}{
-		"total_items":    len(configs),
-		"success_count":  successCount,
-		"failure_count":  len(configs) - successCount,
-		"results":        results,
-	}, nil
+	if err != nil {
+		return nil, err
+	}
+	a.recordConfigChange(ctx, connector, events.Event{Table: tableName, Key: key, Operation: events.OperationCreate, NewValueHash: valueHash(value)})
+	return result, nil
 }
 
-// READ operations
-func (a *API) readConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string) (interface{}, error) {
-	return a.getConfig(ctx, connector, tableName, key)
+// createMultipleConfigs creates multiple configs in a legacy table
+func (a *API) createMultipleConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem, opts configBatchOptions) (interface{}, error) {
+	return a.runConfigBatch(ctx, connector, configItemKeys(configs), opts, func(ctx context.Context, connector connectors.DBConnector, i int) (interface{}, error) {
+		config := configs[i]
+		return a.createConfig(ctx, connector, tableName, config.Key, config.Value, config.Description)
+	})
 }
 
-func (a *API) readAllConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, limit, offset int) (interface{}, error) {
+// readConfig reads the config stored under key in a legacy table, returning ErrConfigNotFound when none is
+func (a *API) readConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string) (interface{}, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := "SELECT config_key, config_value, description, created_at, updated_at FROM " + tableName + " ORDER BY config_key"
-		
-		if limit > 0 {
-			if connector.GetType() == "mysql" {
-				query += fmt.Sprintf(" LIMIT %d", limit)
-				if offset > 0 {
-					query += fmt.Sprintf(" OFFSET %d", offset)
-				}
-			} else { // postgresql
-				query += fmt.Sprintf(" LIMIT %d", limit)
-				if offset > 0 {
-					query += fmt.Sprintf(" OFFSET %d", offset)
-				}
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "mongodb":
-		params := map[string]interface{}{
-			"collection": tableName,
-			"filter":     map[string]interface{}{},
-			"sort":       map[string]interface{}{"config_key": 1},
-		}
-		
-		if limit > 0 {
-			params["limit"] = limit
-		}
-		if offset > 0 {
-			params["skip"] = offset
-		}
-		
-		return connector.Execute(ctx, "find", params)
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type")
-	}
-}
-
-func (a *API) searchConfigs(ctx context.Context, connector connectors.DBConnector, tableName, searchTerm string, limit, offset int) (interface{}, error) {
-	switch connector.GetType() {
-	case "mysql":
-		query := `SELECT config_key, config_value, description, created_at, updated_at FROM ` + tableName + ` 
-				  WHERE config_key LIKE ? OR config_value LIKE ? OR description LIKE ? 
-				  ORDER BY config_key`
-		searchPattern := "%" + searchTerm + "%"
-		args := []interface{}{searchPattern, searchPattern, searchPattern}
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query, args...)
+		query := connectors.Bind(sqlDialect(connector), "SELECT " + legacyConfigColumns + " FROM " + sqlTable(ctx, tableName) + " WHERE config_key = ?")
+		rows, err := connector.Query(ctx, query, key)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "postgresql":
-		query := `SELECT config_key, config_value, description, created_at, updated_at FROM ` + tableName + ` 
-				  WHERE config_key ILIKE $1 OR config_value ILIKE $2 OR description ILIKE $3 
-				  ORDER BY config_key`
-		searchPattern := "%" + searchTerm + "%"
-		args := []interface{}{searchPattern, searchPattern, searchPattern}
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query, args...)
+		results, err := a.matchedRows(rows)
 		if err != nil {
-			return nil, err
+			return nil, notFound(err, ErrConfigNotFound, key)
 		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
+		return results, nil
 		
 	case "mongodb":
-		params := map[string]interface{}{
+		result, err := connector.Execute(ctx, "findOne", map[string]interface{}{
 			"collection": tableName,
-			"filter": map[string]interface{}{
-				"$or": []map[string]interface{}{
-					{"config_key": map[string]interface{}{"$regex": searchTerm, "$options": "i"}},
-					{"config_value": map[string]interface{}{"$regex": searchTerm, "$options": "i"}},
-					{"description": map[string]interface{}{"$regex": searchTerm, "$options": "i"}},
-				},
-			},
-			"sort": map[string]interface{}{"config_key": 1},
-		}
-		
-		if limit > 0 {
-			params["limit"] = limit
-		}
-		if offset > 0 {
-			params["skip"] = offset
-		}
-		
-		return connector.Execute(ctx, "find", params)
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type")
-	}
-}
-
-func (a *API) filterConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, filter map[string]interface{}, limit, offset int) (interface{}, error) {
-	switch connector.GetType() {
-	case "mysql", "postgresql":
-		// Build WHERE clause from filter
-		whereClause := "WHERE 1=1"
-		args := []interface{}{}
-		paramIndex := 1
-		
-		for key, value := range filter {
-			if connector.GetType() == "mysql" {
-				whereClause += fmt.Sprintf(" AND %s = ?", key)
-			} else {
-				whereClause += fmt.Sprintf(" AND %s = $%d", key, paramIndex)
-				paramIndex++
-			}
-			args = append(args, value)
-		}
-		
-		query := fmt.Sprintf("SELECT config_key, config_value, description, created_at, updated_at FROM %s %s ORDER BY config_key", tableName, whereClause)
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query, args...)
+			"filter":     map[string]interface{}{"config_key": key},
+		})
 		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "mongodb":
-		params := map[string]interface{}{
-			"collection": tableName,
-			"filter":     filter,
-			"sort":       map[string]interface{}{"config_key": 1},
-		}
-		
-		if limit > 0 {
-			params["limit"] = limit
-		}
-		if offset > 0 {
-			params["skip"] = offset
+			return nil, notFound(err, ErrConfigNotFound, key)
 		}
-		
-		return connector.Execute(ctx, "find", params)
+		return result, nil
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
 }
 
-// UPDATE operations
+// updateConfig updates a config in a legacy table, returning ErrConfigNotFound when no config is stored
+// under the key
 func (a *API) updateConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string, value interface{}, description string) (interface{}, error) {
+	oldHash, _ := a.previousValueHash(ctx, connector, tableName, key)
+	var result interface{}
+	var err error
 	switch connector.GetType() {
-	case "mysql":
-		query := `UPDATE ` + tableName + ` SET config_value = ?, description = ?, updated_at = NOW() WHERE config_key = ?`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{value, description, key},
-		})
-		
-	case "postgresql":
-		query := `UPDATE ` + tableName + ` SET config_value = $1, description = $2, updated_at = CURRENT_TIMESTAMP WHERE config_key = $3`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		query := connectors.Bind(d, `UPDATE ` + sqlTable(ctx, tableName) + ` SET config_value = ?, description = ?, updated_at = ` + d.NowFunc() + ` WHERE config_key = ?`)
+		result, err = connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
-			"args":  []interface{}{value, description, key},
+			"args":  []interface{}{integerValue(value), description, key},
 		})
 		
 	case "mongodb":
-		return connector.Execute(ctx, "update", map[string]interface{}{
+		result, err = connector.Execute(ctx, "update", map[string]interface{}{
 			"collection": tableName,
 			"filter":     map[string]interface{}{"config_key": key},
 			"update": map[string]interface{}{
 				"$set": map[string]interface{}{
 					"config_value": value,
 					"description":  description,
-					"updated_at":   time.Now(),
 				},
+				"$currentDate": currentDate("updated_at"),
 			},
 		})
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
+
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkConfigAffected(ctx, connector, tableName, key, result); err != nil {
+		return nil, err
+	}
+	a.recordConfigChange(ctx, connector, events.Event{Table: tableName, Key: key, Operation: events.OperationUpdate, OldValueHash: oldHash, NewValueHash: valueHash(value)})
+	return result, nil
 }
 
-func (a *API) updateMultipleConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem) (interface{}, error) {
-	results := make(map[string]interface{})
-	successCount := 0
-	
-	for _, config := range configs {
-		result, err := a.updateConfig(ctx, connector, tableName, config.Key, config.Value, config.Description)
+// updateMultipleConfigs updates multiple configs in a legacy table
+func (a *API) updateMultipleConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem, opts configBatchOptions) (interface{}, error) {
+	return a.runConfigBatch(ctx, connector, configItemKeys(configs), opts, func(ctx context.Context, connector connectors.DBConnector, i int) (interface{}, error) {
+		config := configs[i]
+		return a.updateConfig(ctx, connector, tableName, config.Key, config.Value, config.Description)
+	})
+}
+
+func (a *API) deleteAllConfigs(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
+	// Look up the configs first so that a delete event can be sent for each
+	var deleted []map[string]interface{}
+	if a.publishesEvents(connector) {
+		configs, err := a.getAllConfigs(ctx, connector, tableName)
 		if err != nil {
-			results[config.Key] = map[string]interface{}{"error": err.Error()}
-		} else {
-			results[config.Key] = map[string]interface{}{"success": true, "result": result}
-			successCount++
+			return nil, err
 		}
+		deleted, _ = configs.([]map[string]interface{})
 	}
-	
-	return map[string]interface{}{
-		"total_items":    len(configs),
-		"success_count":  successCount,
-		"failure_count":  len(configs) - successCount,
-		"results":        results,
-	}, nil
-}
-
-// DELETE operations
-func (a *API) deleteMultipleConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem) (interface{}, error) {
-	results := make(map[string]interface{})
-	successCount := 0
-	
-	for _, config := range configs {
-		result, err := a.deleteConfig(ctx, connector, tableName, config.Key)
-		if err != nil {
-			results[config.Key] = map[string]interface{}{"error": err.Error()}
-		} else {
-			results[config.Key] = map[string]interface{}{"success": true, "result": result}
-			successCount++
-		}
+
+	count, err := deleteAllRows(ctx, connector, tableName)
+	if err != nil {
+		return nil, err
 	}
-	
-	return map[string]interface{}{
-		"total_items":    len(configs),
-		"success_count":  successCount,
-		"failure_count":  len(configs) - successCount,
-		"results":        results,
-	}, nil
+	for _, config := range deleted {
+		key, _ := config["config_key"].(string)
+		a.recordConfigChange(ctx, connector, events.Event{Table: tableName, Key: key, Operation: events.OperationDelete, OldValueHash: valueHash(config["config_value"])})
+	}
+	cleared := &ClearedTable{Table: tableName, Deleted: count}
+	a.logClearedTable(ctx, connector, "direct_delete_all", cleared)
+	return cleared, nil
 }
 
-func (a *API) deleteAllConfigs(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
+// dropAllConfigTable drops the allconfig table, counting the configs it held first
+func (a *API) dropAllConfigTable(ctx context.Context, connector connectors.DBConnector, schema, tableName string) (interface{}, error) {
+	exists, err := a.checkTableExists(ctx, connector, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	cleared := &ClearedTable{Table: tableName, Dropped: &exists}
+	if exists {
+		if cleared.Deleted, err = a.countMatchingConfigs(ctx, connector, tableName, configQuery{}); err != nil {
+			return nil, fmt.Errorf("failed to count configs: %w", err)
+		}
+	}
+
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := "DELETE FROM " + tableName
-		return connector.Execute(ctx, "execute", map[string]interface{}{
+		query := "DROP TABLE IF EXISTS " + sqlTable(ctx, tableName)
+		_, err = connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
 		})
 		
 	case "mongodb":
-		return connector.Execute(ctx, "delete", map[string]interface{}{
+		_, err = connector.Execute(ctx, "drop", map[string]interface{}{
 			"collection": tableName,
-			"filter":     map[string]interface{}{},
 		})
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
-}
-
-func (a *API) dropAllConfigTable(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
-	switch connector.GetType() {
-	case "mysql", "postgresql":
-		query := "DROP TABLE IF EXISTS " + tableName
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-		})
-		
-	case "mongodb":
-		return connector.Execute(ctx, "drop", map[string]interface{}{
-			"collection": tableName,
-		})
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type")
+	if err != nil {
+		return nil, err
 	}
+	a.logClearedTable(ctx, connector, "drop_table", cleared)
+	return cleared, nil
 }
 
 // UTILITY operations
-func (a *API) countConfigs(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
-	return a.getConfigCount(ctx, connector, tableName)
-}
-
 func (a *API) configExists(ctx context.Context, connector connectors.DBConnector, tableName, key string) (interface{}, error) {
 	switch connector.GetType() {
-	case "mysql":
-		query := "SELECT COUNT(*) FROM " + tableName + " WHERE config_key = ?"
-		rows, err := connector.Query(ctx, query, key)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		
-		if rows.Next() {
-			var count int
-			if err := rows.Scan(&count); err != nil {
-				return nil, err
-			}
-			return map[string]interface{}{
-				"exists": count > 0,
-				"key":    key,
-			}, nil
-		}
-		return map[string]interface{}{"exists": false, "key": key}, nil
-		
-	case "postgresql":
-		query := "SELECT COUNT(*) FROM " + tableName + " WHERE config_key = $1"
+	case "mysql", "postgresql":
+		query := connectors.Bind(sqlDialect(connector), "SELECT COUNT(*) FROM " + sqlTable(ctx, tableName) + " WHERE config_key = ?")
 		rows, err := connector.Query(ctx, query, key)
 		if err != nil {
 			return nil, err
@@ -1583,212 +1799,87 @@ func (a *API) configExists(ctx context.Context, connector connectors.DBConnector
 // MAKER-CHECKER WORKFLOW FUNCTIONS
 // ========================================
 
-// generateRequestID generates a unique request ID
-func (a *API) generateRequestID() string {
-	bytes := make([]byte, 16)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
-}
-
-// submitConfigForApproval submits a configuration change for approval
-func (a *API) submitConfigForApproval(ctx context.Context, connector connectors.DBConnector, tableName, operation, key string, value interface{}, description, makerID string, previousValue interface{}) (interface{}, error) {
-	requestID := a.generateRequestID()
+// submitConfigForApproval stores a pending approval request with the ID and returns the result of the insert
+func (a *API) submitConfigForApproval(ctx context.Context, connector connectors.DBConnector, requestID string, req allconfig.SubmitRequest) (interface{}, error) {
+	// Invalid values never enter the approval queue
+	if err := a.rules.checkConfig(req.Key, req.Value); err != nil {
+		return nil, err
+	}
+	tableName, key, value, expiresAt := req.Table, req.Key, req.Value, req.ExpiresAt
 	
 	switch connector.GetType() {
-	case "mysql":
-		query := `INSERT INTO ` + tableName + `_approval_requests 
-				  (request_id, config_key, config_value, description, operation, maker_id, status, requested_at, previous_value) 
-				  VALUES (?, ?, ?, ?, ?, ?, 'pending', NOW(), ?)`
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		expiryColumn, expiryValue := expiryColumns(expiresAt)
+		query := connectors.Bind(d, `INSERT INTO ` + sqlTable(ctx, a.approvalTable(tableName)) + ` 
+				  (request_id, config_key, config_value, description, operation, maker_id, status, requested_at, previous_value, tags` + expiryColumn + `) 
+				  VALUES (?, ?, ?, ?, ?, ?, 'pending', ` + d.NowFunc() + `, ?, ?` + expiryValue + `)`)
 		
 		valueStr := ""
 		if value != nil {
-			valueStr = fmt.Sprintf("%v", value)
-		}
-		prevValueStr := ""
-		if previousValue != nil {
-			prevValueStr = fmt.Sprintf("%v", previousValue)
+			valueStr = fmt.Sprintf("%v", integerValue(value))
 		}
 		
-		result, err := connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{requestID, key, valueStr, description, operation, makerID, prevValueStr},
-		})
-		if err != nil {
-			return nil, err
-		}
-		
-		return map[string]interface{}{
-			"request_id": requestID,
-			"status":     "submitted_for_approval",
-			"operation":  operation,
-			"config_key": key,
-			"maker_id":   makerID,
-			"result":     result,
-		}, nil
-		
-	case "postgresql":
-		query := `INSERT INTO ` + tableName + `_approval_requests 
-				  (request_id, config_key, config_value, description, operation, maker_id, status, requested_at, previous_value) 
-				  VALUES ($1, $2, $3, $4, $5, $6, 'pending', CURRENT_TIMESTAMP, $7)`
-		
-		valueStr := ""
-		if value != nil {
-			valueStr = fmt.Sprintf("%v", value)
-		}
-		prevValueStr := ""
-		if previousValue != nil {
-			prevValueStr = fmt.Sprintf("%v", previousValue)
+		args := []interface{}{requestID, key, valueStr, req.Description, req.Operation, req.MakerID, "", tagsArg(req.Tags)}
+		if expiresAt != nil {
+			args = append(args, expiryArg(expiresAt))
 		}
 		
-		result, err := connector.Execute(ctx, "execute", map[string]interface{}{
+		return connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
-			"args":  []interface{}{requestID, key, valueStr, description, operation, makerID, prevValueStr},
+			"args":  args,
 		})
-		if err != nil {
-			return nil, err
-		}
-		
-		return map[string]interface{}{
-			"request_id": requestID,
-			"status":     "submitted_for_approval",
-			"operation":  operation,
-			"config_key": key,
-			"maker_id":   makerID,
-			"result":     result,
-		}, nil
 		
 	case "mongodb":
 		doc := map[string]interface{}{
 			"request_id":     requestID,
 			"config_key":     key,
 			"config_value":   value,
-			"description":    description,
-			"operation":      operation,
-			"maker_id":       makerID,
+			"description":    req.Description,
+			"operation":      req.Operation,
+			"maker_id":       req.MakerID,
 			"status":         "pending",
-			"requested_at":   time.Now(),
-			"previous_value": previousValue,
+			"requested_at":   mongoNow(),
+			"previous_value": nil,
+		}
+		if req.Tags != nil {
+			doc["tags"] = req.Tags
+		}
+		if expiresAt != nil {
+			doc["expires_at"] = expiryArg(expiresAt)
 		}
 		
-		result, err := connector.Execute(ctx, "insert", map[string]interface{}{
-			"collection": tableName + "_approval_requests",
+		return connector.Execute(ctx, "insert", map[string]interface{}{
+			"collection": a.approvalTable(tableName),
 			"document":   doc,
 		})
-		if err != nil {
-			return nil, err
-		}
-		
-		return map[string]interface{}{
-			"request_id": requestID,
-			"status":     "submitted_for_approval",
-			"operation":  operation,
-			"config_key": key,
-			"maker_id":   makerID,
-			"result":     result,
-		}, nil
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
 }
 
-// approveRequest approves a pending configuration change
-func (a *API) approveRequest(ctx context.Context, connector connectors.DBConnector, databaseName, tableName, requestID, checkerID, comment string) (interface{}, error) {
-	// First, get the pending request details
-	request, err := a.getPendingRequestByID(ctx, connector, tableName, requestID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get pending request: %w", err)
-	}
-	
-	if request == nil {
-		return nil, fmt.Errorf("request not found or not in pending status")
-	}
-	
-	// Apply the approved change to the main table
-	var applyResult interface{}
-	switch request["operation"].(string) {
-	case "create":
-		applyResult, err = a.createConfigDirect(ctx, connector, databaseName, tableName, 
-			request["config_key"].(string), 
-			request["config_value"], 
-			request["description"].(string), 
-			request["maker_id"].(string))
-	case "update":
-		applyResult, err = a.updateConfigDirect(ctx, connector, databaseName, tableName, 
-			request["config_key"].(string), 
-			request["config_value"], 
-			request["description"].(string), 
-			request["maker_id"].(string))
-	case "delete":
-		applyResult, err = a.deleteConfigDirect(ctx, connector, tableName, 
-			request["config_key"].(string), 
-			request["maker_id"].(string))
-	default:
-		return nil, fmt.Errorf("unsupported operation: %s", request["operation"])
-	}
-	
-	if err != nil {
-		return nil, fmt.Errorf("failed to apply approved change: %w", err)
-	}
-	
-	// Update the approval request status
-	err = a.updateApprovalRequestStatus(ctx, connector, tableName, requestID, "approved", checkerID, comment)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update approval request status: %w", err)
-	}
-	
-	return map[string]interface{}{
-		"request_id":       requestID,
-		"status":           "approved",
-		"checker_id":       checkerID,
-		"approval_comment": comment,
-		"applied_result":   applyResult,
-	}, nil
-}
-
-// rejectRequest rejects a pending configuration change
-func (a *API) rejectRequest(ctx context.Context, connector connectors.DBConnector, databaseName, tableName, requestID, checkerID, comment string) (interface{}, error) {
-	// Update the approval request status to rejected
-	err := a.updateApprovalRequestStatus(ctx, connector, tableName, requestID, "rejected", checkerID, comment)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update approval request status: %w", err)
-	}
-	
-	return map[string]interface{}{
-		"request_id":       requestID,
-		"status":           "rejected",
-		"checker_id":       checkerID,
-		"approval_comment": comment,
-	}, nil
-}
-
 // getPendingApprovals gets all pending approval requests
 func (a *API) getPendingApprovals(ctx context.Context, connector connectors.DBConnector, tableName string, limit, offset int) (interface{}, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := `SELECT request_id, config_key, config_value, description, operation, maker_id, 
-				         requested_at, previous_value 
-				  FROM ` + tableName + `_approval_requests 
+		query := `SELECT request_id, config_key, ` + a.listedValue("config_value") + `, description, tags, operation, maker_id, 
+				         requested_at, ` + a.listedValue("previous_value") + ` 
+				  FROM ` + sqlTable(ctx, a.approvalTable(tableName)) + ` 
 				  WHERE status = 'pending' 
 				  ORDER BY requested_at ASC`
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
+		query = pageQuery(sqlDialect(connector), query, limit, offset)
 		
 		rows, err := connector.Query(ctx, query)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		return a.rowsToMap(rows)
+		return a.markLargeValues(a.configRows(rows))
 		
 	case "mongodb":
 		params := map[string]interface{}{
-			"collection": tableName + "_approval_requests",
+			"collection": a.approvalTable(tableName),
 			"filter":     map[string]interface{}{"status": "pending"},
 			"sort":       map[string]interface{}{"requested_at": 1},
 		}
@@ -1800,7 +1891,7 @@ func (a *API) getPendingApprovals(ctx context.Context, connector connectors.DBCo
 			params["skip"] = offset
 		}
 		
-		return connector.Execute(ctx, "find", params)
+		return a.markLargeValues(connector.Execute(ctx, "find", params))
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
@@ -1809,312 +1900,71 @@ func (a *API) getPendingApprovals(ctx context.Context, connector connectors.DBCo
 
 // getMyRequests gets approval requests made by a specific maker
 func (a *API) getMyRequests(ctx context.Context, connector connectors.DBConnector, tableName, makerID string, limit, offset int) (interface{}, error) {
-	switch connector.GetType() {
-	case "mysql":
-		query := `SELECT request_id, config_key, config_value, description, operation, status, 
-				         requested_at, processed_at, checker_id, approval_comment, previous_value 
-				  FROM ` + tableName + `_approval_requests 
-				  WHERE maker_id = ? 
-				  ORDER BY requested_at DESC`
-		
-		args := []interface{}{makerID}
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query, args...)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "postgresql":
-		query := `SELECT request_id, config_key, config_value, description, operation, status, 
-				         requested_at, processed_at, checker_id, approval_comment, previous_value 
-				  FROM ` + tableName + `_approval_requests 
-				  WHERE maker_id = $1 
-				  ORDER BY requested_at DESC`
-		
-		args := []interface{}{makerID}
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query, args...)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "mongodb":
-		params := map[string]interface{}{
-			"collection": tableName + "_approval_requests",
-			"filter":     map[string]interface{}{"maker_id": makerID},
-			"sort":       map[string]interface{}{"requested_at": -1},
-		}
-		
-		if limit > 0 {
-			params["limit"] = limit
-		}
-		if offset > 0 {
-			params["skip"] = offset
-		}
-		
-		return connector.Execute(ctx, "find", params)
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type")
-	}
-}
-
-// getApprovalHistory gets the history of all processed approval requests
-func (a *API) getApprovalHistory(ctx context.Context, connector connectors.DBConnector, tableName string, limit, offset int) (interface{}, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := `SELECT request_id, config_key, config_value, description, operation, maker_id, 
-				         checker_id, status, requested_at, processed_at, approval_comment, previous_value 
-				  FROM ` + tableName + `_approval_requests 
-				  WHERE status IN ('approved', 'rejected') 
-				  ORDER BY processed_at DESC`
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "mongodb":
-		params := map[string]interface{}{
-			"collection": tableName + "_approval_requests",
-			"filter": map[string]interface{}{
-				"status": map[string]interface{}{
-					"$in": []string{"approved", "rejected"},
-				},
-			},
-			"sort": map[string]interface{}{"processed_at": -1},
-		}
-		
-		if limit > 0 {
-			params["limit"] = limit
-		}
-		if offset > 0 {
-			params["skip"] = offset
-		}
-		
-		return connector.Execute(ctx, "find", params)
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type")
-	}
-}
-
-// Helper functions for approval workflow
-
-func (a *API) getPendingRequestByID(ctx context.Context, connector connectors.DBConnector, tableName, requestID string) (map[string]interface{}, error) {
-	switch connector.GetType() {
-	case "mysql":
-		query := `SELECT request_id, config_key, config_value, description, operation, maker_id, previous_value 
-				  FROM ` + tableName + `_approval_requests 
-				  WHERE request_id = ? AND status = 'pending'`
-		
-		rows, err := connector.Query(ctx, query, requestID)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		
-		results, err := a.rowsToMap(rows)
-		if err != nil {
-			return nil, err
-		}
-		
-		if results == nil || len(results) == 0 {
-			return nil, nil
-		}
-		
-		return results[0], nil
-		
-	case "postgresql":
-		query := `SELECT request_id, config_key, config_value, description, operation, maker_id, previous_value 
-				  FROM ` + tableName + `_approval_requests 
-				  WHERE request_id = $1 AND status = 'pending'`
-		
-		rows, err := connector.Query(ctx, query, requestID)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		
-		results, err := a.rowsToMap(rows)
-		if err != nil {
-			return nil, err
-		}
-		
-		if results == nil || len(results) == 0 {
-			return nil, nil
-		}
-		
-		return results[0], nil
-		
-	case "mongodb":
-		result, err := connector.Execute(ctx, "findOne", map[string]interface{}{
-			"collection": tableName + "_approval_requests",
-			"filter": map[string]interface{}{
-				"request_id": requestID,
-				"status":     "pending",
-			},
-		})
-		if err != nil {
-			return nil, err
-		}
-		
-		if result == nil {
-			return nil, nil
-		}
-		
-		return result.(map[string]interface{}), nil
-		
-	default:
-		return nil, fmt.Errorf("unsupported database type")
-	}
-}
-
-func (a *API) updateApprovalRequestStatus(ctx context.Context, connector connectors.DBConnector, tableName, requestID, status, checkerID, comment string) error {
-	switch connector.GetType() {
-	case "mysql":
-		query := `UPDATE ` + tableName + `_approval_requests 
-				  SET status = ?, checker_id = ?, approval_comment = ?, processed_at = NOW() 
-				  WHERE request_id = ?`
-		
-		_, err := connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{status, checkerID, comment, requestID},
-		})
-		return err
-		
-	case "postgresql":
-		query := `UPDATE ` + tableName + `_approval_requests 
-				  SET status = $1, checker_id = $2, approval_comment = $3, processed_at = CURRENT_TIMESTAMP 
-				  WHERE request_id = $4`
-		
-		_, err := connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{status, checkerID, comment, requestID},
-		})
-		return err
-		
-	case "mongodb":
-		_, err := connector.Execute(ctx, "update", map[string]interface{}{
-			"collection": tableName + "_approval_requests",
-			"filter":     map[string]interface{}{"request_id": requestID},
-			"update": map[string]interface{}{
-				"$set": map[string]interface{}{
-					"status":           status,
-					"checker_id":       checkerID,
-					"approval_comment": comment,
-					"processed_at":     time.Now(),
-				},
-			},
-		})
-		return err
-		
-	default:
-		return fmt.Errorf("unsupported database type")
-	}
-}
-
-// ========================================
-// APPROVED-ONLY READ OPERATIONS
-// ========================================
-
-// readApprovedConfig reads a single approved configuration
-func (a *API) readApprovedConfig(ctx context.Context, connector connectors.DBConnector, databaseName, tableName, key string) (interface{}, error) {
-	switch connector.GetType() {
-	case "mysql":
-		query := "SELECT config_key, config_value, description, created_at, updated_at, maker_id, checker_id, approved_at FROM " + tableName + " WHERE config_key = ? AND status = 'approved'"
-		rows, err := connector.Query(ctx, query, key)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
+		d := sqlDialect(connector)
+		query := connectors.Bind(d, `SELECT request_id, config_key, ` + a.listedValue("config_value") + `, description, tags, operation, status, 
+				         requested_at, processed_at, checker_id, approval_comment, ` + a.listedValue("previous_value") + ` 
+				  FROM ` + sqlTable(ctx, a.approvalTable(tableName)) + ` 
+				  WHERE maker_id = ? 
+				  ORDER BY requested_at DESC`)
+		query = pageQuery(d, query, limit, offset)
 		
-	case "postgresql":
-		query := "SELECT config_key, config_value, description, created_at, updated_at, maker_id, checker_id, approved_at FROM " + tableName + " WHERE config_key = $1 AND status = 'approved'"
-		rows, err := connector.Query(ctx, query, key)
+		rows, err := connector.Query(ctx, query, makerID)
 		if err != nil {
 			return nil, err
 		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "mongodb":
-		params := map[string]interface{}{
-			"collection": tableName,
-			"filter": map[string]interface{}{
-				"config_key": key,
-				"status":     "approved",
-			},
+		defer rows.Close()
+		return a.markLargeValues(a.configRows(rows))
+		
+	case "mongodb":
+		params := map[string]interface{}{
+			"collection": a.approvalTable(tableName),
+			"filter":     map[string]interface{}{"maker_id": makerID},
+			"sort":       map[string]interface{}{"requested_at": -1},
 		}
 		
-		// Add database parameter for MongoDB
-		if databaseName != "" {
-			params["database"] = databaseName
+		if limit > 0 {
+			params["limit"] = limit
+		}
+		if offset > 0 {
+			params["skip"] = offset
 		}
 		
-		return connector.Execute(ctx, "findOne", params)
+		return a.markLargeValues(connector.Execute(ctx, "find", params))
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
 }
 
-// readAllApprovedConfigs reads all approved configurations
-func (a *API) readAllApprovedConfigs(ctx context.Context, connector connectors.DBConnector, databaseName, tableName string, limit, offset int) (interface{}, error) {
+// getApprovalHistory gets the history of all processed approval requests
+func (a *API) getApprovalHistory(ctx context.Context, connector connectors.DBConnector, tableName string, limit, offset int) (interface{}, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := "SELECT config_key, config_value, description, created_at, updated_at, maker_id, checker_id, approved_at FROM " + tableName + " WHERE status = 'approved' ORDER BY config_key"
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
+		query := `SELECT request_id, config_key, ` + a.listedValue("config_value") + `, description, tags, operation, maker_id, 
+				         checker_id, status, requested_at, processed_at, approval_comment, ` + a.listedValue("previous_value") + ` 
+				  FROM ` + sqlTable(ctx, a.approvalTable(tableName)) + ` 
+				  WHERE status IN ('approved', 'rejected') 
+				  ORDER BY processed_at DESC`
+		query = pageQuery(sqlDialect(connector), query, limit, offset)
 		
 		rows, err := connector.Query(ctx, query)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		return a.rowsToMap(rows)
+		return a.markLargeValues(a.configRows(rows))
 		
 	case "mongodb":
 		params := map[string]interface{}{
-			"collection": tableName,
-			"filter":     map[string]interface{}{"status": "approved"},
-			"sort":       map[string]interface{}{"config_key": 1},
-		}
-		
-		// Add database parameter for MongoDB
-		if databaseName != "" {
-			params["database"] = databaseName
+			"collection": a.approvalTable(tableName),
+			"filter": map[string]interface{}{
+				"status": map[string]interface{}{
+					"$in": []string{"approved", "rejected"},
+				},
+			},
+			"sort": map[string]interface{}{"processed_at": -1},
 		}
 		
 		if limit > 0 {
@@ -2124,173 +1974,174 @@ func (a *API) readAllApprovedConfigs(ctx context.Context, connector connectors.D
 			params["skip"] = offset
 		}
 		
-		return connector.Execute(ctx, "find", params)
+		return a.markLargeValues(connector.Execute(ctx, "find", params))
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
 }
 
-// searchApprovedConfigs searches approved configurations
-func (a *API) searchApprovedConfigs(ctx context.Context, connector connectors.DBConnector, tableName, searchTerm string, limit, offset int) (interface{}, error) {
+// Helper functions for approval workflow
+
+// getPendingRequestByID returns the pending approval request with the ID, or ErrRequestNotFound
+func (a *API) getPendingRequestByID(ctx context.Context, connector connectors.DBConnector, tableName, requestID string) (map[string]interface{}, error) {
 	switch connector.GetType() {
-	case "mysql":
-		query := `SELECT config_key, config_value, description, created_at, updated_at, maker_id, checker_id, approved_at FROM ` + tableName + ` 
-				  WHERE status = 'approved' AND (config_key LIKE ? OR config_value LIKE ? OR description LIKE ?) 
-				  ORDER BY config_key`
-		searchPattern := "%" + searchTerm + "%"
-		args := []interface{}{searchPattern, searchPattern, searchPattern}
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
+	case "mysql", "postgresql":
+		query := connectors.Bind(sqlDialect(connector), `SELECT request_id, config_key, config_value, description, tags, operation, maker_id, previous_value, expires_at, requested_at 
+				  FROM ` + sqlTable(ctx, a.approvalTable(tableName)) + ` 
+				  WHERE request_id = ? AND status = 'pending'`)
 		
-		rows, err := connector.Query(ctx, query, args...)
+		rows, err := connector.Query(ctx, query, requestID)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		return a.rowsToMap(rows)
 		
-	case "postgresql":
-		query := `SELECT config_key, config_value, description, created_at, updated_at, maker_id, checker_id, approved_at FROM ` + tableName + ` 
-				  WHERE status = 'approved' AND (config_key ILIKE $1 OR config_value ILIKE $2 OR description ILIKE $3) 
-				  ORDER BY config_key`
-		searchPattern := "%" + searchTerm + "%"
-		args := []interface{}{searchPattern, searchPattern, searchPattern}
-		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
-		
-		rows, err := connector.Query(ctx, query, args...)
+		results, err := a.matchedRows(rows)
 		if err != nil {
-			return nil, err
+			return nil, notFound(err, ErrRequestNotFound, requestID)
 		}
-		defer rows.Close()
-		return a.rowsToMap(rows)
+		
+		return results[0], nil
 		
 	case "mongodb":
-		params := map[string]interface{}{
-			"collection": tableName,
+		result, err := connector.Execute(ctx, "findOne", map[string]interface{}{
+			"collection": a.approvalTable(tableName),
 			"filter": map[string]interface{}{
-				"status": "approved",
-				"$or": []map[string]interface{}{
-					{"config_key": map[string]interface{}{"$regex": searchTerm, "$options": "i"}},
-					{"config_value": map[string]interface{}{"$regex": searchTerm, "$options": "i"}},
-					{"description": map[string]interface{}{"$regex": searchTerm, "$options": "i"}},
-				},
+				"request_id": requestID,
+				"status":     "pending",
 			},
-			"sort": map[string]interface{}{"config_key": 1},
+		})
+		if err != nil {
+			return nil, notFound(err, ErrRequestNotFound, requestID)
 		}
 		
-		if limit > 0 {
-			params["limit"] = limit
+		request, ok := result.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected approval request document: %T", result)
 		}
-		if offset > 0 {
-			params["skip"] = offset
-		}
-		
-		return connector.Execute(ctx, "find", params)
+		return request, nil
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
 }
 
-// filterApprovedConfigs filters approved configurations
-func (a *API) filterApprovedConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, filter map[string]interface{}, limit, offset int) (interface{}, error) {
+// updateApprovalRequestStatus records the decision on a pending request, returning ErrRequestNotFound
+// when no request with the ID is pending
+func (a *API) updateApprovalRequestStatus(ctx context.Context, connector connectors.DBConnector, tableName, requestID, status, checkerID, comment string) error {
+	var result interface{}
+	var err error
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		// Build WHERE clause from filter, ensuring status = 'approved'
-		whereClause := "WHERE status = 'approved'"
-		args := []interface{}{}
-		paramIndex := 1
-		
-		for key, value := range filter {
-			if connector.GetType() == "mysql" {
-				whereClause += fmt.Sprintf(" AND %s = ?", key)
-			} else {
-				whereClause += fmt.Sprintf(" AND %s = $%d", key, paramIndex+1)
-				paramIndex++
-			}
-			args = append(args, value)
-		}
+		d := sqlDialect(connector)
+		query := connectors.Bind(d, `UPDATE ` + sqlTable(ctx, a.approvalTable(tableName)) + ` 
+				  SET status = ?, checker_id = ?, approval_comment = ?, processed_at = ` + d.NowFunc() + ` 
+				  WHERE request_id = ? AND status = 'pending'`)
 		
-		query := fmt.Sprintf("SELECT config_key, config_value, description, created_at, updated_at, maker_id, checker_id, approved_at FROM %s %s ORDER BY config_key", tableName, whereClause)
+		result, err = connector.Execute(ctx, "execute", map[string]interface{}{
+			"query": query,
+			"args":  []interface{}{status, checkerID, comment, requestID},
+		})
 		
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
-			if offset > 0 {
-				query += fmt.Sprintf(" OFFSET %d", offset)
-			}
-		}
+	case "mongodb":
+		result, err = connector.Execute(ctx, "update", map[string]interface{}{
+			"collection": a.approvalTable(tableName),
+			"filter":     map[string]interface{}{"request_id": requestID, "status": "pending"},
+			"update": map[string]interface{}{
+				"$set": map[string]interface{}{
+					"status":           status,
+					"checker_id":       checkerID,
+					"approval_comment": comment,
+				},
+				"$currentDate": currentDate("processed_at"),
+			},
+		})
 		
-		rows, err := connector.Query(ctx, query, args...)
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if err != nil {
+		return err
+	}
+	if count, ok := affectedCount(result); ok && count == 0 {
+		return fmt.Errorf("%w: %s", ErrRequestNotFound, requestID)
+	}
+	return nil
+}
+
+// ========================================
+// APPROVED-ONLY READ OPERATIONS
+// ========================================
+
+// readApprovedConfig reads a single approved configuration, returning ErrConfigNotFound when none is stored
+func (a *API) readApprovedConfig(ctx context.Context, connector connectors.DBConnector, tableName, key string) (interface{}, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		query := connectors.Bind(d, "SELECT config_key, config_value, description, tags, created_at, updated_at, maker_id, checker_id, approved_at, expires_at FROM " + sqlTable(ctx, tableName) + " WHERE config_key = ? AND status = 'approved' AND " + sqlUnexpired(d, "expires_at"))
+		rows, err := connector.Query(ctx, query, key)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		return a.rowsToMap(rows)
-		
-	case "mongodb":
-		// Add status filter to user's filter
-		combinedFilter := map[string]interface{}{"status": "approved"}
-		for k, v := range filter {
-			combinedFilter[k] = v
+		results, err := a.matchedRows(rows)
+		if err != nil {
+			return nil, notFound(err, ErrConfigNotFound, key)
 		}
+		return results, nil
 		
+	case "mongodb":
 		params := map[string]interface{}{
 			"collection": tableName,
-			"filter":     combinedFilter,
-			"sort":       map[string]interface{}{"config_key": 1},
+			"filter": a.unexpired(map[string]interface{}{
+				"config_key": key,
+				"status":     "approved",
+			}),
 		}
 		
-		if limit > 0 {
-			params["limit"] = limit
-		}
-		if offset > 0 {
-			params["skip"] = offset
+		result, err := connector.Execute(ctx, "findOne", params)
+		if err != nil {
+			return nil, notFound(err, ErrConfigNotFound, key)
 		}
-		
-		return connector.Execute(ctx, "find", params)
+		return result, nil
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
 }
 
-// countApprovedConfigs counts only approved configurations
-func (a *API) countApprovedConfigs(ctx context.Context, connector connectors.DBConnector, tableName string) (interface{}, error) {
+// readAllApprovedConfigs reads all approved configurations
+func (a *API) readAllApprovedConfigs(ctx context.Context, connector connectors.DBConnector, tableName string, limit, offset int) (interface{}, error) {
 	switch connector.GetType() {
 	case "mysql", "postgresql":
-		query := "SELECT COUNT(*) FROM " + tableName + " WHERE status = 'approved'"
+		d := sqlDialect(connector)
+		query := "SELECT config_key, " + a.listedValue("config_value") + ", description, tags, created_at, updated_at, maker_id, checker_id, approved_at, expires_at FROM " + sqlTable(ctx, tableName) + " WHERE status = 'approved' AND " + sqlUnexpired(d, "expires_at") + " ORDER BY config_key"
+		query = pageQuery(d, query, limit, offset)
+		
 		rows, err := connector.Query(ctx, query)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
-		
-		if rows.Next() {
-			var count int64
-			if err := rows.Scan(&count); err != nil {
-				return nil, err
-			}
-			return count, nil
-		}
-		return 0, nil
+		return a.markLargeValues(a.configRows(rows))
 		
 	case "mongodb":
-		return connector.Execute(ctx, "count", map[string]interface{}{
+		params := map[string]interface{}{
 			"collection": tableName,
-			"filter":     map[string]interface{}{"status": "approved"},
-		})
+			"filter":     a.unexpired(map[string]interface{}{"status": "approved"}),
+			"sort":       map[string]interface{}{"config_key": 1},
+		}
+		
+		if limit > 0 {
+			params["limit"] = limit
+		}
+		if offset > 0 {
+			params["skip"] = offset
+		}
+		
+		return a.markLargeValues(connector.Execute(ctx, "find", params))
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
@@ -2300,28 +2151,9 @@ func (a *API) countApprovedConfigs(ctx context.Context, connector connectors.DBC
 // configExistsApproved checks if an approved configuration exists
 func (a *API) configExistsApproved(ctx context.Context, connector connectors.DBConnector, tableName, key string) (interface{}, error) {
 	switch connector.GetType() {
-	case "mysql":
-		query := "SELECT COUNT(*) FROM " + tableName + " WHERE config_key = ? AND status = 'approved'"
-		rows, err := connector.Query(ctx, query, key)
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		
-		if rows.Next() {
-			var count int
-			if err := rows.Scan(&count); err != nil {
-				return nil, err
-			}
-			return map[string]interface{}{
-				"exists": count > 0,
-				"key":    key,
-			}, nil
-		}
-		return map[string]interface{}{"exists": false, "key": key}, nil
-		
-	case "postgresql":
-		query := "SELECT COUNT(*) FROM " + tableName + " WHERE config_key = $1 AND status = 'approved'"
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		query := connectors.Bind(d, "SELECT COUNT(*) FROM " + sqlTable(ctx, tableName) + " WHERE config_key = ? AND status = 'approved' AND " + sqlUnexpired(d, "expires_at"))
 		rows, err := connector.Query(ctx, query, key)
 		if err != nil {
 			return nil, err
@@ -2343,10 +2175,10 @@ func (a *API) configExistsApproved(ctx context.Context, connector connectors.DBC
 	case "mongodb":
 		result, err := connector.Execute(ctx, "count", map[string]interface{}{
 			"collection": tableName,
-			"filter": map[string]interface{}{
+			"filter": a.unexpired(map[string]interface{}{
 				"config_key": key,
 				"status":     "approved",
-			},
+			}),
 		})
 		if err != nil {
 			return nil, err
@@ -2373,26 +2205,56 @@ func (a *API) configExistsApproved(ctx context.Context, connector connectors.DBC
 // DIRECT OPERATIONS (BYPASS APPROVAL)
 // ========================================
 
-// createConfigDirect creates configuration directly with approved status
-func (a *API) createConfigDirect(ctx context.Context, connector connectors.DBConnector, databaseName, tableName, key string, value interface{}, description, makerID string) (interface{}, error) {
+// createConfigDirect creates configuration directly with approved status, returning ErrConfigExists
+// when the key is taken
+func (a *API) createConfigDirect(ctx context.Context, connector connectors.DBConnector, tableName, key string, value interface{}, description string, tags []string, expiresAt *time.Time, makerID string) (interface{}, error) {
+	if err := a.rules.checkConfig(key, value); err != nil {
+		return nil, err
+	}
+
+	// A dry run writes nothing for the unique index to reject, so look the key up instead
+	_, dryRun := connector.(*dryRunConnector)
+	if dryRun {
+		exists, err := a.configExists(ctx, connector, tableName, key)
+		if err != nil {
+			return nil, err
+		}
+		if found, _ := exists.(map[string]interface{})["exists"].(bool); found {
+			return nil, fmt.Errorf("%w: %s", ErrConfigExists, key)
+		}
+	}
+
+	write := &ConfigWrite{Key: key}
+	var err error
 	switch connector.GetType() {
-	case "mysql":
-		query := `INSERT INTO ` + tableName + ` (config_key, config_value, description, status, maker_id, created_at, updated_at, approved_at) 
-				  VALUES (?, ?, ?, 'approved', ?, NOW(), NOW(), NOW())`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		expiryColumn, expiryValue := expiryColumns(expiresAt)
+		query := connectors.Bind(d, `INSERT INTO ` + sqlTable(ctx, tableName) + ` (config_key, config_value, description, tags, status, maker_id, created_at, updated_at, approved_at` + expiryColumn + `) 
+				  VALUES (?, ?, ?, ?, 'approved', ?, ` + d.NowFunc() + `, ` + d.NowFunc() + `, ` + d.NowFunc() + expiryValue + `)`)
+		args := []interface{}{key, integerValue(value), description, tagsArg(tags), makerID}
+		if expiresAt != nil {
+			args = append(args, expiryArg(expiresAt))
+		}
+		
+		// PostgreSQL returns the timestamps from the insert, except in a dry run, which records the insert
+		// rather than running it
+		if connector.GetType() == "postgresql" && !dryRun {
+			write, _, err = returnConfigWrite(ctx, connector, query, args, key)
+			break
+		}
+		_, err = connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
-			"args":  []interface{}{key, value, description, makerID},
+			"args":  args,
 		})
 		
-	case "postgresql":
-		query := `INSERT INTO ` + tableName + ` (config_key, config_value, description, status, maker_id, created_at, updated_at, approved_at) 
-				  VALUES ($1, $2, $3, 'approved', $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{key, value, description, makerID},
-		})
+		// MySQL cannot return the timestamps from the insert, so read them back
+		if err == nil && !dryRun {
+			write, err = a.readConfigWrite(ctx, connector, tableName, key)
+		}
 		
 	case "mongodb":
+		now := mongoNow()
 		params := map[string]interface{}{
 			"collection": tableName,
 			"document": map[string]interface{}{
@@ -2401,39 +2263,81 @@ func (a *API) createConfigDirect(ctx context.Context, connector connectors.DBCon
 				"description":  description,
 				"status":       "approved",
 				"maker_id":     makerID,
-				"created_at":   time.Now(),
-				"updated_at":   time.Now(),
-				"approved_at":  time.Now(),
+				"created_at":   now,
+				"updated_at":   now,
+				"approved_at":  now,
 			},
 		}
-		
-		// Add database parameter for MongoDB
-		if databaseName != "" {
-			params["database"] = databaseName
+		if tags != nil {
+			params["document"].(map[string]interface{})["tags"] = tags
+		}
+		if expiresAt != nil {
+			params["document"].(map[string]interface{})["expires_at"] = expiryArg(expiresAt)
 		}
 		
-		return connector.Execute(ctx, "insert", params)
+		_, err = connector.Execute(ctx, "insert", params)
+		if !dryRun {
+			write.CreatedAt, write.UpdatedAt, write.ApprovedAt = &now, &now, &now
+		}
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
+
+	if connectors.IsDuplicateKey(err) {
+		// An expired config keeps its key until it is deleted, which it can be now
+		if deleted, _ := a.deleteExpiredConfig(ctx, connector, tableName, key); deleted {
+			return a.createConfigDirect(ctx, connector, tableName, key, value, description, tags, expiresAt, makerID)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrConfigExists, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.recordConfigChange(ctx, connector, events.Event{Table: tableName, Key: key, Operation: events.OperationCreate, NewValueHash: valueHash(value), Actor: makerID})
+	if write != nil {
+		write.ExpiresAt = expiresAt
+	}
+	return write, nil
 }
 
-// updateConfigDirect updates configuration directly with approved status
-func (a *API) updateConfigDirect(ctx context.Context, connector connectors.DBConnector, databaseName, tableName, key string, value interface{}, description, makerID string) (interface{}, error) {
+// updateConfigDirect updates configuration directly with approved status, returning ErrConfigNotFound
+// when no config is stored under the key
+func (a *API) updateConfigDirect(ctx context.Context, connector connectors.DBConnector, tableName, key string, value interface{}, description string, tags []string, expiresAt *time.Time, makerID string) (interface{}, error) {
+	if err := a.rules.checkConfig(key, value); err != nil {
+		return nil, err
+	}
+	_, dryRun := connector.(*dryRunConnector)
+	oldHash, _ := a.previousValueHash(ctx, connector, tableName, key)
+	change := events.Event{Table: tableName, Key: key, Operation: events.OperationUpdate, OldValueHash: oldHash, NewValueHash: valueHash(value), Actor: makerID}
+	var result interface{}
+	var err error
 	switch connector.GetType() {
-	case "mysql":
-		query := `UPDATE ` + tableName + ` SET config_value = ?, description = ?, status = 'approved', maker_id = ?, updated_at = NOW(), approved_at = NOW() WHERE config_key = ?`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{value, description, makerID, key},
-		})
-		
-	case "postgresql":
-		query := `UPDATE ` + tableName + ` SET config_value = $1, description = $2, status = 'approved', maker_id = $3, updated_at = CURRENT_TIMESTAMP, approved_at = CURRENT_TIMESTAMP WHERE config_key = $4`
-		return connector.Execute(ctx, "execute", map[string]interface{}{
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		set := `config_value = ?, description = ?, status = 'approved', maker_id = ?, tags = COALESCE(?, tags), updated_at = ` + d.NowFunc() + `, approved_at = ` + d.NowFunc()
+		args := []interface{}{integerValue(value), description, makerID, tagsArg(tags)}
+		if expiresAt != nil {
+			set += ", expires_at = ?"
+			args = append(args, expiryArg(expiresAt))
+		}
+		query := connectors.Bind(d, `UPDATE ` + sqlTable(ctx, tableName) + ` SET ` + set + ` WHERE config_key = ?`)
+		args = append(args, key)
+		if connector.GetType() == "postgresql" && !dryRun {
+			write, found, err := returnConfigWrite(ctx, connector, query, args, key)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, key)
+			}
+			a.recordConfigChange(ctx, connector, change)
+			write.ExpiresAt = expiresAt
+			return write, nil
+		}
+		result, err = connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
-			"args":  []interface{}{value, description, makerID, key},
+			"args":  args,
 		})
 		
 	case "mongodb":
@@ -2447,46 +2351,59 @@ func (a *API) updateConfigDirect(ctx context.Context, connector connectors.DBCon
 					"description":  description,
 					"status":       "approved",
 					"maker_id":     makerID,
-					"updated_at":   time.Now(),
-					"approved_at":  time.Now(),
-				},
-				"$setOnInsert": map[string]interface{}{
-					"created_at": time.Now(),
 				},
+				"$currentDate": currentDate("updated_at", "approved_at"),
 			},
 		}
-		
-		// Add database parameter for MongoDB
-		if databaseName != "" {
-			params["database"] = databaseName
+		if tags != nil {
+			params["update"].(map[string]interface{})["$set"].(map[string]interface{})["tags"] = tags
+		}
+		if expiresAt != nil {
+			params["update"].(map[string]interface{})["$set"].(map[string]interface{})["expires_at"] = expiryArg(expiresAt)
 		}
 		
-		return connector.Execute(ctx, "upsert", params)
+		result, err = connector.Execute(ctx, "update", params)
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
+
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkConfigAffected(ctx, connector, tableName, key, result); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return &ConfigWrite{Key: key}, nil
+	}
+	a.recordConfigChange(ctx, connector, change)
+	
+	// MySQL and MongoDB cannot return the timestamps from the update, so read them back
+	write, err := a.readConfigWrite(ctx, connector, tableName, key)
+	if err != nil {
+		return nil, err
+	}
+	write.ExpiresAt = expiresAt
+	return write, nil
 }
 
-// deleteConfigDirect deletes configuration directly
+// deleteConfigDirect deletes configuration directly, returning ErrConfigNotFound when no config is
+// stored under the key
 func (a *API) deleteConfigDirect(ctx context.Context, connector connectors.DBConnector, tableName, key, makerID string) (interface{}, error) {
+	oldHash, _ := a.previousValueHash(ctx, connector, tableName, key)
+	var result interface{}
+	var err error
 	switch connector.GetType() {
-	case "mysql":
-		query := "DELETE FROM " + tableName + " WHERE config_key = ?"
-		return connector.Execute(ctx, "execute", map[string]interface{}{
-			"query": query,
-			"args":  []interface{}{key},
-		})
-		
-	case "postgresql":
-		query := "DELETE FROM " + tableName + " WHERE config_key = $1"
-		return connector.Execute(ctx, "execute", map[string]interface{}{
+	case "mysql", "postgresql":
+		query := connectors.Bind(sqlDialect(connector), "DELETE FROM " + sqlTable(ctx, tableName) + " WHERE config_key = ?")
+		result, err = connector.Execute(ctx, "execute", map[string]interface{}{
 			"query": query,
 			"args":  []interface{}{key},
 		})
 		
 	case "mongodb":
-		return connector.Execute(ctx, "delete", map[string]interface{}{
+		result, err = connector.Execute(ctx, "delete", map[string]interface{}{
 			"collection": tableName,
 			"filter":     map[string]interface{}{"config_key": key},
 		})
@@ -2494,73 +2411,70 @@ func (a *API) deleteConfigDirect(ctx context.Context, connector connectors.DBCon
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
+
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkConfigAffected(ctx, connector, tableName, key, result); err != nil {
+		return nil, err
+	}
+	a.recordConfigChange(ctx, connector, events.Event{Table: tableName, Key: key, Operation: events.OperationDelete, OldValueHash: oldHash, Actor: makerID})
+	return result, nil
 }
 
-// createMultipleConfigsDirect creates multiple configurations directly with approved status
-func (a *API) createMultipleConfigsDirect(ctx context.Context, connector connectors.DBConnector, databaseName, tableName string, configs []ConfigItem) (interface{}, error) {
-	results := make(map[string]interface{})
-	successCount := 0
-	
-	for _, config := range configs {
-		result, err := a.createConfigDirect(ctx, connector, databaseName, tableName, config.Key, config.Value, config.Description, config.MakerID)
-		if err != nil {
-			results[config.Key] = map[string]interface{}{"error": err.Error()}
-		} else {
-			results[config.Key] = map[string]interface{}{"success": true, "result": result}
-			successCount++
-		}
+// affectedCount returns the rows (SQL) or documents (MongoDB) matched by an update or delete, reporting
+// false for results that carry no count
+func affectedCount(result interface{}) (int64, bool) {
+	switch r := result.(type) {
+	case sql.Result:
+		count, err := r.RowsAffected()
+		return count, err == nil
+	case *mongo.UpdateResult:
+		return r.MatchedCount, true
+	case *mongo.DeleteResult:
+		return r.DeletedCount, true
 	}
-	
-	return map[string]interface{}{
-		"total_items":    len(configs),
-		"success_count":  successCount,
-		"failure_count":  len(configs) - successCount,
-		"results":        results,
-	}, nil
+	return 0, false
 }
 
-// updateMultipleConfigsDirect updates multiple configurations directly with approved status
-func (a *API) updateMultipleConfigsDirect(ctx context.Context, connector connectors.DBConnector, databaseName, tableName string, configs []ConfigItem) (interface{}, error) {
-	results := make(map[string]interface{})
-	successCount := 0
-	
-	for _, config := range configs {
-		result, err := a.updateConfigDirect(ctx, connector, databaseName, tableName, config.Key, config.Value, config.Description, config.MakerID)
+// checkConfigAffected returns ErrConfigNotFound when a direct update or delete of the key matched nothing
+func (a *API) checkConfigAffected(ctx context.Context, connector connectors.DBConnector, tableName, key string, result interface{}) error {
+	if count, ok := affectedCount(result); !ok || count > 0 {
+		return nil
+	}
+	// MySQL counts changed rather than matched rows, so rewriting the same values within a second affects none
+	if connector.GetType() == "mysql" {
+		exists, err := a.configExists(ctx, connector, tableName, key)
 		if err != nil {
-			results[config.Key] = map[string]interface{}{"error": err.Error()}
-		} else {
-			results[config.Key] = map[string]interface{}{"success": true, "result": result}
-			successCount++
+			return err
+		}
+		if found, _ := exists.(map[string]interface{})["exists"].(bool); found {
+			return nil
 		}
 	}
-	
-	return map[string]interface{}{
-		"total_items":    len(configs),
-		"success_count":  successCount,
-		"failure_count":  len(configs) - successCount,
-		"results":        results,
-	}, nil
+	return fmt.Errorf("%w: %s", ErrConfigNotFound, key)
+}
+
+// createMultipleConfigsDirect creates multiple configurations directly with approved status
+func (a *API) createMultipleConfigsDirect(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem, opts configBatchOptions) (interface{}, error) {
+	return a.runConfigBatch(ctx, connector, configItemKeys(configs), opts, func(ctx context.Context, connector connectors.DBConnector, i int) (interface{}, error) {
+		config := configs[i]
+		return a.createConfigDirect(ctx, connector, tableName, config.Key, config.Value, config.Description, config.Tags, nil, config.MakerID)
+	})
+}
+
+// updateMultipleConfigsDirect updates multiple configurations directly with approved status
+func (a *API) updateMultipleConfigsDirect(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem, opts configBatchOptions) (interface{}, error) {
+	return a.runConfigBatch(ctx, connector, configItemKeys(configs), opts, func(ctx context.Context, connector connectors.DBConnector, i int) (interface{}, error) {
+		config := configs[i]
+		return a.updateConfigDirect(ctx, connector, tableName, config.Key, config.Value, config.Description, config.Tags, nil, config.MakerID)
+	})
 }
 
 // deleteMultipleConfigsDirect deletes multiple configurations directly
-func (a *API) deleteMultipleConfigsDirect(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem) (interface{}, error) {
-	results := make(map[string]interface{})
-	successCount := 0
-	
-	for _, config := range configs {
-		result, err := a.deleteConfigDirect(ctx, connector, tableName, config.Key, config.MakerID)
-		if err != nil {
-			results[config.Key] = map[string]interface{}{"error": err.Error()}
-		} else {
-			results[config.Key] = map[string]interface{}{"success": true, "result": result}
-			successCount++
-		}
-	}
-	
-	return map[string]interface{}{
-		"total_items":    len(configs),
-		"success_count":  successCount,
-		"failure_count":  len(configs) - successCount,
-		"results":        results,
-	}, nil
+func (a *API) deleteMultipleConfigsDirect(ctx context.Context, connector connectors.DBConnector, tableName string, configs []ConfigItem, opts configBatchOptions) (interface{}, error) {
+	return a.runConfigBatch(ctx, connector, configItemKeys(configs), opts, func(ctx context.Context, connector connectors.DBConnector, i int) (interface{}, error) {
+		config := configs[i]
+		return a.deleteConfigDirect(ctx, connector, tableName, config.Key, config.MakerID)
+	})
 }
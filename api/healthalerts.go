@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/logging"
+	"db-connectors/webhook"
+)
+
+// DefaultMinStateDuration is how long a connection stays unhealthy, or healthy again, before it is
+// notified, so that a connection flapping between the two does not page anyone on every ping
+const DefaultMinStateDuration = 30 * time.Second
+
+// Events of a HealthAlert
+const (
+	HealthEventUnhealthy = "connection_unhealthy"
+	HealthEventRecovered = "connection_recovered"
+)
+
+// HealthAlerts configures the notifications sent when a connection profile turns unhealthy, as its
+// keepalive ping fails or its circuit breaker opens, and when it recovers. Each is logged and, with a
+// webhook set, posted to it as a HealthAlert.
+type HealthAlerts struct {
+	MinStateDuration time.Duration   // A change is notified once it lasted this long; zero keeps the default, negative notifies right away
+	Webhook          *webhook.Client // nil only logs the changes
+}
+
+// HealthAlert is posted to the alerting webhook when a connection turns unhealthy or recovers
+type HealthAlert struct {
+	Event          string            `json:"event"`
+	Connection     string            `json:"connection"`
+	Type           string            `json:"type"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Error          string            `json:"error,omitempty"`       // Why the connection turned unhealthy
+	ErrorClass     string            `json:"error_class,omitempty"` // Such as host_unreachable or timeout
+	ErrorCode      string            `json:"error_code,omitempty"`
+	UnhealthySince time.Time         `json:"unhealthy_since"`
+	OutageMs       int64             `json:"outage_ms,omitempty"` // How long the connection was unhealthy, once it recovers
+	Timestamp      time.Time         `json:"timestamp"`
+}
+
+// connectionHealth is the last notified health of one connection
+type connectionHealth struct {
+	unhealthy  *connectors.HealthChange // The notified change to unhealthy; nil while healthy
+	generation int                      // Counts the changes, so that a pending notification superseded by a later change is dropped
+}
+
+// healthAlerter debounces the changes of health of each connection, keyed by profile name
+type healthAlerter struct {
+	HealthAlerts
+	mu          sync.Mutex
+	connections map[string]*connectionHealth
+}
+
+// newHealthAlerter creates an alerter, filling an unset minimum state duration with the default
+func newHealthAlerter(alerts HealthAlerts) *healthAlerter {
+	if alerts.MinStateDuration == 0 {
+		alerts.MinStateDuration = DefaultMinStateDuration
+	}
+	alerts.MinStateDuration = max(alerts.MinStateDuration, 0)
+	return &healthAlerter{HealthAlerts: alerts, connections: map[string]*connectionHealth{}}
+}
+
+// healthChanged notifies a change of health of a connection once it has lasted the minimum state duration.
+// A connection changing back before then notifies nothing.
+func (a *API) healthChanged(change connectors.HealthChange) {
+	alerts := a.alerts
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+	health, ok := alerts.connections[change.Name]
+	if !ok {
+		health = &connectionHealth{}
+		alerts.connections[change.Name] = health
+	}
+	health.generation++
+	if change.Healthy == (health.unhealthy == nil) {
+		// Back to the notified health before the change was notified
+		return
+	}
+	generation := health.generation
+	time.AfterFunc(alerts.MinStateDuration, func() { a.notifyHealth(change, generation) })
+}
+
+// notifyHealth logs and posts a change of health, unless a later change superseded it
+func (a *API) notifyHealth(change connectors.HealthChange, generation int) {
+	alerts := a.alerts
+	alerts.mu.Lock()
+	health := alerts.connections[change.Name]
+	if health.generation != generation {
+		alerts.mu.Unlock()
+		return
+	}
+	alert := HealthAlert{
+		Connection: change.Name,
+		Type:       change.Type,
+		Labels:     change.Labels,
+		Timestamp:  change.At,
+	}
+	if change.Healthy {
+		down := health.unhealthy
+		health.unhealthy = nil
+		alert.Event = HealthEventRecovered
+		alert.UnhealthySince = down.At
+		alert.OutageMs = change.At.Sub(down.At).Milliseconds()
+		alert.Error, alert.ErrorClass, alert.ErrorCode = healthError(down.Err)
+	} else {
+		health.unhealthy = &change
+		alert.Event = HealthEventUnhealthy
+		alert.UnhealthySince = change.At
+		alert.Error, alert.ErrorClass, alert.ErrorCode = healthError(change.Err)
+	}
+	alerts.mu.Unlock()
+
+	attrs := []interface{}{"profile", alert.Connection, "type", alert.Type, "labels", alert.Labels, "error", alert.Error, "error_class", alert.ErrorClass}
+	if change.Healthy {
+		a.logger.Info("connection recovered", append(attrs, "outage_ms", alert.OutageMs)...)
+	} else {
+		a.logger.Warn("connection became unhealthy", attrs...)
+	}
+	if alerts.Webhook == nil {
+		return
+	}
+	if err := alerts.Webhook.Post(context.Background(), alert); err != nil {
+		a.logger.Error("failed to post health alert", "profile", alert.Connection, "event", alert.Event, "error", err)
+	}
+}
+
+// healthError describes why a connection turned unhealthy, redacting any credentials the driver quoted
+func healthError(err error) (message, class, code string) {
+	if err == nil {
+		return "", "", ""
+	}
+	_, code = classifyDatabaseError(err)
+	return logging.RedactDSN(err.Error()), string(connectors.ClassifyError(err)), code
+}
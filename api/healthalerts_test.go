@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/logging"
+	"db-connectors/webhook"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the goroutines notifying health changes
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newAlertingAPI returns an API with a "primary" profile whose health alerts are posted to the returned channel
+func newAlertingAPI(t *testing.T, minState time.Duration, logs *syncBuffer) (*API, <-chan HealthAlert) {
+	posted := make(chan HealthAlert, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert HealthAlert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		posted <- alert
+	}))
+	t.Cleanup(server.Close)
+	client, err := webhook.New(webhook.Options{URL: server.URL})
+	require.NoError(t, err)
+
+	api := NewServer(config.ServerConfig{},
+		WithLogger(logging.New(logging.Options{Level: "info", Format: logging.FormatJSON, Output: logs})),
+		WithHealthAlerts(HealthAlerts{MinStateDuration: minState, Webhook: client}),
+		WithProfile(ConnectionProfile{
+			Name:      "primary",
+			Connector: newProfileConnector("mysql"),
+			Labels:    map[string]string{"team": "payments"},
+		}),
+	).API()
+	return api, posted
+}
+
+// nextAlert waits for the next posted alert
+func nextAlert(t *testing.T, posted <-chan HealthAlert) HealthAlert {
+	t.Helper()
+	select {
+	case alert := <-posted:
+		return alert
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "no health alert posted")
+		return HealthAlert{}
+	}
+}
+
+// requireNoAlert asserts that nothing is posted for a while
+func requireNoAlert(t *testing.T, posted <-chan HealthAlert, wait time.Duration) {
+	t.Helper()
+	select {
+	case alert := <-posted:
+		require.FailNow(t, "unexpected health alert", "%+v", alert)
+	case <-time.After(wait):
+	}
+}
+
+func TestHealthAlerts(t *testing.T) {
+	var logs syncBuffer
+	minState := 20 * time.Millisecond
+	api, posted := newAlertingAPI(t, minState, &logs)
+
+	// A failing keepalive ping notifies once the connection stayed unhealthy long enough
+	api.registry.MarkKeepAlive("primary", refused)
+	api.registry.MarkKeepAlive("primary", refused)
+	alert := nextAlert(t, posted)
+	assert.Equal(t, HealthEventUnhealthy, alert.Event)
+	assert.Equal(t, "primary", alert.Connection)
+	assert.Equal(t, "mysql", alert.Type)
+	assert.Equal(t, map[string]string{"team": "payments"}, alert.Labels)
+	assert.Contains(t, alert.Error, "connection refused")
+	assert.Equal(t, "host_unreachable", alert.ErrorClass)
+	assert.Equal(t, ErrorCodeHostUnreachable, alert.ErrorCode)
+	assert.Zero(t, alert.OutageMs)
+	requireNoAlert(t, posted, 5*minState)
+
+	// Recovering reports how long the outage lasted
+	api.registry.MarkKeepAlive("primary", nil)
+	recovered := nextAlert(t, posted)
+	assert.Equal(t, HealthEventRecovered, recovered.Event)
+	assert.Equal(t, alert.UnhealthySince, recovered.UnhealthySince)
+	assert.Equal(t, recovered.Timestamp.Sub(alert.UnhealthySince).Milliseconds(), recovered.OutageMs)
+	assert.Positive(t, recovered.OutageMs)
+	assert.Equal(t, "host_unreachable", recovered.ErrorClass)
+	requireNoAlert(t, posted, 5*minState)
+
+	assert.Equal(t, 1, strings.Count(logs.String(), `"msg":"connection became unhealthy"`))
+	assert.Equal(t, 1, strings.Count(logs.String(), `"msg":"connection recovered"`))
+	assert.Contains(t, logs.String(), `"level":"WARN"`)
+}
+
+func TestHealthAlertsDebounceFlapping(t *testing.T) {
+	var logs syncBuffer
+	minState := 50 * time.Millisecond
+	api, posted := newAlertingAPI(t, minState, &logs)
+
+	// Changes reverted within the minimum state duration notify nothing
+	for i := 0; i < 3; i++ {
+		api.registry.MarkKeepAlive("primary", refused)
+		api.registry.MarkKeepAlive("primary", nil)
+	}
+	requireNoAlert(t, posted, 3*minState)
+	assert.Empty(t, logs.String())
+
+	// Flapping that settles on unhealthy notifies once
+	api.registry.MarkKeepAlive("primary", refused)
+	api.registry.MarkHealth("primary", nil)
+	api.registry.MarkHealth("primary", refused)
+	assert.Equal(t, HealthEventUnhealthy, nextAlert(t, posted).Event)
+	requireNoAlert(t, posted, 3*minState)
+
+	// Unregistered connections notify nothing
+	api.registry.MarkHealth("unknown", refused)
+	requireNoAlert(t, posted, 3*minState)
+}
+
+func TestHealthAlertsCircuitBreaker(t *testing.T) {
+	var logs syncBuffer
+	api, posted := newAlertingAPI(t, -1, &logs)
+	api.breakers = newCircuitBreakers(CircuitBreaker{MinRequests: 1})
+
+	// A breaker opening marks its profile unhealthy, and closing healthy again
+	now := time.Now()
+	api.breakers.now = func() time.Time { return now }
+	assert.Equal(t, refused, api.guardConnect("primary", func() error { return refused }))
+	assert.Equal(t, HealthEventUnhealthy, nextAlert(t, posted).Event)
+
+	now = now.Add(DefaultBreakerCooldown)
+	require.NoError(t, api.guardConnect("primary", func() error { return nil }))
+	assert.Equal(t, HealthEventRecovered, nextAlert(t, posted).Event)
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"db-connectors/requestid"
+)
+
+// IdempotencyKeyHeader carries the client-chosen key under which a mutating request is replayed
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayHeader is set to "true" on responses replayed from the idempotency store
+const IdempotentReplayHeader = "Idempotent-Replayed"
+
+// DefaultIdempotencyTTL is how long responses are kept for replay
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotentBody caps the response body kept for replay; larger responses, such as streamed rows, are not
+// kept, so retrying them runs the request again
+const maxIdempotentBody = 1 << 20
+
+// idempotencyScopeHeaders name the caller of a request: a key is only replayed to requests sending the same
+// values
+var idempotencyScopeHeaders = []string{TenantHeader, APIKeyHeader, ProfileHeader, UserIDHeader, UserRoleHeader}
+
+// IdempotentResponse is the response to a request sent with an idempotency key
+type IdempotentResponse struct {
+	Fingerprint string // Hash of the method, path, query and body of the request
+	Done        bool   // False while the request is still being handled
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// IdempotencyStore keeps the responses of requests sent with an idempotency key
+type IdempotencyStore interface {
+	// Reserve claims key for a request with the fingerprint, reporting true. When the key is already
+	// claimed it returns the response stored under it and false instead.
+	Reserve(key, fingerprint string) (*IdempotentResponse, bool)
+	// Complete stores the response of the request holding key
+	Complete(key string, response *IdempotentResponse)
+	// Release drops the claim on key so that the request can be retried
+	Release(key string)
+}
+
+// idempotencyEntry is a response held by the memory store until it expires
+type idempotencyEntry struct {
+	response *IdempotentResponse
+	expires  time.Time
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore keeping responses in memory for a fixed TTL
+type MemoryIdempotencyStore struct {
+	ttl       time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+// NewMemoryIdempotencyStore creates a memory store keeping responses for ttl, or DefaultIdempotencyTTL
+// when ttl is zero or less
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &MemoryIdempotencyStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Reserve claims key unless an unexpired entry holds it
+func (s *MemoryIdempotencyStore) Reserve(key, fingerprint string) (*IdempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		response := *entry.response
+		return &response, false
+	}
+	s.entries[key] = &idempotencyEntry{
+		response: &IdempotentResponse{Fingerprint: fingerprint},
+		expires:  now.Add(s.ttl),
+	}
+	return nil, true
+}
+
+// Complete stores the response of key for the TTL
+func (s *MemoryIdempotencyStore) Complete(key string, response *IdempotentResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response.Done = true
+	s.entries[key] = &idempotencyEntry{response: response, expires: s.now().Add(s.ttl)}
+}
+
+// Release forgets key
+func (s *MemoryIdempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// sweep evicts expired entries at most once per TTL; callers hold s.mu
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// size returns the number of stored keys
+func (s *MemoryIdempotencyStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and of a body of up to
+// maxIdempotentBody bytes
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool // The body outgrew maxIdempotentBody and is not kept
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if !r.truncated && r.body.Len()+len(b) > maxIdempotentBody {
+		r.truncated = true
+		r.body = bytes.Buffer{}
+	}
+	if !r.truncated {
+		r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed rows reach the client through the recorder
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// idempotencyKey returns the key of the Idempotency-Key header, or else of the idempotency_key field of a
+// JSON body
+func idempotencyKey(r *http.Request, body []byte) string {
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		return key
+	}
+	var fields struct {
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	return fields.IdempotencyKey
+}
+
+// requestFingerprint hashes the method, path, query and body of a request; /v1 paths hash like their
+// unversioned aliases
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", r.Method, strings.TrimPrefix(r.URL.Path, "/v1"), r.URL.RawQuery)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyStoreKey scopes key to the caller of r, so that tenants, API keys, profiles and roles choosing
+// the same key never get each other's responses. The scope is hashed, keeping API keys out of the store.
+func idempotencyStoreKey(r *http.Request, key string) string {
+	hash := sha256.New()
+	for _, name := range idempotencyScopeHeaders {
+		fmt.Fprintf(hash, "%s: %q\n", name, r.Header.Get(name))
+	}
+	fmt.Fprintf(hash, "%q", key)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyMiddleware replays the stored response of a request repeating the idempotency key and body of
+// an earlier one from the same caller, and rejects a key reused with a different body, or while its first
+// request is still running, with 409 Conflict. Server errors, requests cancelled by their client and
+// responses larger than maxIdempotentBody are not stored, so retrying them runs the request again.
+func (a *API) idempotencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.idempotency == nil || r.Body == nil {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				a.sendError(w, http.StatusRequestEntityTooLarge, ErrorCodePayloadTooLarge, fmt.Sprintf("Request body exceeds the limit of %d bytes", maxBytesErr.Limit))
+				return
+			}
+			a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to read request body: %v", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := idempotencyKey(r, body)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		fingerprint := requestFingerprint(r, body)
+		storeKey := idempotencyStoreKey(r, key)
+		stored, reserved := a.idempotency.Reserve(storeKey, fingerprint)
+		if !reserved {
+			a.replayIdempotentResponse(w, key, fingerprint, stored)
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				a.idempotency.Release(storeKey)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.status >= http.StatusInternalServerError || r.Context().Err() != nil || recorder.truncated {
+			return
+		}
+
+		header := w.Header().Clone()
+		header.Del(requestid.Header)
+		// corsMiddleware sets these for the origin of each request; a replay to another origin gets its own
+		for _, name := range corsResponseHeaders {
+			header.Del(name)
+		}
+		a.idempotency.Complete(storeKey, &IdempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      recorder.status,
+			Header:      header,
+			Body:        recorder.body.Bytes(),
+		})
+		completed = true
+	}
+}
+
+// replayIdempotentResponse responds to a request whose idempotency key is already taken
+func (a *API) replayIdempotentResponse(w http.ResponseWriter, key, fingerprint string, stored *IdempotentResponse) {
+	switch {
+	case stored.Fingerprint != fingerprint:
+		a.sendJSON(w, http.StatusConflict, DatabaseResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Idempotency-Key %s was already used for a different request", key),
+			ErrorCode: ErrorCodeConflict,
+			Details:   map[string]interface{}{"idempotency_key": key},
+			Timestamp: time.Now(),
+		})
+	case !stored.Done:
+		a.sendJSON(w, http.StatusConflict, DatabaseResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("A request with Idempotency-Key %s is still in progress", key),
+			ErrorCode: ErrorCodeConflict,
+			Details:   map[string]interface{}{"idempotency_key": key},
+			Timestamp: time.Now(),
+		})
+	default:
+		for name, values := range stored.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(IdempotentReplayHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIdempotentHandler returns a handler counting its calls behind the idempotency middleware, backed
+// by a store whose clock the test controls
+func newIdempotentHandler(status int) (http.HandlerFunc, *MemoryIdempotencyStore, *time.Time, *int) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryIdempotencyStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	api := NewAPI()
+	api.idempotency = store
+	calls := 0
+	handler := api.idempotencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/v1/jobs/job-1")
+		api.sendJSON(w, status, map[string]interface{}{"call": calls})
+	})
+	return handler, store, &now, &calls
+}
+
+// sendIdempotent posts body to the handler with the Idempotency-Key header set to key, if any
+func sendIdempotent(handler http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	handler, _, _, calls := newIdempotentHandler(http.StatusAccepted)
+
+	first := sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "insert"}`)
+	assert.Equal(t, http.StatusAccepted, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayHeader))
+
+	// The unversioned alias replays responses to /v1 requests
+	replay := sendIdempotent(handler, "/execute", "key-1", `{"operation": "insert"}`)
+	assert.Equal(t, http.StatusAccepted, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, "/v1/jobs/job-1", replay.Header().Get("Location"))
+	assert.JSONEq(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, 1, *calls)
+
+	// The key may also be sent in the body
+	sendIdempotent(handler, "/v1/execute", "", `{"operation": "insert", "idempotency_key": "key-2"}`)
+	replay = sendIdempotent(handler, "/v1/execute", "", `{"operation": "insert", "idempotency_key": "key-2"}`)
+	assert.Equal(t, "true", replay.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, 2, *calls)
+
+	// Requests without a key always run
+	sendIdempotent(handler, "/v1/execute", "", `{"operation": "insert"}`)
+	sendIdempotent(handler, "/v1/execute", "", `{"operation": "insert"}`)
+	assert.Equal(t, 4, *calls)
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	handler, store, _, calls := newIdempotentHandler(http.StatusOK)
+
+	sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "insert"}`)
+	for name, rr := range map[string]*httptest.ResponseRecorder{
+		"different body":  sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "delete"}`),
+		"different path":  sendIdempotent(handler, "/v1/execute-batch", "key-1", `{"operation": "insert"}`),
+		"different query": sendIdempotent(handler, "/v1/execute?format=jsonl", "key-1", `{"operation": "insert"}`),
+	} {
+		assert.Equal(t, http.StatusConflict, rr.Code, name)
+		var response DatabaseResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, ErrorCodeConflict, response.ErrorCode, name)
+		assert.Equal(t, map[string]interface{}{"idempotency_key": "key-1"}, response.Details, name)
+	}
+	assert.Equal(t, 1, *calls)
+
+	// A key whose first request is still running cannot be replayed yet
+	running := httptest.NewRequest(http.MethodPost, "/v1/execute", nil)
+	_, reserved := store.Reserve(idempotencyStoreKey(running, "key-2"), requestFingerprint(running, []byte(`{}`)))
+	require.True(t, reserved)
+	rr := sendIdempotent(handler, "/v1/execute", "key-2", `{}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "still in progress")
+	assert.Equal(t, 1, *calls)
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	handler, store, now, calls := newIdempotentHandler(http.StatusOK)
+
+	sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "insert"}`)
+	*now = now.Add(59 * time.Minute)
+	assert.Equal(t, "true", sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "insert"}`).Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, 1, *calls)
+
+	// Once expired the key runs again, even with a different body
+	*now = now.Add(2 * time.Minute)
+	rr := sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "delete"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, 2, *calls)
+
+	// Expired keys are evicted
+	sendIdempotent(handler, "/v1/execute", "key-2", `{}`)
+	assert.Equal(t, 2, store.size())
+	*now = now.Add(2 * time.Hour)
+	sendIdempotent(handler, "/v1/execute", "key-3", `{}`)
+	assert.Equal(t, 1, store.size())
+}
+
+func TestIdempotencyScopedByCaller(t *testing.T) {
+	handler, store, _, calls := newIdempotentHandler(http.StatusOK)
+	send := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewBufferString(`{"operation": "select"}`))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	send("", "")
+	for _, header := range idempotencyScopeHeaders {
+		rr := send(header, "other")
+		assert.Equal(t, http.StatusOK, rr.Code, header)
+		assert.Empty(t, rr.Header().Get(IdempotentReplayHeader), header)
+	}
+	assert.Equal(t, 1+len(idempotencyScopeHeaders), *calls)
+
+	// The same caller still gets its own response
+	rr := send(TenantHeader, "other")
+	assert.Equal(t, "true", rr.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, 1+len(idempotencyScopeHeaders), *calls)
+
+	// API keys are hashed into the store key
+	for key := range store.entries {
+		assert.NotContains(t, key, "other")
+	}
+}
+
+func TestIdempotencyLargeResponsesNotStored(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Hour)
+	api := NewAPI()
+	api.idempotency = store
+	calls := 0
+	handler := api.idempotencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// Rows streamed in writes that outgrow the cap together
+		line := bytes.Repeat([]byte("x"), maxIdempotentBody/4)
+		for i := 0; i < 5; i++ {
+			w.Write(line)
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		rr := sendIdempotent(handler, "/v1/execute?format=jsonl", "key-1", `{"operation": "select"}`)
+		assert.Equal(t, 5*(maxIdempotentBody/4), rr.Body.Len())
+		assert.Empty(t, rr.Header().Get(IdempotentReplayHeader))
+	}
+	assert.Equal(t, 2, calls)
+	assert.Zero(t, store.size())
+}
+
+func TestIdempotencyServerErrorsNotStored(t *testing.T) {
+	handler, store, _, calls := newIdempotentHandler(http.StatusBadGateway)
+
+	sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "insert"}`)
+	rr := sendIdempotent(handler, "/v1/execute", "key-1", `{"operation": "insert"}`)
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Empty(t, rr.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, 2, *calls)
+	assert.Zero(t, store.size())
+}
+
+func TestIdempotentRoutes(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+	body := `{"type": "mysql", "host": "db.invalid", "port": 3306, "database": "app", "operation": "approve_request"}`
+
+	first := sendIdempotent(handler, "/v1/allconfig-operation", "key-1", body)
+	assert.Equal(t, http.StatusBadRequest, first.Code)
+	replay := sendIdempotent(handler, "/allconfig-operation", "key-1", body)
+	assert.Equal(t, http.StatusBadRequest, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get(IdempotentReplayHeader))
+	assert.NotEmpty(t, replay.Header().Get("X-Request-ID"))
+
+	// A replay to another origin is answered with the CORS headers of that origin
+	cors := NewAPI()
+	cors.cors = restrictedCORSPolicy()
+	handler = SetupRoutes(cors)
+	send := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/allconfig-operation", bytes.NewBufferString(body))
+		req.Header.Set(IdempotencyKeyHeader, "key-2")
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	first = send("https://admin.example.org")
+	assert.Equal(t, "https://admin.example.org", first.Header().Get("Access-Control-Allow-Origin"))
+	replay = send("https://app.example.com")
+	assert.Equal(t, "true", replay.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, "https://app.example.com", replay.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, []string{"Origin"}, replay.Header().Values("Vary"))
+	replay = send("https://evil.test")
+	assert.Equal(t, "true", replay.Header().Get(IdempotentReplayHeader))
+	assert.Empty(t, replay.Header().Get("Access-Control-Allow-Origin"), "a disallowed origin gets no CORS headers")
+	assert.Empty(t, replay.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Read-only endpoints ignore the header
+	health := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+	health.Header.Set(IdempotencyKeyHeader, "key-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, health)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(IdempotentReplayHeader))
+}
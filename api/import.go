@@ -0,0 +1,496 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// Formats of /import uploads
+const (
+	ImportFormatCSV   = "csv"   // Comma-separated values with a header row
+	ImportFormatJSONL = "jsonl" // One JSON object per line
+)
+
+// Rows loaded by one bulk insert of an import, unless the request sets chunk_size
+const (
+	defaultImportChunkSize = 5000
+	maxImportChunkSize     = 100000
+)
+
+// ImportRequest loads an upload of CSV or JSON Lines rows into a table
+type ImportRequest struct {
+	DatabaseConnectionRequest
+	Table  string `json:"table" validate:"required"`
+	Format string `json:"format,omitempty"` // csv (default) or jsonl
+	Data   string `json:"data"`             // CSV with a header row, or one JSON object per line
+	// Maps CSV header fields or JSON keys to the table columns they are loaded into. When set only the
+	// mapped fields are loaded; otherwise every field is loaded into the column of the same name.
+	Columns   map[string]string `json:"columns,omitempty"`
+	ChunkSize int               `json:"chunk_size,omitempty"` // Rows loaded per transaction, defaults to 5000
+}
+
+// ImportChunkFailure reports a chunk of an import that was not loaded
+type ImportChunkFailure struct {
+	Chunk    int    `json:"chunk"`
+	FirstRow int    `json:"first_row"` // Index of the chunk's first row in the upload, counting from 0
+	Rows     int    `json:"rows"`
+	Error    string `json:"error"`
+}
+
+// ImportResult reports the rows an import loaded. Each chunk is loaded in a transaction of its own, so the
+// rows of failed chunks are not loaded while those of the other chunks are.
+type ImportResult struct {
+	Table     string               `json:"table"`
+	Columns   []string             `json:"columns"`
+	Rows      int                  `json:"rows"` // Rows in the upload
+	Loaded    int64                `json:"loaded"`
+	ChunkSize int                  `json:"chunk_size"`
+	Chunks    int                  `json:"chunks"`
+	Failures  []ImportChunkFailure `json:"failures,omitempty"`
+	// Looks up the keys and outcomes with get_operation; set by the import allconfig operation only
+	OperationID string `json:"operation_id,omitempty"`
+
+	err error // Error of the first failed chunk, which sets the status when no chunk loaded
+}
+
+// importChunks splits rows into the [lo, hi) ranges loaded by one bulk insert each
+func importChunks(rows, chunkSize int) [][2]int {
+	if chunkSize <= 0 {
+		chunkSize = defaultImportChunkSize
+	}
+	var chunks [][2]int
+	for lo := 0; lo < rows; lo += chunkSize {
+		hi := lo + chunkSize
+		if hi > rows {
+			hi = rows
+		}
+		chunks = append(chunks, [2]int{lo, hi})
+	}
+	return chunks
+}
+
+// parseImport parses an upload into the table columns and the rows of values loaded into them
+func parseImport(format, data string, mapping map[string]string) ([]string, [][]interface{}, error) {
+	switch format {
+	case "", ImportFormatCSV:
+		return parseCSVImport(data, mapping)
+	case ImportFormatJSONL:
+		return parseJSONLinesImport(data, mapping)
+	default:
+		return nil, nil, fmt.Errorf("unsupported import format %q, expected %s or %s", format, ImportFormatCSV, ImportFormatJSONL)
+	}
+}
+
+// parseCSVImport parses CSV with a header row naming its fields. Empty fields are loaded as NULL.
+func parseCSVImport(data string, mapping map[string]string) ([]string, [][]interface{}, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("CSV data has no header row")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, field := range header {
+		if _, duplicate := positions[field]; duplicate {
+			return nil, nil, fmt.Errorf("CSV header has field %q more than once", field)
+		}
+		positions[field] = i
+	}
+	fields := header
+	if len(mapping) > 0 {
+		fields = sortedMappingFields(mapping)
+		for _, field := range fields {
+			if _, ok := positions[field]; !ok {
+				return nil, nil, fmt.Errorf("columns maps field %q, which the CSV header does not have", field)
+			}
+		}
+	}
+
+	var rows [][]interface{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		row := make([]interface{}, len(fields))
+		for i, field := range fields {
+			if value := record[positions[field]]; value != "" {
+				row[i] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return importColumns(fields, mapping), rows, nil
+}
+
+// parseJSONLinesImport parses one JSON object per line, skipping blank lines. Without a mapping the
+// columns are the keys of all objects in the order they first appear. Missing keys are loaded as NULL,
+// and objects and arrays as their JSON text.
+func parseJSONLinesImport(data string, mapping map[string]string) ([]string, [][]interface{}, error) {
+	var objects []map[string]interface{}
+	var fields []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		err := decoder.Decode(&object)
+		switch {
+		case err == nil && object == nil:
+			err = errors.New("expected an object")
+		case err == nil && decoder.More():
+			err = errors.New("expected one object per line")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON on line %d: %w", line, err)
+		}
+		objects = append(objects, object)
+		for _, key := range orderedJSONKeys(text) {
+			if !seen[key] {
+				seen[key] = true
+				fields = append(fields, key)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON Lines: %w", err)
+	}
+	if len(mapping) > 0 {
+		fields = sortedMappingFields(mapping)
+	}
+
+	rows := make([][]interface{}, len(objects))
+	for i, object := range objects {
+		row := make([]interface{}, len(fields))
+		for j, field := range fields {
+			row[j] = importValue(object[field])
+		}
+		rows[i] = row
+	}
+	return importColumns(fields, mapping), rows, nil
+}
+
+// orderedJSONKeys returns the top-level keys of a JSON object in the order they appear
+func orderedJSONKeys(object []byte) []string {
+	decoder := json.NewDecoder(bytes.NewReader(object))
+	if _, err := decoder.Token(); err != nil {
+		return nil
+	}
+	var keys []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, token.(string))
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// importValue converts a decoded JSON value into a value drivers accept: numbers keep their text, and
+// objects and arrays become JSON text
+func importValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// sortedMappingFields returns the fields of a column mapping ordered by the column they map to, then by name
+func sortedMappingFields(mapping map[string]string) []string {
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if mapping[fields[i]] != mapping[fields[j]] {
+			return mapping[fields[i]] < mapping[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+	return fields
+}
+
+// importColumns returns the columns fields are loaded into
+func importColumns(fields []string, mapping map[string]string) []string {
+	if len(mapping) == 0 {
+		return fields
+	}
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = mapping[field]
+	}
+	return columns
+}
+
+// bulkLoad loads rows into table one chunk at a time, each in a transaction of its own, carrying on after
+// a chunk fails. loaded is called with the range of every chunk loaded.
+func bulkLoad(ctx context.Context, inserter connectors.BulkInserter, table string, columns []string, rows [][]interface{}, chunkSize int, loaded func(lo, hi int)) *ImportResult {
+	if chunkSize <= 0 {
+		chunkSize = defaultImportChunkSize
+	}
+	result := &ImportResult{Table: table, Columns: columns, Rows: len(rows), ChunkSize: chunkSize}
+	for i, chunk := range importChunks(len(rows), chunkSize) {
+		result.Chunks++
+		n, err := inserter.BulkInsert(ctx, table, columns, rows[chunk[0]:chunk[1]])
+		if err != nil {
+			result.Failures = append(result.Failures, ImportChunkFailure{
+				Chunk:    i,
+				FirstRow: chunk[0],
+				Rows:     chunk[1] - chunk[0],
+				Error:    err.Error(),
+			})
+			if result.err == nil {
+				result.err = err
+			}
+			// A done context fails every remaining chunk the same way
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		result.Loaded += n
+		if loaded != nil {
+			loaded(chunk[0], chunk[1])
+		}
+	}
+	return result
+}
+
+// validateImportRequest checks the connection fields, the import options and the statement policy
+func (a *API) validateImportRequest(req *ImportRequest) error {
+	if err := a.validateConnectionRequest(&req.DatabaseConnectionRequest); err != nil {
+		return err
+	}
+	if !isSQLType(req.Type) {
+		return fmt.Errorf("import is only supported for MySQL and PostgreSQL, not %s", req.Type)
+	}
+	if strings.TrimSpace(req.Table) == "" {
+		return fmt.Errorf("table is required")
+	}
+	if req.ChunkSize < 0 || req.ChunkSize > maxImportChunkSize {
+		return fmt.Errorf("chunk_size must be between 1 and %d", maxImportChunkSize)
+	}
+	mapped := make(map[string]string, len(req.Columns))
+	for _, field := range sortedMappingFields(req.Columns) {
+		column := req.Columns[field]
+		if strings.TrimSpace(column) == "" {
+			return fmt.Errorf("columns maps field %q to an empty column name", field)
+		}
+		if other, ok := mapped[column]; ok {
+			return fmt.Errorf("columns maps both %q and %q to column %s", other, field, column)
+		}
+		mapped[column] = field
+	}
+	// An import inserts rows, so it is allowed wherever an INSERT would be
+	return a.policy.Check(&DatabaseOperationRequest{
+		DatabaseConnectionRequest: req.DatabaseConnectionRequest,
+		Operation:                 "insert",
+		Query:                     "INSERT INTO " + req.Table,
+	})
+}
+
+// ImportHandler loads CSV or JSON Lines rows into a table with the bulk insert of the database: COPY on
+// PostgreSQL and multi-row INSERTs on MySQL
+func (a *API) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	if err := a.validateImportRequest(&req); err != nil {
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			a.sendError(w, policyErr.StatusCode, policyErr.Code, policyErr.Message)
+			return
+		}
+		a.sendValidationError(w, err)
+		return
+	}
+
+	// Parse the whole upload first, so malformed data loads nothing
+	columns, rows, err := parseImport(req.Format, req.Data, req.Columns)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, "data has no rows to import")
+		return
+	}
+
+	connector, err := a.createConnector(&req.DatabaseConnectionRequest)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
+		return
+	}
+	inserter, ok := connector.(connectors.BulkInserter)
+	if !ok {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("import is not supported for %s", req.Type))
+		return
+	}
+
+	release, ok := a.acquireSlot(w, r, a.connectionKey(&req.DatabaseConnectionRequest))
+	if !ok {
+		return
+	}
+	defer release()
+
+	if err := a.connectWithin(r.Context(), connector, &req.DatabaseConnectionRequest); err != nil {
+		a.sendDatabaseError(w, "Connection failed", err)
+		return
+	}
+	defer connector.Close(r.Context())
+
+	op := a.operationPhase(r.Context(), &req.DatabaseConnectionRequest)
+	defer op.cancel()
+	result := bulkLoad(op.ctx, inserter, req.Table, columns, rows, req.ChunkSize, nil)
+	a.invalidateQueryCache(&req.DatabaseConnectionRequest)
+	status, response := importResponse(result)
+	a.sendJSON(w, status, response)
+}
+
+// importResponse reports result with 200 when every chunk loaded, 207 when only some did, and the status of
+// the first chunk's error when none did
+func importResponse(result *ImportResult) (int, DatabaseResponse) {
+	response := DatabaseResponse{
+		Success:   len(result.Failures) == 0,
+		Data:      result,
+		Timestamp: time.Now(),
+	}
+	if response.Success {
+		response.Message = fmt.Sprintf("Imported %d rows", result.Loaded)
+		return http.StatusOK, response
+	}
+	response.Error = fmt.Sprintf("%d of %d chunks failed", len(result.Failures), result.Chunks)
+	if len(result.Failures) < result.Chunks {
+		// The chunks that loaded stay loaded
+		return http.StatusMultiStatus, response
+	}
+	status, code := classifyDatabaseError(result.err)
+	response.ErrorCode = code
+	return status, response
+}
+
+// configImportColumns are the columns of the allconfig table the import operation loads, in order. Tables
+// created before a column was added lack it, so only config_key and config_value are required and the
+// others are loaded when the table has them; the timestamps other than approved_at take their defaults.
+var configImportColumns = []string{"config_key", "config_value", "description", "tags", "status", "maker_id", "approved_at"}
+
+// importColumns returns the columns of configImportColumns the allconfig table tableName has
+func (a *API) importColumns(ctx context.Context, connector connectors.DBConnector, schema, tableName string) ([]string, error) {
+	described, err := a.describeTable(ctx, connector, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(described) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	has := func(name string) bool {
+		for _, column := range described {
+			if strings.EqualFold(column.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+	columns := []string{"config_key", "config_value"}
+	for _, column := range configImportColumns[2:] {
+		if has(column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// importConfigs creates configs with approved status using the bulk insert of the database, one chunk of
+// items per transaction. Unlike direct_create_batch with upsert it never updates an existing config: a
+// chunk holding a key that exists fails as a whole.
+func (a *API) importConfigs(ctx context.Context, connector connectors.DBConnector, schema, tableName string, items []ConfigItem, chunkSize int) (interface{}, error) {
+	inserter, ok := connector.(connectors.BulkInserter)
+	if !ok {
+		return nil, fmt.Errorf("import is not supported for %s", connector.GetType())
+	}
+	columns, err := a.importColumns(ctx, connector, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	approvedAt := time.Now().UTC()
+	rows := make([][]interface{}, len(items))
+	for i, item := range items {
+		row := make([]interface{}, len(columns))
+		for j, column := range columns {
+			switch column {
+			case "config_key":
+				row[j] = item.Key
+			case "config_value":
+				if item.Value != nil {
+					row[j] = valueText(item.Value)
+				}
+			case "description":
+				row[j] = item.Description
+			case "tags":
+				row[j] = tagsArg(item.Tags)
+			case "status":
+				row[j] = "approved"
+			case "maker_id":
+				row[j] = item.MakerID
+			case "approved_at":
+				row[j] = approvedAt
+			}
+		}
+		rows[i] = row
+	}
+	outcomes := newConfigBatchResult(configItemKeys(items)).Items
+	result := bulkLoad(ctx, inserter, tableName, columns, rows, chunkSize, func(lo, hi int) {
+		a.recordConfigWrites(ctx, connector, tableName, items[lo:hi], nil)
+		for i := lo; i < hi; i++ {
+			outcomes[i].Status = ConfigItemSucceeded
+		}
+	})
+	for _, failure := range result.Failures {
+		for i := failure.FirstRow; i < failure.FirstRow+failure.Rows; i++ {
+			outcomes[i].Status, outcomes[i].Error = ConfigItemFailed, failure.Error
+		}
+	}
+	result.OperationID = operationID(ctx)
+	a.finishConfigOperation(ctx, outcomes)
+	return result, nil
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/connectors/connectortest"
+	"db-connectors/events"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInserter records the chunks bulk inserted into it, failing those holding a row whose first value is
+// in fail
+type fakeInserter struct {
+	*connectortest.MockDBConnector
+	fail    map[interface{}]bool
+	table   string
+	columns []string
+	chunks  [][][]interface{}
+}
+
+func (f *fakeInserter) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	f.table, f.columns = table, columns
+	f.chunks = append(f.chunks, rows)
+	for _, row := range rows {
+		if f.fail[row[0]] {
+			return 0, fmt.Errorf("duplicate key %v", row[0])
+		}
+	}
+	return int64(len(rows)), nil
+}
+
+func newFakeInserter(dbType string, fail ...interface{}) *fakeInserter {
+	f := &fakeInserter{MockDBConnector: newProfileConnector(dbType), fail: map[interface{}]bool{}}
+	for _, value := range fail {
+		f.fail[value] = true
+	}
+	return f
+}
+
+// describe answers the next column lookup of the table with columns
+func (f *fakeInserter) describe(t *testing.T, columns ...string) *fakeInserter {
+	rows := make([][]driver.Value, len(columns))
+	for i, column := range columns {
+		rows[i] = []driver.Value{column, "text", "YES", nil, "", ""}
+	}
+	f.On("Query", mock.Anything, queryContaining("information_schema.columns"), mock.Anything).Return(newMockRows(t,
+		[]string{"column_name", "column_type", "is_nullable", "column_default", "column_key", "extra"}, rows...), nil).Once()
+	return f
+}
+
+func TestImportChunks(t *testing.T) {
+	assert.Equal(t, [][2]int{{0, 2}, {2, 4}, {4, 5}}, importChunks(5, 2))
+	assert.Equal(t, [][2]int{{0, 5}}, importChunks(5, 10))
+	assert.Equal(t, [][2]int{{0, defaultImportChunkSize}, {defaultImportChunkSize, defaultImportChunkSize + 1}}, importChunks(defaultImportChunkSize+1, 0))
+	assert.Nil(t, importChunks(0, 2))
+}
+
+func TestParseCSVImport(t *testing.T) {
+	data := "id,name,\"note, quoted\"\n1,Ada,\"line\nbreak\"\n2,,x\n"
+	columns, rows, err := parseImport(ImportFormatCSV, data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name", "note, quoted"}, columns)
+	assert.Equal(t, [][]interface{}{{"1", "Ada", "line\nbreak"}, {"2", nil, "x"}}, rows)
+
+	// A mapping loads only its fields, ordered by column
+	columns, rows, err = parseImport("", data, map[string]string{"name": "full_name", "id": "customer_id"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"customer_id", "full_name"}, columns)
+	assert.Equal(t, [][]interface{}{{"1", "Ada"}, {"2", nil}}, rows)
+
+	_, _, err = parseImport(ImportFormatCSV, data, map[string]string{"email": "email"})
+	assert.EqualError(t, err, `columns maps field "email", which the CSV header does not have`)
+	_, _, err = parseImport(ImportFormatCSV, "id,name\n1\n", nil)
+	assert.ErrorContains(t, err, "invalid CSV: record on line 2: wrong number of fields")
+	_, _, err = parseImport(ImportFormatCSV, "id,id\n1,2\n", nil)
+	assert.EqualError(t, err, `CSV header has field "id" more than once`)
+	_, _, err = parseImport(ImportFormatCSV, "", nil)
+	assert.EqualError(t, err, "CSV data has no header row")
+
+	_, rows, err = parseImport(ImportFormatCSV, "id,name\n", nil)
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestParseJSONLinesImport(t *testing.T) {
+	data := `{"id": 12345678901234567890, "name": "Ada"}
+
+{"name": "Alan", "tags": ["a", "b"], "active": true, "meta": {"x": 1.5}}
+`
+	columns, rows, err := parseImport(ImportFormatJSONL, data, nil)
+	require.NoError(t, err)
+	// Keys in the order they first appear; missing keys are NULL and numbers keep their text
+	assert.Equal(t, []string{"id", "name", "tags", "active", "meta"}, columns)
+	assert.Equal(t, [][]interface{}{
+		{"12345678901234567890", "Ada", nil, nil, nil},
+		{nil, "Alan", `["a","b"]`, true, `{"x":1.5}`},
+	}, rows)
+
+	columns, rows, err = parseImport(ImportFormatJSONL, data, map[string]string{"name": "full_name"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"full_name"}, columns)
+	assert.Equal(t, [][]interface{}{{"Ada"}, {"Alan"}}, rows)
+
+	_, _, err = parseImport(ImportFormatJSONL, "{\"id\": 1}\n{\"id\": \n", nil)
+	assert.ErrorContains(t, err, "invalid JSON on line 2")
+	_, _, err = parseImport(ImportFormatJSONL, "[1, 2]\n", nil)
+	assert.ErrorContains(t, err, "invalid JSON on line 1")
+	_, _, err = parseImport(ImportFormatJSONL, "null\n", nil)
+	assert.EqualError(t, err, "invalid JSON on line 1: expected an object")
+	_, _, err = parseImport(ImportFormatJSONL, `{"id": 1} {"id": 2}`, nil)
+	assert.EqualError(t, err, "invalid JSON on line 1: expected one object per line")
+
+	_, _, err = parseImport("xml", "<rows/>", nil)
+	assert.EqualError(t, err, `unsupported import format "xml", expected csv or jsonl`)
+}
+
+func TestBulkLoadReportsChunkFailures(t *testing.T) {
+	inserter := newFakeInserter("postgresql", 3)
+	rows := [][]interface{}{{1}, {2}, {3}, {4}, {5}}
+	var loaded [][2]int
+	result := bulkLoad(context.Background(), inserter, "orders", []string{"id"}, rows, 2, func(lo, hi int) {
+		loaded = append(loaded, [2]int{lo, hi})
+	})
+
+	assert.Equal(t, &ImportResult{
+		Table:     "orders",
+		Columns:   []string{"id"},
+		Rows:      5,
+		Loaded:    3,
+		ChunkSize: 2,
+		Chunks:    3,
+		Failures:  []ImportChunkFailure{{Chunk: 1, FirstRow: 2, Rows: 2, Error: "duplicate key 3"}},
+		err:       errors.New("duplicate key 3"),
+	}, result)
+	assert.Equal(t, [][2]int{{0, 2}, {4, 5}}, loaded)
+	assert.Len(t, inserter.chunks, 3)
+}
+
+func TestBulkLoadStopsWhenContextDone(t *testing.T) {
+	inserter := newFakeInserter("postgresql", 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := bulkLoad(ctx, inserter, "orders", []string{"id"}, [][]interface{}{{1}, {2}}, 1, nil)
+	assert.Equal(t, 1, result.Chunks)
+	assert.Len(t, result.Failures, 1)
+}
+
+func TestImportConfigs(t *testing.T) {
+	api, published := newEventsAPI(t)
+	inserter := newFakeInserter("mysql", "taken").describe(t, configImportColumns...)
+	items := []ConfigItem{
+		{Key: "feature.a", Value: "on", MakerID: "alice"},
+		{Key: "taken", Value: "x"},
+		{Key: "feature.b", Value: map[string]interface{}{"limit": 5}, Tags: []string{"team:payments"}},
+		{Key: "feature.c"},
+	}
+
+	result, err := api.importConfigs(context.Background(), inserter, "", "allconfig", items, 2)
+	require.NoError(t, err)
+	imported := result.(*ImportResult)
+	assert.Equal(t, int64(2), imported.Loaded)
+	assert.Equal(t, []ImportChunkFailure{{Chunk: 0, FirstRow: 0, Rows: 2, Error: "duplicate key taken"}}, imported.Failures)
+	assert.Equal(t, configImportColumns, inserter.columns)
+
+	second := inserter.chunks[1]
+	assert.Equal(t, []interface{}{"feature.b", `{"limit":5}`, "", `["team:payments"]`, "approved", ""}, second[0][:6])
+	assert.Nil(t, second[1][1])
+	assert.Nil(t, second[1][3])
+	assert.IsType(t, time.Time{}, second[0][6])
+
+	// Only the configs of loaded chunks are announced
+	announced := published()
+	require.Len(t, announced, 2)
+	assert.Equal(t, "feature.b", announced[0].Key)
+	assert.Equal(t, events.OperationCreate, announced[0].Operation)
+
+	_, err = api.importConfigs(context.Background(), newProfileConnector("mysql"), "", "allconfig", items, 0)
+	assert.EqualError(t, err, "import is not supported for mysql")
+}
+
+func TestImportConfigsIntoOlderTable(t *testing.T) {
+	api, _ := newEventsAPI(t)
+	items := []ConfigItem{{Key: "feature.a", Value: "on", Description: "A", Tags: []string{"team:payments"}, MakerID: "alice"}}
+
+	// A table from before tags and the maker-checker columns gets the columns it has
+	inserter := newFakeInserter("postgresql").describe(t, "id", "CONFIG_KEY", "config_value", "description", "created_at")
+	result, err := api.importConfigs(context.Background(), inserter, "", "allconfig", items, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.(*ImportResult).Loaded)
+	assert.Equal(t, []string{"config_key", "config_value", "description"}, inserter.columns)
+	assert.Equal(t, [][]interface{}{{"feature.a", "on", "A"}}, inserter.chunks[0])
+
+	// A missing table loads nothing
+	inserter = newFakeInserter("postgresql").describe(t)
+	_, err = api.importConfigs(context.Background(), inserter, "", "allconfig", items, 0)
+	assert.EqualError(t, err, "table allconfig does not exist")
+	assert.Empty(t, inserter.chunks)
+}
+
+func TestImportResponse(t *testing.T) {
+	status, response := importResponse(&ImportResult{Loaded: 4, Chunks: 2})
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, response.Success)
+	assert.Equal(t, "Imported 4 rows", response.Message)
+
+	// Some chunks loaded
+	failure := ImportChunkFailure{Chunk: 1, FirstRow: 2, Rows: 2, Error: "connection reset"}
+	status, response = importResponse(&ImportResult{Loaded: 2, Chunks: 2, Failures: []ImportChunkFailure{failure}, err: errors.New("connection reset")})
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.False(t, response.Success)
+	assert.Equal(t, "1 of 2 chunks failed", response.Error)
+	assert.Empty(t, response.ErrorCode)
+
+	// No chunk loaded
+	status, response = importResponse(&ImportResult{Chunks: 1, Failures: []ImportChunkFailure{failure}, err: errors.New("connection reset")})
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, ErrorCodeDBError, response.ErrorCode)
+	assert.Equal(t, "1 of 1 chunks failed", response.Error)
+	status, response = importResponse(&ImportResult{Chunks: 1, Failures: []ImportChunkFailure{failure}, err: context.Canceled})
+	assert.Equal(t, StatusClientClosedRequest, status)
+	assert.Equal(t, ErrorCodeClientClosed, response.ErrorCode)
+}
+
+func TestCheckImportOptions(t *testing.T) {
+	spec := lookupOperation(allConfigOperationSpecs, "import", "postgresql")
+	require.NotNil(t, spec)
+
+	req := &AllConfigOperationRequest{Operation: "import", ChunkSize: 1000}
+	assert.NoError(t, checkConfigBatchOptions(req, spec, "postgresql"))
+	req.Upsert = true
+	assert.ErrorContains(t, checkConfigBatchOptions(req, spec, "postgresql"), "cannot upsert")
+	req.Upsert, req.ChunkSize = false, maxImportChunkSize+1
+	assert.ErrorContains(t, checkConfigBatchOptions(req, spec, "postgresql"), "chunk_size between 1 and 100000")
+}
+
+func TestImportHandlerRejectsInvalidRequests(t *testing.T) {
+	connection := map[string]interface{}{"type": "postgresql", "host": "db", "port": 5432, "database": "app"}
+	request := func(api *API, fields map[string]interface{}) *httptest.ResponseRecorder {
+		body := map[string]interface{}{}
+		for key, value := range connection {
+			body[key] = value
+		}
+		for key, value := range fields {
+			body[key] = value
+		}
+		encoded, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		api.ImportHandler(rr, httptest.NewRequest(http.MethodPost, "/import", bytes.NewReader(encoded)))
+		return rr
+	}
+	api := NewAPI()
+
+	rr := httptest.NewRecorder()
+	api.ImportHandler(rr, httptest.NewRequest(http.MethodGet, "/import", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	for name, tc := range map[string]struct {
+		fields  map[string]interface{}
+		message string
+	}{
+		"no table":        {map[string]interface{}{"data": "id\n1\n"}, "table is required"},
+		"chunk size":      {map[string]interface{}{"table": "t", "data": "id\n1\n", "chunk_size": -1}, "chunk_size must be between 1 and 100000"},
+		"format":          {map[string]interface{}{"table": "t", "data": "id\n1\n", "format": "xml"}, `unsupported import format "xml"`},
+		"no rows":         {map[string]interface{}{"table": "t", "data": "id\n"}, "data has no rows to import"},
+		"empty column":    {map[string]interface{}{"table": "t", "data": "id\n1\n", "columns": map[string]string{"id": " "}}, `columns maps field "id" to an empty column name`},
+		"shared column":   {map[string]interface{}{"table": "t", "data": "a,b\n1,2\n", "columns": map[string]string{"a": "id", "b": "id"}}, `columns maps both "a" and "b" to column id`},
+		"unsupported":     {map[string]interface{}{"type": "mongodb", "port": 27017, "table": "t", "data": "id\n1\n"}, "import is only supported for MySQL and PostgreSQL, not mongodb"},
+		"malformed jsonl": {map[string]interface{}{"table": "t", "format": "jsonl", "data": "{\n"}, "invalid JSON on line 1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := request(api, tc.fields)
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var response DatabaseResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Contains(t, response.Error, tc.message)
+		})
+	}
+
+	// An import is an INSERT to read-only mode and the denylist
+	readOnly := NewAPI()
+	readOnly.policy = StatementPolicy{ReadOnly: true}
+	rr = request(readOnly, map[string]interface{}{"table": "t", "data": "id\n1\n"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	denied := NewAPI()
+	denied.policy = StatementPolicy{DeniedStatements: []string{"INSERT"}}
+	rr = request(denied, map[string]interface{}{"table": "t", "data": "id\n1\n"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "INSERT statements are not allowed")
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/jobs"
+	"db-connectors/requestid"
+)
+
+// SubmitJobHandler handles /jobs: POST submits an operation to run asynchronously, GET lists jobs
+func (a *API) SubmitJobHandler(w http.ResponseWriter, r *http.Request) {
+	if a.jobs == nil {
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, "Asynchronous jobs are not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.sendSuccess(w, a.jobs.List(), "Jobs retrieved successfully")
+		return
+	case http.MethodPost:
+	default:
+		a.sendError(w, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req DatabaseOperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+
+	if err := a.validateOperationRequest(&req); err != nil {
+		a.sendValidationError(w, err)
+		return
+	}
+	if req.Operation == "" {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, "Operation is required")
+		return
+	}
+	if err := ValidateOperation(&req); err != nil {
+		a.sendRequestError(w, err)
+		return
+	}
+	if err := checkReturning(&req); err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+
+	if err := a.policy.Check(&req); err != nil {
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			a.sendError(w, policyErr.StatusCode, policyErr.Code, policyErr.Message)
+			return
+		}
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, err.Error())
+		return
+	}
+
+	if req.Operation == "list_databases" && req.Database == "" {
+		req.Database = defaultServerDatabase(req.Type)
+	}
+	req.switchDatabase()
+
+	// Create the connector up front so an unsupported type is reported synchronously
+	connector, err := a.createConnector(&req.DatabaseConnectionRequest)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
+		return
+	}
+
+	labels := map[string]string{
+		"type":      req.Type,
+		"database":  req.Database,
+		"operation": req.Operation,
+	}
+	// Carry the submitting request's ID into the job so its logs can be correlated, and mask the rows the
+	// job stores unless the submitter has the bypass role
+	id := requestid.FromContext(r.Context())
+	m := a.masker(r, a.connectionName(&req.DatabaseConnectionRequest))
+	status, err := a.jobs.Submit(labels, func(ctx context.Context, rw jobs.ResultWriter) error {
+		return a.runJob(requestid.NewContext(ctx, id), connector, &req, m.writer(req.maskSource(), rw))
+	})
+	if err != nil {
+		if errors.Is(err, jobs.ErrQueueFull) {
+			w.Header().Set("Retry-After", "30")
+			a.sendError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, err.Error())
+			return
+		}
+		a.sendError(w, http.StatusInternalServerError, ErrorCodeInternal, fmt.Sprintf("Failed to submit job: %v", err))
+		return
+	}
+
+	w.Header().Set("Location", "/v1/jobs/"+status.ID)
+	a.sendJSON(w, http.StatusAccepted, DatabaseResponse{
+		Success:   true,
+		Message:   "Job submitted",
+		Data:      status,
+		Timestamp: time.Now(),
+	})
+}
+
+// JobHandler handles /jobs/{id}: GET returns the job status, DELETE cancels it
+func (a *API) JobHandler(w http.ResponseWriter, r *http.Request) {
+	if a.jobs == nil {
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, "Asynchronous jobs are not enabled")
+		return
+	}
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		status, err := a.jobs.Get(id)
+		if err != nil {
+			a.sendJobError(w, err)
+			return
+		}
+		a.sendSuccess(w, status, "Job status retrieved")
+	case http.MethodDelete:
+		status, err := a.jobs.Cancel(id)
+		if err != nil {
+			a.sendJobError(w, err)
+			return
+		}
+		a.sendSuccess(w, status, "Job cancellation requested")
+	default:
+		a.sendError(w, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// JobResultHandler handles GET /jobs/{id}/result
+func (a *API) JobResultHandler(w http.ResponseWriter, r *http.Request) {
+	if a.jobs == nil {
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, "Asynchronous jobs are not enabled")
+		return
+	}
+	if !a.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	a.sendJobResult(w, r, r.PathValue("id"))
+}
+
+// sendJobResult streams a stored job result as JSON Lines (default) or CSV
+func (a *API) sendJobResult(w http.ResponseWriter, r *http.Request, id string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "csv" {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Unsupported result format: %s (use jsonl or csv)", format))
+		return
+	}
+
+	result, err := a.jobs.OpenResult(id)
+	if err != nil {
+		a.sendJobError(w, err)
+		return
+	}
+	defer result.Close()
+
+	w.Header().Set("X-Row-Count", strconv.Itoa(result.Rows))
+	out := newStreamWriter(w, a.streamFlushRows)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"job-%s.csv\"", id))
+		w.WriteHeader(http.StatusOK)
+		result.WriteCSV(out)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(out, result)
+}
+
+// sendJobError maps job manager errors onto HTTP responses
+func (a *API) sendJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, err.Error())
+	case errors.Is(err, jobs.ErrNotFinished), errors.Is(err, jobs.ErrNoResult):
+		a.sendError(w, http.StatusConflict, ErrorCodeConflict, err.Error())
+	default:
+		a.sendError(w, http.StatusInternalServerError, ErrorCodeInternal, err.Error())
+	}
+}
+
+// runJob connects and runs the operation, streaming SQL query rows straight into the job result
+func (a *API) runJob(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest, rw jobs.ResultWriter) error {
+	if err := connector.Connect(ctx); err != nil {
+		return errors.New(connectionFailureMessage("Connection failed", err))
+	}
+	defer connector.Close(ctx)
+	err := a.RunOperation(ctx, connector, req, rw)
+	if class, _ := classifyOperation(req); class != StatementRead {
+		a.invalidateQueryCache(&req.DatabaseConnectionRequest)
+	}
+	return err
+}
+
+// RunOperation runs an operation on a connected connector and writes its result to rw as rows:
+// SQL query rows are streamed, other results are converted the same way as job results
+func (a *API) RunOperation(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest, rw jobs.ResultWriter) error {
+	if (req.Type == "mysql" || req.Type == "postgresql") && (req.Operation == "query" || req.Operation == "select") {
+		if req.Query == "" {
+			return fmt.Errorf("query is required for SQL select operation")
+		}
+		rows, err := connector.Query(ctx, req.Query, req.Args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		rw.SetColumns(columns)
+		if err := a.scanRows(rows, rw.WriteRow); err != nil {
+			return err
+		}
+		return rows.Err()
+	}
+
+	result, err := a.executeOperation(ctx, connector, req)
+	if err != nil {
+		return err
+	}
+	return WriteResultRows(rw, result)
+}
+
+// WriteResultRows writes a non-streamed operation result to rw as rows: SQL results as their
+// affected row count and other results, such as MongoDB documents, through their JSON form
+func WriteResultRows(rw jobs.ResultWriter, result interface{}) error {
+	result = utcTimes(result)
+	switch v := result.(type) {
+	case nil:
+		return nil
+	case sql.Result:
+		if affected, err := v.RowsAffected(); err == nil {
+			rw.SetRowsAffected(affected)
+		}
+		return nil
+	case []map[string]interface{}:
+		for _, row := range v {
+			if err := rw.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *WriteResult:
+		rw.SetRowsAffected(v.RowsAffected)
+		for _, row := range v.Rows {
+			if err := rw.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Normalize other results (schema listings, MongoDB documents) through their JSON form
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return fmt.Errorf("failed to decode result: %w", err)
+	}
+
+	items, ok := decoded.([]interface{})
+	if !ok {
+		items = []interface{}{decoded}
+	}
+	for _, item := range items {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			row = map[string]interface{}{"value": item}
+		}
+		if err := rw.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/connectors/connectortest"
+	"db-connectors/jobs"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingWriter is a jobs.ResultWriter that keeps rows in memory
+type recordingWriter struct {
+	columns      []string
+	rows         []map[string]interface{}
+	rowsAffected *int64
+}
+
+func (w *recordingWriter) SetColumns(columns []string) { w.columns = columns }
+func (w *recordingWriter) SetRowsAffected(n int64)     { w.rowsAffected = &n }
+func (w *recordingWriter) WriteRow(row map[string]interface{}) error {
+	w.rows = append(w.rows, row)
+	return nil
+}
+
+func newJobsAPI(t *testing.T) *API {
+	api := NewAPI()
+	api.jobs = jobs.NewManager(jobs.Options{Workers: 1})
+	t.Cleanup(api.jobs.Close)
+	return api
+}
+
+func waitForJob(t *testing.T, api *API, id string, want jobs.State) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		status, err := api.jobs.Get(id)
+		return err == nil && status.State == want
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestRunJobStreamsSQLRows(t *testing.T) {
+	api := NewAPI()
+	connector := new(connectortest.MockDBConnector)
+	connector.On("Connect", mock.Anything).Return(nil)
+	connector.On("Close").Return(nil)
+	connector.On("Query", mock.Anything, "SELECT id, name FROM users", mock.Anything).
+		Return(newMockRows(t, []string{"id", "name"}, []driver.Value{1, "alpha"}, []driver.Value{2, []byte("beta")}), nil)
+
+	req := &DatabaseOperationRequest{Operation: "query", Query: "SELECT id, name FROM users"}
+	req.Type = "mysql"
+
+	rw := &recordingWriter{}
+	require.NoError(t, api.runJob(context.Background(), connector, req, rw))
+
+	assert.Equal(t, []string{"id", "name"}, rw.columns)
+	require.Len(t, rw.rows, 2)
+	assert.Equal(t, "beta", rw.rows[1]["name"])
+	connector.AssertExpectations(t)
+}
+
+func TestRunJobConnectionFailure(t *testing.T) {
+	api := NewAPI()
+	connector := new(connectortest.MockDBConnector)
+	connector.On("Connect", mock.Anything).Return(context.DeadlineExceeded)
+
+	req := &DatabaseOperationRequest{Operation: "query", Query: "SELECT 1"}
+	req.Type = "postgresql"
+
+	err := api.runJob(context.Background(), connector, req, &recordingWriter{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout")
+}
+
+func TestWriteJobResult(t *testing.T) {
+	rw := &recordingWriter{}
+	require.NoError(t, WriteResultRows(rw, sqlmock.NewResult(0, 5)))
+	require.NotNil(t, rw.rowsAffected)
+	assert.Equal(t, int64(5), *rw.rowsAffected)
+	assert.Empty(t, rw.rows)
+
+	rw = &recordingWriter{}
+	require.NoError(t, WriteResultRows(rw, []TableInfo{{Schema: "public", Name: "users", Type: "table"}}))
+	require.Len(t, rw.rows, 1)
+	assert.Equal(t, "users", rw.rows[0]["name"])
+
+	rw = &recordingWriter{}
+	require.NoError(t, WriteResultRows(rw, int64(42)))
+	assert.Equal(t, []map[string]interface{}{{"value": float64(42)}}, rw.rows)
+}
+
+func TestJobHandlersDisabled(t *testing.T) {
+	api := NewAPI()
+
+	rr := httptest.NewRecorder()
+	api.SubmitJobHandler(rr, httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewBufferString("{}")))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	api.JobHandler(rr, httptest.NewRequest(http.MethodGet, "/jobs/abc", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestSubmitJobHandlerValidation(t *testing.T) {
+	api := newJobsAPI(t)
+
+	rr := httptest.NewRecorder()
+	api.SubmitJobHandler(rr, httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewBufferString(`{"type":"mysql"}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	api.policy.ReadOnly = true
+	body := `{"type":"mysql","host":"localhost","port":3306,"database":"testdb","operation":"delete","query":"DELETE FROM t"}`
+	rr = httptest.NewRecorder()
+	api.SubmitJobHandler(rr, httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	api.SubmitJobHandler(rr, httptest.NewRequest(http.MethodPut, "/jobs", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestJobHandlerLifecycle(t *testing.T) {
+	api := newJobsAPI(t)
+	handler := SetupRoutes(api)
+
+	status, err := api.jobs.Submit(map[string]string{"operation": "query"}, func(ctx context.Context, rw jobs.ResultWriter) error {
+		rw.SetColumns([]string{"id", "name"})
+		return rw.WriteRow(map[string]interface{}{"id": 1, "name": "alpha"})
+	})
+	require.NoError(t, err)
+	waitForJob(t, api, status.ID, jobs.StateSucceeded)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+status.ID, nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	data := response.Data.(map[string]interface{})
+	assert.Equal(t, "succeeded", data["state"])
+	assert.Equal(t, float64(1), data["row_count"])
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/jobs/"+status.ID, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+status.ID+"/result", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"id\":1,\"name\":\"alpha\"}\n", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+status.ID+"/result?format=csv", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "id,name\n1,alpha\n", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+status.ID+"/result?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestJobHandlerCancel(t *testing.T) {
+	api := newJobsAPI(t)
+	handler := SetupRoutes(api)
+
+	started := make(chan struct{})
+	status, err := api.jobs.Submit(nil, func(ctx context.Context, rw jobs.ResultWriter) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+	<-started
+
+	// The result of a running job is not available yet
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+status.ID+"/result", nil))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/jobs/"+status.ID, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	waitForJob(t, api, status.ID, jobs.StateCancelled)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+status.ID+"/result", nil))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
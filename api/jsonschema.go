@@ -0,0 +1,306 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchemaAnnotations are the keywords of a JSON Schema that document it without constraining values
+var jsonSchemaAnnotations = []string{"$schema", "$id", "$comment", "title", "description", "default", "examples"}
+
+// jsonSchemaTypes are the values of the type keyword
+var jsonSchemaTypes = []string{"string", "number", "integer", "boolean", "object", "array", "null"}
+
+// JSONSchema validates config values against the subset of JSON Schema draft 2020-12 made of type, enum,
+// const, minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern, required,
+// properties, additionalProperties, items, minItems and maxItems. Schemas using other keywords are rejected
+// rather than checked in part.
+type JSONSchema struct {
+	Source json.RawMessage // The schema as configured
+
+	types                []string
+	enum                 []interface{}
+	constant             interface{}
+	hasConst             bool
+	minimum, maximum     *float64
+	exclusiveMin         *float64
+	exclusiveMax         *float64
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	required             []string
+	properties           map[string]*JSONSchema
+	additional           *JSONSchema // nil accepts any additional property
+	noAdditional         bool
+	items                *JSONSchema
+	minItems, maxItems   *int
+}
+
+// schemaViolation is where and how a value breaks a JSON Schema
+type schemaViolation struct {
+	Path    string      // JSON Pointer to the offending part of the value, empty for the value itself
+	Value   interface{} // The offending part
+	Message string
+}
+
+// CompileJSONSchema compiles a JSON Schema given as JSON text
+func CompileJSONSchema(source string) (*JSONSchema, error) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(source), &decoded); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+	schema, err := compileJSONSchema(decoded, "")
+	if err != nil {
+		return nil, err
+	}
+	schema.Source = json.RawMessage(source)
+	return schema, nil
+}
+
+// compileJSONSchema compiles the decoded schema found at path of the configured schema
+func compileJSONSchema(decoded interface{}, path string) (*JSONSchema, error) {
+	fields, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("JSON Schema%s must be an object", at(path))
+	}
+	s := &JSONSchema{}
+	invalid := func(keyword, message string) error {
+		return fmt.Errorf("JSON Schema%s: %s %s", at(path), keyword, message)
+	}
+	number := func(keyword string) (*float64, error) {
+		n, ok := fields[keyword].(float64)
+		if !ok {
+			return nil, invalid(keyword, "must be a number")
+		}
+		return &n, nil
+	}
+	count := func(keyword string) (*int, error) {
+		n, ok := fields[keyword].(float64)
+		if !ok || n < 0 || n != math.Trunc(n) {
+			return nil, invalid(keyword, "must be a non-negative integer")
+		}
+		c := int(n)
+		return &c, nil
+	}
+
+	var err error
+	for _, keyword := range sortedConfigKeys(fields) {
+		value := fields[keyword]
+		switch keyword {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, item := range t {
+					name, _ := item.(string)
+					s.types = append(s.types, name)
+				}
+			}
+			if len(s.types) == 0 {
+				return nil, invalid(keyword, "must be a type name or a list of them")
+			}
+			for _, t := range s.types {
+				if !slices.Contains(jsonSchemaTypes, t) {
+					return nil, invalid(keyword, fmt.Sprintf("must be one of %s, got %q", strings.Join(jsonSchemaTypes, ", "), t))
+				}
+			}
+		case "enum":
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, invalid(keyword, "must be a non-empty list")
+			}
+			s.enum = list
+		case "const":
+			s.constant, s.hasConst = value, true
+		case "minimum":
+			s.minimum, err = number(keyword)
+		case "maximum":
+			s.maximum, err = number(keyword)
+		case "exclusiveMinimum":
+			s.exclusiveMin, err = number(keyword)
+		case "exclusiveMaximum":
+			s.exclusiveMax, err = number(keyword)
+		case "minLength":
+			s.minLength, err = count(keyword)
+		case "maxLength":
+			s.maxLength, err = count(keyword)
+		case "minItems":
+			s.minItems, err = count(keyword)
+		case "maxItems":
+			s.maxItems, err = count(keyword)
+		case "pattern":
+			text, ok := value.(string)
+			if !ok {
+				return nil, invalid(keyword, "must be a string")
+			}
+			if s.pattern, err = regexp.Compile(text); err != nil {
+				return nil, invalid(keyword, err.Error())
+			}
+		case "required":
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, invalid(keyword, "must be a list of property names")
+			}
+			for _, item := range list {
+				name, ok := item.(string)
+				if !ok {
+					return nil, invalid(keyword, "must be a list of property names")
+				}
+				s.required = append(s.required, name)
+			}
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, invalid(keyword, "must be an object")
+			}
+			s.properties = make(map[string]*JSONSchema, len(properties))
+			for _, name := range sortedConfigKeys(properties) {
+				if s.properties[name], err = compileJSONSchema(properties[name], path+"/properties/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "additionalProperties":
+			if allowed, ok := value.(bool); ok {
+				s.noAdditional = !allowed
+				break
+			}
+			s.additional, err = compileJSONSchema(value, path+"/additionalProperties")
+		case "items":
+			s.items, err = compileJSONSchema(value, path+"/items")
+		default:
+			if !slices.Contains(jsonSchemaAnnotations, keyword) {
+				return nil, fmt.Errorf("JSON Schema%s: unsupported keyword %q", at(path), keyword)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// at names a location of a schema in its error messages
+func at(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " at " + path
+}
+
+// validate returns the first place where value, decoded from JSON, breaks the schema, or nil when it does not
+func (s *JSONSchema) validate(value interface{}, path string) *schemaViolation {
+	violation := func(format string, args ...interface{}) *schemaViolation {
+		return &schemaViolation{Path: path, Value: value, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return jsonTypeMatches(t, value) }) {
+		return violation("must be of type %s, got %s", strings.Join(s.types, " or "), jsonTypeOf(value))
+	}
+	if len(s.enum) > 0 && !slices.ContainsFunc(s.enum, func(item interface{}) bool { return reflect.DeepEqual(item, value) }) {
+		return violation("must be one of the enum values")
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constant, value) {
+		return violation("must equal the const value")
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			return violation("must be at least %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			return violation("must be at most %v", *s.maximum)
+		}
+		if s.exclusiveMin != nil && v <= *s.exclusiveMin {
+			return violation("must be greater than %v", *s.exclusiveMin)
+		}
+		if s.exclusiveMax != nil && v >= *s.exclusiveMax {
+			return violation("must be less than %v", *s.exclusiveMax)
+		}
+
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			return violation("must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			return violation("must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return violation("must match %s", s.pattern)
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			return violation("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			return violation("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				if found := s.items.validate(item, fmt.Sprintf("%s/%d", path, i)); found != nil {
+					return found
+				}
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				return violation("is missing the required property %q", name)
+			}
+		}
+		for _, name := range sortedConfigKeys(v) {
+			property, declared := s.properties[name]
+			switch {
+			case declared:
+			case s.noAdditional:
+				return &schemaViolation{Path: path + "/" + name, Value: v[name], Message: "is not an allowed property"}
+			case s.additional != nil:
+				property = s.additional
+			default:
+				continue
+			}
+			if found := property.validate(v[name], path+"/"+name); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// jsonTypeMatches reports whether a value decoded from JSON is of the JSON Schema type
+func jsonTypeMatches(t string, value interface{}) bool {
+	if t == "integer" {
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return jsonTypeOf(value) == t
+}
+
+// jsonTypeOf returns the JSON Schema type of a value decoded from JSON
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileJSONSchema(t *testing.T) {
+	schema, err := CompileJSONSchema(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "Retry policy", "type": "object"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"object"}, schema.types)
+
+	for source, message := range map[string]string{
+		`[1]`:                 "JSON Schema must be an object",
+		`{"type": "decimal"}`: `JSON Schema: type must be one of string, number, integer, boolean, object, array, null, got "decimal"`,
+		`{"minLength": -1}`:   "JSON Schema: minLength must be a non-negative integer",
+		`{"maximum": "10"}`:   "JSON Schema: maximum must be a number",
+		`{"pattern": "(x"}`:   "JSON Schema: pattern error parsing regexp",
+		`{"enum": []}`:        "JSON Schema: enum must be a non-empty list",
+		`{"properties": {"retries": {"oneOf": []}}}`:  `JSON Schema at /properties/retries: unsupported keyword "oneOf"`,
+		`{"items": {"type": ["string", 1]}}`:          "JSON Schema at /items: type must be one of",
+		`{"additionalProperties": {"format": "uri"}}`: `JSON Schema at /additionalProperties: unsupported keyword "format"`,
+		`{"type": "string"`:                           "invalid JSON Schema",
+	} {
+		_, err := CompileJSONSchema(source)
+		assert.ErrorContains(t, err, message, source)
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, err := CompileJSONSchema(`{
+		"type": "object",
+		"required": ["currency", "retries"],
+		"properties": {
+			"currency": {"enum": ["EUR", "USD"]},
+			"retries": {"type": "integer", "minimum": 0, "maximum": 5},
+			"timeout": {"type": "number", "exclusiveMinimum": 0},
+			"hosts": {"type": "array", "minItems": 1, "items": {"type": "string", "pattern": "^[a-z.]+$", "maxLength": 20}},
+			"version": {"const": 2}
+		},
+		"additionalProperties": false
+	}`)
+	require.NoError(t, err)
+
+	validate := func(value string) *schemaViolation {
+		var decoded interface{}
+		require.NoError(t, json.Unmarshal([]byte(value), &decoded))
+		return schema.validate(decoded, "")
+	}
+	assert.Nil(t, validate(`{"currency": "EUR", "retries": 3, "timeout": 1.5, "hosts": ["a.example"], "version": 2}`))
+
+	tests := []struct {
+		value string
+		want  schemaViolation
+	}{
+		{`[]`, schemaViolation{Path: "", Value: []interface{}{}, Message: "must be of type object, got array"}},
+		{`{"currency": "EUR"}`, schemaViolation{Path: "", Value: map[string]interface{}{"currency": "EUR"}, Message: `is missing the required property "retries"`}},
+		{`{"currency": "GBP", "retries": 1}`, schemaViolation{Path: "/currency", Value: "GBP", Message: "must be one of the enum values"}},
+		{`{"currency": "EUR", "retries": 1.5}`, schemaViolation{Path: "/retries", Value: 1.5, Message: "must be of type integer, got number"}},
+		{`{"currency": "EUR", "retries": 9}`, schemaViolation{Path: "/retries", Value: 9.0, Message: "must be at most 5"}},
+		{`{"currency": "EUR", "retries": 1, "timeout": 0}`, schemaViolation{Path: "/timeout", Value: 0.0, Message: "must be greater than 0"}},
+		{`{"currency": "EUR", "retries": 1, "hosts": []}`, schemaViolation{Path: "/hosts", Value: []interface{}{}, Message: "must have at least 1 items"}},
+		{`{"currency": "EUR", "retries": 1, "hosts": ["ok", "Not Ok"]}`, schemaViolation{Path: "/hosts/1", Value: "Not Ok", Message: "must match ^[a-z.]+$"}},
+		{`{"currency": "EUR", "retries": 1, "version": 1}`, schemaViolation{Path: "/version", Value: 1.0, Message: "must equal the const value"}},
+		{`{"currency": "EUR", "retries": 1, "debug": true}`, schemaViolation{Path: "/debug", Value: true, Message: "is not an allowed property"}},
+	}
+	for _, tt := range tests {
+		got := validate(tt.value)
+		require.NotNil(t, got, tt.value)
+		assert.Equal(t, tt.want, *got, tt.value)
+	}
+}
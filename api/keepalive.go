@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// DefaultKeepAliveInterval is well below the shortest wait_timeout commonly set on MySQL servers and the
+// idle timeouts of proxies in front of databases, which drop connections idle for a few minutes
+const DefaultKeepAliveInterval = time.Minute
+
+// KeepAlive configures the background pings keeping the connections of the connection profiles open
+type KeepAlive struct {
+	Interval    time.Duration // Between pings of each profile; zero keeps the default, negative disables the pings
+	WarmUpConns int           // Connections each SQL profile opens when its keepalive starts; zero opens none
+}
+
+// keepAliver holds the keepalive settings and the timer the pings wait on
+type keepAliver struct {
+	KeepAlive
+	after func(time.Duration) <-chan time.Time
+}
+
+// newKeepAliver creates a keepaliver, filling an unset interval with the default
+func newKeepAliver(keepAlive KeepAlive) keepAliver {
+	if keepAlive.Interval == 0 {
+		keepAlive.Interval = DefaultKeepAliveInterval
+	}
+	return keepAliver{KeepAlive: keepAlive, after: time.After}
+}
+
+// StartKeepAlive warms up the connection of every profile and then pings it in the background until ctx is
+// done or the profile is removed. A failed ping marks the connection unhealthy in /v1/connections and
+// reconnects it; the next successful ping marks it healthy again.
+func (a *API) StartKeepAlive(ctx context.Context) {
+	if a.keepAlive.Interval < 0 {
+		return
+	}
+	for _, p := range a.profileList() {
+		ctx, cancel := context.WithCancel(ctx)
+		p.mu.Lock()
+		p.stopKeepAlive = cancel
+		p.mu.Unlock()
+		go a.keepProfileAlive(ctx, p)
+	}
+}
+
+// keepProfileAlive warms up the connection of p and pings it every interval until ctx is done
+func (a *API) keepProfileAlive(ctx context.Context, p *profile) {
+	if a.keepAlive.WarmUpConns > 0 {
+		a.warmUp(ctx, p)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.keepAlive.after(a.keepAlive.Interval):
+		}
+		a.pingKeepAlive(ctx, p)
+	}
+}
+
+// warmUp connects p and opens the warm-up connections of its pool within the connect timeout
+func (a *API) warmUp(ctx context.Context, p *profile) {
+	ctx, cancel := context.WithTimeout(ctx, a.phaseTimeouts.Connect)
+	defer cancel()
+	opened := 0
+	err := p.connect(ctx)
+	if err == nil {
+		opened, err = connectors.WarmUp(ctx, p.connector(), a.keepAlive.WarmUpConns)
+	}
+	if err != nil {
+		a.logger.Warn("failed to warm up connection", "profile", p.Name, "opened", opened, "error", err)
+		return
+	}
+	a.logger.Debug("connection warmed up", "profile", p.Name, "opened", opened)
+}
+
+// pingKeepAlive pings the connection of p, which keeps it from being dropped by the server while idle. A
+// profile that has not connected yet has nothing to keep open and is skipped.
+func (a *API) pingKeepAlive(ctx context.Context, p *profile) {
+	p.mu.Lock()
+	connected := p.connected
+	p.mu.Unlock()
+	if !connected {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.phaseTimeouts.Connect)
+	defer cancel()
+	err := p.connector().Ping(ctx)
+	if err != nil {
+		a.logger.Warn("keepalive ping failed, reconnecting", "profile", p.Name, "error", err)
+		if err = p.reconnect(ctx); err == nil {
+			err = p.connector().Ping(ctx)
+		}
+	}
+	a.registry.MarkKeepAlive(p.Name, err)
+	if err != nil {
+		a.logger.Error("connection unhealthy", "profile", p.Name, "error", err)
+	}
+}
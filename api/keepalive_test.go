@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"db-connectors/connectors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// keepAliveClock hands the waits of the keepalive pings to the test, which fires them one at a time
+type keepAliveClock struct {
+	waits chan time.Duration
+	ticks chan time.Time
+}
+
+func newKeepAliveClock() *keepAliveClock {
+	// The wait started after the last tick is never read, so it must not block
+	return &keepAliveClock{waits: make(chan time.Duration, 1), ticks: make(chan time.Time)}
+}
+
+func (c *keepAliveClock) after(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.ticks
+}
+
+// tick fires the pending wait and returns once the ping it releases is done and the next wait has started
+func (c *keepAliveClock) tick(t *testing.T) time.Duration {
+	t.Helper()
+	c.ticks <- time.Now()
+	select {
+	case d := <-c.waits:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("the keepalive did not wait again")
+		return 0
+	}
+}
+
+// startKeepAlive starts the keepalive of an API serving conn as the primary profile, connected unless
+// connected is false, and returns once the first ping is waited for
+func startKeepAlive(t *testing.T, conn connectors.DBConnector, connected bool, keepAlive KeepAlive) (*API, *keepAliveClock) {
+	t.Helper()
+	api := NewAPI()
+	api.keepAlive = newKeepAliver(keepAlive)
+	clock := newKeepAliveClock()
+	api.keepAlive.after = clock.after
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: conn})
+	p, _ := api.lookupProfile("primary")
+	p.connected = connected
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	api.StartKeepAlive(ctx)
+	assert.Equal(t, api.keepAlive.Interval, <-clock.waits)
+	return api, clock
+}
+
+func TestKeepAliveCadence(t *testing.T) {
+	conn := newPingConnector("mysql", nil)
+	api, clock := startKeepAlive(t, conn, true, KeepAlive{})
+	assert.Equal(t, DefaultKeepAliveInterval, api.keepAlive.Interval)
+
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, DefaultKeepAliveInterval, clock.tick(t))
+		conn.AssertNumberOfCalls(t, "Ping", i)
+	}
+
+	infos := decodeConnections(t, serveConfigs(SetupRoutes(api), http.MethodGet, "/v1/connections", nil, nil).Body.Bytes())
+	require.Len(t, infos, 1)
+	require.NotNil(t, infos[0].LastKeepAlive)
+	require.NotNil(t, infos[0].Healthy)
+	assert.True(t, *infos[0].Healthy)
+	assert.Equal(t, infos[0].LastKeepAlive, infos[0].LastPing, "a successful keepalive is a successful ping")
+}
+
+func TestKeepAliveUnhealthy(t *testing.T) {
+	conn := new(reconnectingConnector)
+	conn.On("GetType").Return("mongodb")
+	conn.On("Ping", mock.Anything).Return(errors.New("connection reset by peer")).Once()
+	conn.On("Reconnect", mock.Anything).Return(errors.New("server selection timeout")).Once()
+	api, clock := startKeepAlive(t, conn, true, KeepAlive{Interval: 30 * time.Second})
+
+	// A failed ping reconnects and marks the connection unhealthy when that fails too
+	assert.Equal(t, 30*time.Second, clock.tick(t))
+	conn.AssertNumberOfCalls(t, "Reconnect", 1)
+	record, _ := api.registry.Record("primary")
+	assert.Equal(t, "server selection timeout", record.KeepAliveError)
+	assert.True(t, record.LastPing.IsZero())
+
+	// A lost connection that reconnects is healthy again
+	conn.On("Ping", mock.Anything).Return(errors.New("connection reset by peer")).Once()
+	conn.On("Reconnect", mock.Anything).Return(nil).Once()
+	conn.On("Ping", mock.Anything).Return(nil).Once()
+	clock.tick(t)
+	record, _ = api.registry.Record("primary")
+	assert.Empty(t, record.KeepAliveError)
+	assert.False(t, record.LastPing.IsZero())
+	conn.AssertExpectations(t)
+}
+
+func TestKeepAliveSkipsUnconnected(t *testing.T) {
+	conn := newPingConnector("postgresql", nil)
+	api, clock := startKeepAlive(t, conn, false, KeepAlive{})
+	clock.tick(t)
+	conn.AssertNotCalled(t, "Ping", mock.Anything)
+	record, _ := api.registry.Record("primary")
+	assert.True(t, record.LastKeepAlive.IsZero())
+}
+
+func TestKeepAliveWarmUp(t *testing.T) {
+	conn, _ := newSQLMockConnector(t, "mysql")
+	conn.db.SetMaxIdleConns(5)
+	conn.On("IsConnected").Return(true)
+	startKeepAlive(t, conn, true, KeepAlive{WarmUpConns: 3})
+	assert.Equal(t, 3, conn.db.Stats().Idle)
+}
+
+func TestKeepAliveDisabled(t *testing.T) {
+	api := NewAPI()
+	api.keepAlive = newKeepAliver(KeepAlive{Interval: -1})
+	api.keepAlive.after = func(time.Duration) <-chan time.Time {
+		t.Fatal("no keepalive runs when disabled")
+		return nil
+	}
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: newPingConnector("mysql", nil)})
+	api.StartKeepAlive(context.Background())
+	p, _ := api.lookupProfile("primary")
+	assert.Nil(t, p.stopKeepAlive)
+}
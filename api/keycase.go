@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"db-connectors/connectors"
+)
+
+// caseInsensitiveCollation is the MongoDB collation comparing strings regardless of case
+var caseInsensitiveCollation = map[string]interface{}{"locale": "en", "strength": 2}
+
+// caseInsensitive reports whether the keys of req are looked up regardless of case, as the request asks
+// or else as the key policy does
+func (a *API) caseInsensitive(req *AllConfigOperationRequest) bool {
+	if req.CaseInsensitive != nil {
+		return *req.CaseInsensitive
+	}
+	return a.keys.CaseInsensitive
+}
+
+// requestKeys returns every key req names
+func requestKeys(req *AllConfigOperationRequest) []string {
+	var keys []string
+	if req.Key != "" {
+		keys = append(keys, req.Key)
+	}
+	keys = append(keys, req.FallbackKeys...)
+	keys = append(keys, configItemKeys(req.ConfigItems)...)
+	return append(keys, sortedConfigKeys(req.Configs)...)
+}
+
+// storedKeys returns the keys stored in the table that match any of keys regardless of case, grouped by
+// their lowercase form. MySQL compares with the collation of config_key, case-insensitive by default, so
+// the lookup uses its index; PostgreSQL compares LOWER(config_key), which an expression index on it serves;
+// MongoDB matches with a case-insensitive collation, which an index with the same collation serves.
+func (a *API) storedKeys(ctx context.Context, connector connectors.DBConnector, tableName string, keys []string) (map[string][]string, error) {
+	var found []string
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		in := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+		args := make([]interface{}, len(keys))
+		column := "config_key"
+		for i, key := range keys {
+			args[i] = key
+		}
+		if connector.GetType() == "postgresql" {
+			column = "LOWER(config_key)"
+			for i, key := range keys {
+				args[i] = strings.ToLower(key)
+			}
+		}
+		rows, err := connector.Query(ctx, connectors.Bind(d, "SELECT config_key FROM "+sqlTable(ctx, tableName)+" WHERE "+column+" IN ("+in+")"), args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return nil, err
+			}
+			found = append(found, key)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+	case "mongodb":
+		result, err := connector.Execute(ctx, "find", map[string]interface{}{
+			"collection": tableName,
+			"filter":     map[string]interface{}{"config_key": map[string]interface{}{"$in": keys}},
+			"collation":  caseInsensitiveCollation,
+		})
+		if err != nil {
+			return nil, err
+		}
+		configs, _ := result.([]map[string]interface{})
+		for _, config := range configs {
+			found = append(found, asString(config["config_key"]))
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+
+	stored := make(map[string][]string, len(found))
+	for _, key := range found {
+		lower := strings.ToLower(key)
+		if !slices.Contains(stored[lower], key) {
+			stored[lower] = append(stored[lower], key)
+		}
+	}
+	for _, matches := range stored {
+		slices.Sort(matches)
+	}
+	return stored, nil
+}
+
+// storedKey returns the stored key that key matches regardless of case: key itself when it is stored as
+// given or not at all, otherwise the one stored key differing from it in case. A key matching several
+// stored keys is a conflict, as any of them could be meant.
+func storedKey(stored map[string][]string, key string) (string, error) {
+	matches := stored[strings.ToLower(key)]
+	switch {
+	case len(matches) == 0 || slices.Contains(matches, key):
+		return key, nil
+	case len(matches) == 1:
+		return matches[0], nil
+	}
+	return "", &apiError{
+		Status:  http.StatusConflict,
+		Code:    ErrorCodeConflict,
+		Message: fmt.Sprintf("config key %q matches %d stored keys differing in case: %s", key, len(matches), strings.Join(matches, ", ")),
+		Details: map[string]interface{}{"key": key, "matches": matches},
+	}
+}
+
+// resolveKeyCase replaces the keys of req with the stored keys they match regardless of case, so that
+// every operation, reads and writes alike, works on the stored config. Keys matching no stored config are
+// left as they are.
+func (a *API) resolveKeyCase(ctx context.Context, connector connectors.DBConnector, req *AllConfigOperationRequest) error {
+	keys := requestKeys(req)
+	if len(keys) == 0 {
+		return nil
+	}
+	stored, err := a.storedKeys(ctx, connector, req.TableName, keys)
+	if err != nil {
+		return fmt.Errorf("failed to look up config keys: %w", err)
+	}
+
+	if req.Key, err = storedKey(stored, req.Key); err != nil {
+		return err
+	}
+	if len(req.FallbackKeys) > 0 {
+		fallbacks := make([]string, len(req.FallbackKeys))
+		for i, key := range req.FallbackKeys {
+			if fallbacks[i], err = storedKey(stored, key); err != nil {
+				return err
+			}
+		}
+		req.FallbackKeys = fallbacks
+	}
+	if len(req.ConfigItems) > 0 {
+		items := make([]ConfigItem, len(req.ConfigItems))
+		for i, item := range req.ConfigItems {
+			if item.Key, err = storedKey(stored, item.Key); err != nil {
+				return err
+			}
+			items[i] = item
+		}
+		req.ConfigItems = items
+	}
+	if len(req.Configs) > 0 {
+		// A map holding keys that differ in case only names the same config twice
+		configs := make(map[string]interface{}, len(req.Configs))
+		seen := make(map[string]bool, len(req.Configs))
+		for _, key := range sortedConfigKeys(req.Configs) {
+			resolved, err := storedKey(stored, key)
+			if err != nil {
+				return err
+			}
+			if seen[strings.ToLower(resolved)] {
+				return &apiError{
+					Status:  http.StatusBadRequest,
+					Code:    ErrorCodeValidation,
+					Message: fmt.Sprintf("configs has more than one key matching %s regardless of case", resolved),
+					Details: map[string]interface{}{"operation": req.Operation, "key": resolved},
+				}
+			}
+			seen[strings.ToLower(resolved)] = true
+			configs[resolved] = req.Configs[key]
+		}
+		req.Configs = configs
+	}
+	return nil
+}
+
+// ResolveKey returns the key a checked ConfigService operation works on: normalized by the key policy and,
+// when the policy looks keys up regardless of case, the stored key it matches
+func (p configPolicy) ResolveKey(ctx context.Context, connector connectors.DBConnector, table, key string) (string, error) {
+	key = p.api.keys.normalize(key)
+	if !p.api.keys.CaseInsensitive {
+		return key, nil
+	}
+	stored, err := p.api.storedKeys(ctx, connector, table, []string{key})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up config key: %w", err)
+	}
+	return storedKey(stored, key)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// caseConnector returns a connector of dbType whose allconfig table stores the approved config
+// Feature.Flag, expecting its key to be looked up regardless of case
+func caseConnector(t *testing.T, dbType string) *connectortest.MockDBConnector {
+	conn := newServiceConnector(dbType)
+	config := map[string]interface{}{"config_key": "Feature.Flag", "config_value": "on"}
+	switch dbType {
+	case "mysql":
+		// The collation of config_key matches regardless of case
+		conn.On("Query", mock.Anything, "SELECT config_key FROM allconfig WHERE config_key IN (?)", []interface{}{"feature.FLAG"}).
+			Return(newMockRows(t, []string{"config_key"}, []driver.Value{"Feature.Flag"}), nil).Once()
+	case "postgresql":
+		conn.On("Query", mock.Anything, "SELECT config_key FROM allconfig WHERE LOWER(config_key) IN ($1)", []interface{}{"feature.flag"}).
+			Return(newMockRows(t, []string{"config_key"}, []driver.Value{"Feature.Flag"}), nil).Once()
+	case "mongodb":
+		conn.On("Execute", mock.Anything, "find", map[string]interface{}{
+			"collection": "allconfig",
+			"filter":     map[string]interface{}{"config_key": map[string]interface{}{"$in": []string{"feature.FLAG"}}},
+			"collation":  map[string]interface{}{"locale": "en", "strength": 2},
+		}).Return([]map[string]interface{}{config}, nil).Once()
+		conn.On("Execute", mock.Anything, "findOne", map[string]interface{}{
+			"collection": "allconfig",
+			"filter":     map[string]interface{}{"config_key": "Feature.Flag", "status": "approved", "expires_at": mongoUnexpired(expiryTestNow)},
+		}).Return(config, nil).Once()
+		return conn
+	}
+	conn.On("Query", mock.Anything, queryContaining("WHERE config_key = "), []interface{}{"Feature.Flag"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"Feature.Flag", "on"}), nil).Once()
+	return conn
+}
+
+func TestCaseInsensitiveReadAcrossDatabases(t *testing.T) {
+	for _, dbType := range []string{"mysql", "postgresql", "mongodb"} {
+		t.Run(dbType, func(t *testing.T) {
+			conn := caseConnector(t, dbType)
+			req := &AllConfigOperationRequest{Operation: "read", Key: "feature.FLAG", CaseInsensitive: boolPtr(true)}
+			req.TableName = "allconfig"
+			req.LegacyMode = boolPtr(false)
+
+			result, err := stopClock(NewAPI()).executeAllConfigOperation(context.Background(), conn, req)
+			require.NoError(t, err)
+			config, _ := allconfig.FirstConfig(result)
+			assert.Equal(t, "Feature.Flag", config.(map[string]interface{})["config_key"])
+			assert.Equal(t, "on", config.(map[string]interface{})["config_value"])
+			conn.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCaseInsensitiveDefault(t *testing.T) {
+	// Keys are looked up as given unless the policy or the request asks otherwise
+	conn := newServiceConnector("postgresql")
+	conn.On("Query", mock.Anything, queryContaining("WHERE config_key = $1"), []interface{}{"feature.FLAG"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}), nil).Once()
+	req := &AllConfigOperationRequest{Operation: "read", Key: "feature.FLAG"}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	_, err := NewAPI().executeAllConfigOperation(context.Background(), conn, req)
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	conn.AssertExpectations(t)
+
+	api := NewAPI()
+	api.keys.CaseInsensitive = true
+	assert.True(t, api.caseInsensitive(&AllConfigOperationRequest{}))
+	assert.False(t, api.caseInsensitive(&AllConfigOperationRequest{CaseInsensitive: boolPtr(false)}))
+
+	// The config resources follow the policy
+	service := stopClock(api).ConfigService()
+	config, err := service.Get(context.Background(), caseConnector(t, "mongodb"), allconfig.ReadRequest{Table: "allconfig", Key: "feature.FLAG"})
+	require.NoError(t, err)
+	assert.Equal(t, "Feature.Flag", config.(map[string]interface{})["config_key"])
+}
+
+func TestStoredKey(t *testing.T) {
+	stored := map[string][]string{
+		"feature.flag": {"Feature.Flag"},
+		"app.mode":     {"APP.MODE", "app.mode"},
+	}
+	for key, want := range map[string]string{
+		"FEATURE.FLAG": "Feature.Flag",
+		"Feature.Flag": "Feature.Flag",
+		"app.mode":     "app.mode",
+		"new.key":      "new.key",
+	} {
+		got, err := storedKey(stored, key)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, key)
+	}
+
+	_, err := storedKey(stored, "App.Mode")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeConflict, apiErr.Code)
+	assert.Equal(t, `config key "App.Mode" matches 2 stored keys differing in case: APP.MODE, app.mode`, apiErr.Message)
+}
+
+func TestResolveKeyCase(t *testing.T) {
+	conn := newServiceConnector("mysql")
+	conn.On("Query", mock.Anything, "SELECT config_key FROM allconfig WHERE config_key IN (?, ?, ?)", mock.Anything).
+		Return(newMockRows(t, []string{"config_key"}, []driver.Value{"Feature.Flag"}, []driver.Value{"Limits.RPS"}), nil).Once()
+
+	req := &AllConfigOperationRequest{Operation: "direct_update_batch", ConfigItems: []ConfigItem{
+		{Key: "feature.flag", Value: "off"}, {Key: "limits.rps", Value: "10"}, {Key: "new.key", Value: "x"},
+	}}
+	req.TableName = "allconfig"
+	items := req.ConfigItems
+	require.NoError(t, NewAPI().resolveKeyCase(context.Background(), conn, req))
+	assert.Equal(t, []string{"Feature.Flag", "Limits.RPS", "new.key"}, configItemKeys(req.ConfigItems))
+	assert.Equal(t, "feature.flag", items[0].Key, "the items of the caller are left as they are")
+
+	// Keys of a configs map differing in case only are the same config, whether it is stored or not
+	for _, stored := range [][]driver.Value{{"Feature.Flag"}, {}} {
+		var rows [][]driver.Value
+		if len(stored) > 0 {
+			rows = append(rows, stored)
+		}
+		conn.On("Query", mock.Anything, "SELECT config_key FROM allconfig WHERE config_key IN (?, ?, ?)", mock.Anything).
+			Return(newMockRows(t, []string{"config_key"}, rows...), nil).Once()
+		req = &AllConfigOperationRequest{Operation: "set_multiple", Configs: map[string]interface{}{"feature.flag": "on", "FEATURE.FLAG": "off", "x": "1"}}
+		req.TableName = "allconfig"
+		err := NewAPI().resolveKeyCase(context.Background(), conn, req)
+		assert.ErrorContains(t, err, "configs has more than one key matching")
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"db-connectors/connectors"
+)
+
+// legacyConfigColumns are the columns of allconfig tables created before the maker-checker workflow
+const legacyConfigColumns = "config_key, config_value, description, created_at, updated_at"
+
+// legacyConfigOperations are the operations supported on legacy allconfig tables, which have no status or
+// maker columns for the maker-checker operations to use. create_table, drop_table and migrate_table run as
+// they do on any table.
+var legacyConfigOperations = []string{
+	"create_table", "drop_table", "migrate_table",
+	"read", "read_all", "read_all_admin", "search", "filter", "search_admin", "exists", "count", "count_admin",
+	"direct_create", "direct_create_batch", "direct_update", "direct_update_batch",
+	"direct_delete", "direct_delete_batch", "direct_delete_all",
+}
+
+// legacyTableKey identifies the allconfig table of a request in the cache of detected legacy tables
+func legacyTableKey(req *AllConfigRequest) string {
+	return connectionHash(&req.DatabaseConnectionRequest) + "/" + req.tableSchema() + "/" + req.TableName
+}
+
+// legacyMode reports whether the operations of req run against a legacy allconfig table. legacy_mode
+// decides when set; otherwise a SQL table lacking the status column is legacy, which is looked up once
+// per table. MongoDB collections have no columns to look up, so they are legacy only when asked to be.
+func (a *API) legacyMode(ctx context.Context, connector connectors.DBConnector, req *AllConfigRequest) bool {
+	if req.LegacyMode != nil {
+		return *req.LegacyMode
+	}
+	if connector.GetType() != "mysql" && connector.GetType() != "postgresql" {
+		return false
+	}
+
+	key := legacyTableKey(req)
+	a.legacyTablesMu.Lock()
+	legacy, found := a.legacyTables[key]
+	a.legacyTablesMu.Unlock()
+	if found {
+		return legacy
+	}
+
+	columns, err := a.describeTable(ctx, connector, req.tableSchema(), req.TableName)
+	if err != nil {
+		a.logger.Warn("failed to detect legacy allconfig table", "table", req.TableName, "error", err)
+		return false
+	}
+	// A table that does not exist yet is created with the status column
+	if len(columns) == 0 {
+		return false
+	}
+	legacy = !slices.ContainsFunc(columns, func(column ColumnInfo) bool {
+		return strings.EqualFold(column.Name, "status")
+	})
+
+	a.legacyTablesMu.Lock()
+	a.legacyTables[key] = legacy
+	a.legacyTablesMu.Unlock()
+	return legacy
+}
+
+// forgetLegacyTable drops the detected layout of the allconfig table of req, which create_table, drop_table,
+// migrate_table and repairs change
+func (a *API) forgetLegacyTable(req *AllConfigRequest) {
+	a.legacyTablesMu.Lock()
+	delete(a.legacyTables, legacyTableKey(req))
+	a.legacyTablesMu.Unlock()
+}
+
+// mongoStatusMigration sets the status of the documents of a MongoDB collection that have none to approved
+func mongoStatusMigration(collection string) (string, map[string]interface{}) {
+	return fmt.Sprintf(`db.%s.updateMany({"status": {"$exists": false}}, {"$set": {"status": "approved"}})`, collection),
+		map[string]interface{}{
+			"collection": collection,
+			"filter":     map[string]interface{}{"status": map[string]interface{}{"$exists": false}},
+			"update":     map[string]interface{}{"$set": map[string]interface{}{"status": "approved"}},
+		}
+}
+
+// configMigration returns what migrate_table adds to the allconfig table and its approval table, with the
+// statements doing so. Existing configs get the approved status, which is the default of the added column.
+func (a *API) configMigration(ctx context.Context, connector connectors.DBConnector, schema, tableName string) (*ConfigSchemaHealth, []string, error) {
+	health, err := a.inspectConfigSchema(ctx, connector, schema, tableName, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	statements := []string{}
+	if connector.GetType() == "mongodb" {
+		statement, _ := mongoStatusMigration(tableName)
+		statements = append(statements, statement)
+	}
+	for _, table := range health.Tables {
+		statements = append(statements, table.RepairSQL...)
+	}
+	return health, statements, nil
+}
+
+// migrateConfigTable adds the status, maker and other columns missing from the allconfig table, creates its
+// approval table when missing and adds the missing indexes of both, so a legacy table can take part in the
+// maker-checker workflow
+func (a *API) migrateConfigTable(ctx context.Context, connector connectors.DBConnector, schema, tableName string) (interface{}, error) {
+	health, err := a.inspectConfigSchema(ctx, connector, schema, tableName, true)
+	if err != nil {
+		return nil, err
+	}
+	applied := []string{}
+	if connector.GetType() == "mongodb" {
+		statement, params := mongoStatusMigration(tableName)
+		if _, err := connector.Execute(ctx, "updateMany", params); err != nil {
+			return nil, fmt.Errorf("failed to set the status of %s: %w", tableName, err)
+		}
+		applied = append(applied, statement)
+	}
+	repaired, err := a.applyConfigSchema(ctx, connector, tableName, health)
+	applied = append(applied, repaired...)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"table": tableName, "applied": applied}, nil
+}
+
+// notMigratedError returns a 400 UNSUPPORTED_OPERATION failure for a request needing the columns a legacy
+// table lacks, listing the statements migrate_table would run to add them
+func (a *API) notMigratedError(ctx context.Context, connector connectors.DBConnector, req *AllConfigOperationRequest, reason string) error {
+	_, statements, err := a.configMigration(ctx, connector, req.tableSchema(), req.TableName)
+	if err != nil {
+		a.logger.Warn("failed to list the migration of a legacy allconfig table", "table", req.TableName, "error", err)
+	}
+	message := fmt.Sprintf("table %s is not migrated: %s. Run migrate_table to add the missing columns", req.TableName, reason)
+	if len(statements) > 0 {
+		message += ": " + strings.Join(statements, "; ")
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeUnsupportedOperation,
+		Message: message,
+		Details: map[string]interface{}{
+			"operation":     req.Operation,
+			"supported":     legacyConfigOperations,
+			"legacy_mode":   true,
+			"migration_sql": statements,
+		},
+	}
+}
+
+// legacyConfigQuery returns the query of a read, search, filter or count request on a legacy table
+func legacyConfigQuery(req *AllConfigOperationRequest) configQuery {
+	return configQuery{Legacy: true, SearchTerm: req.SearchTerm, Filter: req.Filter}
+}
+
+// executeLegacyConfigOperation runs an allconfig operation against a legacy table with the operations that
+// neither read nor write the status and maker columns
+func (a *API) executeLegacyConfigOperation(ctx context.Context, connector connectors.DBConnector, req *AllConfigOperationRequest, spec *operationSpec) (interface{}, error) {
+	if req.DryRun {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: ErrorCodeValidation, Message: "dry_run is not supported on legacy tables"}
+	}
+	if req.Upsert {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: ErrorCodeValidation, Message: "upsert is not supported on legacy tables"}
+	}
+	if resolvesFallback(req) {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: ErrorCodeValidation, Message: "fallback_keys and default_value are not supported on legacy tables"}
+	}
+	if !slices.Contains(legacyConfigOperations, spec.Name) {
+		return nil, a.notMigratedError(ctx, connector, req, spec.Name+" needs the status and maker columns")
+	}
+	if req.Status != "" {
+		return nil, a.notMigratedError(ctx, connector, req, "status needs the status column")
+	}
+	if len(req.Tags) > 0 || len(req.TagsAny) > 0 || len(req.TagsAll) > 0 {
+		return nil, a.notMigratedError(ctx, connector, req, "tags need the tags column")
+	}
+
+	switch spec.Name {
+	case "read":
+		return typingOf(req).apply(a.readConfig(ctx, connector, req.TableName, req.Key))
+	case "read_all", "read_all_admin", "search", "filter", "search_admin":
+		return a.findConfigs(ctx, connector, req.TableName, legacyConfigQuery(req), req.Limit, req.Offset)
+	case "exists":
+		return a.configExists(ctx, connector, req.TableName, req.Key)
+	case "count", "count_admin":
+		return a.countMatchingConfigs(ctx, connector, req.TableName, legacyConfigQuery(req))
+
+	case "direct_create":
+		return a.createConfig(ctx, connector, req.TableName, req.Key, req.Value, req.Description)
+	case "direct_create_batch":
+		if len(req.ConfigItems) > 0 {
+			return a.createMultipleConfigs(ctx, connector, req.TableName, req.ConfigItems, configBatchOptionsOf(req))
+		}
+		return a.setMultipleConfigs(ctx, connector, req.TableName, req.Configs, configBatchOptionsOf(req))
+	case "direct_update":
+		return a.updateConfig(ctx, connector, req.TableName, req.Key, req.Value, req.Description)
+	case "direct_update_batch":
+		return a.updateMultipleConfigs(ctx, connector, req.TableName, req.ConfigItems, configBatchOptionsOf(req))
+	case "direct_delete":
+		return a.deleteConfigDirect(ctx, connector, req.TableName, req.Key, req.MakerID)
+	case "direct_delete_batch":
+		return a.deleteMultipleConfigsDirect(ctx, connector, req.TableName, req.ConfigItems, configBatchOptionsOf(req))
+	case "direct_delete_all":
+		return a.deleteAllConfigs(ctx, connector, req.TableName)
+	default:
+		return nil, a.notMigratedError(ctx, connector, req, spec.Name+" needs the status and maker columns")
+	}
+}
+
+// legacy reports whether the allconfig table exists without the status column, as tables created before
+// the maker-checker workflow do
+func (h *ConfigSchemaHealth) legacy() bool {
+	for _, table := range h.Tables {
+		if table.Role == "config" {
+			return table.Exists && slices.Contains(table.MissingColumns, "status")
+		}
+	}
+	return false
+}
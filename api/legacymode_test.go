@@ -0,0 +1,334 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// describedConnector answers the column lookup of legacy mode detection with columns
+func describedConnector(t *testing.T, dbType string, columns ...string) *connectortest.MockDBConnector {
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return(dbType)
+	rows := make([][]driver.Value, len(columns))
+	for i, column := range columns {
+		rows[i] = []driver.Value{column, "text", "YES", nil, "", ""}
+	}
+	m.On("Query", mock.Anything, queryContaining("information_schema.columns"), mock.Anything).Return(newMockRows(t,
+		[]string{"column_name", "column_type", "is_nullable", "column_default", "column_key", "extra"}, rows...), nil).Once()
+	return m
+}
+
+func legacyRequest(dbType string) *AllConfigRequest {
+	req := &AllConfigRequest{TableName: "allconfig"}
+	req.Type, req.Host, req.Port, req.Database = dbType, "db", 3306, "app"
+	return req
+}
+
+func TestLegacyModeDetection(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("table without status column", func(t *testing.T) {
+		api := NewAPI()
+		m := describedConnector(t, "mysql", "config_key", "config_value", "description", "created_at", "updated_at")
+		assert.True(t, api.legacyMode(ctx, m, legacyRequest("mysql")))
+		// The table is looked up once
+		assert.True(t, api.legacyMode(ctx, m, legacyRequest("mysql")))
+		m.AssertNumberOfCalls(t, "Query", 1)
+
+		// Until create_table or a repair changes it
+		api.forgetLegacyTable(legacyRequest("mysql"))
+		m.On("Query", mock.Anything, queryContaining("information_schema.columns"), mock.Anything).Return(newMockRows(t,
+			[]string{"column_name", "column_type", "is_nullable", "column_default", "column_key", "extra"},
+			[]driver.Value{"config_key", "varchar", "NO", nil, "", ""},
+			[]driver.Value{"STATUS", "varchar", "YES", nil, "", ""},
+		), nil).Once()
+		assert.False(t, api.legacyMode(ctx, m, legacyRequest("mysql")))
+	})
+
+	t.Run("table with status column", func(t *testing.T) {
+		m := describedConnector(t, "postgresql", "config_key", "config_value", "status", "maker_id")
+		assert.False(t, NewAPI().legacyMode(ctx, m, legacyRequest("postgresql")))
+	})
+
+	t.Run("missing table", func(t *testing.T) {
+		api := NewAPI()
+		m := describedConnector(t, "mysql")
+		assert.False(t, api.legacyMode(ctx, m, legacyRequest("mysql")))
+		// A table that does not exist is looked up again once created
+		m.On("Query", mock.Anything, queryContaining("information_schema.columns"), mock.Anything).Return(newMockRows(t,
+			[]string{"column_name", "column_type", "is_nullable", "column_default", "column_key", "extra"},
+			[]driver.Value{"config_key", "varchar", "NO", nil, "", ""},
+		), nil).Once()
+		assert.True(t, api.legacyMode(ctx, m, legacyRequest("mysql")))
+	})
+
+	t.Run("failed lookup", func(t *testing.T) {
+		m := new(connectortest.MockDBConnector)
+		m.On("GetType").Return("mysql")
+		m.On("Query", mock.Anything, mock.Anything, mock.Anything).Return((*sql.Rows)(nil), errors.New("access denied"))
+		assert.False(t, NewAPI().legacyMode(ctx, m, legacyRequest("mysql")))
+	})
+
+	t.Run("legacy_mode set", func(t *testing.T) {
+		m := newProfileConnector("mysql")
+		req := legacyRequest("mysql")
+		req.LegacyMode = boolPtr(true)
+		assert.True(t, NewAPI().legacyMode(ctx, m, req))
+		req.LegacyMode = boolPtr(false)
+		assert.False(t, NewAPI().legacyMode(ctx, m, req))
+		m.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("mongodb", func(t *testing.T) {
+		m := newProfileConnector("mongodb")
+		assert.False(t, NewAPI().legacyMode(ctx, m, legacyRequest("mongodb")))
+		m.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestLegacyOperationRouting(t *testing.T) {
+	listed := NewAPI().listedValue("config_value")
+	tests := []struct {
+		req      AllConfigOperationRequest
+		mysql    string
+		postgres string
+	}{
+		{
+			req:      AllConfigOperationRequest{Operation: "read", Key: "k"},
+			mysql:    "SELECT config_key, config_value, description, created_at, updated_at FROM allconfig WHERE config_key = ?",
+			postgres: "SELECT config_key, config_value, description, created_at, updated_at FROM allconfig WHERE config_key = $1",
+		},
+		{
+			req:      AllConfigOperationRequest{Operation: "read_all_admin", Limit: 10, Offset: 20},
+			mysql:    "SELECT config_key, " + listed + ", description, created_at, updated_at FROM allconfig ORDER BY config_key LIMIT 10 OFFSET 20",
+			postgres: "SELECT config_key, " + listed + ", description, created_at, updated_at FROM allconfig ORDER BY config_key LIMIT 10 OFFSET 20",
+		},
+		{
+			req: AllConfigOperationRequest{Operation: "search", SearchTerm: "flag"},
+			mysql: "SELECT config_key, " + listed + ", description, created_at, updated_at FROM allconfig " +
+				"WHERE (config_key LIKE ? OR config_value LIKE ? OR description LIKE ?) ORDER BY config_key",
+			postgres: "SELECT config_key, " + listed + ", description, created_at, updated_at FROM allconfig " +
+				"WHERE (config_key ILIKE $1 OR config_value ILIKE $2 OR description ILIKE $3) ORDER BY config_key",
+		},
+		{
+			req:      AllConfigOperationRequest{Operation: "exists", Key: "k"},
+			mysql:    "SELECT COUNT(*) FROM allconfig WHERE config_key = ?",
+			postgres: "SELECT COUNT(*) FROM allconfig WHERE config_key = $1",
+		},
+		{
+			req:      AllConfigOperationRequest{Operation: "count"},
+			mysql:    "SELECT COUNT(*) FROM allconfig",
+			postgres: "SELECT COUNT(*) FROM allconfig",
+		},
+		{
+			req:      AllConfigOperationRequest{Operation: "direct_create", Key: "k", Value: "v", Description: "d", MakerID: "alice"},
+			mysql:    "INSERT INTO allconfig (config_key, config_value, description, created_at, updated_at) VALUES (?, ?, ?, NOW(), NOW())",
+			postgres: "INSERT INTO allconfig (config_key, config_value, description, created_at, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+		},
+		{
+			req:      AllConfigOperationRequest{Operation: "direct_update_batch", ConfigItems: []ConfigItem{{Key: "k", Value: "v", Description: "d"}}},
+			mysql:    "UPDATE allconfig SET config_value = ?, description = ?, updated_at = NOW() WHERE config_key = ?",
+			postgres: "UPDATE allconfig SET config_value = $1, description = $2, updated_at = CURRENT_TIMESTAMP WHERE config_key = $3",
+		},
+		{
+			req:      AllConfigOperationRequest{Operation: "direct_delete", Key: "k"},
+			mysql:    "DELETE FROM allconfig WHERE config_key = ?",
+			postgres: "DELETE FROM allconfig WHERE config_key = $1",
+		},
+	}
+	for _, tt := range tests {
+		for dbType, want := range map[string]string{"mysql": tt.mysql, "postgresql": tt.postgres} {
+			t.Run(dbType+"/"+tt.req.Operation, func(t *testing.T) {
+				conn := &statementConnector{t: t, dbType: dbType}
+				req := tt.req
+				req.TableName = "allconfig"
+				req.LegacyMode = boolPtr(true)
+				NewAPI().executeAllConfigOperation(context.Background(), conn, &req)
+				require.NotEmpty(t, conn.statements)
+				assert.Equal(t, want, conn.statements[0])
+			})
+		}
+	}
+}
+
+func TestLegacyModeDetectedByOperations(t *testing.T) {
+	m := describedConnector(t, "mysql", "config_key", "config_value", "description", "created_at", "updated_at")
+	m.On("Query", mock.Anything, "SELECT config_key, config_value, description, created_at, updated_at FROM allconfig WHERE config_key = ?", []interface{}{"k"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"k", "v"}), nil)
+
+	req := AllConfigOperationRequest{Operation: "read", Key: "k"}
+	req.AllConfigRequest = *legacyRequest("mysql")
+	result, err := NewAPI().executeAllConfigOperation(context.Background(), m, &req)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"config_key": "k", "config_value": "v"}}, result)
+	m.AssertExpectations(t)
+}
+
+func TestLegacyModeRejectsStatusOperations(t *testing.T) {
+	api := NewAPI()
+	run := func(req AllConfigOperationRequest) error {
+		req.TableName = "allconfig"
+		req.LegacyMode = boolPtr(true)
+		_, err := api.executeAllConfigOperation(context.Background(), legacySchemaConnector(t, api, "postgresql"), &req)
+		return err
+	}
+
+	for _, tc := range []struct {
+		req    AllConfigOperationRequest
+		reason string
+	}{
+		{AllConfigOperationRequest{Operation: "submit_create", Key: "k", Value: "v", MakerID: "bob"}, "submit_create needs the status and maker columns"},
+		{AllConfigOperationRequest{Operation: "approve_request", RequestID: "r1", CheckerID: "carol"}, "approve_request needs the status and maker columns"},
+		{AllConfigOperationRequest{Operation: "get_pending_approvals"}, "get_pending_approvals needs the status and maker columns"},
+		{AllConfigOperationRequest{Operation: "read_all_admin", Status: "pending"}, "status needs the status column"},
+		{AllConfigOperationRequest{Operation: "filter", TagsAny: []string{"team:payments"}}, "tags need the tags column"},
+	} {
+		err := run(tc.req)
+		var apiErr *apiError
+		require.ErrorAs(t, err, &apiErr, tc.req.Operation)
+		assert.Equal(t, ErrorCodeUnsupportedOperation, apiErr.Code)
+		assert.True(t, strings.HasPrefix(apiErr.Message, "table allconfig is not migrated: "+tc.reason+
+			". Run migrate_table to add the missing columns: ALTER TABLE allconfig ADD COLUMN tags JSONB; "), apiErr.Message)
+		assert.Equal(t, true, apiErr.Details["legacy_mode"])
+		assert.Len(t, apiErr.Details["migration_sql"], 14)
+	}
+
+	err := run(AllConfigOperationRequest{Operation: "direct_delete", Key: "k", DryRun: true})
+	assert.EqualError(t, err, "dry_run is not supported on legacy tables")
+	err = run(AllConfigOperationRequest{Operation: "direct_create_batch", Configs: map[string]interface{}{"k": "v"}, Upsert: true})
+	assert.EqualError(t, err, "upsert is not supported on legacy tables")
+}
+
+// legacySchemaConnector returns a connector holding an allconfig table created before tags and the
+// maker-checker workflow, keyed by config_key, with no approval table
+func legacySchemaConnector(t *testing.T, api *API, dbType string) *schemaConnector {
+	c := newSchemaConnector(t, api, dbType)
+	c.dropColumns("allconfig", "id", "tags", "status", "maker_id", "checker_id", "approved_at", "approval_comment")
+	var dropped []string
+	for _, index := range c.indexes["allconfig"] {
+		if index.Columns[0] != "config_key" {
+			dropped = append(dropped, index.Name)
+		}
+	}
+	c.dropIndexes("allconfig", dropped...)
+	c.drop(api.approvalTable("allconfig"))
+	return c
+}
+
+func TestLegacyModeSchemaShapes(t *testing.T) {
+	api := NewAPI()
+	for _, dbType := range []string{"mysql", "postgresql"} {
+		t.Run(dbType, func(t *testing.T) {
+			assert.False(t, api.legacyMode(context.Background(), newSchemaConnector(t, api, dbType), legacyRequest(dbType)))
+			assert.True(t, NewAPI().legacyMode(context.Background(), legacySchemaConnector(t, api, dbType), legacyRequest(dbType)))
+		})
+	}
+}
+
+func TestConfigMigrationSQL(t *testing.T) {
+	api := NewAPI()
+	tests := map[string][]string{
+		"mysql": {
+			"ALTER TABLE allconfig ADD COLUMN tags JSON",
+			"ALTER TABLE allconfig ADD COLUMN status ENUM('approved', 'pending', 'rejected') DEFAULT 'approved'",
+			"ALTER TABLE allconfig ADD COLUMN maker_id VARCHAR(255)",
+			"ALTER TABLE allconfig ADD COLUMN checker_id VARCHAR(255)",
+			"ALTER TABLE allconfig ADD COLUMN approved_at TIMESTAMP NULL",
+			"ALTER TABLE allconfig ADD COLUMN approval_comment TEXT",
+			"CREATE INDEX idx_status ON allconfig (status)",
+			"CREATE INDEX idx_maker_id ON allconfig (maker_id)",
+			"CREATE INDEX idx_expires_at ON allconfig (expires_at)",
+		},
+		"postgresql": {
+			"ALTER TABLE allconfig ADD COLUMN tags JSONB",
+			"ALTER TABLE allconfig ADD COLUMN status VARCHAR(20) DEFAULT 'approved' CHECK (status IN ('approved', 'pending', 'rejected'))",
+			"ALTER TABLE allconfig ADD COLUMN maker_id VARCHAR(255)",
+			"ALTER TABLE allconfig ADD COLUMN checker_id VARCHAR(255)",
+			"ALTER TABLE allconfig ADD COLUMN approved_at TIMESTAMP",
+			"ALTER TABLE allconfig ADD COLUMN approval_comment TEXT",
+			"CREATE INDEX idx_allconfig_status ON allconfig (status)",
+			"CREATE INDEX idx_allconfig_maker_id ON allconfig (maker_id)",
+			"CREATE INDEX idx_allconfig_tags ON allconfig USING GIN (tags)",
+			"CREATE INDEX idx_allconfig_expires_at ON allconfig (expires_at)",
+		},
+	}
+	for dbType, alters := range tests {
+		t.Run(dbType, func(t *testing.T) {
+			_, statements, err := api.configMigration(context.Background(), legacySchemaConnector(t, api, dbType), "", "allconfig")
+			require.NoError(t, err)
+			require.Greater(t, len(statements), len(alters))
+			// The id key is left out, as the table is keyed by config_key already
+			assert.Equal(t, alters, statements[:len(alters)])
+			assert.True(t, strings.HasPrefix(statements[len(alters)], "CREATE TABLE allconfig_approval_requests ("))
+			for _, statement := range statements {
+				if strings.HasPrefix(statement, "ALTER TABLE") {
+					assert.NotContains(t, statement, "PRIMARY KEY")
+				}
+			}
+
+			// A migrated table needs nothing
+			_, statements, err = api.configMigration(context.Background(), newSchemaConnector(t, api, dbType), "", "allconfig")
+			require.NoError(t, err)
+			assert.Empty(t, statements)
+		})
+	}
+}
+
+func TestMigrateTable(t *testing.T) {
+	api := NewAPI()
+	ctx := context.Background()
+	for _, dbType := range []string{"mysql", "postgresql"} {
+		t.Run(dbType, func(t *testing.T) {
+			conn := legacySchemaConnector(t, api, dbType)
+			req := AllConfigOperationRequest{Operation: "migrate_table"}
+			req.AllConfigRequest = *legacyRequest(dbType)
+			require.True(t, api.legacyMode(ctx, conn, &req.AllConfigRequest))
+
+			result, err := api.executeAllConfigOperation(ctx, conn, &req)
+			require.NoError(t, err)
+			_, statements, _ := api.configMigration(ctx, legacySchemaConnector(t, api, dbType), "", "allconfig")
+			assert.Equal(t, map[string]interface{}{"table": "allconfig", "applied": statements}, result)
+			assert.Equal(t, statements, conn.executed)
+
+			// The table is looked up again after its migration
+			assert.False(t, api.legacyMode(ctx, newSchemaConnector(t, api, dbType), &req.AllConfigRequest))
+		})
+	}
+
+	t.Run("mongodb", func(t *testing.T) {
+		conn := legacySchemaConnector(t, api, "mongodb")
+		req := AllConfigOperationRequest{Operation: "migrate_table"}
+		req.AllConfigRequest = *legacyRequest("mongodb")
+		result, err := api.executeAllConfigOperation(ctx, conn, &req)
+		require.NoError(t, err)
+		applied := result.(map[string]interface{})["applied"].([]string)
+		require.Len(t, applied, 7)
+		assert.Equal(t, `db.allconfig.updateMany({"status": {"$exists": false}}, {"$set": {"status": "approved"}})`, applied[0])
+		assert.Equal(t, `db.allconfig.createIndex({"tags": 1})`, applied[1])
+		assert.Equal(t, `db.allconfig.createIndex({"expires_at": 1}, {"expireAfterSeconds": 0})`, applied[2])
+		assert.Equal(t, "allconfig updateMany map[status:map[$exists:false]] map[$set:map[status:approved]]", conn.executed[0])
+	})
+}
+
+func TestConfigSchemaHealthLegacy(t *testing.T) {
+	health := &ConfigSchemaHealth{Tables: []ConfigTableHealth{
+		{Role: "config", Exists: true, MissingColumns: []string{"tags", "status", "maker_id"}},
+		{Role: "approval", Exists: false},
+	}}
+	assert.True(t, health.legacy())
+
+	health.Tables[0].MissingColumns = []string{"tags"}
+	assert.False(t, health.legacy())
+	health.Tables[0] = ConfigTableHealth{Role: "config", Exists: false, MissingColumns: []string{}}
+	assert.False(t, health.legacy())
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	api := NewAPI()
+	api.logger = logging.New(logging.Options{Level: "info", Output: &buf})
+	handler := SetupRoutes(api)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	line := buf.String()
+	assert.Contains(t, line, "INFO  request method=GET path=/health status=200 duration=")
+	assert.Regexp(t, `request_id=[0-9a-f]{32}\n$`, line)
+
+	buf.Reset()
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/execute", nil))
+	assert.Contains(t, buf.String(), "path=/execute status=405")
+}
+
+func TestLoggingMiddlewareCancelledRequest(t *testing.T) {
+	var buf bytes.Buffer
+	api := NewAPI()
+	api.logger = logging.New(logging.Options{Level: "info", Output: &buf})
+	slowDriverConnector = &slowConnector{executeDelay: time.Minute}
+
+	// The client goes away while the operation runs
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	body := `{"type": "slowkv", "host": "kv.internal", "port": 7000, "database": "sessions", "operation": "get"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewBufferString(body)).WithContext(ctx)
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	start := time.Now()
+	SetupRoutes(api).ServeHTTP(httptest.NewRecorder(), req)
+
+	// The operation stops with the request rather than running to completion
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.ErrorIs(t, slowDriverConnector.executeErr, context.Canceled)
+	assert.Contains(t, buf.String(), "INFO  request cancelled method=POST path=/v1/execute status=499 duration=")
+	// A retry runs the request again rather than replaying the response the client never read
+	assert.Zero(t, api.idempotency.(*MemoryIdempotencyStore).size())
+}
+
+func TestStatusRecorderDefaultsToOK(t *testing.T) {
+	recorder := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	recorder.Write([]byte("ok"))
+	recorder.WriteHeader(http.StatusTeapot)
+	assert.Equal(t, http.StatusOK, recorder.status)
+}
+
+func TestRequestIDMiddlewareGeneratesID(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/execute", nil))
+
+	id := rr.Header().Get("X-Request-ID")
+	assert.Regexp(t, `^[0-9a-f]{32}$`, id)
+
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, id, response.RequestID)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/execute", nil))
+	assert.NotEqual(t, id, rr.Header().Get("X-Request-ID"))
+}
+
+func TestRequestIDMiddlewarePropagatesID(t *testing.T) {
+	var buf bytes.Buffer
+	api := NewAPI()
+	api.logger = logging.New(logging.Options{Level: "info", Output: &buf})
+	handler := SetupRoutes(api)
+
+	req := httptest.NewRequest(http.MethodPost, "/execute", bytes.NewBufferString("{"))
+	req.Header.Set("X-Request-ID", "client-req-42")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "client-req-42", rr.Header().Get("X-Request-ID"))
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "client-req-42", response.RequestID)
+	assert.Contains(t, buf.String(), "request_id=client-req-42")
+}
+
+func TestRequestIDMiddlewareReplacesInvalidID(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "bad id\nINFO forged=1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Regexp(t, `^[0-9a-f]{32}$`, rr.Header().Get("X-Request-ID"))
+}
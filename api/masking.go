@@ -0,0 +1,311 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"db-connectors/jobs"
+)
+
+// MaskAction is how a masking rule transforms a sensitive value
+type MaskAction string
+
+const (
+	MaskRedact  MaskAction = "redact"  // Replace the value with MaskedValue
+	MaskPartial MaskAction = "partial" // Replace all but the last 4 characters with *
+	MaskHash    MaskAction = "hash"    // Replace the value with its hex SHA-256, keyed by the policy's hash key when set
+)
+
+// MaskedValue replaces redacted values
+const MaskedValue = "[REDACTED]"
+
+// MaskingRule masks the values of sensitive columns in query results, or the values of sensitive allconfig
+// keys. A rule matching columns sets Column or ColumnPattern; a rule matching config keys sets KeyPattern.
+type MaskingRule struct {
+	Connection    string         // Connection profile whose results are masked; empty for every connection
+	Column        string         // Column or document field, or table.column to mask it only in statements reading the table
+	ColumnPattern *regexp.Regexp // Matched against column names
+	KeyPattern    *regexp.Regexp // Matched against allconfig keys, masking their values
+	Action        MaskAction
+}
+
+// MaskingPolicy holds the masking rules applied to the results of /execute, /execute-batch, jobs and the
+// allconfig reads
+type MaskingPolicy struct {
+	Rules      []MaskingRule
+	BypassRole string // X-User-Role seeing values unmasked; empty for AdminRole
+	HashKey    []byte // Key of the HMAC used by hash rules, so hashes cannot be looked up; nil hashes plainly
+}
+
+// bypassRole returns the role that sees values unmasked
+func (p MaskingPolicy) bypassRole() string {
+	if p.BypassRole == "" {
+		return AdminRole
+	}
+	return p.BypassRole
+}
+
+// masker masks the results of one request on one connection
+type masker struct {
+	rules   []MaskingRule
+	hashKey []byte
+}
+
+// masker returns the masker for the results of a request on the named connection, or nil when no rule
+// applies or the caller has the bypass role
+func (a *API) masker(r *http.Request, connection string) *masker {
+	if len(a.masking.Rules) == 0 || r.Header.Get(UserRoleHeader) == a.masking.bypassRole() {
+		return nil
+	}
+	var rules []MaskingRule
+	for _, rule := range a.masking.Rules {
+		if rule.Connection == "" || rule.Connection == connection {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &masker{rules: rules, hashKey: a.masking.HashKey}
+}
+
+// connectionName returns the connection profile a request's connection settings point at, or an empty
+// string when they match none
+func (a *API) connectionName(req *DatabaseConnectionRequest) string {
+	a.profilesMu.RLock()
+	defer a.profilesMu.RUnlock()
+	for name, p := range a.profiles {
+		if p.Host == req.Host && p.Port == req.Port && p.Database == req.Database && p.connector().GetType() == req.Type {
+			return name
+		}
+	}
+	return ""
+}
+
+// maskSource returns what an operation reads for matching table.column rules: the SQL statement, or the
+// MongoDB collection
+func (r *DatabaseOperationRequest) maskSource() string {
+	if isSQLType(r.Type) {
+		return r.Query
+	}
+	collection, _ := r.Params["collection"].(string)
+	return collection
+}
+
+// columns returns a function masking the columns of rows read by source
+func (m *masker) columns(source string) func(row map[string]interface{}) map[string]interface{} {
+	var rules []MaskingRule
+	for _, rule := range m.rules {
+		if rule.Column == "" && rule.ColumnPattern == nil {
+			continue
+		}
+		if table, _, ok := cutColumn(rule.Column); ok && !readsTable(source, table) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return func(row map[string]interface{}) map[string]interface{} {
+		if len(rules) == 0 {
+			return row
+		}
+		masked := make(map[string]interface{}, len(row))
+		for column, value := range row {
+			masked[column] = value
+			for _, rule := range rules {
+				if rule.matchesColumn(column) {
+					masked[column] = m.mask(rule.Action, value)
+					break
+				}
+			}
+		}
+		return masked
+	}
+}
+
+// rows masks the sensitive columns of a query result read by source. Results other than rows, such as
+// affected row counts, are returned as they are.
+func (m *masker) rows(source string, result interface{}) interface{} {
+	if m == nil {
+		return result
+	}
+	mask := m.columns(source)
+	switch v := result.(type) {
+	case []map[string]interface{}:
+		masked := make([]map[string]interface{}, len(v))
+		for i, row := range v {
+			masked[i] = mask(row)
+		}
+		return masked
+	case map[string]interface{}:
+		return mask(v)
+	case *QueryResult:
+		masked := *v
+		masked.Rows = make([]map[string]interface{}, len(v.Rows))
+		for i, row := range v.Rows {
+			masked.Rows[i] = mask(row)
+		}
+		return &masked
+	case *CallResult:
+		masked := *v
+		masked.ResultSets = make([]*QueryResult, len(v.ResultSets))
+		for i, set := range v.ResultSets {
+			masked.ResultSets[i] = m.rows(source, set).(*QueryResult)
+		}
+		return &masked
+	case *WriteResult:
+		masked := *v
+		if v.Rows != nil {
+			masked.Rows = make([]map[string]interface{}, len(v.Rows))
+			for i, row := range v.Rows {
+				masked.Rows[i] = mask(row)
+			}
+		}
+		return &masked
+	}
+	return result
+}
+
+// writer masks the sensitive columns of the rows written to rw by an operation reading source
+func (m *masker) writer(source string, rw jobs.ResultWriter) jobs.ResultWriter {
+	if m == nil {
+		return rw
+	}
+	return maskingWriter{ResultWriter: rw, mask: m.columns(source)}
+}
+
+// maskingWriter masks rows on their way into a job result, so both its JSON Lines and CSV forms are masked
+type maskingWriter struct {
+	jobs.ResultWriter
+	mask func(row map[string]interface{}) map[string]interface{}
+}
+
+func (w maskingWriter) WriteRow(row map[string]interface{}) error {
+	return w.ResultWriter.WriteRow(w.mask(row))
+}
+
+// configs masks the values of allconfig results whose config_key matches a key rule, looking through
+// lists and wrapping objects
+func (m *masker) configs(result interface{}) interface{} {
+	if m == nil {
+		return result
+	}
+	switch v := result.(type) {
+	case []map[string]interface{}:
+		masked := make([]map[string]interface{}, len(v))
+		for i, row := range v {
+			masked[i] = m.configs(row).(map[string]interface{})
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = m.configs(item)
+		}
+		return masked
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		key, _ := v["config_key"].(string)
+		action, sensitive := m.keyAction(key)
+		for field, value := range v {
+			switch {
+			case sensitive && (field == "config_value" || field == "previous_value"):
+				masked[field] = m.mask(action, value)
+			default:
+				masked[field] = m.configs(value)
+			}
+		}
+		return masked
+	}
+	return result
+}
+
+// keyAction returns the action of the first key rule matching an allconfig key
+func (m *masker) keyAction(key string) (MaskAction, bool) {
+	if key == "" {
+		return "", false
+	}
+	for _, rule := range m.rules {
+		if rule.KeyPattern != nil && rule.KeyPattern.MatchString(key) {
+			return rule.Action, true
+		}
+	}
+	return "", false
+}
+
+// matchesColumn reports whether the rule masks the column
+func (r MaskingRule) matchesColumn(column string) bool {
+	if r.ColumnPattern != nil && r.ColumnPattern.MatchString(column) {
+		return true
+	}
+	if r.Column == "" {
+		return false
+	}
+	if _, name, ok := cutColumn(r.Column); ok {
+		return strings.EqualFold(name, column)
+	}
+	return strings.EqualFold(r.Column, column)
+}
+
+// cutColumn splits table.column at its last dot
+func cutColumn(column string) (table, name string, ok bool) {
+	i := strings.LastIndexByte(column, '.')
+	if i < 0 {
+		return "", column, false
+	}
+	return column[:i], column[i+1:], true
+}
+
+// readsTable reports whether a statement or collection name refers to table as a whole word
+func readsTable(source, table string) bool {
+	pattern := `(?i)(^|[^A-Za-z0-9_$])` + regexp.QuoteMeta(table) + `($|[^A-Za-z0-9_$])`
+	matched, _ := regexp.MatchString(pattern, source)
+	return matched
+}
+
+// mask transforms a sensitive value; NULL values stay NULL
+func (m *masker) mask(action MaskAction, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch action {
+	case MaskPartial:
+		text := valueText(value)
+		n := utf8.RuneCountInString(text)
+		if n <= 4 {
+			return strings.Repeat("*", n)
+		}
+		runes := []rune(text)
+		return strings.Repeat("*", n-4) + string(runes[n-4:])
+	case MaskHash:
+		if m.hashKey != nil {
+			mac := hmac.New(sha256.New, m.hashKey)
+			mac.Write([]byte(valueText(value)))
+			return hex.EncodeToString(mac.Sum(nil))
+		}
+		sum := sha256.Sum256([]byte(valueText(value)))
+		return hex.EncodeToString(sum[:])
+	}
+	return MaskedValue
+}
+
+// valueText returns the text a value is masked, hashed or checked against value rules as: strings as they
+// are, other values as JSON
+func valueText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	if encoded, err := json.Marshal(value); err == nil {
+		return string(encoded)
+	}
+	return fmt.Sprint(value)
+}
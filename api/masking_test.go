@@ -0,0 +1,157 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMaskingAPI(rules ...MaskingRule) *API {
+	api := NewAPI()
+	api.masking = MaskingPolicy{Rules: rules}
+	return api
+}
+
+func maskingRequest(role string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/v1/execute", nil)
+	if role != "" {
+		r.Header.Set(UserRoleHeader, role)
+	}
+	return r
+}
+
+func TestMaskRows(t *testing.T) {
+	api := newMaskingAPI(
+		MaskingRule{Column: "ssn", Action: MaskRedact},
+		MaskingRule{Column: "card_number", Action: MaskPartial},
+		MaskingRule{ColumnPattern: regexp.MustCompile(`(?i)email`), Action: MaskHash},
+	)
+	rows := []map[string]interface{}{
+		{"id": int64(1), "name": "Ada", "ssn": "123-45-6789", "card_number": "4111111111111111", "Email": "ada@example.com"},
+		{"id": int64(2), "name": "Bob", "ssn": nil, "card_number": "123", "Email": "bob@example.com"},
+	}
+
+	hash := func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	masked := api.masker(maskingRequest(""), "").rows("SELECT * FROM customers", rows)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": int64(1), "name": "Ada", "ssn": MaskedValue, "card_number": "************1111", "Email": hash("ada@example.com")},
+		{"id": int64(2), "name": "Bob", "ssn": nil, "card_number": "***", "Email": hash("bob@example.com")},
+	}, masked)
+	// The rows passed in are left as they are, since they may be cached
+	assert.Equal(t, "123-45-6789", rows[0]["ssn"])
+
+	// Results other than rows pass through
+	assert.Equal(t, map[string]interface{}{"rows_affected": int64(1)}, api.masker(maskingRequest(""), "").rows("", map[string]interface{}{"rows_affected": int64(1)}))
+}
+
+func TestMaskHashKey(t *testing.T) {
+	api := newMaskingAPI(MaskingRule{Column: "email", Action: MaskHash})
+	api.masking.HashKey = []byte("pepper")
+
+	mac := hmac.New(sha256.New, []byte("pepper"))
+	mac.Write([]byte("ada@example.com"))
+	masked := api.masker(maskingRequest(""), "").rows("", []map[string]interface{}{{"email": "ada@example.com"}})
+	assert.Equal(t, []map[string]interface{}{{"email": hex.EncodeToString(mac.Sum(nil))}}, masked)
+}
+
+func TestMaskTableColumn(t *testing.T) {
+	m := newMaskingAPI(MaskingRule{Column: "customers.card_number", Action: MaskRedact}).masker(maskingRequest(""), "")
+	rows := []map[string]interface{}{{"card_number": "4111111111111111"}}
+
+	assert.Equal(t, []map[string]interface{}{{"card_number": MaskedValue}}, m.rows("SELECT card_number FROM billing.Customers c", rows))
+	// Statements not reading the table, and MongoDB collections of other names, are not masked
+	assert.Equal(t, rows, m.rows("SELECT card_number FROM customers_archive", rows))
+	assert.Equal(t, rows, m.rows("orders", rows))
+
+	req := &DatabaseOperationRequest{DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mongodb"}, Params: map[string]interface{}{"collection": "customers"}}
+	assert.Equal(t, []map[string]interface{}{{"card_number": MaskedValue}}, m.rows(req.maskSource(), rows))
+}
+
+func TestMaskerRoleAndConnection(t *testing.T) {
+	api := newMaskingAPI(MaskingRule{Connection: "billing", Column: "ssn", Action: MaskRedact})
+
+	assert.NotNil(t, api.masker(maskingRequest("analyst"), "billing"))
+	// Rules apply to their connection only
+	assert.Nil(t, api.masker(maskingRequest("analyst"), "reporting"))
+	// Admins see values unmasked, unless the policy names another bypass role
+	assert.Nil(t, api.masker(maskingRequest(AdminRole), "billing"))
+	api.masking.BypassRole = "auditor"
+	assert.NotNil(t, api.masker(maskingRequest(AdminRole), "billing"))
+	assert.Nil(t, api.masker(maskingRequest("auditor"), "billing"))
+
+	// A nil masker masks nothing
+	var m *masker
+	rows := []map[string]interface{}{{"ssn": "123-45-6789"}}
+	assert.Equal(t, rows, m.rows("", rows))
+	assert.Equal(t, rows, m.configs(rows))
+}
+
+func TestMaskingWriter(t *testing.T) {
+	m := newMaskingAPI(MaskingRule{Column: "ssn", Action: MaskPartial}).masker(maskingRequest(""), "")
+	rw := &recordingWriter{}
+	w := m.writer("SELECT * FROM people", rw)
+	require.NoError(t, w.WriteRow(map[string]interface{}{"id": 1, "ssn": "123-45-6789"}))
+	assert.Equal(t, []map[string]interface{}{{"id": 1, "ssn": "*******6789"}}, rw.rows)
+
+	// Without rules the writer is returned as it is
+	var none *masker
+	assert.Same(t, rw, none.writer("", rw))
+}
+
+func TestMaskConfigs(t *testing.T) {
+	m := newMaskingAPI(
+		MaskingRule{KeyPattern: regexp.MustCompile(`password|secret`), Action: MaskRedact},
+		MaskingRule{Column: "config_value", Action: MaskHash}, // Column rules do not apply to configs
+	).masker(maskingRequest(""), "")
+
+	result := map[string]interface{}{
+		"configs": []map[string]interface{}{
+			{"config_key": "db.password", "config_value": "hunter2", "description": "Database password"},
+			{"config_key": "feature.enabled", "config_value": "true"},
+		},
+		"approval": map[string]interface{}{"config_key": "api.secret", "config_value": "new", "previous_value": "old"},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"configs": []map[string]interface{}{
+			{"config_key": "db.password", "config_value": MaskedValue, "description": "Database password"},
+			{"config_key": "feature.enabled", "config_value": "true"},
+		},
+		"approval": map[string]interface{}{"config_key": "api.secret", "config_value": MaskedValue, "previous_value": MaskedValue},
+	}, m.configs(result))
+}
+
+func TestExecuteMasksResults(t *testing.T) {
+	api := newMaskingAPI(MaskingRule{Column: "ssn", Action: MaskRedact})
+	handler := SetupRoutes(api)
+	body := map[string]interface{}{
+		"type": "mysql", "host": "db.invalid", "port": 3306, "username": "app", "password": "secret", "database": "app",
+		"operation": "query", "query": "SELECT id, ssn FROM people", "cache_ttl_seconds": 30,
+	}
+	connection := DatabaseConnectionRequest{Type: "mysql", Host: "db.invalid", Port: 3306, Username: "app", Password: "secret", Database: "app"}
+	key, _ := queryCacheKey(connectionHash(&connection), "SELECT id, ssn FROM people", nil)
+	api.queryCache.put(key, connectionHash(&connection), []map[string]interface{}{{"id": 1, "ssn": "123-45-6789"}}, time.Minute)
+
+	data := func(headers map[string]string) []map[string]interface{} {
+		rr := serveConfigs(handler, http.MethodPost, "/v1/execute", body, headers)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response.Data
+	}
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0, "ssn": MaskedValue}}, data(nil))
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0, "ssn": "123-45-6789"}}, data(map[string]string{UserRoleHeader: AdminRole}))
+}
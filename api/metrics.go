@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors"
+	"db-connectors/events"
+)
+
+// Metrics reports counters of the running server
+type Metrics struct {
+	QueryCache QueryCacheStats           `json:"query_cache"`
+	Statements connectors.StatementStats `json:"statements"`
+	Events     *events.Stats             `json:"events,omitempty"` // Config change events, when they are published
+
+	// Latency of each phase of the requests of each operation, by operation then phase
+	Timings map[string]map[string]LatencyHistogram `json:"timings"`
+
+	// Operations running and queued on each connection, by profile name or database address
+	Concurrency map[string]ConcurrencyStats `json:"concurrency,omitempty"`
+	// Circuit breakers of the connections that failed to connect, by profile name or database address
+	Circuits map[string]BreakerStats `json:"circuits,omitempty"`
+
+	// Approval requests submitted, approved, rejected and pending on each allconfig table, by profile name or
+	// database address and then by table
+	AllConfig map[string]map[string]allconfig.TableStats `json:"allconfig,omitempty"`
+}
+
+// MetricsHandler reports the server's counters, such as the hits and misses of the query cache, the slow
+// statements, the config change events dropped, the latency percentiles of each operation, the
+// operations running and queued on each connection and the state of their circuit breakers, and the
+// maker-checker activity on each allconfig table. With format=prometheus it reports the maker-checker
+// activity in the Prometheus text format instead.
+func (a *API) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "prometheus":
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		writeAllConfigPrometheus(w, a.AllConfigStats())
+		return
+	default:
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Unsupported metrics format: %s (use json or prometheus)", format))
+		return
+	}
+	a.sendSuccess(w, Metrics{QueryCache: a.QueryCacheStats(), Statements: a.statements.Stats(), Events: a.EventStats(), Timings: a.latencies.stats(), Concurrency: a.operations.stats(), Circuits: a.breakers.stats(), AllConfig: a.AllConfigStats()}, "Metrics retrieved successfully")
+}
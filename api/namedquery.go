@@ -0,0 +1,353 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// namedQueryOperation is the /execute operation running a named query of the server configuration
+const namedQueryOperation = "named_query"
+
+// NamedQueryParamTypes lists the types a named query parameter may be declared with
+var NamedQueryParamTypes = []string{"string", "int", "float", "bool", "date", "timestamp"}
+
+// NamedQuery is a read-only SQL query that clients run by name. Its SQL refers to parameters as :name.
+type NamedQuery struct {
+	SQL         string
+	Profile     string // Connection profile the query runs on; empty for the default profile
+	Description string
+	Params      []QueryParam
+}
+
+// QueryParam declares a parameter of a named query
+type QueryParam struct {
+	Name string
+	Type string // One of NamedQueryParamTypes
+}
+
+// SetNamedQueries replaces the named queries run by /execute, checking every one of them first: each must
+// run on a SQL profile, declare the parameters its SQL uses and only read. On failure the queries in use
+// are kept.
+func (a *API) SetNamedQueries(queries map[string]NamedQuery) error {
+	var problems []string
+	for _, name := range sortedQueryNames(queries) {
+		if err := a.checkNamedQuery(queries[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("query %s: %v", name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	a.namedQueriesMu.Lock()
+	defer a.namedQueriesMu.Unlock()
+	a.namedQueries = queries
+	return nil
+}
+
+// namedQuery returns the named query
+func (a *API) namedQuery(name string) (NamedQuery, bool) {
+	a.namedQueriesMu.RLock()
+	defer a.namedQueriesMu.RUnlock()
+	q, ok := a.namedQueries[name]
+	return q, ok
+}
+
+// namedQueryNames returns the names of the named queries in sorted order
+func (a *API) namedQueryNames() []string {
+	a.namedQueriesMu.RLock()
+	defer a.namedQueriesMu.RUnlock()
+	return sortedQueryNames(a.namedQueries)
+}
+
+func sortedQueryNames(queries map[string]NamedQuery) []string {
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkNamedQuery checks a named query against the profile it runs on
+func (a *API) checkNamedQuery(q NamedQuery) error {
+	p, err := a.namedQueryProfile(q)
+	if err != nil {
+		return err
+	}
+	dbType := p.connector().GetType()
+	if _, ok := connectors.DialectFor(dbType); !ok {
+		return fmt.Errorf("profile %s is a %s connection; named queries run on SQL databases", p.Name, dbType)
+	}
+
+	declared := make(map[string]bool, len(q.Params))
+	for _, param := range q.Params {
+		if declared[param.Name] {
+			return fmt.Errorf("parameter %s is declared twice", param.Name)
+		}
+		if !slices.Contains(NamedQueryParamTypes, param.Type) {
+			return fmt.Errorf("parameter %s has invalid type %q, must be one of: %s", param.Name, param.Type, strings.Join(NamedQueryParamTypes, ", "))
+		}
+		declared[param.Name] = true
+	}
+	_, used := positionalQuery(q.SQL)
+	for _, name := range used {
+		if !declared[name] {
+			return fmt.Errorf("parameter %s is used but not declared", name)
+		}
+		delete(declared, name)
+	}
+	for _, param := range q.Params {
+		if declared[param.Name] {
+			return fmt.Errorf("parameter %s is declared but not used", param.Name)
+		}
+	}
+
+	if class, keywords := ClassifySQL(dbType, q.SQL); class != StatementRead {
+		return fmt.Errorf("named queries may only read, got %s", strings.Join(keywords, ", "))
+	}
+	return nil
+}
+
+// namedQueryProfile returns the profile a named query runs on
+func (a *API) namedQueryProfile(q NamedQuery) (*profile, error) {
+	name := q.Profile
+	if name == "" {
+		name = a.defaultProfile
+	}
+	if name == "" {
+		return nil, errors.New("no profile named and no default profile configured")
+	}
+	p, ok := a.lookupProfile(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown connection profile: %s", name)
+	}
+	return p, nil
+}
+
+// executeNamedQuery runs the named query of a named_query operation on its profile and sends the rows
+func (a *API) executeNamedQuery(w http.ResponseWriter, r *http.Request, req *DatabaseOperationRequest) {
+	if req.Name == "" {
+		a.sendRequestError(w, missingFieldsError(namedQueryOperation, []string{"name"}, false))
+		return
+	}
+	q, ok := a.namedQuery(req.Name)
+	if !ok {
+		a.sendRequestError(w, &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: fmt.Sprintf("unknown named query: %s", req.Name),
+			Details: map[string]interface{}{"name": req.Name, "available": a.namedQueryNames()},
+		})
+		return
+	}
+	args, err := bindQueryParams(q, req.Params)
+	if err != nil {
+		a.sendValidationError(w, err)
+		return
+	}
+	p, err := a.namedQueryProfile(q)
+	if err != nil {
+		a.sendError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, fmt.Sprintf("Named query %s: %v", req.Name, err))
+		return
+	}
+
+	a.onProfile(w, r, p, func(ctx context.Context, p *profile) {
+		rows, err := a.runNamedQuery(a.limitResults(ctx), p.connector(), q, args)
+		if err != nil {
+			a.sendDatabaseError(w, "Operation failed", err)
+			return
+		}
+		a.sendSuccess(w, a.masker(r, p.Name).rows(q.SQL, rows), "Operation executed successfully")
+	})
+}
+
+// runNamedQuery runs a named query with its bound arguments in a read-only transaction
+func (a *API) runNamedQuery(ctx context.Context, connector connectors.DBConnector, q NamedQuery, args []interface{}) ([]map[string]interface{}, error) {
+	sqlConnector, ok := connector.(connectors.SQLConnector)
+	if !ok || sqlConnector.DB() == nil {
+		return nil, fmt.Errorf("named queries need a SQL connection, got %s", connector.GetType())
+	}
+	query, _ := positionalQuery(q.SQL)
+	query = connectors.Bind(sqlConnector.Dialect(), query)
+
+	tx, err := sqlConnector.DB().BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows, err := tx.QueryContext(queryCtx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return a.readResult(ctx, rows, cancel)
+}
+
+// positionalQuery rewrites the :name parameters of a named query's SQL as ? bind parameters, returning the
+// parameter names in order. Quoted text and PostgreSQL :: casts are left alone.
+func positionalQuery(query string) (string, []string) {
+	var b strings.Builder
+	var names []string
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			b.WriteString("::")
+			i++
+			continue
+		case c == ':' && i+1 < len(query) && isParamStart(query[i+1]):
+			end := i + 1
+			for end < len(query) && isParamChar(query[end]) {
+				end++
+			}
+			names = append(names, query[i+1:end])
+			b.WriteByte('?')
+			i = end - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), names
+}
+
+func isParamStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isParamChar(c byte) bool {
+	return isParamStart(c) || '0' <= c && c <= '9'
+}
+
+// bindQueryParams coerces the supplied parameters to their declared types and orders them as the query's
+// SQL uses them, reporting every missing, unknown and mistyped parameter
+func bindQueryParams(q NamedQuery, params map[string]interface{}) ([]interface{}, error) {
+	var problems []string
+	values := make(map[string]interface{}, len(q.Params))
+	for _, param := range q.Params {
+		raw, ok := params[param.Name]
+		if !ok || raw == nil {
+			problems = append(problems, fmt.Sprintf("parameter %s is required", param.Name))
+			continue
+		}
+		value, err := coerceQueryParam(param.Type, raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("parameter %s %v", param.Name, err))
+			continue
+		}
+		values[param.Name] = value
+	}
+	for _, name := range sortedParamNames(params) {
+		if !slices.ContainsFunc(q.Params, func(p QueryParam) bool { return p.Name == name }) {
+			problems = append(problems, fmt.Sprintf("parameter %s is not declared by the query", name))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &connectors.ValidationError{Problems: problems}
+	}
+
+	_, names := positionalQuery(q.SQL)
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = values[name]
+	}
+	return args, nil
+}
+
+func sortedParamNames(params map[string]interface{}) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// coerceQueryParam converts a JSON value to a parameter type. Numbers and booleans may also be sent as
+// strings, dates as YYYY-MM-DD and timestamps as RFC 3339.
+func coerceQueryParam(paramType string, raw interface{}) (interface{}, error) {
+	switch paramType {
+	case "string":
+		if s, ok := raw.(string); ok {
+			return s, nil
+		}
+		return nil, errors.New("must be a string")
+	case "int":
+		switch v := raw.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+				return int64(v), nil
+			}
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				return n, nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, errors.New("must be an integer")
+	case "float":
+		switch v := raw.(type) {
+		case float64:
+			return v, nil
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				return f, nil
+			}
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, errors.New("must be a number")
+	case "bool":
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, errors.New("must be a boolean")
+	case "date":
+		if s, ok := raw.(string); ok {
+			if t, err := time.Parse(time.DateOnly, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, errors.New("must be a date (YYYY-MM-DD)")
+	case "timestamp":
+		if s, ok := raw.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return nil, errors.New("must be an RFC 3339 timestamp")
+	}
+	return nil, fmt.Errorf("has unknown type %s", paramType)
+}
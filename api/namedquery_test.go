@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// activeUsers is a named query taking a date and a minimum login count
+var activeUsers = NamedQuery{
+	SQL:    "SELECT user_id, CAST(last_login AS date)::text AS day FROM logins WHERE CAST(last_login AS date) = :day AND logins >= :min_logins AND note <> ':day'",
+	Params: []QueryParam{{Name: "day", Type: "date"}, {Name: "min_logins", Type: "int"}},
+}
+
+func TestPositionalQuery(t *testing.T) {
+	query, names := positionalQuery(activeUsers.SQL)
+	assert.Equal(t, "SELECT user_id, CAST(last_login AS date)::text AS day FROM logins WHERE CAST(last_login AS date) = ? AND logins >= ? AND note <> ':day'", query)
+	assert.Equal(t, []string{"day", "min_logins"}, names)
+
+	// A parameter used twice is bound twice
+	query, names = positionalQuery("SELECT * FROM t WHERE a = :v OR b = :v")
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? OR b = ?", query)
+	assert.Equal(t, []string{"v", "v"}, names)
+}
+
+func TestCoerceQueryParam(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		paramType string
+		raw       interface{}
+		want      interface{}
+		err       string
+	}{
+		{paramType: "string", raw: "alice", want: "alice"},
+		{paramType: "string", raw: 1.0, err: "must be a string"},
+		{paramType: "int", raw: 42.0, want: int64(42)},
+		{paramType: "int", raw: "42", want: int64(42)},
+		{paramType: "int", raw: 4.5, err: "must be an integer"},
+		{paramType: "int", raw: true, err: "must be an integer"},
+		{paramType: "float", raw: 4.5, want: 4.5},
+		{paramType: "float", raw: "4.5", want: 4.5},
+		{paramType: "float", raw: "many", err: "must be a number"},
+		{paramType: "bool", raw: true, want: true},
+		{paramType: "bool", raw: "false", want: false},
+		{paramType: "bool", raw: 1.0, err: "must be a boolean"},
+		{paramType: "date", raw: "2024-05-01", want: day},
+		{paramType: "date", raw: "01/05/2024", err: "must be a date (YYYY-MM-DD)"},
+		{paramType: "timestamp", raw: "2024-05-01T02:00:00+02:00", want: day},
+		{paramType: "timestamp", raw: "2024-05-01", err: "must be an RFC 3339 timestamp"},
+	}
+	for _, tt := range tests {
+		got, err := coerceQueryParam(tt.paramType, tt.raw)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, "%s %v", tt.paramType, tt.raw)
+			continue
+		}
+		require.NoError(t, err, "%s %v", tt.paramType, tt.raw)
+		assert.Equal(t, tt.want, got, "%s %v", tt.paramType, tt.raw)
+	}
+}
+
+func TestBindQueryParams(t *testing.T) {
+	args, err := bindQueryParams(activeUsers, map[string]interface{}{"min_logins": "3", "day": "2024-05-01"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), int64(3)}, args)
+
+	_, err = bindQueryParams(activeUsers, map[string]interface{}{"day": "yesterday", "limit": 10.0})
+	assert.EqualError(t, err, "parameter day must be a date (YYYY-MM-DD); parameter min_logins is required; parameter limit is not declared by the query")
+}
+
+func TestSetNamedQueries(t *testing.T) {
+	api := NewAPI()
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: newProfileConnector("postgresql")})
+	api.addProfile(ConnectionProfile{Name: "documents", Connector: newProfileConnector("mongodb")})
+	api.defaultProfile = "primary"
+
+	require.NoError(t, api.SetNamedQueries(map[string]NamedQuery{"active_users": activeUsers}))
+	assert.Equal(t, []string{"active_users"}, api.namedQueryNames())
+
+	tests := map[string]NamedQuery{
+		"unknown profile": {SQL: "SELECT 1", Profile: "missing"},
+		"mongodb profile": {SQL: "SELECT 1", Profile: "documents"},
+		"undeclared":      {SQL: "SELECT * FROM t WHERE a = :a"},
+		"unused":          {SQL: "SELECT 1", Params: []QueryParam{{Name: "a", Type: "string"}}},
+		"duplicate":       {SQL: "SELECT :a", Params: []QueryParam{{Name: "a", Type: "string"}, {Name: "a", Type: "int"}}},
+		"bad type":        {SQL: "SELECT :a", Params: []QueryParam{{Name: "a", Type: "uuid"}}},
+		"write":           {SQL: "DELETE FROM t"},
+	}
+	want := map[string]string{
+		"unknown profile": "query unknown profile: unknown connection profile: missing",
+		"mongodb profile": "query mongodb profile: profile documents is a mongodb connection; named queries run on SQL databases",
+		"undeclared":      "query undeclared: parameter a is used but not declared",
+		"unused":          "query unused: parameter a is declared but not used",
+		"duplicate":       "query duplicate: parameter a is declared twice",
+		"bad type":        `query bad type: parameter a has invalid type "uuid", must be one of: string, int, float, bool, date, timestamp`,
+		"write":           "query write: named queries may only read, got DELETE",
+	}
+	for name, q := range tests {
+		assert.EqualError(t, api.SetNamedQueries(map[string]NamedQuery{name: q}), want[name])
+	}
+	// Failed loads keep the queries in use
+	assert.Equal(t, []string{"active_users"}, api.namedQueryNames())
+}
+
+func TestNamedQueryHandler(t *testing.T) {
+	connector, mockDB := newSQLMockConnector(t, "postgresql")
+	connector.On("IsConnected").Return(true)
+	api := NewAPI()
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: connector})
+	api.defaultProfile = "primary"
+	require.NoError(t, api.SetNamedQueries(map[string]NamedQuery{"active_users": activeUsers}))
+	handler := SetupRoutes(api)
+
+	mockDB.ExpectBegin()
+	mockDB.ExpectQuery(`CAST\(last_login AS date\) = \$1 AND logins >= \$2 AND note <> ':day'`).
+		WithArgs(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "day"}).AddRow(int64(7), "2024-05-01"))
+	mockDB.ExpectRollback()
+
+	rr := serveConfigs(handler, http.MethodPost, "/v1/execute", map[string]interface{}{
+		"operation": "named_query",
+		"name":      "active_users",
+		"params":    map[string]interface{}{"day": "2024-05-01", "min_logins": 3},
+	}, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, []map[string]interface{}{{"user_id": 7.0, "day": "2024-05-01"}}, response.Data)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+
+	// Unknown names and bad parameters are rejected before touching the database
+	rr = serveConfigs(handler, http.MethodPost, "/v1/execute", map[string]interface{}{"operation": "named_query", "name": "missing"}, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"error":"unknown named query: missing"`)
+	assert.Contains(t, rr.Body.String(), `"available":["active_users"]`)
+
+	rr = serveConfigs(handler, http.MethodPost, "/v1/execute", map[string]interface{}{
+		"operation": "named_query",
+		"name":      "active_users",
+		"params":    map[string]interface{}{"day": 20240501},
+	}, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"errors":["parameter day must be a date (YYYY-MM-DD)","parameter min_logins is required"]`)
+
+	rr = serveConfigs(handler, http.MethodPost, "/v1/execute", map[string]interface{}{"operation": "named_query"}, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "name is required for named_query operation")
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+}
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+	"db-connectors/jobs"
+)
+
+// operationDoc describes one route in the generated OpenAPI specification
+type operationDoc struct {
+	ID           string
+	Tag          string
+	Summary      string
+	Description  string
+	Params       []paramDoc     // Query and header parameters; path parameters are taken from the pattern
+	Body         interface{}    // Value of the JSON request body type; nil when there is no body
+	OptionalBody bool           // The request body may be omitted
+	Data         interface{}    // Value of the DatabaseResponse data type on success; nil leaves it untyped
+	Success      int            // Success status, defaults to 200
+	Content      []string       // Non-JSON success content types
+	Responses    map[int]string // Further statuses and their descriptions
+}
+
+// paramDoc describes a query or header parameter
+type paramDoc struct {
+	Name        string
+	In          string // query or header
+	Type        string // Defaults to string
+	Description string
+	Enum        []string
+}
+
+// openAPITags lists the tags in display order
+var openAPITags = []map[string]string{
+	{"name": "Health", "description": "Liveness and readiness checks"},
+	{"name": "Database Connection", "description": "Database connection testing"},
+	{"name": "Database Operations", "description": "SQL statements, MongoDB operations and schema introspection"},
+	{"name": "Jobs", "description": "Asynchronous operations with downloadable results"},
+	{"name": "Connections", "description": "State and health of the configured connection profiles"},
+	{"name": "AllConfig Management", "description": "Configuration table management"},
+	{"name": "Maker-Checker Workflow", "description": "Configuration approval workflow"},
+	{"name": "Config Resources", "description": "RESTful configs and approvals on a configured connection profile"},
+}
+
+// schemaEnums holds the allowed values of string fields, keyed by schema name and JSON field name
+var schemaEnums = map[string][]string{
+	"DatabaseConnectionRequest.ssl_mode":     connectors.PostgreSQLSSLModes,
+	"DatabaseOperationRequest.operation":     append(executeOperations[:len(executeOperations):len(executeOperations)], namedQueryOperation),
+	"DatabaseOperationRequest.result_format": resultFormats,
+	"BatchStatement.operation":               sqlOperations,
+	"AllConfigOperationRequest.operation":    allConfigOperations,
+	"JobsStatus.state": {
+		string(jobs.StateQueued), string(jobs.StateRunning), string(jobs.StateSucceeded),
+		string(jobs.StateFailed), string(jobs.StateCancelled),
+	},
+	"DatabaseStatus.status":       {"up", "down"},
+	"DatabaseResponse.error_code": errorCodes(),
+}
+
+// schemaDescriptions describes fields whose meaning is not clear from their name, keyed like schemaEnums
+var schemaDescriptions = map[string]string{
+	"DatabaseResponse.error_code": errorCodeDescription(),
+	"DatabaseResponse.details":    "Structured context of the failure, such as the problems of a validation error or the supported operations",
+	"DatabaseConnectionRequest.schema": "PostgreSQL schema set as the search_path of the session, where allconfig tables are " +
+		"looked up (public when left out). On MySQL the schema, a database, that schema operations and allconfig lookups look in; " +
+		"on MongoDB the database schema operations look in. allconfig statements qualify their SQL tables with it, " +
+		"defaulting to the server's allconfig schema",
+	"DatabaseConnectionRequest.uri": "Connection URI or DSN passed to the driver as it is instead of host, port, username, password, " +
+		"database and ssl_mode: a MySQL DSN, a postgres:// URL or key=value string, or a mongodb:// or mongodb+srv:// URI",
+	"DatabaseConnectionRequest.label": "Name of the connection, attached as its connection label to the connector's log lines, " +
+		"the statement metrics when connection is a metric label, and the config change events written through it",
+	"DatabaseOperationRequest.use_database": "Database of the server a MySQL operation runs in, as after USE; other databases reject it",
+	"DatabaseOperationRequest.name": "Named query of the server configuration run by the named_query operation, which takes its " +
+		"parameters in params and runs on the query's connection profile, so the connection fields are not needed",
+	"DatabaseOperationRequest.analyze": "Make explain run the statement and report actual costs: EXPLAIN ANALYZE on PostgreSQL and " +
+		"executionStats verbosity on MongoDB. MySQL cannot report EXPLAIN ANALYZE as JSON and rejects it",
+	"DatabaseOperationRequest.allow_writes": "Let explain accept statements that write, which analyze executes",
+	"DatabaseOperationRequest.cache_ttl_seconds": "Serve the result of a read query or select from the query cache while younger than this, " +
+		"keyed by the connection, the SQL with its whitespace collapsed and the args. Writes through the API drop the connection's cached results",
+	"DatabaseOperationRequest.include_columns": "Make a query or select respond with data holding columns, each with its name, database type, " +
+		"nullability and scan type, and rows, objects with their keys in column order. The columns are there even when no row is",
+	"DatabaseOperationRequest.result_format": "Shape of the rows of a query or select: objects keyed by column name, or tabular arrays of " +
+		"values in column order, which implies include_columns and is smaller on the wire",
+	"DatabaseOperationRequest.returning": "Make an insert, update, delete or execute respond with rows_affected and what it wrote: the " +
+		"rows of its RETURNING clause, which PostgreSQL requires, or the last_insert_id of a MySQL insert",
+	"DatabaseResponse.cached": "The data was served from the query cache, cache_age_ms ago",
+	"DatabaseConnectionRequest.include_timings": "Respond with timings_ms, the milliseconds the request spent connecting, waiting, " +
+		"executing and serializing, which add up to its total",
+	"DatabaseResponse.timings_ms": "Time each phase of the request took, when it set include_timings. database is the part of execute " +
+		"the connector spent running statements",
+	"AllConfigOperationRequest.dry_run": "Run the checks and lookups but no write, responding with each statement or command and the rows or " +
+		"documents it would affect. Supported by " + strings.Join(dryRunOperations, ", "),
+	"AllConfigOperationRequest.concurrency": fmt.Sprintf("Number of items of a batch operation run at once, from 1 (the default) to %d", maxConfigBatchConcurrency),
+	"AllConfigOperationRequest.continue_on_error": "Keep running the items of a batch operation after one fails (the default); when false the " +
+		"remaining items are skipped and their keys returned in resume_token",
+	"AllConfigOperationRequest.atomic": "Run a batch operation in one transaction that the first failure rolls back (MySQL and PostgreSQL only)",
+	"AllConfigOperationRequest.upsert": "Create or overwrite the configs of direct_create_batch with one multi-row upsert statement " +
+		"(MySQL, PostgreSQL) or bulkWrite (MongoDB) per chunk; each key may appear once",
+	"AllConfigOperationRequest.chunk_size": fmt.Sprintf("Items per upsert statement or bulkWrite, %d by default; SQL chunks are capped "+
+		"to stay within the bind parameter limit. prune_history deletes %d approval requests at a time by default", defaultUpsertChunkSize, DefaultPruneChunkSize),
+	"AllConfigOperationRequest.confirm": "The table_name, required by drop_table, direct_delete_all and truncate_approvals so that a " +
+		"request aimed at the wrong table removes nothing",
+	"AllConfigOperationRequest.operation": operationAliases(allConfigOperationSpecs),
+	"DatabaseResponse.deprecation":        "Set when the request named its operation by a deprecated alias, naming the canonical operation to use instead",
+	"AllConfigOperationRequest.case_insensitive": "Look keys up regardless of case, working on the stored key a key matches; " +
+		"overrides the case_insensitive_keys setting",
+}
+
+// registeredEnums holds enums read when the specification is built, such as the database types
+// of drivers registered by the program after package initialization
+var registeredEnums = map[string]func() []string{
+	"DatabaseConnectionRequest.type": connectors.Drivers,
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// specBuilder collects the component schemas referenced while building the specification
+type specBuilder struct {
+	schemas map[string]interface{}
+}
+
+// OpenAPISpec builds the OpenAPI 3 document for the versioned API from the route table and Go types
+func (s *Server) OpenAPISpec() map[string]interface{} {
+	b := &specBuilder{schemas: make(map[string]interface{})}
+	b.schema(reflect.TypeOf(DatabaseResponse{}))
+
+	paths := make(map[string]interface{})
+	for _, route := range s.apiRoutes() {
+		item, ok := paths[route.pattern].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[route.pattern] = item
+		}
+		item[strings.ToLower(route.method)] = b.operation(route)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Database Connectors API",
+			"description": "Connect to MySQL, PostgreSQL and MongoDB and manage configurations with a maker-checker workflow. Generated from the server's routes and request types.",
+			"version":     "1.0.0",
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": "/v1", "description": "This server"},
+		},
+		"tags":       openAPITags,
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": b.schemas},
+	}
+}
+
+// operation builds the OpenAPI operation object of a route
+func (b *specBuilder) operation(route apiRoute) map[string]interface{} {
+	doc := route.doc
+	op := map[string]interface{}{
+		"operationId": doc.ID,
+		"tags":        []string{doc.Tag},
+		"summary":     doc.Summary,
+	}
+	if doc.Description != "" {
+		op["description"] = doc.Description
+	}
+
+	var params []interface{}
+	for _, segment := range splitPath(route.pattern) {
+		if name, ok := wildcardName(segment); ok {
+			params = append(params, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, p := range doc.Params {
+		schema := map[string]interface{}{"type": "string"}
+		if p.Type != "" {
+			schema["type"] = p.Type
+		}
+		if p.Enum != nil {
+			schema["enum"] = p.Enum
+		}
+		params = append(params, map[string]interface{}{
+			"name":        p.Name,
+			"in":          p.In,
+			"description": p.Description,
+			"schema":      schema,
+		})
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+
+	if doc.Body != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": !doc.OptionalBody,
+			"content":  jsonContent(b.schema(reflect.TypeOf(doc.Body))),
+		}
+	}
+
+	success := doc.Success
+	if success == 0 {
+		success = 200
+	}
+	responses := map[string]interface{}{
+		strconv.Itoa(success): b.successResponse(doc, "Success"),
+	}
+	for status, description := range doc.Responses {
+		if status < 300 {
+			responses[strconv.Itoa(status)] = b.successResponse(doc, description)
+			continue
+		}
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": description,
+			"content":     jsonContent(schemaRef("DatabaseResponse")),
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// successResponse describes a successful response: the DatabaseResponse envelope with typed data,
+// or the raw content types of non-JSON downloads
+func (b *specBuilder) successResponse(doc operationDoc, description string) map[string]interface{} {
+	if doc.Content != nil {
+		content := make(map[string]interface{}, len(doc.Content))
+		for _, contentType := range doc.Content {
+			content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		return map[string]interface{}{"description": description, "content": content}
+	}
+
+	schema := schemaRef("DatabaseResponse")
+	if doc.Data != nil {
+		schema = map[string]interface{}{
+			"allOf": []interface{}{
+				schemaRef("DatabaseResponse"),
+				map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"data": b.schema(reflect.TypeOf(doc.Data))},
+				},
+			},
+		}
+	}
+	return map[string]interface{}{"description": description, "content": jsonContent(schema)}
+}
+
+// schema returns the JSON schema of t, registering named structs as components
+func (b *specBuilder) schema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Interface:
+		return map[string]interface{}{} // Any JSON value
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = nil // Reserve the name so recursive types terminate
+			b.schemas[name] = b.structSchema(t, name)
+		}
+		return schemaRef(name)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema builds the object schema of a struct; embedded structs become allOf references
+// and fields with a `validate:"required"` tag are required
+func (b *specBuilder) structSchema(t reflect.Type, name string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	var embedded []interface{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+		if field.Anonymous && jsonName == "" && field.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, b.schema(field.Type))
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+
+		schema := b.schema(field.Type)
+		if enum, ok := schemaEnums[name+"."+jsonName]; ok {
+			schema["enum"] = enum
+		} else if enum, ok := registeredEnums[name+"."+jsonName]; ok {
+			schema["enum"] = enum()
+		}
+		if description, ok := schemaDescriptions[name+"."+jsonName]; ok {
+			schema["description"] = description
+		}
+		properties[jsonName] = schema
+		if strings.Contains(field.Tag.Get("validate"), "required") {
+			required = append(required, jsonName)
+		}
+	}
+
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if required != nil {
+		object["required"] = required
+	}
+	if embedded == nil {
+		return object
+	}
+	return map[string]interface{}{"allOf": append(embedded, object)}
+}
+
+// schemaName names the component of a struct; types outside this package are prefixed with their package
+func schemaName(t reflect.Type) string {
+	if t.PkgPath() == reflect.TypeOf(API{}).PkgPath() {
+		return t.Name()
+	}
+	pkg := path.Base(t.PkgPath())
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIDocument is the part of the specification checked by the tests
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+func fetchSpec(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	SetupRoutes(NewAPI()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	return rr
+}
+
+func TestOpenAPISpecCoversRegisteredRoutes(t *testing.T) {
+	rr := fetchSpec(t, "/swagger.json")
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var spec openAPIDocument
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+
+	versioned := 0
+	for _, route := range (&Server{api: NewAPI()}).router().routes {
+		if len(route.segments) == 0 || route.segments[0] != "v1" {
+			continue
+		}
+		versioned++
+		path := "/" + strings.Join(route.segments[1:], "/")
+		require.Contains(t, spec.Paths, path)
+		assert.Contains(t, spec.Paths[path], strings.ToLower(route.method), "%s %s", route.method, path)
+	}
+	assert.Greater(t, versioned, 10)
+}
+
+func TestOpenAPISpecReferencesResolve(t *testing.T) {
+	rr := fetchSpec(t, "/swagger.json")
+	var spec openAPIDocument
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+
+	for _, ref := range strings.Split(rr.Body.String(), `"$ref": "#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		assert.Contains(t, spec.Components.Schemas, name)
+	}
+	for _, name := range []string{"DatabaseResponse", "DatabaseOperationRequest", "AllConfigOperationRequest", "BatchRequest", "JobsStatus", "ReadinessReport"} {
+		assert.Contains(t, spec.Components.Schemas, name)
+	}
+}
+
+func TestOpenAPISpecSchemas(t *testing.T) {
+	spec := (&Server{api: NewAPI()}).OpenAPISpec()
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	connection := schemas["DatabaseConnectionRequest"].(map[string]interface{})
+	assert.Equal(t, []string{"type", "host", "port", "database"}, connection["required"])
+	properties := connection["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "integer"}, properties["port"])
+	assert.Subset(t, properties["type"].(map[string]interface{})["enum"], []string{"mysql", "postgresql", "mongodb", fakeDriver})
+
+	// Embedded request types reference the connection fields instead of repeating them
+	operation := schemas["AllConfigOperationRequest"].(map[string]interface{})["allOf"].([]interface{})
+	assert.Equal(t, schemaRef("AllConfigRequest"), operation[0])
+	fields := operation[1].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, allConfigOperations, fields["operation"].(map[string]interface{})["enum"])
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": schemaRef("ConfigItem")}, fields["config_items"])
+	assert.Contains(t, fields["dry_run"].(map[string]interface{})["description"], "direct_delete_all")
+	assert.Contains(t, fields["concurrency"].(map[string]interface{})["description"], "to 32")
+
+	response := schemas["DatabaseResponse"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "date-time"}, response["timestamp"])
+	errorCode := response["error_code"].(map[string]interface{})
+	assert.Equal(t, errorCodes(), errorCode["enum"])
+	assert.Contains(t, errorCode["description"], "RATE_LIMITED (429)")
+}
+
+func TestOpenAPISpecYAML(t *testing.T) {
+	rr := fetchSpec(t, "/swagger.yaml")
+	assert.Equal(t, "application/yaml", rr.Header().Get("Content-Type"))
+
+	var spec map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(rr.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	assert.Contains(t, spec["paths"], "/configs/{key}")
+}
+
+// TestDocumentedOperationsAreSupported checks that the operation enums only list operations the handlers accept
+func TestDocumentedOperationsAreSupported(t *testing.T) {
+	api := NewAPI()
+	conn := new(connectortest.MockDBConnector)
+	conn.On("GetType").Return("mysql")
+	conn.On("Query", mock.Anything, mock.Anything, mock.Anything).Return((*sql.Rows)(nil), errors.New("query failed"))
+	conn.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("execute failed"))
+
+	for _, operation := range allConfigOperations {
+		req := &AllConfigOperationRequest{Operation: operation}
+		req.TableName = "allconfig"
+		_, err := api.executeAllConfigOperation(context.Background(), conn, req)
+		if err != nil {
+			_, code := classifyDatabaseError(err)
+			assert.NotEqual(t, ErrorCodeUnsupportedOperation, code, operation)
+		}
+	}
+
+	for _, operation := range sqlOperations {
+		_, err := api.executeSQLOperation(context.Background(), conn, &DatabaseOperationRequest{Operation: operation, Query: "SELECT 1"})
+		require.Error(t, err)
+		_, code := classifyDatabaseError(err)
+		assert.NotEqual(t, ErrorCodeUnsupportedOperation, code, operation)
+	}
+
+	_, err := api.executeSQLOperation(context.Background(), conn, &DatabaseOperationRequest{Operation: "upsert", Query: "SELECT 1"})
+	_, code := classifyDatabaseError(err)
+	assert.Equal(t, ErrorCodeUnsupportedOperation, code)
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// operationSpec describes an operation accepted by /execute, /execute-batch or /allconfig-operation
+type operationSpec struct {
+	Name     string
+	Aliases  []string // Other names accepted for the operation
+	Required []string // JSON fields of the request that must be set; params.<key> names a MongoDB parameter
+	AnyOf    []string // JSON fields of which at least one must be set
+	Types    []string // Database types supporting the operation; empty for every type
+	Mutates  bool     // Whether the operation writes data or changes the schema
+	DryRun   bool     // Whether dry_run previews the operation instead of executing it
+	Batch    bool     // Whether the operation runs config items as a batch taking concurrency, continue_on_error and atomic
+
+	CreatesKeys bool // Whether the operation can create configs, whose keys must satisfy the key policy
+	Confirms    bool // Whether the operation clears or drops a table, which the request must name in confirm
+}
+
+// builtinTypes are the database types whose operations are all registered; registered custom drivers
+// receive operations the registry does not know as they are
+var builtinTypes = []string{"mysql", "postgresql", "mongodb"}
+
+var (
+	sqlTypes   = []string{"mysql", "postgresql"}
+	mongoTypes = []string{"mongodb"}
+)
+
+// sqlOperationSpecs registers the SQL operations of /execute and /execute-batch
+var sqlOperationSpecs = []operationSpec{
+	{Name: "query", Aliases: []string{"select"}, Required: []string{"query"}, Types: sqlTypes},
+	{Name: "insert", Required: []string{"query"}, Types: sqlTypes, Mutates: true},
+	{Name: "update", Required: []string{"query"}, Types: sqlTypes, Mutates: true},
+	{Name: "delete", Required: []string{"query"}, Types: sqlTypes, Mutates: true},
+	{Name: "execute", Required: []string{"query"}, Types: sqlTypes, Mutates: true},
+}
+
+// callOperationSpecs registers the stored routine calls of /execute: a MySQL statement such as CALL proc(?),
+// or a PostgreSQL procedure or function called by name
+var callOperationSpecs = []operationSpec{
+	{Name: "call", Required: []string{"query"}, Types: []string{"mysql"}, Mutates: true},
+	{Name: "call", Required: []string{"params.routine"}, Types: []string{"postgresql"}, Mutates: true},
+}
+
+// mongoOperationSpecs registers the MongoDB operations of /execute and /execute-batch
+var mongoOperationSpecs = []operationSpec{
+	{Name: "find", Required: []string{"params.collection"}, Types: mongoTypes},
+	{Name: "findOne", Required: []string{"params.collection"}, Types: mongoTypes},
+	{Name: "insert", Required: []string{"params.collection", "params.document"}, Types: mongoTypes, Mutates: true},
+	{Name: "insertMany", Required: []string{"params.collection", "params.documents"}, Types: mongoTypes, Mutates: true},
+	{Name: "update", Required: []string{"params.collection", "params.filter", "params.update"}, Types: mongoTypes, Mutates: true},
+	{Name: "updateMany", Required: []string{"params.collection", "params.filter", "params.update"}, Types: mongoTypes, Mutates: true},
+	{Name: "upsert", Required: []string{"params.collection", "params.filter", "params.update"}, Types: mongoTypes, Mutates: true},
+	{Name: "delete", Required: []string{"params.collection", "params.filter"}, Types: mongoTypes, Mutates: true},
+	{Name: "deleteMany", Required: []string{"params.collection", "params.filter"}, Types: mongoTypes, Mutates: true},
+	{Name: "bulkWrite", Required: []string{"params.collection", "params.operations"}, Types: mongoTypes, Mutates: true},
+	{Name: "count", Required: []string{"params.collection"}, Types: mongoTypes},
+	{Name: "listCollections", Types: mongoTypes},
+	{Name: "listDatabases", Types: mongoTypes},
+	{Name: "listIndexes", Required: []string{"params.collection"}, Types: mongoTypes},
+	{Name: "createIndex", Required: []string{"params.collection", "params.index"}, Types: mongoTypes, Mutates: true},
+}
+
+// schemaOperationSpecs registers the schema introspection operations shared by all database types
+var schemaOperationSpecs = []operationSpec{
+	{Name: "list_tables"},
+	{Name: "describe_table", Required: []string{"table"}},
+	{Name: "list_indexes", Required: []string{"table"}},
+	{Name: "list_databases"},
+}
+
+// explainOperationSpecs registers the query plan operation of /execute
+var explainOperationSpecs = []operationSpec{
+	{Name: explainOperation, Required: []string{"query"}, Types: sqlTypes},
+	{Name: explainOperation, Required: []string{"params.collection"}, Types: mongoTypes},
+}
+
+// executeOperationSpecs registers every operation of /execute and /jobs
+var executeOperationSpecs = concatSpecs(sqlOperationSpecs, callOperationSpecs, mongoOperationSpecs, schemaOperationSpecs, explainOperationSpecs)
+
+// batchOperationSpecs registers the operations of /execute-batch statements
+var batchOperationSpecs = concatSpecs(sqlOperationSpecs, mongoOperationSpecs)
+
+// allConfigOperationSpecs registers the operations of /allconfig-operation
+var allConfigOperationSpecs = []operationSpec{
+	// Table management
+	{Name: "create_table", Mutates: true},
+	{Name: "drop_table", Mutates: true, DryRun: true, Confirms: true},
+	{Name: "migrate_table", Mutates: true},
+
+	// Maker-checker workflow
+	{Name: "submit_create", Required: []string{"key", "maker_id"}, Mutates: true, DryRun: true, CreatesKeys: true},
+	{Name: "submit_update", Required: []string{"key", "maker_id"}, Mutates: true, DryRun: true},
+	{Name: "submit_delete", Required: []string{"key", "maker_id"}, Mutates: true, DryRun: true},
+	{Name: "approve_request", Required: []string{"request_id", "checker_id"}, Mutates: true},
+	{Name: "reject_request", Required: []string{"request_id", "checker_id"}, Mutates: true},
+	{Name: "get_pending_approvals"},
+	{Name: "get_pending_with_current"},
+	{Name: "get_my_requests", Required: []string{"maker_id"}},
+	{Name: "get_approval_history"},
+	{Name: "truncate_approvals", Mutates: true, DryRun: true, Confirms: true},
+	{Name: "prune_history", Required: []string{"older_than"}, Mutates: true},
+	{Name: "expire_configs", Mutates: true},
+	{Name: "get_operation", Required: []string{"operation_id"}},
+
+	// Direct writes bypassing approval, for admin use
+	{Name: "direct_create", Aliases: []string{"create", "set_config"}, Required: []string{"key"}, Mutates: true, DryRun: true, CreatesKeys: true},
+	{Name: "direct_create_batch", Aliases: []string{"create_batch", "set_multiple"}, AnyOf: []string{"config_items", "configs"}, Mutates: true, DryRun: true, Batch: true, CreatesKeys: true},
+	{Name: "import", Required: []string{"config_items"}, Types: sqlTypes, Mutates: true, CreatesKeys: true},
+
+	// Reads of approved configs, and of all configs for admins
+	{Name: "read", Aliases: []string{"get_config"}, Required: []string{"key"}},
+	{Name: "read_all", Aliases: []string{"get_all"}},
+	{Name: "search", Required: []string{"search_term"}},
+	{Name: "filter", AnyOf: []string{"filter", "tags_any", "tags_all"}},
+	{Name: "read_all_admin"},
+	{Name: "search_admin", Required: []string{"search_term"}},
+
+	{Name: "direct_update", Aliases: []string{"update"}, Required: []string{"key"}, Mutates: true, DryRun: true},
+	{Name: "direct_update_batch", Aliases: []string{"update_batch"}, Required: []string{"config_items"}, Mutates: true, DryRun: true, Batch: true},
+	{Name: "direct_delete", Aliases: []string{"delete", "delete_config"}, Required: []string{"key"}, Mutates: true, DryRun: true},
+	{Name: "direct_delete_batch", Aliases: []string{"delete_batch"}, Required: []string{"config_items"}, Mutates: true, DryRun: true, Batch: true},
+	{Name: "direct_delete_all", Aliases: []string{"delete_all"}, Mutates: true, DryRun: true, Confirms: true},
+
+	// Utilities
+	{Name: "count"},
+	{Name: "count_admin"},
+	{Name: "count_pending"},
+	{Name: "exists", Required: []string{"key"}},
+}
+
+// Operation names and aliases listed by the OpenAPI enums and unsupported-operation errors
+var (
+	sqlOperations       = operationNames(sqlOperationSpecs, "")
+	executeOperations   = operationNames(executeOperationSpecs, "")
+	allConfigOperations = operationNames(allConfigOperationSpecs, "")
+	dryRunOperations    = dryRunOperationNames(allConfigOperationSpecs)
+)
+
+func concatSpecs(groups ...[]operationSpec) []operationSpec {
+	var specs []operationSpec
+	for _, group := range groups {
+		specs = append(specs, group...)
+	}
+	return specs
+}
+
+// accepts reports whether the spec registers the name for the database type; an empty type matches every spec
+func (s *operationSpec) accepts(name, dbType string) bool {
+	if !s.supports(dbType) {
+		return false
+	}
+	if s.Name == name {
+		return true
+	}
+	for _, alias := range s.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// supports reports whether the database type supports the operation; an empty type is supported
+func (s *operationSpec) supports(dbType string) bool {
+	if len(s.Types) == 0 || dbType == "" {
+		return true
+	}
+	for _, t := range s.Types {
+		if t == dbType {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupOperation returns the spec registering the operation or alias for the database type, or nil
+func lookupOperation(specs []operationSpec, operation, dbType string) *operationSpec {
+	for i := range specs {
+		if specs[i].accepts(operation, dbType) {
+			return &specs[i]
+		}
+	}
+	return nil
+}
+
+// operationNames lists the names and aliases of the operations the database type supports in registry
+// order without duplicates; an empty type lists every operation
+func operationNames(specs []operationSpec, dbType string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		if !spec.supports(dbType) {
+			continue
+		}
+		for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// checkOperation returns the spec of the operation after checking that the database type supports it and
+// that its required fields are set in req, a request struct, or params
+func checkOperation(specs []operationSpec, operation, dbType string, req interface{}, params map[string]interface{}) (*operationSpec, error) {
+	spec := lookupOperation(specs, operation, dbType)
+	if spec == nil {
+		return nil, unsupportedOperationError(operation, operationNames(specs, dbType))
+	}
+
+	var missing []string
+	for _, field := range spec.Required {
+		if !fieldSet(req, params, field) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, missingFieldsError(operation, missing, false)
+	}
+
+	if len(spec.AnyOf) > 0 {
+		for _, field := range spec.AnyOf {
+			if fieldSet(req, params, field) {
+				return spec, nil
+			}
+		}
+		return nil, missingFieldsError(operation, spec.AnyOf, true)
+	}
+	return spec, nil
+}
+
+// dryRunOperationNames lists the names and aliases of the operations supporting dry_run
+func dryRunOperationNames(specs []operationSpec) []string {
+	var dryRunSpecs []operationSpec
+	for _, spec := range specs {
+		if spec.DryRun {
+			dryRunSpecs = append(dryRunSpecs, spec)
+		}
+	}
+	return operationNames(dryRunSpecs, "")
+}
+
+// checkAllConfigOperation checks an /allconfig-operation request against the registry, rejecting dry_run
+// for operations that cannot be previewed rather than running them for real, and batch options the
+// operation cannot honour
+func checkAllConfigOperation(req *AllConfigOperationRequest, dbType string) (*operationSpec, error) {
+	spec, err := checkOperation(allConfigOperationSpecs, req.Operation, dbType, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.DryRun && !spec.DryRun {
+		return nil, &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeUnsupportedOperation,
+			Message: fmt.Sprintf("dry_run is not supported for %s operation. Supported operations: %s", req.Operation, strings.Join(dryRunOperations, ", ")),
+			Details: map[string]interface{}{"operation": req.Operation, "supported": dryRunOperations},
+		}
+	}
+	if err := checkConfigBatchOptions(req, spec, dbType); err != nil {
+		return nil, err
+	}
+	if err := checkStatusFilter(req); err != nil {
+		return nil, err
+	}
+	if err := checkFallback(req, spec); err != nil {
+		return nil, err
+	}
+	if err := checkExpectedType(req, spec); err != nil {
+		return nil, err
+	}
+	if err := checkConfirm(req, spec); err != nil {
+		return nil, err
+	}
+	if err := checkPruneHistory(req, spec); err != nil {
+		return nil, err
+	}
+	if err := checkExpiry(req, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// ValidateOperation checks an /execute operation against the operation registry, so a misspelled operation
+// or missing field fails before connecting. Operations of registered custom drivers the registry does not
+// know are left for the driver to check.
+func ValidateOperation(req *DatabaseOperationRequest) error {
+	return checkExecuteOperation(req, req.Type)
+}
+
+// checkExecuteOperation checks an /execute operation for the database type
+func checkExecuteOperation(req *DatabaseOperationRequest, dbType string) error {
+	if lookupOperation(executeOperationSpecs, req.Operation, dbType) == nil && !isBuiltinType(dbType) {
+		return nil
+	}
+	if _, err := checkOperation(executeOperationSpecs, req.Operation, dbType, req, req.Params); err != nil {
+		return err
+	}
+	if isSQLType(dbType) {
+		args, err := normalizeArgs(req.Args)
+		if err != nil {
+			return err
+		}
+		req.Args = args
+	}
+	if req.Operation == explainOperation {
+		return checkExplain(req, dbType)
+	}
+	if req.Operation == "call" && dbType == "postgresql" {
+		return checkRoutine(req)
+	}
+	return nil
+}
+
+func isBuiltinType(dbType string) bool {
+	for _, t := range builtinTypes {
+		if t == dbType {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldSet reports whether the field named by its JSON name is set in req: non-empty for strings, slices and
+// maps and non-zero otherwise. Names of the form params.<key> refer to a non-null entry of params.
+func fieldSet(req interface{}, params map[string]interface{}, name string) bool {
+	if key, ok := strings.CutPrefix(name, "params."); ok {
+		return params[key] != nil
+	}
+	field, ok := jsonField(reflect.Indirect(reflect.ValueOf(req)), name)
+	if !ok {
+		return false
+	}
+	switch field.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return field.Len() > 0
+	}
+	return !field.IsZero()
+}
+
+// jsonField returns the field of a struct with the JSON name, looking into embedded structs
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && jsonName == "" {
+			if found, ok := jsonField(v.Field(i), name); ok {
+				return found, true
+			}
+			continue
+		}
+		if jsonName == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setField sets the request field or parameter with the JSON name to a non-empty value
+func setField(t *testing.T, req interface{}, params map[string]interface{}, name string) {
+	if key, ok := strings.CutPrefix(name, "params."); ok {
+		params[key] = "value"
+		return
+	}
+	field, ok := jsonField(reflect.ValueOf(req).Elem(), name)
+	require.True(t, ok, "no request field %s", name)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString("value")
+	case reflect.Map:
+		field.Set(reflect.MakeMap(field.Type()))
+		field.SetMapIndex(reflect.ValueOf("key"), reflect.ValueOf("value"))
+	case reflect.Slice:
+		field.Set(reflect.MakeSlice(field.Type(), 1, 1))
+	default:
+		t.Fatalf("cannot set request field %s of kind %s", name, field.Kind())
+	}
+}
+
+// TestOperationRegistryRequirements checks for every registered operation, alias and database type that a
+// request with the required fields passes and that leaving out any of them names exactly that field
+func TestOperationRegistryRequirements(t *testing.T) {
+	registries := []struct {
+		name       string
+		specs      []operationSpec
+		newRequest func() (interface{}, map[string]interface{})
+	}{
+		{
+			name:  "execute",
+			specs: executeOperationSpecs,
+			newRequest: func() (interface{}, map[string]interface{}) {
+				req := &DatabaseOperationRequest{Params: map[string]interface{}{}}
+				return req, req.Params
+			},
+		},
+		{
+			name:  "allconfig",
+			specs: allConfigOperationSpecs,
+			newRequest: func() (interface{}, map[string]interface{}) {
+				return &AllConfigOperationRequest{}, nil
+			},
+		},
+	}
+
+	for _, registry := range registries {
+		for _, spec := range registry.specs {
+			types := spec.Types
+			if len(types) == 0 {
+				types = builtinTypes
+			}
+			for _, dbType := range types {
+				for _, operation := range append([]string{spec.Name}, spec.Aliases...) {
+					t.Run(registry.name+"/"+dbType+"/"+operation, func(t *testing.T) {
+						// without lists the left-out field, or -1 to set every required field
+						check := func(without int, anyOf string) error {
+							req, params := registry.newRequest()
+							for i, field := range spec.Required {
+								if i != without {
+									setField(t, req, params, field)
+								}
+							}
+							if anyOf != "" {
+								setField(t, req, params, anyOf)
+							}
+							found, err := checkOperation(registry.specs, operation, dbType, req, params)
+							if err == nil {
+								assert.Equal(t, spec.Name, found.Name)
+							}
+							return err
+						}
+
+						if len(spec.AnyOf) == 0 {
+							require.NoError(t, check(-1, ""))
+						}
+						for _, field := range spec.AnyOf {
+							assert.NoError(t, check(-1, field), field)
+						}
+						anyOf := ""
+						if len(spec.AnyOf) > 0 {
+							anyOf = spec.AnyOf[0]
+							var apiErr *apiError
+							require.ErrorAs(t, check(-1, ""), &apiErr)
+							assert.Equal(t, spec.AnyOf, apiErr.Details["missing"])
+						}
+
+						for i, field := range spec.Required {
+							var apiErr *apiError
+							require.ErrorAs(t, check(i, anyOf), &apiErr, field)
+							assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+							assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+							assert.Equal(t, []string{field}, apiErr.Details["missing"])
+							assert.Equal(t, field+" is required for "+operation+" operation", apiErr.Message)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestCheckOperationUnsupported(t *testing.T) {
+	_, err := checkOperation(executeOperationSpecs, "find", "mysql", &DatabaseOperationRequest{}, nil)
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeUnsupportedOperation, apiErr.Code)
+	assert.Equal(t, []string{"query", "select", "insert", "update", "delete", "execute", "call",
+		"list_tables", "describe_table", "list_indexes", "list_databases", "explain"}, apiErr.Details["supported"])
+
+	_, err = checkOperation(executeOperationSpecs, "select", "mongodb", &DatabaseOperationRequest{}, nil)
+	require.ErrorAs(t, err, &apiErr)
+	assert.NotContains(t, apiErr.Details["supported"], "select")
+	assert.Contains(t, apiErr.Details["supported"], "findOne")
+
+	// The same name can mean different operations on different database types
+	_, err = checkOperation(executeOperationSpecs, "insert", "mongodb", &DatabaseOperationRequest{Query: "INSERT INTO t VALUES (1)"}, nil)
+	assert.EqualError(t, err, "params.collection and params.document are required for insert operation")
+}
+
+func TestValidateOperationCustomDrivers(t *testing.T) {
+	// Registered custom drivers check the operations the registry does not know themselves
+	assert.NoError(t, ValidateOperation(&DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: fakeDriver},
+		Operation:                 "get",
+	}))
+
+	err := ValidateOperation(&DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: fakeDriver},
+		Operation:                 "describe_table",
+	})
+	assert.EqualError(t, err, "table is required for describe_table operation")
+}
+
+// TestOperationsValidatedBeforeConnecting sends requests for an unresolvable host, which would fail
+// with 502 if the handlers connected before validating the operation
+func TestOperationsValidatedBeforeConnecting(t *testing.T) {
+	connection := map[string]interface{}{"type": "mysql", "host": "db.invalid", "port": 3306, "database": "app"}
+	with := func(fields map[string]interface{}) map[string]interface{} {
+		body := make(map[string]interface{})
+		for k, v := range connection {
+			body[k] = v
+		}
+		for k, v := range fields {
+			body[k] = v
+		}
+		return body
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		body    map[string]interface{}
+		code    string
+		details map[string]interface{}
+	}{
+		{
+			name: "misspelled execute operation",
+			path: "/v1/execute",
+			body: with(map[string]interface{}{"operation": "selct", "query": "SELECT 1"}),
+			code: ErrorCodeUnsupportedOperation,
+		},
+		{
+			name:    "execute without query",
+			path:    "/v1/execute",
+			body:    with(map[string]interface{}{"operation": "select"}),
+			code:    ErrorCodeValidation,
+			details: map[string]interface{}{"operation": "select", "missing": []interface{}{"query"}},
+		},
+		{
+			name:    "allconfig operation without fields",
+			path:    "/v1/allconfig-operation",
+			body:    with(map[string]interface{}{"operation": "approve_request", "checker_id": "alice"}),
+			code:    ErrorCodeValidation,
+			details: map[string]interface{}{"operation": "approve_request", "missing": []interface{}{"request_id"}},
+		},
+		{
+			name: "misspelled batch operation",
+			path: "/v1/execute-batch",
+			body: with(map[string]interface{}{"statements": []interface{}{
+				map[string]interface{}{"operation": "selct", "query": "SELECT 1"},
+			}}),
+			code: ErrorCodeUnsupportedOperation,
+		},
+	}
+
+	handler := SetupRoutes(NewAPI())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.body)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(data)))
+
+			require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+			var response DatabaseResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.code, response.ErrorCode)
+			if tt.details != nil {
+				assert.Equal(t, tt.details, response.Details)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"db-connectors/connectors"
+)
+
+// getPendingWithCurrent lists the pending approval requests, oldest first, each with the approved config it
+// would change: current_value and current_updated_at, current_exists, and changed, which is set when
+// approving the request would change the live value. key, when set, restricts the list to one config.
+func (a *API) getPendingWithCurrent(ctx context.Context, connector connectors.DBConnector, tableName, key string, limit, offset int) (interface{}, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		// A pending delete changes a config that exists; a create or update changes one that does not
+		// exist yet or holds another value
+		differs := "p.config_value IS DISTINCT FROM c.config_value"
+		if connector.GetType() == "mysql" {
+			differs = "NOT (p.config_value <=> c.config_value)"
+		}
+		query := `SELECT p.request_id, p.config_key, ` + a.listedValueOf("p.config_value", "config_value") + `, p.description,
+				         p.tags, p.operation, p.maker_id, p.requested_at,
+				         ` + a.listedValueOf("c.config_value", "current_value") + `, c.updated_at AS current_updated_at,
+				         c.config_key IS NOT NULL AS current_exists,
+				         CASE WHEN p.operation = 'delete' THEN c.config_key IS NOT NULL
+				              ELSE c.config_key IS NULL OR ` + differs + ` END AS changed
+				  FROM ` + sqlTable(ctx, a.approvalTable(tableName)) + ` p
+				  LEFT JOIN ` + sqlTable(ctx, tableName) + ` c ON c.config_key = p.config_key AND c.status = 'approved' AND ` + sqlUnexpired(d, "c.expires_at") + `
+				  WHERE p.status = 'pending'`
+		var args []interface{}
+		if key != "" {
+			query += " AND p.config_key = ?"
+			args = append(args, key)
+		}
+		query = pageQuery(d, connectors.Bind(d, query+" ORDER BY p.requested_at ASC"), limit, offset)
+
+		rows, err := connector.Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		results, err := a.configRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		// MySQL returns the flags as integers
+		for _, row := range results {
+			row["current_exists"] = asBool(row["current_exists"])
+			row["changed"] = asBool(row["changed"])
+		}
+		return a.markLargeValues(results, nil)
+
+	case "mongodb":
+		filter := map[string]interface{}{"status": "pending"}
+		if key != "" {
+			filter["config_key"] = key
+		}
+		params := map[string]interface{}{
+			"collection": a.approvalTable(tableName),
+			"filter":     filter,
+			"sort":       map[string]interface{}{"requested_at": 1},
+		}
+		if limit > 0 {
+			params["limit"] = limit
+		}
+		if offset > 0 {
+			params["skip"] = offset
+		}
+		result, err := connector.Execute(ctx, "find", params)
+		if err != nil {
+			return nil, err
+		}
+		pending, _ := result.([]map[string]interface{})
+
+		// Look up the approved configs of the listed requests with a second query
+		keys := make([]string, 0, len(pending))
+		for _, request := range pending {
+			keys = append(keys, asString(request["config_key"]))
+		}
+		current := map[string]map[string]interface{}{}
+		if len(keys) > 0 {
+			result, err := connector.Execute(ctx, "find", map[string]interface{}{
+				"collection": tableName,
+				"filter": a.unexpired(map[string]interface{}{
+					"config_key": map[string]interface{}{"$in": keys},
+					"status":     "approved",
+				}),
+			})
+			if err != nil {
+				return nil, err
+			}
+			configs, _ := result.([]map[string]interface{})
+			for _, config := range configs {
+				current[asString(config["config_key"])] = config
+			}
+		}
+
+		rows := make([]map[string]interface{}, 0, len(pending))
+		for _, request := range pending {
+			config, exists := current[asString(request["config_key"])]
+			row := map[string]interface{}{
+				"request_id":         request["request_id"],
+				"config_key":         request["config_key"],
+				"config_value":       request["config_value"],
+				"description":        request["description"],
+				"tags":               request["tags"],
+				"operation":          request["operation"],
+				"maker_id":           request["maker_id"],
+				"requested_at":       request["requested_at"],
+				"current_value":      config["config_value"],
+				"current_updated_at": config["updated_at"],
+				"current_exists":     exists,
+				"changed":            pendingChanges(asString(request["operation"]), exists, request["config_value"], config["config_value"]),
+			}
+			rows = append(rows, row)
+		}
+		return a.markLargeValues(rows, nil)
+
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+}
+
+// pendingChanges reports whether approving a request would change the live config: a delete changes a
+// config that exists, a create or update one that does not exist or holds another value
+func pendingChanges(operation string, exists bool, proposed, current interface{}) bool {
+	if operation == "delete" {
+		return exists
+	}
+	return !exists || !reflect.DeepEqual(proposed, current)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingChanges(t *testing.T) {
+	assert.True(t, pendingChanges("create", false, "on", nil))
+	assert.False(t, pendingChanges("create", true, "on", "on"))
+	assert.True(t, pendingChanges("update", true, "off", "on"))
+	assert.False(t, pendingChanges("update", true, "on", "on"))
+	assert.True(t, pendingChanges("update", false, "on", nil))
+	assert.True(t, pendingChanges("delete", true, nil, "on"))
+	assert.False(t, pendingChanges("delete", false, nil, nil))
+}
+
+// pendingColumns are the columns of get_pending_with_current rows read from SQL
+var pendingColumns = []string{"request_id", "config_key", "config_value", "value_size", "operation", "maker_id",
+	"current_value", "current_value_size", "current_updated_at", "current_exists", "changed"}
+
+func TestGetPendingWithCurrentSQL(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		dbType string
+		query  []string
+		key    string
+		args   []interface{}
+	}{
+		{
+			dbType: "mysql",
+			query: []string{
+				"FROM allconfig_approval_requests p",
+				"LEFT JOIN allconfig c ON c.config_key = p.config_key AND c.status = 'approved' AND (c.expires_at IS NULL OR c.expires_at > UTC_TIMESTAMP())",
+				"NOT (p.config_value <=> c.config_value)",
+				"WHERE p.status = 'pending' AND p.config_key = ? ORDER BY p.requested_at ASC LIMIT 10 OFFSET 20",
+				"END AS current_value, OCTET_LENGTH(c.config_value) AS current_value_size",
+			},
+			key:  "feature.flag",
+			args: []interface{}{"feature.flag"},
+		},
+		{
+			dbType: "postgresql",
+			query: []string{
+				"p.config_value IS DISTINCT FROM c.config_value",
+				"WHERE p.status = 'pending' ORDER BY p.requested_at ASC LIMIT 10 OFFSET 20",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			api := NewAPI()
+			m := new(connectortest.MockDBConnector)
+			m.On("GetType").Return(tt.dbType)
+			m.On("Query", mock.Anything, mock.MatchedBy(func(query string) bool {
+				for _, part := range tt.query {
+					if !strings.Contains(query, part) {
+						return false
+					}
+				}
+				return true
+			}), tt.args).Return(newMockRows(t, pendingColumns,
+				[]driver.Value{"r1", "new.flag", "on", int64(2), "create", "bob", nil, nil, nil, int64(0), int64(1)},
+				[]driver.Value{"r2", "feature.flag", "off", int64(3), "update", "bob", "on", int64(2), updatedAt, int64(1), int64(1)},
+				[]driver.Value{"r3", "old.flag", nil, nil, "delete", "bob", "on", int64(2), updatedAt, true, true},
+			), nil)
+
+			result, err := api.getPendingWithCurrent(context.Background(), m, "allconfig", tt.key, 10, 20)
+			require.NoError(t, err)
+			rows := result.([]map[string]interface{})
+			require.Len(t, rows, 3)
+
+			assert.Nil(t, rows[0]["current_value"])
+			assert.Equal(t, false, rows[0]["current_exists"])
+			assert.Equal(t, true, rows[0]["changed"])
+			assert.Equal(t, false, rows[0]["current_value_truncated"])
+
+			assert.Equal(t, "off", rows[1]["config_value"])
+			assert.Equal(t, "on", rows[1]["current_value"])
+			assert.Equal(t, true, rows[1]["current_exists"])
+			assert.Equal(t, true, rows[1]["changed"])
+
+			assert.Equal(t, "delete", rows[2]["operation"])
+			assert.Equal(t, true, rows[2]["changed"])
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPendingWithCurrentMongoDB(t *testing.T) {
+	api := stopClock(NewAPI())
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("mongodb")
+	m.On("Execute", mock.Anything, "find", mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["collection"] == "allconfig_approval_requests"
+	})).Return([]map[string]interface{}{
+		{"request_id": "r1", "config_key": "new.flag", "config_value": "on", "operation": "create"},
+		{"request_id": "r2", "config_key": "feature.flag", "config_value": "off", "operation": "update"},
+		{"request_id": "r3", "config_key": "same.flag", "config_value": "on", "operation": "update"},
+		{"request_id": "r4", "config_key": "old.flag", "operation": "delete"},
+		{"request_id": "r5", "config_key": "gone.flag", "operation": "delete"},
+	}, nil)
+	m.On("Execute", mock.Anything, "find", map[string]interface{}{
+		"collection": "allconfig",
+		"filter": map[string]interface{}{
+			"config_key": map[string]interface{}{"$in": []string{"new.flag", "feature.flag", "same.flag", "old.flag", "gone.flag"}},
+			"status":     "approved",
+			"expires_at": mongoUnexpired(expiryTestNow),
+		},
+	}).Return([]map[string]interface{}{
+		{"config_key": "feature.flag", "config_value": "on", "status": "approved"},
+		{"config_key": "same.flag", "config_value": "on", "status": "approved"},
+		{"config_key": "old.flag", "config_value": "x", "status": "approved"},
+	}, nil)
+
+	result, err := api.getPendingWithCurrent(context.Background(), m, "allconfig", "", 0, 0)
+	require.NoError(t, err)
+	rows := result.([]map[string]interface{})
+	require.Len(t, rows, 5)
+
+	type summary struct {
+		current interface{}
+		exists  bool
+		changed bool
+	}
+	var got []summary
+	for _, row := range rows {
+		got = append(got, summary{row["current_value"], row["current_exists"].(bool), row["changed"].(bool)})
+	}
+	assert.Equal(t, []summary{
+		{nil, false, true},  // create of a new key
+		{"on", true, true},  // update to another value
+		{"on", true, false}, // update to the live value
+		{"x", true, true},   // delete of a live config
+		{nil, false, false}, // delete of a config already gone
+	}, got)
+	assert.Equal(t, int64(3), rows[1]["value_size"])
+	assert.Equal(t, int64(2), rows[1]["current_value_size"])
+	m.AssertExpectations(t)
+}
+
+func TestGetPendingWithCurrentMongoDBFilters(t *testing.T) {
+	api := NewAPI()
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("mongodb")
+	m.On("Execute", mock.Anything, "find", map[string]interface{}{
+		"collection": "allconfig_approval_requests",
+		"filter":     map[string]interface{}{"status": "pending", "config_key": "feature.flag"},
+		"sort":       map[string]interface{}{"requested_at": 1},
+		"limit":      5,
+		"skip":       10,
+	}).Return([]map[string]interface{}{}, nil)
+
+	// Without pending requests there are no configs to look up
+	result, err := api.getPendingWithCurrent(context.Background(), m, "allconfig", "feature.flag", 5, 10)
+	require.NoError(t, err)
+	assert.Empty(t, result)
+	m.AssertNumberOfCalls(t, "Execute", 1)
+}
@@ -0,0 +1,516 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// StatementClass reports whether a statement only reads data or may modify it
+type StatementClass string
+
+const (
+	StatementRead  StatementClass = "read"
+	StatementWrite StatementClass = "write"
+)
+
+// DefaultDeniedStatements are rejected on /execute unless the deployment overrides the list
+var DefaultDeniedStatements = []string{"DROP", "TRUNCATE", "ALTER"}
+
+// StatementPolicy restricts which statements /execute is allowed to run
+type StatementPolicy struct {
+	ReadOnly         bool     // Reject every statement that is not a read
+	DeniedStatements []string // Leading keywords rejected even in read-write mode
+	// Let MySQL requests set multi_statements, running several statements per query. Off by default, since
+	// a statement injected after a semicolon then runs too.
+	AllowMultiStatements bool
+}
+
+// PolicyError is returned when a request is rejected by the statement policy
+type PolicyError struct {
+	StatusCode int
+	Code       string // ErrorCodeValidation or ErrorCodeForbidden
+	Message    string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// DefaultStatementPolicy returns a read-write policy with the default denylist
+func DefaultStatementPolicy() StatementPolicy {
+	return StatementPolicy{
+		DeniedStatements: append([]string(nil), DefaultDeniedStatements...),
+	}
+}
+
+// sqlReadOperations are /execute operations that must only carry read statements
+var sqlReadOperations = map[string]bool{
+	"query":  true,
+	"select": true,
+}
+
+// mongoReadOperations are MongoDB operations that never modify data
+var mongoReadOperations = map[string]bool{
+	"find":            true,
+	"findOne":         true,
+	"count":           true,
+	"countDocuments":  true,
+	"aggregate":       true,
+	"distinct":        true,
+	"listCollections": true,
+	"listIndexes":     true,
+	"listDatabases":   true,
+}
+
+// mongoStatementKeywords maps MongoDB operations onto the SQL keyword used by the denylist
+var mongoStatementKeywords = map[string]string{
+	"drop":           "DROP",
+	"dropCollection": "DROP",
+	"dropDatabase":   "DROP",
+	"dropIndex":      "DROP",
+	"dropIndexes":    "DROP",
+}
+
+// Check validates an /execute request against the policy
+func (p StatementPolicy) Check(req *DatabaseOperationRequest) error {
+	if isSQLType(req.Type) && strings.TrimSpace(req.Query) == "" && !callsRoutine(req) {
+		// Nothing to classify; the operation registry reports the missing query
+		return nil
+	}
+
+	class, keywords := classifyOperation(req)
+	if isSQLType(req.Type) && sqlReadOperations[req.Operation] && class != StatementRead {
+		return &PolicyError{
+			StatusCode: http.StatusBadRequest,
+			Code:       ErrorCodeValidation,
+			Message:    fmt.Sprintf("operation %q only accepts read statements, got %s", req.Operation, strings.Join(keywords, ", ")),
+		}
+	}
+
+	for _, keyword := range keywords {
+		if p.isDenied(keyword) {
+			return &PolicyError{
+				StatusCode: http.StatusForbidden,
+				Code:       ErrorCodeForbidden,
+				Message:    fmt.Sprintf("%s statements are not allowed", keyword),
+			}
+		}
+	}
+
+	if p.ReadOnly && class != StatementRead {
+		return &PolicyError{
+			StatusCode: http.StatusForbidden,
+			Code:       ErrorCodeForbidden,
+			Message:    "server is in read-only mode: write operations are not allowed",
+		}
+	}
+
+	return nil
+}
+
+// classifyOperation classifies an /execute request as read or write, returning the statement keywords the
+// denylist applies to
+func classifyOperation(req *DatabaseOperationRequest) (StatementClass, []string) {
+	// Schema introspection and database listing only read catalog data
+	if isSchemaOperation(req.Operation) || req.Operation == "list_databases" {
+		return StatementRead, nil
+	}
+
+	if callsRoutine(req) {
+		// A routine may run any statement, so it is denied by the CALL keyword whatever its type
+		return StatementWrite, []string{"CALL"}
+	}
+
+	var (
+		class    StatementClass
+		keywords []string
+	)
+	switch req.Type {
+	case "mysql", "postgresql":
+		class, keywords = ClassifySQL(req.Type, req.Query)
+	case "mongodb":
+		class = ClassifyMongoOperation(req.Operation, req.Params)
+		if keyword, ok := mongoStatementKeywords[req.Operation]; ok {
+			keywords = []string{keyword}
+		}
+	default:
+		// Operations of registered custom drivers cannot be classified, so read-only mode rejects them
+		class = StatementWrite
+	}
+	if req.Operation == explainOperation && !req.Analyze && len(keywords) <= 1 {
+		// Without analyze only the plan is computed and the statement never runs. A query holding several
+		// statements keeps its class, since the ones after the first would run.
+		class = StatementRead
+	}
+	return class, keywords
+}
+
+// checkMultiStatements reports the problems of a request asking for multi_statements: only MySQL supports
+// them, and only when the policy allows them
+func (p StatementPolicy) checkMultiStatements(req *DatabaseConnectionRequest) []string {
+	switch {
+	case !req.MultiStatements:
+		return nil
+	case req.Type != "mysql":
+		return []string{"multi_statements is only supported for MySQL"}
+	case !p.AllowMultiStatements:
+		return []string{"multi_statements is disabled on this server; enable server.allow_multi_statements to allow it"}
+	}
+	return nil
+}
+
+func isSQLType(dbType string) bool {
+	return dbType == "mysql" || dbType == "postgresql"
+}
+
+func (p StatementPolicy) isDenied(keyword string) bool {
+	for _, denied := range p.DeniedStatements {
+		if strings.EqualFold(strings.TrimSpace(denied), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlReadKeywords are leading keywords of statements that only read data
+var sqlReadKeywords = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"EXPLAIN":  true,
+	"VALUES":   true,
+	"TABLE":    true,
+}
+
+// sqlDMLKeywords are the statements a CTE can wrap
+var sqlDMLKeywords = map[string]bool{
+	"SELECT": true,
+	"INSERT": true,
+	"UPDATE": true,
+	"DELETE": true,
+	"MERGE":  true,
+	"VALUES": true,
+	"TABLE":  true,
+}
+
+// ClassifySQL classifies a SQL string as read or write and returns the leading keyword of each statement.
+// Comments, string literals and quoted identifiers are skipped using the lexical rules of dbType;
+// unknown statements are classified as writes.
+func ClassifySQL(dbType, query string) (StatementClass, []string) {
+	class := StatementRead
+	var keywords []string
+
+	statements := splitSQLStatements(tokenizeSQL(dbType, query))
+	if len(statements) == 0 {
+		return StatementWrite, nil
+	}
+	for _, tokens := range statements {
+		keyword, stmtClass := classifySQLStatement(tokens)
+		keywords = append(keywords, keyword)
+		if stmtClass == StatementWrite {
+			class = StatementWrite
+		}
+	}
+	return class, keywords
+}
+
+// sqlToken is a word or punctuation character outside comments and literals
+type sqlToken struct {
+	text  string // Upper-cased word or single punctuation character
+	depth int    // Parenthesis nesting depth
+}
+
+// tokenizeSQL splits a query into words and punctuation, dropping comments, string literals and quoted identifiers
+func tokenizeSQL(dbType, query string) []sqlToken {
+	var tokens []sqlToken
+	runes := []rune(query)
+	depth := 0
+	mysqlDialect := dbType == "mysql"
+	inExecutableComment := false
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case isLineComment(runes, i, mysqlDialect):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case mysqlDialect && executableCommentBody(runes, i) > i:
+			// MySQL runs the body of /*! ... */ comments and reads /*+ ... */ optimizer hints, so their words
+			// are tokenized like the rest of the statement
+			i = executableCommentBody(runes, i)
+			inExecutableComment = true
+		case inExecutableComment && r == '*' && i+1 < len(runes) && runes[i+1] == '/':
+			i += 2
+			inExecutableComment = false
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			// PostgreSQL block comments nest
+			nested := 1
+			for i += 2; i < len(runes) && nested > 0; {
+				switch {
+				case runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/':
+					nested--
+					i += 2
+				case !mysqlDialect && runes[i] == '/' && i+1 < len(runes) && runes[i+1] == '*':
+					nested++
+					i += 2
+				default:
+					i++
+				}
+			}
+		case r == '\'' || r == '"' || (r == '`' && mysqlDialect):
+			// Doubled quotes escape themselves; backslashes escape in MySQL strings and PostgreSQL E'' strings
+			backslashEscapes := (mysqlDialect && r != '`') || (r == '\'' && isEscapeStringPrefix(runes, i))
+			i++
+			for i < len(runes) {
+				if runes[i] == '\\' && backslashEscapes {
+					i += 2
+					continue
+				}
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			tokens = append(tokens, sqlToken{text: "?", depth: depth})
+		case r == '$' && !mysqlDialect && dollarQuoteEnd(runes, i) > i:
+			// PostgreSQL dollar-quoted string such as $$...$$ or $tag$...$tag$
+			tagEnd := dollarQuoteEnd(runes, i)
+			tag := string(runes[i : tagEnd+1])
+			rest := string(runes[tagEnd+1:])
+			if idx := strings.Index(rest, tag); idx >= 0 {
+				i = tagEnd + 1 + len([]rune(rest[:idx])) + len([]rune(tag))
+			} else {
+				i = len(runes)
+			}
+			tokens = append(tokens, sqlToken{text: "?", depth: depth})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{text: strings.ToUpper(string(runes[start:i])), depth: depth})
+		case r == '(':
+			tokens = append(tokens, sqlToken{text: "(", depth: depth})
+			depth++
+			i++
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+			tokens = append(tokens, sqlToken{text: ")", depth: depth})
+			i++
+		default:
+			tokens = append(tokens, sqlToken{text: string(r), depth: depth})
+			i++
+		}
+	}
+	return tokens
+}
+
+// isLineComment reports whether a "--" or MySQL "#" comment starts at i.
+// MySQL only treats "--" as a comment when followed by whitespace.
+func isLineComment(runes []rune, i int, mysqlDialect bool) bool {
+	if mysqlDialect && runes[i] == '#' {
+		return true
+	}
+	if runes[i] != '-' || i+1 >= len(runes) || runes[i+1] != '-' {
+		return false
+	}
+	return !mysqlDialect || i+2 >= len(runes) || unicode.IsSpace(runes[i+2])
+}
+
+// executableCommentBody returns where the body of a MySQL /*! ... */ executable comment, with its optional
+// version number, or of a /*+ ... */ optimizer hint starting at i begins, or i when none starts there.
+// MariaDB's /*M! ... */ comments are executable too.
+func executableCommentBody(runes []rune, i int) int {
+	if runes[i] != '/' || i+2 >= len(runes) || runes[i+1] != '*' {
+		return i
+	}
+	j := i + 2
+	switch {
+	case runes[j] == '+':
+		return j + 1
+	case runes[j] == 'M' && j+1 < len(runes) && runes[j+1] == '!':
+		j++
+	case runes[j] != '!':
+		return i
+	}
+	j++
+	for j < len(runes) && unicode.IsDigit(runes[j]) {
+		j++
+	}
+	return j
+}
+
+// isEscapeStringPrefix reports whether the quote at i opens a PostgreSQL E'...' string
+func isEscapeStringPrefix(runes []rune, i int) bool {
+	if i == 0 || (runes[i-1] != 'E' && runes[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !(unicode.IsLetter(runes[i-2]) || unicode.IsDigit(runes[i-2]) || runes[i-2] == '_')
+}
+
+// dollarQuoteEnd returns the index of the closing '$' of a dollar-quote tag starting at i, or -1
+func dollarQuoteEnd(runes []rune, i int) int {
+	for j := i + 1; j < len(runes); j++ {
+		if runes[j] == '$' {
+			return j
+		}
+		if !(unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+			return -1
+		}
+	}
+	return -1
+}
+
+// splitSQLStatements splits tokens on top-level semicolons, dropping empty statements
+func splitSQLStatements(tokens []sqlToken) [][]sqlToken {
+	var statements [][]sqlToken
+	var current []sqlToken
+	for _, tok := range tokens {
+		if tok.text == ";" && tok.depth == 0 {
+			if len(current) > 0 {
+				statements = append(statements, current)
+			}
+			current = nil
+			continue
+		}
+		current = append(current, tok)
+	}
+	if len(current) > 0 {
+		statements = append(statements, current)
+	}
+	return statements
+}
+
+// classifySQLStatement classifies a single statement and returns its leading keyword
+func classifySQLStatement(tokens []sqlToken) (string, StatementClass) {
+	// Skip wrapping parentheses such as "(SELECT ...) UNION (SELECT ...)"
+	start := 0
+	for start < len(tokens) && tokens[start].text == "(" {
+		start++
+	}
+	if start == len(tokens) {
+		return "", StatementWrite
+	}
+	tokens = tokens[start:]
+	keyword := tokens[0].text
+
+	switch keyword {
+	case "WITH":
+		return keyword, classifyCTE(tokens)
+	case "EXPLAIN", "DESCRIBE", "DESC":
+		return keyword, classifyExplain(tokens)
+	case "SELECT":
+		// SELECT ... INTO creates a table (PostgreSQL) or writes a file (MySQL)
+		if hasTopLevelKeyword(tokens, tokens[0].depth, "INTO") {
+			return keyword, StatementWrite
+		}
+		return keyword, StatementRead
+	}
+
+	if sqlReadKeywords[keyword] {
+		return keyword, StatementRead
+	}
+	return keyword, StatementWrite
+}
+
+// classifyCTE classifies WITH statements, including PostgreSQL data-modifying CTEs
+func classifyCTE(tokens []sqlToken) StatementClass {
+	for i, tok := range tokens {
+		switch tok.text {
+		case "INSERT", "DELETE", "MERGE":
+			return StatementWrite
+		case "UPDATE":
+			// SELECT ... FOR UPDATE and FOR NO KEY UPDATE only lock rows
+			if i > 0 && (tokens[i-1].text == "FOR" || tokens[i-1].text == "KEY") {
+				continue
+			}
+			return StatementWrite
+		case "INTO":
+			if tok.depth == tokens[0].depth {
+				return StatementWrite
+			}
+		}
+	}
+
+	// The main statement must itself be one a CTE can wrap
+	for _, tok := range tokens[1:] {
+		if tok.depth == tokens[0].depth && sqlDMLKeywords[tok.text] {
+			return StatementRead
+		}
+	}
+	return StatementWrite
+}
+
+// classifyExplain treats EXPLAIN ANALYZE of a write as a write, since it executes the statement
+func classifyExplain(tokens []sqlToken) StatementClass {
+	analyze := false
+	for i, tok := range tokens[1:] {
+		if tok.text == "ANALYZE" {
+			analyze = true
+			continue
+		}
+		if sqlDMLKeywords[tok.text] || tok.text == "WITH" {
+			if !analyze {
+				return StatementRead
+			}
+			_, class := classifySQLStatement(tokens[i+1:])
+			return class
+		}
+	}
+	return StatementRead
+}
+
+// hasTopLevelKeyword reports whether keyword appears at the given nesting depth
+func hasTopLevelKeyword(tokens []sqlToken, depth int, keyword string) bool {
+	for _, tok := range tokens {
+		if tok.depth == depth && tok.text == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyMongoOperation classifies a MongoDB operation as read or write
+func ClassifyMongoOperation(operation string, params map[string]interface{}) StatementClass {
+	if operation == explainOperation {
+		// explain runs a find, or an aggregate when given a pipeline
+		operation = "find"
+		if params["pipeline"] != nil {
+			operation = "aggregate"
+		}
+	}
+	if !mongoReadOperations[operation] {
+		return StatementWrite
+	}
+	// $out and $merge stages write the aggregation result to a collection
+	if operation == "aggregate" {
+		if pipeline, ok := params["pipeline"].([]interface{}); ok {
+			for _, stage := range pipeline {
+				stageMap, ok := stage.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if _, ok := stageMap["$out"]; ok {
+					return StatementWrite
+				}
+				if _, ok := stageMap["$merge"]; ok {
+					return StatementWrite
+				}
+			}
+		}
+	}
+	return StatementRead
+}
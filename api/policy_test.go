@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifySQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbType   string
+		query    string
+		want     StatementClass
+		keywords []string
+	}{
+		{"simple select", "mysql", "SELECT * FROM users", StatementRead, []string{"SELECT"}},
+		{"lowercase select", "postgresql", "select id from users", StatementRead, []string{"SELECT"}},
+		{"lowercase update", "mysql", "update users set name = 'x'", StatementWrite, []string{"UPDATE"}},
+		{"leading line comment", "postgresql", "-- fetch users\nSELECT 1", StatementRead, []string{"SELECT"}},
+		{"leading block comment hiding write", "mysql", "/* SELECT */ DELETE FROM users", StatementWrite, []string{"DELETE"}},
+		{"leading hash comment", "mysql", "# note\nselect 1", StatementRead, []string{"SELECT"}},
+		{"comment mentioning write", "postgresql", "SELECT 1 -- DROP TABLE users", StatementRead, []string{"SELECT"}},
+		{"write keyword inside string", "postgresql", "SELECT 'DELETE FROM users; DROP TABLE x'", StatementRead, []string{"SELECT"}},
+		{"write keyword as quoted identifier", "postgresql", `SELECT "update" FROM audit`, StatementRead, []string{"SELECT"}},
+		{"parenthesized select", "mysql", "(SELECT 1) UNION (SELECT 2)", StatementRead, []string{"SELECT"}},
+		{"show", "mysql", "SHOW TABLES", StatementRead, []string{"SHOW"}},
+		{"explain", "postgresql", "EXPLAIN SELECT * FROM users", StatementRead, []string{"EXPLAIN"}},
+		{"explain delete without analyze", "postgresql", "EXPLAIN DELETE FROM users", StatementRead, []string{"EXPLAIN"}},
+		{"explain analyze delete", "postgresql", "EXPLAIN ANALYZE DELETE FROM users", StatementWrite, []string{"EXPLAIN"}},
+		{"explain analyze options delete", "postgresql", "EXPLAIN (ANALYZE, BUFFERS) DELETE FROM users", StatementWrite, []string{"EXPLAIN"}},
+		{"cte select", "postgresql", "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", StatementRead, []string{"WITH"}},
+		{"recursive cte", "postgresql", "with recursive t(n) as (select 1 union all select n + 1 from t where n < 5) select * from t", StatementRead, []string{"WITH"}},
+		{"cte insert", "postgresql", "WITH src AS (SELECT 1 AS id) INSERT INTO t SELECT id FROM src", StatementWrite, []string{"WITH"}},
+		{"data modifying cte", "postgresql", "WITH gone AS (DELETE FROM t RETURNING *) SELECT * FROM gone", StatementWrite, []string{"WITH"}},
+		{"cte for update", "postgresql", "WITH x AS (SELECT * FROM t FOR UPDATE) SELECT * FROM x", StatementRead, []string{"WITH"}},
+		{"select into table", "postgresql", "SELECT * INTO backup FROM users", StatementWrite, []string{"SELECT"}},
+		{"select into outfile", "mysql", "SELECT * FROM users INTO OUTFILE '/tmp/u.csv'", StatementWrite, []string{"SELECT"}},
+		{"select with subquery into ignored", "postgresql", "SELECT (SELECT 1) AS one", StatementRead, []string{"SELECT"}},
+		{"stacked statements", "postgresql", "SELECT 1; DROP TABLE users", StatementWrite, []string{"SELECT", "DROP"}},
+		{"trailing semicolon", "mysql", "SELECT 1;", StatementRead, []string{"SELECT"}},
+		{"mysql backslash escaped quote", "mysql", `SELECT 'it\'s; DROP TABLE x'`, StatementRead, []string{"SELECT"}},
+		{"postgres backslash is not an escape", "postgresql", `SELECT 'a\'; DROP TABLE x; --'`, StatementWrite, []string{"SELECT", "DROP"}},
+		{"postgres escape string", "postgresql", `SELECT E'it\'s; DROP TABLE x'`, StatementRead, []string{"SELECT"}},
+		{"postgres hash operator is not a comment", "postgresql", "SELECT 1 # 2; DROP TABLE x", StatementWrite, []string{"SELECT", "DROP"}},
+		{"postgres dollar quoted string", "postgresql", "SELECT $body$ DELETE FROM t; $body$", StatementRead, []string{"SELECT"}},
+		{"mysql executable comment", "mysql", "SELECT 1 /*!50000 INTO OUTFILE '/tmp/x' */", StatementWrite, []string{"SELECT"}},
+		{"mysql executable comment without version", "mysql", "SELECT * FROM users /*! INTO DUMPFILE '/tmp/x' */", StatementWrite, []string{"SELECT"}},
+		{"mysql executable comment hiding statement", "mysql", "/*!DELETE FROM users */", StatementWrite, []string{"DELETE"}},
+		{"mysql executable comment hiding stacked write", "mysql", "SELECT 1 /*!; DROP TABLE users */", StatementWrite, []string{"SELECT", "DROP"}},
+		{"mariadb executable comment", "mysql", "SELECT 1 /*M!100100 INTO OUTFILE '/tmp/x' */", StatementWrite, []string{"SELECT"}},
+		{"mysql optimizer hint", "mysql", "SELECT /*+ MAX_EXECUTION_TIME(1000) */ * FROM users", StatementRead, []string{"SELECT"}},
+		{"mysql words after executable comment", "mysql", "SELECT /*!40001 SQL_NO_CACHE */ id FROM users", StatementRead, []string{"SELECT"}},
+		{"postgres bang comment is a comment", "postgresql", "SELECT 1 /*! INTO backup */", StatementRead, []string{"SELECT"}},
+		{"postgres nested comment", "postgresql", "SELECT 1 /* /* */ ' */; DELETE FROM users; -- '", StatementWrite, []string{"SELECT", "DELETE"}},
+		{"mysql comments do not nest", "mysql", "SELECT 1 /* /* */ ' */; DELETE FROM users; -- '", StatementRead, []string{"SELECT"}},
+		{"mysql double dash needs space", "mysql", "SELECT 1--1", StatementRead, []string{"SELECT"}},
+		{"ddl", "mysql", "CREATE TABLE t (id INT)", StatementWrite, []string{"CREATE"}},
+		{"unknown statement", "postgresql", "VACUUM users", StatementWrite, []string{"VACUUM"}},
+		{"only comments", "mysql", "-- nothing here", StatementWrite, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, keywords := ClassifySQL(tt.dbType, tt.query)
+			assert.Equal(t, tt.want, class)
+			assert.Equal(t, tt.keywords, keywords)
+		})
+	}
+}
+
+func TestClassifyMongoOperation(t *testing.T) {
+	assert.Equal(t, StatementRead, ClassifyMongoOperation("find", nil))
+	assert.Equal(t, StatementRead, ClassifyMongoOperation("count", nil))
+	assert.Equal(t, StatementRead, ClassifyMongoOperation("distinct", nil))
+	assert.Equal(t, StatementRead, ClassifyMongoOperation("aggregate", map[string]interface{}{
+		"pipeline": []interface{}{map[string]interface{}{"$match": map[string]interface{}{"a": 1}}},
+	}))
+	assert.Equal(t, StatementWrite, ClassifyMongoOperation("aggregate", map[string]interface{}{
+		"pipeline": []interface{}{map[string]interface{}{"$out": "copy"}},
+	}))
+	assert.Equal(t, StatementWrite, ClassifyMongoOperation("insert", nil))
+	assert.Equal(t, StatementWrite, ClassifyMongoOperation("deleteMany", nil))
+	assert.Equal(t, StatementWrite, ClassifyMongoOperation("somethingNew", nil))
+}
+
+func TestStatementPolicyCheck(t *testing.T) {
+	sqlReq := func(op, query string) *DatabaseOperationRequest {
+		req := &DatabaseOperationRequest{Operation: op, Query: query}
+		req.Type = "mysql"
+		return req
+	}
+	mongoReq := func(op string) *DatabaseOperationRequest {
+		req := &DatabaseOperationRequest{Operation: op}
+		req.Type = "mongodb"
+		return req
+	}
+
+	readWrite := DefaultStatementPolicy()
+	readOnly := DefaultStatementPolicy()
+	readOnly.ReadOnly = true
+
+	tests := []struct {
+		name       string
+		policy     StatementPolicy
+		req        *DatabaseOperationRequest
+		wantStatus int
+	}{
+		{"read allowed in read-only", readOnly, sqlReq("query", "SELECT 1"), 0},
+		{"write rejected in read-only", readOnly, sqlReq("update", "UPDATE t SET a = 1"), http.StatusForbidden},
+		{"write allowed in read-write", readWrite, sqlReq("update", "UPDATE t SET a = 1"), 0},
+		{"query carrying update", readWrite, sqlReq("query", "update t set a = 1"), http.StatusBadRequest},
+		{"query carrying cte insert", readWrite, sqlReq("query", "WITH x AS (SELECT 1) INSERT INTO t SELECT * FROM x"), http.StatusBadRequest},
+		{"drop denied in read-write", readWrite, sqlReq("execute", "DROP TABLE t"), http.StatusForbidden},
+		{"lowercase truncate denied", readWrite, sqlReq("execute", "  truncate t"), http.StatusForbidden},
+		{"stacked alter denied", readWrite, sqlReq("execute", "UPDATE t SET a = 1; ALTER TABLE t ADD b INT"), http.StatusForbidden},
+		{"empty denylist allows drop", StatementPolicy{}, sqlReq("execute", "DROP TABLE t"), 0},
+		{"schema operation allowed in read-only", readOnly, sqlReq("describe_table", ""), 0},
+		{"mongo find allowed in read-only", readOnly, mongoReq("find"), 0},
+		{"mongo insert rejected in read-only", readOnly, mongoReq("insert"), http.StatusForbidden},
+		{"mongo drop denied", readWrite, mongoReq("drop"), http.StatusForbidden},
+		{"custom driver allowed in read-write", readWrite, &DatabaseOperationRequest{DatabaseConnectionRequest: DatabaseConnectionRequest{Type: fakeDriver}, Operation: "get"}, 0},
+		{"custom driver rejected in read-only", readOnly, &DatabaseOperationRequest{DatabaseConnectionRequest: DatabaseConnectionRequest{Type: fakeDriver}, Operation: "get"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.req)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var policyErr *PolicyError
+			require.ErrorAs(t, err, &policyErr)
+			assert.Equal(t, tt.wantStatus, policyErr.StatusCode)
+		})
+	}
+}
+
+func TestExecuteOperationHandlerEnforcesReadOnly(t *testing.T) {
+	api := NewAPI()
+	api.policy.ReadOnly = true
+
+	body, err := json.Marshal(map[string]interface{}{
+		"type":      "mysql",
+		"host":      "localhost",
+		"port":      3306,
+		"username":  "root",
+		"database":  "testdb",
+		"operation": "query",
+		"query":     "DELETE FROM users",
+	})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body))
+	api.ExecuteOperationHandler(rr, req)
+
+	// The mismatch is reported before any connection attempt
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	body, err = json.Marshal(map[string]interface{}{
+		"type":      "mysql",
+		"host":      "localhost",
+		"port":      3306,
+		"username":  "root",
+		"database":  "testdb",
+		"operation": "delete",
+		"query":     "DELETE FROM users",
+	})
+	require.NoError(t, err)
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body))
+	api.ExecuteOperationHandler(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeForbidden, response.ErrorCode)
+	assert.Contains(t, response.Error, "read-only")
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"db-connectors/connectors"
+)
+
+// ProfileHeader selects a connection profile when the profile query parameter is absent
+const ProfileHeader = "X-Connection-Profile"
+
+// ConnectionProfile is a named database connection configured on the server
+type ConnectionProfile struct {
+	Name      string
+	Connector connectors.DBConnector // Shared by all requests using the profile
+	Host      string                 // Connection target reported by /v1/connections; never includes credentials
+	Port      int
+	Database  string
+	URI       string            // Connection URI, reported by /v1/connections with its password redacted
+	Labels    map[string]string // Labels of the connection, reported by /v1/connections
+	TableName string            // allconfig table, defaults to the server's allconfig table
+
+	// Rebuild builds the profile's connector again with freshly resolved credentials, replacing one the
+	// database stopped authenticating. Nil keeps the connector the profile was added with.
+	Rebuild func() (connectors.DBConnector, error)
+}
+
+// profile guards connecting a shared profile connector
+type profile struct {
+	ConnectionProfile
+	mu            sync.Mutex
+	connectorMu   sync.RWMutex       // Guards Connector, which a rebuild replaces while holding mu too
+	connected     bool               // Connected once, so a lost connection is rebuilt rather than opened again
+	stopListening context.CancelFunc // Stops listening for config changes; nil when not listening
+	listening     context.Context    // Listening runs under, so that a rebuilt connector listens again
+	stopKeepAlive context.CancelFunc // Stops the keepalive pings; nil when not pinging
+
+	// rebuilt is called under mu once a rebuild replaced the connector, with the connector it replaced
+	rebuilt func(ctx context.Context, replaced connectors.DBConnector)
+}
+
+// errNotRebuildable is returned when refreshing a profile that has no way to build its connector again
+var errNotRebuildable = errors.New("connection cannot be rebuilt")
+
+// connector returns the profile's current connector
+func (p *profile) connector() connectors.DBConnector {
+	p.connectorMu.RLock()
+	defer p.connectorMu.RUnlock()
+	return p.Connector
+}
+
+// connect connects the profile's connector unless it is already connected. A connector that lost its
+// connection reconnects when it can, replacing its client instead of leaking it, and one whose credentials
+// the database rejected is rebuilt.
+func (p *profile) connect(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.needsRebuild() {
+		return p.rebuild(ctx)
+	}
+	if p.Connector.IsConnected(ctx) {
+		return nil
+	}
+	if r, ok := p.Connector.(connectors.Reconnector); ok && p.connected {
+		return r.Reconnect(ctx)
+	}
+	if err := p.Connector.Connect(ctx); err != nil {
+		return err
+	}
+	p.connected = true
+	return nil
+}
+
+// reconnect rebuilds the connection of a profile whose ping failed. Connectors that do not recover on their
+// own are reconnected; database/sql pools drop the broken connection and dial a new one on their next use.
+func (p *profile) reconnect(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.needsRebuild() {
+		return p.rebuild(ctx)
+	}
+	if r, ok := p.Connector.(connectors.Reconnector); ok {
+		return r.Reconnect(ctx)
+	}
+	return nil
+}
+
+// refresh rebuilds the profile's connector whether or not the database rejected its credentials
+func (p *profile) refresh(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Rebuild == nil {
+		return errNotRebuildable
+	}
+	return p.rebuild(ctx)
+}
+
+// needsRebuild reports whether the database rejected the credentials of the profile's connector and the
+// profile can build it again. Callers hold mu.
+func (p *profile) needsRebuild() bool {
+	watcher, ok := p.Connector.(connectors.AuthWatcher)
+	return ok && p.Rebuild != nil && watcher.NeedsReauth()
+}
+
+// rebuild replaces the profile's connector with a newly built and connected one. A connector that fails to
+// build or connect leaves the old one in place, so the next request tries again. Callers hold mu.
+func (p *profile) rebuild(ctx context.Context) error {
+	connector, err := p.Rebuild()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild connection %s: %w", p.Name, err)
+	}
+	if err := connector.Connect(ctx); err != nil {
+		connector.Close(ctx)
+		return err
+	}
+	p.connectorMu.Lock()
+	replaced := p.Connector
+	p.Connector = connector
+	p.connectorMu.Unlock()
+	p.connected = true
+	if p.rebuilt != nil {
+		p.rebuilt(ctx, replaced)
+	}
+	return nil
+}
+
+// Close closes the connections of every registered profile, giving up on each once ctx is done
+func (a *API) Close(ctx context.Context) error {
+	var errs []error
+	for _, record := range a.registry.Records() {
+		if err := record.Connector.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", record.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addProfile registers a connection profile, replacing one with the same name
+func (a *API) addProfile(p ConnectionProfile) {
+	a.profilesMu.Lock()
+	defer a.profilesMu.Unlock()
+	if a.profiles == nil {
+		a.profiles = make(map[string]*profile)
+	}
+	added := &profile{ConnectionProfile: p}
+	added.rebuilt = func(ctx context.Context, replaced connectors.DBConnector) {
+		a.profileRebuilt(ctx, added, replaced)
+	}
+	a.profiles[p.Name] = added
+	a.registry.RegisterWithConfig(p.Name, p.Connector, &connectors.ConnectionConfig{
+		Host:     p.Host,
+		Port:     p.Port,
+		Database: p.Database,
+		URI:      p.URI,
+		Labels:   p.Labels,
+	})
+}
+
+// profileRebuilt registers the rebuilt connector of p in place of the one it replaced, which is closed, and
+// moves the config change listener of p over to it. Called under p.mu.
+func (a *API) profileRebuilt(ctx context.Context, p *profile, replaced connectors.DBConnector) {
+	if _, err := a.registry.Replace(p.Name, p.Connector); err != nil {
+		a.logger.Warn("rebuilt connection is not registered", "profile", p.Name, "error", err)
+	}
+	if p.stopListening != nil {
+		p.stopListening()
+		a.listenProfile(p.listening, p)
+	}
+	if err := replaced.Close(ctx); err != nil {
+		a.logger.Warn("failed to close replaced connection", "profile", p.Name, "error", err)
+	}
+	a.logger.Info("connection rebuilt", "profile", p.Name)
+}
+
+// removeProfile unregisters a connection profile, returning it if it existed
+func (a *API) removeProfile(name string) (*profile, bool) {
+	a.profilesMu.Lock()
+	defer a.profilesMu.Unlock()
+	p, ok := a.profiles[name]
+	delete(a.profiles, name)
+	return p, ok
+}
+
+// lookupProfile returns the named connection profile
+func (a *API) lookupProfile(name string) (*profile, bool) {
+	a.profilesMu.RLock()
+	defer a.profilesMu.RUnlock()
+	p, ok := a.profiles[name]
+	return p, ok
+}
+
+// profileNames returns the registered profile names in sorted order
+func (a *API) profileNames() []string {
+	a.profilesMu.RLock()
+	defer a.profilesMu.RUnlock()
+	names := make([]string, 0, len(a.profiles))
+	for name := range a.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileList returns the registered profiles sorted by name
+func (a *API) profileList() []*profile {
+	a.profilesMu.RLock()
+	defer a.profilesMu.RUnlock()
+	list := make([]*profile, 0, len(a.profiles))
+	for _, p := range a.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// resolveProfile picks the profile named by the profile query parameter, the
+// X-Connection-Profile header, or the default profile, in that order
+func (a *API) resolveProfile(r *http.Request) (*profile, error) {
+	name := r.URL.Query().Get("profile")
+	if name == "" {
+		name = r.Header.Get(ProfileHeader)
+	}
+	if name == "" {
+		name = a.defaultProfile
+	}
+	if name == "" {
+		if profiles := a.profileList(); len(profiles) == 1 {
+			return profiles[0], nil
+		}
+		return nil, fmt.Errorf("no connection profile selected; pass ?profile= or the %s header", ProfileHeader)
+	}
+
+	p, ok := a.lookupProfile(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown connection profile: %s", name)
+	}
+	return p, nil
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// Batching of prune_history, which deletes a bounded number of approval requests at a time and pauses
+// between batches so that replicas keep up
+const (
+	DefaultPruneChunkSize = 1000
+	maxPruneChunkSize     = 10000
+	DefaultPruneDelay     = 100 * time.Millisecond
+	maxPruneDelay         = time.Minute
+)
+
+// DefaultArchiveSuffix names the table prune_history archives the approval requests of an allconfig table to
+const DefaultArchiveSuffix = "_approval_archive"
+
+// prunableStatuses are the statuses of the approval requests prune_history may remove, and removes by
+// default. Pending requests are never removed, as they still await a checker.
+var prunableStatuses = []string{"approved", "rejected"}
+
+// PrunedHistory is the result of prune_history
+type PrunedHistory struct {
+	Table        string    `json:"table"`
+	Before       time.Time `json:"before"` // Requests processed before this time were removed
+	Statuses     []string  `json:"statuses"`
+	Deleted      int64     `json:"deleted"`
+	Batches      int       `json:"batches"`
+	ArchiveTable string    `json:"archive_table,omitempty"` // Where the removed requests were copied, with archive
+}
+
+// historyPruning is what prune_history removes and how
+type historyPruning struct {
+	before    time.Time
+	statuses  []string
+	chunkSize int
+	delay     time.Duration
+	archive   bool
+}
+
+// parseOlderThan returns the cutoff of older_than, which is a timestamp in RFC 3339 format or an age: a
+// duration such as "720h" or a number of days such as "90d"
+func parseOlderThan(olderThan string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, olderThan); err == nil {
+		return t, nil
+	}
+	var age time.Duration
+	if days, ok := strings.CutSuffix(olderThan, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("older_than must be a timestamp, a duration or a number of days, got %q", olderThan)
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(olderThan)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("older_than must be a timestamp, a duration or a number of days, got %q", olderThan)
+		}
+		age = d
+	}
+	if age <= 0 {
+		return time.Time{}, fmt.Errorf("older_than must be a positive age, got %q", olderThan)
+	}
+	return now.Add(-age), nil
+}
+
+// historyPruningOf returns the pruning requested by a prune_history request
+func historyPruningOf(req *AllConfigOperationRequest, now time.Time) (historyPruning, error) {
+	before, err := parseOlderThan(req.OlderThan, now)
+	if err != nil {
+		return historyPruning{}, err
+	}
+	p := historyPruning{before: before.UTC(), statuses: prunableStatuses, chunkSize: req.ChunkSize, delay: DefaultPruneDelay, archive: req.Archive}
+	if len(req.Statuses) > 0 {
+		p.statuses = req.Statuses
+	}
+	for _, status := range p.statuses {
+		if !slices.Contains(prunableStatuses, status) {
+			return historyPruning{}, fmt.Errorf("statuses must be among %s, got %q; pending requests are never pruned", strings.Join(prunableStatuses, ", "), status)
+		}
+	}
+	if p.chunkSize == 0 {
+		p.chunkSize = DefaultPruneChunkSize
+	}
+	if req.ChunkDelayMS != nil {
+		p.delay = time.Duration(*req.ChunkDelayMS) * time.Millisecond
+	}
+	if p.delay < 0 || p.delay > maxPruneDelay {
+		return historyPruning{}, fmt.Errorf("chunk_delay_ms must be between 0 and %d", maxPruneDelay.Milliseconds())
+	}
+	return p, nil
+}
+
+// checkPruneHistory rejects the pruning fields on other operations, and the older_than, statuses and
+// chunk_delay_ms of prune_history that do not parse
+func checkPruneHistory(req *AllConfigOperationRequest, spec *operationSpec) error {
+	invalid := func(message string) error {
+		return &apiError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: message,
+			Details: map[string]interface{}{"operation": req.Operation},
+		}
+	}
+	if spec.Name != "prune_history" {
+		if req.OlderThan != "" || len(req.Statuses) > 0 || req.ChunkDelayMS != nil || req.Archive {
+			return invalid(fmt.Sprintf("older_than, statuses, chunk_delay_ms and archive apply to prune_history only, not %s", req.Operation))
+		}
+		return nil
+	}
+	if _, err := historyPruningOf(req, time.Now()); err != nil {
+		return invalid(err.Error())
+	}
+	return nil
+}
+
+// archiveTable returns the table prune_history archives the approval requests of an allconfig table to
+func archiveTable(tableName string) string {
+	return tableName + DefaultArchiveSuffix
+}
+
+// pruneHistory removes the processed approval requests older than the cutoff, chunkSize at a time,
+// copying them to the archive table first with archive. Each batch is a selection of request IDs followed
+// by their deletion, so a failure leaves the batches already run removed and the result reports them.
+func (a *API) pruneHistory(ctx context.Context, connector connectors.DBConnector, tableName string, p historyPruning) (interface{}, error) {
+	result := &PrunedHistory{Table: a.approvalTable(tableName), Before: p.before, Statuses: p.statuses}
+	if p.archive {
+		result.ArchiveTable = archiveTable(tableName)
+		if err := createArchiveTable(ctx, connector, result.Table, result.ArchiveTable); err != nil {
+			return nil, fmt.Errorf("failed to create approval archive: %w", err)
+		}
+	}
+
+	for {
+		deleted, err := a.pruneBatch(ctx, connector, result.Table, result.ArchiveTable, p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prune approval history after %d requests: %w", result.Deleted, err)
+		}
+		if deleted == 0 {
+			break
+		}
+		result.Batches++
+		result.Deleted += int64(deleted)
+		if deleted < p.chunkSize {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to prune approval history after %d requests: %w", result.Deleted, ctx.Err())
+		case <-time.After(p.delay):
+		}
+	}
+
+	a.logger.InfoContext(ctx, "approval history pruned", "table", result.Table, "before", result.Before, "deleted", result.Deleted, "archive_table", result.ArchiveTable)
+	return result, nil
+}
+
+// createArchiveTable creates the archive of an approval table with the same columns, unless it exists.
+// MongoDB creates the collection on the first write.
+func createArchiveTable(ctx context.Context, connector connectors.DBConnector, approvalTable, archive string) error {
+	var query string
+	switch connector.GetType() {
+	case "mysql":
+		query = "CREATE TABLE IF NOT EXISTS " + sqlTable(ctx, archive) + " LIKE " + sqlTable(ctx, approvalTable)
+	case "postgresql":
+		query = "CREATE TABLE IF NOT EXISTS " + sqlTable(ctx, archive) + " (LIKE " + sqlTable(ctx, approvalTable) + " INCLUDING ALL)"
+	default:
+		return nil
+	}
+	_, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": query})
+	return err
+}
+
+// pruneBatch removes the next chunkSize approval requests to prune, oldest first, returning how many it
+// found. Archived rows are copied so that a copy left by a failed batch is not copied twice.
+func (a *API) pruneBatch(ctx context.Context, connector connectors.DBConnector, approvalTable, archive string, p historyPruning) (int, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		d := sqlDialect(connector)
+		table := sqlTable(ctx, approvalTable)
+		statuses := strings.TrimSuffix(strings.Repeat("?, ", len(p.statuses)), ", ")
+		args := make([]interface{}, 0, len(p.statuses)+1)
+		for _, status := range p.statuses {
+			args = append(args, status)
+		}
+		query := "SELECT request_id FROM " + table + " WHERE status IN (" + statuses + ") AND processed_at < ? ORDER BY processed_at"
+		rows, err := connector.Query(ctx, pageQuery(d, connectors.Bind(d, query), p.chunkSize, 0), append(args, p.before)...)
+		if err != nil {
+			return 0, err
+		}
+		var ids []interface{}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		if len(ids) == 0 {
+			return 0, nil
+		}
+
+		in := "request_id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")"
+		if archive != "" {
+			copyRows := "INSERT IGNORE INTO " + sqlTable(ctx, archive) + " SELECT * FROM " + table + " WHERE " + in
+			if connector.GetType() == "postgresql" {
+				copyRows = "INSERT INTO " + sqlTable(ctx, archive) + " SELECT * FROM " + table + " WHERE " + in + " ON CONFLICT DO NOTHING"
+			}
+			if _, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": connectors.Bind(d, copyRows), "args": ids}); err != nil {
+				return 0, fmt.Errorf("failed to archive approval requests: %w", err)
+			}
+		}
+		// The status is checked again so that a request can never be removed unless it was processed
+		remove := "DELETE FROM " + table + " WHERE " + in + " AND status IN (" + statuses + ")"
+		if _, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": connectors.Bind(d, remove), "args": append(ids, args...)}); err != nil {
+			return 0, err
+		}
+		return len(ids), nil
+
+	case "mongodb":
+		filter := map[string]interface{}{
+			"status":       map[string]interface{}{"$in": p.statuses},
+			"processed_at": map[string]interface{}{"$lt": p.before},
+		}
+		found, err := connector.Execute(ctx, "find", map[string]interface{}{
+			"collection": approvalTable,
+			"filter":     filter,
+			"sort":       map[string]interface{}{"processed_at": 1},
+			"limit":      p.chunkSize,
+		})
+		if err != nil {
+			return 0, err
+		}
+		requests, _ := found.([]map[string]interface{})
+		if len(requests) == 0 {
+			return 0, nil
+		}
+
+		ids := make([]interface{}, len(requests))
+		copies := make([]interface{}, len(requests))
+		for i, request := range requests {
+			ids[i] = request["request_id"]
+			copies[i] = map[string]interface{}{"replaceOne": map[string]interface{}{
+				"filter": map[string]interface{}{"request_id": request["request_id"]}, "replacement": request, "upsert": true,
+			}}
+		}
+		if archive != "" {
+			if _, err := connector.Execute(ctx, "bulkWrite", map[string]interface{}{"collection": archive, "operations": copies}); err != nil {
+				return 0, fmt.Errorf("failed to archive approval requests: %w", err)
+			}
+		}
+		if _, err := connector.Execute(ctx, "deleteMany", map[string]interface{}{
+			"collection": approvalTable,
+			"filter":     map[string]interface{}{"request_id": map[string]interface{}{"$in": ids}, "status": filter["status"]},
+		}); err != nil {
+			return 0, err
+		}
+		return len(requests), nil
+
+	default:
+		return 0, fmt.Errorf("unsupported database type")
+	}
+}
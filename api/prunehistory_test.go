@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOlderThan(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	for olderThan, want := range map[string]time.Time{
+		"90d":                  now.AddDate(0, 0, -90),
+		"36h":                  now.Add(-36 * time.Hour),
+		"2024-01-01T00:00:00Z": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		got, err := parseOlderThan(olderThan, now)
+		require.NoError(t, err, olderThan)
+		assert.True(t, want.Equal(got), "%s: %s", olderThan, got)
+	}
+
+	for _, olderThan := range []string{"", "soon", "3 days", "xd"} {
+		_, err := parseOlderThan(olderThan, now)
+		assert.ErrorContains(t, err, "older_than must be a timestamp, a duration or a number of days", olderThan)
+	}
+	_, err := parseOlderThan("0d", now)
+	assert.EqualError(t, err, `older_than must be a positive age, got "0d"`)
+	_, err = parseOlderThan("-1h", now)
+	assert.EqualError(t, err, `older_than must be a positive age, got "-1h"`)
+}
+
+func TestCheckPruneHistory(t *testing.T) {
+	check := func(req *AllConfigOperationRequest) error {
+		_, err := checkAllConfigOperation(req, "mysql")
+		return err
+	}
+	delay := 0
+	assert.NoError(t, check(&AllConfigOperationRequest{Operation: "prune_history", OlderThan: "30d"}))
+	assert.NoError(t, check(&AllConfigOperationRequest{Operation: "prune_history", OlderThan: "30d", Statuses: []string{"rejected"}, ChunkSize: 500, ChunkDelayMS: &delay, Archive: true}))
+
+	// Pending requests are never pruned
+	err := check(&AllConfigOperationRequest{Operation: "prune_history", OlderThan: "30d", Statuses: []string{"approved", "pending"}})
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	assert.Equal(t, `statuses must be among approved, rejected, got "pending"; pending requests are never pruned`, apiErr.Message)
+
+	assert.ErrorContains(t, check(&AllConfigOperationRequest{Operation: "prune_history"}), "older_than")
+	assert.EqualError(t, check(&AllConfigOperationRequest{Operation: "prune_history", OlderThan: "30d", ChunkSize: 20000}),
+		"prune_history takes a chunk_size between 1 and 10000 and cannot upsert")
+	delay = -5
+	assert.EqualError(t, check(&AllConfigOperationRequest{Operation: "prune_history", OlderThan: "30d", ChunkDelayMS: &delay}),
+		"chunk_delay_ms must be between 0 and 60000")
+	assert.EqualError(t, check(&AllConfigOperationRequest{Operation: "get_approval_history", OlderThan: "30d"}),
+		"older_than, statuses, chunk_delay_ms and archive apply to prune_history only, not get_approval_history")
+}
+
+// pruneRequest returns a prune_history request deleting chunks of two without pausing
+func pruneRequest(archive bool) *AllConfigOperationRequest {
+	delay := 0
+	req := &AllConfigOperationRequest{Operation: "prune_history", OlderThan: "30d", ChunkSize: 2, ChunkDelayMS: &delay, Archive: archive}
+	req.TableName = "allconfig"
+	req.LegacyMode = boolPtr(false)
+	return req
+}
+
+func TestPruneHistoryBatches(t *testing.T) {
+	conn := newServiceConnector("mysql")
+	selectIDs := "SELECT request_id FROM allconfig_approval_requests WHERE status IN (?, ?) AND processed_at < ? ORDER BY processed_at LIMIT 2"
+	for _, ids := range [][]driver.Value{{"r1", "r2"}, {"r3", "r4"}, {"r5"}} {
+		var rows [][]driver.Value
+		for _, id := range ids {
+			rows = append(rows, []driver.Value{id})
+		}
+		conn.On("Query", mock.Anything, selectIDs, mock.MatchedBy(func(args []interface{}) bool {
+			return len(args) == 3 && args[0] == "approved" && args[1] == "rejected"
+		})).Return(newMockRows(t, []string{"request_id"}, rows...), nil).Once()
+	}
+	var deletes [][]interface{}
+	conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["query"] == "DELETE FROM allconfig_approval_requests WHERE request_id IN (?, ?) AND status IN (?, ?)" ||
+			params["query"] == "DELETE FROM allconfig_approval_requests WHERE request_id IN (?) AND status IN (?, ?)"
+	})).Run(func(args mock.Arguments) {
+		deletes = append(deletes, args.Get(2).(map[string]interface{})["args"].([]interface{}))
+	}).Return(driver.RowsAffected(2), nil)
+
+	result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, pruneRequest(false))
+	require.NoError(t, err)
+	conn.AssertExpectations(t)
+
+	pruned := result.(*PrunedHistory)
+	assert.Equal(t, int64(5), pruned.Deleted)
+	assert.Equal(t, 3, pruned.Batches, "a chunk shorter than chunk_size ends the pruning")
+	assert.Equal(t, "allconfig_approval_requests", pruned.Table)
+	assert.Equal(t, []string{"approved", "rejected"}, pruned.Statuses)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, -30), pruned.Before, time.Minute)
+	assert.Empty(t, pruned.ArchiveTable)
+	assert.Equal(t, [][]interface{}{
+		{"r1", "r2", "approved", "rejected"},
+		{"r3", "r4", "approved", "rejected"},
+		{"r5", "approved", "rejected"},
+	}, deletes)
+}
+
+func TestPruneHistoryArchive(t *testing.T) {
+	conn := newServiceConnector("postgresql")
+	var statements []string
+	conn.On("Query", mock.Anything, queryContaining("SELECT request_id FROM allconfig_approval_requests WHERE status IN ($1, $2) AND processed_at < $3"), mock.Anything).
+		Return(newMockRows(t, []string{"request_id"}, []driver.Value{"r1"}), nil).Once()
+	conn.On("Execute", mock.Anything, "execute", mock.Anything).Run(func(args mock.Arguments) {
+		statements = append(statements, args.Get(2).(map[string]interface{})["query"].(string))
+	}).Return(driver.RowsAffected(1), nil)
+
+	result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, pruneRequest(true))
+	require.NoError(t, err)
+	assert.Equal(t, "allconfig_approval_archive", result.(*PrunedHistory).ArchiveTable)
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS allconfig_approval_archive (LIKE allconfig_approval_requests INCLUDING ALL)",
+		"INSERT INTO allconfig_approval_archive SELECT * FROM allconfig_approval_requests WHERE request_id IN ($1) ON CONFLICT DO NOTHING",
+		"DELETE FROM allconfig_approval_requests WHERE request_id IN ($1) AND status IN ($2, $3)",
+	}, statements)
+}
+
+func TestPruneHistoryMongoDB(t *testing.T) {
+	conn := newServiceConnector("mongodb")
+	page := []map[string]interface{}{
+		{"request_id": "r1", "status": "approved"},
+		{"request_id": "r2", "status": "rejected"},
+	}
+	conn.On("Execute", mock.Anything, "find", mock.MatchedBy(func(params map[string]interface{}) bool {
+		filter := params["filter"].(map[string]interface{})
+		return params["collection"] == "allconfig_approval_requests" && params["limit"] == 2 &&
+			assert.ObjectsAreEqual(map[string]interface{}{"$in": []string{"approved", "rejected"}}, filter["status"])
+	})).Return(page, nil).Once()
+	conn.On("Execute", mock.Anything, "find", mock.Anything).Return([]map[string]interface{}{}, nil).Once()
+	conn.On("Execute", mock.Anything, "bulkWrite", mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["collection"] == "allconfig_approval_archive" && len(params["operations"].([]interface{})) == 2
+	})).Return(nil, nil).Once()
+	conn.On("Execute", mock.Anything, "deleteMany", map[string]interface{}{
+		"collection": "allconfig_approval_requests",
+		"filter": map[string]interface{}{
+			"request_id": map[string]interface{}{"$in": []interface{}{"r1", "r2"}},
+			"status":     map[string]interface{}{"$in": []string{"approved", "rejected"}},
+		},
+	}).Return(nil, nil).Once()
+
+	result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, pruneRequest(true))
+	require.NoError(t, err)
+	conn.AssertExpectations(t)
+	assert.Equal(t, int64(2), result.(*PrunedHistory).Deleted)
+	assert.Equal(t, 1, result.(*PrunedHistory).Batches)
+}
+
+func TestPruneHistoryStopsOnCancel(t *testing.T) {
+	conn := newServiceConnector("mysql")
+	conn.On("Query", mock.Anything, mock.Anything, mock.Anything).
+		Return(newMockRows(t, []string{"request_id"}, []driver.Value{"r1"}, []driver.Value{"r2"}), nil).Once()
+	conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(driver.RowsAffected(2), nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := pruneRequest(false)
+	delay := 1000
+	req.ChunkDelayMS = &delay
+	_, err := NewAPI().executeAllConfigOperation(ctx, conn, req)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "failed to prune approval history after 2 requests")
+	conn.AssertExpectations(t)
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// DefaultQueryCacheBytes bounds the memory held by cached query results
+const DefaultQueryCacheBytes = 64 << 20
+
+// QueryCacheStats counts the lookups of the query cache and reports its size
+type QueryCacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`     // Entries dropped to stay within max_bytes
+	Invalidations int64 `json:"invalidations"` // Entries dropped by writes to their connection
+	Entries       int   `json:"entries"`
+	Bytes         int64 `json:"bytes"`
+	MaxBytes      int64 `json:"max_bytes"`
+}
+
+// queryCacheEntry is a cached query result, sized by its JSON encoding
+type queryCacheEntry struct {
+	key        string
+	connection string
+	result     interface{}
+	size       int64
+	stored     time.Time
+	expires    time.Time
+}
+
+// queryCache keeps the results of read queries sent with cache_ttl_seconds, evicting the least recently
+// used entries once their total size exceeds maxBytes
+type queryCache struct {
+	maxBytes int64
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Values are *queryCacheEntry
+	lru     *list.List               // Most recently used at the front
+	bytes   int64
+	stats   QueryCacheStats
+}
+
+func newQueryCache(maxBytes int64) *queryCache {
+	if maxBytes == 0 {
+		maxBytes = DefaultQueryCacheBytes
+	}
+	return &queryCache{
+		maxBytes: maxBytes,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// get returns the result cached under key together with its age, provided it has not expired and is
+// younger than maxAge
+func (c *queryCache) get(key string, maxAge time.Duration) (interface{}, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, 0, false
+	}
+	entry := element.Value.(*queryCacheEntry)
+	now := c.now()
+	age := now.Sub(entry.stored)
+	if !now.Before(entry.expires) || age >= maxAge {
+		c.remove(element)
+		c.stats.Misses++
+		return nil, 0, false
+	}
+	c.lru.MoveToFront(element)
+	c.stats.Hits++
+	return entry.result, age, true
+}
+
+// put caches the result of a query on connection under key for ttl. Results larger than the whole cache
+// are not kept.
+func (c *queryCache) put(key, connection string, result interface{}, ttl time.Duration) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	size := int64(len(body) + len(key) + len(connection))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	now := c.now()
+	c.entries[key] = c.lru.PushFront(&queryCacheEntry{
+		key:        key,
+		connection: connection,
+		result:     result,
+		size:       size,
+		stored:     now,
+		expires:    now.Add(ttl),
+	})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate drops every result cached for connection
+func (c *queryCache) invalidate(connection string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*queryCacheEntry).connection == connection {
+			c.remove(element)
+			c.stats.Invalidations++
+		}
+		element = next
+	}
+}
+
+// invalidateAll drops every cached result
+func (c *queryCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Invalidations += int64(len(c.entries))
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// remove drops an entry; callers hold c.mu
+func (c *queryCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*queryCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *queryCache) snapshot() QueryCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.bytes
+	stats.MaxBytes = c.maxBytes
+	return stats
+}
+
+// connectionHash identifies the database and credentials of a request without holding the password
+func connectionHash(req *DatabaseConnectionRequest) string {
+	h := sha256.New()
+	for _, field := range []string{req.Type, req.Host, strconv.Itoa(req.Port), req.Username, req.Password, req.Database, req.Schema, req.SSLMode, req.URI} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// queryCacheKey keys the result of a query by its connection, normalized SQL and arguments
+func queryCacheKey(connection, query string, args []interface{}) (string, bool) {
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	h.Write([]byte(connection))
+	h.Write([]byte{0})
+	h.Write([]byte(normalizeSQL(query)))
+	h.Write([]byte{0})
+	h.Write(encodedArgs)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// normalizeSQL collapses runs of whitespace outside quoted text into single spaces and drops a trailing
+// semicolon, so that queries differing only in layout share a cache entry
+func normalizeSQL(query string) string {
+	var b strings.Builder
+	var quote byte
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		}
+		b.WriteByte(c)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(b.String(), ";"))
+}
+
+// cachedQuery reports whether the result of an /execute request may be cached: a read query on a SQL
+// database sent with cache_ttl_seconds
+func cachedQuery(req *DatabaseOperationRequest) bool {
+	if req.CacheTTLSeconds <= 0 || !isSQLType(req.Type) || !sqlReadOperations[req.Operation] {
+		return false
+	}
+	class, _ := classifyOperation(req)
+	return class == StatementRead
+}
+
+// checkQueryCache rejects cache_ttl_seconds on requests whose result may not be cached
+func checkQueryCache(req *DatabaseOperationRequest) error {
+	if req.CacheTTLSeconds < 0 {
+		return fmt.Errorf("cache_ttl_seconds cannot be negative")
+	}
+	if req.CacheTTLSeconds > 0 && !cachedQuery(req) {
+		return fmt.Errorf("cache_ttl_seconds is only supported for read statements of the query and select operations on SQL databases")
+	}
+	return nil
+}
+
+// cachedResult looks up the cached result of a request sent with cache_ttl_seconds. On a miss it returns
+// the key to cache the result under, which is empty when the result is not to be cached.
+func (a *API) cachedResult(req *DatabaseOperationRequest) (result interface{}, age time.Duration, key string, hit bool) {
+	if a.queryCache == nil || !cachedQuery(req) {
+		return nil, 0, "", false
+	}
+	key, ok := queryCacheKey(connectionHash(&req.DatabaseConnectionRequest), req.Query, req.Args)
+	if !ok {
+		return nil, 0, "", false
+	}
+	// Results with their columns are cached apart from plain rows
+	if req.wantsColumns() {
+		key += ":" + req.resultFormat()
+	}
+	result, age, hit = a.queryCache.get(key, req.cacheTTL())
+	return result, age, key, hit
+}
+
+// executeCached runs an /execute operation, caching its result under the key returned by cachedResult and
+// dropping the connection's cached results after an operation that may have written
+func (a *API) executeCached(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest, key string) (interface{}, error) {
+	result, err := a.executeOperation(ctx, connector, req)
+	// A write may have applied even when it failed, so the connection's results are dropped either way
+	if class, _ := classifyOperation(req); class != StatementRead {
+		a.invalidateQueryCache(&req.DatabaseConnectionRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		a.queryCache.put(key, connectionHash(&req.DatabaseConnectionRequest), result, req.cacheTTL())
+	}
+	return result, nil
+}
+
+func (r *DatabaseOperationRequest) cacheTTL() time.Duration {
+	return time.Duration(r.CacheTTLSeconds) * time.Second
+}
+
+// invalidateQueryCache drops the cached results of a connection after an operation that may have written
+// to it
+func (a *API) invalidateQueryCache(conn *DatabaseConnectionRequest) {
+	if a.queryCache != nil {
+		a.queryCache.invalidate(connectionHash(conn))
+	}
+}
+
+// QueryCacheStats reports the hits, misses and size of the query cache
+func (a *API) QueryCacheStats() QueryCacheStats {
+	if a.queryCache == nil {
+		return QueryCacheStats{}
+	}
+	return a.queryCache.snapshot()
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/connectors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestQueryCache returns a cache of maxBytes whose clock is advanced through the returned pointer
+func newTestQueryCache(maxBytes int64) (*queryCache, *time.Time) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := newQueryCache(maxBytes)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestNormalizeSQL(t *testing.T) {
+	assert.Equal(t, "SELECT a, b FROM t WHERE c = 'x  y';", normalizeSQL("  SELECT a,\n\tb  FROM t\nWHERE c = 'x  y';;"))
+	assert.Equal(t, "SELECT 1", normalizeSQL("SELECT 1 ;"))
+
+	key, ok := queryCacheKey("conn", "SELECT *\nFROM t WHERE a = ?", []interface{}{1})
+	require.True(t, ok)
+	same, _ := queryCacheKey("conn", "SELECT * FROM t WHERE a = ?;", []interface{}{1})
+	assert.Equal(t, key, same)
+	otherArgs, _ := queryCacheKey("conn", "SELECT * FROM t WHERE a = ?", []interface{}{2})
+	assert.NotEqual(t, key, otherArgs)
+	otherConnection, _ := queryCacheKey("other", "SELECT * FROM t WHERE a = ?", []interface{}{1})
+	assert.NotEqual(t, key, otherConnection)
+}
+
+func TestQueryCacheTTL(t *testing.T) {
+	cache, now := newTestQueryCache(1 << 20)
+	cache.put("k", "conn", []string{"row"}, 10*time.Second)
+
+	*now = now.Add(4 * time.Second)
+	result, age, ok := cache.get("k", 10*time.Second)
+	require.True(t, ok)
+	assert.Equal(t, []string{"row"}, result)
+	assert.Equal(t, 4*time.Second, age)
+
+	// A request asking for fresher data than the entry misses
+	_, _, ok = cache.get("k", 3*time.Second)
+	assert.False(t, ok)
+
+	cache.put("k", "conn", []string{"row"}, 10*time.Second)
+	*now = now.Add(10 * time.Second)
+	_, _, ok = cache.get("k", time.Minute)
+	assert.False(t, ok, "expired entries miss")
+
+	stats := cache.snapshot()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Zero(t, stats.Entries)
+	assert.Zero(t, stats.Bytes)
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	// Each entry takes 9 bytes: a 5 byte result, a 1 byte key and a 3 byte connection
+	cache, _ := newTestQueryCache(20)
+	cache.put("a", "one", "aaa", time.Minute)
+	cache.put("b", "one", "bbb", time.Minute)
+
+	// Using a makes b the least recently used entry, so adding c evicts it
+	_, _, ok := cache.get("a", time.Minute)
+	require.True(t, ok)
+	cache.put("c", "one", "ccc", time.Minute)
+
+	_, _, ok = cache.get("b", time.Minute)
+	assert.False(t, ok)
+	_, _, ok = cache.get("a", time.Minute)
+	assert.True(t, ok)
+	_, _, ok = cache.get("c", time.Minute)
+	assert.True(t, ok)
+
+	// Results larger than the whole cache are not kept
+	cache.put("d", "one", "a result longer than the cache", time.Minute)
+	_, _, ok = cache.get("d", time.Minute)
+	assert.False(t, ok)
+
+	stats := cache.snapshot()
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(18), stats.Bytes)
+	assert.Equal(t, int64(20), stats.MaxBytes)
+}
+
+func TestQueryCacheInvalidate(t *testing.T) {
+	cache, _ := newTestQueryCache(1 << 20)
+	cache.put("a", "one", 1, time.Minute)
+	cache.put("b", "two", 2, time.Minute)
+	cache.put("c", "one", 3, time.Minute)
+
+	cache.invalidate("one")
+	_, _, ok := cache.get("a", time.Minute)
+	assert.False(t, ok)
+	_, _, ok = cache.get("c", time.Minute)
+	assert.False(t, ok)
+	_, _, ok = cache.get("b", time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), cache.snapshot().Invalidations)
+}
+
+func TestCheckQueryCache(t *testing.T) {
+	postgres := DatabaseConnectionRequest{Type: "postgresql"}
+	tests := []struct {
+		name string
+		req  DatabaseOperationRequest
+		err  string
+	}{
+		{name: "select", req: DatabaseOperationRequest{DatabaseConnectionRequest: postgres, Operation: "query", Query: "SELECT 1", CacheTTLSeconds: 10}},
+		{name: "uncached write", req: DatabaseOperationRequest{DatabaseConnectionRequest: postgres, Operation: "update", Query: "UPDATE t SET a = 1"}},
+		{
+			name: "negative",
+			req:  DatabaseOperationRequest{DatabaseConnectionRequest: postgres, Operation: "query", Query: "SELECT 1", CacheTTLSeconds: -1},
+			err:  "cache_ttl_seconds cannot be negative",
+		},
+		{
+			name: "write",
+			req:  DatabaseOperationRequest{DatabaseConnectionRequest: postgres, Operation: "execute", Query: "DELETE FROM t", CacheTTLSeconds: 10},
+			err:  "cache_ttl_seconds is only supported for read statements of the query and select operations on SQL databases",
+		},
+		{
+			name: "mongodb",
+			req: DatabaseOperationRequest{
+				DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mongodb"},
+				Operation:                 "find",
+				Params:                    map[string]interface{}{"collection": "users"},
+				CacheTTLSeconds:           10,
+			},
+			err: "cache_ttl_seconds is only supported for read statements of the query and select operations on SQL databases",
+		},
+	}
+	for _, tt := range tests {
+		err := checkQueryCache(&tt.req)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.name)
+		} else {
+			assert.EqualError(t, err, tt.err, tt.name)
+		}
+	}
+}
+
+func TestExecuteCachedInvalidatesOnWrite(t *testing.T) {
+	api := NewAPI()
+	connector, mockDB := newSQLMockConnector(t, "postgresql")
+	conn := queryingConnector{connector}
+	ctx := context.Background()
+	connection := DatabaseConnectionRequest{Type: "postgresql", Host: "db", Port: 5432, Database: "app"}
+	read := &DatabaseOperationRequest{DatabaseConnectionRequest: connection, Operation: "query", Query: "SELECT id FROM users", CacheTTLSeconds: 60}
+
+	// The first read runs the query and caches its rows
+	mockDB.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)))
+	_, _, key, hit := api.cachedResult(read)
+	require.False(t, hit)
+	_, err := api.executeCached(ctx, conn, read, key)
+	require.NoError(t, err)
+
+	cached, _, _, hit := api.cachedResult(read)
+	require.True(t, hit)
+	assert.Equal(t, []map[string]interface{}{{"id": int64(1)}}, cached)
+
+	// Reads without cache_ttl_seconds leave the cache alone
+	mockDB.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)))
+	_, err = api.executeCached(ctx, conn, &DatabaseOperationRequest{DatabaseConnectionRequest: connection, Operation: "query", Query: "SELECT id FROM users"}, "")
+	require.NoError(t, err)
+	_, _, _, hit = api.cachedResult(read)
+	require.True(t, hit)
+
+	// A write to another database keeps the cached rows, a write to the same one drops them
+	other := connection
+	other.Database = "audit"
+	connector.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(sqlmock.NewResult(1, 1), nil)
+	_, err = api.executeCached(ctx, conn, &DatabaseOperationRequest{DatabaseConnectionRequest: other, Operation: "insert", Query: "INSERT INTO events VALUES (1)"}, "")
+	require.NoError(t, err)
+	_, _, _, hit = api.cachedResult(read)
+	require.True(t, hit)
+
+	_, err = api.executeCached(ctx, conn, &DatabaseOperationRequest{DatabaseConnectionRequest: connection, Operation: "update", Query: "UPDATE users SET id = 2"}, "")
+	require.NoError(t, err)
+	_, _, _, hit = api.cachedResult(read)
+	assert.False(t, hit)
+	assert.NoError(t, mockDB.ExpectationsWereMet())
+	connector.AssertNumberOfCalls(t, "Execute", 2)
+
+	stats := api.QueryCacheStats()
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, int64(1), stats.Invalidations)
+}
+
+func TestExecuteServesCachedResults(t *testing.T) {
+	api := NewAPI()
+	handler := SetupRoutes(api)
+	body := map[string]interface{}{
+		"type": "mysql", "host": "db.invalid", "port": 3306, "username": "app", "password": "secret", "database": "app",
+		"operation": "query", "query": "SELECT id FROM users", "cache_ttl_seconds": 30,
+	}
+	connection := DatabaseConnectionRequest{Type: "mysql", Host: "db.invalid", Port: 3306, Username: "app", Password: "secret", Database: "app"}
+	key, _ := queryCacheKey(connectionHash(&connection), "SELECT id FROM users", nil)
+	api.queryCache.put(key, connectionHash(&connection), []map[string]interface{}{{"id": 1}}, time.Minute)
+
+	// The cached rows are served without connecting to the unreachable host
+	rr := serveConfigs(handler, http.MethodPost, "/v1/execute", body, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response struct {
+		Data       []map[string]interface{} `json:"data"`
+		Cached     bool                     `json:"cached"`
+		CacheAgeMs *float64                 `json:"cache_age_ms"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}}, response.Data)
+	assert.True(t, response.Cached)
+	assert.NotNil(t, response.CacheAgeMs)
+
+	body["operation"], body["query"] = "execute", "DELETE FROM users"
+	rr = serveConfigs(handler, http.MethodPost, "/v1/execute", body, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cache_ttl_seconds is only supported for read statements")
+
+	rr = serveConfigs(handler, http.MethodGet, "/v1/metrics", nil, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var metrics struct {
+		Data Metrics `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &metrics))
+	assert.Equal(t, int64(1), metrics.Data.QueryCache.Hits)
+	assert.Equal(t, 1, metrics.Data.QueryCache.Entries)
+	assert.Equal(t, int64(DefaultQueryCacheBytes), metrics.Data.QueryCache.MaxBytes)
+	assert.Equal(t, connectors.DefaultSlowStatementThreshold.Milliseconds(), metrics.Data.Statements.SlowThresholdMs)
+}
+
+func TestWithStatementLogger(t *testing.T) {
+	statements := connectors.NewStatementLogger(connectors.StatementLogOptions{SlowThreshold: time.Minute, HideText: true})
+	server := NewServer(config.ServerConfig{Port: 8080}, WithStatementLogger(statements))
+	assert.Same(t, statements, server.api.statements)
+	assert.Equal(t, int64(60000), server.api.statements.Stats().SlowThresholdMs)
+
+	// A nil logger keeps the default
+	assert.NotNil(t, NewServer(config.ServerConfig{Port: 8080}, WithStatementLogger(nil)).api.statements)
+}
+
+func TestWithQueryCacheBytes(t *testing.T) {
+	server := NewServer(config.ServerConfig{Port: 8080}, WithQueryCacheBytes(1024))
+	assert.Equal(t, int64(1024), server.api.QueryCacheStats().MaxBytes)
+
+	server = NewServer(config.ServerConfig{Port: 8080}, WithQueryCacheBytes(-1))
+	assert.Nil(t, server.api.queryCache)
+	_, _, key, hit := server.api.cachedResult(&DatabaseOperationRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mysql"},
+		Operation:                 "query",
+		Query:                     "SELECT 1",
+		CacheTTLSeconds:           10,
+	})
+	assert.False(t, hit)
+	assert.Empty(t, key)
+}
+
+func TestBatchWrites(t *testing.T) {
+	batch := &BatchRequest{
+		DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mysql"},
+		Statements:                []BatchStatement{{Query: "SELECT 1"}, {Operation: "query", Query: "SELECT 2"}},
+	}
+	assert.False(t, batch.writes())
+
+	batch.Statements = append(batch.Statements, BatchStatement{Query: "UPDATE t SET a = 1"})
+	assert.True(t, batch.writes())
+}
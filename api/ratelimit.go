@@ -0,0 +1,178 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader identifies a client for per-key rate limits
+const APIKeyHeader = "X-API-Key"
+
+// Default rate limit settings
+const (
+	DefaultRequestsPerSecond = 10
+	DefaultBurst             = 20
+	DefaultLimiterIdleTTL    = 10 * time.Minute
+)
+
+// RateLimit is a token bucket refilled at RequestsPerSecond holding at most Burst tokens
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// RateLimitPolicy configures per-client rate limiting
+type RateLimitPolicy struct {
+	Default RateLimit
+	// Overrides by API key or client IP. Requests are keyed by their X-API-Key only when it
+	// appears here, so unknown keys cannot be rotated to escape the per-IP limit.
+	Overrides map[string]RateLimit
+	IdleTTL   time.Duration // Buckets unused for this long are evicted
+}
+
+// bucket is the token bucket of one client
+type bucket struct {
+	limit    RateLimit
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter tracks a token bucket per client key
+type rateLimiter struct {
+	policy    RateLimitPolicy
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// newRateLimiter creates a limiter, filling unset policy values with defaults
+func newRateLimiter(policy RateLimitPolicy) *rateLimiter {
+	if policy.Default.RequestsPerSecond <= 0 {
+		policy.Default.RequestsPerSecond = DefaultRequestsPerSecond
+	}
+	if policy.Default.Burst <= 0 {
+		policy.Default.Burst = DefaultBurst
+	}
+	if policy.IdleTTL <= 0 {
+		policy.IdleTTL = DefaultLimiterIdleTTL
+	}
+	return &rateLimiter{
+		policy:  policy,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// limitFor returns the limit applying to key, falling back to the default
+func (l *rateLimiter) limitFor(key string) RateLimit {
+	limit, ok := l.policy.Overrides[key]
+	if !ok {
+		return l.policy.Default
+	}
+	if limit.RequestsPerSecond <= 0 {
+		limit.RequestsPerSecond = l.policy.Default.RequestsPerSecond
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Max(1, math.Ceil(limit.RequestsPerSecond)))
+	}
+	return limit
+}
+
+// allow takes a token from key's bucket, returning how long to wait when none is left
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		limit := l.limitFor(key)
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.RequestsPerSecond)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / b.limit.RequestsPerSecond * float64(time.Second))
+	return false, wait
+}
+
+// sweep evicts idle buckets at most once per IdleTTL; callers hold l.mu
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.policy.IdleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= l.policy.IdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// size returns the number of tracked clients
+func (l *rateLimiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// clientKey identifies the client of r by a configured API key or else by remote IP
+func (l *rateLimiter) clientKey(r *http.Request) string {
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+		if _, ok := l.policy.Overrides[apiKey]; ok {
+			return apiKey
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitExempt lists paths that are never rate limited
+var rateLimitExempt = map[string]bool{
+	"/health":     true,
+	"/ready":      true,
+	"/metrics":    true,
+	"/v1/health":  true,
+	"/v1/ready":   true,
+	"/v1/metrics": true,
+}
+
+// rateLimitMiddleware rejects requests over the client's rate with 429 Too Many Requests
+func (a *API) rateLimitMiddleware(next http.Handler) http.Handler {
+	if a.limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimitExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, wait := a.limiter.allow(a.limiter.clientKey(r))
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			a.sendError(w, http.StatusTooManyRequests, ErrorCodeRateLimited, fmt.Sprintf("Rate limit exceeded, retry after %d seconds", retryAfter))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
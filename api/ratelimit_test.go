@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced time source for the limiter
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(policy RateLimitPolicy) (*rateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(policy)
+	limiter.now = clock.now
+	return limiter, clock
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	limiter, clock := newTestLimiter(RateLimitPolicy{Default: RateLimit{RequestsPerSecond: 2, Burst: 3}})
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.allow("10.0.0.1")
+		assert.True(t, allowed, "request %d within burst", i)
+	}
+	allowed, wait := limiter.allow("10.0.0.1")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Tokens refill at the configured rate
+	clock.advance(500 * time.Millisecond)
+	allowed, _ = limiter.allow("10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _ = limiter.allow("10.0.0.1")
+	assert.False(t, allowed)
+
+	// The bucket never holds more than the burst
+	clock.advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		allowed, _ = limiter.allow("10.0.0.1")
+		assert.True(t, allowed)
+	}
+	allowed, _ = limiter.allow("10.0.0.1")
+	assert.False(t, allowed)
+}
+
+func TestRateLimiterKeysAreIndependent(t *testing.T) {
+	limiter, _ := newTestLimiter(RateLimitPolicy{
+		Default:   RateLimit{RequestsPerSecond: 1, Burst: 1},
+		Overrides: map[string]RateLimit{"batch-key": {RequestsPerSecond: 5, Burst: 5}},
+	})
+
+	allowed, _ := limiter.allow("10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _ = limiter.allow("10.0.0.1")
+	assert.False(t, allowed)
+
+	allowed, _ = limiter.allow("10.0.0.2")
+	assert.True(t, allowed, "another client has its own bucket")
+
+	for i := 0; i < 5; i++ {
+		allowed, _ = limiter.allow("batch-key")
+		assert.True(t, allowed, "override burst %d", i)
+	}
+	allowed, _ = limiter.allow("batch-key")
+	assert.False(t, allowed)
+}
+
+func TestRateLimiterEvictsIdleKeys(t *testing.T) {
+	limiter, clock := newTestLimiter(RateLimitPolicy{IdleTTL: time.Minute})
+
+	limiter.allow("10.0.0.1")
+	limiter.allow("10.0.0.2")
+	assert.Equal(t, 2, limiter.size())
+
+	clock.advance(30 * time.Second)
+	limiter.allow("10.0.0.2")
+	clock.advance(45 * time.Second)
+	limiter.allow("10.0.0.3")
+	assert.Equal(t, 2, limiter.size(), "only the idle client is evicted")
+}
+
+func TestRateLimiterClientKey(t *testing.T) {
+	limiter, _ := newTestLimiter(RateLimitPolicy{Overrides: map[string]RateLimit{"known-key": {}}})
+
+	req := httptest.NewRequest(http.MethodPost, "/execute", nil)
+	req.RemoteAddr = "192.0.2.10:54321"
+	assert.Equal(t, "192.0.2.10", limiter.clientKey(req))
+
+	req.Header.Set(APIKeyHeader, "known-key")
+	assert.Equal(t, "known-key", limiter.clientKey(req))
+
+	// Unknown keys fall back to the client IP so rotating keys does not reset the limit
+	req.Header.Set(APIKeyHeader, "made-up-key")
+	assert.Equal(t, "192.0.2.10", limiter.clientKey(req))
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	api := NewAPI()
+	api.limiter = newRateLimiter(RateLimitPolicy{
+		Default:   RateLimit{RequestsPerSecond: 0.5, Burst: 2},
+		Overrides: map[string]RateLimit{"key-b": {RequestsPerSecond: 0.5, Burst: 2}},
+	})
+	handler := SetupRoutes(api)
+
+	send := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.10:1234"
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, send("/execute", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, send("/execute", "").Code)
+
+	rr := send("/execute", "")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+	assert.Equal(t, ErrorCodeRateLimited, response.ErrorCode)
+	assert.Contains(t, response.Error, "Rate limit exceeded")
+
+	// A configured API key from the same address has its own bucket
+	assert.Equal(t, http.StatusMethodNotAllowed, send("/execute", "key-b").Code)
+
+	// Health checks are exempt
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, send("/health", "").Code)
+	}
+}
+
+func TestRateLimitDisabledByDefault(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+	for i := 0; i < 50; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/execute", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default readiness check settings
+const (
+	DefaultReadyTimeout  = 2 * time.Second // Per-database ping timeout
+	DefaultReadyCacheTTL = 5 * time.Second // How long a readiness result is reused
+)
+
+// DatabaseStatus is the readiness of one connection profile
+type DatabaseStatus struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Status    string `json:"status"` // up or down
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ReadinessReport is the result of pinging every connection profile
+type ReadinessReport struct {
+	Ready     bool             `json:"ready"`
+	Databases []DatabaseStatus `json:"databases"`
+	CheckedAt time.Time        `json:"checked_at"`
+}
+
+// readinessChecker pings the connection profiles and caches the report so that
+// aggressive probes do not turn into a ping storm
+type readinessChecker struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+	now      func() time.Time
+	mu       sync.Mutex
+	cached   *ReadinessReport
+}
+
+// newReadinessChecker creates a checker, filling unset values with defaults
+func newReadinessChecker(timeout, cacheTTL time.Duration) *readinessChecker {
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultReadyCacheTTL
+	}
+	return &readinessChecker{timeout: timeout, cacheTTL: cacheTTL, now: time.Now}
+}
+
+// check returns the cached report while it is fresh and otherwise pings all profiles in parallel.
+// Concurrent callers wait for a single round of pings rather than starting their own.
+func (c *readinessChecker) check(ctx context.Context, a *API) ReadinessReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && c.now().Sub(c.cached.CheckedAt) < c.cacheTTL {
+		return *c.cached
+	}
+
+	profiles := a.profileList()
+	statuses := make([]DatabaseStatus, len(profiles))
+	var wg sync.WaitGroup
+	for i, p := range profiles {
+		wg.Add(1)
+		go func(i int, p *profile) {
+			defer wg.Done()
+			statuses[i] = c.ping(ctx, p)
+			if statuses[i].Status == "up" {
+				a.registry.MarkPinged(p.Name)
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	report := ReadinessReport{Ready: true, Databases: statuses, CheckedAt: c.now()}
+	for _, status := range statuses {
+		if status.Status != "up" {
+			report.Ready = false
+		}
+	}
+	c.cached = &report
+	return report
+}
+
+// ping connects the profile if needed and pings it within the checker timeout
+func (c *readinessChecker) ping(ctx context.Context, p *profile) DatabaseStatus {
+	status, _ := pingProfile(ctx, p, c.timeout)
+	return status
+}
+
+// store replaces the cached report, so that probes answer with it until it goes stale
+func (c *readinessChecker) store(report ReadinessReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cached = &report
+}
+
+// pingProfile connects the profile if needed and pings it within timeout, returning its status and the
+// error of a failed connect or ping
+func pingProfile(ctx context.Context, p *profile, timeout time.Duration) (DatabaseStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	status := DatabaseStatus{Name: p.Name, Type: p.connector().GetType(), Status: "up"}
+	start := time.Now()
+	err := p.connect(ctx)
+	if err == nil {
+		err = p.connector().Ping(ctx)
+	}
+	status.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Status = "down"
+		status.Error = connectionFailureMessage("Ping failed", err)
+	}
+	return status, err
+}
+
+// ReadyHandler reports whether every configured connection profile answers a ping,
+// returning 200 when all are up and 503 otherwise
+func (a *API) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	// Pings are shared with other probes, so they must not be cancelled with this request
+	report := a.readiness.check(context.WithoutCancel(r.Context()), a)
+	if report.Ready {
+		a.sendJSON(w, http.StatusOK, DatabaseResponse{
+			Success:   true,
+			Message:   "Service is ready",
+			Data:      report,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	a.sendJSON(w, http.StatusServiceUnavailable, DatabaseResponse{
+		Success:   false,
+		Error:     "One or more databases are unavailable",
+		ErrorCode: ErrorCodeUnavailable,
+		Data:      report,
+		Timestamp: time.Now(),
+	})
+}
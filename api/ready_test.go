@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newPingConnector returns a connected mock connector whose Ping returns err
+func newPingConnector(dbType string, err error) *connectortest.MockDBConnector {
+	conn := newProfileConnector(dbType)
+	conn.On("Ping", mock.Anything).Return(err)
+	return conn
+}
+
+func newReadyAPI(connectors map[string]*connectortest.MockDBConnector) *API {
+	api := NewAPI()
+	for name, conn := range connectors {
+		api.addProfile(ConnectionProfile{Name: name, Connector: conn})
+	}
+	return api
+}
+
+func serveReady(t *testing.T, api *API) (int, ReadinessReport) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	SetupRoutes(api).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/ready", nil))
+
+	var response struct {
+		Data ReadinessReport `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return rr.Code, response.Data
+}
+
+func TestReadyHandlerAllUp(t *testing.T) {
+	api := newReadyAPI(map[string]*connectortest.MockDBConnector{
+		"mysql":   newPingConnector("mysql", nil),
+		"mongodb": newPingConnector("mongodb", nil),
+	})
+
+	code, report := serveReady(t, api)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Ready)
+	require.Len(t, report.Databases, 2)
+	assert.Equal(t, DatabaseStatus{Name: "mongodb", Type: "mongodb", Status: "up", LatencyMS: report.Databases[0].LatencyMS}, report.Databases[0])
+	assert.Equal(t, "mysql", report.Databases[1].Name)
+}
+
+func TestReadyHandlerPartial(t *testing.T) {
+	api := newReadyAPI(map[string]*connectortest.MockDBConnector{
+		"mysql":      newPingConnector("mysql", nil),
+		"postgresql": newPingConnector("postgresql", errors.New("connection refused")),
+	})
+
+	code, report := serveReady(t, api)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Ready)
+	require.Len(t, report.Databases, 2)
+	assert.Equal(t, "up", report.Databases[0].Status)
+	assert.Equal(t, "down", report.Databases[1].Status)
+	assert.Contains(t, report.Databases[1].Error, "connection refused")
+}
+
+func TestReadyHandlerAllDown(t *testing.T) {
+	unreachable := new(connectortest.MockDBConnector)
+	unreachable.On("IsConnected").Return(false)
+	unreachable.On("GetType").Return("mysql")
+	unreachable.On("Connect", mock.Anything).Return(errors.New("dial tcp: i/o timeout"))
+
+	api := newReadyAPI(map[string]*connectortest.MockDBConnector{
+		"mysql":   unreachable,
+		"mongodb": newPingConnector("mongodb", errors.New("server selection timeout")),
+	})
+
+	code, report := serveReady(t, api)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Ready)
+	for _, status := range report.Databases {
+		assert.Equal(t, "down", status.Status, status.Name)
+		assert.NotEmpty(t, status.Error, status.Name)
+	}
+	unreachable.AssertNotCalled(t, "Ping", mock.Anything)
+}
+
+func TestReadyHandlerWithoutProfiles(t *testing.T) {
+	code, report := serveReady(t, NewAPI())
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Ready)
+	assert.Empty(t, report.Databases)
+}
+
+func TestReadinessCachesResult(t *testing.T) {
+	conn := newPingConnector("mysql", nil)
+	api := newReadyAPI(map[string]*connectortest.MockDBConnector{"mysql": conn})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	api.readiness.now = func() time.Time { return now }
+
+	serveReady(t, api)
+	serveReady(t, api)
+	conn.AssertNumberOfCalls(t, "Ping", 1)
+
+	now = now.Add(DefaultReadyCacheTTL)
+	serveReady(t, api)
+	conn.AssertNumberOfCalls(t, "Ping", 2)
+}
+
+// blockingPinger is a connector whose Ping blocks until its context is done
+type blockingPinger struct {
+	*connectortest.MockDBConnector
+}
+
+func (b blockingPinger) Ping(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReadinessPingTimeout(t *testing.T) {
+	api := NewAPI()
+	api.addProfile(ConnectionProfile{Name: "postgresql", Connector: blockingPinger{newProfileConnector("postgresql")}})
+	api.readiness = newReadinessChecker(20*time.Millisecond, time.Second)
+
+	start := time.Now()
+	code, report := serveReady(t, api)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, report.Databases[0].Error, "deadline exceeded")
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+
+	"db-connectors/connectors"
+)
+
+// DefaultMaxResultBytes bounds the approximate JSON size of the rows one query returns
+const DefaultMaxResultBytes = 64 << 20
+
+// limitResults returns a context limiting the query results read with it to the server's maximum
+func (a *API) limitResults(ctx context.Context) context.Context {
+	return connectors.ContextWithMaxResultBytes(ctx, a.maxResultBytes)
+}
+
+// readResult reads rows like rowsToMap up to the result size limit of ctx. Rows going over it fail with a
+// *connectors.ResultTooLargeError after calling cancel, which cancels the query so that the database
+// stops producing the rest before the rows are closed.
+func (a *API) readResult(ctx context.Context, rows *sql.Rows, cancel context.CancelFunc) ([]map[string]interface{}, error) {
+	size := connectors.NewResultSize(connectors.MaxResultBytesFromContext(ctx))
+	var results []map[string]interface{}
+	err := a.scanRows(rows, func(row map[string]interface{}) error {
+		if err := size.Add(row); err != nil {
+			cancel()
+			return err
+		}
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
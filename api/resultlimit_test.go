@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"db-connectors/config"
+	"db-connectors/connectors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelRecordingConnector runs queries on sqlmock and keeps the context of the last one
+type cancelRecordingConnector struct {
+	queryingConnector
+	ctx context.Context
+}
+
+func (c *cancelRecordingConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.ctx = ctx
+	return c.queryingConnector.Query(ctx, query, args...)
+}
+
+// largeRows returns n rows of about 100 bytes of JSON each
+func largeRows(n int) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "payload"})
+	for i := 0; i < n; i++ {
+		rows.AddRow(i, strings.Repeat("x", 80))
+	}
+	return rows
+}
+
+func TestQueryResultTooLarge(t *testing.T) {
+	connector, mockDB := newSQLMockConnector(t, "mysql")
+	conn := &cancelRecordingConnector{queryingConnector: queryingConnector{connector}}
+	mockDB.ExpectQuery("SELECT id, payload FROM events").WillReturnRows(largeRows(10000))
+
+	api := NewAPI()
+	api.maxResultBytes = 1000
+	req := &DatabaseOperationRequest{Operation: "query", Query: "SELECT id, payload FROM events"}
+	_, err := api.executeOperation(api.limitResults(context.Background()), conn, req)
+
+	var tooLarge *connectors.ResultTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, int64(1000), tooLarge.Limit)
+	assert.Equal(t, 10, tooLarge.Rows)
+	assert.Greater(t, tooLarge.Bytes, int64(1000))
+	// The query was cancelled rather than read to the end
+	assert.ErrorIs(t, conn.ctx.Err(), context.Canceled)
+}
+
+func TestQueryResultWithinLimit(t *testing.T) {
+	connector, mockDB := newSQLMockConnector(t, "mysql")
+	mockDB.ExpectQuery("SELECT id, payload FROM events").WillReturnRows(largeRows(100))
+
+	api := NewAPI()
+	req := &DatabaseOperationRequest{Operation: "query", Query: "SELECT id, payload FROM events"}
+	result, err := api.executeOperation(api.limitResults(context.Background()), queryingConnector{connector}, req)
+	require.NoError(t, err)
+	assert.Len(t, result, 100)
+
+	// A negative limit lets results of any size through
+	mockDB.ExpectQuery("SELECT id, payload FROM events").WillReturnRows(largeRows(100))
+	api.maxResultBytes = -1
+	result, err = api.executeOperation(api.limitResults(context.Background()), queryingConnector{connector}, req)
+	require.NoError(t, err)
+	assert.Len(t, result, 100)
+}
+
+func TestBatchStatementResultTooLarge(t *testing.T) {
+	connector, mockDB := newSQLMockConnector(t, "postgresql")
+	mockDB.ExpectQuery("SELECT id, payload FROM events").WillReturnRows(largeRows(1000))
+
+	api := NewAPI()
+	api.maxResultBytes = 500
+	result, err := api.executeBatch(api.limitResults(context.Background()), connector, &BatchRequest{
+		Statements: []BatchStatement{{Query: "SELECT id, payload FROM events"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Statements, 1)
+	assert.False(t, result.Statements[0].Success)
+	assert.Contains(t, result.Statements[0].Error, "query result exceeds the limit of 500 bytes: read 5 rows")
+	assert.Nil(t, result.Statements[0].Rows)
+}
+
+func TestSendResultTooLarge(t *testing.T) {
+	rr := httptest.NewRecorder()
+	err := fmt.Errorf("failed to run query: %w", &connectors.ResultTooLargeError{Limit: 1000, Rows: 12, Bytes: 1040})
+	NewAPI().sendDatabaseError(rr, "Operation failed", err)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeResultTooLarge, response.ErrorCode)
+	assert.Equal(t, "Operation failed: failed to run query: query result exceeds the limit of 1000 bytes: read 12 rows of about 1040 bytes", response.Error)
+	assert.Equal(t, map[string]interface{}{"limit": 1000.0, "rows_read": 12.0, "bytes_read": 1040.0}, response.Details)
+}
+
+func TestWithMaxResultBytes(t *testing.T) {
+	assert.Equal(t, int64(DefaultMaxResultBytes), NewServer(config.ServerConfig{Port: 8080}, WithMaxResultBytes(0)).api.maxResultBytes)
+	assert.Equal(t, int64(4096), NewServer(config.ServerConfig{Port: 8080}, WithMaxResultBytes(4096)).api.maxResultBytes)
+	assert.Equal(t, int64(-1), NewServer(config.ServerConfig{Port: 8080}, WithMaxResultBytes(-1)).api.maxResultBytes)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"db-connectors/connectors"
+)
+
+// returningOperations are the SQL operations that can return the rows they write
+var returningOperations = map[string]bool{
+	"insert":  true,
+	"update":  true,
+	"delete":  true,
+	"execute": true,
+}
+
+// WriteResult is the result of a write sent with returning or a RETURNING clause
+type WriteResult struct {
+	RowsAffected int64                    `json:"rows_affected"`
+	LastInsertID *int64                   `json:"last_insert_id,omitempty"` // ID generated by a MySQL insert
+	Rows         []map[string]interface{} `json:"rows,omitempty"`           // Rows of the RETURNING clause
+}
+
+// hasReturningClause reports whether a statement has a RETURNING clause of its own, rather than one of a
+// statement nested in it
+func hasReturningClause(dbType, query string) bool {
+	for _, token := range tokenizeSQL(dbType, query) {
+		if token.text == "RETURNING" && token.depth == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// returnsRows reports whether a write request asks for what it wrote
+func (r *DatabaseOperationRequest) returnsRows() bool {
+	return r.Returning || hasReturningClause(r.Type, r.Query)
+}
+
+// checkReturning rejects returning on operations other than SQL writes, and on PostgreSQL statements
+// that do not say what to return
+func checkReturning(req *DatabaseOperationRequest) error {
+	if !req.Returning {
+		return nil
+	}
+	if !isSQLType(req.Type) || !returningOperations[req.Operation] {
+		return fmt.Errorf("returning is only supported for the insert, update, delete and execute operations on SQL databases")
+	}
+	if req.Type == "postgresql" && !hasReturningClause(req.Type, req.Query) {
+		return fmt.Errorf("returning on PostgreSQL requires a RETURNING clause naming the columns to return")
+	}
+	return nil
+}
+
+// executeReturning runs a write returning what it wrote. Statements with a RETURNING clause run as
+// queries whose rows are read like query results; MySQL, which has no RETURNING, reports the ID
+// generated by an insert instead.
+func (a *API) executeReturning(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest) (*WriteResult, error) {
+	if !hasReturningClause(req.Type, req.Query) {
+		result, err := connector.Execute(ctx, req.Operation, map[string]interface{}{
+			"query": req.Query,
+			"args":  []interface{}(req.Args),
+		})
+		if err != nil {
+			return nil, err
+		}
+		res, ok := result.(sql.Result)
+		if !ok {
+			return nil, fmt.Errorf("unexpected result of %s: %T", req.Operation, result)
+		}
+		write := &WriteResult{}
+		if write.RowsAffected, err = res.RowsAffected(); err != nil {
+			return nil, err
+		}
+		if id, err := res.LastInsertId(); err == nil {
+			write.LastInsertID = &id
+		}
+		return write, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows, err := connector.Query(ctx, req.Query, req.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := a.readResult(ctx, rows, cancel)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []map[string]interface{}{}
+	}
+	// Every row written returns one row
+	return &WriteResult{RowsAffected: int64(len(results)), Rows: results}, nil
+}
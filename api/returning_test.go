@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writingConnector runs queries and writes on sqlmock the way the SQL connectors do
+type writingConnector struct {
+	queryingConnector
+}
+
+func (c writingConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	args, _ := params["args"].([]interface{})
+	return c.db.ExecContext(ctx, params["query"].(string), args...)
+}
+
+func runWrite(t *testing.T, dbType string, req *DatabaseOperationRequest, expect func(sqlmock.Sqlmock)) (interface{}, error) {
+	connector, mockDB := newSQLMockConnector(t, dbType)
+	expect(mockDB)
+	req.Type = dbType
+	result, err := NewAPI().executeOperation(context.Background(), writingConnector{queryingConnector{connector}}, req)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+	return result, err
+}
+
+func TestInsertReturningID(t *testing.T) {
+	req := &DatabaseOperationRequest{Operation: "insert", Query: "INSERT INTO orders (status) VALUES ($1) RETURNING id", Args: []interface{}{"new"}}
+	result, err := runWrite(t, "postgresql", req, func(mockDB sqlmock.Sqlmock) {
+		mockDB.ExpectQuery(`INSERT INTO orders \(status\) VALUES \(\$1\) RETURNING id`).WithArgs("new").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(42)))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &WriteResult{RowsAffected: 1, Rows: []map[string]interface{}{{"id": int64(42)}}}, result)
+}
+
+func TestUpdateReturningAll(t *testing.T) {
+	req := &DatabaseOperationRequest{Operation: "update", Query: "UPDATE orders SET status = 'shipped' WHERE batch = $1 RETURNING *", Args: []interface{}{7}, Returning: true}
+	result, err := runWrite(t, "postgresql", req, func(mockDB sqlmock.Sqlmock) {
+		mockDB.ExpectQuery("UPDATE orders SET status").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "batch"}).AddRow(int64(1), "shipped", int64(7)).AddRow(int64(2), "shipped", int64(7)))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &WriteResult{RowsAffected: 2, Rows: []map[string]interface{}{
+		{"id": int64(1), "status": "shipped", "batch": int64(7)},
+		{"id": int64(2), "status": "shipped", "batch": int64(7)},
+	}}, result)
+
+	// Matching nothing returns no rows rather than null
+	result, err = runWrite(t, "postgresql", req, func(mockDB sqlmock.Sqlmock) {
+		mockDB.ExpectQuery("UPDATE orders SET status").WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"id", "status", "batch"}))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &WriteResult{RowsAffected: 0, Rows: []map[string]interface{}{}}, result)
+}
+
+func TestMySQLInsertReturningLastInsertID(t *testing.T) {
+	req := &DatabaseOperationRequest{Operation: "insert", Query: "INSERT INTO orders (status) VALUES (?)", Args: []interface{}{"new"}, Returning: true}
+	result, err := runWrite(t, "mysql", req, func(mockDB sqlmock.Sqlmock) {
+		mockDB.ExpectExec(`INSERT INTO orders`).WithArgs("new").WillReturnResult(sqlmock.NewResult(42, 1))
+	})
+	require.NoError(t, err)
+	id := int64(42)
+	assert.Equal(t, &WriteResult{RowsAffected: 1, LastInsertID: &id}, result)
+}
+
+func TestWriteWithoutReturning(t *testing.T) {
+	req := &DatabaseOperationRequest{Operation: "insert", Query: "INSERT INTO audit (note) VALUES ('returning soon')"}
+	result, err := runWrite(t, "postgresql", req, func(mockDB sqlmock.Sqlmock) {
+		mockDB.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(0, 1))
+	})
+	require.NoError(t, err)
+	// Writes that ask for nothing back keep their plain result
+	assert.NotNil(t, result)
+	assert.NotEqual(t, "*api.WriteResult", fmt.Sprintf("%T", result))
+}
+
+func TestHasReturningClause(t *testing.T) {
+	assert.True(t, hasReturningClause("postgresql", "INSERT INTO t (a) VALUES (1) RETURNING id"))
+	assert.True(t, hasReturningClause("postgresql", "delete from t where a = 1 returning *"))
+	assert.False(t, hasReturningClause("postgresql", "INSERT INTO t (note) VALUES ('RETURNING')"))
+	assert.False(t, hasReturningClause("postgresql", "INSERT INTO t (a) VALUES (1) -- RETURNING id"))
+	assert.False(t, hasReturningClause("postgresql", "WITH moved AS (DELETE FROM t RETURNING *) INSERT INTO archive SELECT * FROM moved"))
+	assert.False(t, hasReturningClause("mysql", "INSERT INTO t (`returning`) VALUES (1)"))
+}
+
+func TestCheckReturning(t *testing.T) {
+	check := func(dbType, operation, query string) error {
+		req := &DatabaseOperationRequest{Operation: operation, Query: query, Returning: true}
+		req.Type = dbType
+		return checkReturning(req)
+	}
+	assert.NoError(t, check("postgresql", "insert", "INSERT INTO t (a) VALUES (1) RETURNING id"))
+	assert.NoError(t, check("mysql", "insert", "INSERT INTO t (a) VALUES (1)"))
+	assert.EqualError(t, check("postgresql", "insert", "INSERT INTO t (a) VALUES (1)"),
+		"returning on PostgreSQL requires a RETURNING clause naming the columns to return")
+	assert.EqualError(t, check("postgresql", "query", "SELECT 1"),
+		"returning is only supported for the insert, update, delete and execute operations on SQL databases")
+	assert.Error(t, check("mongodb", "insert", ""))
+}
+
+func TestReturnedRowsMaskedAndWritten(t *testing.T) {
+	api := newMaskingAPI(MaskingRule{Column: "ssn", Action: MaskRedact})
+	result := &WriteResult{RowsAffected: 1, Rows: []map[string]interface{}{{"id": int64(1), "ssn": "123-45-6789"}}}
+	masked := api.masker(maskingRequest(""), "").rows("INSERT INTO people (ssn) VALUES ($1) RETURNING id, ssn", result)
+	assert.Equal(t, &WriteResult{RowsAffected: 1, Rows: []map[string]interface{}{{"id": int64(1), "ssn": MaskedValue}}}, masked)
+	assert.Equal(t, "123-45-6789", result.Rows[0]["ssn"])
+
+	rw := &recordingWriter{}
+	require.NoError(t, WriteResultRows(rw, result))
+	require.NotNil(t, rw.rowsAffected)
+	assert.Equal(t, int64(1), *rw.rowsAffected)
+	assert.Equal(t, "123-45-6789", rw.rows[0]["ssn"])
+}
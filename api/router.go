@@ -0,0 +1,272 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// route is one method and path pattern registered on a Router
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.Handler
+}
+
+// Router is a small method-aware router. Patterns are literal segments, "{name}" for a single
+// path segment, or a trailing "{name...}" for the rest of the path; matched values are available
+// through r.PathValue. Paths are split into segments before they are unescaped, so a value sent with an
+// escaped slash, such as a config key "a%2Fb", fills a single segment. A path with a trailing slash matching no route is served by the route matching it
+// without the slash. HEAD is served by the GET route of a path, and OPTIONS answered with the methods of the
+// path in an Allow header. Unmatched paths and methods get JSON 404 and 405 responses, the latter with an
+// Allow header.
+type Router struct {
+	api    *API
+	routes []route
+}
+
+// NewRouter creates a router that reports errors through api's JSON responses
+func NewRouter(api *API) *Router {
+	return &Router{api: api}
+}
+
+// Handle registers handler for method and pattern
+func (rt *Router) Handle(method, pattern string, handler http.Handler) {
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		pattern:  pattern,
+		segments: splitPath(pattern),
+		handler:  handler,
+	})
+}
+
+// HandleFunc registers a handler function for method and pattern
+func (rt *Router) HandleFunc(method, pattern string, handler http.HandlerFunc) {
+	rt.Handle(method, pattern, handler)
+}
+
+// ServeHTTP dispatches to the first route matching the path and method
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rt.dispatch(w, r) {
+		return
+	}
+	escaped := r.URL.EscapedPath()
+	if trimmed := strings.TrimRight(escaped, "/"); trimmed != escaped && trimmed != "" {
+		// Serve /allconfig/ as /allconfig
+		if path, err := url.PathUnescape(trimmed); err == nil {
+			r.URL.Path, r.URL.RawPath = path, trimmed
+			if rt.dispatch(w, r) {
+				return
+			}
+		}
+	}
+
+	response := DatabaseResponse{
+		Success:   false,
+		Error:     "Not found: " + r.URL.Path,
+		ErrorCode: ErrorCodeNotFound,
+		Timestamp: time.Now(),
+	}
+	if apiRequest(r) {
+		response.Details = map[string]interface{}{"endpoints": rt.Endpoints()}
+	}
+	rt.api.sendJSON(w, http.StatusNotFound, response)
+}
+
+// dispatch serves r by the first route matching its path and method, answering OPTIONS, and 405 when routes
+// match the path but not the method. It reports false when no route matches the path.
+func (rt *Router) dispatch(w http.ResponseWriter, r *http.Request) bool {
+	path := splitPath(r.URL.EscapedPath())
+
+	var registered []string
+	for _, rte := range rt.routes {
+		values, ok := rte.match(path)
+		if !ok {
+			continue
+		}
+		if !rte.serves(r.Method) {
+			registered = append(registered, rte.method)
+			continue
+		}
+		for name, value := range values {
+			r.SetPathValue(name, value)
+		}
+		rte.handler.ServeHTTP(w, r)
+		return true
+	}
+
+	if len(registered) == 0 {
+		return false
+	}
+	w.Header().Set("Allow", strings.Join(allowedMethods(registered), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	rt.api.sendError(w, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+	return true
+}
+
+// Allowed returns the methods a request to path, escaped as in a URL, may use, as its Allow header lists
+// them, or nil when no route matches path
+func (rt *Router) Allowed(path string) []string {
+	registered := rt.registered(splitPath(path))
+	if trimmed := strings.TrimRight(path, "/"); len(registered) == 0 && trimmed != path && trimmed != "" {
+		registered = rt.registered(splitPath(trimmed))
+	}
+	if len(registered) == 0 {
+		return nil
+	}
+	return allowedMethods(registered)
+}
+
+// registered returns the methods of the routes matching path
+func (rt *Router) registered(path []string) []string {
+	var methods []string
+	for _, rte := range rt.routes {
+		if _, ok := rte.match(path); ok {
+			methods = append(methods, rte.method)
+		}
+	}
+	return methods
+}
+
+// allowedMethods returns the methods a path with routes for registered may be requested with, in sorted
+// order: those, HEAD where there is a GET, and OPTIONS
+func allowedMethods(registered []string) []string {
+	methods := append([]string{http.MethodOptions}, registered...)
+	if slices.Contains(registered, http.MethodGet) {
+		methods = append(methods, http.MethodHead)
+	}
+	return uniqueSorted(methods)
+}
+
+// Endpoints lists the method and pattern of every route under /v1, such as "GET /v1/health", sorted by pattern
+func (rt *Router) Endpoints() []string {
+	var versioned []route
+	for _, rte := range rt.routes {
+		if strings.HasPrefix(rte.pattern, "/v1/") {
+			versioned = append(versioned, rte)
+		}
+	}
+	sort.SliceStable(versioned, func(i, j int) bool { return versioned[i].pattern < versioned[j].pattern })
+	endpoints := make([]string, len(versioned))
+	for i, rte := range versioned {
+		endpoints[i] = rte.method + " " + rte.pattern
+	}
+	return endpoints
+}
+
+// allowMethod answers 405, with an Allow header, unless r uses method, or HEAD where method is GET, so that a
+// handler served outside the router rejects other methods the way the router does. It reports whether r may
+// go on.
+func (a *API) allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if (route{method: method}).serves(r.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(allowedMethods([]string{method}), ", "))
+	a.sendError(w, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
+	return false
+}
+
+// apiRequest reports whether r looks like it comes from an API client rather than a browser: it is under
+// /v1 or accepts JSON
+func apiRequest(r *http.Request) bool {
+	if r.URL.Path == "/v1" || strings.HasPrefix(r.URL.Path, "/v1/") {
+		return true
+	}
+	return acceptsJSON(r)
+}
+
+// acceptsJSON reports whether the Accept header of r asks for JSON
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serves reports whether the route serves requests with method; GET routes serve HEAD as well
+func (rte route) serves(method string) bool {
+	return rte.method == method || (method == http.MethodHead && rte.method == http.MethodGet)
+}
+
+// match reports whether path, split into escaped segments, matches the route pattern and returns the
+// captured values, unescaped. A path that is not validly escaped matches no route.
+func (rte route) match(path []string) (map[string]string, bool) {
+	var values map[string]string
+	for i, segment := range rte.segments {
+		if name, ok := wildcardName(segment); ok {
+			if rest, ok := strings.CutSuffix(name, "..."); ok {
+				value, err := url.PathUnescape(strings.Join(path[i:], "/"))
+				if err != nil {
+					return nil, false
+				}
+				if values == nil {
+					values = make(map[string]string)
+				}
+				values[rest] = value
+				return values, true
+			}
+			if i >= len(path) || path[i] == "" {
+				return nil, false
+			}
+			value, err := url.PathUnescape(path[i])
+			if err != nil {
+				return nil, false
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = value
+			continue
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		if value, err := url.PathUnescape(path[i]); err != nil || value != segment {
+			return nil, false
+		}
+	}
+	return values, len(path) == len(rte.segments)
+}
+
+// wildcardName returns the name of a "{name}" pattern segment
+func wildcardName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+// splitPath splits a path into segments; "/" has none and a trailing slash yields an empty last segment
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// uniqueSorted returns the distinct values of items in sorted order
+func uniqueSorted(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	var unique []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			unique = append(unique, item)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterMatching(t *testing.T) {
+	router := NewRouter(NewAPI())
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":" + r.PathValue("id") + r.PathValue("path")))
+		}
+	}
+	router.HandleFunc(http.MethodGet, "/", echo("root"))
+	router.HandleFunc(http.MethodGet, "/items/{id}", echo("get"))
+	router.HandleFunc(http.MethodDelete, "/items/{id}", echo("delete"))
+	router.HandleFunc(http.MethodGet, "/items/{id}/result", echo("result"))
+	router.HandleFunc(http.MethodGet, "/files/{path...}", echo("files"))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/", http.StatusOK, "root:"},
+		{http.MethodGet, "/items/42", http.StatusOK, "get:42"},
+		{http.MethodDelete, "/items/42", http.StatusOK, "delete:42"},
+		{http.MethodGet, "/items/42/result", http.StatusOK, "result:42"},
+		{http.MethodGet, "/items/a%2Fb", http.StatusOK, "get:a/b"},
+		{http.MethodGet, "/items/a%2Fb/result", http.StatusOK, "result:a/b"},
+		{http.MethodGet, "/items/a%2Fb/", http.StatusOK, "get:a/b"},
+		{http.MethodGet, "/items/100%25", http.StatusOK, "get:100%"},
+		{http.MethodGet, "/%69tems/42", http.StatusOK, "get:42"},
+		{http.MethodGet, "/files/a/b.txt", http.StatusOK, "files:a/b.txt"},
+		{http.MethodGet, "/files/a%2Fb/c.txt", http.StatusOK, "files:a/b/c.txt"},
+		{http.MethodGet, "/files/", http.StatusOK, "files:"},
+		{http.MethodGet, "/items/", http.StatusNotFound, ""},
+		{http.MethodGet, "/items/42/other", http.StatusNotFound, ""},
+		{http.MethodGet, "/unknown", http.StatusNotFound, ""},
+		{http.MethodPost, "/items/42", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			assert.Equal(t, tt.status, rr.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	router := NewRouter(NewAPI())
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc(http.MethodGet, "/items/{id}", ok)
+	router.HandleFunc(http.MethodDelete, "/items/{id}", ok)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/items/1", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+	assert.Equal(t, ErrorCodeMethodNotAllowed, response.ErrorCode)
+	assert.Equal(t, "Method not allowed", response.Error)
+}
+
+func TestRouterHeadAndOptions(t *testing.T) {
+	router := NewRouter(NewAPI())
+	router.HandleFunc(http.MethodGet, "/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	})
+	router.HandleFunc(http.MethodPut, "/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, "/items/1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.MethodHead, rr.Header().Get("X-Method"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, "/items/1/", nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT", rr.Header().Get("Allow"))
+	assert.Empty(t, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	assert.Equal(t, []string{"GET", "HEAD", "OPTIONS", "PUT"}, router.Allowed("/items/1"))
+	assert.Nil(t, router.Allowed("/items"))
+}
+
+// TestEndpointsAnswerOptionsAndHead checks every registered path: OPTIONS lists its methods, which a 405
+// repeats, and its GET routes answer HEAD
+func TestEndpointsAnswerOptionsAndHead(t *testing.T) {
+	router := (&Server{api: NewAPI()}).router()
+	handler := SetupRoutes(NewAPI())
+
+	registered := make(map[string][]string)
+	var patterns []string
+	for _, rte := range router.routes {
+		if _, seen := registered[rte.pattern]; !seen {
+			patterns = append(patterns, rte.pattern)
+		}
+		registered[rte.pattern] = append(registered[rte.pattern], rte.method)
+	}
+
+	for _, pattern := range patterns {
+		path := pattern
+		for _, segment := range splitPath(pattern) {
+			if _, ok := wildcardName(segment); ok {
+				path = strings.Replace(path, segment, "x", 1)
+			}
+		}
+		allow := strings.Join(allowedMethods(registered[pattern]), ", ")
+		t.Run(pattern, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, path, nil))
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			assert.Equal(t, allow, rr.Header().Get("Allow"))
+
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, path, nil))
+			assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+			assert.Equal(t, allow, rr.Header().Get("Allow"))
+
+			if slices.Contains(registered[pattern], http.MethodGet) {
+				rr = httptest.NewRecorder()
+				handler.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, path, nil))
+				assert.NotEqual(t, http.StatusMethodNotAllowed, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHeadOmitsBody(t *testing.T) {
+	server := httptest.NewServer(SetupRoutes(NewAPI()))
+	defer server.Close()
+
+	resp, err := http.Head(server.URL + "/v1/health")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Empty(t, body)
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	for _, path := range []string{"/health", "/v1/health"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+	}
+
+	// Old and versioned paths reach the same handlers
+	for _, path := range []string{"/execute", "/v1/execute"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"type":"mysql"}`)))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, path)
+	}
+}
+
+func TestVersionedRoutesMethodNotAllowed(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodGet, "/v1/execute", "OPTIONS, POST"},
+		{http.MethodPut, "/v1/test-connection", "OPTIONS, POST"},
+		{http.MethodPost, "/v1/health", "GET, HEAD, OPTIONS"},
+		{http.MethodPut, "/v1/jobs", "GET, HEAD, OPTIONS, POST"},
+		{http.MethodPost, "/v1/jobs/abc", "DELETE, GET, HEAD, OPTIONS"},
+		{http.MethodGet, "/allconfig", "OPTIONS, POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+			assert.Equal(t, tt.allow, rr.Header().Get("Allow"))
+			var response DatabaseResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.False(t, response.Success)
+			assert.Equal(t, ErrorCodeMethodNotAllowed, response.ErrorCode)
+			assert.Equal(t, "Method not allowed", response.Error)
+			assert.NotEmpty(t, response.RequestID)
+		})
+	}
+}
+
+func TestUnknownRouteReturnsJSON404(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/unknown", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeNotFound, response.ErrorCode)
+	assert.Equal(t, "Not found: /v1/unknown", response.Error)
+}
+
+func TestUnknownRouteListsEndpoints(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	tests := []struct {
+		path      string
+		accept    string
+		endpoints bool
+	}{
+		{"/unknown", "application/json", true},
+		{"/unknown", "text/html,application/xhtml+xml,*/*;q=0.8", false},
+		{"/v1/unknown", "", true},
+		{"/v1/", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			var response DatabaseResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, ErrorCodeNotFound, response.ErrorCode)
+			if !tt.endpoints {
+				assert.Nil(t, response.Details)
+				return
+			}
+			assert.Contains(t, response.Details["endpoints"], "GET /v1/health")
+			assert.Contains(t, response.Details["endpoints"], "POST /v1/allconfig")
+		})
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	// Endpoints are served with a trailing slash as they are without
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/health/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/allconfig/", bytes.NewBufferString(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeValidation, response.ErrorCode)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/allconfig/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "OPTIONS, POST", rr.Header().Get("Allow"))
+}
+
+func TestDocumentationIndex(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+
+	// Browsers get the landing page
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html", rr.Header().Get("Content-Type"))
+
+	// API clients get the endpoints
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	data := response.Data.(map[string]interface{})
+	assert.Contains(t, data["endpoints"], "POST /v1/execute")
+	assert.Equal(t, "/swagger.json", data["openapi"])
+}
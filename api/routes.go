@@ -0,0 +1,264 @@
+package api
+
+import (
+	"net/http"
+
+	"db-connectors/jobs"
+)
+
+// apiRoute is an endpoint served under /v1 and described in the generated OpenAPI specification
+type apiRoute struct {
+	method        string
+	pattern       string // Path relative to /v1
+	handler       http.HandlerFunc
+	versionedOnly bool // Not served at the unversioned alias
+	idempotent    bool // Replays responses by Idempotency-Key
+	doc           operationDoc
+}
+
+// Responses shared by several endpoints
+var (
+	requestFailed = map[int]string{
+		http.StatusBadRequest:          "Invalid request, or the database does not exist (error_code DB_NOT_FOUND)",
+		http.StatusUnauthorized:        "The database rejected the credentials (error_code AUTH_FAILED)",
+		http.StatusInternalServerError: "Connection or operation failed",
+		http.StatusBadGateway:          "The database host could not be resolved or reached (error_code HOST_UNREACHABLE)",
+		http.StatusGatewayTimeout:      "Timed out reaching the database (error_code TIMEOUT)",
+	}
+	profileFailed = map[int]string{
+		http.StatusBadRequest:         "Unknown connection profile or invalid parameters",
+		http.StatusForbidden:          "Unknown tenant, or a profile or API key of another tenant",
+		http.StatusServiceUnavailable: "Connection to the profile failed; error_code classifies the failure",
+	}
+	jobsDisabled = map[int]string{http.StatusNotFound: "Jobs are not enabled or the job does not exist"}
+)
+
+// Parameters of the profile-based config resources
+var (
+	profileParams = []paramDoc{
+		{Name: "profile", In: "query", Description: "Connection profile; takes precedence over the X-Connection-Profile header"},
+		{Name: ProfileHeader, In: "header", Description: "Connection profile; defaults to default_profile, or the tenant's profile"},
+		tenantParam,
+	}
+	streamParam = paramDoc{Name: "format", In: "query", Enum: []string{StreamFormatJSONL}, Description: "Stream the rows as " +
+		"application/x-ndjson, one object per line, ending with a _trailer line holding the row count, whether the rows were " +
+		"truncated at max_result_bytes, and the error of a read failing midway"}
+	tenantParam = paramDoc{Name: TenantHeader, In: "header", Description: "Tenant whose allconfig tables are used whatever table_name says; defaults to the tenant of the X-API-Key"}
+	pageParams  = []paramDoc{
+		{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of results"},
+		{Name: "offset", In: "query", Type: "integer", Description: "Number of results to skip"},
+	}
+	idempotencyParams = []paramDoc{
+		{Name: IdempotencyKeyHeader, In: "header", Description: "Replays the stored response when the request is retried with the same key and body; may also be set as idempotency_key in the body"},
+	}
+	userParams = []paramDoc{
+		{Name: UserIDHeader, In: "header", Description: "Caller recorded as maker or checker; falls back to maker_id or checker_id in the body"},
+		{Name: UserRoleHeader, In: "header", Description: "admin writes directly; other roles submit changes for approval"},
+	}
+)
+
+// apiRoutes lists every versioned endpoint together with its documentation
+func (s *Server) apiRoutes() []apiRoute {
+	a := s.api
+	return []apiRoute{
+		{method: http.MethodGet, pattern: "/health", handler: a.HealthHandler, doc: operationDoc{
+			ID: "healthCheck", Tag: "Health", Summary: "Liveness check",
+			Description: "Reports that the process is serving requests without touching any database",
+		}},
+		{method: http.MethodGet, pattern: "/ready", handler: a.ReadyHandler, doc: operationDoc{
+			ID: "readinessCheck", Tag: "Health", Summary: "Readiness check",
+			Description: "Pings every connection profile in parallel; the result is cached for a few seconds",
+			Data:        ReadinessReport{},
+			Responses:   map[int]string{http.StatusServiceUnavailable: "At least one database is unreachable"},
+		}},
+		{method: http.MethodGet, pattern: "/admin/startup-report", handler: a.StartupReportHandler, versionedOnly: true, doc: operationDoc{
+			ID: "startupReport", Tag: "Health", Summary: "Startup connectivity report",
+			Description: "Reports the result of connecting to and pinging every connection profile at startup, with the error_code classifying each failure; under the retry policy it is updated as profiles come up",
+			Data:        StartupReport{},
+			Responses:   map[int]string{http.StatusNotFound: "The startup check is not enabled"},
+		}},
+		{method: http.MethodGet, pattern: "/metrics", handler: a.MetricsHandler, doc: operationDoc{
+			ID: "metrics", Tag: "Health", Summary: "Server metrics",
+			Description: "Reports the hits, misses, evictions and size of the query cache, and the statements run, failed and slower than the slow statement threshold",
+			Data:        Metrics{},
+		}},
+		{method: http.MethodPost, pattern: "/test-connection", handler: a.TestConnectionHandler, doc: operationDoc{
+			ID: "testConnection", Tag: "Database Connection", Summary: "Test a database connection",
+			Description: "Connects with the given credentials and reports server information",
+			Body:        DatabaseConnectionRequest{},
+			Responses:   requestFailed,
+		}},
+		{method: http.MethodPost, pattern: "/execute", handler: a.ExecuteOperationHandler, idempotent: true, doc: operationDoc{
+			ID: "executeOperation", Tag: "Database Operations", Summary: "Execute a database operation",
+			Description: "Runs a SQL statement, a MongoDB operation, a schema introspection operation or a named query of the server configuration",
+			Params:      append(append([]paramDoc{}, idempotencyParams...), streamParam),
+			Body:        DatabaseOperationRequest{},
+			Responses:   idempotent(withStatus(requestFailed, http.StatusForbidden, "Rejected by the read-only mode or statement denylist")),
+		}},
+		{method: http.MethodPost, pattern: "/execute-batch", handler: a.ExecuteBatchHandler, idempotent: true, doc: operationDoc{
+			ID: "executeBatch", Tag: "Database Operations", Summary: "Execute statements on one connection",
+			Description: "Runs up to 100 statements in order, optionally in a single transaction",
+			Params:      idempotencyParams,
+			Body:        BatchRequest{},
+			Data:        BatchResult{},
+			Responses:   idempotent(withStatus(requestFailed, http.StatusForbidden, "Rejected by the read-only mode or statement denylist")),
+		}},
+		{method: http.MethodPost, pattern: "/import", handler: a.ImportHandler, idempotent: true, doc: operationDoc{
+			ID: "importRows", Tag: "Database Operations", Summary: "Bulk load rows into a table",
+			Description: "Loads CSV or JSON Lines rows into a table with COPY on PostgreSQL and multi-row inserts on MySQL, one transaction per chunk, reporting the rows loaded and the chunks that failed",
+			Params:      idempotencyParams,
+			Body:        ImportRequest{},
+			Data:        ImportResult{},
+			Responses:   idempotent(withStatus(requestFailed, http.StatusForbidden, "Rejected by the read-only mode or statement denylist")),
+		}},
+		{method: http.MethodGet, pattern: "/jobs", handler: a.SubmitJobHandler, doc: operationDoc{
+			ID: "listJobs", Tag: "Jobs", Summary: "List jobs",
+			Data:      []jobs.Status{},
+			Responses: jobsDisabled,
+		}},
+		{method: http.MethodPost, pattern: "/jobs", handler: a.SubmitJobHandler, idempotent: true, doc: operationDoc{
+			ID: "submitJob", Tag: "Jobs", Summary: "Submit an asynchronous operation",
+			Description: "Accepts the same body as /execute and returns the job status with a Location header",
+			Params:      idempotencyParams,
+			Body:        DatabaseOperationRequest{},
+			Data:        jobs.Status{},
+			Success:     http.StatusAccepted,
+			Responses: idempotent(map[int]string{
+				http.StatusBadRequest:         "Invalid request",
+				http.StatusForbidden:          "Rejected by the read-only mode or statement denylist",
+				http.StatusNotFound:           "Jobs are not enabled",
+				http.StatusServiceUnavailable: "The job queue is full",
+			}),
+		}},
+		{method: http.MethodGet, pattern: "/jobs/{id}", handler: a.JobHandler, doc: operationDoc{
+			ID: "getJob", Tag: "Jobs", Summary: "Get a job's status",
+			Data:      jobs.Status{},
+			Responses: jobsDisabled,
+		}},
+		{method: http.MethodDelete, pattern: "/jobs/{id}", handler: a.JobHandler, doc: operationDoc{
+			ID: "cancelJob", Tag: "Jobs", Summary: "Cancel a queued or running job",
+			Data:      jobs.Status{},
+			Responses: jobsDisabled,
+		}},
+		{method: http.MethodGet, pattern: "/jobs/{id}/result", handler: a.JobResultHandler, doc: operationDoc{
+			ID: "getJobResult", Tag: "Jobs", Summary: "Download a job's result",
+			Params: []paramDoc{
+				{Name: "format", In: "query", Description: "Result format", Enum: []string{"jsonl", "csv"}},
+			},
+			Content: []string{"application/x-ndjson", "text/csv"},
+			Responses: map[int]string{
+				http.StatusBadRequest: "Unsupported format",
+				http.StatusNotFound:   "Jobs are not enabled or the job does not exist",
+				http.StatusConflict:   "The job has not succeeded",
+			},
+		}},
+		{method: http.MethodGet, pattern: "/connections", handler: a.ListConnectionsHandler, versionedOnly: true, doc: operationDoc{
+			ID: "listConnections", Tag: "Connections", Summary: "List registered connections",
+			Description: "Reports each connection profile's target, connected state, last successful ping and pool statistics; credentials are never included",
+			Data:        []ConnectionInfo{},
+		}},
+		{method: http.MethodPost, pattern: "/connections/{name}/ping", handler: a.PingConnectionHandler, versionedOnly: true, doc: operationDoc{
+			ID: "pingConnection", Tag: "Connections", Summary: "Ping a connection",
+			Description: "Connects the connection if needed and pings it, bypassing the readiness cache",
+			Data:        DatabaseStatus{},
+			Responses: map[int]string{
+				http.StatusNotFound:           "Unknown connection",
+				http.StatusServiceUnavailable: "The ping failed",
+			},
+		}},
+		{method: http.MethodPost, pattern: "/connections/{name}/refresh", handler: a.RefreshConnectionHandler, versionedOnly: true, doc: operationDoc{
+			ID: "refreshConnection", Tag: "Connections", Summary: "Rebuild a connection",
+			Description: "Builds the connection again with freshly resolved credentials and connects it, closing the one it replaces; connections are rebuilt on their own once the database rejects their credentials",
+			Responses: map[int]string{
+				http.StatusNotFound:           "Unknown connection",
+				http.StatusConflict:           "The connection was not configured by the server and cannot be rebuilt",
+				http.StatusServiceUnavailable: "The rebuilt connection failed to connect",
+			},
+		}},
+		{method: http.MethodDelete, pattern: "/connections/{name}", handler: a.DeleteConnectionHandler, versionedOnly: true, doc: operationDoc{
+			ID: "deleteConnection", Tag: "Connections", Summary: "Close and remove a connection",
+			Description: "Closes the connection and removes its profile until the server restarts",
+			Responses:   map[int]string{http.StatusNotFound: "Unknown connection"},
+		}},
+		{method: http.MethodPost, pattern: "/allconfig", handler: a.AllConfigHandler, doc: operationDoc{
+			ID: "checkAllConfig", Tag: "AllConfig Management", Summary: "Check the allconfig table",
+			Description: "Reports whether the allconfig table exists, with its structure and row count, and the columns and indexes missing from it and its approval table, and whether it is a legacy table without the status column; repair adds them",
+			Params:      []paramDoc{tenantParam},
+			Body:        AllConfigRequest{},
+			Responses:   withStatus(requestFailed, http.StatusForbidden, "Unknown tenant, or an API key of another tenant"),
+		}},
+		{method: http.MethodPost, pattern: "/allconfig-operation", handler: a.AllConfigOperationHandler, idempotent: true, doc: operationDoc{
+			ID: "allConfigOperation", Tag: "Maker-Checker Workflow", Summary: "Perform an allconfig operation",
+			Description: "Runs a maker-checker, read, direct write or table management operation on the allconfig table",
+			Params:      append(append([]paramDoc{}, idempotencyParams...), tenantParam, streamParam),
+			Body:        AllConfigOperationRequest{},
+			Responses:   withStatus(idempotent(requestFailed), http.StatusForbidden, "Unknown tenant, or an API key of another tenant"),
+		}},
+		{method: http.MethodGet, pattern: "/allconfig/rules", handler: a.ListValueRulesHandler, versionedOnly: true, doc: operationDoc{
+			ID: "listValueRules", Tag: "AllConfig Management", Summary: "List the value rules",
+			Description: "Lists the rules of the server configuration that the values of config writes, submissions and approvals are checked against",
+			Data:        []ValueRuleInfo{},
+		}},
+		{method: http.MethodGet, pattern: "/configs", handler: a.ListConfigsHandler, versionedOnly: true, doc: operationDoc{
+			ID: "listConfigs", Tag: "Config Resources", Summary: "List approved configs",
+			Description: "Runs read_all, or search when the search parameter is set, on the selected profile",
+			Params: append(append(append([]paramDoc{}, profileParams...), pageParams...),
+				paramDoc{Name: "search", In: "query", Description: "Search keys, values and descriptions"}),
+			Responses: profileFailed,
+		}},
+		{method: http.MethodGet, pattern: "/configs/{key}", handler: a.GetConfigHandler, versionedOnly: true, doc: operationDoc{
+			ID: "getConfig", Tag: "Config Resources", Summary: "Read an approved config",
+			Params:    profileParams,
+			Responses: withStatus(profileFailed, http.StatusNotFound, "Config not found"),
+		}},
+		{method: http.MethodPut, pattern: "/configs/{key}", handler: a.PutConfigHandler, versionedOnly: true, doc: operationDoc{
+			ID: "putConfig", Tag: "Config Resources", Summary: "Create or update a config",
+			Description: "Admins write directly (201 for a new key, 200 for an update); other callers submit the change for approval (202)",
+			Params:      append(append([]paramDoc{}, profileParams...), userParams...),
+			Body:        ConfigWriteRequest{},
+			Responses: withStatus(withStatus(profileFailed, http.StatusCreated, "Config created directly"),
+				http.StatusAccepted, "Change submitted for approval"),
+		}},
+		{method: http.MethodDelete, pattern: "/configs/{key}", handler: a.DeleteConfigHandler, versionedOnly: true, doc: operationDoc{
+			ID: "deleteConfig", Tag: "Config Resources", Summary: "Delete a config",
+			Description: "Admins delete directly; other callers submit the delete for approval (202)",
+			Params:      append(append([]paramDoc{}, profileParams...), userParams...),
+			Responses: withStatus(withStatus(profileFailed, http.StatusAccepted, "Delete submitted for approval"),
+				http.StatusNotFound, "Config not found"),
+		}},
+		{method: http.MethodGet, pattern: "/approvals", handler: a.ListApprovalsHandler, versionedOnly: true, doc: operationDoc{
+			ID: "listApprovals", Tag: "Config Resources", Summary: "List pending approval requests",
+			Params:    append(append([]paramDoc{}, profileParams...), pageParams...),
+			Responses: profileFailed,
+		}},
+		{method: http.MethodPost, pattern: "/approvals/{id}/approve", handler: a.ApproveHandler, versionedOnly: true, doc: operationDoc{
+			ID: "approveRequest", Tag: "Config Resources", Summary: "Approve a pending request and apply its change",
+			Params:       append(append([]paramDoc{}, profileParams...), userParams[0]),
+			Body:         ApprovalDecisionRequest{},
+			OptionalBody: true,
+			Responses:    withStatus(profileFailed, http.StatusNotFound, "No pending request with this ID"),
+		}},
+		{method: http.MethodPost, pattern: "/approvals/{id}/reject", handler: a.RejectHandler, versionedOnly: true, doc: operationDoc{
+			ID: "rejectRequest", Tag: "Config Resources", Summary: "Reject a pending request",
+			Params:       append(append([]paramDoc{}, profileParams...), userParams[0]),
+			Body:         ApprovalDecisionRequest{},
+			OptionalBody: true,
+			Responses:    withStatus(profileFailed, http.StatusNotFound, "No pending request with this ID"),
+		}},
+	}
+}
+
+// idempotent adds the conflict response of an endpoint replaying responses by Idempotency-Key
+func idempotent(responses map[int]string) map[int]string {
+	return withStatus(responses, http.StatusConflict, "The Idempotency-Key was used for a different request or its first request is still running")
+}
+
+// withStatus returns a copy of responses with one more status
+func withStatus(responses map[int]string, status int, description string) map[int]string {
+	merged := make(map[int]string, len(responses)+1)
+	for code, text := range responses {
+		merged[code] = text
+	}
+	merged[status] = description
+	return merged
+}
@@ -0,0 +1,616 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"db-connectors/connectors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mongoSchemaSampleSize is the number of documents sampled to infer a collection's fields
+const mongoSchemaSampleSize = 100
+
+// TableInfo describes a table (SQL) or collection (MongoDB)
+type TableInfo struct {
+	Schema string `json:"schema,omitempty"` // Schema (SQL) or database (MongoDB) holding the table
+	Name   string `json:"name"`
+	Type   string `json:"type"` // table, view, collection
+}
+
+// ColumnInfo describes a single column or inferred document field
+type ColumnInfo struct {
+	Name     string  `json:"name"`
+	DataType string  `json:"data_type"`
+	Nullable bool    `json:"nullable"`
+	Default  *string `json:"default,omitempty"`
+	Key      string  `json:"key,omitempty"`   // primary, unique, index, foreign
+	Extra    string  `json:"extra,omitempty"` // e.g. auto_increment
+}
+
+// DatabaseInfo describes a database (MySQL, MongoDB) or database/catalog (PostgreSQL) on a server
+type DatabaseInfo struct {
+	Name      string `json:"name"`
+	SizeBytes *int64 `json:"size_bytes,omitempty"` // Only reported where cheaply available (PostgreSQL, MongoDB)
+	System    bool   `json:"system"`
+}
+
+// systemDatabases lists the built-in databases hidden from list_databases unless include_system is set
+var systemDatabases = map[string][]string{
+	"mysql":      {"information_schema", "mysql", "performance_schema", "sys"},
+	"postgresql": {"postgres", "template0", "template1"},
+	"mongodb":    {"admin", "config", "local"},
+}
+
+// IndexInfo describes an index on a table or collection
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+}
+
+// isSchemaOperation reports whether the operation is a schema introspection operation
+func isSchemaOperation(operation string) bool {
+	switch operation {
+	case "list_tables", "describe_table", "list_indexes":
+		return true
+	}
+	return false
+}
+
+// executeSchemaOperation runs a schema introspection operation for any database type
+func (a *API) executeSchemaOperation(ctx context.Context, connector connectors.DBConnector, req *DatabaseOperationRequest) (interface{}, error) {
+	switch req.Operation {
+	case "list_tables":
+		return a.listTables(ctx, connector, req.Schema, "")
+	case "describe_table":
+		return a.describeTable(ctx, connector, req.Schema, req.Table)
+	case "list_indexes":
+		return a.listIndexes(ctx, connector, req.Schema, req.Table)
+	default:
+		return nil, unsupportedOperationError(req.Operation, []string{"list_tables", "describe_table", "list_indexes"})
+	}
+}
+
+// defaultServerDatabase returns the database to connect to when only the server is of interest
+func defaultServerDatabase(dbType string) string {
+	if dbType == "postgresql" {
+		return "postgres"
+	}
+	return ""
+}
+
+// checkUseDatabase reports the problems of a use_database override. Only MySQL sessions switch databases;
+// a PostgreSQL session stays in the database it connected to and changes schemas through search_path.
+func checkUseDatabase(req *DatabaseOperationRequest) []string {
+	if req.UseDatabase == "" {
+		return nil
+	}
+	if req.Type != "mysql" {
+		return []string{"use_database is only supported for MySQL; set database to connect elsewhere, or schema to change a PostgreSQL search_path"}
+	}
+	if err := connectors.ValidateName("use_database", req.UseDatabase); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// switchDatabase points the session of a request at its use_database. A MySQL session starts in the
+// database it connects to, so connecting to use_database leaves it where running USE would.
+func (r *DatabaseOperationRequest) switchDatabase() {
+	if r.UseDatabase != "" {
+		r.Database = r.UseDatabase
+	}
+}
+
+// isSystemDatabase reports whether name is a built-in database for the given database type
+func isSystemDatabase(dbType, name string) bool {
+	for _, system := range systemDatabases[dbType] {
+		if name == system {
+			return true
+		}
+	}
+	return false
+}
+
+// listDatabases lists the databases available on the connected server
+func (a *API) listDatabases(ctx context.Context, connector connectors.DBConnector, includeSystem bool) ([]DatabaseInfo, error) {
+	var all []DatabaseInfo
+
+	switch connector.GetType() {
+	case "mysql":
+		rows, err := connector.Query(ctx, "SHOW DATABASES")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases in MySQL: %w", err)
+		}
+		defer rows.Close()
+
+		results, err := a.rowsToMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range results {
+			all = append(all, DatabaseInfo{Name: asString(row["Database"])})
+		}
+
+	case "postgresql":
+		query := `SELECT datname,
+				         CASE WHEN has_database_privilege(datname, 'CONNECT') THEN pg_database_size(datname) END AS size_bytes
+				  FROM pg_database ORDER BY datname`
+		rows, err := connector.Query(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases in PostgreSQL: %w", err)
+		}
+		defer rows.Close()
+
+		results, err := a.rowsToMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range results {
+			info := DatabaseInfo{Name: asString(row["datname"])}
+			if size, ok := row["size_bytes"].(int64); ok {
+				info.SizeBytes = &size
+			}
+			all = append(all, info)
+		}
+
+	case "mongodb":
+		result, err := connector.Execute(ctx, "listDatabases", map[string]interface{}{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases in MongoDB: %w", err)
+		}
+
+		specs, _ := result.([]map[string]interface{})
+		for _, spec := range specs {
+			info := DatabaseInfo{Name: asString(spec["name"])}
+			if size, ok := spec["size_bytes"].(int64); ok {
+				info.SizeBytes = &size
+			}
+			all = append(all, info)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", connector.GetType())
+	}
+
+	databases := make([]DatabaseInfo, 0, len(all))
+	for _, db := range all {
+		db.System = isSystemDatabase(connector.GetType(), db.Name)
+		if db.System && !includeSystem {
+			continue
+		}
+		databases = append(databases, db)
+	}
+	return databases, nil
+}
+
+// listTables lists tables or collections, optionally restricted to a schema and a single table name
+func (a *API) listTables(ctx context.Context, connector connectors.DBConnector, schema, tableName string) ([]TableInfo, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		var query string
+		var args []interface{}
+		if connector.GetType() == "mysql" {
+			query = "SELECT table_schema, table_name, table_type FROM information_schema.tables WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE())"
+			args = append(args, schema)
+			if tableName != "" {
+				query += " AND table_name = ?"
+				args = append(args, tableName)
+			}
+		} else {
+			if schema != "" {
+				query = "SELECT table_schema, table_name, table_type FROM information_schema.tables WHERE table_schema = $1"
+				args = append(args, schema)
+			} else {
+				query = "SELECT table_schema, table_name, table_type FROM information_schema.tables WHERE table_schema NOT IN ('pg_catalog', 'information_schema')"
+			}
+			if tableName != "" {
+				args = append(args, tableName)
+				query += fmt.Sprintf(" AND table_name = $%d", len(args))
+			}
+		}
+		query += " ORDER BY table_schema, table_name"
+
+		rows, err := connector.Query(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		defer rows.Close()
+
+		results, err := a.rowsToMap(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tables := make([]TableInfo, 0, len(results))
+		for _, row := range results {
+			tableType := "table"
+			if strings.Contains(strings.ToUpper(asString(row["table_type"])), "VIEW") {
+				tableType = "view"
+			}
+			tables = append(tables, TableInfo{
+				Schema: asString(row["table_schema"]),
+				Name:   asString(row["table_name"]),
+				Type:   tableType,
+			})
+		}
+		return tables, nil
+
+	case "mongodb":
+		params := map[string]interface{}{
+			"filter": map[string]interface{}{},
+		}
+		if tableName != "" {
+			params["filter"] = map[string]interface{}{"name": tableName}
+		}
+		if schema != "" {
+			params["database"] = schema
+		}
+
+		result, err := connector.Execute(ctx, "listCollections", params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list collections: %w", err)
+		}
+
+		var collections []map[string]interface{}
+		switch v := result.(type) {
+		case []map[string]interface{}:
+			collections = v
+		case []interface{}:
+			for _, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					collections = append(collections, m)
+				}
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("unexpected result type from MongoDB listCollections: %T", v)
+		}
+
+		tables := make([]TableInfo, 0, len(collections))
+		for _, c := range collections {
+			collType := asString(c["type"])
+			if collType == "" {
+				collType = "collection"
+			}
+			tables = append(tables, TableInfo{
+				Schema: schema,
+				Name:   asString(c["name"]),
+				Type:   collType,
+			})
+		}
+		sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+		return tables, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", connector.GetType())
+	}
+}
+
+// describeTable returns the columns of a table, or the fields inferred from sampled documents for MongoDB
+func (a *API) describeTable(ctx context.Context, connector connectors.DBConnector, schema, tableName string) ([]ColumnInfo, error) {
+	switch connector.GetType() {
+	case "mysql":
+		query := `SELECT column_name, column_type, is_nullable, column_default, column_key, extra
+				  FROM information_schema.columns
+				  WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?
+				  ORDER BY ordinal_position`
+		rows, err := connector.Query(ctx, query, schema, tableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe table in MySQL: %w", err)
+		}
+		defer rows.Close()
+
+		results, err := a.rowsToMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeColumns(results, mysqlColumnKey), nil
+
+	case "postgresql":
+		query := `SELECT c.column_name, c.data_type, c.is_nullable, c.column_default,
+				         COALESCE((SELECT string_agg(tc.constraint_type, ',')
+				                   FROM information_schema.key_column_usage k
+				                   JOIN information_schema.table_constraints tc
+				                     ON tc.constraint_name = k.constraint_name AND tc.table_schema = k.table_schema
+				                   WHERE k.table_schema = c.table_schema AND k.table_name = c.table_name
+				                     AND k.column_name = c.column_name), '') AS column_key,
+				         '' AS extra
+				  FROM information_schema.columns c
+				  WHERE c.table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND c.table_name = $2
+				  ORDER BY c.ordinal_position`
+		rows, err := connector.Query(ctx, query, schema, tableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe table in PostgreSQL: %w", err)
+		}
+		defer rows.Close()
+
+		results, err := a.rowsToMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeColumns(results, postgresColumnKey), nil
+
+	case "mongodb":
+		params := map[string]interface{}{
+			"collection": tableName,
+			"filter":     map[string]interface{}{},
+			"limit":      mongoSchemaSampleSize,
+		}
+		if schema != "" {
+			params["database"] = schema
+		}
+
+		result, err := connector.Execute(ctx, "find", params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample collection in MongoDB: %w", err)
+		}
+
+		docs, _ := result.([]map[string]interface{})
+		return inferDocumentFields(docs), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", connector.GetType())
+	}
+}
+
+// listIndexes returns the indexes defined on a table or collection
+func (a *API) listIndexes(ctx context.Context, connector connectors.DBConnector, schema, tableName string) ([]IndexInfo, error) {
+	switch connector.GetType() {
+	case "mysql", "postgresql":
+		var query string
+		if connector.GetType() == "mysql" {
+			query = `SELECT index_name, column_name, non_unique = 0 AS is_unique, index_name = 'PRIMARY' AS is_primary
+					 FROM information_schema.statistics
+					 WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?
+					 ORDER BY index_name, seq_in_index`
+		} else {
+			query = `SELECT i.relname AS index_name, a.attname AS column_name, ix.indisunique AS is_unique, ix.indisprimary AS is_primary
+					 FROM pg_class t
+					 JOIN pg_namespace n ON n.oid = t.relnamespace
+					 JOIN pg_index ix ON ix.indrelid = t.oid
+					 JOIN pg_class i ON i.oid = ix.indexrelid
+					 JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+					 JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+					 WHERE n.nspname = COALESCE(NULLIF($1, ''), current_schema()) AND t.relname = $2
+					 ORDER BY i.relname, k.ord`
+		}
+
+		rows, err := connector.Query(ctx, query, schema, tableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes: %w", err)
+		}
+		defer rows.Close()
+
+		results, err := a.rowsToMap(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		indexes := make([]IndexInfo, 0)
+		positions := make(map[string]int)
+		for _, row := range results {
+			name := asString(row["index_name"])
+			pos, seen := positions[name]
+			if !seen {
+				pos = len(indexes)
+				positions[name] = pos
+				indexes = append(indexes, IndexInfo{
+					Name:    name,
+					Columns: []string{},
+					Unique:  asBool(row["is_unique"]),
+					Primary: asBool(row["is_primary"]),
+				})
+			}
+			indexes[pos].Columns = append(indexes[pos].Columns, asString(row["column_name"]))
+		}
+		return indexes, nil
+
+	case "mongodb":
+		params := map[string]interface{}{
+			"collection": tableName,
+		}
+		if schema != "" {
+			params["database"] = schema
+		}
+
+		result, err := connector.Execute(ctx, "listIndexes", params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes in MongoDB: %w", err)
+		}
+
+		specs, _ := result.([]map[string]interface{})
+		indexes := make([]IndexInfo, 0, len(specs))
+		for _, spec := range specs {
+			columns, _ := spec["keys"].([]string)
+			name := asString(spec["name"])
+			indexes = append(indexes, IndexInfo{
+				Name:    name,
+				Columns: columns,
+				Unique:  asBool(spec["unique"]) || name == "_id_",
+				Primary: name == "_id_",
+			})
+		}
+		return indexes, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", connector.GetType())
+	}
+}
+
+// normalizeColumns converts information_schema rows into ColumnInfo values
+func normalizeColumns(rows []map[string]interface{}, keyFn func(string) string) []ColumnInfo {
+	columns := make([]ColumnInfo, 0, len(rows))
+	for _, row := range rows {
+		column := ColumnInfo{
+			Name:     asString(row["column_name"]),
+			DataType: asString(row["column_type"]),
+			Nullable: strings.EqualFold(asString(row["is_nullable"]), "YES"),
+			Key:      keyFn(asString(row["column_key"])),
+			Extra:    asString(row["extra"]),
+		}
+		if column.DataType == "" {
+			column.DataType = asString(row["data_type"])
+		}
+		if row["column_default"] != nil {
+			def := asString(row["column_default"])
+			column.Default = &def
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// mysqlColumnKey maps MySQL's COLUMN_KEY values onto the normalized key names
+func mysqlColumnKey(key string) string {
+	switch strings.ToUpper(key) {
+	case "PRI":
+		return "primary"
+	case "UNI":
+		return "unique"
+	case "MUL":
+		return "index"
+	}
+	return ""
+}
+
+// postgresColumnKey maps the aggregated constraint types of a PostgreSQL column onto the normalized key names
+func postgresColumnKey(constraints string) string {
+	upper := strings.ToUpper(constraints)
+	switch {
+	case strings.Contains(upper, "PRIMARY KEY"):
+		return "primary"
+	case strings.Contains(upper, "UNIQUE"):
+		return "unique"
+	case strings.Contains(upper, "FOREIGN KEY"):
+		return "foreign"
+	}
+	return ""
+}
+
+// inferDocumentFields infers field names and types from a sample of MongoDB documents
+func inferDocumentFields(docs []map[string]interface{}) []ColumnInfo {
+	types := make(map[string]map[string]bool)
+	present := make(map[string]int)
+	nullSeen := make(map[string]bool)
+
+	for _, doc := range docs {
+		for field, value := range doc {
+			present[field]++
+			if value == nil {
+				nullSeen[field] = true
+				continue
+			}
+			if types[field] == nil {
+				types[field] = make(map[string]bool)
+			}
+			types[field][bsonTypeName(value)] = true
+		}
+	}
+
+	names := make([]string, 0, len(present))
+	for field := range present {
+		names = append(names, field)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// Keep _id first, then alphabetical
+		if names[i] == "_id" || names[j] == "_id" {
+			return names[i] == "_id"
+		}
+		return names[i] < names[j]
+	})
+
+	columns := make([]ColumnInfo, 0, len(names))
+	for _, field := range names {
+		typeNames := make([]string, 0, len(types[field]))
+		for t := range types[field] {
+			typeNames = append(typeNames, t)
+		}
+		sort.Strings(typeNames)
+		dataType := strings.Join(typeNames, "|")
+		if dataType == "" {
+			dataType = "null"
+		}
+
+		column := ColumnInfo{
+			Name:     field,
+			DataType: dataType,
+			Nullable: nullSeen[field] || present[field] < len(docs),
+		}
+		if field == "_id" {
+			column.Key = "primary"
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// bsonTypeName returns the BSON type name for a decoded MongoDB value
+func bsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int32:
+		return "int"
+	case int, int64:
+		return "long"
+	case float32, float64:
+		return "double"
+	case primitive.Decimal128:
+		return "decimal"
+	case primitive.ObjectID:
+		return "objectId"
+	case primitive.DateTime, time.Time:
+		return "date"
+	case primitive.Binary:
+		return "binData"
+	case primitive.A, []interface{}:
+		return "array"
+	case primitive.D, primitive.M, map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// asString converts a scanned column value to a string
+func asString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// asBool converts a scanned column value to a bool, accepting numeric and textual forms
+func asBool(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case int64:
+		return val != 0
+	case int:
+		return val != 0
+	case int32:
+		return val != 0
+	case float64:
+		return val != 0
+	case string, []byte:
+		s := strings.ToLower(asString(val))
+		return s == "1" || s == "t" || s == "true" || s == "yes"
+	}
+	return false
+}
@@ -0,0 +1,511 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockRows builds a *sql.Rows populated with the given columns and values
+func newMockRows(t *testing.T, columns []string, values ...[]driver.Value) *sql.Rows {
+	db, sqlMock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	mockRows := sqlmock.NewRows(columns)
+	for _, v := range values {
+		mockRows.AddRow(v...)
+	}
+	sqlMock.ExpectQuery(".*").WillReturnRows(mockRows)
+
+	rows, err := db.Query("SELECT")
+	require.NoError(t, err)
+	return rows
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestListTables(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbType   string
+		schema   string
+		setup    func(t *testing.T, m *connectortest.MockDBConnector)
+		expected []TableInfo
+	}{
+		{
+			name:   "mysql defaults to current database",
+			dbType: "mysql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.MatchedBy(func(q string) bool {
+					return assert.Contains(t, q, "DATABASE()")
+				}), []interface{}{""}).Return(newMockRows(t,
+					[]string{"table_schema", "table_name", "table_type"},
+					[]driver.Value{"shop", "orders", "BASE TABLE"},
+					[]driver.Value{"shop", "order_summary", "VIEW"},
+				), nil)
+			},
+			expected: []TableInfo{
+				{Schema: "shop", Name: "orders", Type: "table"},
+				{Schema: "shop", Name: "order_summary", Type: "view"},
+			},
+		},
+		{
+			name:   "postgresql with schema filter",
+			dbType: "postgresql",
+			schema: "billing",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.Anything, []interface{}{"billing"}).Return(newMockRows(t,
+					[]string{"table_schema", "table_name", "table_type"},
+					[]driver.Value{"billing", "invoices", "BASE TABLE"},
+				), nil)
+			},
+			expected: []TableInfo{
+				{Schema: "billing", Name: "invoices", Type: "table"},
+			},
+		},
+		{
+			name:   "postgresql without schema excludes system schemas",
+			dbType: "postgresql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.MatchedBy(func(q string) bool {
+					return assert.Contains(t, q, "NOT IN ('pg_catalog', 'information_schema')")
+				}), []interface{}(nil)).Return(newMockRows(t,
+					[]string{"table_schema", "table_name", "table_type"},
+					[]driver.Value{"public", "users", "BASE TABLE"},
+				), nil)
+			},
+			expected: []TableInfo{
+				{Schema: "public", Name: "users", Type: "table"},
+			},
+		},
+		{
+			name:   "mongodb collections in requested database",
+			dbType: "mongodb",
+			schema: "analytics",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Execute", mock.Anything, "listCollections", map[string]interface{}{
+					"filter":   map[string]interface{}{},
+					"database": "analytics",
+				}).Return([]map[string]interface{}{
+					{"name": "events", "type": "collection"},
+					{"name": "daily_view", "type": "view"},
+				}, nil)
+			},
+			expected: []TableInfo{
+				{Schema: "analytics", Name: "daily_view", Type: "view"},
+				{Schema: "analytics", Name: "events", Type: "collection"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := NewAPI()
+			m := new(connectortest.MockDBConnector)
+			m.On("GetType").Return(tt.dbType)
+			tt.setup(t, m)
+
+			tables, err := api.listTables(context.Background(), m, tt.schema, "")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tables)
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDescribeTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbType   string
+		setup    func(t *testing.T, m *connectortest.MockDBConnector)
+		expected []ColumnInfo
+	}{
+		{
+			name:   "mysql columns with keys",
+			dbType: "mysql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.Anything, []interface{}{"", "allconfig"}).Return(newMockRows(t,
+					[]string{"column_name", "column_type", "is_nullable", "column_default", "column_key", "extra"},
+					[]driver.Value{"id", "int", "NO", nil, "PRI", "auto_increment"},
+					[]driver.Value{"config_key", "varchar(255)", "NO", nil, "UNI", ""},
+					[]driver.Value{"status", "enum('approved','pending','rejected')", "YES", "approved", "MUL", ""},
+				), nil)
+			},
+			expected: []ColumnInfo{
+				{Name: "id", DataType: "int", Nullable: false, Key: "primary", Extra: "auto_increment"},
+				{Name: "config_key", DataType: "varchar(255)", Nullable: false, Key: "unique"},
+				{Name: "status", DataType: "enum('approved','pending','rejected')", Nullable: true, Default: strPtr("approved"), Key: "index"},
+			},
+		},
+		{
+			name:   "postgresql columns with constraints",
+			dbType: "postgresql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.Anything, []interface{}{"", "allconfig"}).Return(newMockRows(t,
+					[]string{"column_name", "data_type", "is_nullable", "column_default", "column_key", "extra"},
+					[]driver.Value{"id", "integer", "NO", "nextval('allconfig_id_seq'::regclass)", "PRIMARY KEY", ""},
+					[]driver.Value{"config_key", "character varying", "NO", nil, "UNIQUE", ""},
+					[]driver.Value{"description", "text", "YES", nil, "", ""},
+				), nil)
+			},
+			expected: []ColumnInfo{
+				{Name: "id", DataType: "integer", Nullable: false, Default: strPtr("nextval('allconfig_id_seq'::regclass)"), Key: "primary"},
+				{Name: "config_key", DataType: "character varying", Nullable: false, Key: "unique"},
+				{Name: "description", DataType: "text", Nullable: true},
+			},
+		},
+		{
+			name:   "mongodb fields inferred from sample",
+			dbType: "mongodb",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Execute", mock.Anything, "find", mock.Anything).Return([]map[string]interface{}{
+					{"_id": "a", "config_key": "k1", "count": int32(1)},
+					{"_id": "b", "config_key": "k2", "count": int64(2), "note": nil},
+				}, nil)
+			},
+			expected: []ColumnInfo{
+				{Name: "_id", DataType: "string", Nullable: false, Key: "primary"},
+				{Name: "config_key", DataType: "string", Nullable: false},
+				{Name: "count", DataType: "int|long", Nullable: false},
+				{Name: "note", DataType: "null", Nullable: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := NewAPI()
+			m := new(connectortest.MockDBConnector)
+			m.On("GetType").Return(tt.dbType)
+			tt.setup(t, m)
+
+			columns, err := api.describeTable(context.Background(), m, "", "allconfig")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, columns)
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDescribeTableBindsNames(t *testing.T) {
+	// Names are bound as parameters, never spliced into the query, so none of them needs quoting
+	names := []struct{ schema, table string }{
+		{"app", "odd`name"},
+		{"my-db", "order-items"},
+		{"", "select"},
+		{"app", "x'; DROP TABLE allconfig; --"},
+	}
+	for _, dbType := range []string{"mysql", "postgresql"} {
+		for _, name := range names {
+			t.Run(dbType+"/"+name.table, func(t *testing.T) {
+				api := NewAPI()
+				m := new(connectortest.MockDBConnector)
+				m.On("GetType").Return(dbType)
+				query := mock.MatchedBy(func(query string) bool {
+					return strings.Contains(query, "information_schema.columns") && !strings.Contains(query, name.table)
+				})
+				m.On("Query", mock.Anything, query, []interface{}{name.schema, name.table}).Return(newMockRows(t,
+					[]string{"column_name", "column_type", "is_nullable", "column_default", "column_key", "extra"},
+					[]driver.Value{"id", "int", "NO", nil, "", ""},
+				), nil)
+
+				columns, err := api.describeTable(context.Background(), m, name.schema, name.table)
+				require.NoError(t, err)
+				assert.Equal(t, []ColumnInfo{{Name: "id", DataType: "int"}}, columns)
+				m.AssertExpectations(t)
+			})
+		}
+	}
+}
+
+func TestListIndexes(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbType   string
+		setup    func(t *testing.T, m *connectortest.MockDBConnector)
+		expected []IndexInfo
+	}{
+		{
+			name:   "mysql groups composite index columns",
+			dbType: "mysql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.Anything, []interface{}{"", "allconfig"}).Return(newMockRows(t,
+					[]string{"index_name", "column_name", "is_unique", "is_primary"},
+					[]driver.Value{"PRIMARY", "id", int64(1), int64(1)},
+					[]driver.Value{"idx_status_maker", "status", int64(0), int64(0)},
+					[]driver.Value{"idx_status_maker", "maker_id", int64(0), int64(0)},
+				), nil)
+			},
+			expected: []IndexInfo{
+				{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+				{Name: "idx_status_maker", Columns: []string{"status", "maker_id"}},
+			},
+		},
+		{
+			name:   "postgresql boolean flags",
+			dbType: "postgresql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.Anything, []interface{}{"", "allconfig"}).Return(newMockRows(t,
+					[]string{"index_name", "column_name", "is_unique", "is_primary"},
+					[]driver.Value{"allconfig_pkey", "id", true, true},
+					[]driver.Value{"allconfig_config_key_key", "config_key", true, false},
+				), nil)
+			},
+			expected: []IndexInfo{
+				{Name: "allconfig_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+				{Name: "allconfig_config_key_key", Columns: []string{"config_key"}, Unique: true},
+			},
+		},
+		{
+			name:   "mongodb index specs",
+			dbType: "mongodb",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Execute", mock.Anything, "listIndexes", map[string]interface{}{
+					"collection": "allconfig",
+				}).Return([]map[string]interface{}{
+					{"name": "_id_", "keys": []string{"_id"}, "unique": false},
+					{"name": "config_key_1", "keys": []string{"config_key"}, "unique": true},
+				}, nil)
+			},
+			expected: []IndexInfo{
+				{Name: "_id_", Columns: []string{"_id"}, Unique: true, Primary: true},
+				{Name: "config_key_1", Columns: []string{"config_key"}, Unique: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := NewAPI()
+			m := new(connectortest.MockDBConnector)
+			m.On("GetType").Return(tt.dbType)
+			tt.setup(t, m)
+
+			indexes, err := api.listIndexes(context.Background(), m, "", "allconfig")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, indexes)
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExecuteSchemaOperationRequiresTable(t *testing.T) {
+	api := NewAPI()
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("mysql")
+
+	for _, op := range []string{"describe_table", "list_indexes"} {
+		_, err := api.executeOperation(context.Background(), m, &DatabaseOperationRequest{Operation: op})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "table is required")
+	}
+}
+
+func TestCheckTableExistsDelegatesToListTables(t *testing.T) {
+	api := NewAPI()
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("mysql")
+	m.On("Query", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return assert.Contains(t, q, "AND table_name = ?")
+	}), []interface{}{"testdb", "allconfig"}).Return(newMockRows(t,
+		[]string{"table_schema", "table_name", "table_type"},
+		[]driver.Value{"testdb", "allconfig", "BASE TABLE"},
+	), nil)
+
+	exists, err := api.checkTableExists(context.Background(), m, "testdb", "allconfig")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	m.AssertExpectations(t)
+}
+
+func TestCheckTableExistsInPostgresSchema(t *testing.T) {
+	api := NewAPI()
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("postgresql")
+	// The table is looked up in the schema alone, without guessing one from the database name
+	m.On("Query", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return assert.Contains(t, q, "WHERE table_schema = $1 AND table_name = $2")
+	}), []interface{}{"billing", "allconfig"}).Return(newMockRows(t,
+		[]string{"table_schema", "table_name", "table_type"},
+	), nil)
+
+	req := DatabaseConnectionRequest{Type: "postgresql", Database: "billing"}
+	exists, err := api.checkTableExists(context.Background(), m, "billing", "allconfig")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, "public", req.tableSchema())
+	m.AssertExpectations(t)
+}
+
+func TestTableSchema(t *testing.T) {
+	tests := []struct {
+		dbType, schema, expected string
+	}{
+		{"postgresql", "", "public"},
+		{"postgresql", "billing", "billing"},
+		{"mysql", "", ""}, // The database connected to
+		{"mysql", "reports", "reports"},
+	}
+	for _, tt := range tests {
+		req := DatabaseConnectionRequest{Type: tt.dbType, Database: "app", Schema: tt.schema}
+		assert.Equal(t, tt.expected, req.tableSchema(), "%s schema %q", tt.dbType, tt.schema)
+	}
+}
+
+func TestUseDatabase(t *testing.T) {
+	api := NewAPI()
+	newRequest := func(dbType, useDatabase string) *DatabaseOperationRequest {
+		req := &DatabaseOperationRequest{Operation: "query", Query: "SELECT 1", UseDatabase: useDatabase}
+		req.Type, req.Host, req.Port, req.Database = dbType, "db.internal", 3306, "app"
+		return req
+	}
+
+	req := newRequest("mysql", "reports")
+	require.NoError(t, api.validateOperationRequest(req))
+	req.switchDatabase()
+	assert.Equal(t, "reports", req.Database)
+
+	req = newRequest("mysql", "")
+	req.switchDatabase()
+	assert.Equal(t, "app", req.Database)
+
+	assert.EqualError(t, api.validateOperationRequest(newRequest("mysql", "reports;drop")),
+		"use_database name may only contain letters, digits, '_', '$' and '-'")
+	err := api.validateOperationRequest(newRequest("postgresql", "reports"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use_database is only supported for MySQL")
+}
+
+func TestListDatabasesSystemFiltering(t *testing.T) {
+	tests := []struct {
+		name          string
+		dbType        string
+		includeSystem bool
+		setup         func(t *testing.T, m *connectortest.MockDBConnector)
+		expected      []string
+	}{
+		{
+			name:   "mysql hides system schemas",
+			dbType: "mysql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, "SHOW DATABASES", []interface{}(nil)).Return(newMockRows(t,
+					[]string{"Database"},
+					[]driver.Value{"information_schema"},
+					[]driver.Value{"mysql"},
+					[]driver.Value{"orders"},
+					[]driver.Value{"performance_schema"},
+					[]driver.Value{"sys"},
+				), nil)
+			},
+			expected: []string{"orders"},
+		},
+		{
+			name:          "mysql include_system keeps everything",
+			dbType:        "mysql",
+			includeSystem: true,
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, "SHOW DATABASES", []interface{}(nil)).Return(newMockRows(t,
+					[]string{"Database"},
+					[]driver.Value{"mysql"},
+					[]driver.Value{"orders"},
+				), nil)
+			},
+			expected: []string{"mysql", "orders"},
+		},
+		{
+			name:   "postgresql hides templates and postgres",
+			dbType: "postgresql",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Query", mock.Anything, mock.Anything, []interface{}(nil)).Return(newMockRows(t,
+					[]string{"datname", "size_bytes"},
+					[]driver.Value{"billing", int64(8192)},
+					[]driver.Value{"postgres", int64(7000)},
+					[]driver.Value{"template0", nil},
+					[]driver.Value{"template1", int64(7000)},
+				), nil)
+			},
+			expected: []string{"billing"},
+		},
+		{
+			name:   "mongodb hides admin, config and local",
+			dbType: "mongodb",
+			setup: func(t *testing.T, m *connectortest.MockDBConnector) {
+				m.On("Execute", mock.Anything, "listDatabases", map[string]interface{}{}).Return([]map[string]interface{}{
+					{"name": "admin", "size_bytes": int64(40960)},
+					{"name": "config", "size_bytes": int64(12288)},
+					{"name": "events", "size_bytes": int64(1048576)},
+					{"name": "local", "size_bytes": int64(73728)},
+				}, nil)
+			},
+			expected: []string{"events"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := NewAPI()
+			m := new(connectortest.MockDBConnector)
+			m.On("GetType").Return(tt.dbType)
+			tt.setup(t, m)
+
+			databases, err := api.listDatabases(context.Background(), m, tt.includeSystem)
+			require.NoError(t, err)
+
+			names := make([]string, 0, len(databases))
+			for _, db := range databases {
+				names = append(names, db.Name)
+				assert.Equal(t, isSystemDatabase(tt.dbType, db.Name), db.System)
+			}
+			assert.Equal(t, tt.expected, names)
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListDatabasesReportsSizes(t *testing.T) {
+	api := NewAPI()
+	m := new(connectortest.MockDBConnector)
+	m.On("GetType").Return("postgresql")
+	m.On("Query", mock.Anything, mock.Anything, []interface{}(nil)).Return(newMockRows(t,
+		[]string{"datname", "size_bytes"},
+		[]driver.Value{"billing", int64(8192)},
+		[]driver.Value{"restricted", nil},
+	), nil)
+
+	databases, err := api.listDatabases(context.Background(), m, false)
+	require.NoError(t, err)
+	require.Len(t, databases, 2)
+	require.NotNil(t, databases[0].SizeBytes)
+	assert.Equal(t, int64(8192), *databases[0].SizeBytes)
+	assert.Nil(t, databases[1].SizeBytes)
+}
+
+func TestValidateOperationRequestDatabaseOptionalForListDatabases(t *testing.T) {
+	api := NewAPI()
+	conn := DatabaseConnectionRequest{Type: "mysql", Host: "localhost", Port: 3306}
+
+	err := api.validateOperationRequest(&DatabaseOperationRequest{DatabaseConnectionRequest: conn, Operation: "list_databases"})
+	assert.NoError(t, err)
+
+	err = api.validateOperationRequest(&DatabaseOperationRequest{DatabaseConnectionRequest: conn, Operation: "query"})
+	assert.EqualError(t, err, "database name is required")
+
+	missingHost := DatabaseOperationRequest{DatabaseConnectionRequest: DatabaseConnectionRequest{Type: "mysql", Port: 3306}, Operation: "list_databases"}
+	assert.EqualError(t, api.validateOperationRequest(&missingHost), "host is required")
+}
+
+func TestDefaultServerDatabase(t *testing.T) {
+	assert.Equal(t, "postgres", defaultServerDatabase("postgresql"))
+	assert.Equal(t, "", defaultServerDatabase("mysql"))
+	assert.Equal(t, "", defaultServerDatabase("mongodb"))
+}
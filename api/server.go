@@ -1,99 +1,522 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/connectors"
+	"db-connectors/events"
+	"db-connectors/jobs"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	api  *API
-	port int
+	api      *API
+	host     string // Interface to bind; empty binds all interfaces
+	port     int
+	timeouts Timeouts
+	tls      TLSOptions
+
+	mu         sync.Mutex
+	httpServer *http.Server // Set by Start, stopped by Shutdown
+	shutdown   bool
 }
 
-// NewServer creates a new HTTP server
-func NewServer(port int) *Server {
-	return &Server{
-		api:  NewAPI(),
-		port: port,
+// ServerOption configures optional Server settings
+type ServerOption func(*Server)
+
+// WithStatementPolicy sets the read-only mode and statement denylist enforced on /execute
+func WithStatementPolicy(policy StatementPolicy) ServerOption {
+	return func(s *Server) {
+		s.api.policy = policy
 	}
 }
 
-// Start starts the HTTP server
-func (s *Server) Start() error {
-	mux := http.NewServeMux()
-
-	// Register routes
-	mux.HandleFunc("/health", s.api.HealthHandler)
-	mux.HandleFunc("/test-connection", s.api.TestConnectionHandler)
-	mux.HandleFunc("/execute", s.api.ExecuteOperationHandler)
-	mux.HandleFunc("/allconfig", s.api.AllConfigHandler)
-	mux.HandleFunc("/allconfig-operation", s.api.AllConfigOperationHandler)
-	
-	// Swagger documentation routes
-	mux.HandleFunc("/", s.DocumentationIndexHandler)
-	mux.HandleFunc("/docs", s.SwaggerHandler)
-	mux.HandleFunc("/docs/", s.SwaggerHandler)
-	mux.HandleFunc("/swagger.json", s.SwaggerJSONHandler)
-	mux.HandleFunc("/swagger.yaml", s.SwaggerYAMLHandler)
-
-	// Add CORS middleware
-	handler := s.corsMiddleware(mux)
-
-	addr := fmt.Sprintf(":%d", s.port)
-	log.Printf("🚀 Database Connectors API server starting on %s", addr)
-	log.Printf("📡 Endpoints:")
-	log.Printf("   GET  /                   - Documentation landing page")
-	log.Printf("   GET  /health             - Health check")
-	log.Printf("   POST /test-connection    - Test database connection")
-	log.Printf("   POST /execute            - Execute database operation")
-	log.Printf("   POST /allconfig          - Check/manage allconfig table")
-	log.Printf("   POST /allconfig-operation - Perform operations on allconfig table")
-	log.Printf("   GET  /docs               - Swagger UI documentation")
-	log.Printf("   GET  /swagger.json       - OpenAPI JSON specification")
-	log.Printf("   GET  /swagger.yaml       - OpenAPI YAML specification")
-	log.Printf("")
-	log.Printf("🌐 Visit http://localhost:%d for documentation", s.port)
-
-	return http.ListenAndServe(addr, handler)
+// WithJobManager enables the asynchronous /jobs API backed by manager
+func WithJobManager(manager *jobs.Manager) ServerOption {
+	return func(s *Server) {
+		s.api.jobs = manager
+	}
 }
 
-// SetupRoutes creates and returns a configured HTTP handler with all routes
-func SetupRoutes(apiInstance *API) http.Handler {
-	mux := http.NewServeMux()
-
-	// Register routes
-	mux.HandleFunc("/health", apiInstance.HealthHandler)
-	mux.HandleFunc("/test-connection", apiInstance.TestConnectionHandler)
-	mux.HandleFunc("/execute", apiInstance.ExecuteOperationHandler)
-	mux.HandleFunc("/allconfig", apiInstance.AllConfigHandler)
-	mux.HandleFunc("/allconfig-operation", apiInstance.AllConfigOperationHandler)
-	
-	// Swagger documentation routes
-	server := &Server{api: apiInstance, port: 8080} // port doesn't matter for tests
-	mux.HandleFunc("/", server.DocumentationIndexHandler)
-	mux.HandleFunc("/docs", server.SwaggerHandler)
-	mux.HandleFunc("/docs/", server.SwaggerHandler)
-	mux.HandleFunc("/swagger.json", server.SwaggerJSONHandler)
-	mux.HandleFunc("/swagger.yaml", server.SwaggerYAMLHandler)
+// WithCORSPolicy sets the origins, methods and headers allowed for browser clients
+func WithCORSPolicy(policy CORSPolicy) ServerOption {
+	return func(s *Server) {
+		s.api.cors = policy
+	}
+}
+
+// WithHost sets the host or interface address the server binds to
+func WithHost(host string) ServerOption {
+	return func(s *Server) {
+		s.host = host
+	}
+}
 
-	// Add CORS middleware
-	return server.corsMiddleware(mux)
+// WithTimeouts sets the HTTP server timeouts; zero values keep the defaults
+func WithTimeouts(timeouts Timeouts) ServerOption {
+	return func(s *Server) {
+		s.timeouts = timeouts.withDefaults()
+	}
 }
 
-// corsMiddleware adds CORS headers
-func (s *Server) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// WithTLS serves HTTPS with the given certificate, requiring client certificates when a client CA is set
+func WithTLS(tls TLSOptions) ServerOption {
+	return func(s *Server) {
+		s.tls = tls
+	}
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+// WithRateLimit enables per-client rate limiting of all endpoints except /health, /ready and /metrics
+func WithRateLimit(policy RateLimitPolicy) ServerOption {
+	return func(s *Server) {
+		s.api.limiter = newRateLimiter(policy)
+	}
+}
+
+// BuildInfo identifies the build of the running binary, reported by /health
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// WithBuildInfo sets the version, commit and build date reported by /health
+func WithBuildInfo(info BuildInfo) ServerOption {
+	return func(s *Server) {
+		s.api.build = info
+	}
+}
+
+// WithMaxRequestBytes limits the size of request bodies; zero or less leaves them unlimited
+func WithMaxRequestBytes(limit int64) ServerOption {
+	return func(s *Server) {
+		s.api.maxRequestBytes = limit
+	}
+}
+
+// WithIdempotencyTTL sets how long responses are kept for replay by Idempotency-Key in memory; zero keeps
+// the default
+func WithIdempotencyTTL(ttl time.Duration) ServerOption {
+	return func(s *Server) {
+		s.api.idempotency = NewMemoryIdempotencyStore(ttl)
+	}
+}
+
+// WithQueryCacheBytes bounds the memory held by results cached for cache_ttl_seconds; zero keeps the default
+// and a negative limit disables the cache
+func WithQueryCacheBytes(limit int64) ServerOption {
+	return func(s *Server) {
+		if limit < 0 {
+			s.api.queryCache = nil
 			return
 		}
+		s.api.queryCache = newQueryCache(limit)
+	}
+}
+
+// WithPhaseTimeouts sets the connect and operation timeouts of requests and the most a request may ask
+// for; unset timeouts keep their defaults
+func WithPhaseTimeouts(timeouts PhaseTimeouts) ServerOption {
+	return func(s *Server) {
+		s.api.phaseTimeouts = timeouts.withDefaults()
+	}
+}
+
+// WithMaxResultBytes bounds the approximate JSON size of the rows one query returns through /execute,
+// /execute-batch and named queries; zero keeps the default and a negative limit removes it
+func WithMaxResultBytes(limit int64) ServerOption {
+	return func(s *Server) {
+		if limit != 0 {
+			s.api.maxResultBytes = limit
+		}
+	}
+}
+
+// WithEventPublisher publishes an event for every config change applied through the server
+func WithEventPublisher(publisher *events.Async) ServerOption {
+	return func(s *Server) {
+		s.api.events = publisher
+	}
+}
+
+// WithMaskingPolicy sets the masking rules applied to query results and allconfig reads
+func WithMaskingPolicy(policy MaskingPolicy) ServerOption {
+	return func(s *Server) {
+		s.api.masking = policy
+	}
+}
+
+// WithIdempotencyStore sets where responses are kept for replay by Idempotency-Key; nil disables replay
+func WithIdempotencyStore(store IdempotencyStore) ServerOption {
+	return func(s *Server) {
+		s.api.idempotency = store
+	}
+}
+
+// WithAllConfigTables sets the allconfig table used when a request or profile names none and the suffix
+// appended to it to name the approval requests table; empty values keep the defaults
+func WithAllConfigTables(table, approvalSuffix string) ServerOption {
+	return func(s *Server) {
+		if table != "" {
+			s.api.allConfigTable = table
+		}
+		if approvalSuffix != "" {
+			s.api.approvalSuffix = approvalSuffix
+		}
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// WithAllConfigSchema sets the schema the SQL allconfig tables live in when a request names none: a
+// PostgreSQL schema, which create_table creates when missing, or a MySQL database. Statements qualify the
+// tables with it, so they do not depend on the search_path.
+func WithAllConfigSchema(schema string) ServerOption {
+	return func(s *Server) {
+		s.api.allConfigSchema = schema
+	}
+}
+
+// WithConfigNotifications makes create_table add a trigger to PostgreSQL allconfig tables notifying every
+// change, which ListenConfigChanges listens for
+func WithConfigNotifications(enabled bool) ServerOption {
+	return func(s *Server) {
+		s.api.notifyConfigChanges = enabled
+	}
+}
+
+// WithStrictOperations makes /allconfig-operation reject operations named by an alias instead of answering
+// them with a deprecation warning
+func WithStrictOperations(enabled bool) ServerOption {
+	return func(s *Server) {
+		s.api.strictOperations = enabled
+	}
+}
+
+// WithTenants sets the tenants whose requests, named by the X-Tenant-ID header or their API keys, use
+// their own allconfig tables
+func WithTenants(tenants ...Tenant) ServerOption {
+	return func(s *Server) {
+		s.api.tenants = make(map[string]*Tenant, len(tenants))
+		for _, tenant := range tenants {
+			s.api.tenants[tenant.ID] = &tenant
+		}
+	}
+}
+
+// WithKeyPolicy sets the rules new config keys must satisfy and whether keys are lowercased
+func WithKeyPolicy(policy KeyPolicy) ServerOption {
+	return func(s *Server) {
+		s.api.keys = policy
+	}
+}
+
+// WithValueLimits sets the largest config values and descriptions accepted and the size above which list
+// results leave values out
+func WithValueLimits(limits ValueLimits) ServerOption {
+	return func(s *Server) {
+		s.api.values = limits
+	}
+}
+
+// WithValueRules sets the rules the values of config writes and approvals must satisfy
+func WithValueRules(rules ValueRules) ServerOption {
+	return func(s *Server) {
+		s.api.rules = rules
+	}
+}
+
+// WithProfile registers a named connection profile for the /v1/configs and /v1/approvals endpoints
+func WithProfile(profile ConnectionProfile) ServerOption {
+	return func(s *Server) {
+		s.api.addProfile(profile)
+	}
+}
+
+// WithDefaultProfile sets the profile used when a request does not name one
+func WithDefaultProfile(name string) ServerOption {
+	return func(s *Server) {
+		s.api.defaultProfile = name
+	}
+}
+
+// WithReadiness sets the per-database ping timeout and result cache TTL of /ready; zero values keep the defaults
+func WithReadiness(timeout, cacheTTL time.Duration) ServerOption {
+	return func(s *Server) {
+		s.api.readiness = newReadinessChecker(timeout, cacheTTL)
+	}
+}
+
+// WithStartupCheck sets the connectivity check CheckStartup runs and the policy it applies; zero timeouts
+// keep the defaults
+func WithStartupCheck(check StartupCheck) ServerOption {
+	return func(s *Server) {
+		if check.Timeout <= 0 {
+			check.Timeout = DefaultStartupTimeout
+		}
+		if check.RetryInterval <= 0 {
+			check.RetryInterval = DefaultStartupRetryInterval
+		}
+		s.api.startup.check = check
+	}
+}
+
+// WithKeepAlive sets the interval of the keepalive pings StartKeepAlive runs and the connections it warms up
+func WithKeepAlive(keepAlive KeepAlive) ServerOption {
+	return func(s *Server) {
+		s.api.keepAlive = newKeepAliver(keepAlive)
+	}
+}
+
+// WithConcurrencyLimit bounds the operations running at once on each connection and how long those beyond
+// the bound wait for a slot
+func WithConcurrencyLimit(limit ConcurrencyLimit) ServerOption {
+	return func(s *Server) {
+		s.api.operations = newOperationLimiter(limit)
+	}
+}
+
+// WithCircuitBreaker sets when the circuit breaker of a connection opens and how long it stays open
+func WithCircuitBreaker(cb CircuitBreaker) ServerOption {
+	return func(s *Server) {
+		s.api.breakers = newCircuitBreakers(cb)
+	}
+}
+
+// WithHealthAlerts sets how the connection profiles turning unhealthy and recovering are notified
+func WithHealthAlerts(alerts HealthAlerts) ServerOption {
+	return func(s *Server) {
+		s.api.alerts = newHealthAlerter(alerts)
+	}
+}
+
+// WithLogger sets the logger used for request logs and passed on to connectors
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.api.logger = logger
+	}
+}
+
+// WithStatementLogger sets the logger timing the statements of request connections, whose counters
+// /metrics reports; pass the same logger to the connectors of profiles to count theirs too
+func WithStatementLogger(statements *connectors.StatementLogger) ServerOption {
+	return func(s *Server) {
+		if statements != nil {
+			s.api.statements = statements
+		}
+	}
+}
+
+// NewServer creates a new HTTP server with the settings of cfg, which opts may override; zero settings keep
+// the defaults
+func NewServer(cfg config.ServerConfig, opts ...ServerOption) *Server {
+	s := &Server{
+		api:      NewAPI(),
+		port:     cfg.Port,
+		timeouts: DefaultTimeouts(),
+	}
+	for _, opt := range append(configOptions(cfg), opts...) {
+		opt(s)
+	}
+	return s
+}
+
+// configOptions maps the bind address, timeouts, TLS, readiness, phase timeouts, body limit, idempotency,
+// query cache, result size, startup check, keepalive, concurrency and circuit breaker settings of cfg onto
+// server options
+func configOptions(cfg config.ServerConfig) []ServerOption {
+	return []ServerOption{
+		WithHost(cfg.Host),
+		WithTimeouts(Timeouts{
+			ReadHeader: cfg.ReadHeaderTimeout,
+			Read:       cfg.ReadTimeout,
+			Write:      cfg.WriteTimeout,
+			Idle:       cfg.IdleTimeout,
+		}),
+		WithTLS(TLSOptions{
+			CertFile:     cfg.TLS.CertFile,
+			KeyFile:      cfg.TLS.KeyFile,
+			ClientCAFile: cfg.TLS.ClientCAFile,
+		}),
+		WithReadiness(cfg.ReadyTimeout, cfg.ReadyCacheTTL),
+		WithPhaseTimeouts(PhaseTimeouts{
+			Connect:      cfg.ConnectTimeout,
+			Operation:    cfg.OperationTimeout,
+			MaxConnect:   cfg.MaxConnectTimeout,
+			MaxOperation: cfg.MaxOperationTimeout,
+		}),
+		WithMaxRequestBytes(cfg.MaxRequestBytes),
+		WithIdempotencyTTL(cfg.IdempotencyTTL),
+		WithQueryCacheBytes(cfg.QueryCacheBytes),
+		WithMaxResultBytes(cfg.MaxResultBytes),
+		WithStrictOperations(cfg.StrictOperations),
+		WithStartupCheck(StartupCheck{
+			Policy:        StartupPolicy(cfg.StartupCheck),
+			Timeout:       cfg.StartupTimeout,
+			RetryInterval: cfg.StartupRetryInterval,
+		}),
+		WithKeepAlive(KeepAlive{Interval: cfg.KeepAliveInterval, WarmUpConns: cfg.WarmUpConns}),
+		WithConcurrencyLimit(ConcurrencyLimit{MaxOperations: cfg.MaxConcurrentOperations, QueueTimeout: cfg.OperationQueueTimeout}),
+		WithCircuitBreaker(CircuitBreaker{
+			FailureRate: cfg.CircuitBreaker.FailureRate,
+			MinRequests: cfg.CircuitBreaker.MinRequests,
+			Window:      cfg.CircuitBreaker.Window,
+			Cooldown:    cfg.CircuitBreaker.Cooldown,
+		}),
+	}
+}
+
+// API returns the API the server serves, configured by the server options
+func (s *Server) API() *API {
+	return s.api
+}
+
+// Start starts the HTTP server, serving HTTPS when TLS is configured
+func (s *Server) Start() error {
+	server, err := s.HTTPServer()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.httpServer = server
+	s.mu.Unlock()
+
+	logger := s.api.logger
+	scheme := "http"
+	if s.tls.Enabled() {
+		scheme = "https"
+	}
+	logger.Info("Database Connectors API server starting",
+		"addr", server.Addr,
+		"version", s.api.build.Version,
+		"tls", s.tls.Enabled(),
+		"mtls", s.tls.ClientCAFile != "",
+		"docs", fmt.Sprintf("%s://localhost:%d", scheme, s.port),
+	)
+	logger.Debug("endpoints are served under /v1; unversioned paths remain as aliases")
+	logger.Debug("endpoint", "route", "GET  /", "description", "Documentation landing page")
+	logger.Debug("endpoint", "route", "GET  /health", "description", "Health check")
+	logger.Debug("endpoint", "route", "GET  /ready", "description", "Readiness check pinging the connection profiles")
+	logger.Debug("endpoint", "route", "POST /test-connection", "description", "Test database connection")
+	logger.Debug("endpoint", "route", "POST /execute", "description", "Execute database operation")
+	logger.Debug("endpoint", "route", "POST /execute-batch", "description", "Execute statements on one connection")
+	if s.api.jobs != nil {
+		logger.Debug("endpoint", "route", "POST /jobs", "description", "Submit an asynchronous operation")
+		logger.Debug("endpoint", "route", "GET  /jobs/{id}", "description", "Job status (DELETE cancels)")
+		logger.Debug("endpoint", "route", "GET  /jobs/{id}/result", "description", "Job result as JSON Lines or CSV")
+	}
+	logger.Debug("endpoint", "route", "POST /allconfig", "description", "Check/manage allconfig table")
+	logger.Debug("endpoint", "route", "POST /allconfig-operation", "description", "Perform operations on allconfig table")
+	if len(s.api.profileNames()) > 0 {
+		logger.Debug("endpoint", "route", "GET  /v1/configs[/{key}]", "description", "Approved configs (PUT/DELETE /v1/configs/{key} write)")
+		logger.Debug("endpoint", "route", "GET  /v1/approvals", "description", "Pending approvals (POST /v1/approvals/{id}/approve|reject)")
+		logger.Debug("endpoint", "route", "GET  /v1/connections", "description", "Connection state (POST /v1/connections/{name}/ping, DELETE /v1/connections/{name})")
+		logger.Info("connection profiles configured", "profiles", s.api.profileNames(), "default", s.api.defaultProfile)
+	}
+	logger.Debug("endpoint", "route", "GET  /docs", "description", "Swagger UI documentation")
+	logger.Debug("endpoint", "route", "GET  /docs/assets/", "description", "Swagger UI assets")
+	logger.Debug("endpoint", "route", "GET  /swagger.json", "description", "OpenAPI JSON specification")
+	logger.Debug("endpoint", "route", "GET  /swagger.yaml", "description", "OpenAPI YAML specification")
+	if s.api.cors.AllowsAnyOrigin() {
+		logger.Warn("CORS allows any origin; set server.cors.allowed_origins to restrict browser access")
+	}
+	if s.api.limiter != nil {
+		limit := s.api.limiter.policy.Default
+		logger.Info("rate limiting enabled", "requests_per_second", limit.RequestsPerSecond, "burst", limit.Burst)
+	}
+	if s.api.maxRequestBytes > 0 {
+		logger.Info("request body size limited", "max_request_bytes", s.api.maxRequestBytes)
+	}
+	if s.api.policy.ReadOnly {
+		logger.Info("read-only mode enabled: /execute only accepts read statements")
+	}
+
+	if s.tls.Enabled() {
+		return server.ListenAndServeTLS(s.tls.CertFile, s.tls.KeyFile)
+	}
+	return server.ListenAndServe()
+}
+
+// Shutdown stops the server started by Start, waiting for requests in flight, then closes the connections
+// of the profiles. Once ctx is done it stops waiting, so a short deadline forces a fast exit. Start returns
+// http.ErrServerClosed, also when it is called after Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.httpServer
+	s.shutdown = true
+	s.mu.Unlock()
+	var err error
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+	return errors.Join(err, s.api.Close(ctx))
+}
+
+// HTTPServer builds the http.Server for the configured address, timeouts and TLS settings
+func (s *Server) HTTPServer() (*http.Server, error) {
+	tlsConfig, err := s.tls.serverConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Server{
+		Addr:              net.JoinHostPort(s.host, strconv.Itoa(s.port)),
+		Handler:           s.routes(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: s.timeouts.ReadHeader,
+		ReadTimeout:       s.timeouts.Read,
+		WriteTimeout:      s.timeouts.Write,
+		IdleTimeout:       s.timeouts.Idle,
+		ErrorLog:          slog.NewLogLogger(s.api.logger.Handler(), slog.LevelWarn),
+	}, nil
+}
+
+// routes registers all endpoints and wraps them in the request ID, logging, CORS, rate limit and body limit middleware
+func (s *Server) routes() http.Handler {
+	router := s.router()
+	return requestIDMiddleware(s.api.loggingMiddleware(s.corsMiddleware(router, s.api.rateLimitMiddleware(s.api.bodyLimitMiddleware(router)))))
+}
+
+// router registers the API routes under /v1, their unversioned aliases and the documentation routes
+func (s *Server) router() *Router {
+	router := NewRouter(s.api)
+
+	// Unversioned paths are kept as aliases for existing clients; newer endpoints are only served under /v1
+	for _, route := range s.apiRoutes() {
+		handler := route.handler
+		if route.idempotent {
+			handler = s.api.idempotencyMiddleware(handler)
+		}
+		router.HandleFunc(route.method, "/v1"+route.pattern, handler)
+		if !route.versionedOnly {
+			router.HandleFunc(route.method, route.pattern, handler)
+		}
+	}
+
+	// Swagger documentation routes
+	router.HandleFunc(http.MethodGet, "/", s.DocumentationIndexHandler)
+	router.HandleFunc(http.MethodGet, "/docs", s.SwaggerHandler)
+	router.HandleFunc(http.MethodGet, "/docs/assets/{path...}", s.SwaggerAssetsHandler)
+	router.HandleFunc(http.MethodGet, "/docs/{path...}", s.SwaggerHandler)
+	router.HandleFunc(http.MethodGet, "/swagger.json", s.SwaggerJSONHandler)
+	router.HandleFunc(http.MethodGet, "/swagger.yaml", s.SwaggerYAMLHandler)
+
+	return router
+}
+
+// SetupRoutes creates and returns a configured HTTP handler with all routes
+func SetupRoutes(apiInstance *API) http.Handler {
+	server := &Server{api: apiInstance, port: 8080} // port doesn't matter for tests
+	return server.routes()
 }
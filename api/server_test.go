@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerShutdown(t *testing.T) {
+	conn := newProfileConnector("mysql")
+	conn.On("Close").Return(nil)
+	server := NewServer(config.ServerConfig{}, WithHost("127.0.0.1"), WithProfile(ConnectionProfile{Name: "primary", Connector: conn}))
+
+	started := make(chan error, 1)
+	go func() { started <- server.Start() }()
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	select {
+	case err := <-started:
+		assert.ErrorIs(t, err, http.ErrServerClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Shutdown")
+	}
+	conn.AssertCalled(t, "Close")
+
+	// A server shut down before it starts never serves
+	assert.ErrorIs(t, server.Start(), http.ErrServerClosed)
+}
+
+func TestAPICloseJoinsErrors(t *testing.T) {
+	failing := newProfileConnector("mysql")
+	failing.On("Close").Return(errors.New("already closed"))
+	closing := newProfileConnector("postgresql")
+	closing.On("Close").Return(nil)
+	api := NewAPI()
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: failing})
+	api.addProfile(ConnectionProfile{Name: "reporting", Connector: closing})
+
+	assert.EqualError(t, api.Close(context.Background()), "failed to close primary: already closed")
+	closing.AssertCalled(t, "Close")
+}
+
+func TestNewServerConfig(t *testing.T) {
+	cfg := config.ServerConfig{
+		Host:            "127.0.0.1",
+		Port:            8443,
+		ReadTimeout:     15 * time.Second,
+		IdleTimeout:     time.Minute,
+		MaxRequestBytes: 4096,
+		TLS: config.TLSConfig{
+			CertFile: "server.crt",
+			KeyFile:  "server.key",
+		},
+	}
+
+	s := NewServer(cfg)
+	server, err := s.HTTPServer()
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8443", server.Addr)
+	assert.Equal(t, 15*time.Second, server.ReadTimeout)
+	assert.Equal(t, time.Minute, server.IdleTimeout)
+	assert.Equal(t, DefaultReadHeaderTimeout, server.ReadHeaderTimeout)
+	assert.Equal(t, DefaultWriteTimeout, server.WriteTimeout)
+	assert.NotNil(t, server.TLSConfig)
+	assert.Equal(t, int64(4096), s.api.maxRequestBytes)
+
+	// Options override the configuration
+	server, err = NewServer(cfg, WithHost("::1"), WithTLS(TLSOptions{})).HTTPServer()
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:8443", server.Addr)
+	assert.Nil(t, server.TLSConfig)
+
+	// An empty configuration keeps the defaults
+	s = NewServer(config.ServerConfig{Port: 8080})
+	server, err = s.HTTPServer()
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", server.Addr)
+	assert.Nil(t, server.TLSConfig)
+	assert.Equal(t, DefaultPhaseTimeouts(), s.api.phaseTimeouts)
+	assert.Equal(t, int64(DefaultMaxResultBytes), s.api.maxResultBytes)
+	assert.NotNil(t, s.api.queryCache)
+}
+
+func TestNewServerStartupCheck(t *testing.T) {
+	report := func(cfg config.ServerConfig) *httptest.ResponseRecorder {
+		server := NewServer(cfg)
+		require.NoError(t, server.API().CheckStartup(context.Background()))
+		rr := httptest.NewRecorder()
+		server.API().StartupReportHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/startup-report", nil))
+		return rr
+	}
+
+	rr := report(config.ServerConfig{StartupCheck: "degraded"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"policy":"degraded","healthy":true`)
+
+	// Without a policy no check runs
+	assert.Equal(t, http.StatusNotFound, report(config.ServerConfig{}).Code)
+}
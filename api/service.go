@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors"
+)
+
+// Errors returned by the allconfig operations for keys and requests that do not exist, or keys that
+// already exist
+var (
+	ErrConfigNotFound  = allconfig.ErrConfigNotFound
+	ErrConfigExists    = allconfig.ErrConfigExists
+	ErrRequestNotFound = allconfig.ErrRequestNotFound
+)
+
+// ConfigService returns the allconfig service of the API, shared by the allconfig operations, the config
+// resource handlers and the allconfig CLI subcommands. Its checked methods normalize keys with the key
+// policy, check keys they would create against it and check writes against the value limits.
+func (a *API) ConfigService() *allconfig.ConfigService {
+	return allconfig.NewConfigService(configStore{api: a}, configPolicy{api: a}, a.configMetrics)
+}
+
+// configService returns the allconfig service running on connector. Dry runs change nothing, so they are
+// counted in no metrics.
+func (a *API) configService(connector connectors.DBConnector) *allconfig.ConfigService {
+	if _, dryRun := connector.(*dryRunConnector); dryRun {
+		return allconfig.NewConfigService(configStore{api: a}, configPolicy{api: a}, nil)
+	}
+	return a.ConfigService()
+}
+
+// ConfigTable returns table, or the default allconfig table when table is empty
+func (a *API) ConfigTable(table string) string {
+	return a.tableName(table)
+}
+
+// configTable returns the allconfig table of a connection profile, or the table of the tenant in ctx
+// when there is one
+func (a *API) configTable(ctx context.Context, p *profile) string {
+	if tenant := tenantFrom(ctx); tenant != nil {
+		return a.tenantTable(tenant, "")
+	}
+	return a.tableName(p.TableName)
+}
+
+// configPolicy checks the writes of the ConfigService with the key policy and value limits
+type configPolicy struct {
+	api *API
+}
+
+// CheckWrite checks the value and description against the value limits, and the tags
+func (p configPolicy) CheckWrite(key string, value interface{}, description string, tags []string) error {
+	if err := p.api.values.checkConfig(key, value, description); err != nil {
+		return err
+	}
+	return checkTags("tags", tags)
+}
+
+// CheckNewKey checks a key a write would create against the key policy
+func (p configPolicy) CheckNewKey(key string) error {
+	return p.api.keys.checkKey(key)
+}
+
+// readRequestOf returns the key an allconfig operation reads
+func readRequestOf(req *AllConfigOperationRequest) allconfig.ReadRequest {
+	return allconfig.ReadRequest{Table: req.TableName, Key: req.Key}
+}
+
+// listRequestOf returns the page of an allconfig list operation
+func listRequestOf(req *AllConfigOperationRequest) allconfig.ListRequest {
+	return allconfig.ListRequest{Table: req.TableName, MakerID: req.MakerID, Limit: req.Limit, Offset: req.Offset}
+}
+
+// searchRequestOf returns the search of a search or filter operation
+func searchRequestOf(req *AllConfigOperationRequest) allconfig.SearchRequest {
+	return allconfig.SearchRequest{
+		Table:   req.TableName,
+		Term:    req.SearchTerm,
+		Filter:  req.Filter,
+		TagsAny: req.TagsAny,
+		TagsAll: req.TagsAll,
+		Limit:   req.Limit,
+		Offset:  req.Offset,
+	}
+}
+
+// setRequestOf returns the write of a direct create or update
+func setRequestOf(req *AllConfigOperationRequest) allconfig.SetRequest {
+	return allconfig.SetRequest{
+		Table:       req.TableName,
+		Key:         req.Key,
+		Value:       req.Value,
+		Description: req.Description,
+		Tags:        req.Tags,
+		ExpiresAt:   req.ExpiresAt,
+		MakerID:     req.MakerID,
+	}
+}
+
+// deleteRequestOf returns the delete of a direct delete
+func deleteRequestOf(req *AllConfigOperationRequest) allconfig.DeleteRequest {
+	return allconfig.DeleteRequest{Table: req.TableName, Key: req.Key, Description: req.Description, MakerID: req.MakerID}
+}
+
+// submitRequestOf returns the change a submit operation asks for; deletes carry no value, tags or expiry
+func submitRequestOf(req *AllConfigOperationRequest, operation string) allconfig.SubmitRequest {
+	submit := allconfig.SubmitRequest{
+		Table:       req.TableName,
+		Operation:   operation,
+		Key:         req.Key,
+		Description: req.Description,
+		MakerID:     req.MakerID,
+	}
+	if operation != allconfig.OperationDelete {
+		submit.Value, submit.Tags, submit.ExpiresAt = req.Value, req.Tags, req.ExpiresAt
+	}
+	return submit
+}
+
+// decisionRequestOf returns the decision of an approve or reject operation
+func decisionRequestOf(req *AllConfigOperationRequest) allconfig.DecisionRequest {
+	return allconfig.DecisionRequest{Table: req.TableName, RequestID: req.RequestID, CheckerID: req.CheckerID, Comment: req.ApprovalComment}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newServiceConnector returns a mock connector of the given type; the service expects it to be connected already
+func newServiceConnector(dbType string) *connectortest.MockDBConnector {
+	conn := new(connectortest.MockDBConnector)
+	conn.On("GetType").Return(dbType)
+	return conn
+}
+
+func TestConfigTable(t *testing.T) {
+	api := NewAPI()
+	assert.Equal(t, "allconfig", api.ConfigTable(""))
+	assert.Equal(t, "settings", api.ConfigTable("settings"))
+
+	api.allConfigTable = "cfg_allconfig"
+	assert.Equal(t, "cfg_allconfig", api.ConfigTable(""))
+}
+
+func TestConfigServiceGet(t *testing.T) {
+	conn := newServiceConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("WHERE config_key = ?"), []interface{}{"feature.flag"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature.flag", "on"}), nil).Once()
+	conn.On("Query", mock.Anything, queryContaining("WHERE config_key = ?"), []interface{}{"missing"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}), nil).Once()
+	service := NewAPI().ConfigService()
+
+	config, err := service.Get(context.Background(), conn, allconfig.ReadRequest{Table: "allconfig", Key: "feature.flag"})
+	require.NoError(t, err)
+	assert.Equal(t, "on", config.(map[string]interface{})["config_value"])
+
+	_, err = service.Get(context.Background(), conn, allconfig.ReadRequest{Table: "allconfig", Key: "missing"})
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	assert.EqualError(t, err, "config not found: missing")
+}
+
+func TestConfigServiceWrites(t *testing.T) {
+	existsRows := func(count int) interface{} {
+		return newMockRows(t, []string{"COUNT(*)"}, []driver.Value{count})
+	}
+	queryPrefix := func(prefix string) interface{} {
+		return mock.MatchedBy(func(params map[string]interface{}) bool {
+			return strings.HasPrefix(params["query"].(string), prefix)
+		})
+	}
+	ctx := context.Background()
+
+	t.Run("set creates and updates", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(0), nil).Once()
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(1), nil).Once()
+		conn.On("Execute", mock.Anything, "execute", queryPrefix("INSERT INTO settings ")).Return(map[string]interface{}{"rows_affected": 1}, nil).Once()
+		conn.On("Execute", mock.Anything, "execute", queryPrefix("UPDATE settings ")).Return(map[string]interface{}{"rows_affected": 1}, nil).Once()
+		expectConfigTimestamps(t, conn, 2)
+		service := NewAPI().ConfigService()
+
+		result, created, err := service.DirectSet(ctx, conn, allconfig.SetRequest{Table: "settings", Key: "feature.flag", Value: "on", MakerID: "alice"})
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, writtenAt.UTC(), *result.(*ConfigWrite).CreatedAt)
+
+		_, created, err = service.DirectSet(ctx, conn, allconfig.SetRequest{Table: "settings", Key: "feature.flag", Value: "off", MakerID: "alice"})
+		require.NoError(t, err)
+		assert.False(t, created)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("delete requires an existing key", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(0), nil)
+
+		service := NewAPI().ConfigService()
+
+		_, err := service.DirectDelete(ctx, conn, allconfig.DeleteRequest{Table: "allconfig", Key: "missing", MakerID: "alice"})
+		assert.ErrorIs(t, err, ErrConfigNotFound)
+		_, err = service.SubmitDelete(ctx, conn, allconfig.DeleteRequest{Table: "allconfig", Key: "missing", MakerID: "bob"})
+		assert.ErrorIs(t, err, ErrConfigNotFound)
+		conn.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("submit", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).Return(existsRows(1), nil)
+		conn.On("Execute", mock.Anything, "execute", queryPrefix("INSERT INTO allconfig_approval_requests ")).
+			Return(map[string]interface{}{"rows_affected": 1}, nil).Once()
+		service := NewAPI().ConfigService()
+
+		submitted, err := service.SubmitSet(ctx, conn, allconfig.SetRequest{Table: "allconfig", Key: "feature.flag", Value: "on", MakerID: "bob"})
+		require.NoError(t, err)
+		assert.Equal(t, allconfig.OperationUpdate, submitted.Operation)
+
+		_, err = service.SubmitSet(ctx, conn, allconfig.SetRequest{Table: "allconfig", Key: "feature.flag", Value: "on"})
+		assert.ErrorIs(t, err, allconfig.ErrMakerIDRequired)
+		conn.AssertExpectations(t)
+	})
+}
+
+func TestConfigServiceDecisions(t *testing.T) {
+	ctx := context.Background()
+	pending := map[string]interface{}{
+		"request_id": "req-1",
+		"config_key": "feature.flag",
+		"operation":  "delete",
+		"maker_id":   "bob",
+	}
+
+	conn := newServiceConnector("mongodb")
+	conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(pending, nil).Twice()
+	conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(nil, connectors.ErrNotFound)
+	conn.On("Execute", mock.Anything, "delete", mock.Anything).Return(int64(1), nil)
+	conn.On("Execute", mock.Anything, "update", mock.Anything).Return(map[string]interface{}{"modified_count": 1}, nil)
+	service := NewAPI().ConfigService()
+
+	_, err := service.Decide(ctx, conn, allconfig.DecisionRequest{Table: "allconfig", RequestID: "req-1"}, true)
+	assert.ErrorIs(t, err, allconfig.ErrCheckerIDRequired)
+
+	decision, err := service.Decide(ctx, conn, allconfig.DecisionRequest{Table: "allconfig", RequestID: "req-1", CheckerID: "alice", Comment: "LGTM"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, allconfig.StatusApproved, decision.Status)
+
+	_, err = service.Decide(ctx, conn, allconfig.DecisionRequest{Table: "allconfig", RequestID: "req-2", CheckerID: "alice"}, false)
+	assert.ErrorIs(t, err, ErrRequestNotFound)
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StartupPolicy decides how the server starts when a connection profile fails the startup check
+type StartupPolicy string
+
+// Startup policies; the zero value is off
+const (
+	StartupPolicyOff      StartupPolicy = "off"      // No startup check; profiles connect on first use
+	StartupPolicyFail     StartupPolicy = "fail"     // Refuse to start while a profile is down
+	StartupPolicyDegraded StartupPolicy = "degraded" // Start, reporting the profiles that are down in /ready
+	StartupPolicyRetry    StartupPolicy = "retry"    // Start degraded and retry the profiles that are down until they come up
+)
+
+// Default startup check settings
+const (
+	DefaultStartupTimeout       = 5 * time.Second  // Connect and ping timeout of each profile
+	DefaultStartupRetryInterval = time.Second      // First delay between retries, doubling after each
+	MaxStartupRetryInterval     = 30 * time.Second // Longest delay between retries
+)
+
+// ErrStartupCheckFailed is returned by CheckStartup under the fail policy when a profile is down
+var ErrStartupCheckFailed = errors.New("startup check failed")
+
+// StartupCheck configures the connectivity check of the connection profiles run before the server starts
+type StartupCheck struct {
+	Policy        StartupPolicy
+	Timeout       time.Duration // Connect and ping timeout of each profile
+	RetryInterval time.Duration // First delay between retries under the retry policy
+}
+
+// StartupStatus is the result of the startup check of one connection profile
+type StartupStatus struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Status    string `json:"status"` // up or down
+	LatencyMS int64  `json:"latency_ms"`
+	Attempts  int    `json:"attempts"`
+	ErrorCode string `json:"error_code,omitempty"` // Classifies the failure, such as AUTH_FAILED or HOST_UNREACHABLE
+	Error     string `json:"error,omitempty"`
+}
+
+// StartupReport is the result of the startup check, kept up to date while profiles are retried
+type StartupReport struct {
+	Policy    StartupPolicy   `json:"policy"`
+	Healthy   bool            `json:"healthy"`
+	Retrying  bool            `json:"retrying"` // Profiles that are down are still being retried
+	Databases []StartupStatus `json:"databases"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// startupState holds the startup check settings and the report of the last check
+type startupState struct {
+	check  StartupCheck
+	mu     sync.Mutex
+	report *StartupReport // nil until CheckStartup has run
+}
+
+// get returns a copy of the report, or false before the check has run
+func (s *startupState) get() (StartupReport, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.report == nil {
+		return StartupReport{}, false
+	}
+	report := *s.report
+	report.Databases = append([]StartupStatus(nil), s.report.Databases...)
+	return report, true
+}
+
+// record stores the statuses of a round of pings, counting the attempts of profiles checked before
+func (s *startupState) record(statuses []StartupStatus, retrying bool, now time.Time) StartupReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.report == nil {
+		s.report = &StartupReport{Policy: s.check.Policy}
+	}
+	for _, status := range statuses {
+		i := s.report.index(status.Name)
+		if i < 0 {
+			s.report.Databases = append(s.report.Databases, status)
+			continue
+		}
+		status.Attempts += s.report.Databases[i].Attempts
+		s.report.Databases[i] = status
+	}
+	s.report.Healthy = true
+	for _, status := range s.report.Databases {
+		if status.Status != "up" {
+			s.report.Healthy = false
+		}
+	}
+	s.report.Retrying = retrying
+	s.report.CheckedAt = now
+	return *s.report
+}
+
+// index returns the position of the named profile in the report, or -1
+func (r *StartupReport) index(name string) int {
+	for i, status := range r.Databases {
+		if status.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckStartup connects and pings every connection profile in parallel, logs the result of each and
+// applies the startup policy. Under fail it returns ErrStartupCheckFailed naming the profiles that are down;
+// under retry it keeps retrying them in the background until they come up or ctx is done. Profiles that are
+// down are reported by /ready, and the report is served at /v1/admin/startup-report. Does nothing under the
+// off policy.
+func (a *API) CheckStartup(ctx context.Context) error {
+	policy := a.startup.check.Policy
+	if policy == "" || policy == StartupPolicyOff {
+		return nil
+	}
+
+	statuses := a.pingStartup(ctx, a.profileList())
+	down := downProfiles(statuses)
+	retrying := policy == StartupPolicyRetry && len(down) > 0
+	a.startup.record(statuses, retrying, time.Now())
+	a.readiness.store(startupReadiness(statuses, a.readiness.now()))
+	a.logger.Info("startup check finished",
+		"policy", policy,
+		"up", len(statuses)-len(down),
+		"down", len(down),
+	)
+
+	if len(down) == 0 {
+		return nil
+	}
+	switch policy {
+	case StartupPolicyFail:
+		return fmt.Errorf("%w: %s unreachable", ErrStartupCheckFailed, strings.Join(down, ", "))
+	case StartupPolicyRetry:
+		go a.retryStartup(ctx, down)
+	}
+	a.logger.Warn("starting with unreachable databases", "policy", policy, "connections", down)
+	return nil
+}
+
+// retryStartup pings the named profiles with growing delays until all are up or ctx is done
+func (a *API) retryStartup(ctx context.Context, names []string) {
+	interval := a.startup.check.RetryInterval
+	for len(names) > 0 {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			a.startup.record(nil, false, time.Now())
+			return
+		case <-timer.C:
+		}
+
+		var profiles []*profile
+		for _, name := range names {
+			if p, ok := a.lookupProfile(name); ok {
+				profiles = append(profiles, p)
+			}
+		}
+		statuses := a.pingStartup(ctx, profiles)
+		names = downProfiles(statuses)
+		report := a.startup.record(statuses, len(names) > 0, time.Now())
+		for _, status := range statuses {
+			if status.Status == "up" {
+				a.logger.Info("database came up", "connection", status.Name, "attempts", report.Databases[report.index(status.Name)].Attempts)
+			}
+		}
+		interval = min(interval*2, MaxStartupRetryInterval)
+	}
+}
+
+// pingStartup pings profiles in parallel within the startup timeout, logging the result of each
+func (a *API) pingStartup(ctx context.Context, profiles []*profile) []StartupStatus {
+	statuses := make([]StartupStatus, len(profiles))
+	var wg sync.WaitGroup
+	for i, p := range profiles {
+		wg.Add(1)
+		go func(i int, p *profile) {
+			defer wg.Done()
+			status, err := pingProfile(ctx, p, a.startup.check.Timeout)
+			statuses[i] = StartupStatus{
+				Name:      status.Name,
+				Type:      status.Type,
+				Status:    status.Status,
+				LatencyMS: status.LatencyMS,
+				Attempts:  1,
+				Error:     status.Error,
+			}
+			if err != nil {
+				_, statuses[i].ErrorCode = classifyDatabaseError(err)
+				a.logger.Warn("database is unreachable",
+					"connection", status.Name,
+					"type", status.Type,
+					"error_code", statuses[i].ErrorCode,
+					"error", status.Error,
+				)
+				return
+			}
+			a.registry.MarkPinged(p.Name)
+			a.logger.Info("database is reachable", "connection", status.Name, "type", status.Type, "latency_ms", status.LatencyMS)
+		}(i, p)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// startupReadiness returns the startup statuses as a readiness report, so that /ready answers with them
+// until it pings again
+func startupReadiness(statuses []StartupStatus, now time.Time) ReadinessReport {
+	report := ReadinessReport{Ready: true, Databases: make([]DatabaseStatus, len(statuses)), CheckedAt: now}
+	for i, status := range statuses {
+		report.Databases[i] = DatabaseStatus{
+			Name:      status.Name,
+			Type:      status.Type,
+			Status:    status.Status,
+			LatencyMS: status.LatencyMS,
+			Error:     status.Error,
+		}
+		if status.Status != "up" {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+// downProfiles returns the names of the profiles whose status is not up
+func downProfiles(statuses []StartupStatus) []string {
+	var down []string
+	for _, status := range statuses {
+		if status.Status != "up" {
+			down = append(down, status.Name)
+		}
+	}
+	return down
+}
+
+// StartupReportHandler returns the report of the startup check, which is updated while profiles are retried
+func (a *API) StartupReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, ok := a.startup.get()
+	if !ok {
+		a.sendError(w, http.StatusNotFound, ErrorCodeNotFound, "The startup check is not enabled")
+		return
+	}
+	message := "All databases were reachable at startup"
+	if !report.Healthy {
+		message = fmt.Sprintf("%d of %d databases are unreachable", len(downProfiles(report.Databases)), len(report.Databases))
+	}
+	a.sendSuccess(w, report, message)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/connectors/connectortest"
+	"db-connectors/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// startupAPI returns an API checking the primary profile, which is up, and the reporting profile, whose
+// pings are answered by pings in turn, at startup under policy
+func startupAPI(policy StartupPolicy, pings ...error) (*API, *connectortest.MockDBConnector, *bytes.Buffer) {
+	reporting := newProfileConnector("postgresql")
+	for _, err := range pings {
+		reporting.On("Ping", mock.Anything).Return(err).Once()
+	}
+	var buf bytes.Buffer
+	api := NewServer(config.ServerConfig{},
+		WithStartupCheck(StartupCheck{Policy: policy, RetryInterval: time.Millisecond}),
+		WithLogger(logging.New(logging.Options{Level: "info", Format: logging.FormatJSON, Output: &buf})),
+		WithProfile(ConnectionProfile{Name: "primary", Connector: newPingConnector("mysql", nil)}),
+		WithProfile(ConnectionProfile{Name: "reporting", Connector: reporting}),
+	).API()
+	return api, reporting, &buf
+}
+
+// refused is the error of a database host refusing connections
+var refused = fmt.Errorf("dial tcp 10.0.0.7:5432: %w", syscall.ECONNREFUSED)
+
+func serveStartupReport(t *testing.T, api *API) (int, StartupReport) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	SetupRoutes(api).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/startup-report", nil))
+	var response struct {
+		Data StartupReport `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return rr.Code, response.Data
+}
+
+func TestStartupCheckFail(t *testing.T) {
+	api, _, logs := startupAPI(StartupPolicyFail, refused)
+	err := api.CheckStartup(context.Background())
+	assert.ErrorIs(t, err, ErrStartupCheckFailed)
+	assert.EqualError(t, err, "startup check failed: reporting unreachable")
+
+	_, report := serveStartupReport(t, api)
+	assert.False(t, report.Healthy)
+	require.Len(t, report.Databases, 2)
+	assert.Equal(t, "up", report.Databases[0].Status)
+	assert.Equal(t, "down", report.Databases[1].Status)
+	assert.Equal(t, ErrorCodeHostUnreachable, report.Databases[1].ErrorCode)
+	assert.Contains(t, report.Databases[1].Error, "connection refused")
+
+	// Each connection is logged with its classified failure, then the summary
+	assert.Contains(t, logs.String(), `"msg":"database is reachable","connection":"primary"`)
+	assert.Contains(t, logs.String(), `"msg":"database is unreachable","connection":"reporting","type":"postgresql","error_code":"HOST_UNREACHABLE"`)
+	assert.Contains(t, logs.String(), `"msg":"startup check finished","policy":"fail","up":1,"down":1`)
+
+	// All profiles up start the server
+	api, _, _ = startupAPI(StartupPolicyFail, nil)
+	assert.NoError(t, api.CheckStartup(context.Background()))
+}
+
+func TestStartupCheckDegraded(t *testing.T) {
+	api, reporting, logs := startupAPI(StartupPolicyDegraded, refused)
+	require.NoError(t, api.CheckStartup(context.Background()))
+	assert.Contains(t, logs.String(), `"msg":"starting with unreachable databases","policy":"degraded","connections":["reporting"]`)
+
+	// /ready reports the profile that is down without pinging again
+	code, readiness := serveReady(t, api)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "down", readiness.Databases[1].Status)
+	reporting.AssertNumberOfCalls(t, "Ping", 1)
+
+	code, report := serveStartupReport(t, api)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, report.Healthy)
+	assert.False(t, report.Retrying, "degraded does not retry")
+	assert.Equal(t, StartupPolicyDegraded, report.Policy)
+}
+
+func TestStartupCheckRetry(t *testing.T) {
+	api, reporting, _ := startupAPI(StartupPolicyRetry, refused, refused, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, api.CheckStartup(ctx))
+
+	_, report := serveStartupReport(t, api)
+	assert.True(t, report.Retrying)
+	assert.False(t, report.Healthy)
+
+	require.Eventually(t, func() bool {
+		report, _ := api.startup.get()
+		return report.Healthy
+	}, time.Second, time.Millisecond)
+	_, report = serveStartupReport(t, api)
+	assert.False(t, report.Retrying)
+	assert.Equal(t, "up", report.Databases[1].Status)
+	assert.Equal(t, 3, report.Databases[1].Attempts)
+	assert.Empty(t, report.Databases[1].ErrorCode)
+	assert.Equal(t, 1, report.Databases[0].Attempts, "profiles up at startup are not retried")
+	reporting.AssertExpectations(t)
+}
+
+func TestStartupCheckRetryStops(t *testing.T) {
+	api, _, _ := startupAPI(StartupPolicyRetry, refused)
+	api.startup.check.RetryInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, api.CheckStartup(ctx))
+	cancel()
+
+	require.Eventually(t, func() bool {
+		report, _ := api.startup.get()
+		return !report.Retrying
+	}, time.Second, time.Millisecond)
+	report, _ := api.startup.get()
+	assert.False(t, report.Healthy)
+}
+
+func TestStartupCheckOff(t *testing.T) {
+	api, reporting, _ := startupAPI(StartupPolicyOff)
+	require.NoError(t, api.CheckStartup(context.Background()))
+	reporting.AssertNotCalled(t, "Ping", mock.Anything)
+
+	rr := httptest.NewRecorder()
+	SetupRoutes(api).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/startup-report", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "The startup check is not enabled")
+}
+
+func TestStartupReadiness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	report := startupReadiness([]StartupStatus{
+		{Name: "primary", Type: "mysql", Status: "up", Attempts: 1},
+		{Name: "reporting", Type: "postgresql", Status: "down", Attempts: 2, ErrorCode: ErrorCodeTimeout, Error: "timed out"},
+	}, now)
+	assert.Equal(t, ReadinessReport{
+		Ready: false,
+		Databases: []DatabaseStatus{
+			{Name: "primary", Type: "mysql", Status: "up"},
+			{Name: "reporting", Type: "postgresql", Status: "down", Error: "timed out"},
+		},
+		CheckedAt: now,
+	}, report)
+	assert.True(t, startupReadiness(nil, now).Ready)
+}
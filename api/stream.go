@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"db-connectors/connectors"
+	"db-connectors/requestid"
+)
+
+// StreamFormatJSONL streams the rows of a read as JSON Lines, one object per line followed by a trailer
+const StreamFormatJSONL = "jsonl"
+
+// DefaultStreamFlushRows is how many lines a streamed response writes between flushes
+const DefaultStreamFlushRows = 100
+
+// streamMongoOperations are the MongoDB operations of /execute whose documents may be streamed, next to
+// the SQL read operations
+var streamMongoOperations = map[string]bool{"find": true, "aggregate": true}
+
+// streamWriter writes a streamed response, flushing it every flushLines lines so that clients read the
+// lines as they are produced. Job result downloads, as JSON Lines or CSV, stream through it as well.
+type streamWriter struct {
+	w          http.ResponseWriter
+	flushLines int
+	lines      int
+}
+
+func newStreamWriter(w http.ResponseWriter, flushLines int) *streamWriter {
+	if flushLines <= 0 {
+		flushLines = DefaultStreamFlushRows
+	}
+	return &streamWriter{w: w, flushLines: flushLines}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	lines := s.lines + bytes.Count(p[:n], []byte{'\n'})
+	if lines/s.flushLines > s.lines/s.flushLines {
+		s.flush()
+	}
+	s.lines = lines
+	return n, err
+}
+
+// flush sends what was written so far; writers that cannot flush send it when the handler returns
+func (s *streamWriter) flush() {
+	http.NewResponseController(s.w).Flush()
+}
+
+// StreamTrailer is the last line of a JSON Lines response. Its _trailer key tells it from the rows, and a
+// response without one was cut off. As the status of the response is sent with its first line, a read
+// failing after it is reported here.
+type StreamTrailer struct {
+	Trailer   bool   `json:"_trailer"` // Always true
+	Success   bool   `json:"success"`
+	Rows      int    `json:"rows"`      // Rows written before the trailer
+	Truncated bool   `json:"truncated"` // The rows stopped at the server's max_result_bytes
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errStreamTruncated stops a read whose rows reached the result size limit of a stream
+var errStreamTruncated = errors.New("streamed rows reached the result size limit")
+
+// rowStream writes the rows of a read as JSON Lines. It implements jobs.ResultWriter, so operations run
+// into it the way they run into a job result. The response starts with the first row, until when a failed
+// read can still be answered with an error response.
+type rowStream struct {
+	ctx       context.Context // Of the request; done once its client goes away
+	w         http.ResponseWriter
+	out       *streamWriter
+	size      *connectors.ResultSize
+	cancel    context.CancelFunc // Stops the read when the rows are truncated
+	started   bool
+	rows      int
+	truncated bool
+}
+
+// newRowStream returns a stream of rows to w up to the server's result size limit, for a request of ctx
+func (a *API) newRowStream(ctx context.Context, w http.ResponseWriter, cancel context.CancelFunc) *rowStream {
+	return &rowStream{
+		ctx:    ctx,
+		w:      w,
+		out:    newStreamWriter(w, a.streamFlushRows),
+		size:   connectors.NewResultSize(a.maxResultBytes),
+		cancel: cancel,
+	}
+}
+
+// start sends the header of the response
+func (s *rowStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", "application/x-ndjson")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// SetColumns does nothing; every line carries its column names
+func (s *rowStream) SetColumns(columns []string) {}
+
+// SetRowsAffected does nothing; only reads are streamed
+func (s *rowStream) SetRowsAffected(n int64) {}
+
+// WriteRow writes a row as a line, or stops the read with errStreamTruncated once the rows grow past the
+// result size limit. A read whose client went away stops at the next row, even before the driver notices.
+func (s *rowStream) WriteRow(row map[string]interface{}) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.size.Add(row); err != nil {
+		s.truncated = true
+		s.cancel()
+		return errStreamTruncated
+	}
+	line, err := json.Marshal(utcTimes(row))
+	if err != nil {
+		return fmt.Errorf("failed to encode row: %w", err)
+	}
+	s.start()
+	if _, err := s.out.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write row: %w", err)
+	}
+	s.rows++
+	return nil
+}
+
+// finish writes the trailer reporting how the read ended, and flushes the response
+func (s *rowStream) finish(err error) {
+	s.start()
+	trailer := StreamTrailer{
+		Trailer:   true,
+		Success:   true,
+		Rows:      s.rows,
+		Truncated: s.truncated,
+		RequestID: s.w.Header().Get(requestid.Header),
+	}
+	if err != nil && !errors.Is(err, errStreamTruncated) {
+		trailer.Success = false
+		trailer.Error = connectionFailureMessage("Operation failed", err)
+		_, trailer.ErrorCode = classifyDatabaseError(err)
+	}
+	line, _ := json.Marshal(trailer)
+	s.out.Write(append(line, '\n'))
+	s.out.flush()
+}
+
+// checkStreamFormat rejects unknown stream formats, and streaming operations that do not read rows or
+// that ask for a response the stream cannot give
+func checkStreamFormat(req *DatabaseOperationRequest, format string) error {
+	if format == "" {
+		return nil
+	}
+	if format != StreamFormatJSONL {
+		return fmt.Errorf("format must be %s", StreamFormatJSONL)
+	}
+	if isSQLType(req.Type) && !sqlReadOperations[req.Operation] || !isSQLType(req.Type) && !streamMongoOperations[req.Operation] {
+		return fmt.Errorf("format %s is only supported for the query and select operations on SQL databases and find and aggregate on MongoDB", StreamFormatJSONL)
+	}
+	if req.wantsColumns() || req.CacheTTLSeconds > 0 {
+		return fmt.Errorf("format %s cannot be combined with include_columns, result_format or cache_ttl_seconds", StreamFormatJSONL)
+	}
+	return nil
+}
+
+// streamOperation runs a read of /execute sent with format=jsonl, writing its rows as JSON Lines as they
+// are read. A read failing before its first row is answered with an error response.
+func (a *API) streamOperation(w http.ResponseWriter, r *http.Request, req *DatabaseOperationRequest, m *masker) {
+	connector, err := a.createConnector(&req.DatabaseConnectionRequest)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, ErrorCodeValidation, fmt.Sprintf("Failed to create connector: %v", err))
+		return
+	}
+	release, ok := a.acquireSlot(w, r, a.connectionKey(&req.DatabaseConnectionRequest))
+	if !ok {
+		return
+	}
+	defer release()
+
+	if err := a.connectWithin(r.Context(), connector, &req.DatabaseConnectionRequest); err != nil {
+		a.sendDatabaseError(w, "Connection failed", err)
+		return
+	}
+	defer connector.Close(r.Context())
+
+	op := a.operationPhase(r.Context(), &req.DatabaseConnectionRequest)
+	defer op.cancel()
+	ctx, cancel := context.WithCancel(op.ctx)
+	defer cancel()
+	stream := a.newRowStream(ctx, w, cancel)
+	a.finishStream(w, stream, op.err(a.RunOperation(ctx, connector, req, m.writer(req.maskSource(), stream))))
+}
+
+// finishStream ends a stream with its trailer, or answers with an error response when the read failed
+// before the stream started
+func (a *API) finishStream(w http.ResponseWriter, stream *rowStream, err error) {
+	if err != nil && !stream.started && !errors.Is(err, errStreamTruncated) {
+		a.sendDatabaseError(w, "Operation failed", err)
+		return
+	}
+	stream.finish(err)
+}
+
+// streamConfigs writes the configs of a read_all sent with format=jsonl as JSON Lines
+func (a *API) streamConfigs(ctx context.Context, w http.ResponseWriter, result interface{}) {
+	stream := a.newRowStream(ctx, w, func() {})
+	a.finishStream(w, stream, WriteResultRows(stream, result))
+}
+
+// checkConfigStreamFormat rejects unknown stream formats, and streaming allconfig operations other than read_all
+func checkConfigStreamFormat(spec *operationSpec, format string) error {
+	switch {
+	case format == "":
+		return nil
+	case format != StreamFormatJSONL:
+		return fmt.Errorf("format must be %s", StreamFormatJSONL)
+	case spec.Name != "read_all":
+		return fmt.Errorf("format %s is only supported for the read_all operation", StreamFormatJSONL)
+	}
+	return nil
+}
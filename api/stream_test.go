@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// flushRecorder counts the flushes of a response
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+// streamedQuery returns a connector whose query reads n rows of id and name, failing with rowErr before
+// the row at failAt when rowErr is set
+func streamedQuery(t *testing.T, n int, failAt int, rowErr error) *connectortest.MockDBConnector {
+	rows := sqlmock.NewRows([]string{"id", "name"})
+	for i := 0; i < n; i++ {
+		rows.AddRow(i, fmt.Sprintf("user-%d", i))
+	}
+	if rowErr != nil {
+		rows.RowError(failAt, rowErr)
+	}
+	conn := newServiceConnector("mysql")
+	conn.On("Query", mock.Anything, "SELECT id, name FROM users", []interface{}(nil)).
+		Return(newSQLRows(t, rows), nil).Once()
+	return conn
+}
+
+// newSQLRows returns rows read from a sqlmock database
+func newSQLRows(t *testing.T, rows *sqlmock.Rows) interface{} {
+	db, sqlMock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	sqlMock.ExpectQuery(".*").WillReturnRows(rows)
+	result, err := db.Query("SELECT")
+	require.NoError(t, err)
+	return result
+}
+
+// runStream runs a query of conn into a row stream, returning the response and its lines
+func runStream(t *testing.T, api *API, conn *connectortest.MockDBConnector) (*flushRecorder, []map[string]interface{}) {
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := api.newRowStream(ctx, rr, cancel)
+	req := &DatabaseOperationRequest{Operation: "query", Query: "SELECT id, name FROM users"}
+	req.Type = "mysql"
+	api.finishStream(rr, stream, api.RunOperation(ctx, conn, req, stream))
+	return rr, streamLines(t, rr.Body.Bytes())
+}
+
+// streamLines decodes each line of a JSON Lines body
+func streamLines(t *testing.T, body []byte) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text())
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestStreamRows(t *testing.T) {
+	api := NewAPI()
+	rr, lines := runStream(t, api, streamedQuery(t, 250, 0, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	require.Len(t, lines, 251, "a line per row and the trailer")
+	assert.Equal(t, map[string]interface{}{"id": float64(0), "name": "user-0"}, lines[0])
+	assert.Equal(t, "user-249", lines[249]["name"])
+	assert.Equal(t, map[string]interface{}{"_trailer": true, "success": true, "rows": float64(250), "truncated": false}, lines[250])
+	assert.Equal(t, 3, rr.flushes, "every 100 lines, then after the trailer")
+}
+
+func TestStreamTruncated(t *testing.T) {
+	api := NewAPI()
+	api.maxResultBytes = 100
+	_, lines := runStream(t, api, streamedQuery(t, 50, 0, nil))
+
+	trailer := lines[len(lines)-1]
+	assert.Equal(t, true, trailer["success"])
+	assert.Equal(t, true, trailer["truncated"])
+	assert.Equal(t, float64(len(lines)-1), trailer["rows"])
+	assert.Less(t, len(lines)-1, 50, "the rows stop at the limit")
+}
+
+func TestStreamFailsMidway(t *testing.T) {
+	// The status is already sent, so the trailer carries the error
+	rr, lines := runStream(t, NewAPI(), streamedQuery(t, 5, 2, errors.New("connection reset by peer")))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.Len(t, lines, 3)
+	trailer := lines[2]
+	assert.Equal(t, true, trailer["_trailer"])
+	assert.Equal(t, false, trailer["success"])
+	assert.Equal(t, float64(2), trailer["rows"])
+	assert.Equal(t, ErrorCodeDBError, trailer["error_code"])
+	assert.Contains(t, trailer["error"], "connection reset by peer")
+
+	// A read failing before its first row is answered with an error response
+	rr, _ = runStream(t, NewAPI(), streamedQuery(t, 5, 0, errors.New("connection reset by peer")))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `"success":false`)
+}
+
+func TestStreamAbandoned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	stream := NewAPI().newRowStream(ctx, rr, cancel)
+	require.NoError(t, stream.WriteRow(map[string]interface{}{"id": 1}))
+
+	// Once the client goes away the read stops at the next row
+	cancel()
+	assert.ErrorIs(t, stream.WriteRow(map[string]interface{}{"id": 2}), context.Canceled)
+	assert.Equal(t, 1, stream.rows)
+
+	// Rows are not scanned for a client that left before the first
+	api := NewAPI()
+	conn := streamedQuery(t, 250, 0, nil)
+	stream = api.newRowStream(ctx, rr, cancel)
+	req := &DatabaseOperationRequest{Operation: "query", Query: "SELECT id, name FROM users"}
+	req.Type = "mysql"
+	err := api.RunOperation(ctx, conn, req, stream)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, stream.rows)
+	status, code := classifyDatabaseError(err)
+	assert.Equal(t, StatusClientClosedRequest, status)
+	assert.Equal(t, ErrorCodeClientClosed, code)
+}
+
+func TestExecuteStreamed(t *testing.T) {
+	fakeDriverConnector = new(connectortest.MockDBConnector)
+	fakeDriverConnector.On("Connect", mock.Anything).Return(nil)
+	fakeDriverConnector.On("Close").Return(nil)
+	fakeDriverConnector.On("GetType").Return(fakeDriver)
+	fakeDriverConnector.On("Execute", mock.Anything, "find", mock.Anything).
+		Return([]map[string]interface{}{{"key": "user:1"}, {"key": "user:2"}}, nil)
+	handler := SetupRoutes(NewAPI())
+	execute := func(target string, body map[string]interface{}) *httptest.ResponseRecorder {
+		body["type"], body["host"], body["port"], body["database"] = fakeDriver, "kv.internal", 7000, "sessions"
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, target, bytes.NewReader(data)))
+		return rr
+	}
+
+	rr := execute("/v1/execute?format=jsonl", map[string]interface{}{"operation": "find", "params": map[string]interface{}{"collection": "sessions"}})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	lines := streamLines(t, rr.Body.Bytes())
+	require.Len(t, lines, 3)
+	assert.Equal(t, "user:2", lines[1]["key"])
+	assert.Equal(t, float64(2), lines[2]["rows"])
+	assert.NotEmpty(t, lines[2]["request_id"])
+
+	for _, tc := range []struct {
+		target  string
+		body    map[string]interface{}
+		message string
+	}{
+		{"/v1/execute?format=csv", map[string]interface{}{"operation": "find"}, "format must be jsonl"},
+		{"/v1/execute?format=jsonl", map[string]interface{}{"operation": "insertOne"}, "format jsonl is only supported for"},
+	} {
+		rr := execute(tc.target, tc.body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, tc.target)
+		assert.Contains(t, rr.Body.String(), tc.message)
+	}
+}
+
+func TestStreamConfigs(t *testing.T) {
+	read := lookupOperation(allConfigOperationSpecs, "read_all", "mysql")
+	assert.NoError(t, checkConfigStreamFormat(read, "jsonl"))
+	assert.NoError(t, checkConfigStreamFormat(read, ""))
+	assert.EqualError(t, checkConfigStreamFormat(read, "csv"), "format must be jsonl")
+	assert.EqualError(t, checkConfigStreamFormat(lookupOperation(allConfigOperationSpecs, "read", "mysql"), "jsonl"),
+		"format jsonl is only supported for the read_all operation")
+
+	rr := httptest.NewRecorder()
+	NewAPI().streamConfigs(context.Background(), rr, []map[string]interface{}{
+		{"config_key": "feature.a", "config_value": "on"},
+		{"config_key": "feature.b", "config_value": "off"},
+	})
+	lines := streamLines(t, rr.Body.Bytes())
+	require.Len(t, lines, 3)
+	assert.Equal(t, "feature.b", lines[1]["config_key"])
+	assert.Equal(t, map[string]interface{}{"_trailer": true, "success": true, "rows": float64(2), "truncated": false}, lines[2])
+
+	// No configs still end with the trailer
+	rr = httptest.NewRecorder()
+	NewAPI().streamConfigs(context.Background(), rr, []map[string]interface{}{})
+	assert.Equal(t, `{"_trailer":true,"success":true,"rows":0,"truncated":false}`+"\n", rr.Body.String())
+}
+
+func TestStreamWriterFlushes(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&buf, "{\"id\":%d}\n", i)
+	}
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	out := newStreamWriter(rr, 2)
+	_, err := out.Write(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 1, rr.flushes, "a write crossing several flush points flushes once")
+	out.Write([]byte("{\"id\":5}\n"))
+	assert.Equal(t, 2, rr.flushes)
+	assert.Equal(t, 6, bytes.Count(rr.Body.Bytes(), []byte{'\n'}))
+}
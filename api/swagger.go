@@ -1,26 +1,54 @@
 package api
 
 import (
+	"embed"
 	"encoding/json"
+	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
-// SwaggerHandler serves the Swagger documentation
-func (s *Server) SwaggerHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// swaggerUIFiles holds the swagger-ui-dist release named by swaggerui/VERSION, once fetch_swagger_ui.sh has
+// downloaded it
+//
+//go:embed swaggerui
+var swaggerUIFiles embed.FS
+
+// swaggerUIAssets are the files served under /docs/assets
+var swaggerUIAssets fs.FS = mustSub(swaggerUIFiles, "swaggerui")
+
+// mustSub returns the subtree of fsys at dir
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
 	}
+	return sub
+}
+
+// swaggerUIBase returns where the Swagger UI page loads swagger-ui from: /docs/assets when the release is
+// embedded, or else unpkg.com, for builds that did not fetch it
+func swaggerUIBase() string {
+	if _, err := fs.Stat(swaggerUIAssets, "swagger-ui-bundle.js"); err == nil {
+		return "/docs/assets"
+	}
+	version, _ := fs.ReadFile(swaggerUIAssets, "VERSION")
+	return "https://unpkg.com/swagger-ui-dist@" + strings.TrimSpace(string(version))
+}
 
-	// Serve Swagger UI HTML
-	swaggerHTML := `
+// swaggerHTML is the Swagger UI page, given the base URL of swagger-ui and the specification as JSON
+const swaggerHTML = `
 <!DOCTYPE html>
 <html>
 <head>
     <title>Database Connectors API Documentation</title>
-    <link rel="stylesheet" type="text/css" href="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui.css" />
+    <link rel="stylesheet" type="text/css" href="%[1]s/swagger-ui.css" />
     <style>
         html {
             box-sizing: border-box;
@@ -38,12 +66,12 @@ func (s *Server) SwaggerHandler(w http.ResponseWriter, r *http.Request) {
 </head>
 <body>
     <div id="swagger-ui"></div>
-    <script src="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui-bundle.js"></script>
-    <script src="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui-standalone-preset.js"></script>
+    <script src="%[1]s/swagger-ui-bundle.js"></script>
+    <script src="%[1]s/swagger-ui-standalone-preset.js"></script>
     <script>
         window.onload = function() {
             const ui = SwaggerUIBundle({
-                url: '/swagger.json',
+                spec: %[2]s,
                 dom_id: '#swagger-ui',
                 deepLinking: true,
                 presets: [
@@ -69,84 +97,127 @@ func (s *Server) SwaggerHandler(w http.ResponseWriter, r *http.Request) {
 </html>
 `
 
-	w.Header().Set("Content-Type", "text/html")
+// SwaggerHandler serves the Swagger documentation, with the specification the server generates inlined
+func (s *Server) SwaggerHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.api.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	// json.Marshal escapes <, > and &, so the specification cannot close the script element
+	spec, err := json.Marshal(s.requestSpec(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode specification: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(swaggerHTML))
+	fmt.Fprintf(w, swaggerHTML, swaggerUIBase(), spec)
+}
+
+// SwaggerAssetsHandler serves the embedded swagger-ui files, with the content type of their extension
+func (s *Server) SwaggerAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("path")
+	if info, err := fs.Stat(swaggerUIAssets, name); err != nil || info.IsDir() {
+		s.api.sendError(w, http.StatusNotFound, ErrorCodeNotFound, "Not found: "+r.URL.Path)
+		return
+	}
+	http.ServeFileFS(w, r, swaggerUIAssets, name)
+}
+
+// requestSpec returns the OpenAPI specification with its server at the URL r reached the server by, so that
+// "Try it out" sends requests back through the same reverse proxy
+func (s *Server) requestSpec(r *http.Request) map[string]interface{} {
+	spec := s.OpenAPISpec()
+	spec["servers"] = []interface{}{
+		map[string]interface{}{"url": requestBaseURL(r) + "/v1", "description": "This server"},
+	}
+	return spec
+}
+
+// requestBaseURL returns the scheme and host r was sent to, as the X-Forwarded-Proto, X-Forwarded-Host and
+// X-Forwarded-Port headers of a reverse proxy name them, or else as the server received it
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := forwardedHeader(r, "X-Forwarded-Proto"); proto != "" {
+		scheme = strings.ToLower(proto)
+	}
+	host := r.Host
+	if forwarded := forwardedHeader(r, "X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	if port := forwardedHeader(r, "X-Forwarded-Port"); port != "" {
+		hostname := host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			hostname = h
+		}
+		host = net.JoinHostPort(strings.Trim(hostname, "[]"), port)
+	}
+	return scheme + "://" + host
+}
+
+// forwardedHeader returns the first value of a proxy header, which a chain of proxies appends to
+func forwardedHeader(r *http.Request, name string) string {
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
 }
 
-// SwaggerJSONHandler serves the Swagger JSON specification
+// SwaggerJSONHandler serves the OpenAPI specification generated from the routes as JSON
 func (s *Server) SwaggerJSONHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !s.api.allowMethod(w, r, http.MethodGet) {
 		return
 	}
 
-	// Try to read swagger.json from docs directory
-	swaggerPath := filepath.Join("docs", "swagger.json")
-	swaggerData, err := ioutil.ReadFile(swaggerPath)
+	data, err := json.MarshalIndent(s.requestSpec(r), "", "  ")
 	if err != nil {
-		// If file doesn't exist, return a basic spec
-		basicSpec := map[string]interface{}{
-			"openapi": "3.0.3",
-			"info": map[string]interface{}{
-				"title":   "Database Connectors API",
-				"version": "1.0.0",
-			},
-			"paths": map[string]interface{}{
-				"/health": map[string]interface{}{
-					"get": map[string]interface{}{
-						"summary": "Health check",
-						"responses": map[string]interface{}{
-							"200": map[string]interface{}{
-								"description": "Service is healthy",
-							},
-						},
-					},
-				},
-			},
-		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(basicSpec)
+		http.Error(w, fmt.Sprintf("Failed to encode specification: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write(swaggerData)
+	w.Write(data)
 }
 
-// SwaggerYAMLHandler serves the Swagger YAML specification
+// SwaggerYAMLHandler serves the OpenAPI specification generated from the routes as YAML
 func (s *Server) SwaggerYAMLHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !s.api.allowMethod(w, r, http.MethodGet) {
 		return
 	}
 
-	// Try to read swagger.yaml from docs directory
-	swaggerPath := filepath.Join("docs", "swagger.yaml")
-	swaggerData, err := ioutil.ReadFile(swaggerPath)
+	data, err := yaml.Marshal(s.requestSpec(r))
 	if err != nil {
-		http.Error(w, "Swagger YAML file not found", http.StatusNotFound)
+		http.Error(w, fmt.Sprintf("Failed to encode specification: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/yaml")
 	w.WriteHeader(http.StatusOK)
-	w.Write(swaggerData)
+	w.Write(data)
 }
 
 // DocumentationIndexHandler serves the documentation landing page
 func (s *Server) DocumentationIndexHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !s.api.allowMethod(w, r, http.MethodGet) {
 		return
 	}
 
 	// Only serve on root path
 	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+		s.api.sendError(w, http.StatusNotFound, ErrorCodeNotFound, "Not found: "+r.URL.Path)
+		return
+	}
+
+	// API clients get the endpoints as JSON rather than a page they cannot decode
+	if acceptsJSON(r) {
+		s.api.sendSuccess(w, map[string]interface{}{
+			"endpoints":     s.router().Endpoints(),
+			"documentation": "/docs",
+			"openapi":       "/swagger.json",
+		}, "Database Connectors API")
 		return
 	}
 
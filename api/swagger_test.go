@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withSwaggerUIAssets serves assets under /docs/assets for the rest of the test
+func withSwaggerUIAssets(t *testing.T, assets fstest.MapFS) {
+	embedded := swaggerUIAssets
+	swaggerUIAssets = assets
+	t.Cleanup(func() { swaggerUIAssets = embedded })
+}
+
+func TestSwaggerUIAssets(t *testing.T) {
+	withSwaggerUIAssets(t, fstest.MapFS{
+		"VERSION":              {Data: []byte("4.15.5\n")},
+		"swagger-ui.css":       {Data: []byte(".swagger-ui{}")},
+		"swagger-ui-bundle.js": {Data: []byte("var SwaggerUIBundle;")},
+		"favicon-32x32.png":    {Data: []byte("\x89PNG\r\n\x1a\n")},
+	})
+	handler := SetupRoutes(NewAPI())
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	for name, contentType := range map[string]string{
+		"swagger-ui.css":       "text/css; charset=utf-8",
+		"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+		"favicon-32x32.png":    "image/png",
+	} {
+		rr := get("/docs/assets/" + name)
+		require.Equal(t, http.StatusOK, rr.Code, name)
+		assert.Equal(t, contentType, rr.Header().Get("Content-Type"), name)
+	}
+	assert.Equal(t, ".swagger-ui{}", get("/docs/assets/swagger-ui.css").Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/docs/assets/swagger-ui-standalone-preset.js").Code)
+	assert.Equal(t, http.StatusNotFound, get("/docs/assets/").Code)
+
+	page := get("/docs")
+	require.Equal(t, http.StatusOK, page.Code)
+	assert.Equal(t, "text/html; charset=utf-8", page.Header().Get("Content-Type"))
+	assert.Contains(t, page.Body.String(), `<script src="/docs/assets/swagger-ui-bundle.js">`)
+	assert.NotContains(t, page.Body.String(), "unpkg.com")
+	assert.NotContains(t, page.Body.String(), "url: '/swagger.json'")
+	assert.Contains(t, page.Body.String(), `"openapi":"3.0.3"`)
+
+	// Builds that did not fetch the release load the pinned one from unpkg.com
+	withSwaggerUIAssets(t, fstest.MapFS{"VERSION": {Data: []byte("4.15.5\n")}})
+	assert.Contains(t, get("/docs").Body.String(), `<script src="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui-bundle.js">`)
+}
+
+func TestSpecServerURL(t *testing.T) {
+	handler := SetupRoutes(NewAPI())
+	serverURL := func(headers map[string]string) string {
+		req := httptest.NewRequest(http.MethodGet, "/swagger.json", nil)
+		req.Host = "10.0.0.5:8080"
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var spec struct {
+			Servers []struct {
+				URL string `json:"url"`
+			} `json:"servers"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+		require.Len(t, spec.Servers, 1)
+		return spec.Servers[0].URL
+	}
+
+	assert.Equal(t, "http://10.0.0.5:8080/v1", serverURL(nil))
+	assert.Equal(t, "https://api.example.com/v1", serverURL(map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "api.example.com",
+	}))
+	// Proxies in a chain append their values; the first is the one the client used
+	assert.Equal(t, "https://api.example.com:8443/v1", serverURL(map[string]string{
+		"X-Forwarded-Proto": "https, http",
+		"X-Forwarded-Host":  "api.example.com, gateway.internal",
+		"X-Forwarded-Port":  "8443",
+	}))
+	assert.Equal(t, "http://10.0.0.5:9000/v1", serverURL(map[string]string{"X-Forwarded-Port": "9000"}))
+
+	// The page inlines the same specification
+	req := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "api.example.com")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Contains(t, rr.Body.String(), `"url":"https://api.example.com/v1"`)
+}
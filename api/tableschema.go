@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+
+	"db-connectors/connectors"
+)
+
+// configSchemaKey carries the quoted schema the allconfig statements of a request qualify their tables with
+type configSchemaKey struct{}
+
+// configSchema returns the schema the allconfig tables of a request of dbType naming schema live in: schema,
+// or the server's allconfig schema when it names none. MongoDB has no schemas, so it is left as named.
+func (a *API) configSchema(dbType, schema string) string {
+	if schema == "" && isSQLType(dbType) {
+		return a.allConfigSchema
+	}
+	return schema
+}
+
+// withConfigSchema returns a context under which the allconfig statements run on connector qualify their
+// tables with schema: a PostgreSQL schema, or a MySQL database. An empty schema leaves them unqualified, to
+// the search_path or the connected database.
+func withConfigSchema(ctx context.Context, connector connectors.DBConnector, schema string) context.Context {
+	if schema == "" || !isSQLType(connector.GetType()) {
+		return ctx
+	}
+	return context.WithValue(ctx, configSchemaKey{}, sqlDialect(connector).QuoteIdent(schema))
+}
+
+// quotedConfigSchema returns the quoted schema of ctx, or "" when its statements are unqualified
+func quotedConfigSchema(ctx context.Context) string {
+	schema, _ := ctx.Value(configSchemaKey{}).(string)
+	return schema
+}
+
+// sqlTable returns table as the allconfig statements of ctx name it, qualified with the schema of ctx. The
+// table itself stays unquoted, so that it names the same table with or without a schema.
+func sqlTable(ctx context.Context, table string) string {
+	if schema := quotedConfigSchema(ctx); schema != "" {
+		return schema + "." + table
+	}
+	return table
+}
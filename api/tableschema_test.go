@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSchemaCreateTable(t *testing.T) {
+	api := NewAPI()
+	api.allConfigSchema = "appconfig"
+	conn := newServiceConnector("postgresql")
+	conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": `CREATE SCHEMA IF NOT EXISTS "appconfig"`}).
+		Return(map[string]interface{}{"rows_affected": 0}, nil).Once()
+	conn.On("Query", mock.Anything, queryContaining("information_schema.tables"), []interface{}{"appconfig", "allconfig"}).
+		Return(newMockRows(t, []string{"table_schema", "table_name", "table_type"}), nil).Once()
+	conn.On("Execute", mock.Anything, "execute", mock.MatchedBy(func(params map[string]interface{}) bool {
+		ddl, _ := params["query"].(string)
+		return strings.HasPrefix(ddl, `CREATE TABLE "appconfig".allconfig (`)
+	})).Return(map[string]interface{}{"rows_affected": 0}, nil).Once()
+
+	// The server's schema stands in for the one the request leaves out
+	req := &AllConfigOperationRequest{Operation: "create_table"}
+	req.TableName = "allconfig"
+	_, err := api.executeAllConfigOperation(context.Background(), conn, req)
+	require.NoError(t, err)
+	assert.Equal(t, "appconfig", req.Schema)
+	conn.AssertExpectations(t)
+
+	// Index names stay unqualified, the tables they are on do not
+	ddl := api.getCreateTableSQL(withConfigSchema(context.Background(), conn, "appconfig"), "postgresql", "allconfig")
+	assert.Contains(t, ddl, `CREATE TABLE "appconfig".allconfig_approval_requests (`)
+	assert.Contains(t, ddl, `CREATE INDEX idx_allconfig_status ON "appconfig".allconfig (status);`)
+	assert.Contains(t, ddl, `CREATE INDEX idx_allconfig_approval_status ON "appconfig".allconfig_approval_requests (status);`)
+}
+
+func TestConfigSchemaQualifiesStatements(t *testing.T) {
+	t.Run("mysql database", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, "SELECT config_key, config_value, description, tags, created_at, updated_at, maker_id, checker_id, approved_at, expires_at FROM `appconfig`.allconfig WHERE config_key = ? AND status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP())", []interface{}{"feature.flag"}).
+			Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature.flag", "on"}), nil).Once()
+
+		req := &AllConfigOperationRequest{Operation: "read", Key: "feature.flag"}
+		req.TableName = "allconfig"
+		req.Schema = "appconfig"
+		req.LegacyMode = boolPtr(false)
+		_, err := NewAPI().executeAllConfigOperation(context.Background(), conn, req)
+		require.NoError(t, err)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("postgresql existence checks", func(t *testing.T) {
+		conn := newServiceConnector("postgresql")
+		// Looked up by drop_table, then by the estimate of its DROP, in the schema and by the bare table name
+		for i := 0; i < 2; i++ {
+			conn.On("Query", mock.Anything, queryContaining("information_schema.tables"), []interface{}{"appconfig", "allconfig"}).
+				Return(newMockRows(t, []string{"table_schema", "table_name", "table_type"}, []driver.Value{"appconfig", "allconfig", "BASE TABLE"}), nil).Once()
+			conn.On("Query", mock.Anything, `SELECT COUNT(*) FROM "appconfig".allconfig`, []interface{}(nil)).Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{3}), nil).Once()
+		}
+
+		req := &AllConfigOperationRequest{Operation: "drop_table", Confirm: "allconfig", DryRun: true}
+		req.TableName = "allconfig"
+		req.Type = "postgresql"
+		req.Schema = "appconfig"
+		req.LegacyMode = boolPtr(false)
+		result, err := NewAPI().executeAllConfigOperation(context.Background(), conn, req)
+		require.NoError(t, err)
+		dryRun := result.(*AllConfigDryRun)
+		require.Len(t, dryRun.Writes, 1)
+		assert.Equal(t, `DROP TABLE IF EXISTS "appconfig".allconfig`, dryRun.Writes[0].Params["query"])
+		assert.Equal(t, int64(3), dryRun.Affected)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("unqualified without a schema", func(t *testing.T) {
+		assert.Equal(t, "allconfig", sqlTable(context.Background(), "allconfig"))
+		assert.Equal(t, "allconfig", sqlTable(withConfigSchema(context.Background(), newServiceConnector("mongodb"), "appconfig"), "allconfig"))
+	})
+}
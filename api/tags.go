@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"db-connectors/connectors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TagMatch selects configs by their tags in the filter operation. Both lists may be given, in which case
+// configs must match both.
+type TagMatch struct {
+	Any []string // Configs carrying at least one of these tags
+	All []string // Configs carrying every one of these tags
+}
+
+// empty reports whether the match selects configs by no tag
+func (m TagMatch) empty() bool {
+	return len(m.Any) == 0 && len(m.All) == 0
+}
+
+// tagMatchOf returns the tag match of a filter request
+func tagMatchOf(req *AllConfigOperationRequest) TagMatch {
+	return TagMatch{Any: req.TagsAny, All: req.TagsAll}
+}
+
+// checkTags returns a validation error naming the field when one of its tags is empty or starts or ends
+// with whitespace
+func checkTags(field string, tags []string) error {
+	for _, tag := range tags {
+		if tag == "" || strings.TrimSpace(tag) != tag {
+			return &apiError{
+				Status:  http.StatusBadRequest,
+				Code:    ErrorCodeValidation,
+				Message: fmt.Sprintf("invalid tag %q in %s: tags must not be empty or start or end with whitespace", tag, field),
+				Details: map[string]interface{}{"field": field, "tag": tag},
+			}
+		}
+	}
+	return nil
+}
+
+// checkRequestTags checks the tags written or matched by an /allconfig-operation request
+func checkRequestTags(req *AllConfigOperationRequest) error {
+	if err := checkTags("tags", req.Tags); err != nil {
+		return err
+	}
+	if err := checkTags("tags_any", req.TagsAny); err != nil {
+		return err
+	}
+	if err := checkTags("tags_all", req.TagsAll); err != nil {
+		return err
+	}
+	for i, item := range req.ConfigItems {
+		if err := checkTags(fmt.Sprintf("config_items[%d].tags", i), item.Tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagsArg returns tags as the JSON bound to a tags column, or nil (NULL) when none are given. Updates
+// keep the stored tags when given NULL, so leaving tags out of a request leaves them as they are.
+func tagsArg(tags []string) interface{} {
+	if tags == nil {
+		return nil
+	}
+	encoded, _ := json.Marshal(tags)
+	return string(encoded)
+}
+
+// tagsOf returns the tags of a config or approval request read from the database: JSON text from a SQL
+// column or an array from a MongoDB document
+func tagsOf(v interface{}) []string {
+	var values []interface{}
+	switch v := v.(type) {
+	case []string:
+		return v
+	case string:
+		var tags []string
+		if json.Unmarshal([]byte(v), &tags) != nil {
+			return nil
+		}
+		return tags
+	case primitive.A:
+		values = v
+	case []interface{}:
+		values = v
+	default:
+		return nil
+	}
+	tags := make([]string, 0, len(values))
+	for _, value := range values {
+		if tag, ok := value.(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// configRows returns the rows of a config or approval request query, with their tags decoded from JSON
+func (a *API) configRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	results, err := a.rowsToMap(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range results {
+		if tags, ok := row["tags"]; ok && tags != nil {
+			row["tags"] = tagsOf(tags)
+		}
+	}
+	return results, nil
+}
+
+// matchedRows reads the rows of a lookup by key or request ID like configRows, returning
+// connectors.ErrNotFound when nothing matched
+func (a *API) matchedRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	results, err := a.configRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, connectors.ErrNotFound
+	}
+	return results, nil
+}
+
+// sqlTagCondition returns the WHERE condition matching m with its args, numbering PostgreSQL placeholders
+// from next. A config matches any of several tags when its tags contain one of them, and all of them when
+// they contain the array of them.
+func sqlTagCondition(dbType string, m TagMatch, next int) (string, []interface{}) {
+	var args []interface{}
+	contains := func(tags []string) string {
+		args = append(args, tagsArg(tags))
+		if dbType == "postgresql" {
+			return fmt.Sprintf("tags @> $%d::jsonb", next+len(args)-1)
+		}
+		return "JSON_CONTAINS(tags, ?)"
+	}
+
+	var conditions []string
+	if len(m.Any) > 0 {
+		anyOf := make([]string, len(m.Any))
+		for i, tag := range m.Any {
+			anyOf[i] = contains([]string{tag})
+		}
+		conditions = append(conditions, "("+strings.Join(anyOf, " OR ")+")")
+	}
+	if len(m.All) > 0 {
+		conditions = append(conditions, contains(m.All))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// mongoTagFilter returns the filter on the tags array matching m
+func mongoTagFilter(m TagMatch) map[string]interface{} {
+	filter := map[string]interface{}{}
+	if len(m.Any) > 0 {
+		filter["$in"] = m.Any
+	}
+	if len(m.All) > 0 {
+		filter["$all"] = m.All
+	}
+	return filter
+}
+
+// configColumnUpgrade is a column added to the allconfig and approval tables after their first release,
+// which create_table adds to tables created before it
+type configColumnUpgrade struct {
+	Column string
+	Types  map[string]string // Column type by database type
+}
+
+// configColumnUpgrades are the columns create_table adds to existing tables, in the order they were introduced
+var configColumnUpgrades = []configColumnUpgrade{
+	{Column: "tags", Types: map[string]string{"mysql": "JSON", "postgresql": "JSONB"}},
+	{Column: "expires_at", Types: map[string]string{"mysql": "DATETIME NULL", "postgresql": "TIMESTAMP"}},
+}
+
+// upgradeAllConfigTables adds the columns missing from existing allconfig and approval tables, reporting
+// the columns it added to each table
+func (a *API) upgradeAllConfigTables(ctx context.Context, connector connectors.DBConnector, schema, tableName string) (interface{}, error) {
+	added := map[string][]string{}
+	for _, table := range []string{tableName, a.approvalTable(tableName)} {
+		exists, err := a.checkTableExists(ctx, connector, schema, table)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		structure, err := a.getTableStructure(ctx, connector, schema, table)
+		if err != nil {
+			return nil, err
+		}
+		columns := map[string]bool{}
+		for _, column := range structure.([]ColumnInfo) {
+			columns[strings.ToLower(column.Name)] = true
+		}
+
+		added[table] = []string{}
+		for _, upgrade := range configColumnUpgrades {
+			if columns[upgrade.Column] {
+				continue
+			}
+			query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", sqlTable(ctx, table), upgrade.Column, upgrade.Types[connector.GetType()])
+			if _, err := connector.Execute(ctx, "execute", map[string]interface{}{"query": query}); err != nil {
+				return nil, fmt.Errorf("failed to add column %s to %s: %w", upgrade.Column, table, err)
+			}
+			added[table] = append(added[table], upgrade.Column)
+		}
+	}
+	return map[string]interface{}{"table_existed": true, "columns_added": added}, nil
+}
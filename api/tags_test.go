@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+
+	"db-connectors/allconfig"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// executedArgs returns the args of the execute call whose query contains fragment
+func executedArgs(t *testing.T, conn *connectortest.MockDBConnector, fragment string) []interface{} {
+	for _, call := range conn.Calls {
+		if call.Method != "Execute" || call.Arguments.String(1) != "execute" {
+			continue
+		}
+		params := call.Arguments.Get(2).(map[string]interface{})
+		if strings.Contains(params["query"].(string), fragment) {
+			return params["args"].([]interface{})
+		}
+	}
+	t.Fatalf("no statement containing %q was executed", fragment)
+	return nil
+}
+
+func TestSQLTagCondition(t *testing.T) {
+	match := TagMatch{Any: []string{"pii", "team:payments"}, All: []string{"prod", "critical"}}
+
+	condition, args := sqlTagCondition("mysql", match, 1)
+	assert.Equal(t, "(JSON_CONTAINS(tags, ?) OR JSON_CONTAINS(tags, ?)) AND JSON_CONTAINS(tags, ?)", condition)
+	assert.Equal(t, []interface{}{`["pii"]`, `["team:payments"]`, `["prod","critical"]`}, args)
+
+	// PostgreSQL placeholders follow those of the rest of the WHERE clause
+	condition, args = sqlTagCondition("postgresql", match, 3)
+	assert.Equal(t, "(tags @> $3::jsonb OR tags @> $4::jsonb) AND tags @> $5::jsonb", condition)
+	assert.Len(t, args, 3)
+
+	condition, _ = sqlTagCondition("postgresql", TagMatch{All: []string{"prod"}}, 1)
+	assert.Equal(t, "tags @> $1::jsonb", condition)
+
+	assert.Equal(t, map[string]interface{}{"$in": []string{"pii"}, "$all": []string{"prod"}},
+		mongoTagFilter(TagMatch{Any: []string{"pii"}, All: []string{"prod"}}))
+}
+
+func TestFilterByTags(t *testing.T) {
+	ctx := context.Background()
+	api := NewAPI()
+
+	t.Run("postgresql contains all", func(t *testing.T) {
+		conn := newServiceConnector("postgresql")
+		conn.On("Query", mock.Anything, queryContaining(`WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')) AND "maker_id" = $1 AND tags @> $2::jsonb ORDER BY config_key`),
+			[]interface{}{"alice", `["pii","prod"]`}).
+			Return(newMockRows(t, []string{"config_key", "tags"}, []driver.Value{"feature.flag", []byte(`["pii", "prod", "team:payments"]`)}), nil).Once()
+
+		result, err := api.findConfigs(ctx, conn, "allconfig", configQuery{ApprovedOnly: true, Filter: map[string]interface{}{"maker_id": "alice"}, Tags: TagMatch{All: []string{"pii", "prod"}}}, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pii", "prod", "team:payments"}, result.([]map[string]interface{})[0]["tags"])
+	})
+
+	t.Run("mysql contains any", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("WHERE status = 'approved' AND (expires_at IS NULL OR expires_at > UTC_TIMESTAMP()) AND (JSON_CONTAINS(tags, ?) OR JSON_CONTAINS(tags, ?))"),
+			[]interface{}{`["pii"]`, `["prod"]`}).
+			Return(newMockRows(t, []string{"config_key", "tags"}, []driver.Value{"feature.flag", `["prod"]`}), nil).Once()
+
+		_, err := api.findConfigs(ctx, conn, "allconfig", configQuery{ApprovedOnly: true, Tags: TagMatch{Any: []string{"pii", "prod"}}}, 0, 0)
+		require.NoError(t, err)
+	})
+
+	t.Run("mongodb", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "find", mock.MatchedBy(func(params map[string]interface{}) bool {
+			filter := params["filter"].(map[string]interface{})
+			return assert.ObjectsAreEqual(map[string]interface{}{"$in": []string{"pii"}, "$all": []string{"prod", "critical"}}, filter["tags"]) &&
+				filter["status"] == "approved"
+		})).Return([]map[string]interface{}{}, nil).Once()
+
+		_, err := api.findConfigs(ctx, conn, "allconfig", configQuery{ApprovedOnly: true, Tags: TagMatch{Any: []string{"pii"}, All: []string{"prod", "critical"}}}, 0, 0)
+		require.NoError(t, err)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("tags alone make a filter request", func(t *testing.T) {
+		_, err := api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "filter", TagsAll: []string{"prod"}}, "mysql")
+		assert.NoError(t, err)
+		_, err = api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "filter"}, "mysql")
+		assert.Error(t, err)
+	})
+}
+
+func TestTagsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	api := NewAPI()
+	written := func(dbType string) *connectortest.MockDBConnector {
+		conn := newServiceConnector(dbType)
+		conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(map[string]interface{}{"rows_affected": 1}, nil)
+		expectConfigTimestamps(t, conn, 1)
+		return conn
+	}
+
+	t.Run("create and update", func(t *testing.T) {
+		conn := written("mysql")
+		_, err := api.createConfigDirect(ctx, conn, "allconfig", "feature.flag", "on", "", []string{"pii", "prod"}, nil, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"feature.flag", "on", "", `["pii","prod"]`, "alice"}, executedArgs(t, conn, "INSERT INTO allconfig"))
+
+		// An update without tags keeps the stored ones, and an empty list clears them
+		conn = written("mysql")
+		_, err = api.updateConfigDirect(ctx, conn, "allconfig", "feature.flag", "off", "", nil, nil, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"off", "", "alice", nil, "feature.flag"}, executedArgs(t, conn, "tags = COALESCE(?, tags)"))
+
+		conn = newServiceConnector("postgresql")
+		conn.On("Query", mock.Anything, queryContaining("tags = COALESCE($4, tags)"), []interface{}{"off", "", "alice", "[]", "feature.flag"}).
+			Return(newMockRows(t, []string{"created_at", "updated_at", "approved_at"}, []driver.Value{writtenAt, writtenAt, writtenAt}), nil).Once()
+		_, err = api.updateConfigDirect(ctx, conn, "allconfig", "feature.flag", "off", "", []string{}, nil, "alice")
+		require.NoError(t, err)
+	})
+
+	t.Run("submit", func(t *testing.T) {
+		conn := newServiceConnector("postgresql")
+		conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(map[string]interface{}{"rows_affected": 1}, nil)
+		_, err := api.submitConfigForApproval(ctx, conn, "req-1", allconfig.SubmitRequest{
+			Table: "allconfig", Operation: allconfig.OperationCreate, Key: "feature.flag", Value: "on", Tags: []string{"pii"}, MakerID: "bob",
+		})
+		require.NoError(t, err)
+		args := executedArgs(t, conn, "INSERT INTO allconfig_approval_requests")
+		assert.Equal(t, `["pii"]`, args[len(args)-1])
+	})
+
+	t.Run("mongodb", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "insert", mock.MatchedBy(func(params map[string]interface{}) bool {
+			return assert.ObjectsAreEqual([]string{"pii"}, params["document"].(map[string]interface{})["tags"])
+		})).Return(map[string]interface{}{"inserted_id": "1"}, nil).Once()
+		conn.On("Execute", mock.Anything, "update", mock.MatchedBy(func(params map[string]interface{}) bool {
+			_, setsTags := params["update"].(map[string]interface{})["$set"].(map[string]interface{})["tags"]
+			return !setsTags
+		})).Return(map[string]interface{}{"matched_count": int64(1)}, nil).Once()
+		conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(map[string]interface{}{}, nil)
+
+		_, err := api.createConfigDirect(ctx, conn, "allconfig", "feature.flag", "on", "", []string{"pii"}, nil, "alice")
+		require.NoError(t, err)
+		_, err = api.updateConfigDirect(ctx, conn, "allconfig", "feature.flag", "off", "", nil, nil, "alice")
+		require.NoError(t, err)
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("reads decode tags", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("description, tags, "), mock.Anything).
+			Return(newMockRows(t, []string{"config_key", "tags"},
+				[]driver.Value{"tagged", []byte(`["pii","prod"]`)},
+				[]driver.Value{"untagged", nil},
+			), nil).Once()
+
+		result, err := api.readApprovedConfig(ctx, conn, "allconfig", "tagged")
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{
+			{"config_key": "tagged", "tags": []string{"pii", "prod"}},
+			{"config_key": "untagged", "tags": nil},
+		}, result)
+
+		assert.Equal(t, []string{"pii"}, tagsOf(primitive.A{"pii"}))
+		assert.Nil(t, tagsOf("not json"))
+	})
+}
+
+func TestCheckRequestTags(t *testing.T) {
+	api := NewAPI()
+	for _, req := range []*AllConfigOperationRequest{
+		{Operation: "direct_create", Key: "k", Tags: []string{"pii", ""}},
+		{Operation: "filter", TagsAny: []string{" pii"}},
+		{Operation: "create_batch", ConfigItems: []ConfigItem{{Key: "a"}, {Key: "b", Tags: []string{"prod "}}}},
+	} {
+		_, err := api.checkAllConfigRequest(req, "mysql")
+		var apiErr *apiError
+		require.ErrorAs(t, err, &apiErr, req.Operation)
+		assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+		assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	}
+
+	rr := serveConfigs(newConfigsHandler(newProfileConnector("mysql")), http.MethodPut, "/v1/configs/feature.flag",
+		ConfigWriteRequest{Value: "on", Tags: []string{""}}, map[string]string{UserIDHeader: "alice", UserRoleHeader: AdminRole})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"error_code":"VALIDATION_ERROR"`)
+}
+
+func TestCreateTableTags(t *testing.T) {
+	ctx := context.Background()
+	api := NewAPI()
+
+	assert.Contains(t, api.getCreateTableSQL(context.Background(), "mysql", "allconfig"), "tags JSON,")
+	assert.Contains(t, api.getCreateTableSQL(context.Background(), "postgresql", "allconfig"), "CREATE INDEX idx_allconfig_tags ON allconfig USING GIN (tags);")
+	assert.Contains(t, api.getCreateTableSQL(context.Background(), "mongodb", "allconfig"), `db.allconfig.createIndex({"tags": 1});`)
+
+	t.Run("existing tables gain the columns they lack", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("information_schema.tables"), mock.Anything).
+			Return(newMockRows(t, []string{"table_schema", "table_name", "table_type"}, []driver.Value{"app", "allconfig", "BASE TABLE"}), nil).Once()
+		conn.On("Query", mock.Anything, queryContaining("information_schema.tables"), mock.Anything).
+			Return(newMockRows(t, []string{"table_schema", "table_name", "table_type"}, []driver.Value{"app", "allconfig", "BASE TABLE"}), nil).Once()
+		conn.On("Query", mock.Anything, queryContaining("information_schema.columns"), []interface{}{"app", "allconfig"}).
+			Return(newMockRows(t, []string{"column_name"}, []driver.Value{"config_key"}, []driver.Value{"description"}, []driver.Value{"expires_at"}), nil).Once()
+		conn.On("Query", mock.Anything, queryContaining("information_schema.tables"), mock.Anything).
+			Return(newMockRows(t, []string{"table_schema", "table_name", "table_type"}, []driver.Value{"app", "allconfig_approval_requests", "BASE TABLE"}), nil).Once()
+		conn.On("Query", mock.Anything, queryContaining("information_schema.columns"), []interface{}{"app", "allconfig_approval_requests"}).
+			Return(newMockRows(t, []string{"column_name"}, []driver.Value{"request_id"}, []driver.Value{"tags"}), nil).Once()
+		conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": "ALTER TABLE allconfig ADD COLUMN tags JSON"}).
+			Return(map[string]interface{}{"rows_affected": 0}, nil).Once()
+		conn.On("Execute", mock.Anything, "execute", map[string]interface{}{"query": "ALTER TABLE allconfig_approval_requests ADD COLUMN expires_at DATETIME NULL"}).
+			Return(map[string]interface{}{"rows_affected": 0}, nil).Once()
+
+		result, err := api.createAllConfigTable(ctx, conn, "app", "allconfig")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"table_existed": true,
+			"columns_added": map[string][]string{"allconfig": {"tags"}, "allconfig_approval_requests": {"expires_at"}},
+		}, result)
+		conn.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// TenantHeader names the tenant of a request when tenants are configured
+const TenantHeader = "X-Tenant-ID"
+
+// Tenant is a tenant whose configs live in allconfig tables of its own, named by its prefix
+type Tenant struct {
+	ID          string
+	TablePrefix string   // Prepended to the server's allconfig table to name the tenant's tables
+	Profile     string   // Connection profile the tenant's config resources use; empty allows any
+	APIKeys     []string // X-API-Key values that identify the tenant without the X-Tenant-ID header
+}
+
+// tableName returns the allconfig table of the tenant; its approval table follows from the approval suffix
+func (t *Tenant) tableName(allConfigTable string) string {
+	return t.TablePrefix + allConfigTable
+}
+
+// tenantContextKey stores the tenant of a request in its context
+type tenantContextKey struct{}
+
+// withTenant returns ctx carrying tenant, which may be nil
+func withTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// tenantFrom returns the tenant stored in ctx by withTenant, or nil
+func tenantFrom(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantContextKey{}).(*Tenant)
+	return tenant
+}
+
+// forbiddenTenant is the 403 answering a request reaching beyond its tenant
+func forbiddenTenant(tenantID, message string) error {
+	return &apiError{
+		Status:  http.StatusForbidden,
+		Code:    ErrorCodeForbidden,
+		Message: message,
+		Details: map[string]interface{}{"tenant": tenantID},
+	}
+}
+
+// resolveTenant returns the tenant of r, named by the X-Tenant-ID header or else identified by its
+// X-API-Key, or nil when no tenants are configured. Once they are, a request naming no tenant is forbidden,
+// since its table_name could reach any tenant's tables, as are an unknown tenant and an API key of one
+// tenant used for another.
+func (a *API) resolveTenant(r *http.Request) (*Tenant, error) {
+	if len(a.tenants) == 0 {
+		return nil, nil
+	}
+	var keyTenant *Tenant
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+		for _, tenant := range a.tenants {
+			if slices.Contains(tenant.APIKeys, apiKey) {
+				keyTenant = tenant
+				break
+			}
+		}
+	}
+
+	id := r.Header.Get(TenantHeader)
+	if id == "" {
+		if keyTenant == nil {
+			return nil, forbiddenTenant("", fmt.Sprintf("a tenant is required: send the %s header or a tenant's API key", TenantHeader))
+		}
+		return keyTenant, nil
+	}
+	tenant, ok := a.tenants[id]
+	if !ok {
+		return nil, forbiddenTenant(id, fmt.Sprintf("unknown tenant %q", id))
+	}
+	if keyTenant != nil && keyTenant != tenant {
+		return nil, forbiddenTenant(id, fmt.Sprintf("the API key belongs to tenant %s, not %s", keyTenant.ID, id))
+	}
+	return tenant, nil
+}
+
+// tenantTable returns the allconfig table of a request naming table: the tenant's table whatever the request
+// names, or without tenants the table named, which defaults to the server's
+func (a *API) tenantTable(tenant *Tenant, table string) string {
+	if tenant == nil {
+		return a.tableName(table)
+	}
+	return tenant.tableName(a.allConfigTable)
+}
+
+// tenantProfile returns the connection profile of a tenant's request to the config resources: the
+// tenant's own profile, which a request naming another profile may not leave
+func (a *API) tenantProfile(r *http.Request, tenant *Tenant) (*profile, error) {
+	if tenant == nil || tenant.Profile == "" {
+		return a.resolveProfile(r)
+	}
+	name := r.URL.Query().Get("profile")
+	if name == "" {
+		name = r.Header.Get(ProfileHeader)
+	}
+	if name != "" && name != tenant.Profile {
+		return nil, forbiddenTenant(tenant.ID, fmt.Sprintf("tenant %s may not use connection profile %s", tenant.ID, name))
+	}
+	p, ok := a.lookupProfile(tenant.Profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown connection profile: %s", tenant.Profile)
+	}
+	return p, nil
+}
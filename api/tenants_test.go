@@ -0,0 +1,112 @@
+package api
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"db-connectors/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantAPI returns an API serving the tenants acme, limited to the primary profile, and globex
+func tenantAPI() *API {
+	server := NewServer(config.ServerConfig{}, WithTenants(
+		Tenant{ID: "acme", TablePrefix: "acme_", Profile: "primary", APIKeys: []string{"acme-key"}},
+		Tenant{ID: "globex", TablePrefix: "globex_", APIKeys: []string{"globex-key"}},
+	))
+	return server.API()
+}
+
+func TestResolveTenant(t *testing.T) {
+	api := tenantAPI()
+	resolve := func(headers map[string]string) (*Tenant, error) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/allconfig-operation", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return api.resolveTenant(req)
+	}
+
+	tenant, err := resolve(map[string]string{TenantHeader: "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tenant.ID)
+
+	// The API key identifies its tenant without the header, and agrees with it
+	tenant, err = resolve(map[string]string{APIKeyHeader: "globex-key"})
+	require.NoError(t, err)
+	assert.Equal(t, "globex", tenant.ID)
+	tenant, err = resolve(map[string]string{TenantHeader: "globex", APIKeyHeader: "globex-key"})
+	require.NoError(t, err)
+	assert.Equal(t, "globex", tenant.ID)
+
+	for _, tc := range []struct {
+		headers map[string]string
+		message string
+	}{
+		{nil, "a tenant is required: send the X-Tenant-ID header or a tenant's API key"},
+		{map[string]string{APIKeyHeader: "unrelated"}, "a tenant is required: send the X-Tenant-ID header or a tenant's API key"},
+		{map[string]string{TenantHeader: "initech"}, `unknown tenant "initech"`},
+		{map[string]string{TenantHeader: "acme", APIKeyHeader: "globex-key"}, "the API key belongs to tenant globex, not acme"},
+	} {
+		_, err := resolve(tc.headers)
+		var apiErr *apiError
+		require.ErrorAs(t, err, &apiErr, tc.message)
+		assert.Equal(t, http.StatusForbidden, apiErr.Status)
+		assert.Equal(t, ErrorCodeForbidden, apiErr.Code)
+		assert.Equal(t, tc.message, apiErr.Message)
+	}
+
+	// Without tenants every request keeps its table
+	tenant, err = NewAPI().resolveTenant(httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.NoError(t, err)
+	assert.Nil(t, tenant)
+}
+
+func TestTenantTable(t *testing.T) {
+	api := tenantAPI()
+	acme := api.tenants["acme"]
+	assert.Equal(t, "acme_allconfig", api.tenantTable(acme, ""))
+	assert.Equal(t, "acme_allconfig", api.tenantTable(acme, "globex_allconfig"), "the tenant's table overrides the request's")
+	assert.Equal(t, "acme_allconfig_approval_requests", api.approvalTable(api.tenantTable(acme, "")))
+	assert.Equal(t, "settings", api.tenantTable(nil, "settings"))
+	assert.Equal(t, "allconfig", api.tenantTable(nil, ""))
+}
+
+func TestTenantConfigResources(t *testing.T) {
+	api := tenantAPI()
+	conn := newProfileConnector("mysql")
+	conn.On("Query", mock.Anything, queryContaining("FROM acme_allconfig WHERE config_key = ?"), []interface{}{"feature.flag"}).
+		Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"feature.flag", "on"}), nil).Once()
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: conn, Database: "app"})
+	api.addProfile(ConnectionProfile{Name: "reporting", Connector: newProfileConnector("mysql"), Database: "reports"})
+	handler := SetupRoutes(api)
+
+	// The tenant's profile is used without being named
+	rr := serveConfigs(handler, http.MethodGet, "/v1/configs/feature.flag", nil, map[string]string{APIKeyHeader: "acme-key"})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	conn.AssertExpectations(t)
+
+	// Another profile is out of reach
+	rr = serveConfigs(handler, http.MethodGet, "/v1/configs/feature.flag?profile=reporting", nil, map[string]string{TenantHeader: "acme"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"error_code":"FORBIDDEN"`)
+	assert.Contains(t, rr.Body.String(), "tenant acme may not use connection profile reporting")
+
+	rr = serveConfigs(handler, http.MethodPost, "/v1/allconfig-operation", map[string]interface{}{"operation": "read"}, map[string]string{TenantHeader: "initech"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), `unknown tenant \"initech\"`)
+
+	// A request naming no tenant cannot reach a tenant's tables through its table_name
+	for _, path := range []string{"/v1/allconfig-operation", "/v1/allconfig"} {
+		rr = serveConfigs(handler, http.MethodPost, path, map[string]interface{}{"operation": "read", "table_name": "acme_allconfig"}, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code, path)
+		assert.Contains(t, rr.Body.String(), "a tenant is required", path)
+	}
+	rr = serveConfigs(handler, http.MethodGet, "/v1/configs/feature.flag?profile=primary", nil, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// Default phase timeouts, and the longest a request may ask for
+const (
+	DefaultConnectTimeout      = 5 * time.Second
+	DefaultOperationTimeout    = 30 * time.Second
+	DefaultMaxConnectTimeout   = 30 * time.Second
+	DefaultMaxOperationTimeout = 5 * time.Minute
+)
+
+// PhaseTimeouts bounds the two phases of a request: connecting to the database, ping included, and running
+// the operation. Requests may set connect_timeout_ms and operation_timeout_ms up to the maximums.
+type PhaseTimeouts struct {
+	Connect      time.Duration
+	Operation    time.Duration
+	MaxConnect   time.Duration
+	MaxOperation time.Duration
+}
+
+// DefaultPhaseTimeouts returns the default phase timeouts
+func DefaultPhaseTimeouts() PhaseTimeouts {
+	return PhaseTimeouts{
+		Connect:      DefaultConnectTimeout,
+		Operation:    DefaultOperationTimeout,
+		MaxConnect:   DefaultMaxConnectTimeout,
+		MaxOperation: DefaultMaxOperationTimeout,
+	}
+}
+
+// withDefaults fills unset timeouts with their defaults, raising maximums below their timeouts
+func (t PhaseTimeouts) withDefaults() PhaseTimeouts {
+	d := DefaultPhaseTimeouts()
+	if t.Connect <= 0 {
+		t.Connect = d.Connect
+	}
+	if t.Operation <= 0 {
+		t.Operation = d.Operation
+	}
+	if t.MaxConnect <= 0 {
+		t.MaxConnect = d.MaxConnect
+	}
+	if t.MaxOperation <= 0 {
+		t.MaxOperation = d.MaxOperation
+	}
+	t.MaxConnect = max(t.MaxConnect, t.Connect)
+	t.MaxOperation = max(t.MaxOperation, t.Operation)
+	return t
+}
+
+// Phases of a request reported by timeout errors
+const (
+	phaseConnect   = "connect"
+	phaseOperation = "operation"
+)
+
+// phaseTimeoutError reports the phase of a request that ran out of time
+type phaseTimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *phaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s phase timed out after %s: %v", e.Phase, e.Timeout, e.Err)
+}
+
+func (e *phaseTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// checkTimeouts reports requested timeouts that are negative or over their maximums
+func (t PhaseTimeouts) checkTimeouts(req *DatabaseConnectionRequest) []string {
+	var problems []string
+	check := func(field string, ms int, limit time.Duration) {
+		switch {
+		case ms < 0:
+			problems = append(problems, fmt.Sprintf("%s cannot be negative", field))
+		case time.Duration(ms)*time.Millisecond > limit:
+			problems = append(problems, fmt.Sprintf("%s cannot exceed %d", field, limit.Milliseconds()))
+		}
+	}
+	check("connect_timeout_ms", req.ConnectTimeoutMs, t.MaxConnect)
+	check("operation_timeout_ms", req.OperationTimeoutMs, t.MaxOperation)
+	return problems
+}
+
+// connectTimeout returns the connect timeout of a request, the server's unless the request sets one
+func (t PhaseTimeouts) connectTimeout(req *DatabaseConnectionRequest) time.Duration {
+	if req.ConnectTimeoutMs > 0 {
+		return time.Duration(req.ConnectTimeoutMs) * time.Millisecond
+	}
+	return t.Connect
+}
+
+// operationTimeout returns the operation timeout of a request, the server's unless the request sets one
+func (t PhaseTimeouts) operationTimeout(req *DatabaseConnectionRequest) time.Duration {
+	if req.OperationTimeoutMs > 0 {
+		return time.Duration(req.OperationTimeoutMs) * time.Millisecond
+	}
+	return t.Operation
+}
+
+// phase bounds one phase of a request by its timeout
+type phase struct {
+	name    string
+	timeout time.Duration
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// startPhase starts a phase of a request running under ctx for at most timeout; callers must call cancel
+func startPhase(ctx context.Context, name string, timeout time.Duration) *phase {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return &phase{name: name, timeout: timeout, ctx: ctx, cancel: cancel}
+}
+
+// err wraps an error of the phase in a phaseTimeoutError when the phase ran out of time
+func (p *phase) err(err error) error {
+	if err != nil && errors.Is(p.ctx.Err(), context.DeadlineExceeded) {
+		return &phaseTimeoutError{Phase: p.name, Timeout: p.timeout, Err: err}
+	}
+	return err
+}
+
+// connectPhase starts the connect phase of a request
+func (a *API) connectPhase(ctx context.Context, req *DatabaseConnectionRequest) *phase {
+	return startPhase(ctx, phaseConnect, a.phaseTimeouts.connectTimeout(req))
+}
+
+// operationPhase starts the operation phase of a request, which ends the wait of a timed request
+func (a *API) operationPhase(ctx context.Context, req *DatabaseConnectionRequest) *phase {
+	return startPhase(startOperation(ctx), phaseOperation, a.phaseTimeouts.operationTimeout(req))
+}
+
+// connectWithin connects connector in the connect phase of req, through the circuit breaker of its connection
+func (a *API) connectWithin(ctx context.Context, connector connectors.DBConnector, req *DatabaseConnectionRequest) error {
+	p := a.connectPhase(ctx, req)
+	defer p.cancel()
+	start := time.Now()
+	defer func() { addConnect(ctx, time.Since(start)) }()
+	return a.guardConnect(a.connectionKey(req), func() error {
+		return p.err(connector.Connect(p.ctx))
+	})
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const slowDriver = "slowkv"
+
+// slowDriverConnector is the connector returned for slowDriver requests
+var slowDriverConnector *slowConnector
+
+func init() {
+	connectors.RegisterDriver(slowDriver, func(config *connectors.ConnectionConfig, opts ...connectors.Option) connectors.DBConnector {
+		return slowDriverConnector
+	})
+}
+
+// slowConnector takes connectDelay to connect and executeDelay to execute, or until its context is done
+type slowConnector struct {
+	connectortest.MockDBConnector
+	connectDelay time.Duration
+	executeDelay time.Duration
+	executeErr   error // Returned by the last Execute
+}
+
+func waitFor(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *slowConnector) Connect(ctx context.Context) error {
+	return waitFor(ctx, c.connectDelay)
+}
+
+func (c *slowConnector) Close(ctx context.Context) error {
+	return nil
+}
+
+func (c *slowConnector) GetType() string {
+	return slowDriver
+}
+
+func (c *slowConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	if c.executeErr = waitFor(ctx, c.executeDelay); c.executeErr != nil {
+		return nil, fmt.Errorf("failed to execute %s: %w", operation, c.executeErr)
+	}
+	return map[string]interface{}{"value": "alice"}, nil
+}
+
+// executeSlow sends an execute request for a slowDriver database with the given timeouts
+func executeSlow(t *testing.T, api *API, connectTimeoutMs, operationTimeoutMs int) *httptest.ResponseRecorder {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":                 slowDriver,
+		"host":                 "kv.internal",
+		"port":                 7000,
+		"database":             "sessions",
+		"operation":            "get",
+		"params":               map[string]interface{}{"key": "user:1"},
+		"connect_timeout_ms":   connectTimeoutMs,
+		"operation_timeout_ms": operationTimeoutMs,
+	})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	SetupRoutes(api).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewReader(data)))
+	return rr
+}
+
+func TestExecuteTimeoutPhases(t *testing.T) {
+	tests := []struct {
+		name               string
+		connectDelay       time.Duration
+		executeDelay       time.Duration
+		connectTimeoutMs   int
+		operationTimeoutMs int
+		phase              string
+		timeoutMs          float64
+	}{
+		{"slow connect", time.Second, 0, 20, 1000, phaseConnect, 20},
+		{"slow operation", 0, time.Second, 1000, 20, phaseOperation, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slowDriverConnector = &slowConnector{connectDelay: tt.connectDelay, executeDelay: tt.executeDelay}
+			rr := executeSlow(t, NewAPI(), tt.connectTimeoutMs, tt.operationTimeoutMs)
+
+			require.Equal(t, http.StatusGatewayTimeout, rr.Code, rr.Body.String())
+			var response DatabaseResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, ErrorCodeTimeout, response.ErrorCode)
+			assert.Contains(t, response.Error, fmt.Sprintf("%s phase timed out after 20ms", tt.phase))
+			assert.Equal(t, map[string]interface{}{"phase": tt.phase, "timeout_ms": tt.timeoutMs}, response.Details)
+		})
+	}
+}
+
+func TestExecuteTimeoutPhasesAreSeparate(t *testing.T) {
+	// Each phase gets its own budget, so a slow connect doesn't eat into the operation
+	slowDriverConnector = &slowConnector{connectDelay: 60 * time.Millisecond, executeDelay: 60 * time.Millisecond}
+	rr := executeSlow(t, NewAPI(), 100, 100)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+func TestExecuteTimeoutValidation(t *testing.T) {
+	slowDriverConnector = &slowConnector{}
+	api := NewAPI()
+	api.phaseTimeouts = PhaseTimeouts{Connect: time.Second, MaxConnect: time.Second, MaxOperation: time.Minute}.withDefaults()
+
+	rr := executeSlow(t, api, 2000, -1)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "connect_timeout_ms cannot exceed 1000")
+	assert.Contains(t, rr.Body.String(), "operation_timeout_ms cannot be negative")
+
+	rr = executeSlow(t, api, 1000, 60000)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+func TestPhaseTimeoutsWithDefaults(t *testing.T) {
+	assert.Equal(t, DefaultPhaseTimeouts(), PhaseTimeouts{}.withDefaults())
+
+	// Maximums below their timeouts are raised to them
+	timeouts := PhaseTimeouts{Connect: time.Minute, Operation: 10 * time.Second, MaxOperation: time.Second}.withDefaults()
+	assert.Equal(t, PhaseTimeouts{
+		Connect:      time.Minute,
+		Operation:    10 * time.Second,
+		MaxConnect:   time.Minute,
+		MaxOperation: 10 * time.Second,
+	}, timeouts)
+
+	assert.Equal(t, DefaultPhaseTimeouts(), NewServer(config.ServerConfig{Port: 8080}).api.phaseTimeouts)
+	assert.Equal(t, 2*time.Second, NewServer(config.ServerConfig{Port: 8080}, WithPhaseTimeouts(PhaseTimeouts{Connect: 2 * time.Second})).api.phaseTimeouts.Connect)
+}
+
+func TestPhaseErr(t *testing.T) {
+	p := startPhase(context.Background(), phaseOperation, time.Millisecond)
+	defer p.cancel()
+	<-p.ctx.Done()
+
+	err := p.err(fmt.Errorf("failed to run query: %w", p.ctx.Err()))
+	var timeout *phaseTimeoutError
+	require.ErrorAs(t, err, &timeout)
+	assert.Equal(t, phaseOperation, timeout.Phase)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	status, code := classifyDatabaseError(err)
+	assert.Equal(t, http.StatusGatewayTimeout, status)
+	assert.Equal(t, ErrorCodeTimeout, code)
+
+	// Errors of phases with time left, and cancelled phases, are left alone
+	p = startPhase(context.Background(), phaseConnect, time.Minute)
+	failed := errors.New("connection refused")
+	assert.Equal(t, failed, p.err(failed))
+	p.cancel()
+	assert.Equal(t, failed, p.err(failed))
+	assert.NoError(t, p.err(nil))
+}
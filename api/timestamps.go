@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"db-connectors/connectors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// configTimestampColumns are the timestamps returned for a config after it is created or updated
+const configTimestampColumns = "created_at, updated_at, approved_at"
+
+// ConfigWrite is the result of creating or updating a config directly: its key and the timestamps the
+// database stored for it, with the expiry the write set. A dry run writes nothing and so reports no
+// timestamps.
+type ConfigWrite struct {
+	Key        string     `json:"config_key"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// scanConfigWrite reads the timestamps of a config from the first of rows, reporting false when there is none
+func scanConfigWrite(rows *sql.Rows, key string) (*ConfigWrite, bool, error) {
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, false, rows.Err()
+	}
+	var created, updated, approved sql.NullTime
+	if err := rows.Scan(&created, &updated, &approved); err != nil {
+		return nil, false, fmt.Errorf("failed to read config timestamps: %w", err)
+	}
+	return &ConfigWrite{Key: key, CreatedAt: utcTime(created), UpdatedAt: utcTime(updated), ApprovedAt: utcTime(approved)}, true, nil
+}
+
+// returnConfigWrite runs a write returning the timestamps of the config under key, reporting false when
+// it matched no row
+func returnConfigWrite(ctx context.Context, connector connectors.DBConnector, query string, args []interface{}, key string) (*ConfigWrite, bool, error) {
+	rows, err := connector.Query(ctx, query+" RETURNING "+configTimestampColumns, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	return scanConfigWrite(rows, key)
+}
+
+// readConfigWrite reads back the timestamps the database stored for the config under key, for databases
+// that cannot return them from the write itself
+func (a *API) readConfigWrite(ctx context.Context, connector connectors.DBConnector, tableName, key string) (*ConfigWrite, error) {
+	if connector.GetType() == "mongodb" {
+		params := map[string]interface{}{
+			"collection": tableName,
+			"filter":     map[string]interface{}{"config_key": key},
+		}
+		result, err := connector.Execute(ctx, "findOne", params)
+		if err != nil {
+			return nil, notFound(err, ErrConfigNotFound, key)
+		}
+		doc, _ := result.(map[string]interface{})
+		return &ConfigWrite{Key: key, CreatedAt: mongoTime(doc["created_at"]), UpdatedAt: mongoTime(doc["updated_at"]), ApprovedAt: mongoTime(doc["approved_at"])}, nil
+	}
+
+	rows, err := connector.Query(ctx, connectors.Bind(sqlDialect(connector), "SELECT "+configTimestampColumns+" FROM "+sqlTable(ctx, tableName)+" WHERE config_key = ?"), key)
+	if err != nil {
+		return nil, err
+	}
+	write, found, err := scanConfigWrite(rows, key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, key)
+	}
+	return write, nil
+}
+
+// utcTime returns t in UTC, or nil when it is NULL
+func utcTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// mongoTime returns a date read from a MongoDB document in UTC, or nil when it is missing
+func mongoTime(v interface{}) *time.Time {
+	var t time.Time
+	switch v := v.(type) {
+	case primitive.DateTime:
+		t = v.Time()
+	case time.Time:
+		t = v
+	default:
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// mongoNow returns the current time as MongoDB stores it, in UTC to the millisecond. Inserts are stamped
+// with it as they cannot take the server's clock the way updates do with currentDate.
+func mongoNow() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// currentDate returns a $currentDate operator setting fields to the MongoDB server's clock
+func currentDate(fields ...string) map[string]interface{} {
+	dates := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		dates[field] = true
+	}
+	return dates
+}
+
+var (
+	mongoDateTimeType = reflect.TypeOf(primitive.DateTime(0))
+
+	// timeHolders caches whether values of a type can hold a time
+	timeHolders sync.Map
+)
+
+// utcTimes returns data with every time it holds converted to UTC, so that responses serialize timestamps
+// as RFC 3339 in UTC whatever the time zone of the column, the session or the host. MongoDB dates, which
+// serialize in the host's zone, become times wherever any type may be stored.
+func utcTimes(data interface{}) interface{} {
+	if data == nil {
+		return nil
+	}
+	return utcValue(reflect.ValueOf(data)).Interface()
+}
+
+// utcValue returns v with its times converted to UTC, copying the maps, slices, structs and pointers
+// holding them rather than changing them in place
+func utcValue(v reflect.Value) reflect.Value {
+	t := v.Type()
+	switch t {
+	case timeType:
+		return reflect.ValueOf(v.Interface().(time.Time).UTC())
+	case mongoDateTimeType:
+		return reflect.ValueOf(v.Interface().(primitive.DateTime).Time().UTC())
+	}
+	if !holdsTime(t) {
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return utcValue(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(t.Elem())
+		copied.Elem().Set(assignableUTC(v.Elem(), t.Elem()))
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(t, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), assignableUTC(iter.Value(), t.Elem()))
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(assignableUTC(v.Index(i), t.Elem()))
+		}
+		return copied
+	case reflect.Array, reflect.Struct:
+		copied := reflect.New(t).Elem()
+		copied.Set(v)
+		if t.Kind() == reflect.Array {
+			for i := 0; i < v.Len(); i++ {
+				copied.Index(i).Set(assignableUTC(v.Index(i), t.Elem()))
+			}
+		} else {
+			for i := 0; i < t.NumField(); i++ {
+				if t.Field(i).IsExported() {
+					copied.Field(i).Set(assignableUTC(v.Field(i), t.Field(i).Type))
+				}
+			}
+		}
+		return copied
+	}
+	return v
+}
+
+// assignableUTC returns v with its times converted to UTC, or v itself when the conversion cannot be stored
+// as typ, such as a MongoDB date held in a field of its own type
+func assignableUTC(v reflect.Value, typ reflect.Type) reflect.Value {
+	converted := utcValue(v)
+	if !converted.Type().AssignableTo(typ) {
+		return v
+	}
+	return converted
+}
+
+// holdsTime reports whether values of t can hold a time, reaching it through exported fields
+func holdsTime(t reflect.Type) bool {
+	if holds, ok := timeHolders.Load(t); ok {
+		return holds.(bool)
+	}
+	holds := typeHoldsTime(t, map[reflect.Type]bool{})
+	timeHolders.Store(t, holds)
+	return holds
+}
+
+// typeHoldsTime reports whether values of t can hold a time, treating types already being visited as not
+// holding one so that recursive types terminate
+func typeHoldsTime(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if t == timeType || t == mongoDateTimeType || t.Kind() == reflect.Interface {
+		return true
+	}
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Array:
+		return typeHoldsTime(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && typeHoldsTime(t.Field(i).Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// writtenAt is the time the mocked databases report configs were written, in a zone other than UTC
+var writtenAt = time.Date(2024, 3, 1, 20, 0, 0, 0, time.FixedZone("IST", 5*3600+1800))
+
+// expectConfigTimestamps has conn report writtenAt as the timestamps of the next n configs read back
+// after a write
+func expectConfigTimestamps(t *testing.T, conn *connectortest.MockDBConnector, n int) {
+	for i := 0; i < n; i++ {
+		conn.On("Query", mock.Anything, queryContaining("SELECT "+configTimestampColumns), mock.Anything).
+			Return(newMockRows(t, []string{"created_at", "updated_at", "approved_at"}, []driver.Value{writtenAt, writtenAt, writtenAt}), nil).Once()
+	}
+}
+
+// timestampRows returns the timestamps of a config written at writtenAt
+func timestampRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"created_at", "updated_at", "approved_at"}).AddRow(writtenAt, writtenAt, writtenAt)
+}
+
+// assertWrittenAt asserts that result is the write of key with every timestamp set to writtenAt in UTC
+func assertWrittenAt(t *testing.T, key string, result interface{}) {
+	write, ok := result.(*ConfigWrite)
+	require.True(t, ok, "result is %T", result)
+	assert.Equal(t, key, write.Key)
+	for _, ts := range []*time.Time{write.CreatedAt, write.UpdatedAt, write.ApprovedAt} {
+		require.NotNil(t, ts)
+		assert.True(t, ts.Equal(writtenAt))
+		assert.Equal(t, time.UTC, ts.Location())
+	}
+}
+
+func TestConfigWriteTimestamps(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("mysql reads them back", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Execute", mock.Anything, "execute", mock.Anything).Return(sqlmock.NewResult(0, 1), nil)
+		conn.On("Query", mock.Anything, "SELECT created_at, updated_at, approved_at FROM allconfig WHERE config_key = ?", []interface{}{"feature.flag"}).
+			Return(newMockRows(t, []string{"created_at", "updated_at", "approved_at"}, []driver.Value{writtenAt, writtenAt, writtenAt}), nil).Once()
+		expectConfigTimestamps(t, conn, 1)
+
+		result, err := NewAPI().createConfigDirect(ctx, conn, "allconfig", "feature.flag", "on", "", nil, nil, "alice")
+		require.NoError(t, err)
+		assertWrittenAt(t, "feature.flag", result)
+
+		result, err = NewAPI().updateConfigDirect(ctx, conn, "allconfig", "feature.flag", "off", "", nil, nil, "alice")
+		require.NoError(t, err)
+		assertWrittenAt(t, "feature.flag", result)
+	})
+
+	t.Run("postgresql returns them", func(t *testing.T) {
+		columns := []string{"created_at", "updated_at", "approved_at"}
+		conn := newServiceConnector("postgresql")
+		for i := 0; i < 2; i++ {
+			conn.On("Query", mock.Anything, queryContaining("RETURNING created_at, updated_at, approved_at"), mock.Anything).
+				Return(newMockRows(t, columns, []driver.Value{writtenAt, writtenAt, writtenAt}), nil).Once()
+		}
+		conn.On("Query", mock.Anything, queryContaining("RETURNING created_at, updated_at, approved_at"), mock.Anything).
+			Return(newMockRows(t, columns), nil).Once()
+
+		result, err := NewAPI().createConfigDirect(ctx, conn, "allconfig", "feature.flag", "on", "", nil, nil, "alice")
+		require.NoError(t, err)
+		assertWrittenAt(t, "feature.flag", result)
+
+		result, err = NewAPI().updateConfigDirect(ctx, conn, "allconfig", "feature.flag", "off", "", nil, nil, "alice")
+		require.NoError(t, err)
+		assertWrittenAt(t, "feature.flag", result)
+
+		// An update returning no row matched no key
+		_, err = NewAPI().updateConfigDirect(ctx, conn, "allconfig", "missing", "off", "", nil, nil, "alice")
+		assert.ErrorIs(t, err, ErrConfigNotFound)
+		conn.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("mongodb", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "insert", mock.Anything).Return(&mongo.InsertOneResult{}, nil)
+		// Updates take the server's clock, so the timestamps are read back
+		conn.On("Execute", mock.Anything, "update", mock.MatchedBy(func(params map[string]interface{}) bool {
+			update := params["update"].(map[string]interface{})
+			_, setsUpdatedAt := update["$set"].(map[string]interface{})["updated_at"]
+			return !setsUpdatedAt && assert.ObjectsAreEqual(currentDate("updated_at", "approved_at"), update["$currentDate"])
+		})).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+		stored := primitive.NewDateTimeFromTime(writtenAt)
+		conn.On("Execute", mock.Anything, "findOne", mock.Anything).
+			Return(map[string]interface{}{"created_at": stored, "updated_at": stored, "approved_at": stored}, nil)
+
+		before := time.Now()
+		result, err := NewAPI().createConfigDirect(ctx, conn, "allconfig", "feature.flag", "on", "", nil, nil, "alice")
+		require.NoError(t, err)
+		// The document is stamped with the time it was inserted at, as stored
+		write := result.(*ConfigWrite)
+		require.NotNil(t, write.CreatedAt)
+		assert.Equal(t, time.UTC, write.CreatedAt.Location())
+		assert.Equal(t, write.CreatedAt.Truncate(time.Millisecond), *write.CreatedAt)
+		assert.WithinDuration(t, before, *write.CreatedAt, time.Second)
+		document := conn.Calls[1].Arguments.Get(2).(map[string]interface{})["document"].(map[string]interface{})
+		assert.Equal(t, *write.CreatedAt, document["created_at"])
+
+		result, err = NewAPI().updateConfigDirect(ctx, conn, "allconfig", "feature.flag", "off", "", nil, nil, "alice")
+		require.NoError(t, err)
+		assertWrittenAt(t, "feature.flag", result)
+	})
+
+	t.Run("dry run reports no timestamps", func(t *testing.T) {
+		conn := newServiceConnector("postgresql")
+		conn.On("Query", mock.Anything, queryContaining("COUNT(*)"), mock.Anything).
+			Return(newMockRows(t, []string{"COUNT(*)"}, []driver.Value{0}), nil)
+
+		api := NewAPI()
+		result, err := api.createConfigDirect(ctx, &dryRunConnector{DBConnector: conn, api: api}, "allconfig", "feature.flag", "on", "", nil, nil, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, &ConfigWrite{Key: "feature.flag"}, result)
+		conn.AssertNotCalled(t, "Query", mock.Anything, queryContaining("RETURNING"), mock.Anything)
+		assertNothingWritten(t, conn)
+	})
+}
+
+func TestUTCTimes(t *testing.T) {
+	local := time.Date(2024, 3, 1, 9, 0, 0, 0, time.FixedZone("PST", -8*3600))
+	data := DatabaseResponse{
+		Success: true,
+		Data: []map[string]interface{}{
+			{"config_key": "feature.flag", "updated_at": local, "approved_at": &local},
+			{"config_key": "limits", "stored": primitive.NewDateTimeFromTime(local), "nested": []interface{}{local}},
+		},
+		Timestamp: local,
+	}
+
+	converted := utcTimes(data).(DatabaseResponse)
+	assert.Equal(t, time.UTC, converted.Timestamp.Location())
+	body, err := json.Marshal(converted)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "-08:00")
+	assert.Equal(t, 5, strings.Count(string(body), `"2024-03-01T17:00:00Z"`))
+
+	// The original is left as it was
+	assert.Equal(t, local, data.Data.([]map[string]interface{})[0]["updated_at"])
+	assert.Equal(t, "PST", data.Timestamp.Location().String())
+
+	// Values that hold no times are returned as they are
+	rows := []string{"a", "b"}
+	assert.Equal(t, rows, utcTimes(rows))
+	assert.Nil(t, utcTimes(nil))
+}
+
+func TestSendJSONUTC(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewAPI().sendSuccess(rr, &ConfigWrite{Key: "feature.flag", CreatedAt: &writtenAt}, "created")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data      map[string]interface{} `json:"data"`
+		Timestamp string                 `json:"timestamp"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "2024-03-01T14:30:00Z", response.Data["created_at"])
+	_, err := time.Parse(time.RFC3339, response.Timestamp)
+	require.NoError(t, err)
+	assert.Equal(t, byte('Z'), response.Timestamp[len(response.Timestamp)-1])
+}
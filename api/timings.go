@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"db-connectors/connectors"
+)
+
+// Timings breaks the time a request took down by phase, in milliseconds. The phases follow one another, so
+// they add up to the total.
+type Timings struct {
+	ConnectMs   float64 `json:"connect"`    // Connecting to the database, ping included
+	WaitMs      float64 `json:"wait"`       // Between connecting and running the operation, such as validating
+	ExecuteMs   float64 `json:"execute"`    // Running the operation and preparing its result
+	DatabaseMs  float64 `json:"database"`   // Part of execute spent running statements, as the connectors report it
+	Statements  int64   `json:"statements"` // Statements the operation ran
+	SerializeMs float64 `json:"serialize"`  // Encoding the result as JSON
+	TotalMs     float64 `json:"total"`
+}
+
+// Request phases recorded by the latency histograms
+const (
+	timingConnect   = "connect"
+	timingWait      = "wait"
+	timingExecute   = "execute"
+	timingSerialize = "serialize"
+	timingTotal     = "total"
+)
+
+// requestTimer times the phases of one request, from the handler being called to its response being encoded
+type requestTimer struct {
+	start     time.Time
+	connect   time.Duration
+	started   time.Time // When the operation started; zero until it has
+	database  connectors.StatementTimings
+	operation string // Names the request in the latency histograms; empty records none
+	include   bool   // Return the timings in the response
+	finished  bool
+}
+
+// requestTimerKey stores the requestTimer of a request in its context
+type requestTimerKey struct{}
+
+// requestTimerFrom returns the timer stored in ctx by timeRequest, or nil
+func requestTimerFrom(ctx context.Context) *requestTimer {
+	timer, _ := ctx.Value(requestTimerKey{}).(*requestTimer)
+	return timer
+}
+
+// timedWriter is the response writer of a timed request, through which sendJSON finds its timer
+type timedWriter struct {
+	http.ResponseWriter
+	timer *requestTimer
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *timedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// timeRequest starts timing a request, returning the writer and request the handler must use from then on
+func (a *API) timeRequest(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	timer := &requestTimer{start: time.Now()}
+	return &timedWriter{ResponseWriter: w, timer: timer}, r.WithContext(context.WithValue(r.Context(), requestTimerKey{}, timer))
+}
+
+// timeOperation names a timed request in the latency histograms once it is valid, and returns its timings
+// in the response when include is set
+func timeOperation(r *http.Request, operation string, include bool) {
+	if timer := requestTimerFrom(r.Context()); timer != nil {
+		timer.operation = operation
+		timer.include = include
+	}
+}
+
+// addConnect counts time spent connecting to the timer of ctx, if it carries one
+func addConnect(ctx context.Context, elapsed time.Duration) {
+	if timer := requestTimerFrom(ctx); timer != nil {
+		timer.connect += elapsed
+	}
+}
+
+// startOperation marks the start of the operation of a timed request, returning ctx carrying the timings
+// its statements report
+func startOperation(ctx context.Context) context.Context {
+	timer := requestTimerFrom(ctx)
+	if timer == nil {
+		return ctx
+	}
+	if timer.started.IsZero() {
+		timer.started = time.Now()
+	}
+	return connectors.WithStatementTimings(ctx, &timer.database)
+}
+
+// finishTimings encodes the data of the response of a timed request, completing its timings. They are
+// recorded in the latency histograms, and returned in the response when the request asked for them.
+func (a *API) finishTimings(timer *requestTimer, response DatabaseResponse) DatabaseResponse {
+	if timer.finished {
+		return response
+	}
+	timer.finished = true
+
+	executed := time.Now()
+	if response.Data != nil {
+		// Encode the data here to time it; sendJSON then copies the encoded data as is
+		if raw, err := json.Marshal(utcTimes(response.Data)); err == nil {
+			response.Data = json.RawMessage(raw)
+		}
+	}
+	end := time.Now()
+
+	started := timer.started
+	if started.IsZero() {
+		started = executed
+	}
+	timings := Timings{
+		ConnectMs:   durationMs(timer.connect),
+		WaitMs:      durationMs(max(started.Sub(timer.start)-timer.connect, 0)),
+		ExecuteMs:   durationMs(executed.Sub(started)),
+		DatabaseMs:  durationMs(timer.database.Elapsed()),
+		Statements:  timer.database.Statements(),
+		SerializeMs: durationMs(end.Sub(executed)),
+		TotalMs:     durationMs(end.Sub(timer.start)),
+	}
+	if timer.operation != "" {
+		a.latencies.observe(timer.operation, timings)
+	}
+	if timer.include {
+		response.Timings = &timings
+	}
+	return response
+}
+
+// latencyBucketsMs are the upper bounds of the latency histogram buckets, in milliseconds
+var latencyBucketsMs = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// LatencyBucket counts the observations of a histogram up to its upper bound
+type LatencyBucket struct {
+	LeMs  float64 `json:"le_ms"`
+	Count int64   `json:"count"` // Cumulative, so it includes the buckets below
+}
+
+// LatencyHistogram reports the latencies of one phase of an operation, with percentiles estimated from
+// its buckets. Latencies above the last bucket count in Count only.
+type LatencyHistogram struct {
+	Count   int64           `json:"count"`
+	SumMs   float64         `json:"sum_ms"`
+	P50Ms   float64         `json:"p50_ms"`
+	P95Ms   float64         `json:"p95_ms"`
+	P99Ms   float64         `json:"p99_ms"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// latencyHistogram counts latencies in the buckets of latencyBucketsMs
+type latencyHistogram struct {
+	buckets []int64 // Per bucket, not cumulative, and one more for latencies above the last
+	sumMs   float64
+}
+
+func (h *latencyHistogram) observe(ms float64) {
+	if h.buckets == nil {
+		h.buckets = make([]int64, len(latencyBucketsMs)+1)
+	}
+	h.buckets[sort.SearchFloat64s(latencyBucketsMs, ms)]++
+	h.sumMs += ms
+}
+
+// stats returns the cumulative buckets of the histogram and the percentiles they give
+func (h *latencyHistogram) stats() LatencyHistogram {
+	stats := LatencyHistogram{SumMs: h.sumMs, Buckets: make([]LatencyBucket, len(latencyBucketsMs))}
+	for i, le := range latencyBucketsMs {
+		stats.Count += h.buckets[i]
+		stats.Buckets[i] = LatencyBucket{LeMs: le, Count: stats.Count}
+	}
+	stats.Count += h.buckets[len(latencyBucketsMs)]
+	stats.P50Ms = stats.quantile(0.5)
+	stats.P95Ms = stats.quantile(0.95)
+	stats.P99Ms = stats.quantile(0.99)
+	return stats
+}
+
+// quantile estimates the q-quantile by interpolating linearly within the bucket holding it. A quantile
+// above the last bucket is reported as its upper bound.
+func (h LatencyHistogram) quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	lower, below := 0.0, int64(0)
+	for _, bucket := range h.Buckets {
+		if float64(bucket.Count) >= rank && bucket.Count > below {
+			return lower + (bucket.LeMs-lower)*(rank-float64(below))/float64(bucket.Count-below)
+		}
+		lower, below = bucket.LeMs, bucket.Count
+	}
+	return lower
+}
+
+// latencyHistograms holds a latency histogram per phase of each operation
+type latencyHistograms struct {
+	mu         sync.Mutex
+	operations map[string]map[string]*latencyHistogram
+}
+
+// observe records the phases of a request running operation
+func (l *latencyHistograms) observe(operation string, timings Timings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.operations == nil {
+		l.operations = map[string]map[string]*latencyHistogram{}
+	}
+	phases, ok := l.operations[operation]
+	if !ok {
+		phases = map[string]*latencyHistogram{}
+		l.operations[operation] = phases
+	}
+	for phase, ms := range map[string]float64{
+		timingConnect:   timings.ConnectMs,
+		timingWait:      timings.WaitMs,
+		timingExecute:   timings.ExecuteMs,
+		timingSerialize: timings.SerializeMs,
+		timingTotal:     timings.TotalMs,
+	} {
+		h, ok := phases[phase]
+		if !ok {
+			h = &latencyHistogram{}
+			phases[phase] = h
+		}
+		h.observe(ms)
+	}
+}
+
+// stats returns the histograms of every phase of the operations recorded, by operation then phase
+func (l *latencyHistograms) stats() map[string]map[string]LatencyHistogram {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make(map[string]map[string]LatencyHistogram, len(l.operations))
+	for operation, phases := range l.operations {
+		stats[operation] = make(map[string]LatencyHistogram, len(phases))
+		for phase, h := range phases {
+			stats[operation][phase] = h.stats()
+		}
+	}
+	return stats
+}
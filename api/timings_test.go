@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// executeTimed sends an execute request for a slowDriver database, asking for its timings when include is set
+func executeTimed(t *testing.T, handler http.Handler, include bool) DatabaseResponse {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":            slowDriver,
+		"host":            "kv.internal",
+		"port":            7000,
+		"database":        "sessions",
+		"operation":       "get",
+		"params":          map[string]interface{}{"key": "user:1"},
+		"include_timings": include,
+	})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewReader(data)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response DatabaseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response
+}
+
+func TestIncludeTimings(t *testing.T) {
+	slowDriverConnector = &slowConnector{connectDelay: 20 * time.Millisecond, executeDelay: 40 * time.Millisecond}
+	api := NewAPI()
+	handler := SetupRoutes(api)
+
+	response := executeTimed(t, handler, true)
+	require.NotNil(t, response.Timings)
+	timings := *response.Timings
+	assert.GreaterOrEqual(t, timings.ConnectMs, 20.0)
+	assert.GreaterOrEqual(t, timings.ExecuteMs, 40.0)
+	assert.GreaterOrEqual(t, timings.WaitMs, 0.0)
+	assert.GreaterOrEqual(t, timings.SerializeMs, 0.0)
+	assert.Zero(t, timings.Statements, "the driver reports no statements")
+	assert.InDelta(t, timings.TotalMs, timings.ConnectMs+timings.WaitMs+timings.ExecuteMs+timings.SerializeMs, 0.01)
+	assert.Equal(t, map[string]interface{}{"value": "alice"}, response.Data, "the data is encoded once")
+
+	// Without include_timings the response leaves them out, though the histograms still record them
+	response = executeTimed(t, handler, false)
+	assert.Nil(t, response.Timings)
+
+	total := api.latencies.stats()["get"][timingTotal]
+	assert.Equal(t, int64(2), total.Count)
+	assert.GreaterOrEqual(t, total.SumMs, 120.0)
+	assert.Equal(t, 100.0, total.Buckets[5].LeMs)
+	assert.Equal(t, int64(2), total.Buckets[5].Count, "each request took under 100ms")
+	for _, phase := range []string{timingConnect, timingWait, timingExecute, timingSerialize} {
+		assert.Equal(t, int64(2), api.latencies.stats()["get"][phase].Count, phase)
+	}
+
+	// /metrics reports them by operation and phase
+	rr := serveConfigs(handler, http.MethodGet, "/v1/metrics", nil, nil)
+	var metrics struct {
+		Data Metrics `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &metrics))
+	assert.Equal(t, total, metrics.Data.Timings["get"][timingTotal])
+}
+
+func TestTimingsWithoutOperation(t *testing.T) {
+	// Requests failing validation are not recorded
+	api := NewAPI()
+	rr := httptest.NewRecorder()
+	SetupRoutes(api).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/execute", bytes.NewReader([]byte(`{"include_timings": true}`))))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "timings_ms")
+	assert.Empty(t, api.latencies.stats())
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	var h latencyHistogram
+	for i := 0; i < 50; i++ {
+		h.observe(0.5)
+	}
+	for i := 0; i < 45; i++ {
+		h.observe(7)
+	}
+	for i := 0; i < 5; i++ {
+		h.observe(3000)
+	}
+	stats := h.stats()
+	assert.Equal(t, int64(100), stats.Count)
+	assert.InDelta(t, 15340.0, stats.SumMs, 0.001)
+	assert.Equal(t, 1.0, stats.P50Ms)
+	assert.Equal(t, 10.0, stats.P95Ms)
+	assert.Equal(t, 4500.0, stats.P99Ms)
+	assert.Equal(t, LatencyBucket{LeMs: 5, Count: 50}, stats.Buckets[1])
+	assert.Equal(t, LatencyBucket{LeMs: 10000, Count: 100}, stats.Buckets[len(stats.Buckets)-1])
+
+	// Latencies above the last bucket are reported as its bound
+	var slow latencyHistogram
+	slow.observe(20000)
+	stats = slow.stats()
+	assert.Equal(t, int64(1), stats.Count)
+	assert.Equal(t, int64(0), stats.Buckets[len(stats.Buckets)-1].Count)
+	assert.Equal(t, 10000.0, stats.P50Ms)
+
+	empty := latencyHistogram{buckets: make([]int64, len(latencyBucketsMs)+1)}
+	assert.Zero(t, empty.stats().P99Ms)
+}
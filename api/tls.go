@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Default HTTP server timeouts
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 2 * time.Minute // Covers /execute-batch and job result downloads
+	DefaultIdleTimeout       = 2 * time.Minute
+)
+
+// Timeouts bounds how long the server waits on clients
+type Timeouts struct {
+	ReadHeader time.Duration // Reading request headers; guards against slowloris clients
+	Read       time.Duration // Reading the whole request including the body
+	Write      time.Duration // From the end of the request headers to the end of the response
+	Idle       time.Duration // Keep-alive connections waiting for the next request
+}
+
+// DefaultTimeouts returns the timeouts used when none are configured
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		ReadHeader: DefaultReadHeaderTimeout,
+		Read:       DefaultReadTimeout,
+		Write:      DefaultWriteTimeout,
+		Idle:       DefaultIdleTimeout,
+	}
+}
+
+// withDefaults fills zero timeouts from DefaultTimeouts
+func (t Timeouts) withDefaults() Timeouts {
+	defaults := DefaultTimeouts()
+	if t.ReadHeader <= 0 {
+		t.ReadHeader = defaults.ReadHeader
+	}
+	if t.Read <= 0 {
+		t.Read = defaults.Read
+	}
+	if t.Write <= 0 {
+		t.Write = defaults.Write
+	}
+	if t.Idle <= 0 {
+		t.Idle = defaults.Idle
+	}
+	return t
+}
+
+// TLSOptions holds the PEM files used to serve HTTPS
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string // When set, clients must present a certificate signed by this CA (mTLS)
+}
+
+// Enabled reports whether HTTPS is configured
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" && o.KeyFile != ""
+}
+
+// serverConfig builds the tls.Config for the server, or nil when TLS is disabled
+func (o TLSOptions) serverConfig() (*tls.Config, error) {
+	if !o.Enabled() {
+		if o.CertFile != "" || o.KeyFile != "" || o.ClientCAFile != "" {
+			return nil, fmt.Errorf("TLS requires both a certificate file and a key file")
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.ClientCAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(o.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", o.ClientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
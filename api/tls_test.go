@@ -0,0 +1,168 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"db-connectors/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate and key written as PEM files
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert issues a certificate signed by parent, or a self-signed CA when parent is nil
+func newTestCert(t *testing.T, dir, name string, parent *testCert, template *x509.Certificate) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	tc := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(tc.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(tc.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return tc
+}
+
+func TestHTTPServerDefaults(t *testing.T) {
+	server, err := NewServer(config.ServerConfig{Port: 8080}).HTTPServer()
+	require.NoError(t, err)
+
+	assert.Equal(t, ":8080", server.Addr)
+	assert.Nil(t, server.TLSConfig)
+	assert.Equal(t, DefaultReadHeaderTimeout, server.ReadHeaderTimeout)
+	assert.Equal(t, DefaultReadTimeout, server.ReadTimeout)
+	assert.Equal(t, DefaultWriteTimeout, server.WriteTimeout)
+	assert.Equal(t, DefaultIdleTimeout, server.IdleTimeout)
+	assert.NotNil(t, server.Handler)
+}
+
+func TestHTTPServerOptions(t *testing.T) {
+	server, err := NewServer(config.ServerConfig{Port: 9443},
+		WithHost("127.0.0.1"),
+		WithTimeouts(Timeouts{Read: 5 * time.Second, Write: time.Minute}),
+	).HTTPServer()
+	require.NoError(t, err)
+
+	assert.Equal(t, "127.0.0.1:9443", server.Addr)
+	assert.Equal(t, 5*time.Second, server.ReadTimeout)
+	assert.Equal(t, time.Minute, server.WriteTimeout)
+	assert.Equal(t, DefaultReadHeaderTimeout, server.ReadHeaderTimeout, "zero timeouts keep the defaults")
+	assert.Equal(t, DefaultIdleTimeout, server.IdleTimeout)
+
+	server, err = NewServer(config.ServerConfig{Port: 8443}, WithHost("::1")).HTTPServer()
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:8443", server.Addr)
+}
+
+func TestHTTPServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign})
+
+	server, err := NewServer(config.ServerConfig{Port: 8443}, WithTLS(TLSOptions{CertFile: "server.crt", KeyFile: "server.key"})).HTTPServer()
+	require.NoError(t, err)
+	require.NotNil(t, server.TLSConfig)
+	assert.Equal(t, tls.NoClientCert, server.TLSConfig.ClientAuth)
+	assert.Equal(t, uint16(tls.VersionTLS12), server.TLSConfig.MinVersion)
+
+	server, err = NewServer(config.ServerConfig{Port: 8443}, WithTLS(TLSOptions{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: ca.certFile})).HTTPServer()
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, server.TLSConfig.ClientAuth)
+	assert.NotNil(t, server.TLSConfig.ClientCAs)
+
+	_, err = NewServer(config.ServerConfig{Port: 8443}, WithTLS(TLSOptions{CertFile: "server.crt"})).HTTPServer()
+	assert.Error(t, err)
+
+	_, err = NewServer(config.ServerConfig{Port: 8443}, WithTLS(TLSOptions{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: filepath.Join(dir, "missing.pem")})).HTTPServer()
+	assert.Error(t, err)
+
+	_, err = NewServer(config.ServerConfig{Port: 8443}, WithTLS(TLSOptions{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: ca.keyFile})).HTTPServer()
+	assert.ErrorContains(t, err, "no certificates found")
+}
+
+func TestMutualTLSHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign})
+	serverCert := newTestCert(t, dir, "server", ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCert := newTestCert(t, dir, "client", ca, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	server, err := NewServer(config.ServerConfig{}, WithTLS(TLSOptions{
+		CertFile:     serverCert.certFile,
+		KeyFile:      serverCert.keyFile,
+		ClientCAFile: ca.certFile,
+	})).HTTPServer()
+	require.NoError(t, err)
+
+	keyPair, err := tls.LoadX509KeyPair(serverCert.certFile, serverCert.keyFile)
+	require.NoError(t, err)
+	ts := httptest.NewUnstartedServer(server.Handler)
+	ts.TLS = server.TLSConfig
+	ts.TLS.Certificates = []tls.Certificate{keyPair}
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	clientKeyPair, err := tls.LoadX509KeyPair(clientCert.certFile, clientCert.keyFile)
+	require.NoError(t, err)
+	resp, err := newClient(clientKeyPair).Get(ts.URL + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Without a client certificate the handshake is rejected
+	_, err = newClient().Get(ts.URL + "/health")
+	assert.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Default sizes of config values and descriptions, in bytes
+const (
+	DefaultMaxValueBytes       = 1 << 20  // Largest config value accepted
+	DefaultMaxDescriptionBytes = 4 << 10  // Largest description accepted
+	DefaultLargeValueBytes     = 64 << 10 // Values larger than this are left out of list results
+)
+
+// ValueLimits bounds the config values and descriptions accepted by writes and the values returned by
+// list operations. Zero fields use the defaults.
+type ValueLimits struct {
+	MaxValueBytes       int // Writes with a larger value are rejected with 413
+	MaxDescriptionBytes int // Writes with a larger description are rejected with 413
+	LargeValueBytes     int // List results return larger values as null with value_truncated set; single-key reads return them in full
+}
+
+// DefaultValueLimits returns the limits of 1 MiB values, 4 KiB descriptions and 64 KiB listed values
+func DefaultValueLimits() ValueLimits {
+	return ValueLimits{
+		MaxValueBytes:       DefaultMaxValueBytes,
+		MaxDescriptionBytes: DefaultMaxDescriptionBytes,
+		LargeValueBytes:     DefaultLargeValueBytes,
+	}
+}
+
+// maxValueBytes returns the largest value accepted
+func (l ValueLimits) maxValueBytes() int {
+	if l.MaxValueBytes <= 0 {
+		return DefaultMaxValueBytes
+	}
+	return l.MaxValueBytes
+}
+
+// maxDescriptionBytes returns the largest description accepted
+func (l ValueLimits) maxDescriptionBytes() int {
+	if l.MaxDescriptionBytes <= 0 {
+		return DefaultMaxDescriptionBytes
+	}
+	return l.MaxDescriptionBytes
+}
+
+// largeValueBytes returns the size above which list results leave values out
+func (l ValueLimits) largeValueBytes() int {
+	if l.LargeValueBytes <= 0 {
+		return DefaultLargeValueBytes
+	}
+	return l.LargeValueBytes
+}
+
+// valueSize returns the size in bytes of a config value as stored: strings and bytes as they are, other
+// values as JSON
+func valueSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return len(encoded)
+}
+
+// oversizedField is a value or description of a batch item over its limit
+type oversizedField struct {
+	Index int    `json:"index"` // Position of the item in the batch, in key order for a configs map
+	Key   string `json:"key"`
+	Field string `json:"field"` // value or description
+	Limit int    `json:"limit"`
+	Size  int    `json:"size"`
+}
+
+// oversized returns the fields of a config over their limits
+func (l ValueLimits) oversized(index int, key string, value interface{}, description string) []oversizedField {
+	var fields []oversizedField
+	if size, limit := valueSize(value), l.maxValueBytes(); size > limit {
+		fields = append(fields, oversizedField{Index: index, Key: key, Field: "value", Limit: limit, Size: size})
+	}
+	if size, limit := len(description), l.maxDescriptionBytes(); size > limit {
+		fields = append(fields, oversizedField{Index: index, Key: key, Field: "description", Limit: limit, Size: size})
+	}
+	return fields
+}
+
+// checkConfig returns a 413 error when the value or description of the config under key is over its limit
+func (l ValueLimits) checkConfig(key string, value interface{}, description string) error {
+	fields := l.oversized(0, key, value, description)
+	if len(fields) == 0 {
+		return nil
+	}
+	f := fields[0]
+	return &apiError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    ErrorCodePayloadTooLarge,
+		Message: fmt.Sprintf("config %s of %q is %d bytes, over the limit of %d bytes", f.Field, key, f.Size, f.Limit),
+		Details: map[string]interface{}{"key": key, "field": f.Field, "limit": f.Limit, "size": f.Size},
+	}
+}
+
+// checkRequest checks the value and description of req and of every item of a batch, reporting all the
+// oversized fields of a batch at once
+func (l ValueLimits) checkRequest(req *AllConfigOperationRequest) error {
+	if err := l.checkConfig(req.Key, req.Value, req.Description); err != nil {
+		err.(*apiError).Details["operation"] = req.Operation
+		return err
+	}
+
+	var fields []oversizedField
+	for i, item := range req.ConfigItems {
+		fields = append(fields, l.oversized(i, item.Key, item.Value, item.Description)...)
+	}
+	for i, key := range sortedConfigKeys(req.Configs) {
+		fields = append(fields, l.oversized(i, key, req.Configs[key], "")...)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	described := make([]string, len(fields))
+	for i, f := range fields {
+		described[i] = fmt.Sprintf("%s of %q is %d bytes, over %d", f.Field, f.Key, f.Size, f.Limit)
+	}
+	return &apiError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    ErrorCodePayloadTooLarge,
+		Message: fmt.Sprintf("%d config fields are over their size limits: %s", len(fields), strings.Join(described, "; ")),
+		Details: map[string]interface{}{"operation": req.Operation, "oversized": fields},
+	}
+}
+
+// listedValueColumns are the value columns list results leave out when they are large
+var listedValueColumns = []string{"config_value", "previous_value", "current_value"}
+
+// valueSizeColumn returns the name list results report the size of a value column under: value_size for
+// config_value and previous_value_size for previous_value
+func valueSizeColumn(column string) string {
+	return strings.TrimPrefix(column, "config_") + "_size"
+}
+
+// valueTruncatedColumn returns the name of the flag list results set when they leave a value column out
+func valueTruncatedColumn(column string) string {
+	return strings.TrimPrefix(column, "config_") + "_truncated"
+}
+
+// listedValue returns the select expression of a value column in list queries: NULL when the value is
+// over the large value threshold, so that the database never sends it, followed by its size in bytes
+func (a *API) listedValue(column string) string {
+	return a.listedValueOf(column, column)
+}
+
+// listedValueOf returns the select expression of listedValue for expr, a column qualified by its table,
+// listed as column
+func (a *API) listedValueOf(expr, column string) string {
+	return fmt.Sprintf("CASE WHEN OCTET_LENGTH(%[1]s) > %[2]d THEN NULL ELSE %[1]s END AS %[3]s, OCTET_LENGTH(%[1]s) AS %[4]s",
+		expr, a.values.largeValueBytes(), column, valueSizeColumn(column))
+}
+
+// markLargeValues sets the size and truncated flag of the value columns of each row of a list result,
+// leaving out the values over the large value threshold. SQL rows come with the sizes from listedValue;
+// MongoDB documents are measured here.
+func (a *API) markLargeValues(result interface{}, err error) (interface{}, error) {
+	rows, ok := result.([]map[string]interface{})
+	if err != nil || !ok {
+		return result, err
+	}
+	threshold := int64(a.values.largeValueBytes())
+	for _, row := range rows {
+		for _, column := range listedValueColumns {
+			value, hasValue := row[column]
+			size, hasSize := row[valueSizeColumn(column)]
+			if !hasValue && !hasSize {
+				continue
+			}
+			var n int64
+			if hasSize {
+				n = sizeOf(size)
+			} else if value != nil {
+				n = int64(valueSize(value))
+				row[valueSizeColumn(column)] = n
+			}
+			truncated := n > threshold
+			if truncated {
+				row[column] = nil
+			}
+			row[valueTruncatedColumn(column)] = truncated
+		}
+	}
+	return rows, nil
+}
+
+// sizeOf returns a size read from a database column
+func sizeOf(v interface{}) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
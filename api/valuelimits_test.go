@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// requireTooLarge asserts that err is a 413 for the field of the config under key
+func requireTooLarge(t *testing.T, err error, field string, limit, size int) {
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, apiErr.Status)
+	assert.Equal(t, ErrorCodePayloadTooLarge, apiErr.Code)
+	assert.Equal(t, field, apiErr.Details["field"])
+	assert.Equal(t, limit, apiErr.Details["limit"])
+	assert.Equal(t, size, apiErr.Details["size"])
+}
+
+func TestValueLimitBoundaries(t *testing.T) {
+	limits := ValueLimits{MaxValueBytes: 10, MaxDescriptionBytes: 5}
+
+	assert.NoError(t, limits.checkConfig("k", strings.Repeat("v", 10), strings.Repeat("d", 5)))
+	requireTooLarge(t, limits.checkConfig("k", strings.Repeat("v", 11), ""), "value", 10, 11)
+	requireTooLarge(t, limits.checkConfig("k", "", strings.Repeat("d", 6)), "description", 5, 6)
+
+	// Values that are not strings are measured as JSON
+	assert.NoError(t, limits.checkConfig("k", map[string]interface{}{"a": 123}, "")) // {"a":123}
+	requireTooLarge(t, limits.checkConfig("k", []interface{}{"abcd", "ef"}, ""), "value", 10, 13)
+	// Sizes are in bytes, not characters
+	requireTooLarge(t, limits.checkConfig("k", strings.Repeat("ä", 6), ""), "value", 10, 12)
+
+	// Zero limits are the defaults
+	assert.NoError(t, ValueLimits{}.checkConfig("k", strings.Repeat("v", DefaultMaxValueBytes), ""))
+	requireTooLarge(t, ValueLimits{}.checkConfig("k", strings.Repeat("v", DefaultMaxValueBytes+1), ""), "value", DefaultMaxValueBytes, DefaultMaxValueBytes+1)
+}
+
+func TestCheckAllConfigRequestValues(t *testing.T) {
+	api := NewAPI()
+	api.values = ValueLimits{MaxValueBytes: 4, MaxDescriptionBytes: 4}
+
+	_, err := api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "direct_update", Key: "k", Value: "12345"}, "mysql")
+	requireTooLarge(t, err, "value", 4, 5)
+	_, err = api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "submit_create", Key: "k", Value: "1", Description: "12345", MakerID: "bob"}, "mysql")
+	requireTooLarge(t, err, "description", 4, 5)
+
+	// Reads carry no values to check
+	_, err = api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "read", Key: "k", Value: "12345"}, "mysql")
+	assert.NoError(t, err)
+
+	// A batch reports every oversized field
+	items := []ConfigItem{{Key: "a", Value: "1234"}, {Key: "b", Value: "12345", Description: "12345"}, {Key: "c", Value: "1"}}
+	_, err = api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "create_batch", ConfigItems: items}, "mysql")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, apiErr.Status)
+	assert.Equal(t, []oversizedField{
+		{Index: 1, Key: "b", Field: "value", Limit: 4, Size: 5},
+		{Index: 1, Key: "b", Field: "description", Limit: 4, Size: 5},
+	}, apiErr.Details["oversized"])
+
+	_, err = api.checkAllConfigRequest(&AllConfigOperationRequest{Operation: "set_multiple", Configs: map[string]interface{}{"b": "12345", "a": "123456"}}, "mysql")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, []oversizedField{
+		{Index: 0, Key: "a", Field: "value", Limit: 4, Size: 6},
+		{Index: 1, Key: "b", Field: "value", Limit: 4, Size: 5},
+	}, apiErr.Details["oversized"])
+}
+
+func TestPutConfigHandlerTooLarge(t *testing.T) {
+	conn := newProfileConnector("mysql")
+	api := NewAPI()
+	api.values.MaxValueBytes = 8
+	api.addProfile(ConnectionProfile{Name: "primary", Connector: conn, Database: "app"})
+	api.defaultProfile = "primary"
+
+	rr := serveConfigs(SetupRoutes(api), http.MethodPut, "/v1/configs/feature.flag", ConfigWriteRequest{Value: "123456789"},
+		map[string]string{UserIDHeader: "alice", UserRoleHeader: AdminRole})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"error_code":"PAYLOAD_TOO_LARGE"`)
+	assert.Contains(t, rr.Body.String(), "is 9 bytes, over the limit of 8 bytes")
+	conn.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything)
+	assertNothingWritten(t, conn)
+}
+
+func TestListLeavesOutLargeValues(t *testing.T) {
+	ctx := context.Background()
+	api := NewAPI()
+	api.values.LargeValueBytes = 4
+
+	t.Run("sql", func(t *testing.T) {
+		conn := newServiceConnector("postgresql")
+		conn.On("Query", mock.Anything, queryContaining("CASE WHEN OCTET_LENGTH(config_value) > 4 THEN NULL ELSE config_value END AS config_value, OCTET_LENGTH(config_value) AS value_size"), mock.Anything).
+			Return(newMockRows(t, []string{"config_key", "config_value", "value_size"},
+				[]driver.Value{"small", "1234", int64(4)},
+				[]driver.Value{"large", nil, int64(5)},
+				[]driver.Value{"unset", nil, nil},
+			), nil).Once()
+
+		result, err := api.readAllApprovedConfigs(ctx, conn, "allconfig", 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{
+			{"config_key": "small", "config_value": "1234", "value_size": int64(4), "value_truncated": false},
+			{"config_key": "large", "config_value": nil, "value_size": int64(5), "value_truncated": true},
+			{"config_key": "unset", "config_value": nil, "value_size": nil, "value_truncated": false},
+		}, result)
+	})
+
+	t.Run("approval history", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, queryContaining("OCTET_LENGTH(previous_value) AS previous_value_size"), mock.Anything).
+			Return(newMockRows(t, []string{"request_id", "config_value", "value_size", "previous_value", "previous_value_size"},
+				[]driver.Value{"r1", "1", int64(1), nil, int64(10)},
+			), nil).Once()
+
+		result, err := api.getApprovalHistory(ctx, conn, "allconfig", 0, 0)
+		require.NoError(t, err)
+		row := result.([]map[string]interface{})[0]
+		assert.Equal(t, false, row["value_truncated"])
+		assert.Equal(t, true, row["previous_value_truncated"])
+	})
+
+	t.Run("mongodb", func(t *testing.T) {
+		conn := newServiceConnector("mongodb")
+		conn.On("Execute", mock.Anything, "find", mock.Anything).Return([]map[string]interface{}{
+			{"config_key": "small", "config_value": "1234"},
+			{"config_key": "large", "config_value": map[string]interface{}{"a": 1}},
+		}, nil)
+
+		result, err := api.readAllApprovedConfigs(ctx, conn, "allconfig", 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{
+			{"config_key": "small", "config_value": "1234", "value_size": int64(4), "value_truncated": false},
+			{"config_key": "large", "config_value": nil, "value_size": int64(7), "value_truncated": true},
+		}, result)
+	})
+
+	t.Run("single-key reads return the full value", func(t *testing.T) {
+		conn := newServiceConnector("mysql")
+		conn.On("Query", mock.Anything, mock.MatchedBy(func(query string) bool { return !strings.Contains(query, "OCTET_LENGTH") }), mock.Anything).
+			Return(newMockRows(t, []string{"config_key", "config_value"}, []driver.Value{"large", "123456789"}), nil).Once()
+
+		result, err := api.readApprovedConfig(ctx, conn, "allconfig", "large")
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"config_key": "large", "config_value": "123456789"}}, result)
+	})
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constraints of value rules, named by the validation errors of values breaking them
+const (
+	ValueRuleSchema  = "schema"  // Validates against Schema
+	ValueRulePattern = "pattern" // Matches Pattern
+	ValueRuleEnum    = "enum"    // Is one of Enum
+	ValueRuleMin     = "min"     // Is a number of at least Min
+	ValueRuleMax     = "max"     // Is a number of at most Max
+)
+
+// maxFragmentLength bounds the offending fragment of a value quoted by a validation error, in bytes
+const maxFragmentLength = 64
+
+// ValueRule constrains the values of the config keys matching KeyPattern; every constraint set applies.
+// Values given as JSON text are decoded before they are checked against Schema, and values that are not
+// text are encoded as JSON before they are checked against Pattern and Enum.
+type ValueRule struct {
+	KeyPattern *regexp.Regexp // Matched against config keys; anchor it with ^ to match a key prefix
+	Schema     *JSONSchema
+	Pattern    *regexp.Regexp // Must match the whole value
+	Enum       []string
+	Min        *float64
+	Max        *float64
+}
+
+// ValueRules are the rules the values written to allconfig tables must satisfy. Writes, direct or
+// submitted for approval, are checked against the rules of their keys, and approvals check the values
+// again in case the rules changed since they were submitted.
+type ValueRules []ValueRule
+
+// valueViolation is a constraint of a value rule broken by the value of a config
+type valueViolation struct {
+	Index      int    `json:"index"` // Position of the item in the batch, in key order for a configs map
+	Key        string `json:"key"`
+	KeyPattern string `json:"key_pattern"` // Key pattern of the broken rule
+	Rule       string `json:"rule"`
+	Path       string `json:"path,omitempty"` // JSON Pointer to the fragment breaking a schema
+	Fragment   string `json:"fragment"`       // The offending value or part of it, shortened when long
+	Message    string `json:"message"`
+}
+
+// ValueRuleInfo describes a value rule as listed by GET /v1/allconfig/rules
+type ValueRuleInfo struct {
+	KeyPattern string          `json:"key_pattern"`
+	Schema     json.RawMessage `json:"schema,omitempty"`
+	Pattern    string          `json:"pattern,omitempty"`
+	Enum       []string        `json:"enum,omitempty"`
+	Min        *float64        `json:"min,omitempty"`
+	Max        *float64        `json:"max,omitempty"`
+}
+
+// info describes the rule
+func (r ValueRule) info() ValueRuleInfo {
+	info := ValueRuleInfo{KeyPattern: r.KeyPattern.String(), Enum: r.Enum, Min: r.Min, Max: r.Max}
+	if r.Schema != nil {
+		info.Schema = r.Schema.Source
+	}
+	if r.Pattern != nil {
+		info.Pattern = r.Pattern.String()
+	}
+	return info
+}
+
+// valueJSON returns a config value decoded from JSON: JSON text decoded, other text as a string, and other
+// values as they encode
+func valueJSON(value interface{}) interface{} {
+	var decoded interface{}
+	if json.Unmarshal([]byte(valueText(value)), &decoded) == nil {
+		return decoded
+	}
+	return valueText(value)
+}
+
+// fragment returns text shortened to the length quoted by validation errors
+func fragment(text string) string {
+	if len(text) <= maxFragmentLength {
+		return text
+	}
+	cut := maxFragmentLength
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
+}
+
+// violations returns the constraints of the rule broken by value
+func (r ValueRule) violations(index int, key string, value interface{}) []valueViolation {
+	text := valueText(value)
+	var found []valueViolation
+	broken := func(rule, path, offending, message string) {
+		found = append(found, valueViolation{
+			Index: index, Key: key, KeyPattern: r.KeyPattern.String(), Rule: rule, Path: path, Fragment: fragment(offending), Message: message,
+		})
+	}
+
+	if r.Schema != nil {
+		if v := r.Schema.validate(valueJSON(value), ""); v != nil {
+			offending := valueText(v.Value)
+			if v.Path == "" {
+				offending = text
+			}
+			broken(ValueRuleSchema, v.Path, offending, strings.TrimSpace(v.Path+" "+v.Message))
+		}
+	}
+	if r.Pattern != nil && !r.Pattern.MatchString(text) {
+		broken(ValueRulePattern, "", text, "must match "+r.Pattern.String())
+	}
+	if len(r.Enum) > 0 && !slices.Contains(r.Enum, text) {
+		broken(ValueRuleEnum, "", text, "must be one of "+strings.Join(r.Enum, ", "))
+	}
+	if r.Min != nil || r.Max != nil {
+		n, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		switch {
+		case err != nil && r.Min != nil:
+			broken(ValueRuleMin, "", text, "must be a number")
+		case err != nil:
+			broken(ValueRuleMax, "", text, "must be a number")
+		case r.Min != nil && n < *r.Min:
+			broken(ValueRuleMin, "", text, fmt.Sprintf("must be at least %v", *r.Min))
+		case r.Max != nil && n > *r.Max:
+			broken(ValueRuleMax, "", text, fmt.Sprintf("must be at most %v", *r.Max))
+		}
+	}
+	return found
+}
+
+// violations returns the constraints broken by the value of the config under key. Null values, which
+// leave a config without a value, are not checked.
+func (rules ValueRules) violations(index int, key string, value interface{}) []valueViolation {
+	if value == nil {
+		return nil
+	}
+	var found []valueViolation
+	for _, rule := range rules {
+		if rule.KeyPattern.MatchString(key) {
+			found = append(found, rule.violations(index, key, value)...)
+		}
+	}
+	return found
+}
+
+// checkConfig returns a 400 error naming the first rule the value of the config under key breaks
+func (rules ValueRules) checkConfig(key string, value interface{}) error {
+	found := rules.violations(0, key, value)
+	if len(found) == 0 {
+		return nil
+	}
+	v := found[0]
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: fmt.Sprintf("config value of %q breaks its %s rule: %s (got %s)", key, v.Rule, v.Message, v.Fragment),
+		Details: map[string]interface{}{"key": key, "rule": v.Rule, "key_pattern": v.KeyPattern, "path": v.Path, "fragment": v.Fragment},
+	}
+}
+
+// checkRequest checks the value of req and of every item of a batch against the rules of their keys,
+// reporting all the values of a batch breaking them at once
+func (rules ValueRules) checkRequest(req *AllConfigOperationRequest) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	if err := rules.checkConfig(req.Key, req.Value); err != nil {
+		err.(*apiError).Details["operation"] = req.Operation
+		return err
+	}
+
+	var found []valueViolation
+	for i, item := range req.ConfigItems {
+		found = append(found, rules.violations(i, item.Key, item.Value)...)
+	}
+	for i, key := range sortedConfigKeys(req.Configs) {
+		found = append(found, rules.violations(i, key, req.Configs[key])...)
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	described := make([]string, len(found))
+	for i, v := range found {
+		described[i] = fmt.Sprintf("%q breaks its %s rule", v.Key, v.Rule)
+	}
+	noun := "values break"
+	if len(found) == 1 {
+		noun = "value breaks"
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    ErrorCodeValidation,
+		Message: fmt.Sprintf("%d config %s the value rules: %s", len(found), noun, strings.Join(described, ", ")),
+		Details: map[string]interface{}{"operation": req.Operation, "invalid_values": found},
+	}
+}
+
+// ListValueRulesHandler lists the value rules config writes are checked against
+func (a *API) ListValueRulesHandler(w http.ResponseWriter, r *http.Request) {
+	infos := make([]ValueRuleInfo, len(a.rules))
+	for i, rule := range a.rules {
+		infos[i] = rule.info()
+	}
+	a.sendSuccess(w, infos, fmt.Sprintf("%d value rules active", len(infos)))
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"db-connectors/config"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// testValueRules returns a rule of each kind: a schema for payments, a pattern and an enum for modes and a
+// range for limits
+func testValueRules(t *testing.T) ValueRules {
+	schema, err := CompileJSONSchema(`{"type": "object", "required": ["currency"], "properties": {"retries": {"maximum": 5}}}`)
+	require.NoError(t, err)
+	min, max := 1.0, 100.0
+	return ValueRules{
+		{KeyPattern: regexp.MustCompile(`^payments\.`), Schema: schema},
+		{KeyPattern: regexp.MustCompile(`mode$`), Pattern: regexp.MustCompile(`^[a-z]+$`), Enum: []string{"on", "off"}},
+		{KeyPattern: regexp.MustCompile(`^limits\.`), Min: &min, Max: &max},
+	}
+}
+
+func TestValueRuleViolations(t *testing.T) {
+	rules := testValueRules(t)
+	for _, value := range []interface{}{
+		`{"currency": "EUR", "retries": 3}`,
+		map[string]interface{}{"currency": "EUR"},
+	} {
+		assert.Empty(t, rules.violations(0, "payments.retry", value))
+	}
+	assert.Empty(t, rules.violations(0, "app.mode", "on"))
+	assert.Empty(t, rules.violations(0, "limits.rps", "50"))
+	assert.Empty(t, rules.violations(0, "limits.rps", 100.0))
+	assert.Empty(t, rules.violations(0, "other", "anything"))
+	assert.Empty(t, rules.violations(0, "limits.rps", nil), "null values are not checked")
+
+	tests := []struct {
+		key   string
+		value interface{}
+		want  []valueViolation
+	}{
+		{"payments.retry", `{"retries": 3}`, []valueViolation{{KeyPattern: `^payments\.`, Rule: ValueRuleSchema, Fragment: `{"retries": 3}`,
+			Message: `is missing the required property "currency"`}}},
+		{"payments.retry", `{"currency": "EUR", "retries": 9}`, []valueViolation{{KeyPattern: `^payments\.`, Rule: ValueRuleSchema, Path: "/retries",
+			Fragment: "9", Message: "/retries must be at most 5"}}},
+		{"payments.retry", "not json", []valueViolation{{KeyPattern: `^payments\.`, Rule: ValueRuleSchema, Fragment: "not json",
+			Message: "must be of type object, got string"}}},
+		{"app.mode", "ON", []valueViolation{
+			{KeyPattern: "mode$", Rule: ValueRulePattern, Fragment: "ON", Message: "must match ^[a-z]+$"},
+			{KeyPattern: "mode$", Rule: ValueRuleEnum, Fragment: "ON", Message: "must be one of on, off"},
+		}},
+		{"limits.rps", "0", []valueViolation{{KeyPattern: `^limits\.`, Rule: ValueRuleMin, Fragment: "0", Message: "must be at least 1"}}},
+		{"limits.rps", 250, []valueViolation{{KeyPattern: `^limits\.`, Rule: ValueRuleMax, Fragment: "250", Message: "must be at most 100"}}},
+		{"limits.rps", "fast", []valueViolation{{KeyPattern: `^limits\.`, Rule: ValueRuleMin, Fragment: "fast", Message: "must be a number"}}},
+	}
+	for _, tt := range tests {
+		for i := range tt.want {
+			tt.want[i].Key = tt.key
+		}
+		assert.Equal(t, tt.want, rules.violations(0, tt.key, tt.value), "%s = %v", tt.key, tt.value)
+	}
+
+	// Long values are quoted shortened
+	long := `{"retries": "` + strings.Repeat("é", 100) + `"}`
+	found := rules.violations(0, "payments.retry", long)
+	require.Len(t, found, 1)
+	assert.True(t, strings.HasSuffix(found[0].Fragment, "..."))
+	assert.LessOrEqual(t, len(found[0].Fragment), maxFragmentLength+3)
+}
+
+func TestValueRulesCheckRequest(t *testing.T) {
+	rules := testValueRules(t)
+	assert.NoError(t, ValueRules(nil).checkRequest(&AllConfigOperationRequest{Operation: "direct_create", Key: "limits.rps", Value: "0"}))
+
+	err := rules.checkRequest(&AllConfigOperationRequest{Operation: "direct_create", Key: "limits.rps", Value: "0"})
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeValidation, apiErr.Code)
+	assert.Equal(t, `config value of "limits.rps" breaks its min rule: must be at least 1 (got 0)`, apiErr.Message)
+	assert.Equal(t, map[string]interface{}{
+		"operation": "direct_create", "key": "limits.rps", "rule": ValueRuleMin, "key_pattern": `^limits\.`, "path": "", "fragment": "0",
+	}, apiErr.Details)
+
+	err = rules.checkRequest(&AllConfigOperationRequest{Operation: "direct_create_batch", ConfigItems: []ConfigItem{
+		{Key: "limits.rps", Value: "10"},
+		{Key: "app.mode", Value: "maybe"},
+		{Key: "limits.burst", Value: "1000"},
+	}})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, `2 config values break the value rules: "app.mode" breaks its enum rule, "limits.burst" breaks its max rule`, apiErr.Message)
+	violations := apiErr.Details["invalid_values"].([]valueViolation)
+	require.Len(t, violations, 2)
+	assert.Equal(t, 1, violations[0].Index)
+	assert.Equal(t, 2, violations[1].Index)
+}
+
+func TestValueRulesEnforced(t *testing.T) {
+	api := NewAPI()
+	api.rules = testValueRules(t)
+	ctx := context.Background()
+	run := func(m *connectortest.MockDBConnector, req AllConfigOperationRequest) error {
+		req.TableName = "allconfig"
+		req.LegacyMode = boolPtr(false)
+		_, err := api.executeAllConfigOperation(ctx, m, &req)
+		return err
+	}
+	mongo := func() *connectortest.MockDBConnector {
+		m := new(connectortest.MockDBConnector)
+		m.On("GetType").Return("mongodb")
+		return m
+	}
+
+	// Invalid values are rejected before anything is written
+	for _, req := range []AllConfigOperationRequest{
+		{Operation: "direct_create", Key: "limits.rps", Value: "500"},
+		{Operation: "direct_update", Key: "app.mode", Value: "auto"},
+		{Operation: "submit_create", Key: "payments.retry", Value: `{"retries": 1}`, MakerID: "bob"},
+		{Operation: "submit_update", Key: "limits.rps", Value: "0", MakerID: "bob"},
+	} {
+		m := mongo()
+		var apiErr *apiError
+		require.ErrorAs(t, run(m, req), &apiErr, req.Operation)
+		assert.Equal(t, req.Key, apiErr.Details["key"])
+		m.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+	}
+
+	m := mongo()
+	m.On("Execute", mock.Anything, "insert", mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["collection"] == "allconfig_approval_requests"
+	})).Return(map[string]interface{}{"inserted_id": "x"}, nil).Once()
+	require.NoError(t, run(m, AllConfigOperationRequest{Operation: "submit_create", Key: "limits.rps", Value: "50", MakerID: "bob"}))
+	m.AssertExpectations(t)
+
+	// A request submitted before its rule was tightened is checked again on approval
+	m = mongo()
+	m.On("Execute", mock.Anything, "findOne", mock.Anything).Return(map[string]interface{}{
+		"request_id": "r1", "config_key": "limits.rps", "config_value": "50", "operation": "update", "maker_id": "bob",
+	}, nil).Once()
+	max := 10.0
+	api.rules[2].Max = &max
+	err := run(m, AllConfigOperationRequest{Operation: "approve_request", RequestID: "r1", CheckerID: "carol"})
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, `failed to apply approved change: config value of "limits.rps" breaks its max rule: must be at most 10 (got 50)`, err.Error())
+	m.AssertExpectations(t)
+}
+
+func TestListValueRules(t *testing.T) {
+	server := NewServer(config.ServerConfig{}, WithValueRules(testValueRules(t)))
+	rr := serveConfigs(server.routes(), http.MethodGet, "/v1/allconfig/rules", nil, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data []ValueRuleInfo `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Data, 3)
+	assert.Equal(t, `^payments\.`, response.Data[0].KeyPattern)
+	assert.JSONEq(t, `{"type": "object", "required": ["currency"], "properties": {"retries": {"maximum": 5}}}`, string(response.Data[0].Schema))
+	assert.Equal(t, ValueRuleInfo{KeyPattern: "mode$", Pattern: "^[a-z]+$", Enum: []string{"on", "off"}}, response.Data[1])
+	assert.Equal(t, 100.0, *response.Data[2].Max)
+}
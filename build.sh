@@ -5,6 +5,9 @@ set -e
 
 APP_NAME="db-connectors"
 VERSION="1.0.0"
+COMMIT=$(git rev-parse --short HEAD 2>/dev/null || echo unknown)
+BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+LDFLAGS="-s -w -X main.Version=${VERSION} -X main.Commit=${COMMIT} -X main.BuildDate=${BUILD_DATE}"
 
 echo "🔨 Database Connectors - Quick Build"
 echo "===================================="
@@ -30,6 +33,9 @@ rm -f ${APP_NAME} ${APP_NAME}-*
 echo "📦 Updating dependencies..."
 go mod tidy
 
+# Embed Swagger UI so /docs works without reaching unpkg.com
+bash fetch_swagger_ui.sh || echo "⚠️  Swagger UI not fetched, /docs will load it from unpkg.com"
+
 case $BUILD_TYPE in
     "local")
         echo "🔨 Building for local development..."
@@ -41,7 +47,7 @@ case $BUILD_TYPE in
     "production")
         echo "🔨 Building for production (Linux)..."
         CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build \
-            -ldflags="-s -w -X main.Version=${VERSION}" \
+            -ldflags="${LDFLAGS}" \
             -o ${APP_NAME}-linux cmd/main.go
         echo "✅ Production build complete: ./${APP_NAME}-linux"
         echo "📤 Upload to server and run: ./${APP_NAME}-linux"
@@ -51,7 +57,7 @@ case $BUILD_TYPE in
         echo "🐳 Building Docker image..."
         # First build Linux binary
         CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build \
-            -ldflags="-s -w -X main.Version=${VERSION}" \
+            -ldflags="${LDFLAGS}" \
             -o ${APP_NAME} cmd/main.go
             
         # Create simple Dockerfile
@@ -66,6 +72,7 @@ COPY README.md .
 COPY config.yaml ./config.example.yaml
 RUN chmod +x ./db-connectors
 EXPOSE 8080
+HEALTHCHECK CMD ["./db-connectors", "healthcheck"]
 CMD ["./db-connectors"]
 EOF
         
@@ -85,19 +92,19 @@ EOF
         # Linux build
         echo "  🐧 Linux..."
         CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build \
-            -ldflags="-s -w -X main.Version=${VERSION}" \
+            -ldflags="${LDFLAGS}" \
             -o ${APP_NAME}-linux cmd/main.go
             
         # Windows build
         echo "  🪟 Windows..."
         CGO_ENABLED=0 GOOS=windows GOARCH=amd64 go build \
-            -ldflags="-s -w -X main.Version=${VERSION}" \
+            -ldflags="${LDFLAGS}" \
             -o ${APP_NAME}-windows.exe cmd/main.go
             
         # macOS build
         echo "  🍎 macOS..."
         CGO_ENABLED=0 GOOS=darwin GOARCH=amd64 go build \
-            -ldflags="-s -w -X main.Version=${VERSION}" \
+            -ldflags="${LDFLAGS}" \
             -o ${APP_NAME}-macos cmd/main.go
             
         echo "✅ All builds complete:"
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"db-connectors/allconfig"
+	"db-connectors/api"
+	"db-connectors/connectors"
+	"db-connectors/logging"
+)
+
+// Actions of the allconfig subcommand
+var allConfigActions = []string{"get", "set", "submit", "approve", "reject", "pending", "history"}
+
+// allConfigOptions are the action and flags of the allconfig subcommand
+type allConfigOptions struct {
+	action        string
+	configPath    string
+	allowWarnings bool
+	conn          string
+	table         string
+	key           string
+	value         string
+	description   string
+	tags          string
+	deleteKey     bool
+	makerID       string
+	checkerID     string
+	requestID     string
+	comment       string
+	limit         int
+	offset        int
+	jsonOutput    bool
+	timeout       time.Duration
+}
+
+// parseAllConfigFlags parses the action and flags following the allconfig subcommand and
+// checks that the flags the action needs are set
+func parseAllConfigFlags(args []string, stderr io.Writer) (*allConfigOptions, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil, fmt.Errorf("an action is required: %s", strings.Join(allConfigActions, ", "))
+	}
+	opts := &allConfigOptions{action: args[0]}
+	valid := false
+	for _, action := range allConfigActions {
+		valid = valid || opts.action == action
+	}
+	if !valid {
+		return nil, fmt.Errorf("unknown action %q; actions: %s", opts.action, strings.Join(allConfigActions, ", "))
+	}
+
+	flags := flag.NewFlagSet("allconfig "+opts.action, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.configPath, "config", "", "Path to the configuration file; searched for like in API mode when empty")
+	flags.BoolVar(&opts.allowWarnings, "allow-config-warnings", false, "Use the configuration despite warnings such as empty database passwords")
+	flags.StringVar(&opts.conn, "conn", "", "Named connection: a databases entry or connection profile")
+	flags.StringVar(&opts.table, "table", "", "Allconfig table; defaults to the connection's table_name, then allconfig.table")
+	flags.StringVar(&opts.key, "key", "", "Config key")
+	flags.StringVar(&opts.value, "value", "", "Config value, parsed as JSON when valid and stored as a string otherwise")
+	flags.StringVar(&opts.description, "description", "", "Config or change description")
+	flags.StringVar(&opts.tags, "tags", "", "set and submit: comma-separated config tags; an update keeps the stored tags when empty")
+	flags.BoolVar(&opts.deleteKey, "delete", false, "set and submit: delete the key instead of setting it")
+	flags.StringVar(&opts.makerID, "maker", "", "Maker ID recorded with the change; required by submit")
+	flags.StringVar(&opts.checkerID, "checker", "", "Checker ID deciding the request")
+	flags.StringVar(&opts.requestID, "request", "", "Approval request ID")
+	flags.StringVar(&opts.comment, "comment", "", "Checker comment")
+	flags.IntVar(&opts.limit, "limit", 50, "pending and history: maximum number of requests")
+	flags.IntVar(&opts.offset, "offset", 0, "pending and history: number of requests to skip")
+	flags.BoolVar(&opts.jsonOutput, "json", false, "Print the result as JSON")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "Timeout for connecting and running the action")
+	if err := flags.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	missing := ""
+	need := func(name, value string) {
+		if missing == "" && value == "" {
+			missing = name
+		}
+	}
+	need("conn", opts.conn)
+	switch opts.action {
+	case "get":
+		need("key", opts.key)
+	case "set", "submit":
+		need("key", opts.key)
+		if !opts.deleteKey {
+			need("value", opts.value)
+		}
+		if opts.action == "submit" {
+			need("maker", opts.makerID)
+		}
+	case "approve", "reject":
+		need("request", opts.requestID)
+		need("checker", opts.checkerID)
+	}
+	if missing != "" {
+		return nil, fmt.Errorf("-%s is required for %s", missing, opts.action)
+	}
+	if opts.limit <= 0 || opts.offset < 0 {
+		return nil, errors.New("-limit must be positive and -offset must not be negative")
+	}
+	return opts, nil
+}
+
+// configValue returns -value decoded from JSON, or as a string when it is not valid JSON
+func (o *allConfigOptions) configValue() interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(o.value), &value); err != nil {
+		return o.value
+	}
+	return value
+}
+
+// configTags returns the tags listed by -tags, or nil when it is empty
+func (o *allConfigOptions) configTags() []string {
+	if o.tags == "" {
+		return nil
+	}
+	tags := strings.Split(o.tags, ",")
+	for i, tag := range tags {
+		tags[i] = strings.TrimSpace(tag)
+	}
+	return tags
+}
+
+// runAllConfig runs the allconfig subcommand, writing the result to stdout and diagnostics to
+// stderr, and returns the process exit code
+func runAllConfig(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseAllConfigFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitSuccess
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "allconfig:", err)
+		return exitUsage
+	}
+
+	cfg, profile, err := loadNamedConnection(opts.configPath, opts.allowWarnings, opts.conn)
+	if err != nil {
+		fmt.Fprintln(stderr, "allconfig:", err)
+		return exitUsage
+	}
+	connConfig := profile.ConnectionConfig
+	logger := logging.New(logging.Options{Level: "warn", Output: stderr})
+	connector, err := connectors.New(profile.Type, &connConfig, connectors.WithLogger(logger))
+	if err != nil {
+		fmt.Fprintln(stderr, "allconfig:", err)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	if err := connector.Connect(ctx); err != nil {
+		fmt.Fprintln(stderr, "allconfig: connection failed:", err)
+		return exitConnection
+	}
+	defer connector.Close(ctx)
+
+	table := opts.table
+	if table == "" {
+		table = profile.TableName
+	}
+	server := api.NewServer(cfg.Server, api.WithAllConfigTables(cfg.AllConfig.Table, cfg.AllConfig.ApprovalSuffix), api.WithKeyPolicy(keyPolicy(cfg.AllConfig)),
+		api.WithValueLimits(valueLimits(cfg.AllConfig)))
+	service := server.API().ConfigService()
+	table = server.API().ConfigTable(table)
+
+	message, result, err := runAllConfigAction(ctx, service, connector, table, opts)
+	if errors.Is(err, allconfig.ErrConfigNotFound) || errors.Is(err, allconfig.ErrRequestNotFound) {
+		fmt.Fprintln(stderr, "allconfig:", err)
+		return exitNoRows
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "allconfig: %s failed: %v\n", opts.action, err)
+		return exitFailed
+	}
+	if err := writeAllConfigResult(stdout, message, result, opts.jsonOutput); err != nil {
+		fmt.Fprintln(stderr, "allconfig: failed to write result:", err)
+		return exitFailed
+	}
+	return exitSuccess
+}
+
+// runAllConfigAction runs the action on table through the service the config resource handlers use and
+// returns a summary of what was done with the result
+func runAllConfigAction(ctx context.Context, service *allconfig.ConfigService, connector connectors.DBConnector, table string, opts *allConfigOptions) (string, interface{}, error) {
+	page := allconfig.ListRequest{Table: table, Limit: opts.limit, Offset: opts.offset}
+	decision := allconfig.DecisionRequest{Table: table, RequestID: opts.requestID, CheckerID: opts.checkerID, Comment: opts.comment}
+	write := allconfig.SetRequest{
+		Table:       table,
+		Key:         opts.key,
+		Value:       opts.configValue(),
+		Description: opts.description,
+		Tags:        opts.configTags(),
+		MakerID:     opts.makerID,
+	}
+	remove := allconfig.DeleteRequest{Table: table, Key: opts.key, Description: opts.description, MakerID: opts.makerID}
+
+	switch opts.action {
+	case "get":
+		result, err := service.Get(ctx, connector, allconfig.ReadRequest{Table: table, Key: opts.key})
+		return fmt.Sprintf("Config %s in %s", opts.key, table), result, err
+	case "set":
+		if opts.deleteKey {
+			result, err := service.DirectDelete(ctx, connector, remove)
+			return fmt.Sprintf("Config %s deleted from %s", opts.key, table), result, err
+		}
+		result, created, err := service.DirectSet(ctx, connector, write)
+		if created {
+			return fmt.Sprintf("Config %s created in %s", opts.key, table), result, err
+		}
+		return fmt.Sprintf("Config %s updated in %s", opts.key, table), result, err
+	case "submit":
+		if opts.deleteKey {
+			submitted, err := service.SubmitDelete(ctx, connector, remove)
+			if err != nil {
+				return "", nil, err
+			}
+			return fmt.Sprintf("Submitted delete of config %s for approval", opts.key), submitted, nil
+		}
+		submitted, err := service.SubmitSet(ctx, connector, write)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("Submitted %s of config %s for approval", submitted.Operation, opts.key), submitted, nil
+	case "approve":
+		result, err := service.Decide(ctx, connector, decision, true)
+		return fmt.Sprintf("Request %s approved by %s", opts.requestID, opts.checkerID), result, err
+	case "reject":
+		result, err := service.Decide(ctx, connector, decision, false)
+		return fmt.Sprintf("Request %s rejected by %s", opts.requestID, opts.checkerID), result, err
+	case "pending":
+		result, err := service.Pending(ctx, connector, page)
+		return fmt.Sprintf("Pending approval requests in %s", table), result, err
+	case "history":
+		result, err := service.History(ctx, connector, page)
+		return fmt.Sprintf("Approval history of %s", table), result, err
+	}
+	return "", nil, fmt.Errorf("unknown action %q", opts.action)
+}
+
+// writeAllConfigResult writes the message and result as indented JSON, or the message followed by
+// the result as an aligned table
+func writeAllConfigResult(w io.Writer, message string, result interface{}, jsonOutput bool) error {
+	if jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]interface{}{"message": message, "data": result})
+	}
+
+	if _, err := fmt.Fprintln(w, message); err != nil {
+		return err
+	}
+	rows := newQueryResult()
+	if err := api.WriteResultRows(rows, result); err != nil {
+		return err
+	}
+	if rows.empty() {
+		return nil
+	}
+	return writeQueryResult(w, rows, "table")
+}
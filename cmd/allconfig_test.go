@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAllConfigFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "no action", args: nil, err: "an action is required: get, set, submit, approve, reject, pending, history"},
+		{name: "flag before action", args: []string{"-conn=primary", "get"}, err: "an action is required: get, set, submit, approve, reject, pending, history"},
+		{name: "unknown action", args: []string{"list"}, err: `unknown action "list"; actions: get, set, submit, approve, reject, pending, history`},
+		{name: "missing connection", args: []string{"pending"}, err: "-conn is required for pending"},
+		{name: "get", args: []string{"get", "-conn=primary", "-key=feature.flag"}},
+		{name: "get without key", args: []string{"get", "-conn=primary"}, err: "-key is required for get"},
+		{name: "set without value", args: []string{"set", "-conn=primary", "-key=feature.flag"}, err: "-value is required for set"},
+		{name: "set delete", args: []string{"set", "-conn=primary", "-key=feature.flag", "-delete"}},
+		{name: "submit without maker", args: []string{"submit", "-conn=primary", "-key=feature.flag", "-value=on"}, err: "-maker is required for submit"},
+		{name: "submit", args: []string{"submit", "-conn=primary", "-key=feature.flag", "-value=on", "-maker=bob"}},
+		{name: "approve without checker", args: []string{"approve", "-conn=primary", "-request=req-1"}, err: "-checker is required for approve"},
+		{name: "reject without request", args: []string{"reject", "-conn=primary", "-checker=alice"}, err: "-request is required for reject"},
+		{name: "invalid limit", args: []string{"history", "-conn=primary", "-limit=0"}, err: "-limit must be positive and -offset must not be negative"},
+		{name: "extra arguments", args: []string{"history", "-conn=primary", "extra"}, err: "unexpected arguments: extra"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseAllConfigFlags(tt.args, io.Discard)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.args[0], opts.action)
+		})
+	}
+}
+
+func TestAllConfigValue(t *testing.T) {
+	assert.Equal(t, "on", (&allConfigOptions{value: "on"}).configValue())
+	assert.Equal(t, "on", (&allConfigOptions{value: `"on"`}).configValue())
+	assert.Equal(t, float64(3), (&allConfigOptions{value: "3"}).configValue())
+	assert.Equal(t, map[string]interface{}{"retries": float64(2)}, (&allConfigOptions{value: `{"retries": 2}`}).configValue())
+}
+
+func TestAllConfigTags(t *testing.T) {
+	assert.Nil(t, (&allConfigOptions{}).configTags())
+	assert.Equal(t, []string{"team:payments", "prod"}, (&allConfigOptions{tags: "team:payments, prod"}).configTags())
+}
+
+func TestWriteAllConfigResult(t *testing.T) {
+	config := map[string]interface{}{"config_key": "feature.flag", "config_value": "on"}
+
+	var text bytes.Buffer
+	require.NoError(t, writeAllConfigResult(&text, "Config feature.flag in allconfig", config, false))
+	assert.Equal(t, "Config feature.flag in allconfig\n"+
+		"config_key    config_value\n"+
+		"feature.flag  on\n"+
+		"(1 row)\n", text.String())
+
+	var empty bytes.Buffer
+	require.NoError(t, writeAllConfigResult(&empty, "Pending approval requests in allconfig", nil, false))
+	assert.Equal(t, "Pending approval requests in allconfig\n", empty.String())
+
+	var out bytes.Buffer
+	require.NoError(t, writeAllConfigResult(&out, "Config feature.flag in allconfig", config, true))
+	assert.JSONEq(t, `{"message": "Config feature.flag in allconfig", "data": {"config_key": "feature.flag", "config_value": "on"}}`, out.String())
+}
+
+func TestRunAllConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`profiles:
+  documents:
+    type: `+queryDriver+`
+    host: kv.internal
+    port: 7000
+    username: app
+    password: secret
+    database: app
+`), 0644))
+	base := []string{"-config=" + path, "-conn=documents"}
+
+	tests := []struct {
+		name       string
+		action     string
+		args       []string
+		connectErr error
+		setup      func(conn *connectortest.MockDBConnector)
+		expected   int
+		stdout     string
+		stderr     string
+	}{
+		{
+			name:   "get",
+			action: "get",
+			args:   []string{"-key=feature.flag"},
+			setup: func(conn *connectortest.MockDBConnector) {
+				conn.On("Execute", mock.Anything, "findOne", mock.Anything).
+					Return(map[string]interface{}{"config_key": "feature.flag", "config_value": "on"}, nil)
+			},
+			expected: exitSuccess,
+			stdout:   "Config feature.flag in allconfig\nconfig_key    config_value\nfeature.flag  on\n(1 row)\n",
+		},
+		{
+			name:   "get missing key",
+			action: "get",
+			args:   []string{"-key=missing", "-table=settings"},
+			setup: func(conn *connectortest.MockDBConnector) {
+				conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(nil, connectors.ErrNotFound)
+			},
+			expected: exitNoRows,
+			stderr:   "allconfig: config not found: missing\n",
+		},
+		{
+			name:   "reject unknown request",
+			action: "reject",
+			args:   []string{"-request=req-9", "-checker=alice"},
+			setup: func(conn *connectortest.MockDBConnector) {
+				conn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(nil, connectors.ErrNotFound)
+			},
+			expected: exitNoRows,
+			stderr:   "allconfig: pending approval request not found: req-9\n",
+		},
+		{
+			name:   "pending failure",
+			action: "pending",
+			setup: func(conn *connectortest.MockDBConnector) {
+				conn.On("Execute", mock.Anything, "find", mock.Anything).Return(nil, errors.New("collection not found"))
+			},
+			expected: exitFailed,
+			stderr:   "allconfig: pending failed: collection not found\n",
+		},
+		{
+			name:       "connection failure",
+			action:     "history",
+			connectErr: errors.New("connection refused"),
+			expected:   exitConnection,
+			stderr:     "allconfig: connection failed: connection refused\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := new(connectortest.MockDBConnector)
+			conn.On("Connect", mock.Anything).Return(tt.connectErr)
+			conn.On("Close").Return(nil)
+			conn.On("GetType").Return("mongodb")
+			if tt.setup != nil {
+				tt.setup(conn)
+			}
+			queryDriverConnector = conn
+
+			var stdout, stderr bytes.Buffer
+			args := append(append([]string{tt.action}, base...), tt.args...)
+			assert.Equal(t, tt.expected, runAllConfig(args, &stdout, &stderr))
+			assert.Equal(t, tt.stdout, stdout.String())
+			assert.Equal(t, tt.stderr, stderr.String())
+		})
+	}
+}
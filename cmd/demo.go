@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"db-connectors/config"
+	"db-connectors/connectors"
+)
+
+// demoTimeout bounds connecting to and exercising one connection in demo mode
+const demoTimeout = 30 * time.Second
+
+// Outcomes of a demo step
+const (
+	stepOK      = "ok"
+	stepWarning = "warning" // Reported without failing the connection
+	stepFailed  = "failed"
+)
+
+// demoStep is the outcome of one action run against a connection
+type demoStep struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok, warning or failed
+	Detail string `json:"detail,omitempty"`
+}
+
+// demoResult is the outcome of demonstrating one connection
+type demoResult struct {
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Success    bool       `json:"success"`
+	Steps      []demoStep `json:"steps"`
+	DurationMS int64      `json:"duration_ms"`
+}
+
+// demoReport is the outcome of a demo run; Success is false when any connection failed
+type demoReport struct {
+	Success     bool         `json:"success"`
+	Connections []demoResult `json:"connections"`
+}
+
+// runCLIDemo connects to every configured database, or only target, runs a few operations on each
+// and prints the results. It exits non-zero when any connection fails so that it can be used as a
+// smoke test.
+func runCLIDemo(configPath, target string, jsonOutput, allowWarnings bool) {
+	cfg, err := loadConfiguration(configPath, validateOptions(allowWarnings)...)
+	if err != nil {
+		slog.Error("failed to load configuration", "path", configPath, "error", err)
+		os.Exit(1)
+	}
+	logger := newLogger(cfg)
+	slog.SetDefault(logger)
+	logConfigSource(logger, cfg, configPath)
+
+	registry := connectors.NewConnectorRegistry()
+	if err := registerConnectors(registry, cfg, logger); err != nil {
+		logger.Error("failed to register connectors", "error", err)
+		os.Exit(1)
+	}
+
+	report, err := demonstrateConnectors(context.Background(), registry, target, logger)
+	if err != nil {
+		logger.Error("demo failed", "error", err)
+		os.Exit(1)
+	}
+	if err := writeDemoReport(os.Stdout, report, jsonOutput); err != nil {
+		logger.Error("failed to write demo results", "error", err)
+		os.Exit(1)
+	}
+	if !report.Success {
+		os.Exit(1)
+	}
+}
+
+// loadConfiguration loads the configuration file, falling back to environment variables when it
+// cannot be read. With no databases configured at all it writes an example config.yaml and fails.
+func loadConfiguration(configPath string, validateOpts ...config.ValidateOption) (*config.Config, error) {
+	cfg, err := config.LoadConfig(configPath, validateOpts...)
+	if errors.Is(err, config.ErrInvalidConfig) {
+		return nil, err
+	}
+	if err != nil {
+		slog.Warn("could not load config file, trying environment variables", "error", err)
+		cfg = config.LoadFromEnv()
+		if err := cfg.Validate(validateOpts...); err != nil {
+			return nil, fmt.Errorf("%w: %w", config.ErrInvalidConfig, err)
+		}
+	}
+
+	if len(cfg.ConnectionProfiles()) == 0 {
+		if err := config.GenerateExampleConfig("config.yaml"); err != nil {
+			return nil, fmt.Errorf("no databases configured and failed to generate example config: %w", err)
+		}
+		return nil, errors.New("no databases configured; an example config.yaml was written, edit it with your database credentials")
+	}
+	return cfg, nil
+}
+
+// registerConnectors registers an unconnected connector for every databases entry and connection profile
+func registerConnectors(registry *connectors.ConnectorRegistry, cfg *config.Config, logger *slog.Logger) error {
+	for name, profile := range cfg.ConnectionProfiles() {
+		connConfig := profile.ConnectionConfig
+		connector, err := connectors.New(profile.Type, &connConfig, connectors.WithLogger(logger))
+		if err != nil {
+			return fmt.Errorf("connection %s: %w", name, err)
+		}
+		registry.RegisterWithConfig(name, connector, &connConfig)
+		logger.Debug("connector registered", "name", name, "db_type", profile.Type)
+	}
+	if len(registry.List()) == 0 {
+		return errors.New("no database connectors configured")
+	}
+	return nil
+}
+
+// demonstrateConnectors demonstrates every registered connection, or only target when it is set
+func demonstrateConnectors(ctx context.Context, registry *connectors.ConnectorRegistry, target string, logger *slog.Logger) (demoReport, error) {
+	names := registry.List()
+	if target != "" {
+		if _, exists := registry.Get(target); !exists {
+			return demoReport{}, fmt.Errorf("unknown connection %q; configured connections: %s", target, strings.Join(names, ", "))
+		}
+		names = []string{target}
+	}
+
+	report := demoReport{Success: true, Connections: make([]demoResult, 0, len(names))}
+	for _, name := range names {
+		connector, _ := registry.Get(name)
+		result := demonstrateConnector(ctx, name, connector, logger)
+		if !result.Success {
+			report.Success = false
+		}
+		report.Connections = append(report.Connections, result)
+	}
+	return report, nil
+}
+
+// demonstrateConnector connects and pings one connection, runs the operations for its type and closes it
+func demonstrateConnector(ctx context.Context, name string, connector connectors.DBConnector, logger *slog.Logger) demoResult {
+	ctx, cancel := context.WithTimeout(ctx, demoTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result := &demoResult{Name: name, Type: connector.GetType(), Success: true}
+	logger = logger.With("name", name, "db_type", result.Type)
+	logger.Info("testing connector")
+
+	if result.step(logger, "connect", connector.Connect(ctx), "") {
+		if result.step(logger, "ping", connector.Ping(ctx), "") {
+			switch result.Type {
+			case "mysql", "postgresql":
+				demonstrateSQLOperations(ctx, connector, result, logger)
+			case "mongodb":
+				demonstrateMongoOperations(ctx, connector, result, logger)
+			}
+		}
+		if err := connector.Close(ctx); err != nil {
+			logger.Warn("failed to close connection", "error", err)
+		}
+	}
+	result.DurationMS = time.Since(start).Milliseconds()
+	return *result
+}
+
+// step records the outcome of an action, failing the connection when err is not nil, and reports whether it succeeded
+func (r *demoResult) step(logger *slog.Logger, name string, err error, detail string) bool {
+	if err != nil {
+		r.Success = false
+		r.Steps = append(r.Steps, demoStep{Name: name, Status: stepFailed, Detail: err.Error()})
+		logger.Error("demo step failed", "step", name, "error", err)
+		return false
+	}
+	r.Steps = append(r.Steps, demoStep{Name: name, Status: stepOK, Detail: detail})
+	logger.Info("demo step succeeded", "step", name, "detail", detail)
+	return true
+}
+
+// warn records an action whose failure does not fail the connection
+func (r *demoResult) warn(logger *slog.Logger, name string, err error) {
+	r.Steps = append(r.Steps, demoStep{Name: name, Status: stepWarning, Detail: err.Error()})
+	logger.Warn("demo step failed", "step", name, "error", err)
+}
+
+// demonstrateSQLOperations creates a test table, which may fail for lack of permissions without failing
+// the demo, and runs a test query
+func demonstrateSQLOperations(ctx context.Context, connector connectors.DBConnector, result *demoResult, logger *slog.Logger) {
+	createTableQuery := `
+		CREATE TABLE IF NOT EXISTS test_users (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100),
+			email VARCHAR(100),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	if connector.GetType() == "mysql" {
+		createTableQuery = `
+			CREATE TABLE IF NOT EXISTS test_users (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(100),
+				email VARCHAR(100),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)
+		`
+	}
+	if _, err := connector.Execute(ctx, "insert", map[string]interface{}{"query": createTableQuery}); err != nil {
+		result.warn(logger, "create test table", err)
+	} else {
+		result.step(logger, "create test table", nil, "")
+	}
+
+	value, err := testQuery(ctx, connector)
+	result.step(logger, "test query", err, fmt.Sprintf("SELECT 1 returned %d", value))
+}
+
+// testQuery runs SELECT 1 and returns the value read back
+func testQuery(ctx context.Context, connector connectors.DBConnector) (int, error) {
+	rows, err := connector.Query(ctx, "SELECT 1 as test_column")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("test query returned no rows")
+	}
+	var value int
+	if err := rows.Scan(&value); err != nil {
+		return 0, err
+	}
+	return value, rows.Err()
+}
+
+// demonstrateMongoOperations counts, inserts, finds and deletes a test document, stopping at the first failure
+func demonstrateMongoOperations(ctx context.Context, connector connectors.DBConnector, result *demoResult, logger *slog.Logger) {
+	const collection = "test_collection"
+	filter := map[string]interface{}{"email": "test@example.com"}
+
+	count, err := connector.Execute(ctx, "count", map[string]interface{}{
+		"collection": collection,
+		"filter":     map[string]interface{}{},
+	})
+	if !result.step(logger, "count documents", err, fmt.Sprintf("%v documents in %s", count, collection)) {
+		return
+	}
+
+	_, err = connector.Execute(ctx, "insert", map[string]interface{}{
+		"collection": collection,
+		"document": map[string]interface{}{
+			"name":      "Test User",
+			"email":     "test@example.com",
+			"timestamp": time.Now(),
+		},
+	})
+	if !result.step(logger, "insert test document", err, "") {
+		return
+	}
+
+	found, err := connector.Execute(ctx, "findOne", map[string]interface{}{"collection": collection, "filter": filter})
+	if !result.step(logger, "find test document", err, fmt.Sprintf("found: %t", found != nil)) {
+		return
+	}
+
+	_, err = connector.Execute(ctx, "delete", map[string]interface{}{"collection": collection, "filter": filter})
+	result.step(logger, "delete test document", err, "")
+}
+
+// writeDemoReport writes the report as indented JSON or as a table with one row per connection
+func writeDemoReport(w io.Writer, report demoReport, jsonOutput bool) error {
+	if jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CONNECTION\tTYPE\tRESULT\tDURATION\tDETAIL")
+	for _, result := range report.Connections {
+		status, detail := "ok", ""
+		if !result.Success {
+			status = "FAILED"
+			for _, step := range result.Steps {
+				if step.Status == stepFailed {
+					detail = step.Name + ": " + step.Detail
+					break
+				}
+			}
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%dms\t%s\n", result.Name, result.Type, status, result.DurationMS, detail)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"db-connectors/config"
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newDemoConnector returns a connector of dbType that connects, pings and closes successfully
+func newDemoConnector(dbType string) *connectortest.MockDBConnector {
+	conn := new(connectortest.MockDBConnector)
+	conn.On("GetType").Return(dbType)
+	conn.On("Connect", mock.Anything).Return(nil)
+	conn.On("Ping", mock.Anything).Return(nil)
+	conn.On("Close").Return(nil)
+	return conn
+}
+
+// selectOneRows returns the rows of SELECT 1
+func selectOneRows(t *testing.T) *sql.Rows {
+	t.Helper()
+	db, sqlMock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	sqlMock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"test_column"}).AddRow(1))
+	rows, err := db.Query("SELECT 1")
+	require.NoError(t, err)
+	return rows
+}
+
+func TestDemonstrateConnectors(t *testing.T) {
+	mysqlConn := newDemoConnector("mysql")
+	mysqlConn.On("Execute", mock.Anything, "insert", mock.Anything).Return(nil, errors.New("permission denied"))
+	mysqlConn.On("Query", mock.Anything, "SELECT 1 as test_column", mock.Anything).Return(selectOneRows(t), nil)
+
+	mongoConn := newDemoConnector("mongodb")
+	mongoConn.On("Execute", mock.Anything, "count", mock.Anything).Return(int64(3), nil)
+	mongoConn.On("Execute", mock.Anything, "insert", mock.Anything).Return("inserted", nil)
+	mongoConn.On("Execute", mock.Anything, "findOne", mock.Anything).Return(map[string]interface{}{"name": "Test User"}, nil)
+	mongoConn.On("Execute", mock.Anything, "delete", mock.Anything).Return(int64(1), nil)
+
+	registry := connectors.NewConnectorRegistry()
+	registry.Register("primary", mysqlConn)
+	registry.Register("documents", mongoConn)
+
+	report, err := demonstrateConnectors(context.Background(), registry, "", discardLogger)
+	require.NoError(t, err)
+	assert.True(t, report.Success)
+	require.Len(t, report.Connections, 2)
+
+	documents := report.Connections[0]
+	assert.Equal(t, "documents", documents.Name)
+	assert.True(t, documents.Success)
+	assert.Len(t, documents.Steps, 6)
+
+	// A test table that cannot be created is a warning rather than a failure
+	primary := report.Connections[1]
+	assert.True(t, primary.Success)
+	assert.Equal(t, []demoStep{
+		{Name: "connect", Status: stepOK},
+		{Name: "ping", Status: stepOK},
+		{Name: "create test table", Status: stepWarning, Detail: "permission denied"},
+		{Name: "test query", Status: stepOK, Detail: "SELECT 1 returned 1"},
+	}, primary.Steps)
+
+	mysqlConn.AssertCalled(t, "Close")
+	mongoConn.AssertCalled(t, "Close")
+}
+
+func TestDemonstrateConnectorsFailure(t *testing.T) {
+	unreachable := new(connectortest.MockDBConnector)
+	unreachable.On("GetType").Return("postgresql")
+	unreachable.On("Connect", mock.Anything).Return(errors.New("connection refused"))
+
+	failingPing := new(connectortest.MockDBConnector)
+	failingPing.On("GetType").Return("mysql")
+	failingPing.On("Connect", mock.Anything).Return(nil)
+	failingPing.On("Ping", mock.Anything).Return(errors.New("bad handshake"))
+	failingPing.On("Close").Return(nil)
+
+	registry := connectors.NewConnectorRegistry()
+	registry.Register("analytics", unreachable)
+	registry.Register("primary", failingPing)
+
+	report, err := demonstrateConnectors(context.Background(), registry, "", discardLogger)
+	require.NoError(t, err)
+	assert.False(t, report.Success)
+	require.Len(t, report.Connections, 2)
+
+	analytics := report.Connections[0]
+	assert.False(t, analytics.Success)
+	assert.Equal(t, []demoStep{{Name: "connect", Status: stepFailed, Detail: "connection refused"}}, analytics.Steps)
+	unreachable.AssertNotCalled(t, "Close")
+
+	primary := report.Connections[1]
+	assert.False(t, primary.Success)
+	assert.Equal(t, demoStep{Name: "ping", Status: stepFailed, Detail: "bad handshake"}, primary.Steps[1])
+	failingPing.AssertCalled(t, "Close")
+	failingPing.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDemonstrateConnectorsTarget(t *testing.T) {
+	selected := newDemoConnector("fakekv")
+	skipped := new(connectortest.MockDBConnector)
+
+	registry := connectors.NewConnectorRegistry()
+	registry.Register("cache", selected)
+	registry.Register("primary", skipped)
+
+	report, err := demonstrateConnectors(context.Background(), registry, "cache", discardLogger)
+	require.NoError(t, err)
+	assert.True(t, report.Success)
+	require.Len(t, report.Connections, 1)
+	assert.Equal(t, "cache", report.Connections[0].Name)
+	assert.Len(t, report.Connections[0].Steps, 2, "custom drivers are only connected and pinged")
+	skipped.AssertNotCalled(t, "Connect", mock.Anything)
+
+	_, err = demonstrateConnectors(context.Background(), registry, "missing", discardLogger)
+	assert.EqualError(t, err, `unknown connection "missing"; configured connections: cache, primary`)
+}
+
+func TestWriteDemoReport(t *testing.T) {
+	report := demoReport{Connections: []demoResult{
+		{Name: "primary", Type: "mysql", Success: true, DurationMS: 12, Steps: []demoStep{{Name: "connect", Status: stepOK}}},
+		{Name: "analytics", Type: "postgresql", DurationMS: 3, Steps: []demoStep{{Name: "connect", Status: stepFailed, Detail: "connection refused"}}},
+	}}
+
+	var text bytes.Buffer
+	require.NoError(t, writeDemoReport(&text, report, false))
+	assert.Equal(t, "CONNECTION  TYPE        RESULT  DURATION  DETAIL\n"+
+		"primary     mysql       ok      12ms      \n"+
+		"analytics   postgresql  FAILED  3ms       connect: connection refused\n", text.String())
+
+	var out bytes.Buffer
+	require.NoError(t, writeDemoReport(&out, report, true))
+	var decoded demoReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, report, decoded)
+	assert.Contains(t, out.String(), `"duration_ms": 12`)
+}
+
+func TestRegisterConnectors(t *testing.T) {
+	cfg := &config.Config{
+		Databases: connectors.DatabaseConfig{
+			MySQL: &connectors.ConnectionConfig{Host: "mysql.internal", Port: 3306, Username: "app", Password: "secret", Database: "app"},
+		},
+		Profiles: map[string]config.ProfileConfig{
+			"reporting": {Type: "postgresql", ConnectionConfig: connectors.ConnectionConfig{Host: "pg.internal", Port: 5432, Database: "reports"}},
+		},
+	}
+	registry := connectors.NewConnectorRegistry()
+	require.NoError(t, registerConnectors(registry, cfg, discardLogger))
+	assert.Equal(t, []string{"mysql", "reporting"}, registry.List())
+
+	record, ok := registry.Record("reporting")
+	require.True(t, ok)
+	assert.Equal(t, "postgresql", record.Connector.GetType())
+	assert.Equal(t, "pg.internal", record.Host)
+
+	err := registerConnectors(connectors.NewConnectorRegistry(), &config.Config{}, discardLogger)
+	assert.EqualError(t, err, "no database connectors configured")
+}
+
+func TestLoadConfigurationWithoutDatabases(t *testing.T) {
+	dir := t.TempDir()
+	previousDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(previousDir) })
+
+	path := filepath.Join(dir, "empty.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("app_name: empty\n"), 0644))
+
+	_, err = loadConfiguration(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no databases configured")
+	assert.FileExists(t, filepath.Join(dir, "config.yaml"))
+}
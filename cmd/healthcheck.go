@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-connectors/config"
+)
+
+// healthcheckOptions are the flags of the healthcheck subcommand
+type healthcheckOptions struct {
+	host    string
+	port    int
+	timeout time.Duration
+}
+
+// parseHealthcheckFlags parses the arguments following the healthcheck subcommand. The port
+// defaults to PORT, then to the server's default port.
+func parseHealthcheckFlags(args []string, stderr io.Writer) (*healthcheckOptions, error) {
+	port := defaultPort
+	if envPort, ok := config.EnvPort("PORT"); ok {
+		port = envPort
+	}
+
+	opts := &healthcheckOptions{}
+	flags := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.host, "host", "localhost", "Host the API server is reachable on")
+	flags.IntVar(&opts.port, "port", port, "Port of the API server; defaults to PORT, then 8080")
+	flags.DurationVar(&opts.timeout, "timeout", 5*time.Second, "Timeout for the health request")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if opts.port < 1 || opts.port > 65535 {
+		return nil, fmt.Errorf("invalid port %d, must be between 1 and 65535", opts.port)
+	}
+	return opts, nil
+}
+
+// runHealthcheck requests /health from the local API server and returns exit code 0 when it reports
+// healthy and 1 otherwise, so that the binary can serve as a container HEALTHCHECK without curl
+func runHealthcheck(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseHealthcheckFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "healthcheck:", err)
+		return 1
+	}
+
+	url := "http://" + net.JoinHostPort(opts.host, strconv.Itoa(opts.port)) + "/health"
+	if err := checkHealth(&http.Client{Timeout: opts.timeout}, url); err != nil {
+		fmt.Fprintln(stderr, "healthcheck:", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "healthy")
+	return 0
+}
+
+// checkHealth requests url and checks that it reports a healthy status
+func checkHealth(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	var health struct {
+		Data struct {
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Errorf("invalid health response: %w", err)
+	}
+	if health.Data.Status != "healthy" {
+		return fmt.Errorf("server reported status %q", health.Data.Status)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"db-connectors/api"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// healthcheckArgs returns the -host and -port flags addressing server
+func healthcheckArgs(t *testing.T, server *httptest.Server) []string {
+	t.Helper()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	return []string{"-host=" + host, "-port=" + port}
+}
+
+func TestParseHealthcheckFlags(t *testing.T) {
+	t.Setenv("PORT", "")
+	opts, err := parseHealthcheckFlags(nil, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", opts.host)
+	assert.Equal(t, defaultPort, opts.port)
+
+	t.Setenv("PORT", "9090")
+	opts, err = parseHealthcheckFlags(nil, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, 9090, opts.port)
+
+	opts, err = parseHealthcheckFlags([]string{"-port=7070"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, 7070, opts.port, "-port overrides PORT")
+
+	_, err = parseHealthcheckFlags([]string{"-port=70000"}, io.Discard)
+	assert.EqualError(t, err, "invalid port 70000, must be between 1 and 65535")
+}
+
+func TestRunHealthcheck(t *testing.T) {
+	healthy := httptest.NewServer(api.SetupRoutes(api.NewAPI()))
+	defer healthy.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runHealthcheck(healthcheckArgs(t, healthy), &stdout, &stderr))
+	assert.Equal(t, "healthy\n", stdout.String())
+	assert.Empty(t, stderr.String())
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	stdout.Reset()
+	assert.Equal(t, 1, runHealthcheck(healthcheckArgs(t, failing), &stdout, &stderr))
+	assert.Empty(t, stdout.String())
+	assert.Contains(t, stderr.String(), "returned 503 Service Unavailable")
+
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": true, "data": {"status": "degraded"}}`))
+	}))
+	defer unhealthy.Close()
+
+	stderr.Reset()
+	assert.Equal(t, 1, runHealthcheck(healthcheckArgs(t, unhealthy), &stdout, &stderr))
+	assert.Equal(t, "healthcheck: server reported status \"degraded\"\n", stderr.String())
+
+	// Nothing listening on the port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	stderr.Reset()
+	assert.Equal(t, 1, runHealthcheck([]string{"-host=127.0.0.1", "-port=" + strconv.Itoa(port)}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "healthcheck: request failed")
+}
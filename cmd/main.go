@@ -2,248 +2,541 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"syscall"
 	"time"
 
 	"db-connectors/api"
 	"db-connectors/config"
 	"db-connectors/connectors"
+	"db-connectors/events"
+	"db-connectors/jobs"
+	"db-connectors/logging"
+	"db-connectors/webhook"
 )
 
 func main() {
-	// Parse command line flags
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		os.Exit(runQuery(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "allconfig" {
+		os.Exit(runAllConfig(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Parse command line flags; -port and -host are applied by resolveServerConfig only when given
+	flag.Int("port", defaultPort, "Port to run the API server on, overriding server.port and PORT")
+	flag.String("host", "", "Host to bind to, overriding server.host and SERVER_HOST (empty for all interfaces)")
 	var (
-		port = flag.Int("port", 8080, "Port to run the API server on")
-		mode = flag.String("mode", "api", "Mode to run: 'api' for HTTP server or 'demo' for CLI demo")
+		mode       = flag.String("mode", "api", "Mode to run: 'api' for HTTP server or 'demo' for CLI demo")
+		configPath = flag.String("config", "", "Path to the configuration file; when empty $DB_CONNECTORS_CONFIG, ./config.yaml, ~/.config/db-connectors/config.yaml and /etc/db-connectors/config.yaml are searched")
+
+		allowWarnings = flag.Bool("allow-config-warnings", false, "Start despite configuration warnings such as empty database passwords")
+
+		target     = flag.String("target", "", "Demo mode: only demonstrate the named connection (a databases entry or connection profile)")
+		jsonOutput = flag.Bool("json", false, "Demo mode: print the results as JSON")
+
+		showVersion = flag.Bool("version", false, "Print the version, commit and build date and exit")
 	)
 	flag.Parse()
 
-	fmt.Println("=== Database Connectors ===")
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
 
 	switch *mode {
 	case "api":
-		runAPIServer(*port)
+		runAPIServer(*configPath, *allowWarnings)
 	case "demo":
-		runCLIDemo()
+		runCLIDemo(*configPath, *target, *jsonOutput, *allowWarnings)
 	default:
-		fmt.Printf("Unknown mode: %s. Use 'api' or 'demo'\n", *mode)
+		slog.Error("unknown mode, use 'api' or 'demo'", "mode", *mode)
 		os.Exit(1)
 	}
 }
 
-func runAPIServer(port int) {
-	fmt.Printf("🚀 Starting Database Connectors API Server on port %d\n", port)
-	
-	server := api.NewServer(port)
-	if err := server.Start(); err != nil {
-		log.Fatalf("❌ Failed to start server: %v", err)
-	}
-}
+// defaultPort is the API server port when neither the flag, PORT nor server.port sets one
+const defaultPort = 8080
 
-func runCLIDemo() {
-	fmt.Println("🔧 Running CLI Demo Mode...")
-	fmt.Println("⚠️  CLI demo mode requires a config.yaml file or environment variables")
-	
-	// Import the original demo functions if needed
-	fmt.Println("Use 'go run cmd/main.go -mode=api' to start the HTTP API server instead")
-	os.Exit(0)
-}
+// defaultShutdownTimeout bounds shutdown when server.shutdown_timeout is not set
+const defaultShutdownTimeout = 15 * time.Second
 
-func loadConfiguration() (*config.Config, error) {
-	// Try to load from config file first
-	cfg, err := config.LoadConfig("config.yaml")
-	if err != nil {
-		fmt.Printf("Warning: Could not load config file, trying environment variables: %v\n", err)
-		
-		// Fall back to environment variables
-		cfg = config.LoadFromEnv()
-		
-		// Check if we have any database configurations
-		if cfg.Databases.MySQL == nil && cfg.Databases.PostgreSQL == nil && cfg.Databases.MongoDB == nil {
-			fmt.Println("No database configurations found. Generating example config file...")
-			if err := config.GenerateExampleConfig("config.yaml"); err != nil {
-				return nil, fmt.Errorf("failed to generate example config: %w", err)
-			}
-			fmt.Println("Example config file 'config.yaml' created. Please edit it with your database credentials.")
-			os.Exit(0)
+// resolveServerConfig applies the -port and -host flags given on the command line on top of the
+// server settings loaded from the file and environment, then fills in defaults, so that
+// flags take precedence over environment variables, which take precedence over the file
+func resolveServerConfig(server config.ServerConfig, flags *flag.FlagSet) config.ServerConfig {
+	flags.Visit(func(f *flag.Flag) {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return
 		}
+		switch f.Name {
+		case "port":
+			server.Port = getter.Get().(int)
+		case "host":
+			server.Host = getter.Get().(string)
+		}
+	})
+	if server.Port == 0 {
+		server.Port = defaultPort
 	}
-
-	return cfg, nil
+	return server
 }
 
-func registerConnectors(registry *connectors.ConnectorRegistry, cfg *config.Config) {
-	// Register MySQL connector if configured
-	if cfg.Databases.MySQL != nil {
-		mysqlConnector := connectors.NewMySQLConnector(cfg.Databases.MySQL)
-		registry.Register("mysql", mysqlConnector)
-		fmt.Println("✓ MySQL connector registered")
+func runAPIServer(configPath string, allowWarnings bool) {
+	cfg, err := config.LoadConfig(configPath, validateOptions(allowWarnings)...)
+	if err != nil {
+		slog.Error("failed to load configuration", "path", configPath, "error", err)
+		os.Exit(1)
+	}
+	for _, warning := range cfg.Warnings() {
+		slog.Warn("configuration warning", "path", cfg.Source, "warning", warning)
 	}
 
-	// Register PostgreSQL connector if configured
-	if cfg.Databases.PostgreSQL != nil {
-		postgresConnector := connectors.NewPostgreSQLConnector(cfg.Databases.PostgreSQL)
-		registry.Register("postgresql", postgresConnector)
-		fmt.Println("✓ PostgreSQL connector registered")
+	cfg.Server = resolveServerConfig(cfg.Server, flag.CommandLine)
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		slog.Error("invalid server port, must be between 1 and 65535", "port", cfg.Server.Port)
+		os.Exit(1)
 	}
 
-	// Register MongoDB connector if configured
-	if cfg.Databases.MongoDB != nil {
-		mongoConnector := connectors.NewMongoDBConnector(cfg.Databases.MongoDB)
-		registry.Register("mongodb", mongoConnector)
-		fmt.Println("✓ MongoDB connector registered")
+	logger := newLogger(cfg)
+	slog.SetDefault(logger)
+	logConfigSource(logger, cfg, configPath)
+
+	statements := connectors.NewStatementLogger(connectors.StatementLogOptions{
+		SlowThreshold: cfg.Server.SlowStatementThreshold,
+		HideText:      cfg.Server.HideStatementText,
+		MetricLabels:  cfg.Server.MetricLabels,
+	})
+	opts := []api.ServerOption{
+		api.WithLogger(logger),
+		api.WithStatementLogger(statements),
+		api.WithStatementPolicy(statementPolicy(cfg.Server)),
+		api.WithCORSPolicy(corsPolicy(cfg.Server.CORS)),
+		api.WithAllConfigTables(cfg.AllConfig.Table, cfg.AllConfig.ApprovalSuffix),
+		api.WithAllConfigSchema(cfg.AllConfig.Schema),
+		api.WithKeyPolicy(keyPolicy(cfg.AllConfig)),
+		api.WithValueLimits(valueLimits(cfg.AllConfig)),
+		api.WithConfigNotifications(cfg.AllConfig.NotifyChanges),
+		api.WithBuildInfo(buildInfo()),
+	}
+	if cfg.Server.RateLimit.Enabled {
+		opts = append(opts, api.WithRateLimit(rateLimitPolicy(cfg.Server.RateLimit)))
+	}
+	if len(cfg.Masking.Rules) > 0 {
+		opts = append(opts, api.WithMaskingPolicy(maskingPolicy(cfg.Masking)))
+	}
+	if len(cfg.Tenants) > 0 {
+		opts = append(opts, api.WithTenants(tenants(cfg.Tenants)...))
+	}
+	if cfg.Jobs.Enabled {
+		manager := jobs.NewManager(jobOptions(cfg.Jobs))
+		defer manager.Close()
+		opts = append(opts, api.WithJobManager(manager))
+	}
+	if cfg.Events.Enabled {
+		publisher, err := eventPublisher(cfg.Events, logger)
+		if err != nil {
+			logger.Error("invalid event publisher", "error", err)
+			os.Exit(1)
+		}
+		defer closeEventPublisher(publisher, cfg.Server.ShutdownTimeout, logger)
+		opts = append(opts, api.WithEventPublisher(publisher))
+	}
+	rules, err := valueRules(cfg.AllConfig)
+	if err != nil {
+		logger.Error("invalid value rule", "error", err)
+		os.Exit(1)
+	}
+	opts = append(opts, api.WithValueRules(rules))
+	alerts, err := healthAlerts(cfg.Server.HealthAlerts)
+	if err != nil {
+		logger.Error("invalid health alert webhook", "error", err)
+		os.Exit(1)
+	}
+	opts = append(opts, api.WithHealthAlerts(alerts))
+	reload := func() (*config.Config, error) {
+		return config.LoadConfig(configPath, validateOptions(allowWarnings)...)
+	}
+	profiles, err := profileOptions(cfg, reload, logger, statements)
+	if err != nil {
+		logger.Error("invalid connection profile", "error", err)
+		os.Exit(1)
 	}
+	opts = append(opts, profiles...)
 
-	if len(registry.List()) == 0 {
-		log.Fatal("No database connectors configured")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := api.NewServer(cfg.Server, opts...)
+	if err := server.API().SetNamedQueries(namedQueries(cfg.Queries)); err != nil {
+		logger.Error("invalid named query", "error", err)
+		os.Exit(1)
+	}
+	if cfg.AllConfig.NotifyChanges {
+		server.API().ListenConfigChanges(ctx)
+	}
+	if err := server.API().CheckStartup(ctx); err != nil {
+		logger.Error("databases unreachable at startup", "error", err)
+		os.Exit(1)
+	}
+	server.API().StartKeepAlive(ctx)
+	if cfg.AllConfig.ExpirySweepInterval > 0 {
+		server.API().SweepExpiredConfigs(ctx, cfg.AllConfig.ExpirySweepInterval)
+	}
+	if cfg.AllConfig.PendingRefreshInterval > 0 {
+		server.API().RefreshPendingCounts(ctx, cfg.AllConfig.PendingRefreshInterval)
+	}
+	go reloadOnHangup(ctx, server.API(), configPath, allowWarnings, logger)
+	if err := serve(ctx, server, cfg.Server.ShutdownTimeout, logger); err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 }
 
-func demonstrateConnectors(registry *connectors.ConnectorRegistry) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	fmt.Println("\n=== Testing Database Connections ===")
+// serve runs server until it fails or ctx is done, then shuts it down, waiting at most timeout for
+// requests in flight and connections to close
+func serve(ctx context.Context, server *api.Server, timeout time.Duration, logger *slog.Logger) error {
+	started := make(chan error, 1)
+	go func() { started <- server.Start() }()
+	select {
+	case err := <-started:
+		return err
+	case <-ctx.Done():
+	}
 
-	for _, name := range registry.List() {
-		connector, _ := registry.Get(name)
-		fmt.Printf("\nTesting %s (%s)...\n", name, connector.GetType())
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	logger.Info("shutting down", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if startErr := <-started; !errors.Is(startErr, http.ErrServerClosed) {
+		err = errors.Join(err, startErr)
+	}
+	return err
+}
 
-		// Test connection
-		if err := connector.Connect(ctx); err != nil {
-			fmt.Printf("❌ Failed to connect to %s: %v\n", name, err)
-			continue
+// reloadOnHangup reloads the named queries from the configuration on every SIGHUP until ctx is done
+func reloadOnHangup(ctx context.Context, a *api.API, configPath string, allowWarnings bool, logger *slog.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if count, err := reloadNamedQueries(a, configPath, allowWarnings); err != nil {
+				logger.Warn("failed to reload named queries, keeping the loaded ones", "error", err)
+			} else {
+				logger.Info("named queries reloaded", "queries", count)
+			}
 		}
-		defer connector.Close()
+	}
+}
 
-		// Test ping
-		if err := connector.Ping(ctx); err != nil {
-			fmt.Printf("❌ Failed to ping %s: %v\n", name, err)
-			continue
-		}
+// reloadNamedQueries loads the configuration again and replaces the API's named queries with its own,
+// returning how many there are. Queries that fail to load or check leave those in use.
+func reloadNamedQueries(a *api.API, configPath string, allowWarnings bool) (int, error) {
+	cfg, err := config.LoadConfig(configPath, validateOptions(allowWarnings)...)
+	if err != nil {
+		return 0, err
+	}
+	if err := a.SetNamedQueries(namedQueries(cfg.Queries)); err != nil {
+		return 0, err
+	}
+	return len(cfg.Queries), nil
+}
 
-		fmt.Printf("✅ Successfully connected to %s\n", name)
-		fmt.Printf("   Connection status: %v\n", connector.IsConnected())
+// namedQueries maps the queries section of the configuration onto the API's named queries
+func namedQueries(queries map[string]config.QueryConfig) map[string]api.NamedQuery {
+	named := make(map[string]api.NamedQuery, len(queries))
+	for name, query := range queries {
+		params := make([]api.QueryParam, len(query.Params))
+		for i, param := range query.Params {
+			params[i] = api.QueryParam{Name: param.Name, Type: param.Type}
+		}
+		named[name] = api.NamedQuery{SQL: query.SQL, Profile: query.Profile, Description: query.Description, Params: params}
+	}
+	return named
+}
 
-		// Demonstrate operations based on database type
-		demonstrateOperations(ctx, connector)
+// validateOptions returns the configuration validation options selected by -allow-config-warnings
+func validateOptions(allowWarnings bool) []config.ValidateOption {
+	if allowWarnings {
+		return []config.ValidateOption{config.AllowWarnings()}
 	}
+	return nil
 }
 
-func demonstrateOperations(ctx context.Context, connector connectors.DBConnector) {
-	switch connector.GetType() {
-	case "mysql", "postgresql":
-		demonstrateSQLOperations(ctx, connector)
-	case "mongodb":
-		demonstrateMongoOperations(ctx, connector)
+// logConfigSource logs the configuration file that was loaded, or the paths tried when none was found
+func logConfigSource(logger *slog.Logger, cfg *config.Config, configPath string) {
+	if cfg.Source != "" {
+		logger.Info("configuration loaded", "path", cfg.Source)
+		return
 	}
+	searched := []string{configPath}
+	if configPath == "" {
+		searched = config.SearchPaths()
+	}
+	logger.Info("no configuration file found, using environment variables", "searched", searched)
 }
 
-func demonstrateSQLOperations(ctx context.Context, connector connectors.DBConnector) {
-	fmt.Printf("   Demonstrating SQL operations for %s:\n", connector.GetType())
+// newLogger builds the application logger from the configured level, format and app name
+func newLogger(cfg *config.Config) *slog.Logger {
+	return logging.New(logging.Options{
+		Level:   cfg.LogLevel,
+		Format:  cfg.LogFormat,
+		AppName: cfg.AppName,
+	})
+}
 
-	// Try to create a test table (this might fail if table exists or no permissions)
-	createTableQuery := `
-		CREATE TABLE IF NOT EXISTS test_users (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(100),
-			email VARCHAR(100),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`
+// statementPolicy builds the /execute statement policy from the server configuration
+func statementPolicy(cfg config.ServerConfig) api.StatementPolicy {
+	policy := api.DefaultStatementPolicy()
+	policy.ReadOnly = cfg.ReadOnly
+	policy.AllowMultiStatements = cfg.AllowMultiStatements
+	if cfg.DeniedStatements != nil {
+		policy.DeniedStatements = cfg.DeniedStatements
+	}
+	return policy
+}
 
-	if connector.GetType() == "mysql" {
-		createTableQuery = `
-			CREATE TABLE IF NOT EXISTS test_users (
-				id INT AUTO_INCREMENT PRIMARY KEY,
-				name VARCHAR(100),
-				email VARCHAR(100),
-				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-			)
-		`
+// corsPolicy builds the CORS policy, keeping the permissive defaults for settings left unset
+func corsPolicy(cfg config.CORSConfig) api.CORSPolicy {
+	policy := api.DefaultCORSPolicy()
+	if cfg.AllowedOrigins != nil {
+		policy.AllowedOrigins = cfg.AllowedOrigins
+	}
+	if cfg.AllowedMethods != nil {
+		policy.AllowedMethods = cfg.AllowedMethods
 	}
+	if cfg.AllowedHeaders != nil {
+		policy.AllowedHeaders = cfg.AllowedHeaders
+	}
+	policy.AllowCredentials = cfg.AllowCredentials
+	policy.MaxAge = cfg.MaxAge
+	return policy
+}
 
-	result, err := connector.Execute(ctx, "insert", map[string]interface{}{
-		"query": createTableQuery,
-	})
-	if err != nil {
-		fmt.Printf("      Note: Could not create test table: %v\n", err)
-	} else {
-		fmt.Printf("      ✓ Test table creation attempted: %v\n", result)
+// rateLimitPolicy maps the rate limit configuration onto the server policy
+func rateLimitPolicy(cfg config.RateLimitConfig) api.RateLimitPolicy {
+	policy := api.RateLimitPolicy{
+		Default: api.RateLimit{RequestsPerSecond: cfg.RequestsPerSecond, Burst: cfg.Burst},
+		IdleTTL: cfg.IdleTTL,
+	}
+	if len(cfg.Overrides) > 0 {
+		policy.Overrides = make(map[string]api.RateLimit, len(cfg.Overrides))
+		for key, value := range cfg.Overrides {
+			policy.Overrides[key] = api.RateLimit{RequestsPerSecond: value.RequestsPerSecond, Burst: value.Burst}
+		}
 	}
+	return policy
+}
 
-	// Try a simple query
-	rows, err := connector.Query(ctx, "SELECT 1 as test_column")
-	if err != nil {
-		fmt.Printf("      ❌ Failed to execute test query: %v\n", err)
-		return
+// keyPolicy builds the config key policy, keeping the defaults for settings left unset. The key
+// pattern must match whole keys and has already been checked when the configuration was validated.
+func keyPolicy(cfg config.AllConfigConfig) api.KeyPolicy {
+	policy := api.DefaultKeyPolicy()
+	if cfg.KeyMaxLength > 0 {
+		policy.MaxLength = cfg.KeyMaxLength
+	}
+	if cfg.KeyPattern != "" {
+		policy.Pattern = regexp.MustCompile("^(?:" + cfg.KeyPattern + ")$")
 	}
-	defer rows.Close()
+	policy.Lowercase = cfg.LowercaseKeys
+	policy.CaseInsensitive = cfg.CaseInsensitiveKeys
+	return policy
+}
 
-	if rows.Next() {
-		var testValue int
-		if err := rows.Scan(&testValue); err == nil {
-			fmt.Printf("      ✓ Test query successful, result: %d\n", testValue)
+// maskingPolicy builds the masking policy; its patterns have already been checked when the configuration
+// was validated
+func maskingPolicy(cfg config.MaskingConfig) api.MaskingPolicy {
+	policy := api.MaskingPolicy{BypassRole: cfg.BypassRole}
+	if cfg.HashKey != "" {
+		policy.HashKey = []byte(cfg.HashKey)
+	}
+	for _, rule := range cfg.Rules {
+		masking := api.MaskingRule{Connection: rule.Connection, Column: rule.Column, Action: api.MaskAction(rule.Action)}
+		if rule.ColumnPattern != "" {
+			masking.ColumnPattern = regexp.MustCompile(rule.ColumnPattern)
 		}
+		if rule.KeyPattern != "" {
+			masking.KeyPattern = regexp.MustCompile(rule.KeyPattern)
+		}
+		policy.Rules = append(policy.Rules, masking)
 	}
+	return policy
 }
 
-func demonstrateMongoOperations(ctx context.Context, connector connectors.DBConnector) {
-	fmt.Printf("   Demonstrating MongoDB operations:\n")
+// tenants builds the tenants of the configuration in order of their IDs
+func tenants(cfg map[string]config.TenantConfig) []api.Tenant {
+	ids := make([]string, 0, len(cfg))
+	for id := range cfg {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := make([]api.Tenant, 0, len(ids))
+	for _, id := range ids {
+		tenant := cfg[id]
+		list = append(list, api.Tenant{ID: id, TablePrefix: tenant.TablePrefix, Profile: tenant.Profile, APIKeys: tenant.APIKeys})
+	}
+	return list
+}
 
-	// Try to count documents in a test collection
-	result, err := connector.Execute(ctx, "count", map[string]interface{}{
-		"collection": "test_collection",
-		"filter":     map[string]interface{}{},
-	})
+// eventPublisher starts publishing config change events to Kafka
+func eventPublisher(cfg config.EventsConfig, logger *slog.Logger) (*events.Async, error) {
+	opts := events.KafkaOptions{Brokers: cfg.Kafka.Brokers, Topic: cfg.Kafka.Topic}
+	if tls := cfg.Kafka.TLS; tls.Enabled {
+		tlsConfig, err := events.ClientTLSConfig(tls.CAFile, tls.CertFile, tls.KeyFile, tls.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLS = tlsConfig
+	}
+	if sasl := cfg.Kafka.SASL; sasl.Mechanism != "" {
+		mechanism, err := events.NewSASLMechanism(sasl.Mechanism, sasl.Username, sasl.Password)
+		if err != nil {
+			return nil, err
+		}
+		opts.SASL = mechanism
+	}
+	publisher, err := events.NewKafkaPublisher(opts)
 	if err != nil {
-		fmt.Printf("      ❌ Failed to count documents: %v\n", err)
-		return
+		return nil, err
 	}
+	return events.NewAsync(publisher, events.Options{BufferSize: cfg.BufferSize, Logger: logger}), nil
+}
 
-	fmt.Printf("      ✓ Document count in test_collection: %v\n", result)
+// healthAlerts builds the notifications of profile health changes, posting them when a webhook URL is set
+func healthAlerts(cfg config.HealthAlertsConfig) (api.HealthAlerts, error) {
+	alerts := api.HealthAlerts{MinStateDuration: cfg.MinStateDuration}
+	if cfg.WebhookURL == "" {
+		return alerts, nil
+	}
+	client, err := webhook.New(webhook.Options{URL: cfg.WebhookURL, Headers: cfg.WebhookHeaders, Timeout: cfg.WebhookTimeout})
+	if err != nil {
+		return api.HealthAlerts{}, err
+	}
+	alerts.Webhook = client
+	return alerts, nil
+}
 
-	// Try to insert a test document
-	testDoc := map[string]interface{}{
-		"name":      "Test User",
-		"email":     "test@example.com",
-		"timestamp": time.Now(),
+// closeEventPublisher publishes the events still queued, giving up after timeout
+func closeEventPublisher(publisher *events.Async, timeout time.Duration, logger *slog.Logger) {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := publisher.Close(ctx); err != nil {
+		logger.Warn("failed to publish queued config change events", "error", err, "pending", publisher.Stats().Pending)
 	}
+}
 
-	insertResult, err := connector.Execute(ctx, "insert", map[string]interface{}{
-		"collection": "test_collection",
-		"document":   testDoc,
-	})
-	if err != nil {
-		fmt.Printf("      ❌ Failed to insert test document: %v\n", err)
-		return
+// valueLimits maps the allconfig size settings onto the value limits; unset sizes keep the defaults
+func valueLimits(cfg config.AllConfigConfig) api.ValueLimits {
+	return api.ValueLimits{
+		MaxValueBytes:       cfg.MaxValueBytes,
+		MaxDescriptionBytes: cfg.MaxDescriptionBytes,
+		LargeValueBytes:     cfg.LargeValueBytes,
 	}
+}
 
-	fmt.Printf("      ✓ Test document inserted: %v\n", insertResult)
+// valueRules builds the value rules of allconfig writes. Their patterns have already been checked when the
+// configuration was validated; their schemas are compiled here.
+func valueRules(cfg config.AllConfigConfig) (api.ValueRules, error) {
+	var rules api.ValueRules
+	for i, rule := range cfg.ValueRules {
+		valueRule := api.ValueRule{KeyPattern: regexp.MustCompile(rule.KeyPattern), Enum: rule.Enum, Min: rule.Min, Max: rule.Max}
+		if rule.Schema != "" {
+			schema, err := api.CompileJSONSchema(rule.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("allconfig.value_rules[%d]: %w", i, err)
+			}
+			valueRule.Schema = schema
+		}
+		if rule.Pattern != "" {
+			valueRule.Pattern = regexp.MustCompile("^(?:" + rule.Pattern + ")$")
+		}
+		rules = append(rules, valueRule)
+	}
+	return rules, nil
+}
 
-	// Try to find the inserted document
-	findResult, err := connector.Execute(ctx, "findOne", map[string]interface{}{
-		"collection": "test_collection",
-		"filter":     map[string]interface{}{"email": "test@example.com"},
-	})
-	if err != nil {
-		fmt.Printf("      ❌ Failed to find test document: %v\n", err)
-		return
+// profileOptions creates an unconnected connector for each connection profile, labeled with the profile
+// name and timing its statements with statements; profiles connect on first use. Profiles are rebuilt
+// with the credentials of the configuration reload loads.
+func profileOptions(cfg *config.Config, reload func() (*config.Config, error), logger *slog.Logger, statements *connectors.StatementLogger) ([]api.ServerOption, error) {
+	var opts []api.ServerOption
+	for name, profile := range cfg.ConnectionProfiles() {
+		connConfig := profile.ConnectionConfig
+		connConfig.Labels = connectors.WithConnectionLabel(profile.Labels, name)
+		connectorOpts := []connectors.Option{connectors.WithLogger(logger), connectors.WithConnectTimeout(cfg.Server.ConnectTimeout),
+			connectors.WithStatementLogger(statements)}
+		connector, err := connectors.New(profile.Type, &connConfig, connectorOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		opts = append(opts, api.WithProfile(api.ConnectionProfile{
+			Name:      name,
+			Connector: connector,
+			Host:      connConfig.Host,
+			Port:      connConfig.Port,
+			Database:  connConfig.Database,
+			URI:       connConfig.URI,
+			Labels:    connConfig.Labels,
+			TableName: profile.TableName,
+			Rebuild:   rebuildProfile(name, profile.Type, connConfig, reload, connectorOpts...),
+		}))
+	}
+	if cfg.DefaultProfile != "" {
+		opts = append(opts, api.WithDefaultProfile(cfg.DefaultProfile))
 	}
+	return opts, nil
+}
 
-	fmt.Printf("      ✓ Found test document: %v\n", findResult != nil)
+// rebuildProfile returns the Rebuild of a connection profile: it loads the configuration again, so that a
+// rotated password is picked up from the file or the environment, and builds a connector with the profile's
+// credentials found there. The host, port and database stay those the server started with; a URI carries
+// its credentials, so it is taken as configured now.
+func rebuildProfile(name, dbType string, connConfig connectors.ConnectionConfig, reload func() (*config.Config, error), opts ...connectors.Option) func() (connectors.DBConnector, error) {
+	return func() (connectors.DBConnector, error) {
+		cfg, err := reload()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve credentials: %w", err)
+		}
+		current, ok := cfg.ConnectionProfiles()[name]
+		if !ok {
+			return nil, fmt.Errorf("profile %s is no longer configured", name)
+		}
+		rebuilt := connConfig
+		rebuilt.Username, rebuilt.Password, rebuilt.URI = current.Username, current.Password, current.URI
+		return connectors.New(dbType, &rebuilt, opts...)
+	}
+}
 
-	// Clean up - delete the test document
-	_, err = connector.Execute(ctx, "delete", map[string]interface{}{
-		"collection": "test_collection",
-		"filter":     map[string]interface{}{"email": "test@example.com"},
-	})
-	if err != nil {
-		fmt.Printf("      ❌ Failed to clean up test document: %v\n", err)
-	} else {
-		fmt.Printf("      ✓ Test document cleaned up\n")
+// jobOptions maps the jobs configuration onto job manager options
+func jobOptions(cfg config.JobsConfig) jobs.Options {
+	return jobs.Options{
+		Workers:        cfg.Workers,
+		QueueSize:      cfg.QueueSize,
+		MaxResultRows:  cfg.MaxResultRows,
+		MaxResultBytes: cfg.MaxResultBytes,
+		ResultTTL:      cfg.ResultTTL,
+		JobTimeout:     cfg.JobTimeout,
+		SpoolDir:       cfg.SpoolDir,
 	}
 }
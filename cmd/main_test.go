@@ -1,11 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"db-connectors/api"
+	"db-connectors/config"
+	"db-connectors/connectors"
+	"db-connectors/connectors/connectortest"
+	"db-connectors/events"
+	"db-connectors/logging"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestMain tests the main function components
@@ -65,6 +80,55 @@ func TestMain(t *testing.T) {
 	}
 }
 
+// TestResolveServerConfig tests that flags override the environment, which overrides the file
+func TestResolveServerConfig(t *testing.T) {
+	newFlags := func(args ...string) *flag.FlagSet {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Int("port", defaultPort, "")
+		flags.String("host", "", "")
+		flags.String("mode", "api", "")
+		require.NoError(t, flags.Parse(args))
+		return flags
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		server := resolveServerConfig(config.ServerConfig{}, newFlags())
+		assert.Equal(t, defaultPort, server.Port)
+		assert.Empty(t, server.Host)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		file := config.ServerConfig{Port: 9000, Host: "10.0.0.1", MaxRequestBytes: 1 << 20}
+		server := resolveServerConfig(file, newFlags("-mode", "api"))
+		assert.Equal(t, file, server)
+	})
+
+	t.Run("environment over file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("server:\n  port: 9000\n  host: 10.0.0.1\n"), 0644))
+		t.Setenv("PORT", "9100")
+		t.Setenv("SERVER_HOST", "127.0.0.1")
+
+		cfg, err := config.LoadConfig(path)
+		require.NoError(t, err)
+		server := resolveServerConfig(cfg.Server, newFlags())
+		assert.Equal(t, 9100, server.Port)
+		assert.Equal(t, "127.0.0.1", server.Host)
+
+		// Flags win over both
+		server = resolveServerConfig(cfg.Server, newFlags("-port", "9200", "-host", "0.0.0.0"))
+		assert.Equal(t, 9200, server.Port)
+		assert.Equal(t, "0.0.0.0", server.Host)
+	})
+
+	t.Run("flag equal to the default still overrides", func(t *testing.T) {
+		server := resolveServerConfig(config.ServerConfig{Port: 9000, Host: "10.0.0.1"}, newFlags("-port", "8080", "-host", ""))
+		assert.Equal(t, 8080, server.Port)
+		assert.Empty(t, server.Host)
+	})
+}
+
 // TestEnvironmentVariableParsing tests environment variable parsing
 func TestEnvironmentVariableParsing(t *testing.T) {
 	tests := []struct {
@@ -283,12 +347,15 @@ func TestHostValidation(t *testing.T) {
 	}
 }
 
-// TestVersionInfo tests version information
+// TestVersionInfo tests the -version output and the build info reported by /health
 func TestVersionInfo(t *testing.T) {
-	// Test version variable (would be set via ldflags in real build)
-	version := "1.0.0" // This would be a package variable
-	assert.NotEmpty(t, version)
-	assert.Regexp(t, `^\d+\.\d+\.\d+`, version) // Basic semver pattern
+	assert.Equal(t, "db-connectors dev (commit unknown, built unknown)", versionString())
+
+	// Values injected with -ldflags "-X main.Version=..."
+	defer func(version, commit, buildDate string) { Version, Commit, BuildDate = version, commit, buildDate }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "1.4.0", "3f2c1ab", "2024-05-06T07:08:09Z"
+	assert.Regexp(t, `^db-connectors \d+\.\d+\.\d+ \(commit [0-9a-f]+, built \S+\)$`, versionString())
+	assert.Equal(t, api.BuildInfo{Version: "1.4.0", Commit: "3f2c1ab", BuildDate: "2024-05-06T07:08:09Z"}, buildInfo())
 }
 
 // TestApplicationName tests application name constant
@@ -411,3 +478,283 @@ func BenchmarkEnvironmentVariableAccess(b *testing.B) {
 		_ = os.Getenv("HOST")
 	}
 }
+
+// TestStatementPolicy tests building the /execute policy from server configuration
+func TestStatementPolicy(t *testing.T) {
+	policy := statementPolicy(config.ServerConfig{})
+	assert.False(t, policy.ReadOnly)
+	assert.False(t, policy.AllowMultiStatements)
+	assert.Equal(t, api.DefaultDeniedStatements, policy.DeniedStatements)
+
+	policy = statementPolicy(config.ServerConfig{ReadOnly: true, DeniedStatements: []string{}, AllowMultiStatements: true})
+	assert.True(t, policy.ReadOnly)
+	assert.True(t, policy.AllowMultiStatements)
+	assert.Empty(t, policy.DeniedStatements)
+}
+
+func TestCORSPolicy(t *testing.T) {
+	policy := corsPolicy(config.CORSConfig{})
+	assert.Equal(t, api.DefaultCORSPolicy(), policy)
+	assert.True(t, policy.AllowsAnyOrigin())
+
+	policy = corsPolicy(config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	assert.False(t, policy.AllowsAnyOrigin())
+	assert.Equal(t, api.DefaultCORSPolicy().AllowedMethods, policy.AllowedMethods)
+	assert.True(t, policy.AllowCredentials)
+	assert.Equal(t, 10*time.Minute, policy.MaxAge)
+}
+
+func TestRateLimitPolicy(t *testing.T) {
+	policy := rateLimitPolicy(config.RateLimitConfig{
+		Enabled:           true,
+		RequestsPerSecond: 5,
+		Burst:             10,
+		IdleTTL:           time.Minute,
+		Overrides: map[string]config.RateLimitValue{
+			"reporting-key": {RequestsPerSecond: 50, Burst: 100},
+		},
+	})
+	assert.Equal(t, api.RateLimit{RequestsPerSecond: 5, Burst: 10}, policy.Default)
+	assert.Equal(t, time.Minute, policy.IdleTTL)
+	assert.Equal(t, api.RateLimit{RequestsPerSecond: 50, Burst: 100}, policy.Overrides["reporting-key"])
+
+	assert.Nil(t, rateLimitPolicy(config.RateLimitConfig{}).Overrides)
+}
+
+func TestKeyPolicy(t *testing.T) {
+	assert.Equal(t, api.DefaultKeyPolicy(), keyPolicy(config.AllConfigConfig{}))
+
+	policy := keyPolicy(config.AllConfigConfig{KeyMaxLength: 64, KeyPattern: "[a-z]+|[0-9]+", LowercaseKeys: true, CaseInsensitiveKeys: true})
+	assert.Equal(t, 64, policy.MaxLength)
+	assert.True(t, policy.Lowercase)
+	assert.True(t, policy.CaseInsensitive)
+	// The pattern must match the whole key
+	assert.True(t, policy.Pattern.MatchString("abc"))
+	assert.False(t, policy.Pattern.MatchString("abc1"))
+}
+
+func TestMaskingPolicy(t *testing.T) {
+	policy := maskingPolicy(config.MaskingConfig{
+		HashKey: "pepper",
+		Rules: []config.MaskingRuleConfig{
+			{Connection: "billing", Column: "customers.card_number", Action: "partial"},
+			{ColumnPattern: "(?i)email", Action: "hash"},
+			{KeyPattern: "secret", Action: "redact"},
+		},
+	})
+	assert.Equal(t, []byte("pepper"), policy.HashKey)
+	require.Len(t, policy.Rules, 3)
+	assert.Equal(t, api.MaskingRule{Connection: "billing", Column: "customers.card_number", Action: api.MaskPartial}, policy.Rules[0])
+	assert.True(t, policy.Rules[1].ColumnPattern.MatchString("Email"))
+	assert.Nil(t, policy.Rules[1].KeyPattern)
+	assert.True(t, policy.Rules[2].KeyPattern.MatchString("db.secret"))
+	assert.Equal(t, api.MaskRedact, policy.Rules[2].Action)
+}
+
+func TestTenants(t *testing.T) {
+	assert.Equal(t, []api.Tenant{
+		{ID: "acme", TablePrefix: "acme_", Profile: "shared", APIKeys: []string{"acme-key"}},
+		{ID: "globex", TablePrefix: "globex_"},
+	}, tenants(map[string]config.TenantConfig{
+		"globex": {TablePrefix: "globex_"},
+		"acme":   {TablePrefix: "acme_", Profile: "shared", APIKeys: []string{"acme-key"}},
+	}))
+}
+
+func TestEventPublisher(t *testing.T) {
+	cfg := config.EventsConfig{
+		Enabled: true,
+		Kafka: config.KafkaConfig{
+			Brokers: []string{"kafka:9093"},
+			Topic:   "config-changes",
+			TLS:     config.KafkaTLSConfig{Enabled: true, InsecureSkipVerify: true},
+			SASL:    config.KafkaSASLConfig{Mechanism: "scram-sha-256", Username: "app", Password: "secret"},
+		},
+	}
+	publisher, err := eventPublisher(cfg, logging.Discard())
+	require.NoError(t, err)
+	closeEventPublisher(publisher, time.Second, logging.Discard())
+	assert.ErrorIs(t, publisher.Close(context.Background()), events.ErrClosed)
+
+	cfg.Kafka.TLS.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = eventPublisher(cfg, logging.Discard())
+	assert.ErrorContains(t, err, "failed to read CA file")
+}
+
+func TestHealthAlerts(t *testing.T) {
+	alerts, err := healthAlerts(config.HealthAlertsConfig{MinStateDuration: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, api.HealthAlerts{MinStateDuration: time.Minute}, alerts)
+
+	alerts, err = healthAlerts(config.HealthAlertsConfig{WebhookURL: "https://alerts.internal/hooks/db"})
+	require.NoError(t, err)
+	assert.NotNil(t, alerts.Webhook)
+
+	_, err = healthAlerts(config.HealthAlertsConfig{WebhookURL: "alerts.internal/hooks/db"})
+	assert.ErrorContains(t, err, "invalid webhook URL")
+}
+
+func TestValueLimits(t *testing.T) {
+	limits := valueLimits(config.AllConfigConfig{MaxValueBytes: 2048, MaxDescriptionBytes: 256, LargeValueBytes: 512})
+	assert.Equal(t, api.ValueLimits{MaxValueBytes: 2048, MaxDescriptionBytes: 256, LargeValueBytes: 512}, limits)
+}
+
+func TestValueRules(t *testing.T) {
+	max := 10.0
+	rules, err := valueRules(config.AllConfigConfig{ValueRules: []config.ValueRuleConfig{
+		{KeyPattern: `^limits\.`, Max: &max},
+		{KeyPattern: "mode$", Pattern: "on|off", Schema: `{"type": "string"}`},
+	}})
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, &max, rules[0].Max)
+	assert.Nil(t, rules[0].Schema)
+	assert.True(t, rules[1].KeyPattern.MatchString("app.mode"))
+	// The value pattern must match the whole value
+	assert.False(t, rules[1].Pattern.MatchString("often"))
+	assert.JSONEq(t, `{"type": "string"}`, string(rules[1].Schema.Source))
+
+	_, err = valueRules(config.AllConfigConfig{ValueRules: []config.ValueRuleConfig{{KeyPattern: "x", Schema: `{"if": {}}`}}})
+	assert.EqualError(t, err, `allconfig.value_rules[0]: JSON Schema: unsupported keyword "if"`)
+}
+
+func TestProfileOptions(t *testing.T) {
+	cfg := &config.Config{
+		Databases: connectors.DatabaseConfig{
+			MySQL: &connectors.ConnectionConfig{Host: "localhost", Port: 3306, Database: "testdb"},
+		},
+		Profiles: map[string]config.ProfileConfig{
+			"reporting": {Type: "postgresql", ConnectionConfig: connectors.ConnectionConfig{Host: "reports", Port: 5432, Database: "reports",
+				Labels: map[string]string{"environment": "prod"}}},
+		},
+		DefaultProfile: "reporting",
+	}
+	opts, err := profileOptions(cfg, nil, logging.Discard(), nil)
+	assert.NoError(t, err)
+	assert.Len(t, opts, 3)
+
+	// Profiles are labeled with their name, leaving the configured labels as they are
+	server := api.NewServer(config.ServerConfig{Port: 8080}, opts...)
+	rr := httptest.NewRecorder()
+	api.SetupRoutes(server.API()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/connections", nil))
+	assert.Contains(t, rr.Body.String(), `"labels":{"connection":"reporting","environment":"prod"}`)
+	assert.Contains(t, rr.Body.String(), `"labels":{"connection":"mysql"}`)
+	assert.Equal(t, map[string]string{"environment": "prod"}, cfg.Profiles["reporting"].Labels)
+
+	cfg.Profiles["broken"] = config.ProfileConfig{Type: "oracle"}
+	_, err = profileOptions(cfg, nil, logging.Discard(), nil)
+	assert.Error(t, err)
+}
+
+// rebuildDriver is a connector type whose connectors keep the configuration they were built with
+const rebuildDriver = "rebuildtest"
+
+// rebuiltConfig is the configuration the last rebuildtest connector was built with
+var rebuiltConfig *connectors.ConnectionConfig
+
+func init() {
+	connectors.RegisterDriver(rebuildDriver, func(config *connectors.ConnectionConfig, opts ...connectors.Option) connectors.DBConnector {
+		rebuiltConfig = config
+		return new(connectortest.MockDBConnector)
+	})
+}
+
+func TestRebuildProfile(t *testing.T) {
+	configured := config.ProfileConfig{Type: rebuildDriver, ConnectionConfig: connectors.ConnectionConfig{Host: "reports", Port: 5432, Database: "reports",
+		Username: "app", Password: "rotated"}}
+	reload := func() (*config.Config, error) {
+		return &config.Config{Profiles: map[string]config.ProfileConfig{"reporting": configured}}, nil
+	}
+	started := connectors.ConnectionConfig{Host: "reports", Port: 5432, Database: "reports", Username: "app", Password: "old",
+		Labels: map[string]string{"connection": "reporting"}}
+
+	// The credentials are those configured now, and the rest is kept
+	connector, err := rebuildProfile("reporting", rebuildDriver, started, reload)()
+	require.NoError(t, err)
+	assert.NotNil(t, connector)
+	assert.Equal(t, "rotated", rebuiltConfig.Password)
+	assert.Equal(t, map[string]string{"connection": "reporting"}, rebuiltConfig.Labels)
+	assert.Equal(t, "old", started.Password)
+
+	configured.Host = "elsewhere"
+	_, err = rebuildProfile("reporting", rebuildDriver, started, reload)()
+	require.NoError(t, err)
+	assert.Equal(t, "reports", rebuiltConfig.Host)
+
+	_, err = rebuildProfile("removed", rebuildDriver, started, reload)()
+	assert.EqualError(t, err, "profile removed is no longer configured")
+	_, err = rebuildProfile("reporting", rebuildDriver, started, func() (*config.Config, error) {
+		return nil, config.ErrInvalidConfig
+	})()
+	assert.ErrorIs(t, err, config.ErrInvalidConfig)
+}
+
+func TestLogConfigSource(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logConfigSource(logger, &config.Config{Source: "/etc/db-connectors/config.yaml"}, "")
+	assert.Contains(t, buf.String(), `msg="configuration loaded" path=/etc/db-connectors/config.yaml`)
+
+	buf.Reset()
+	logConfigSource(logger, &config.Config{}, "missing.yaml")
+	assert.Contains(t, buf.String(), "searched=[missing.yaml]")
+
+	buf.Reset()
+	t.Setenv(config.PathEnvVar, "")
+	logConfigSource(logger, &config.Config{}, "")
+	assert.Contains(t, buf.String(), "no configuration file found")
+	assert.Contains(t, buf.String(), "config.yaml")
+}
+
+func TestServeShutsDownWhenContextIsDone(t *testing.T) {
+	conn := new(connectortest.MockDBConnector)
+	conn.On("Close").Return(nil)
+	server := api.NewServer(config.ServerConfig{}, api.WithHost("127.0.0.1"), api.WithProfile(api.ConnectionProfile{Name: "primary", Connector: conn}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, serve(ctx, server, time.Second, discardLogger))
+	conn.AssertCalled(t, "Close")
+
+	// A server that cannot start is reported without waiting for a signal
+	broken := api.NewServer(config.ServerConfig{}, api.WithTLS(api.TLSOptions{CertFile: "missing.crt", KeyFile: "missing.key"}))
+	assert.Error(t, serve(context.Background(), broken, time.Second, discardLogger))
+}
+
+func TestReloadNamedQueries(t *testing.T) {
+	conn := new(connectortest.MockDBConnector)
+	conn.On("GetType").Return("postgresql")
+	server := api.NewServer(config.ServerConfig{}, api.WithProfile(api.ConnectionProfile{Name: "reporting", Connector: conn}), api.WithDefaultProfile("reporting"))
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+queries:
+  active_users_by_day:
+    sql: "SELECT user_id FROM logins WHERE login_date = :day"
+    params:
+      - name: day
+        type: date
+`), 0644))
+	count, err := reloadNamedQueries(server.API(), path, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+queries:
+  purge:
+    sql: "DELETE FROM logins"
+`), 0644))
+	_, err = reloadNamedQueries(server.API(), path, true)
+	assert.EqualError(t, err, "query purge: named queries may only read, got DELETE")
+
+	assert.Equal(t, map[string]api.NamedQuery{
+		"q": {SQL: "SELECT :a", Profile: "reporting", Params: []api.QueryParam{{Name: "a", Type: "int"}}},
+	}, namedQueries(map[string]config.QueryConfig{
+		"q": {SQL: "SELECT :a", Profile: "reporting", Params: []config.QueryParamConfig{{Name: "a", Type: "int"}}},
+	}))
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"db-connectors/api"
+	"db-connectors/config"
+	"db-connectors/connectors"
+	"db-connectors/jobs"
+	"db-connectors/logging"
+)
+
+// Exit codes of the query and allconfig subcommands
+const (
+	exitSuccess    = 0 // At least one row was returned or affected
+	exitUsage      = 1 // Invalid flags, configuration or connection name
+	exitConnection = 2 // Connecting to the database failed
+	exitFailed     = 3 // The statement or operation failed
+	exitNoRows     = 4 // Succeeded without returning or affecting any rows, or the config does not exist
+)
+
+// Output formats of the query subcommand
+var queryOutputs = []string{"table", "json", "csv"}
+
+// queryOptions are the flags of the query subcommand
+type queryOptions struct {
+	configPath    string
+	allowWarnings bool
+	conn          string
+	connection    connectors.ConnectionConfig // Explicit connection flags, overriding the named connection
+	dbType        string
+	statement     string
+	operation     string
+	params        string
+	output        string
+	timeout       time.Duration
+}
+
+// parseQueryFlags parses the arguments following the query subcommand
+func parseQueryFlags(args []string, stderr io.Writer) (*queryOptions, error) {
+	opts := &queryOptions{}
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.configPath, "config", "", "Path to the configuration file; searched for like in API mode when empty")
+	flags.BoolVar(&opts.allowWarnings, "allow-config-warnings", false, "Use the configuration despite warnings such as empty database passwords")
+	flags.StringVar(&opts.conn, "conn", "", "Named connection: a databases entry or connection profile")
+	flags.StringVar(&opts.dbType, "type", "", "Database type when not using -conn: "+strings.Join(connectors.Drivers(), ", "))
+	flags.StringVar(&opts.connection.Host, "host", "", "Database host")
+	flags.IntVar(&opts.connection.Port, "port", 0, "Database port")
+	flags.StringVar(&opts.connection.Username, "user", "", "Database user")
+	flags.StringVar(&opts.connection.Password, "password", "", "Database password")
+	flags.StringVar(&opts.connection.Database, "database", "", "Database name")
+	flags.StringVar(&opts.connection.SSLMode, "ssl-mode", "", "PostgreSQL SSL mode")
+	flags.StringVar(&opts.connection.URI, "uri", "", "Connection URI or DSN, used instead of -host, -port, -user, -password and -database")
+	flags.StringVar(&opts.statement, "sql", "", "SQL statement to run")
+	flags.StringVar(&opts.operation, "op", "", "Operation: query or execute for SQL (inferred from -sql when empty), or a MongoDB operation such as find or count")
+	flags.StringVar(&opts.params, "params", "", "JSON object of MongoDB operation parameters, such as {\"collection\": \"users\"}")
+	flags.StringVar(&opts.output, "output", "table", "Output format: "+strings.Join(queryOutputs, ", "))
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "Timeout for connecting and running the operation")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	valid := false
+	for _, output := range queryOutputs {
+		valid = valid || opts.output == output
+	}
+	if !valid {
+		return nil, fmt.Errorf("-output must be one of %s", strings.Join(queryOutputs, ", "))
+	}
+	return opts, nil
+}
+
+// runQuery runs the query subcommand, writing the result to stdout and diagnostics to stderr,
+// and returns the process exit code
+func runQuery(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseQueryFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitSuccess
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "query:", err)
+		return exitUsage
+	}
+
+	dbType, connConfig, err := resolveQueryConnection(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "query:", err)
+		return exitUsage
+	}
+	req, err := queryRequest(opts, dbType)
+	if err != nil {
+		fmt.Fprintln(stderr, "query:", err)
+		return exitUsage
+	}
+
+	logger := logging.New(logging.Options{Level: "warn", Output: stderr})
+	connector, err := connectors.New(dbType, connConfig, connectors.WithLogger(logger))
+	if err != nil {
+		fmt.Fprintln(stderr, "query:", err)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	if err := connector.Connect(ctx); err != nil {
+		fmt.Fprintln(stderr, "query: connection failed:", err)
+		return exitConnection
+	}
+	defer connector.Close(ctx)
+
+	result := newQueryResult()
+	if err := api.NewAPI().RunOperation(ctx, connector, req, result); err != nil {
+		fmt.Fprintln(stderr, "query: operation failed:", err)
+		return exitFailed
+	}
+	if err := writeQueryResult(stdout, result, opts.output); err != nil {
+		fmt.Fprintln(stderr, "query: failed to write result:", err)
+		return exitFailed
+	}
+	if result.empty() {
+		return exitNoRows
+	}
+	return exitSuccess
+}
+
+// resolveQueryConnection returns the database type and connection settings named by -conn, with
+// any explicit connection flags applied on top, or those given entirely by flags
+func resolveQueryConnection(opts *queryOptions) (string, *connectors.ConnectionConfig, error) {
+	dbType, connConfig := opts.dbType, opts.connection
+	if opts.conn != "" {
+		_, profile, err := loadNamedConnection(opts.configPath, opts.allowWarnings, opts.conn)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if dbType == "" {
+			dbType = profile.Type
+		}
+		connConfig = profile.ConnectionConfig
+		overrideConnection(&connConfig, opts.connection)
+	}
+
+	if dbType == "" {
+		return "", nil, errors.New("either -conn or -type is required")
+	}
+	if !connectors.IsRegistered(dbType) {
+		return "", nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	if err := connConfig.Validate(); err != nil {
+		return "", nil, err
+	}
+	if err := connConfig.CheckURI(dbType); err != nil {
+		return "", nil, err
+	}
+	return dbType, &connConfig, nil
+}
+
+// loadNamedConnection loads the configuration and returns it with the databases entry or connection profile called name
+func loadNamedConnection(configPath string, allowWarnings bool, name string) (*config.Config, config.ProfileConfig, error) {
+	cfg, err := config.LoadConfig(configPath, validateOptions(allowWarnings)...)
+	if err != nil {
+		return nil, config.ProfileConfig{}, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	profiles := cfg.ConnectionProfiles()
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, config.ProfileConfig{}, fmt.Errorf("unknown connection %q; configured connections: %s", name, strings.Join(names, ", "))
+	}
+	return cfg, profile, nil
+}
+
+// overrideConnection copies the non-empty settings of flags onto connConfig
+func overrideConnection(connConfig *connectors.ConnectionConfig, flags connectors.ConnectionConfig) {
+	if flags.Host != "" {
+		connConfig.Host = flags.Host
+	}
+	if flags.Port != 0 {
+		connConfig.Port = flags.Port
+	}
+	if flags.Username != "" {
+		connConfig.Username = flags.Username
+	}
+	if flags.Password != "" {
+		connConfig.Password = flags.Password
+	}
+	if flags.Database != "" {
+		connConfig.Database = flags.Database
+	}
+	if flags.SSLMode != "" {
+		connConfig.SSLMode = flags.SSLMode
+	}
+	if flags.URI != "" {
+		connConfig.URI = flags.URI
+	}
+}
+
+// queryRequest builds the operation to run. SQL statements run as queries unless they write,
+// other databases default to find.
+func queryRequest(opts *queryOptions, dbType string) (*api.DatabaseOperationRequest, error) {
+	req := &api.DatabaseOperationRequest{
+		DatabaseConnectionRequest: api.DatabaseConnectionRequest{Type: dbType},
+		Operation:                 opts.operation,
+		Query:                     opts.statement,
+	}
+
+	switch dbType {
+	case "mysql", "postgresql":
+		if opts.statement == "" {
+			return nil, errors.New("-sql is required for SQL databases")
+		}
+		if req.Operation == "" {
+			req.Operation = "execute"
+			if class, _ := api.ClassifySQL(dbType, opts.statement); class == api.StatementRead {
+				req.Operation = "query"
+			}
+		}
+	default:
+		if req.Operation == "" {
+			req.Operation = "find"
+		}
+		if opts.params != "" {
+			if err := json.Unmarshal([]byte(opts.params), &req.Params); err != nil {
+				return nil, fmt.Errorf("-params must be a JSON object: %w", err)
+			}
+		}
+	}
+	if err := api.ValidateOperation(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// queryResult collects an operation's rows as JSON Lines, the form job results are stored in,
+// so that values are formatted the same way as by GET /jobs/{id}/result
+type queryResult struct {
+	columns      []string
+	seen         map[string]bool
+	fixed        bool
+	lines        bytes.Buffer
+	rows         int
+	rowsAffected *int64
+}
+
+func newQueryResult() *queryResult {
+	return &queryResult{seen: make(map[string]bool)}
+}
+
+func (r *queryResult) SetColumns(columns []string) {
+	r.columns = append([]string(nil), columns...)
+	r.fixed = true
+}
+
+func (r *queryResult) WriteRow(row map[string]interface{}) error {
+	line, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("failed to encode result row: %w", err)
+	}
+	r.lines.Write(line)
+	r.lines.WriteByte('\n')
+	r.rows++
+
+	if !r.fixed {
+		// Rows without fixed columns contribute their keys in sorted order
+		keys := make([]string, 0, len(row))
+		for key := range row {
+			if !r.seen[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			r.seen[key] = true
+			r.columns = append(r.columns, key)
+		}
+	}
+	return nil
+}
+
+func (r *queryResult) SetRowsAffected(n int64) {
+	r.rowsAffected = &n
+}
+
+// empty reports whether no rows were returned or affected
+func (r *queryResult) empty() bool {
+	return r.rows == 0 && (r.rowsAffected == nil || *r.rowsAffected == 0)
+}
+
+// writeCSV writes the rows as CSV with a header row
+func (r *queryResult) writeCSV(w io.Writer) error {
+	result := &jobs.Result{
+		ReadCloser: io.NopCloser(bytes.NewReader(r.lines.Bytes())),
+		Columns:    r.columns,
+		Rows:       r.rows,
+	}
+	return result.WriteCSV(w)
+}
+
+// writeQueryResult writes the result as an aligned table, a JSON array or CSV. Write statements
+// report the affected row count instead of rows.
+func writeQueryResult(w io.Writer, r *queryResult, output string) error {
+	if r.rows == 0 && r.rowsAffected != nil {
+		switch output {
+		case "json":
+			return json.NewEncoder(w).Encode(map[string]int64{"rows_affected": *r.rowsAffected})
+		case "csv":
+			_, err := fmt.Fprintf(w, "rows_affected\n%d\n", *r.rowsAffected)
+			return err
+		default:
+			_, err := fmt.Fprintf(w, "%d rows affected\n", *r.rowsAffected)
+			return err
+		}
+	}
+
+	switch output {
+	case "json":
+		rows := make([]json.RawMessage, 0, r.rows)
+		for _, line := range bytes.Split(bytes.TrimSuffix(r.lines.Bytes(), []byte("\n")), []byte("\n")) {
+			if len(line) > 0 {
+				rows = append(rows, line)
+			}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "csv":
+		return r.writeCSV(w)
+	default:
+		return r.writeTable(w)
+	}
+}
+
+// writeTable writes the rows as columns aligned with spaces, followed by the row count.
+// Values are formatted as in CSV output with line breaks flattened to spaces.
+func (r *queryResult) writeTable(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := r.writeCSV(&buf); err != nil {
+		return err
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, record := range records {
+		for i, field := range record {
+			record[i] = strings.NewReplacer("\r\n", " ", "\n", " ", "\t", " ").Replace(field)
+		}
+		fmt.Fprintln(table, strings.Join(record, "\t"))
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	noun := "rows"
+	if r.rows == 1 {
+		noun = "row"
+	}
+	_, err = fmt.Fprintf(w, "(%d %s)\n", r.rows, noun)
+	return err
+}
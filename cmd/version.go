@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"db-connectors/api"
+)
+
+// Build information, injected at build time with
+//
+//	go build -ldflags "-X main.Version=1.2.0 -X main.Commit=$(git rev-parse --short HEAD) -X main.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// buildInfo returns the build information reported by /health
+func buildInfo() api.BuildInfo {
+	return api.BuildInfo{Version: Version, Commit: Commit, BuildDate: BuildDate}
+}
+
+// versionString returns the line printed by -version
+func versionString() string {
+	return fmt.Sprintf("db-connectors %s (commit %s, built %s)", Version, Commit, BuildDate)
+}
@@ -1,27 +1,268 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"db-connectors/connectors"
-	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Databases connectors.DatabaseConfig `yaml:"databases"`
-	LogLevel  string                    `yaml:"log_level,omitempty"`
-	AppName   string                    `yaml:"app_name,omitempty"`
+	Databases connectors.DatabaseConfig `yaml:"databases" json:"databases"`
+	// Named connections served by /v1/configs; the databases entries are also available as
+	// the profiles "mysql", "postgresql" and "mongodb"
+	Profiles       map[string]ProfileConfig `yaml:"profiles,omitempty" json:"profiles,omitempty"`
+	DefaultProfile string                   `yaml:"default_profile,omitempty" json:"default_profile,omitempty"` // Used when a request names no profile
+	Tenants        map[string]TenantConfig  `yaml:"tenants,omitempty" json:"tenants,omitempty"`                 // By tenant ID; each tenant's requests use allconfig tables of its own
+	Server         ServerConfig             `yaml:"server,omitempty" json:"server,omitempty"`
+	Jobs           JobsConfig               `yaml:"jobs,omitempty" json:"jobs,omitempty"`
+	Events         EventsConfig             `yaml:"events,omitempty" json:"events,omitempty"` // Publishes config changes for downstream consumers
+	AllConfig      AllConfigConfig          `yaml:"allconfig,omitempty" json:"allconfig,omitempty"`
+	Queries        map[string]QueryConfig   `yaml:"queries,omitempty" json:"queries,omitempty"` // Named queries run by the named_query operation of /execute
+	Masking        MaskingConfig            `yaml:"masking,omitempty" json:"masking,omitempty"` // Masks sensitive columns in query results and sensitive allconfig values
+	LogLevel       string                   `yaml:"log_level,omitempty" json:"log_level,omitempty"`
+	LogFormat      string                   `yaml:"log_format,omitempty" json:"log_format,omitempty"` // console (default) or json
+	AppName        string                   `yaml:"app_name,omitempty" json:"app_name,omitempty"`
+
+	Source string `yaml:"-" json:"-"` // File the configuration was loaded from; empty when no file was found
+}
+
+// ProfileConfig represents a named database connection
+type ProfileConfig struct {
+	Type                        string `yaml:"type" json:"type"` // mysql, postgresql or mongodb
+	connectors.ConnectionConfig `yaml:",inline"`
+	TableName                   string `yaml:"table_name,omitempty" json:"table_name,omitempty"` // allconfig table, defaults to allconfig.table
+}
+
+// TenantConfig represents a tenant sharing the databases with others, named by the X-Tenant-ID header or
+// identified by its API keys, whose allconfig and approval tables are named by its prefix
+type TenantConfig struct {
+	TablePrefix string   `yaml:"table_prefix" json:"table_prefix"`             // Prepended to allconfig.table, such as "acme_" for acme_allconfig
+	Profile     string   `yaml:"profile,omitempty" json:"profile,omitempty"`   // Connection profile of the tenant's config resources; empty allows any
+	APIKeys     []string `yaml:"api_keys,omitempty" json:"api_keys,omitempty"` // X-API-Key values identifying the tenant without the header
+}
+
+// AllConfigConfig represents the tables used by the allconfig and maker-checker endpoints
+type AllConfigConfig struct {
+	Table               string `yaml:"table,omitempty" json:"table,omitempty"`                                 // Used when a request or profile names no table, defaults to "allconfig"
+	Schema              string `yaml:"schema,omitempty" json:"schema,omitempty"`                               // PostgreSQL schema, or MySQL database, of the SQL allconfig tables when a request names none
+	ApprovalSuffix      string `yaml:"approval_suffix,omitempty" json:"approval_suffix,omitempty"`             // Appended to the table name to name the approval requests table, defaults to "_approval_requests"
+	KeyMaxLength        int    `yaml:"key_max_length,omitempty" json:"key_max_length,omitempty"`               // Longest config key accepted on create, in characters; defaults to 255 to match the config_key column
+	KeyPattern          string `yaml:"key_pattern,omitempty" json:"key_pattern,omitempty"`                     // Regular expression new config keys must match in full, defaults to letters, digits and . _ - /
+	LowercaseKeys       bool   `yaml:"lowercase_keys,omitempty" json:"lowercase_keys,omitempty"`               // Lowercase config keys in every operation, so keys differing in case are the same config
+	CaseInsensitiveKeys bool   `yaml:"case_insensitive_keys,omitempty" json:"case_insensitive_keys,omitempty"` // Look config keys up regardless of case unless a request sets case_insensitive
+	MaxValueBytes       int    `yaml:"max_value_bytes,omitempty" json:"max_value_bytes,omitempty"`             // Largest config value accepted, defaults to 1 MiB
+	MaxDescriptionBytes int    `yaml:"max_description_bytes,omitempty" json:"max_description_bytes,omitempty"` // Largest config description accepted, defaults to 4 KiB
+	LargeValueBytes     int    `yaml:"large_value_bytes,omitempty" json:"large_value_bytes,omitempty"`         // List operations leave out larger values, defaults to 64 KiB
+	NotifyChanges       bool   `yaml:"notify_changes,omitempty" json:"notify_changes,omitempty"`               // Notify changes to PostgreSQL allconfig tables with NOTIFY and listen for them to drop cached results
+
+	// Rules the values of direct writes, submissions and approvals must satisfy
+	ValueRules []ValueRuleConfig `yaml:"value_rules,omitempty" json:"value_rules,omitempty"`
+
+	// Interval of the sweeps deleting the SQL configs past their expires_at; unset leaves them to expire_configs
+	ExpirySweepInterval time.Duration `yaml:"expiry_sweep_interval,omitempty" json:"expiry_sweep_interval,omitempty"`
+
+	// Interval of the counts of pending approval requests /metrics reports; unset counts none
+	PendingRefreshInterval time.Duration `yaml:"pending_refresh_interval,omitempty" json:"pending_refresh_interval,omitempty"`
+}
+
+// ValueRuleConfig constrains the values of the allconfig keys matching key_pattern; every constraint set
+// applies
+type ValueRuleConfig struct {
+	KeyPattern string   `yaml:"key_pattern" json:"key_pattern"`             // Regular expression matched against allconfig keys, such as ^payments\.
+	Schema     string   `yaml:"schema,omitempty" json:"schema,omitempty"`   // JSON Schema, as JSON text, that values given as JSON text must validate against
+	Pattern    string   `yaml:"pattern,omitempty" json:"pattern,omitempty"` // Regular expression values must match in full
+	Enum       []string `yaml:"enum,omitempty" json:"enum,omitempty"`       // Values allowed
+	Min        *float64 `yaml:"min,omitempty" json:"min,omitempty"`         // Smallest numeric value allowed
+	Max        *float64 `yaml:"max,omitempty" json:"max,omitempty"`         // Largest numeric value allowed
+}
+
+// QueryConfig represents a read-only SQL query that clients run by name
+type QueryConfig struct {
+	SQL         string             `yaml:"sql" json:"sql"`                             // Refers to parameters as :name
+	Profile     string             `yaml:"profile,omitempty" json:"profile,omitempty"` // Connection profile the query runs on, defaults to default_profile
+	Description string             `yaml:"description,omitempty" json:"description,omitempty"`
+	Params      []QueryParamConfig `yaml:"params,omitempty" json:"params,omitempty"`
+}
+
+// QueryParamConfig declares a parameter of a named query
+type QueryParamConfig struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"` // string, int, float, bool, date or timestamp
+}
+
+// MaskingConfig represents the rules masking sensitive values in query results and allconfig reads
+type MaskingConfig struct {
+	BypassRole string              `yaml:"bypass_role,omitempty" json:"bypass_role,omitempty"` // X-User-Role seeing values unmasked, defaults to admin
+	HashKey    string              `yaml:"hash_key,omitempty" json:"hash_key,omitempty"`       // Keys the HMAC of hash rules; unset hashes with plain SHA-256
+	Rules      []MaskingRuleConfig `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// MaskingRuleConfig masks the columns named by column or matching column_pattern, or the values of the
+// allconfig keys matching key_pattern
+type MaskingRuleConfig struct {
+	Connection    string `yaml:"connection,omitempty" json:"connection,omitempty"`         // Connection profile the rule applies to, defaults to every connection
+	Column        string `yaml:"column,omitempty" json:"column,omitempty"`                 // column, or table.column to mask it only in statements reading the table
+	ColumnPattern string `yaml:"column_pattern,omitempty" json:"column_pattern,omitempty"` // Regular expression matched against column names
+	KeyPattern    string `yaml:"key_pattern,omitempty" json:"key_pattern,omitempty"`       // Regular expression matched against allconfig keys
+	Action        string `yaml:"action" json:"action"`                                     // redact, partial (keeps the last 4 characters) or hash
+}
+
+// maskActions lists the actions of masking rules
+var maskActions = []string{"redact", "partial", "hash"}
+
+// tableNamePattern matches the allconfig table names and approval table suffixes accepted in the configuration
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ConnectionProfiles returns the configured profiles together with one profile per
+// databases entry; explicit profiles win over databases entries of the same name
+func (c *Config) ConnectionProfiles() map[string]ProfileConfig {
+	profiles := make(map[string]ProfileConfig)
+	for _, dbType := range []string{"mysql", "postgresql", "mongodb"} {
+		if connConfig, err := c.Databases.GetConfig(dbType); err == nil {
+			profiles[dbType] = ProfileConfig{Type: dbType, ConnectionConfig: *connConfig}
+		}
+	}
+	for name, profile := range c.Profiles {
+		profiles[name] = profile
+	}
+	return profiles
+}
+
+// ServerConfig represents settings of the HTTP API server
+type ServerConfig struct {
+	Port              int           `yaml:"port,omitempty" json:"port,omitempty"`                               // Defaults to 8080
+	Host              string        `yaml:"host,omitempty" json:"host,omitempty"`                               // Interface to bind; empty binds all interfaces
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout,omitempty" json:"read_header_timeout,omitempty"` // Zero values keep the server defaults
+	ReadTimeout       time.Duration `yaml:"read_timeout,omitempty" json:"read_timeout,omitempty"`
+	WriteTimeout      time.Duration `yaml:"write_timeout,omitempty" json:"write_timeout,omitempty"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout,omitempty" json:"idle_timeout,omitempty"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout,omitempty" json:"shutdown_timeout,omitempty"` // How long shutdown waits for requests and connections to close
+	TLS               TLSConfig     `yaml:"tls,omitempty" json:"tls,omitempty"`
+
+	ReadOnly bool `yaml:"read_only,omitempty" json:"read_only,omitempty"` // Only allow read statements on /execute
+	// Reject allconfig operations named by a deprecated alias, such as update for direct_update
+	StrictOperations bool `yaml:"strict_operations,omitempty" json:"strict_operations,omitempty"`
+	// Leading statement keywords rejected on /execute; nil keeps the built-in list (DROP, TRUNCATE, ALTER)
+	DeniedStatements []string        `yaml:"denied_statements,omitempty" json:"denied_statements,omitempty"`
+	// Let MySQL requests on /execute set multi_statements, running several statements per query
+	AllowMultiStatements bool `yaml:"allow_multi_statements,omitempty" json:"allow_multi_statements,omitempty"`
+	CORS             CORSConfig      `yaml:"cors,omitempty" json:"cors,omitempty"`
+	RateLimit        RateLimitConfig `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+
+	// Phase timeouts of requests, and the most connect_timeout_ms and operation_timeout_ms may ask for;
+	// zero values keep the defaults of 5s, 30s, 30s and 5m
+	ConnectTimeout      time.Duration `yaml:"connect_timeout,omitempty" json:"connect_timeout,omitempty"`
+	OperationTimeout    time.Duration `yaml:"operation_timeout,omitempty" json:"operation_timeout,omitempty"`
+	MaxConnectTimeout   time.Duration `yaml:"max_connect_timeout,omitempty" json:"max_connect_timeout,omitempty"`
+	MaxOperationTimeout time.Duration `yaml:"max_operation_timeout,omitempty" json:"max_operation_timeout,omitempty"`
+
+	ReadyTimeout  time.Duration `yaml:"ready_timeout,omitempty" json:"ready_timeout,omitempty"`     // Per-database ping timeout of /ready
+	ReadyCacheTTL time.Duration `yaml:"ready_cache_ttl,omitempty" json:"ready_cache_ttl,omitempty"` // How long /ready reuses its last result
+
+	// Connectivity check of the connection profiles before serving: off, fail, degraded or retry; empty is off
+	StartupCheck         string        `yaml:"startup_check,omitempty" json:"startup_check,omitempty"`
+	StartupTimeout       time.Duration `yaml:"startup_timeout,omitempty" json:"startup_timeout,omitempty"`               // Connect and ping timeout of each profile; defaults to 5s
+	StartupRetryInterval time.Duration `yaml:"startup_retry_interval,omitempty" json:"startup_retry_interval,omitempty"` // First delay between retries, doubling up to 30s; defaults to 1s
+
+	// Interval of the pings keeping profile connections from being dropped while idle; defaults to 1m, negative disables
+	KeepAliveInterval time.Duration `yaml:"keepalive_interval,omitempty" json:"keepalive_interval,omitempty"`
+	WarmUpConns       int           `yaml:"warm_up_conns,omitempty" json:"warm_up_conns,omitempty"` // Connections each SQL profile opens at startup
+
+	// Operations running at once on each connection; zero defaults to 25, the open connections of a pool, negative is unlimited
+	MaxConcurrentOperations int           `yaml:"max_concurrent_operations,omitempty" json:"max_concurrent_operations,omitempty"`
+	OperationQueueTimeout   time.Duration `yaml:"operation_queue_timeout,omitempty" json:"operation_queue_timeout,omitempty"` // How long operations beyond the limit wait; defaults to 1s
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"` // Fail fast on databases that cannot be reached
+	HealthAlerts   HealthAlertsConfig   `yaml:"health_alerts,omitempty" json:"health_alerts,omitempty"`     // Notify profiles turning unhealthy and recovering
+
+	MaxRequestBytes int64 `yaml:"max_request_bytes,omitempty" json:"max_request_bytes,omitempty"` // Largest accepted request body; zero is unlimited
+
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl,omitempty" json:"idempotency_ttl,omitempty"` // How long responses are replayed by Idempotency-Key; defaults to 24h
+
+	QueryCacheBytes int64 `yaml:"query_cache_bytes,omitempty" json:"query_cache_bytes,omitempty"` // Memory held by cached query results; defaults to 64 MiB, negative disables
+
+	MaxResultBytes int64 `yaml:"max_result_bytes,omitempty" json:"max_result_bytes,omitempty"` // Approximate JSON size of the rows one query may return; defaults to 64 MiB, negative is unlimited
+
+	// Statements running longer than this are logged as warnings; zero keeps the default of 1s, negative disables
+	SlowStatementThreshold time.Duration `yaml:"slow_statement_threshold,omitempty" json:"slow_statement_threshold,omitempty"`
+	HideStatementText      bool          `yaml:"hide_statement_text,omitempty" json:"hide_statement_text,omitempty"` // Leave SQL text out of statement logs
+	// Connection labels /metrics breaks statement counts down by, such as environment or connection; other
+	// labels are left out of metrics to bound their cardinality
+	MetricLabels []string `yaml:"metric_labels,omitempty" json:"metric_labels,omitempty"`
+}
+
+// RateLimitConfig represents per-client token bucket rate limiting
+type RateLimitConfig struct {
+	Enabled           bool                      `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	RequestsPerSecond float64                   `yaml:"requests_per_second,omitempty" json:"requests_per_second,omitempty"` // Sustained rate per client
+	Burst             int                       `yaml:"burst,omitempty" json:"burst,omitempty"`                             // Requests allowed at once
+	IdleTTL           time.Duration             `yaml:"idle_ttl,omitempty" json:"idle_ttl,omitempty"`                       // Forget clients idle for this long
+	Overrides         map[string]RateLimitValue `yaml:"overrides,omitempty" json:"overrides,omitempty"`                     // Limits by API key or client IP
+}
+
+// RateLimitValue represents the rate and burst of one rate limit override
+type RateLimitValue struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty" json:"requests_per_second,omitempty"`
+	Burst             int     `yaml:"burst,omitempty" json:"burst,omitempty"`
+}
+
+// CircuitBreakerConfig represents when the circuit breaker of a connection opens and how long it stays open;
+// zero values keep the defaults
+type CircuitBreakerConfig struct {
+	FailureRate float64       `yaml:"failure_rate,omitempty" json:"failure_rate,omitempty"` // Share of failed connects that opens the breaker; defaults to 0.5
+	MinRequests int           `yaml:"min_requests,omitempty" json:"min_requests,omitempty"` // Connects before the breaker may open; defaults to 5
+	Window      int           `yaml:"window,omitempty" json:"window,omitempty"`             // Latest connects the rate is computed over; defaults to 20
+	Cooldown    time.Duration `yaml:"cooldown,omitempty" json:"cooldown,omitempty"`         // How long the breaker stays open before a probe; defaults to 30s, negative disables
+}
+
+// HealthAlertsConfig represents how connection profiles turning unhealthy and recovering are notified. The
+// changes are always logged; a webhook URL also posts them.
+type HealthAlertsConfig struct {
+	MinStateDuration time.Duration     `yaml:"min_state_duration,omitempty" json:"min_state_duration,omitempty"` // How long a change lasts before it is notified; defaults to 30s, negative notifies right away
+	WebhookURL       string            `yaml:"webhook_url,omitempty" json:"webhook_url,omitempty"`
+	WebhookHeaders   map[string]string `yaml:"webhook_headers,omitempty" json:"webhook_headers,omitempty"` // Such as an Authorization token
+	WebhookTimeout   time.Duration     `yaml:"webhook_timeout,omitempty" json:"webhook_timeout,omitempty"` // Of each post; defaults to 5s
 }
 
-// LoadConfig loads configuration from a YAML file and environment variables
-func LoadConfig(configPath string) (*Config, error) {
+// TLSConfig represents the PEM files used to serve HTTPS
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`
+	KeyFile      string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	ClientCAFile string `yaml:"client_ca_file,omitempty" json:"client_ca_file,omitempty"` // Require client certificates signed by this CA (mTLS)
+}
+
+// CORSConfig represents the cross-origin resource sharing policy; nil lists keep the permissive defaults
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins,omitempty" json:"allowed_origins,omitempty"`     // Exact origins, "*" or wildcard suffixes like "https://*.example.com"
+	AllowedMethods   []string      `yaml:"allowed_methods,omitempty" json:"allowed_methods,omitempty"`     // Methods allowed in preflight responses
+	AllowedHeaders   []string      `yaml:"allowed_headers,omitempty" json:"allowed_headers,omitempty"`     // Request headers allowed in preflight responses
+	AllowCredentials bool          `yaml:"allow_credentials,omitempty" json:"allow_credentials,omitempty"` // Allow cookies and Authorization headers
+	MaxAge           time.Duration `yaml:"max_age,omitempty" json:"max_age,omitempty"`                     // How long browsers may cache preflight results
+}
+
+// ErrInvalidConfig is wrapped by LoadConfig errors for configurations that fail Validate
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// LoadConfig loads configuration from a YAML or JSON file and environment variables and validates it.
+// The format follows the file extension (.json, .yaml or .yml) and is detected from the content otherwise.
+// An empty path loads the first file found in SearchPaths; the file used is recorded in Source, and
+// only the environment is used when the file does not exist.
+func LoadConfig(configPath string, opts ...ValidateOption) (*Config, error) {
 	if configPath == "" {
-		configPath = "config.yaml"
+		configPath = FindConfig()
 	}
 
 	var config Config
@@ -34,21 +275,20 @@ func LoadConfig(configPath string) (*Config, error) {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
 
-		// Parse YAML
-		if err := yaml.Unmarshal(data, &config); err != nil {
+		// Parse YAML or JSON
+		if err := unmarshalConfig(configPath, data, detectFormat(configPath, data), &config); err != nil {
 			return nil, fmt.Errorf("failed to parse config file: %w", err)
 		}
+		config.Source = configPath
 	}
 
 	// Override/set values from environment variables
 	loadFromEnvironment(&config)
 
-	// Set defaults if not provided
-	if config.LogLevel == "" {
-		config.LogLevel = "info"
-	}
-	if config.AppName == "" {
-		config.AppName = "db-connectors"
+	config.applyDefaults()
+
+	if err := config.Validate(opts...); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
 	}
 
 	return &config, nil
@@ -62,118 +302,398 @@ func loadFromEnvironment(config *Config) {
 	if logLevel := os.Getenv("LOG_LEVEL"); logLevel != "" {
 		config.LogLevel = logLevel
 	}
-
-	// Load MySQL config from environment
-	if host := os.Getenv("MYSQL_HOST"); host != "" {
-		if config.Databases.MySQL == nil {
-			config.Databases.MySQL = &connectors.ConnectionConfig{}
-		}
-		config.Databases.MySQL.Host = host
+	if logFormat := os.Getenv("LOG_FORMAT"); logFormat != "" {
+		config.LogFormat = logFormat
 	}
-	if portStr := os.Getenv("MYSQL_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err == nil {
-			if config.Databases.MySQL == nil {
-				config.Databases.MySQL = &connectors.ConnectionConfig{}
-			}
-			config.Databases.MySQL.Port = port
+	if defaultProfile := os.Getenv("DEFAULT_PROFILE"); defaultProfile != "" {
+		config.DefaultProfile = defaultProfile
+	}
+	loadServerFromEnvironment(&config.Server)
+	loadJobsFromEnvironment(&config.Jobs)
+	loadEventsFromEnvironment(&config.Events)
+	if table := os.Getenv("ALLCONFIG_TABLE"); table != "" {
+		config.AllConfig.Table = table
+	}
+	if schema := os.Getenv("ALLCONFIG_SCHEMA"); schema != "" {
+		config.AllConfig.Schema = schema
+	}
+	if suffix := os.Getenv("ALLCONFIG_APPROVAL_SUFFIX"); suffix != "" {
+		config.AllConfig.ApprovalSuffix = suffix
+	}
+	if maxLength, ok := EnvInt("ALLCONFIG_KEY_MAX_LENGTH"); ok {
+		config.AllConfig.KeyMaxLength = maxLength
+	}
+	if hashKey := os.Getenv("MASKING_HASH_KEY"); hashKey != "" {
+		config.Masking.HashKey = hashKey
+	}
+	if pattern := os.Getenv("ALLCONFIG_KEY_PATTERN"); pattern != "" {
+		config.AllConfig.KeyPattern = pattern
+	}
+	if lowercase := os.Getenv("ALLCONFIG_LOWERCASE_KEYS"); lowercase != "" {
+		if value, err := strconv.ParseBool(lowercase); err == nil {
+			config.AllConfig.LowercaseKeys = value
 		}
 	}
-	if username := os.Getenv("MYSQL_USERNAME"); username != "" {
-		if config.Databases.MySQL == nil {
-			config.Databases.MySQL = &connectors.ConnectionConfig{}
+	if caseInsensitive := os.Getenv("ALLCONFIG_CASE_INSENSITIVE_KEYS"); caseInsensitive != "" {
+		if value, err := strconv.ParseBool(caseInsensitive); err == nil {
+			config.AllConfig.CaseInsensitiveKeys = value
 		}
-		config.Databases.MySQL.Username = username
 	}
-	if password := os.Getenv("MYSQL_PASSWORD"); password != "" {
-		if config.Databases.MySQL == nil {
-			config.Databases.MySQL = &connectors.ConnectionConfig{}
+	if maxBytes, ok := EnvInt("ALLCONFIG_MAX_VALUE_BYTES"); ok {
+		config.AllConfig.MaxValueBytes = maxBytes
+	}
+	if maxBytes, ok := EnvInt("ALLCONFIG_MAX_DESCRIPTION_BYTES"); ok {
+		config.AllConfig.MaxDescriptionBytes = maxBytes
+	}
+	if largeBytes, ok := EnvInt("ALLCONFIG_LARGE_VALUE_BYTES"); ok {
+		config.AllConfig.LargeValueBytes = largeBytes
+	}
+	if notify := os.Getenv("ALLCONFIG_NOTIFY_CHANGES"); notify != "" {
+		if value, err := strconv.ParseBool(notify); err == nil {
+			config.AllConfig.NotifyChanges = value
 		}
-		config.Databases.MySQL.Password = password
 	}
-	if database := os.Getenv("MYSQL_DATABASE"); database != "" {
-		if config.Databases.MySQL == nil {
-			config.Databases.MySQL = &connectors.ConnectionConfig{}
+	if interval, err := time.ParseDuration(os.Getenv("ALLCONFIG_EXPIRY_SWEEP_INTERVAL")); err == nil {
+		config.AllConfig.ExpirySweepInterval = interval
+	}
+	if interval, err := time.ParseDuration(os.Getenv("ALLCONFIG_PENDING_REFRESH_INTERVAL")); err == nil {
+		config.AllConfig.PendingRefreshInterval = interval
+	}
+
+	loadDatabaseFromEnvironment(&config.Databases.MySQL, "MYSQL", 3306)
+	loadDatabaseFromEnvironment(&config.Databases.PostgreSQL, "POSTGRES", 5432)
+	loadDatabaseFromEnvironment(&config.Databases.MongoDB, "MONGO", 27017)
+}
+
+// loadDatabaseFromEnvironment overrides a databases entry from the environment variables with
+// the given prefix, such as MYSQL_HOST; an entry created from the environment starts with the default port
+func loadDatabaseFromEnvironment(entry **connectors.ConnectionConfig, prefix string, defaultPort int) {
+	conn := func() *connectors.ConnectionConfig {
+		if *entry == nil {
+			*entry = &connectors.ConnectionConfig{Port: defaultPort}
 		}
-		config.Databases.MySQL.Database = database
+		return *entry
 	}
 
-	// Load PostgreSQL config from environment
-	if host := os.Getenv("POSTGRES_HOST"); host != "" {
-		if config.Databases.PostgreSQL == nil {
-			config.Databases.PostgreSQL = &connectors.ConnectionConfig{}
+	if host := os.Getenv(prefix + "_HOST"); host != "" {
+		conn().Host = host
+	}
+	if port, ok := EnvPort(prefix + "_PORT"); ok {
+		conn().Port = port
+	}
+	if username := os.Getenv(prefix + "_USERNAME"); username != "" {
+		conn().Username = username
+	}
+	if password := os.Getenv(prefix + "_PASSWORD"); password != "" {
+		conn().Password = password
+	}
+	if database := os.Getenv(prefix + "_DATABASE"); database != "" {
+		conn().Database = database
+	}
+	if schema := os.Getenv(prefix + "_SCHEMA"); schema != "" {
+		conn().Schema = schema
+	}
+	if sslMode := os.Getenv(prefix + "_SSLMODE"); sslMode != "" {
+		conn().SSLMode = sslMode
+	}
+	if uri := os.Getenv(prefix + "_URI"); uri != "" {
+		conn().URI = uri
+	}
+}
+
+// JobsConfig represents settings of asynchronous query jobs; zero values use the built-in defaults
+type JobsConfig struct {
+	Enabled        bool          `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	Workers        int           `yaml:"workers,omitempty" json:"workers,omitempty"`                   // Jobs run concurrently
+	QueueSize      int           `yaml:"queue_size,omitempty" json:"queue_size,omitempty"`             // Jobs waiting for a worker
+	MaxResultRows  int           `yaml:"max_result_rows,omitempty" json:"max_result_rows,omitempty"`   // Row cap per job result
+	MaxResultBytes int64         `yaml:"max_result_bytes,omitempty" json:"max_result_bytes,omitempty"` // Byte cap per job result
+	ResultTTL      time.Duration `yaml:"result_ttl,omitempty" json:"result_ttl,omitempty"`             // How long finished jobs are kept, e.g. "1h"
+	JobTimeout     time.Duration `yaml:"job_timeout,omitempty" json:"job_timeout,omitempty"`           // Maximum run time of a job
+	SpoolDir       string        `yaml:"spool_dir,omitempty" json:"spool_dir,omitempty"`               // Spool results to this directory instead of memory
+}
+
+// EventsConfig represents the publishing of config change events to Kafka
+type EventsConfig struct {
+	Enabled    bool        `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	BufferSize int         `yaml:"buffer_size,omitempty" json:"buffer_size,omitempty"` // Events waiting to be published before new ones are dropped, defaults to 1024
+	Kafka      KafkaConfig `yaml:"kafka,omitempty" json:"kafka,omitempty"`
+}
+
+// KafkaConfig represents the Kafka brokers and topic config change events are written to
+type KafkaConfig struct {
+	Brokers []string        `yaml:"brokers,omitempty" json:"brokers,omitempty"` // host:port of one or more brokers
+	Topic   string          `yaml:"topic,omitempty" json:"topic,omitempty"`
+	TLS     KafkaTLSConfig  `yaml:"tls,omitempty" json:"tls,omitempty"`
+	SASL    KafkaSASLConfig `yaml:"sasl,omitempty" json:"sasl,omitempty"`
+}
+
+// KafkaTLSConfig represents TLS connections to the Kafka brokers
+type KafkaTLSConfig struct {
+	Enabled            bool   `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	CAFile             string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`     // Verify brokers against this CA instead of the system roots
+	CertFile           string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"` // Client certificate, for brokers requiring one
+	KeyFile            string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+}
+
+// KafkaSASLConfig represents SASL authentication with the Kafka brokers
+type KafkaSASLConfig struct {
+	Mechanism string `yaml:"mechanism,omitempty" json:"mechanism,omitempty"` // plain, scram-sha-256 or scram-sha-512; empty disables SASL
+	Username  string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password  string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// startupChecks lists the accepted server startup_check policies
+var startupChecks = []string{"off", "fail", "degraded", "retry"}
+
+// saslMechanisms lists the SASL mechanisms accepted for Kafka
+var saslMechanisms = []string{"plain", "scram-sha-256", "scram-sha-512"}
+
+// loadServerFromEnvironment loads HTTP server settings from environment variables
+func loadServerFromEnvironment(server *ServerConfig) {
+	if port, ok := EnvPort("PORT"); ok {
+		server.Port = port
+	}
+	if host := os.Getenv("SERVER_HOST"); host != "" {
+		server.Host = host
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_READ_HEADER_TIMEOUT")); err == nil {
+		server.ReadHeaderTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_READ_TIMEOUT")); err == nil {
+		server.ReadTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_WRITE_TIMEOUT")); err == nil {
+		server.WriteTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_IDLE_TIMEOUT")); err == nil {
+		server.IdleTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_SHUTDOWN_TIMEOUT")); err == nil {
+		server.ShutdownTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_CONNECT_TIMEOUT")); err == nil {
+		server.ConnectTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_OPERATION_TIMEOUT")); err == nil {
+		server.OperationTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_MAX_CONNECT_TIMEOUT")); err == nil {
+		server.MaxConnectTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_MAX_OPERATION_TIMEOUT")); err == nil {
+		server.MaxOperationTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_READY_TIMEOUT")); err == nil {
+		server.ReadyTimeout = timeout
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("SERVER_READY_CACHE_TTL")); err == nil {
+		server.ReadyCacheTTL = ttl
+	}
+	if check := os.Getenv("SERVER_STARTUP_CHECK"); check != "" {
+		server.StartupCheck = check
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_STARTUP_TIMEOUT")); err == nil {
+		server.StartupTimeout = timeout
+	}
+	if interval, err := time.ParseDuration(os.Getenv("SERVER_STARTUP_RETRY_INTERVAL")); err == nil {
+		server.StartupRetryInterval = interval
+	}
+	if interval, err := time.ParseDuration(os.Getenv("SERVER_KEEPALIVE_INTERVAL")); err == nil {
+		server.KeepAliveInterval = interval
+	}
+	if conns, ok := EnvInt("SERVER_WARM_UP_CONNS"); ok {
+		server.WarmUpConns = conns
+	}
+	if operations, ok := EnvInt("SERVER_MAX_CONCURRENT_OPERATIONS"); ok {
+		server.MaxConcurrentOperations = operations
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("SERVER_OPERATION_QUEUE_TIMEOUT")); err == nil {
+		server.OperationQueueTimeout = timeout
+	}
+	if rate, ok := EnvFloat("SERVER_CIRCUIT_FAILURE_RATE"); ok {
+		server.CircuitBreaker.FailureRate = rate
+	}
+	if requests, ok := EnvInt("SERVER_CIRCUIT_MIN_REQUESTS"); ok {
+		server.CircuitBreaker.MinRequests = requests
+	}
+	if window, ok := EnvInt("SERVER_CIRCUIT_WINDOW"); ok {
+		server.CircuitBreaker.Window = window
+	}
+	if cooldown, err := time.ParseDuration(os.Getenv("SERVER_CIRCUIT_COOLDOWN")); err == nil {
+		server.CircuitBreaker.Cooldown = cooldown
+	}
+	if duration, err := time.ParseDuration(os.Getenv("SERVER_HEALTH_ALERT_MIN_STATE_DURATION")); err == nil {
+		server.HealthAlerts.MinStateDuration = duration
+	}
+	if url := os.Getenv("SERVER_HEALTH_ALERT_WEBHOOK_URL"); url != "" {
+		server.HealthAlerts.WebhookURL = url
+	}
+	if maxBytes, ok := EnvInt64("SERVER_MAX_REQUEST_BYTES"); ok {
+		server.MaxRequestBytes = maxBytes
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("SERVER_IDEMPOTENCY_TTL")); err == nil {
+		server.IdempotencyTTL = ttl
+	}
+	if cacheBytes, ok := EnvInt64("SERVER_QUERY_CACHE_BYTES"); ok {
+		server.QueryCacheBytes = cacheBytes
+	}
+	if resultBytes, ok := EnvInt64("SERVER_MAX_RESULT_BYTES"); ok {
+		server.MaxResultBytes = resultBytes
+	}
+	if threshold, err := time.ParseDuration(os.Getenv("SERVER_SLOW_STATEMENT_THRESHOLD")); err == nil {
+		server.SlowStatementThreshold = threshold
+	}
+	if hide := os.Getenv("SERVER_HIDE_STATEMENT_TEXT"); hide != "" {
+		if value, err := strconv.ParseBool(hide); err == nil {
+			server.HideStatementText = value
 		}
-		config.Databases.PostgreSQL.Host = host
 	}
-	if portStr := os.Getenv("POSTGRES_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err == nil {
-			if config.Databases.PostgreSQL == nil {
-				config.Databases.PostgreSQL = &connectors.ConnectionConfig{}
+	if labels, ok := os.LookupEnv("SERVER_METRIC_LABELS"); ok {
+		server.MetricLabels = nil
+		for _, label := range strings.Split(labels, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				server.MetricLabels = append(server.MetricLabels, label)
 			}
-			config.Databases.PostgreSQL.Port = port
 		}
 	}
-	if username := os.Getenv("POSTGRES_USERNAME"); username != "" {
-		if config.Databases.PostgreSQL == nil {
-			config.Databases.PostgreSQL = &connectors.ConnectionConfig{}
+	if certFile := os.Getenv("TLS_CERT_FILE"); certFile != "" {
+		server.TLS.CertFile = certFile
+	}
+	if keyFile := os.Getenv("TLS_KEY_FILE"); keyFile != "" {
+		server.TLS.KeyFile = keyFile
+	}
+	if clientCAFile := os.Getenv("TLS_CLIENT_CA_FILE"); clientCAFile != "" {
+		server.TLS.ClientCAFile = clientCAFile
+	}
+	if readOnly := os.Getenv("READ_ONLY"); readOnly != "" {
+		if value, err := strconv.ParseBool(readOnly); err == nil {
+			server.ReadOnly = value
 		}
-		config.Databases.PostgreSQL.Username = username
 	}
-	if password := os.Getenv("POSTGRES_PASSWORD"); password != "" {
-		if config.Databases.PostgreSQL == nil {
-			config.Databases.PostgreSQL = &connectors.ConnectionConfig{}
+	if strict := os.Getenv("SERVER_STRICT_OPERATIONS"); strict != "" {
+		if value, err := strconv.ParseBool(strict); err == nil {
+			server.StrictOperations = value
 		}
-		config.Databases.PostgreSQL.Password = password
 	}
-	if database := os.Getenv("POSTGRES_DATABASE"); database != "" {
-		if config.Databases.PostgreSQL == nil {
-			config.Databases.PostgreSQL = &connectors.ConnectionConfig{}
+	if multi := os.Getenv("SERVER_ALLOW_MULTI_STATEMENTS"); multi != "" {
+		if value, err := strconv.ParseBool(multi); err == nil {
+			server.AllowMultiStatements = value
 		}
-		config.Databases.PostgreSQL.Database = database
 	}
-	if sslMode := os.Getenv("POSTGRES_SSLMODE"); sslMode != "" {
-		if config.Databases.PostgreSQL == nil {
-			config.Databases.PostgreSQL = &connectors.ConnectionConfig{}
+	if denied, ok := os.LookupEnv("DENIED_STATEMENTS"); ok {
+		// An empty value disables the denylist
+		server.DeniedStatements = []string{}
+		for _, keyword := range strings.Split(denied, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				server.DeniedStatements = append(server.DeniedStatements, strings.ToUpper(keyword))
+			}
 		}
-		config.Databases.PostgreSQL.SSLMode = sslMode
 	}
 
-	// Load MongoDB config from environment
-	if host := os.Getenv("MONGO_HOST"); host != "" {
-		if config.Databases.MongoDB == nil {
-			config.Databases.MongoDB = &connectors.ConnectionConfig{}
+	if origins, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		server.CORS.AllowedOrigins = splitList(origins)
+	}
+	if methods, ok := os.LookupEnv("CORS_ALLOWED_METHODS"); ok {
+		server.CORS.AllowedMethods = splitList(strings.ToUpper(methods))
+	}
+	if headers, ok := os.LookupEnv("CORS_ALLOWED_HEADERS"); ok {
+		server.CORS.AllowedHeaders = splitList(headers)
+	}
+	if credentials := os.Getenv("CORS_ALLOW_CREDENTIALS"); credentials != "" {
+		if value, err := strconv.ParseBool(credentials); err == nil {
+			server.CORS.AllowCredentials = value
 		}
-		config.Databases.MongoDB.Host = host
 	}
-	if portStr := os.Getenv("MONGO_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err == nil {
-			if config.Databases.MongoDB == nil {
-				config.Databases.MongoDB = &connectors.ConnectionConfig{}
-			}
-			config.Databases.MongoDB.Port = port
+	if maxAge, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil {
+		server.CORS.MaxAge = maxAge
+	}
+
+	if enabled := os.Getenv("RATE_LIMIT_ENABLED"); enabled != "" {
+		if value, err := strconv.ParseBool(enabled); err == nil {
+			server.RateLimit.Enabled = value
 		}
 	}
-	if username := os.Getenv("MONGO_USERNAME"); username != "" {
-		if config.Databases.MongoDB == nil {
-			config.Databases.MongoDB = &connectors.ConnectionConfig{}
+	if rps, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT_RPS"), 64); err == nil {
+		server.RateLimit.RequestsPerSecond = rps
+	}
+	if burst, ok := EnvInt("RATE_LIMIT_BURST"); ok {
+		server.RateLimit.Burst = burst
+	}
+}
+
+// splitList splits a comma-separated environment value, dropping empty entries
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-		config.Databases.MongoDB.Username = username
 	}
-	if password := os.Getenv("MONGO_PASSWORD"); password != "" {
-		if config.Databases.MongoDB == nil {
-			config.Databases.MongoDB = &connectors.ConnectionConfig{}
+	return items
+}
+
+// loadJobsFromEnvironment loads asynchronous job settings from environment variables
+func loadJobsFromEnvironment(jobs *JobsConfig) {
+	if enabled := os.Getenv("JOBS_ENABLED"); enabled != "" {
+		if value, err := strconv.ParseBool(enabled); err == nil {
+			jobs.Enabled = value
 		}
-		config.Databases.MongoDB.Password = password
 	}
-	if database := os.Getenv("MONGO_DATABASE"); database != "" {
-		if config.Databases.MongoDB == nil {
-			config.Databases.MongoDB = &connectors.ConnectionConfig{}
+	if workers, ok := EnvInt("JOBS_WORKERS"); ok {
+		jobs.Workers = workers
+	}
+	if queueSize, ok := EnvInt("JOBS_QUEUE_SIZE"); ok {
+		jobs.QueueSize = queueSize
+	}
+	if maxRows, ok := EnvInt("JOBS_MAX_RESULT_ROWS"); ok {
+		jobs.MaxResultRows = maxRows
+	}
+	if maxBytes, err := strconv.ParseInt(os.Getenv("JOBS_MAX_RESULT_BYTES"), 10, 64); err == nil {
+		jobs.MaxResultBytes = maxBytes
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("JOBS_RESULT_TTL")); err == nil {
+		jobs.ResultTTL = ttl
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("JOBS_TIMEOUT")); err == nil {
+		jobs.JobTimeout = timeout
+	}
+	if spoolDir := os.Getenv("JOBS_SPOOL_DIR"); spoolDir != "" {
+		jobs.SpoolDir = spoolDir
+	}
+}
+
+// loadEventsFromEnvironment loads config change event settings from environment variables
+func loadEventsFromEnvironment(events *EventsConfig) {
+	if enabled := os.Getenv("EVENTS_ENABLED"); enabled != "" {
+		if value, err := strconv.ParseBool(enabled); err == nil {
+			events.Enabled = value
 		}
-		config.Databases.MongoDB.Database = database
+	}
+	if bufferSize, ok := EnvInt("EVENTS_BUFFER_SIZE"); ok {
+		events.BufferSize = bufferSize
+	}
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		events.Kafka.Brokers = strings.Split(brokers, ",")
+	}
+	if topic := os.Getenv("KAFKA_TOPIC"); topic != "" {
+		events.Kafka.Topic = topic
+	}
+	if mechanism := os.Getenv("KAFKA_SASL_MECHANISM"); mechanism != "" {
+		events.Kafka.SASL.Mechanism = mechanism
+	}
+	if username := os.Getenv("KAFKA_SASL_USERNAME"); username != "" {
+		events.Kafka.SASL.Username = username
+	}
+	if password := os.Getenv("KAFKA_SASL_PASSWORD"); password != "" {
+		events.Kafka.SASL.Password = password
 	}
 }
 
-// Validate checks if the configuration is valid
-func (c *Config) Validate() error {
+// Validate checks if the configuration is valid, including every configured database and profile.
+// Warnings fail validation unless AllowWarnings is given.
+func (c *Config) Validate(opts ...ValidateOption) error {
 	if c.AppName == "" {
 		return fmt.Errorf("app name cannot be empty")
 	}
@@ -189,11 +709,358 @@ func (c *Config) Validate() error {
 	if !isValidLogLevel {
 		return fmt.Errorf("invalid log level: %s, must be one of: debug, info, warn, error", c.LogLevel)
 	}
+
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("server port must be between 1 and 65535")
+	}
+	if c.Server.MaxRequestBytes < 0 {
+		return fmt.Errorf("server max_request_bytes cannot be negative")
+	}
+	if c.Server.IdempotencyTTL < 0 {
+		return fmt.Errorf("server idempotency_ttl cannot be negative")
+	}
+	if conns := c.Server.WarmUpConns; conns < 0 || conns > connectors.DefaultMaxIdleConns {
+		return fmt.Errorf("server warm_up_conns must be between 0 and %d, the idle connections a pool keeps", connectors.DefaultMaxIdleConns)
+	}
+	if c.Server.OperationQueueTimeout < 0 {
+		return fmt.Errorf("server operation_queue_timeout cannot be negative")
+	}
+	if breaker := c.Server.CircuitBreaker; breaker.FailureRate < 0 || breaker.FailureRate > 1 {
+		return fmt.Errorf("server circuit_breaker failure_rate must be between 0 and 1")
+	}
+	if breaker := c.Server.CircuitBreaker; breaker.MinRequests < 0 || breaker.Window < 0 {
+		return fmt.Errorf("server circuit_breaker min_requests and window cannot be negative")
+	}
+	if c.Server.HealthAlerts.WebhookTimeout < 0 {
+		return fmt.Errorf("server health_alerts webhook_timeout cannot be negative")
+	}
+	if check := c.Server.StartupCheck; check != "" && !slices.Contains(startupChecks, check) {
+		return fmt.Errorf("invalid server startup_check: %q, must be one of: %s", check, strings.Join(startupChecks, ", "))
+	}
+	for _, label := range c.Server.MetricLabels {
+		if err := connectors.ValidateLabelKey(label); err != nil {
+			return fmt.Errorf("server metric_labels: %w", err)
+		}
+	}
+
+	if cors := c.Server.CORS; cors.AllowCredentials && (cors.AllowedOrigins == nil || slices.Contains(cors.AllowedOrigins, "*")) {
+		return fmt.Errorf(`server cors allow_credentials cannot be combined with allowing any origin: list the allowed_origins instead of "*"`)
+	}
+
+	tls := c.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return fmt.Errorf("server TLS requires both cert_file and key_file")
+	}
+	if tls.ClientCAFile != "" && tls.CertFile == "" {
+		return fmt.Errorf("server TLS client_ca_file requires cert_file and key_file")
+	}
+
+	if table := c.AllConfig.Table; table != "" && !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("invalid allconfig table: %q, may only contain letters, digits and underscores", table)
+	}
+	if schema := c.AllConfig.Schema; schema != "" && !tableNamePattern.MatchString(schema) {
+		return fmt.Errorf("invalid allconfig schema: %q, may only contain letters, digits and underscores", schema)
+	}
+	if suffix := c.AllConfig.ApprovalSuffix; suffix != "" && !tableNamePattern.MatchString(suffix) {
+		return fmt.Errorf("invalid allconfig approval_suffix: %q, may only contain letters, digits and underscores", suffix)
+	}
+	if c.AllConfig.KeyMaxLength < 0 {
+		return fmt.Errorf("allconfig key_max_length cannot be negative")
+	}
+	if c.AllConfig.MaxValueBytes < 0 || c.AllConfig.MaxDescriptionBytes < 0 || c.AllConfig.LargeValueBytes < 0 {
+		return fmt.Errorf("allconfig max_value_bytes, max_description_bytes and large_value_bytes cannot be negative")
+	}
+	if pattern := c.AllConfig.KeyPattern; pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid allconfig key_pattern: %w", err)
+		}
+	}
+
+	// An empty format falls back to the console format
+	if c.LogFormat != "" && c.LogFormat != "console" && c.LogFormat != "json" {
+		return fmt.Errorf("invalid log format: %s, must be one of: console, json", c.LogFormat)
+	}
+
+	for _, name := range sortedKeys(c.Profiles) {
+		profile := c.Profiles[name]
+		if !connectors.IsRegistered(profile.Type) {
+			return fmt.Errorf("profile %s has invalid type: %q, must be one of: %s", name, profile.Type, strings.Join(connectors.Drivers(), ", "))
+		}
+		if err := profile.ConnectionConfig.Validate(); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+		if err := profile.ConnectionConfig.CheckURI(profile.Type); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+		if profile.MultiStatements && profile.Type != "mysql" {
+			return fmt.Errorf("profiles.%s: multi_statements is only supported for MySQL", name)
+		}
+		if _, ok := profile.Labels[connectors.ConnectionLabel]; ok {
+			return fmt.Errorf("profiles.%s: label %s is set to the profile name", name, connectors.ConnectionLabel)
+		}
+	}
+	for _, db := range c.databaseBlocks() {
+		if err := db.config.Validate(); err != nil {
+			return fmt.Errorf("databases.%s: %w", db.dbType, err)
+		}
+		if err := db.config.CheckURI(db.dbType); err != nil {
+			return fmt.Errorf("databases.%s: %w", db.dbType, err)
+		}
+		if _, ok := db.config.Labels[connectors.ConnectionLabel]; ok {
+			return fmt.Errorf("databases.%s: label %s is set to the profile name", db.dbType, connectors.ConnectionLabel)
+		}
+	}
+	if c.DefaultProfile != "" {
+		if _, ok := c.ConnectionProfiles()[c.DefaultProfile]; !ok {
+			return fmt.Errorf("default profile %s is not configured", c.DefaultProfile)
+		}
+	}
+	if err := c.validateQueries(); err != nil {
+		return err
+	}
+	if err := c.validateTenants(); err != nil {
+		return err
+	}
+	if err := c.validateMasking(); err != nil {
+		return err
+	}
+	if err := c.AllConfig.validateValueRules(); err != nil {
+		return err
+	}
+	if err := c.Events.validate(); err != nil {
+		return err
+	}
+
+	options := validateOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if warnings := c.Warnings(); len(warnings) > 0 && !options.allowWarnings {
+		return fmt.Errorf("configuration has warnings: %s", strings.Join(warnings, "; "))
+	}
 	
 	return nil
 }
 
-// SaveConfig saves configuration to a YAML file
+// ValidateOption configures Config.Validate
+type ValidateOption func(*validateOptions)
+
+type validateOptions struct {
+	allowWarnings bool
+}
+
+// AllowWarnings makes warnings, such as a MySQL connection without a password, non-fatal;
+// they are still returned by Warnings
+func AllowWarnings() ValidateOption {
+	return func(o *validateOptions) {
+		o.allowWarnings = true
+	}
+}
+
+// Warnings lists settings that are valid but probably unintended, such as SQL
+// connections without credentials
+func (c *Config) Warnings() []string {
+	var warnings []string
+	check := func(block, dbType string, conn *connectors.ConnectionConfig) {
+		// MongoDB connections without authentication are common and expected, and URIs carry their
+		// own credentials
+		if dbType == "mongodb" || conn.URI != "" {
+			return
+		}
+		if conn.Username == "" {
+			warnings = append(warnings, fmt.Sprintf("%s: username is empty", block))
+		}
+		if conn.Password == "" {
+			warnings = append(warnings, fmt.Sprintf("%s: password is empty", block))
+		}
+	}
+	for _, db := range c.databaseBlocks() {
+		check("databases."+db.dbType, db.dbType, db.config)
+	}
+	for _, name := range sortedKeys(c.Profiles) {
+		profile := c.Profiles[name]
+		check("profiles."+name, profile.Type, &profile.ConnectionConfig)
+	}
+	return warnings
+}
+
+// databaseBlock is a configured entry of the databases section
+type databaseBlock struct {
+	dbType string
+	config *connectors.ConnectionConfig
+}
+
+// databaseBlocks returns the non-nil databases entries in a fixed order
+func (c *Config) databaseBlocks() []databaseBlock {
+	var blocks []databaseBlock
+	for _, dbType := range []string{"mysql", "postgresql", "mongodb"} {
+		if connConfig, err := c.Databases.GetConfig(dbType); err == nil {
+			blocks = append(blocks, databaseBlock{dbType: dbType, config: connConfig})
+		}
+	}
+	return blocks
+}
+
+// validateQueries checks that every named query has SQL, a configured profile and named, typed parameters.
+// The API checks the SQL against its parameters and profile when it loads the queries.
+func (c *Config) validateQueries() error {
+	names := make([]string, 0, len(c.Queries))
+	for name := range c.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	profiles := c.ConnectionProfiles()
+	for _, name := range names {
+		query := c.Queries[name]
+		if strings.TrimSpace(query.SQL) == "" {
+			return fmt.Errorf("queries.%s: sql is required", name)
+		}
+		if query.Profile != "" {
+			if _, ok := profiles[query.Profile]; !ok {
+				return fmt.Errorf("queries.%s: profile %s is not configured", name, query.Profile)
+			}
+		}
+		for i, param := range query.Params {
+			if param.Name == "" || param.Type == "" {
+				return fmt.Errorf("queries.%s: params[%d] needs a name and a type", name, i)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTenants checks that every tenant has a prefix of its own naming valid tables, that its profile is
+// configured and that no API key identifies two tenants
+func (c *Config) validateTenants() error {
+	ids := make([]string, 0, len(c.Tenants))
+	for id := range c.Tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	profiles := c.ConnectionProfiles()
+	prefixes := make(map[string]string, len(ids))
+	keys := make(map[string]string)
+	for _, id := range ids {
+		tenant := c.Tenants[id]
+		if id == "" {
+			return fmt.Errorf("tenants: tenant ID cannot be empty")
+		}
+		if !tableNamePattern.MatchString(tenant.TablePrefix) {
+			return fmt.Errorf("tenants.%s: invalid table_prefix: %q, must be letters, digits and underscores", id, tenant.TablePrefix)
+		}
+		if other, ok := prefixes[tenant.TablePrefix]; ok {
+			return fmt.Errorf("tenants.%s: table_prefix %q is also the prefix of tenant %s", id, tenant.TablePrefix, other)
+		}
+		prefixes[tenant.TablePrefix] = id
+		if tenant.Profile != "" {
+			if _, ok := profiles[tenant.Profile]; !ok {
+				return fmt.Errorf("tenants.%s: profile %s is not configured", id, tenant.Profile)
+			}
+		}
+		for _, key := range tenant.APIKeys {
+			if other, ok := keys[key]; ok {
+				return fmt.Errorf("tenants.%s: an API key is also a key of tenant %s", id, other)
+			}
+			keys[key] = id
+		}
+	}
+	return nil
+}
+
+// validateMasking checks that every masking rule matches something with a known action, and that its
+// patterns compile and its connection is configured
+func (c *Config) validateMasking() error {
+	profiles := c.ConnectionProfiles()
+	for i, rule := range c.Masking.Rules {
+		if rule.Column == "" && rule.ColumnPattern == "" && rule.KeyPattern == "" {
+			return fmt.Errorf("masking.rules[%d]: column, column_pattern or key_pattern is required", i)
+		}
+		if !slices.Contains(maskActions, rule.Action) {
+			return fmt.Errorf("masking.rules[%d]: invalid action: %q, must be one of: %s", i, rule.Action, strings.Join(maskActions, ", "))
+		}
+		if _, err := regexp.Compile(rule.ColumnPattern); err != nil {
+			return fmt.Errorf("masking.rules[%d]: invalid column_pattern: %w", i, err)
+		}
+		if _, err := regexp.Compile(rule.KeyPattern); err != nil {
+			return fmt.Errorf("masking.rules[%d]: invalid key_pattern: %w", i, err)
+		}
+		if rule.Connection != "" {
+			if _, ok := profiles[rule.Connection]; !ok {
+				return fmt.Errorf("masking.rules[%d]: connection %s is not configured", i, rule.Connection)
+			}
+		}
+	}
+	return nil
+}
+
+// validateValueRules checks that every value rule matches keys with a pattern that compiles and sets a
+// constraint, that its schema is a JSON object and that its range is not empty. The schema keywords are
+// checked when the server compiles the schema.
+func (a *AllConfigConfig) validateValueRules() error {
+	for i, rule := range a.ValueRules {
+		if rule.KeyPattern == "" {
+			return fmt.Errorf("allconfig.value_rules[%d]: key_pattern is required", i)
+		}
+		if _, err := regexp.Compile(rule.KeyPattern); err != nil {
+			return fmt.Errorf("allconfig.value_rules[%d]: invalid key_pattern: %w", i, err)
+		}
+		if rule.Schema == "" && rule.Pattern == "" && len(rule.Enum) == 0 && rule.Min == nil && rule.Max == nil {
+			return fmt.Errorf("allconfig.value_rules[%d]: schema, pattern, enum, min or max is required", i)
+		}
+		if rule.Schema != "" {
+			var schema map[string]interface{}
+			if err := json.Unmarshal([]byte(rule.Schema), &schema); err != nil {
+				return fmt.Errorf("allconfig.value_rules[%d]: schema must be a JSON object: %w", i, err)
+			}
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("allconfig.value_rules[%d]: invalid pattern: %w", i, err)
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return fmt.Errorf("allconfig.value_rules[%d]: min %v is greater than max %v", i, *rule.Min, *rule.Max)
+		}
+	}
+	return nil
+}
+
+// validate checks that enabled events name their brokers and topic and a supported SASL mechanism
+func (e *EventsConfig) validate() error {
+	if e.BufferSize < 0 {
+		return fmt.Errorf("events buffer_size cannot be negative")
+	}
+	if !e.Enabled {
+		return nil
+	}
+	kafka := e.Kafka
+	if len(kafka.Brokers) == 0 || kafka.Topic == "" {
+		return fmt.Errorf("events.kafka requires brokers and a topic")
+	}
+	if (kafka.TLS.CertFile == "") != (kafka.TLS.KeyFile == "") {
+		return fmt.Errorf("events.kafka.tls requires both cert_file and key_file")
+	}
+	if mechanism := kafka.SASL.Mechanism; mechanism != "" {
+		if !slices.Contains(saslMechanisms, strings.ToLower(mechanism)) {
+			return fmt.Errorf("invalid events.kafka.sasl mechanism: %q, must be one of: %s", mechanism, strings.Join(saslMechanisms, ", "))
+		}
+		if kafka.SASL.Username == "" {
+			return fmt.Errorf("events.kafka.sasl requires a username")
+		}
+	}
+	return nil
+}
+
+func sortedKeys(profiles map[string]ProfileConfig) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SaveConfig saves configuration to a file, as JSON when the name ends in .json and as YAML otherwise
 func SaveConfig(config *Config, configPath string) error {
 	if configPath == "" {
 		configPath = "config.yaml"
@@ -205,8 +1072,11 @@ func SaveConfig(config *Config, configPath string) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	// Marshal to YAML
-	data, err := yaml.Marshal(config)
+	format, ok := FormatFromPath(configPath)
+	if !ok {
+		format = FormatYAML
+	}
+	data, err := marshalConfig(config, format)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -221,49 +1091,26 @@ func SaveConfig(config *Config, configPath string) error {
 
 // LoadFromEnv loads configuration from environment variables
 func LoadFromEnv() *Config {
-	config := &Config{
-		LogLevel: getEnvWithDefault("LOG_LEVEL", "info"),
-		AppName:  getEnvWithDefault("APP_NAME", "db-connectors"),
-	}
+	config := &Config{}
+	loadFromEnvironment(config)
+	config.applyDefaults()
+	return config
+}
 
-	// MySQL configuration
-	if host := os.Getenv("MYSQL_HOST"); host != "" {
-		config.Databases.MySQL = &connectors.ConnectionConfig{
-			Host:     host,
-			Port:     getEnvIntWithDefault("MYSQL_PORT", 3306),
-			Username: os.Getenv("MYSQL_USERNAME"),
-			Password: os.Getenv("MYSQL_PASSWORD"),
-			Database: os.Getenv("MYSQL_DATABASE"),
-		}
+// applyDefaults sets the application settings that were not provided
+func (c *Config) applyDefaults() {
+	if c.LogLevel == "" {
+		c.LogLevel = "info"
 	}
-
-	// PostgreSQL configuration
-	if host := os.Getenv("POSTGRES_HOST"); host != "" {
-		config.Databases.PostgreSQL = &connectors.ConnectionConfig{
-			Host:     host,
-			Port:     getEnvIntWithDefault("POSTGRES_PORT", 5432),
-			Username: os.Getenv("POSTGRES_USERNAME"),
-			Password: os.Getenv("POSTGRES_PASSWORD"),
-			Database: os.Getenv("POSTGRES_DATABASE"),
-			SSLMode:  getEnvWithDefault("POSTGRES_SSLMODE", "disable"),
-		}
+	if c.LogFormat == "" {
+		c.LogFormat = "console"
 	}
-
-	// MongoDB configuration
-	if host := os.Getenv("MONGO_HOST"); host != "" {
-		config.Databases.MongoDB = &connectors.ConnectionConfig{
-			Host:     host,
-			Port:     getEnvIntWithDefault("MONGO_PORT", 27017),
-			Username: os.Getenv("MONGO_USERNAME"),
-			Password: os.Getenv("MONGO_PASSWORD"),
-			Database: os.Getenv("MONGO_DATABASE"),
-		}
+	if c.AppName == "" {
+		c.AppName = "db-connectors"
 	}
-
-	return config
 }
 
-// GenerateExampleConfig creates an example configuration file
+// GenerateExampleConfig creates an example configuration file in the format of its extension
 func GenerateExampleConfig(configPath string) error {
 	config := &Config{
 		LogLevel: "info",
@@ -297,34 +1144,60 @@ func GenerateExampleConfig(configPath string) error {
 	return SaveConfig(config, configPath)
 }
 
-// Helper functions
+// EnvInt returns the integer in the environment variable key. It reports false when the variable
+// is unset or empty, and logs a warning naming the variable when the value is not an integer.
+func EnvInt(key string) (int, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("ignoring environment variable that is not an integer", "variable", key, "value", value, "error", err)
+		return 0, false
+	}
+	return n, true
+}
 
-func getEnvWithDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// EnvInt64 returns the 64-bit integer in the environment variable key like EnvInt, for sizes in bytes
+func EnvInt64(key string) (int64, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, false
 	}
-	return defaultValue
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		slog.Warn("ignoring environment variable that is not an integer", "variable", key, "value", value, "error", err)
+		return 0, false
+	}
+	return n, true
 }
 
-func getEnvIntWithDefault(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		// Simple conversion, in production you'd want proper error handling
-		if intValue := parseIntSafe(value); intValue != 0 {
-			return intValue
-		}
+// EnvFloat returns the number in the environment variable key like EnvInt, logging a warning naming the
+// variable when the value is not a number
+func EnvFloat(key string) (float64, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, false
 	}
-	return defaultValue
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("ignoring environment variable that is not a number", "variable", key, "value", value, "error", err)
+		return 0, false
+	}
+	return f, true
 }
 
-func parseIntSafe(s string) int {
-	// Basic integer parsing - in production use strconv.Atoi with error handling
-	result := 0
-	for _, r := range s {
-		if r >= '0' && r <= '9' {
-			result = result*10 + int(r-'0')
-		} else {
-			return 0
-		}
+// EnvPort returns the port in the environment variable key like EnvInt, also ignoring
+// values outside 1-65535 with a warning
+func EnvPort(key string) (int, bool) {
+	port, ok := EnvInt(key)
+	if !ok {
+		return 0, false
+	}
+	if port < 1 || port > 65535 {
+		slog.Warn("ignoring environment variable with a port outside 1-65535", "variable", key, "value", port)
+		return 0, false
 	}
-	return result
+	return port, true
 }
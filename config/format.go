@@ -0,0 +1,88 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the encoding of a configuration file
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// FormatFromPath returns the format implied by the extension of path (.json, .yaml or .yml);
+// it reports false for other extensions
+func FormatFromPath(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, true
+	case ".yaml", ".yml":
+		return FormatYAML, true
+	}
+	return "", false
+}
+
+// detectFormat returns the format of a configuration file from its extension, falling back
+// to the content: a document starting with "{" is JSON
+func detectFormat(path string, data []byte) Format {
+	if format, ok := FormatFromPath(path); ok {
+		return format
+	}
+	if looksLikeJSON(data) {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// looksLikeJSON reports whether data starts with a JSON object
+func looksLikeJSON(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// unmarshalConfig decodes a configuration document of the given format into config
+func unmarshalConfig(path string, data []byte, format Format, config *Config) error {
+	if format == FormatJSON {
+		var document interface{}
+		if err := json.Unmarshal(data, &document); err != nil {
+			if !looksLikeJSON(data) {
+				return fmt.Errorf("%s is not valid JSON (%w); use a .yaml or .yml extension for YAML files", path, err)
+			}
+			return fmt.Errorf("invalid JSON in %s: %w", path, err)
+		}
+		// Re-encode the document as YAML so that both formats share the yaml tags, inline
+		// profiles and duration strings such as "30s"
+		var err error
+		if data, err = yaml.Marshal(document); err != nil {
+			return fmt.Errorf("failed to convert %s: %w", path, err)
+		}
+	}
+
+	return yaml.Unmarshal(data, config)
+}
+
+// marshalConfig encodes config in the given format
+func marshalConfig(config *Config, format Format) ([]byte, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil || format != FormatJSON {
+		return data, err
+	}
+
+	// Convert through the YAML encoding so that JSON files hold the same keys and values
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if data, err = json.MarshalIndent(document, "", "  "); err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
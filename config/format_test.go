@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"db-connectors/connectors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func roundTripConfig() *Config {
+	return &Config{
+		AppName:   "round-trip",
+		LogLevel:  "debug",
+		LogFormat: "json",
+		Databases: connectors.DatabaseConfig{
+			PostgreSQL: &connectors.ConnectionConfig{
+				Host:     "pg.internal",
+				Port:     5432,
+				Username: "app",
+				Password: "secret",
+				Database: "orders",
+				SSLMode:  "require",
+			},
+		},
+		Profiles: map[string]ProfileConfig{
+			"reporting": {
+				Type: "mysql",
+				ConnectionConfig: connectors.ConnectionConfig{
+					Host:     "mysql.internal",
+					Port:     3306,
+					Username: "report",
+					Password: "secret",
+					Database: "reports",
+				},
+				TableName: "settings",
+			},
+		},
+		DefaultProfile: "reporting",
+		Server: ServerConfig{
+			Port:            9090,
+			ReadTimeout:     30 * time.Second,
+			MaxRequestBytes: 1 << 20,
+		},
+		Jobs: JobsConfig{Enabled: true, Workers: 2, ResultTTL: time.Hour},
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.yml", "config.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, SaveConfig(roundTripConfig(), path))
+
+			loaded, err := LoadConfig(path)
+			require.NoError(t, err)
+			expected := roundTripConfig()
+			expected.Source = path
+			assert.Equal(t, expected, loaded)
+		})
+	}
+}
+
+func TestSaveConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, SaveConfig(roundTripConfig(), path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var document map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &document))
+
+	// JSON files use the same keys and duration strings as YAML files
+	server := document["server"].(map[string]interface{})
+	assert.Equal(t, "30s", server["read_timeout"])
+	reporting := document["profiles"].(map[string]interface{})["reporting"].(map[string]interface{})
+	assert.Equal(t, "mysql.internal", reporting["host"])
+	assert.Equal(t, "settings", reporting["table_name"])
+}
+
+func TestGenerateExampleConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.json")
+	require.NoError(t, GenerateExampleConfig(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, json.Valid(data))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 27017, config.Databases.MongoDB.Port)
+}
+
+func TestLoadConfigDetectsFormatFromContent(t *testing.T) {
+	content := "{\n\t\"app_name\": \"sniffed\",\n\t\"server\": {\"read_timeout\": \"5s\"}\n}\n"
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "sniffed", config.AppName)
+	assert.Equal(t, 5*time.Second, config.Server.ReadTimeout)
+}
+
+func TestLoadConfigMixedUpExtension(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("app_name: misnamed\n"), 0644))
+	_, err := LoadConfig(yamlPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config.json is not valid JSON")
+	assert.Contains(t, err.Error(), "use a .yaml or .yml extension for YAML files")
+
+	brokenPath := filepath.Join(dir, "broken.json")
+	require.NoError(t, os.WriteFile(brokenPath, []byte(`{"app_name": "broken",}`), 0644))
+	_, err = LoadConfig(brokenPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid JSON in "+brokenPath)
+
+	// JSON is a subset of YAML, so JSON content in a .yaml file still loads
+	jsonPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"app_name": "misnamed"}`), 0644))
+	config, err := LoadConfig(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, "misnamed", config.AppName)
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, expected := range map[string]Format{"a.json": FormatJSON, "b.YAML": FormatYAML, "c.yml": FormatYAML} {
+		format, ok := FormatFromPath(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, format, path)
+	}
+	_, ok := FormatFromPath("config.toml")
+	assert.False(t, ok)
+}
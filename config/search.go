@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// PathEnvVar names the environment variable that points at the configuration file
+const PathEnvVar = "DB_CONNECTORS_CONFIG"
+
+// systemConfigDir is the system-wide configuration directory searched last
+var systemConfigDir = "/etc/db-connectors"
+
+// SearchPaths returns the locations LoadConfig tries in order when it is given no path:
+// $DB_CONNECTORS_CONFIG, ./config.yaml, ~/.config/db-connectors/config.yaml and
+// /etc/db-connectors/config.yaml
+func SearchPaths() []string {
+	var paths []string
+	if path := os.Getenv(PathEnvVar); path != "" {
+		paths = append(paths, path)
+	}
+	paths = append(paths, "config.yaml")
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "db-connectors", "config.yaml"))
+	}
+	return append(paths, filepath.Join(systemConfigDir, "config.yaml"))
+}
+
+// FindConfig returns the first of SearchPaths that is an existing file, or "" when there is none
+func FindConfig() string {
+	for _, path := range SearchPaths() {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchDirs points every search location at its own temporary directory and returns the
+// environment variable path, working directory, home directory and system directory
+func searchDirs(t *testing.T) (envPath, workDir, homeDir, systemDir string) {
+	t.Helper()
+	envPath = filepath.Join(t.TempDir(), "custom.yaml")
+	workDir, homeDir, systemDir = t.TempDir(), t.TempDir(), t.TempDir()
+
+	t.Setenv(PathEnvVar, envPath)
+	t.Setenv("HOME", homeDir)
+
+	previousSystemDir := systemConfigDir
+	systemConfigDir = systemDir
+	t.Cleanup(func() { systemConfigDir = previousSystemDir })
+
+	previousDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(workDir))
+	t.Cleanup(func() { os.Chdir(previousDir) })
+	return envPath, workDir, homeDir, systemDir
+}
+
+func writeAppName(t *testing.T, path, appName string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("app_name: "+appName+"\n"), 0644))
+}
+
+func TestSearchPaths(t *testing.T) {
+	envPath, _, homeDir, systemDir := searchDirs(t)
+	assert.Equal(t, []string{
+		envPath,
+		"config.yaml",
+		filepath.Join(homeDir, ".config", "db-connectors", "config.yaml"),
+		filepath.Join(systemDir, "config.yaml"),
+	}, SearchPaths())
+
+	t.Setenv(PathEnvVar, "")
+	assert.Equal(t, "config.yaml", SearchPaths()[0])
+}
+
+func TestLoadConfigSearchOrder(t *testing.T) {
+	envPath, workDir, homeDir, systemDir := searchDirs(t)
+	homePath := filepath.Join(homeDir, ".config", "db-connectors", "config.yaml")
+	systemPath := filepath.Join(systemDir, "config.yaml")
+	candidates := []struct {
+		path    string
+		source  string // Relative paths are reported as searched
+		appName string
+	}{
+		{envPath, envPath, "from-env"},
+		{filepath.Join(workDir, "config.yaml"), "config.yaml", "from-workdir"},
+		{homePath, homePath, "from-home"},
+		{systemPath, systemPath, "from-system"},
+	}
+	for _, candidate := range candidates {
+		writeAppName(t, candidate.path, candidate.appName)
+	}
+
+	// Each location wins over the ones after it; remove them one at a time
+	for _, candidate := range candidates {
+		config, err := LoadConfig("")
+		require.NoError(t, err)
+		assert.Equal(t, candidate.appName, config.AppName)
+		assert.Equal(t, candidate.source, config.Source)
+		require.NoError(t, os.Remove(candidate.path))
+	}
+
+	// With no file anywhere only the environment is used
+	assert.Equal(t, "", FindConfig())
+	config, err := LoadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, "", config.Source)
+	assert.Equal(t, "db-connectors", config.AppName)
+}
+
+func TestLoadConfigExplicitPathSkipsSearch(t *testing.T) {
+	_, workDir, _, _ := searchDirs(t)
+	writeAppName(t, filepath.Join(workDir, "config.yaml"), "searched")
+	explicit := filepath.Join(t.TempDir(), "explicit.yaml")
+	writeAppName(t, explicit, "explicit")
+
+	config, err := LoadConfig(explicit)
+	require.NoError(t, err)
+	assert.Equal(t, "explicit", config.AppName)
+	assert.Equal(t, explicit, config.Source)
+}
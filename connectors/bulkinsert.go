@@ -0,0 +1,180 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// maxInsertPlaceholders is the most bind parameters one MySQL statement may hold
+const maxInsertPlaceholders = 65535
+
+// BulkInserter is implemented by connectors that load many rows into a table far faster than one INSERT
+// per row: COPY on PostgreSQL and multi-row INSERTs on MySQL
+type BulkInserter interface {
+	DBConnector
+
+	// BulkInsert loads rows, each holding a value for every column, into table in one transaction and
+	// returns the number of rows loaded. Nothing is loaded when it fails.
+	BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error)
+}
+
+// checkBulkRows rejects a bulk insert without columns or with rows not holding a value for every column
+func checkBulkRows(columns []string, rows [][]interface{}) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("bulk insert requires at least one column")
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return fmt.Errorf("row %d has %d values for %d columns", i, len(row), len(columns))
+		}
+	}
+	return nil
+}
+
+// insertBatches splits rows holding columns values each into the [lo, hi) ranges of the multi-row INSERTs
+// loading them, each holding at most batchRows rows and maxInsertPlaceholders bind parameters
+func insertBatches(rows, columns, batchRows int) [][2]int {
+	if columns <= 0 {
+		return nil
+	}
+	if max := maxInsertPlaceholders / columns; batchRows <= 0 || batchRows > max {
+		batchRows = max
+	}
+	var batches [][2]int
+	for lo := 0; lo < rows; lo += batchRows {
+		hi := lo + batchRows
+		if hi > rows {
+			hi = rows
+		}
+		batches = append(batches, [2]int{lo, hi})
+	}
+	return batches
+}
+
+// quoteTable quotes each part of a table name that may be qualified by its schema
+func quoteTable(d Dialect, table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = d.QuoteIdent(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteColumns quotes column names and joins them into a column list
+func quoteColumns(d Dialect, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = d.QuoteIdent(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// multiRowInsert builds the INSERT of rows into table with its args
+func multiRowInsert(d Dialect, table string, columns []string, rows [][]interface{}) (string, []interface{}) {
+	var query strings.Builder
+	query.WriteString("INSERT INTO " + quoteTable(d, table) + " (" + quoteColumns(d, columns) + ") VALUES ")
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteByte('(')
+		for j := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString(d.Placeholder(len(args) + j + 1))
+		}
+		query.WriteByte(')')
+		args = append(args, row...)
+	}
+	return query.String(), args
+}
+
+// BulkInsert loads rows into table with multi-row INSERTs of as many rows as fit in one statement, run in
+// one transaction
+func (m *MySQLConnector) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	if m.db == nil {
+		return 0, fmt.Errorf("MySQL connection not established")
+	}
+	if err := checkBulkRows(columns, rows); err != nil {
+		return 0, err
+	}
+	d := MySQLDialect{}
+	text := "INSERT INTO " + quoteTable(d, table) + " (" + quoteColumns(d, columns) + ") VALUES …"
+	stmt := m.statements.beginSQL(m.logger, m.config.Labels, "bulk_insert", text, len(rows)*len(columns))
+	loaded, err := inTransaction(ctx, m.db, func(tx *sql.Tx) (int64, error) {
+		var loaded int64
+		for _, batch := range insertBatches(len(rows), len(columns), 0) {
+			query, args := multiRowInsert(d, table, columns, rows[batch[0]:batch[1]])
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return 0, err
+			}
+			loaded += int64(batch[1] - batch[0])
+		}
+		return loaded, nil
+	})
+	stmt.end(ctx, loaded, err)
+	return loaded, err
+}
+
+// BulkInsert loads rows into table with COPY FROM STDIN, in one transaction
+func (p *PostgreSQLConnector) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	if p.db == nil {
+		return 0, fmt.Errorf("PostgreSQL connection not established")
+	}
+	if err := checkBulkRows(columns, rows); err != nil {
+		return 0, err
+	}
+	query := copyIn(table, columns)
+	stmt := p.statements.beginSQL(p.logger, p.config.Labels, "bulk_insert", query, len(rows)*len(columns))
+	loaded, err := inTransaction(ctx, p.db, func(tx *sql.Tx) (int64, error) {
+		copied, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return 0, err
+		}
+		defer copied.Close()
+		for _, row := range rows {
+			if _, err := copied.ExecContext(ctx, row...); err != nil {
+				return 0, err
+			}
+		}
+		// Executing without values ends the COPY, which is when rows are checked against the table
+		if _, err := copied.ExecContext(ctx); err != nil {
+			return 0, err
+		}
+		return int64(len(rows)), nil
+	})
+	stmt.end(ctx, loaded, err)
+	return loaded, err
+}
+
+// copyIn returns the COPY FROM STDIN statement loading columns into table, which may be qualified by its
+// schema
+func copyIn(table string, columns []string) string {
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return pq.CopyInSchema(schema, name, columns...)
+	}
+	return pq.CopyIn(table, columns...)
+}
+
+// inTransaction runs load in a transaction, committing it when load succeeds and rolling it back otherwise
+func inTransaction(ctx context.Context, db *sql.DB, load func(tx *sql.Tx) (int64, error)) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	loaded, err := load(tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return loaded, nil
+}
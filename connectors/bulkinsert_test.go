@@ -0,0 +1,107 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"db-connectors/logging"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertBatches(t *testing.T) {
+	assert.Equal(t, [][2]int{{0, 2}, {2, 4}, {4, 5}}, insertBatches(5, 3, 2))
+	assert.Nil(t, insertBatches(0, 3, 2))
+	assert.Nil(t, insertBatches(5, 0, 2))
+
+	// Batches never hold more bind parameters than MySQL accepts
+	batches := insertBatches(70000, 2, 0)
+	require.Len(t, batches, 3)
+	assert.Equal(t, [2]int{0, 32767}, batches[0])
+	assert.Equal(t, [2]int{65534, 70000}, batches[2])
+	assert.Equal(t, [][2]int{{0, 6553}, {6553, 10000}}, insertBatches(10000, 10, 50000))
+}
+
+func TestMultiRowInsert(t *testing.T) {
+	rows := [][]interface{}{{1, "a"}, {2, nil}}
+	query, args := multiRowInsert(MySQLDialect{}, "app.orders", []string{"id", "note"}, rows)
+	assert.Equal(t, "INSERT INTO `app`.`orders` (`id`, `note`) VALUES (?, ?), (?, ?)", query)
+	assert.Equal(t, []interface{}{1, "a", 2, nil}, args)
+
+	query, _ = multiRowInsert(PostgreSQLDialect{}, "orders", []string{"id", "note"}, rows)
+	assert.Equal(t, `INSERT INTO "orders" ("id", "note") VALUES ($1, $2), ($3, $4)`, query)
+}
+
+func TestCheckBulkRows(t *testing.T) {
+	assert.NoError(t, checkBulkRows([]string{"id"}, [][]interface{}{{1}, {2}}))
+	assert.EqualError(t, checkBulkRows(nil, nil), "bulk insert requires at least one column")
+	assert.EqualError(t, checkBulkRows([]string{"id", "note"}, [][]interface{}{{1, "a"}, {2}}), "row 1 has 1 values for 2 columns")
+}
+
+func TestCopyIn(t *testing.T) {
+	assert.Equal(t, `COPY "orders" ("id", "note") FROM STDIN`, copyIn("orders", []string{"id", "note"}))
+	assert.Equal(t, `COPY "app"."orders" ("id") FROM STDIN`, copyIn("app.orders", []string{"id"}))
+}
+
+func TestMySQLBulkInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	connector := NewMySQLConnector(&ConnectionConfig{}, WithLogger(logging.Discard()))
+	connector.db = db
+	ctx := context.Background()
+	rows := [][]interface{}{{1, "a"}, {2, "b"}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `orders` (`id`, `note`) VALUES (?, ?), (?, ?)")).
+		WithArgs(1, "a", 2, "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	loaded, err := connector.BulkInsert(ctx, "orders", []string{"id", "note"}, rows)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), loaded)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `orders`").WillReturnError(errors.New("duplicate entry"))
+	mock.ExpectRollback()
+	loaded, err = connector.BulkInsert(ctx, "orders", []string{"id", "note"}, rows)
+	assert.EqualError(t, err, "duplicate entry")
+	assert.Zero(t, loaded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLBulkInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	connector := NewPostgreSQLConnector(&ConnectionConfig{}, WithLogger(logging.Discard()))
+	connector.db = db
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	copied := mock.ExpectPrepare(regexp.QuoteMeta(`COPY "orders" ("id", "note") FROM STDIN`))
+	copied.ExpectExec().WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 0))
+	copied.ExpectExec().WithArgs(2, nil).WillReturnResult(sqlmock.NewResult(0, 0))
+	copied.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	loaded, err := connector.BulkInsert(ctx, "orders", []string{"id", "note"}, [][]interface{}{{1, "a"}, {2, nil}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), loaded)
+
+	// Rows are checked when the COPY ends, which rolls the whole load back
+	mock.ExpectBegin()
+	copied = mock.ExpectPrepare("COPY")
+	copied.ExpectExec().WithArgs("x", "a").WillReturnResult(sqlmock.NewResult(0, 0))
+	copied.ExpectExec().WithArgs().WillReturnError(errors.New(`invalid input syntax for type integer: "x"`))
+	mock.ExpectRollback()
+	loaded, err = connector.BulkInsert(ctx, "orders", []string{"id", "note"}, [][]interface{}{{"x", "a"}})
+	assert.EqualError(t, err, `invalid input syntax for type integer: "x"`)
+	assert.Zero(t, loaded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = NewPostgreSQLConnector(&ConnectionConfig{}).BulkInsert(ctx, "orders", []string{"id"}, nil)
+	assert.EqualError(t, err, "PostgreSQL connection not established")
+}
@@ -0,0 +1,690 @@
+package connectortest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"db-connectors/connectors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// duplicateKeyCode is the code of MongoDB's duplicate key errors, which mongo.IsDuplicateKeyError and
+// connectors.IsDuplicateKey look for
+const duplicateKeyCode = 11000
+
+// Fake is a MongoDB connector keeping its collections in memory, so that code running MongoDB operations
+// through the connectors package, such as the allconfig maker-checker flow of the api package, can be tested
+// without a server. It runs the collection operations of MongoDBConnector and returns what MongoDBConnector
+// returns for them, with its error messages:
+//
+//   - find, with sort, skip, limit and a collation of strength 1 or 2 comparing strings regardless of case;
+//     findOne and count
+//   - insert, insertMany, update, updateMany, upsert, delete, deleteMany and bulkWrite
+//   - createIndex, whose unique indexes reject duplicate keys as MongoDB does and whose TTL indexes delete
+//     expired documents before the next operation, and listIndexes
+//   - listCollections and listDatabases
+//
+// Filters support equality, $eq, $ne, $in, $nin, $exists, $gt, $gte, $lt, $lte, $not, $regex, $all, $or,
+// $and and $nor on dotted paths; updates support $set, $unset, $setOnInsert, $currentDate and $inc. Other
+// operators fail the operation. Documents keep the Go values they were written with, where the driver would
+// decode dates as primitive.DateTime and arrays as primitive.A. A sort on several fields of a map applies them
+// in name order, as a map holds no order.
+type Fake struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	collections map[string]*fakeCollection
+	order       []string // Collection names in creation order
+	lastID      uint64
+	closed      bool
+}
+
+// fakeCollection holds the documents of a collection in insertion order and its indexes
+type fakeCollection struct {
+	docs    []map[string]interface{}
+	indexes []fakeIndex
+}
+
+// fakeIndex is an index created by createIndex
+type fakeIndex struct {
+	name   string
+	keys   []string
+	unique bool
+	ttl    *time.Duration // Age at which a TTL index deletes a document
+}
+
+// NewFake returns a connected Fake with no collections, stamping $currentDate with the current time
+func NewFake() *Fake {
+	return &Fake{
+		now:         time.Now,
+		collections: make(map[string]*fakeCollection),
+	}
+}
+
+// SetNow sets the clock that $currentDate stamps documents with and TTL indexes expire them by
+func (f *Fake) SetNow(now func() time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// Insert stores docs in collection as they are, adding an _id to those without one. It is meant for seeding
+// a test, so unique indexes are not checked.
+func (f *Fake) Insert(collection string, docs ...map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(collection)
+	for _, doc := range docs {
+		coll.docs = append(coll.docs, f.withID(doc))
+	}
+}
+
+// Documents returns copies of the documents of collection, in insertion order
+func (f *Fake) Documents(collection string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire()
+	var docs []map[string]interface{}
+	if coll, ok := f.collections[collection]; ok {
+		for _, doc := range coll.docs {
+			docs = append(docs, cloneDocument(doc))
+		}
+	}
+	return docs
+}
+
+// Connect reconnects a closed Fake
+func (f *Fake) Connect(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = false
+	return nil
+}
+
+// Ping fails once the Fake is closed
+func (f *Fake) Ping(ctx context.Context) error {
+	if !f.IsConnected(ctx) {
+		return fmt.Errorf("MongoDB connection not established")
+	}
+	return nil
+}
+
+// Close disconnects the Fake, keeping its collections for a later Connect
+func (f *Fake) Close(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// GetType returns mongodb
+func (f *Fake) GetType() string {
+	return "mongodb"
+}
+
+// Query fails as it does for MongoDB
+func (f *Fake) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, fmt.Errorf("Query method not applicable for MongoDB, use Execute instead")
+}
+
+// IsConnected reports whether the Fake has not been closed
+func (f *Fake) IsConnected(ctx context.Context) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.closed
+}
+
+// GetServerInfo describes the Fake as a server of version "fake"
+func (f *Fake) GetServerInfo(ctx context.Context) (*connectors.ServerInfo, error) {
+	return &connectors.ServerInfo{Version: "fake", TimeZone: "UTC"}, nil
+}
+
+// Execute runs a MongoDB operation on the collections in memory
+func (f *Fake) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, fmt.Errorf("MongoDB connection not established")
+	}
+	f.expire()
+
+	switch operation {
+	case "listCollections":
+		filter, _ := params["filter"].(map[string]interface{})
+		var collections []map[string]interface{}
+		for _, name := range f.order {
+			info := map[string]interface{}{"name": name, "type": "collection"}
+			ok, err := matches(info, filter, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list collections: %w", err)
+			}
+			if ok {
+				collections = append(collections, info)
+			}
+		}
+		return collections, nil
+
+	case "listDatabases":
+		return []map[string]interface{}{{"name": "fake", "size_bytes": int64(0), "empty": len(f.order) == 0}}, nil
+	}
+
+	collection, ok := params["collection"].(string)
+	if !ok {
+		return nil, fmt.Errorf("collection parameter required for MongoDB collection operations")
+	}
+	filter, _ := params["filter"].(map[string]interface{})
+
+	switch operation {
+	case "find":
+		docs, err := f.find(collection, filter, strength(params) > 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute find: %w", err)
+		}
+		sortDocuments(docs, params["sort"])
+		docs = page(docs, intParam(params["skip"]), intParam(params["limit"]))
+		var results []map[string]interface{}
+		for _, doc := range docs {
+			results = append(results, cloneDocument(doc))
+		}
+		return results, nil
+
+	case "findOne":
+		docs, err := f.find(collection, filter, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute findOne: %w", err)
+		}
+		if len(docs) == 0 {
+			return nil, connectors.ErrNotFound
+		}
+		return cloneDocument(docs[0]), nil
+
+	case "count":
+		docs, err := f.find(collection, filter, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count documents: %w", err)
+		}
+		return int64(len(docs)), nil
+
+	case "insert":
+		document, ok := params["document"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("document parameter required for insert operation")
+		}
+		id, err := f.insert(collection, document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert document: %w", err)
+		}
+		return &mongo.InsertOneResult{InsertedID: id}, nil
+
+	case "insertMany":
+		documents, ok := params["documents"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("documents parameter required for insertMany operation")
+		}
+		result := &mongo.InsertManyResult{}
+		for i, document := range documents {
+			doc, _ := document.(map[string]interface{})
+			id, err := f.insert(collection, doc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert documents: %w", bulkWriteException(i, err))
+			}
+			result.InsertedIDs = append(result.InsertedIDs, id)
+		}
+		return result, nil
+
+	case "update", "updateMany", "upsert":
+		update, _ := params["update"].(map[string]interface{})
+		if params["filter"] == nil || update == nil {
+			return nil, fmt.Errorf("filter and update parameters required for %s operation", operation)
+		}
+		result, err := f.update(collection, filter, update, operation == "updateMany", operation == "upsert")
+		if err != nil {
+			return nil, fmt.Errorf("failed to %s: %w", map[string]string{
+				"update":     "update document",
+				"updateMany": "update documents",
+				"upsert":     "upsert document",
+			}[operation], err)
+		}
+		return result, nil
+
+	case "delete", "deleteMany":
+		if params["filter"] == nil {
+			return nil, fmt.Errorf("filter parameter required for %s operation", operation)
+		}
+		deleted, err := f.delete(collection, filter, operation == "deleteMany")
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", map[bool]string{false: "document", true: "documents"}[operation == "deleteMany"], err)
+		}
+		return &mongo.DeleteResult{DeletedCount: deleted}, nil
+
+	case "bulkWrite":
+		operations, ok := params["operations"].([]interface{})
+		if !ok || len(operations) == 0 {
+			return nil, fmt.Errorf("operations parameter required for bulkWrite operation")
+		}
+		ordered := true
+		if o, ok := params["ordered"].(bool); ok {
+			ordered = o
+		}
+		result, err := f.bulkWrite(collection, operations, ordered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bulk write documents: %w", err)
+		}
+		return result, nil
+
+	case "listIndexes":
+		indexes := []map[string]interface{}{{"name": "_id_", "keys": []string{"_id"}, "unique": false}}
+		if coll, ok := f.collections[collection]; ok {
+			for _, idx := range coll.indexes {
+				indexes = append(indexes, map[string]interface{}{"name": idx.name, "keys": idx.keys, "unique": idx.unique})
+			}
+		}
+		return indexes, nil
+
+	case "createIndex":
+		name, err := f.createIndex(collection, params)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"name": name}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", connectors.ErrUnsupportedOperation, operation)
+	}
+}
+
+// collection returns the collection called name, creating it as MongoDB does on its first write
+func (f *Fake) collection(name string) *fakeCollection {
+	coll, ok := f.collections[name]
+	if !ok {
+		coll = &fakeCollection{}
+		f.collections[name] = coll
+		f.order = append(f.order, name)
+	}
+	return coll
+}
+
+// withID returns a copy of doc with an _id, generating one when it has none. Generated ObjectIDs count up
+// from 1, so that a test sees the same ones on every run.
+func (f *Fake) withID(doc map[string]interface{}) map[string]interface{} {
+	stored := cloneDocument(doc)
+	if _, ok := stored["_id"]; !ok {
+		f.lastID++
+		var id primitive.ObjectID
+		binary.BigEndian.PutUint64(id[4:], f.lastID)
+		stored["_id"] = id
+	}
+	return stored
+}
+
+// find returns the stored documents of collection matching filter, in insertion order
+func (f *Fake) find(collection string, filter map[string]interface{}, fold bool) ([]map[string]interface{}, error) {
+	coll, ok := f.collections[collection]
+	if !ok {
+		return nil, nil
+	}
+	var found []map[string]interface{}
+	for _, doc := range coll.docs {
+		ok, err := matches(doc, filter, fold)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, doc)
+		}
+	}
+	return found, nil
+}
+
+// insert stores a copy of doc in collection, returning its _id
+func (f *Fake) insert(collection string, doc map[string]interface{}) (interface{}, error) {
+	if doc == nil {
+		return nil, fmt.Errorf("document parameter required for insert operation")
+	}
+	coll := f.collection(collection)
+	stored := f.withID(doc)
+	if err := coll.checkUnique(collection, stored, nil); err != nil {
+		return nil, err
+	}
+	coll.docs = append(coll.docs, stored)
+	return stored["_id"], nil
+}
+
+// update applies update to the first document of collection matching filter, or to all of them with many,
+// inserting one built from the filter and update when none matches and upsert is set
+func (f *Fake) update(collection string, filter, update map[string]interface{}, many, upsert bool) (*mongo.UpdateResult, error) {
+	coll := f.collection(collection)
+	result := &mongo.UpdateResult{}
+	for i, doc := range coll.docs {
+		ok, err := matches(doc, filter, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		updated := cloneDocument(doc)
+		if err := applyUpdate(updated, update, false, f.now()); err != nil {
+			return nil, err
+		}
+		if err := coll.checkUnique(collection, updated, doc); err != nil {
+			return nil, err
+		}
+		result.MatchedCount++
+		if !equal(doc, updated, false) {
+			result.ModifiedCount++
+		}
+		coll.docs[i] = updated
+		if !many {
+			break
+		}
+	}
+	if result.MatchedCount > 0 || !upsert {
+		return result, nil
+	}
+
+	inserted := make(map[string]interface{})
+	for key, value := range filter {
+		if _, isOperator := operators(value); !strings.HasPrefix(key, "$") && !isOperator {
+			setPath(inserted, key, cloneValue(value))
+		}
+	}
+	if err := applyUpdate(inserted, update, true, f.now()); err != nil {
+		return nil, err
+	}
+	id, err := f.insert(collection, inserted)
+	if err != nil {
+		return nil, err
+	}
+	result.UpsertedCount = 1
+	result.UpsertedID = id
+	return result, nil
+}
+
+// replace replaces the first document of collection matching filter with replacement, keeping its _id
+func (f *Fake) replace(collection string, filter, replacement map[string]interface{}, upsert bool) (*mongo.UpdateResult, error) {
+	for key := range replacement {
+		if strings.HasPrefix(key, "$") {
+			return nil, fmt.Errorf("replacement document cannot contain keys beginning with '$'")
+		}
+	}
+	coll := f.collection(collection)
+	for i, doc := range coll.docs {
+		ok, err := matches(doc, filter, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		replaced := cloneDocument(replacement)
+		replaced["_id"] = doc["_id"]
+		if err := coll.checkUnique(collection, replaced, doc); err != nil {
+			return nil, err
+		}
+		coll.docs[i] = replaced
+		return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+	}
+	if !upsert {
+		return &mongo.UpdateResult{}, nil
+	}
+	id, err := f.insert(collection, replacement)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.UpdateResult{UpsertedCount: 1, UpsertedID: id}, nil
+}
+
+// delete deletes the first document of collection matching filter, or all of them with many
+func (f *Fake) delete(collection string, filter map[string]interface{}, many bool) (int64, error) {
+	coll, ok := f.collections[collection]
+	if !ok {
+		return 0, nil
+	}
+	var kept []map[string]interface{}
+	var deleted int64
+	for _, doc := range coll.docs {
+		if many || deleted == 0 {
+			ok, err := matches(doc, filter, false)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				deleted++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	coll.docs = kept
+	return deleted, nil
+}
+
+// bulkWrite runs the writes of a bulkWrite in order. An ordered bulkWrite stops at the first failing write,
+// an unordered one runs the others; either fails with a mongo.BulkWriteException listing the failed writes.
+func (f *Fake) bulkWrite(collection string, operations []interface{}, ordered bool) (*mongo.BulkWriteResult, error) {
+	result := &mongo.BulkWriteResult{UpsertedIDs: make(map[int64]interface{})}
+	var failed mongo.BulkWriteException
+	for i, operation := range operations {
+		op, ok := operation.(map[string]interface{})
+		if !ok || len(op) != 1 {
+			return nil, fmt.Errorf("bulkWrite operation %d must hold exactly one write", i)
+		}
+		var err error
+		for kind, value := range op {
+			args, _ := value.(map[string]interface{})
+			filter, _ := args["filter"].(map[string]interface{})
+			upsert, _ := args["upsert"].(bool)
+			if args == nil || (kind == "insertOne" && args["document"] == nil) || (kind != "insertOne" && args["filter"] == nil) {
+				return nil, fmt.Errorf("bulkWrite operation %d: %s is missing its arguments", i, kind)
+			}
+			var updated *mongo.UpdateResult
+			switch kind {
+			case "insertOne":
+				document, _ := args["document"].(map[string]interface{})
+				if _, err = f.insert(collection, document); err == nil {
+					result.InsertedCount++
+				}
+			case "updateOne", "updateMany":
+				update, _ := args["update"].(map[string]interface{})
+				updated, err = f.update(collection, filter, update, kind == "updateMany", upsert)
+			case "replaceOne":
+				replacement, _ := args["replacement"].(map[string]interface{})
+				updated, err = f.replace(collection, filter, replacement, upsert)
+			case "deleteOne", "deleteMany":
+				var deleted int64
+				deleted, err = f.delete(collection, filter, kind == "deleteMany")
+				result.DeletedCount += deleted
+			default:
+				return nil, fmt.Errorf("bulkWrite operation %d: unsupported write %s", i, kind)
+			}
+			if updated != nil {
+				result.MatchedCount += updated.MatchedCount
+				result.ModifiedCount += updated.ModifiedCount
+				result.UpsertedCount += updated.UpsertedCount
+				if updated.UpsertedID != nil {
+					result.UpsertedIDs[int64(i)] = updated.UpsertedID
+				}
+			}
+		}
+		if err != nil {
+			failed.WriteErrors = append(failed.WriteErrors, bulkWriteException(i, err).WriteErrors...)
+			if ordered {
+				break
+			}
+		}
+	}
+	if len(failed.WriteErrors) > 0 {
+		return nil, failed
+	}
+	return result, nil
+}
+
+// createIndex creates the index of a createIndex, named after its keys unless its options name it. Creating
+// an index that exists already does nothing; a unique index fails on documents already sharing a key.
+func (f *Fake) createIndex(collection string, params map[string]interface{}) (string, error) {
+	var idx fakeIndex
+	switch keys := params["index"].(type) {
+	case nil:
+		return "", fmt.Errorf("index is required for createIndex")
+	case bson.D:
+		for _, elem := range keys {
+			idx.keys = append(idx.keys, elem.Key)
+		}
+	case map[string]interface{}:
+		for key := range keys {
+			idx.keys = append(idx.keys, key)
+		}
+		sort.Strings(idx.keys)
+	default:
+		return "", fmt.Errorf("failed to create index: unsupported index keys %T", keys)
+	}
+	names := make([]string, len(idx.keys))
+	for i, key := range idx.keys {
+		names[i] = key + "_1"
+	}
+	idx.name = strings.Join(names, "_")
+
+	spec, _ := params["options"].(map[string]interface{})
+	idx.unique, _ = spec["unique"].(bool)
+	if name, ok := spec["name"].(string); ok {
+		idx.name = name
+	}
+	if seconds, ok := number(spec["expireAfterSeconds"]); ok {
+		ttl := time.Duration(seconds * float64(time.Second))
+		idx.ttl = &ttl
+	}
+
+	coll := f.collection(collection)
+	for _, existing := range coll.indexes {
+		if existing.name == idx.name {
+			return idx.name, nil
+		}
+	}
+	if idx.unique {
+		for i, doc := range coll.docs {
+			for _, other := range coll.docs[:i] {
+				if idx.duplicates(doc, other) {
+					return "", fmt.Errorf("failed to create index: %w", duplicateKeyError(collection, idx))
+				}
+			}
+		}
+	}
+	coll.indexes = append(coll.indexes, idx)
+	return idx.name, nil
+}
+
+// expire deletes the documents whose TTL index has expired them, as MongoDB's TTL monitor does about once a
+// minute; the Fake does it before every operation
+func (f *Fake) expire() {
+	now := f.now()
+	for _, coll := range f.collections {
+		for _, idx := range coll.indexes {
+			if idx.ttl == nil || len(idx.keys) != 1 {
+				continue
+			}
+			var kept []map[string]interface{}
+			for _, doc := range coll.docs {
+				value, _ := lookup(doc, idx.keys[0])
+				if at, ok := dateOf(value); ok && !at.Add(*idx.ttl).After(now) {
+					continue
+				}
+				kept = append(kept, doc)
+			}
+			coll.docs = kept
+		}
+	}
+}
+
+// checkUnique fails with a duplicate key error when doc shares the key of a unique index with a document of
+// the collection other than replaced, the document doc is replacing
+func (c *fakeCollection) checkUnique(collection string, doc, replaced map[string]interface{}) error {
+	for _, idx := range c.indexes {
+		if !idx.unique {
+			continue
+		}
+		for _, other := range c.docs {
+			if !sameDocument(other, replaced) && idx.duplicates(doc, other) {
+				return duplicateKeyError(collection, idx)
+			}
+		}
+	}
+	return nil
+}
+
+// duplicates reports whether two documents hold the same key of the index; a missing field is null
+func (idx fakeIndex) duplicates(a, b map[string]interface{}) bool {
+	for _, key := range idx.keys {
+		x, _ := lookup(a, key)
+		y, _ := lookup(b, key)
+		if !equal(x, y, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameDocument reports whether a and b are the same stored document
+func sameDocument(a, b map[string]interface{}) bool {
+	return a != nil && b != nil && equal(a["_id"], b["_id"], false)
+}
+
+// duplicateKeyError returns the error MongoDB fails a write breaking the unique index idx with
+func duplicateKeyError(collection string, idx fakeIndex) error {
+	return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+		Code:    duplicateKeyCode,
+		Message: fmt.Sprintf("E11000 duplicate key error collection: fake.%s index: %s", collection, idx.name),
+	}}}
+}
+
+// bulkWriteException returns err, the failure of the write at index of a bulk write, as a bulk write fails
+func bulkWriteException(index int, err error) mongo.BulkWriteException {
+	writeErr := mongo.WriteError{Index: index, Message: err.Error()}
+	if exception, ok := err.(mongo.WriteException); ok && len(exception.WriteErrors) > 0 {
+		writeErr = exception.WriteErrors[0]
+		writeErr.Index = index
+	}
+	return mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: writeErr}}}
+}
+
+// strength returns the strength of the collation of a find, or 0 when it has none. Strengths 1 and 2 compare
+// strings regardless of case.
+func strength(params map[string]interface{}) float64 {
+	collation, _ := params["collation"].(map[string]interface{})
+	s, _ := number(collation["strength"])
+	if s > 2 {
+		return 0
+	}
+	return s
+}
+
+// intParam returns a skip or limit given as an int or int64, as MongoDBConnector reads them, or 0
+func intParam(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// page returns the documents left after skipping skip of them, at most limit of them unless limit is 0
+func page(docs []map[string]interface{}, skip, limit int) []map[string]interface{} {
+	if skip >= len(docs) {
+		return nil
+	}
+	docs = docs[skip:]
+	if limit > 0 && limit < len(docs) {
+		docs = docs[:limit]
+	}
+	return docs
+}
@@ -0,0 +1,222 @@
+package connectortest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"db-connectors/connectors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var _ connectors.DBConnector = (*Fake)(nil)
+
+func TestFakeCRUD(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake.SetNow(func() time.Time { return now })
+	run := func(operation string, params map[string]interface{}) interface{} {
+		t.Helper()
+		result, err := fake.Execute(ctx, operation, params)
+		require.NoError(t, err, operation)
+		return result
+	}
+
+	inserted := run("insert", map[string]interface{}{"collection": "users", "document": map[string]interface{}{"name": "ana", "age": 31}}).(*mongo.InsertOneResult)
+	assert.NotNil(t, inserted.InsertedID)
+	run("insertMany", map[string]interface{}{"collection": "users", "documents": []interface{}{
+		map[string]interface{}{"name": "bo", "age": int64(25)},
+		map[string]interface{}{"name": "cy", "age": 40.0},
+	}})
+
+	older := run("find", map[string]interface{}{
+		"collection": "users",
+		"filter":     map[string]interface{}{"age": map[string]interface{}{"$gt": 30}},
+		"sort":       map[string]interface{}{"age": -1},
+	}).([]map[string]interface{})
+	require.Len(t, older, 2)
+	assert.Equal(t, "cy", older[0]["name"])
+	assert.Equal(t, "ana", older[1]["name"])
+
+	// Results are copies
+	older[0]["name"] = "changed"
+	found := run("findOne", map[string]interface{}{"collection": "users", "filter": map[string]interface{}{"age": 40}}).(map[string]interface{})
+	assert.Equal(t, "cy", found["name"])
+
+	updated := run("update", map[string]interface{}{
+		"collection": "users",
+		"filter":     map[string]interface{}{"name": "bo"},
+		"update":     map[string]interface{}{"$set": map[string]interface{}{"age": 26}, "$currentDate": map[string]interface{}{"updated_at": true}},
+	}).(*mongo.UpdateResult)
+	assert.Equal(t, &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, updated)
+	bo := run("findOne", map[string]interface{}{"collection": "users", "filter": map[string]interface{}{"name": "bo"}}).(map[string]interface{})
+	assert.Equal(t, 26, bo["age"])
+	assert.Equal(t, now, bo["updated_at"])
+
+	upserted := run("upsert", map[string]interface{}{
+		"collection": "users",
+		"filter":     map[string]interface{}{"name": "di"},
+		"update":     map[string]interface{}{"$set": map[string]interface{}{"age": 19}, "$setOnInsert": map[string]interface{}{"created_at": now}},
+	}).(*mongo.UpdateResult)
+	assert.EqualValues(t, 1, upserted.UpsertedCount)
+	di := run("findOne", map[string]interface{}{"collection": "users", "filter": map[string]interface{}{"name": "di"}}).(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"_id": upserted.UpsertedID, "name": "di", "age": 19, "created_at": now}, di)
+
+	assert.EqualValues(t, 4, run("count", map[string]interface{}{"collection": "users"}))
+	deleted := run("deleteMany", map[string]interface{}{"collection": "users", "filter": map[string]interface{}{"age": map[string]interface{}{"$lt": 30}}}).(*mongo.DeleteResult)
+	assert.EqualValues(t, 2, deleted.DeletedCount)
+	assert.Len(t, fake.Documents("users"), 2)
+
+	paged := run("find", map[string]interface{}{"collection": "users", "sort": map[string]interface{}{"name": 1}, "skip": 1, "limit": int64(5)}).([]map[string]interface{})
+	require.Len(t, paged, 1)
+	assert.Equal(t, "cy", paged[0]["name"])
+
+	_, err := fake.Execute(ctx, "findOne", map[string]interface{}{"collection": "users", "filter": map[string]interface{}{"name": "zed"}})
+	assert.ErrorIs(t, err, connectors.ErrNotFound)
+	_, err = fake.Execute(ctx, "explain", map[string]interface{}{"collection": "users"})
+	assert.ErrorIs(t, err, connectors.ErrUnsupportedOperation)
+	_, err = fake.Execute(ctx, "find", map[string]interface{}{})
+	assert.EqualError(t, err, "collection parameter required for MongoDB collection operations")
+}
+
+func TestFakeUniqueIndex(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	fake.Insert("configs", map[string]interface{}{"config_key": "a"})
+	result, err := fake.Execute(ctx, "createIndex", map[string]interface{}{
+		"collection": "configs",
+		"index":      map[string]interface{}{"config_key": 1},
+		"options":    map[string]interface{}{"unique": true},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "config_key_1"}, result)
+
+	_, err = fake.Execute(ctx, "insert", map[string]interface{}{"collection": "configs", "document": map[string]interface{}{"config_key": "a"}})
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+	assert.True(t, connectors.IsDuplicateKey(err))
+
+	_, err = fake.Execute(ctx, "insert", map[string]interface{}{"collection": "configs", "document": map[string]interface{}{"config_key": "b"}})
+	require.NoError(t, err)
+	_, err = fake.Execute(ctx, "update", map[string]interface{}{
+		"collection": "configs",
+		"filter":     map[string]interface{}{"config_key": "b"},
+		"update":     map[string]interface{}{"$set": map[string]interface{}{"config_key": "a"}},
+	})
+	assert.True(t, connectors.IsDuplicateKey(err))
+
+	// Rewriting a document's own key is no duplicate
+	_, err = fake.Execute(ctx, "update", map[string]interface{}{
+		"collection": "configs",
+		"filter":     map[string]interface{}{"config_key": "b"},
+		"update":     map[string]interface{}{"$set": map[string]interface{}{"config_key": "b", "value": 1}},
+	})
+	assert.NoError(t, err)
+
+	indexes, err := fake.Execute(ctx, "listIndexes", map[string]interface{}{"collection": "configs"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "_id_", "keys": []string{"_id"}, "unique": false},
+		{"name": "config_key_1", "keys": []string{"config_key"}, "unique": true},
+	}, indexes)
+
+	// A unique index cannot be created over duplicates
+	fake.Insert("dupes", map[string]interface{}{"k": 1}, map[string]interface{}{"k": 1})
+	_, err = fake.Execute(ctx, "createIndex", map[string]interface{}{"collection": "dupes", "index": map[string]interface{}{"k": 1}, "options": map[string]interface{}{"unique": true}})
+	assert.True(t, connectors.IsDuplicateKey(err))
+}
+
+func TestFakeBulkWrite(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	_, err := fake.Execute(ctx, "createIndex", map[string]interface{}{"collection": "c", "index": map[string]interface{}{"k": 1}, "options": map[string]interface{}{"unique": true}})
+	require.NoError(t, err)
+
+	result, err := fake.Execute(ctx, "bulkWrite", map[string]interface{}{"collection": "c", "operations": []interface{}{
+		map[string]interface{}{"insertOne": map[string]interface{}{"document": map[string]interface{}{"k": "a"}}},
+		map[string]interface{}{"updateOne": map[string]interface{}{"filter": map[string]interface{}{"k": "b"}, "update": map[string]interface{}{"$set": map[string]interface{}{"v": 1}}, "upsert": true}},
+		map[string]interface{}{"updateOne": map[string]interface{}{"filter": map[string]interface{}{"k": "a"}, "update": map[string]interface{}{"$set": map[string]interface{}{"v": 2}}}},
+		map[string]interface{}{"deleteOne": map[string]interface{}{"filter": map[string]interface{}{"k": "missing"}}},
+	}})
+	require.NoError(t, err)
+	bulk := result.(*mongo.BulkWriteResult)
+	assert.EqualValues(t, 1, bulk.InsertedCount)
+	assert.EqualValues(t, 1, bulk.UpsertedCount)
+	assert.EqualValues(t, 1, bulk.MatchedCount)
+	assert.Contains(t, bulk.UpsertedIDs, int64(1))
+
+	// An ordered bulkWrite stops at the duplicate, an unordered one goes on
+	for ordered, stored := range map[bool]int{true: 2, false: 3} {
+		fake := NewFake()
+		_, err := fake.Execute(ctx, "createIndex", map[string]interface{}{"collection": "c", "index": map[string]interface{}{"k": 1}, "options": map[string]interface{}{"unique": true}})
+		require.NoError(t, err)
+		_, err = fake.Execute(ctx, "bulkWrite", map[string]interface{}{"collection": "c", "ordered": ordered, "operations": []interface{}{
+			map[string]interface{}{"insertOne": map[string]interface{}{"document": map[string]interface{}{"k": "a"}}},
+			map[string]interface{}{"insertOne": map[string]interface{}{"document": map[string]interface{}{"k": "b"}}},
+			map[string]interface{}{"insertOne": map[string]interface{}{"document": map[string]interface{}{"k": "a"}}},
+			map[string]interface{}{"insertOne": map[string]interface{}{"document": map[string]interface{}{"k": "c"}}},
+		}})
+		var exception mongo.BulkWriteException
+		require.ErrorAs(t, err, &exception)
+		require.Len(t, exception.WriteErrors, 1)
+		assert.Equal(t, 2, exception.WriteErrors[0].Index)
+		assert.True(t, connectors.IsDuplicateKey(err))
+		assert.Len(t, fake.Documents("c"), stored, "ordered %v", ordered)
+	}
+}
+
+func TestFakeTTLIndex(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake.SetNow(func() time.Time { return now })
+	fake.Insert("sessions",
+		map[string]interface{}{"id": 1, "expires_at": now.Add(-time.Second)},
+		map[string]interface{}{"id": 2, "expires_at": now.Add(time.Hour)},
+		map[string]interface{}{"id": 3},
+	)
+	_, err := fake.Execute(ctx, "createIndex", map[string]interface{}{
+		"collection": "sessions",
+		"index":      map[string]interface{}{"expires_at": 1},
+		"options":    map[string]interface{}{"expireAfterSeconds": 0},
+	})
+	require.NoError(t, err)
+
+	count, err := fake.Execute(ctx, "count", map[string]interface{}{"collection": "sessions"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	now = now.Add(2 * time.Hour)
+	count, err = fake.Execute(ctx, "count", map[string]interface{}{"collection": "sessions"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestFakeCollections(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	fake.Insert("b", map[string]interface{}{"x": 1})
+	_, err := fake.Execute(ctx, "insert", map[string]interface{}{"collection": "a", "document": map[string]interface{}{"x": 1}})
+	require.NoError(t, err)
+
+	collections, err := fake.Execute(ctx, "listCollections", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"name": "b", "type": "collection"}, {"name": "a", "type": "collection"}}, collections)
+	collections, err = fake.Execute(ctx, "listCollections", map[string]interface{}{"filter": map[string]interface{}{"name": "a"}})
+	require.NoError(t, err)
+	assert.Len(t, collections, 1)
+
+	// Generated ObjectIDs are the same on every run
+	assert.Equal(t, "000000000000000000000001", fake.Documents("b")[0]["_id"].(interface{ Hex() string }).Hex())
+
+	require.NoError(t, fake.Close(ctx))
+	assert.False(t, fake.IsConnected(ctx))
+	assert.Error(t, fake.Ping(ctx))
+	_, err = fake.Execute(ctx, "count", map[string]interface{}{"collection": "a"})
+	assert.Error(t, err)
+	require.NoError(t, fake.Connect(ctx))
+	assert.Len(t, fake.Documents("a"), 1)
+}
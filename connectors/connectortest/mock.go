@@ -0,0 +1,70 @@
+// Package connectortest provides connectors for testing code built on the connectors package without a
+// database: MockDBConnector, a testify mock answering as its expectations say, and Fake, a MongoDB connector
+// keeping its collections in memory.
+package connectortest
+
+import (
+	"context"
+	"database/sql"
+
+	"db-connectors/connectors"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockDBConnector is a connectors.DBConnector answering each call as the expectation set with On for it
+// says. Close and GetType and IsConnected are matched without arguments, the other methods with theirs;
+// Query gets its args as one []interface{}.
+type MockDBConnector struct {
+	mock.Mock
+}
+
+// Connect returns the error of the Connect expectation
+func (m *MockDBConnector) Connect(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+// Ping returns the error of the Ping expectation
+func (m *MockDBConnector) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+// Close returns the error of the Close expectation
+func (m *MockDBConnector) Close(ctx context.Context) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// GetType returns the database type of the GetType expectation
+func (m *MockDBConnector) GetType() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+// Query returns the rows, which may be nil, and error of the Query expectation matching query and args
+func (m *MockDBConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	mockArgs := m.Called(ctx, query, args)
+	rows, _ := mockArgs.Get(0).(*sql.Rows)
+	return rows, mockArgs.Error(1)
+}
+
+// Execute returns the result and error of the Execute expectation matching operation and params
+func (m *MockDBConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	args := m.Called(ctx, operation, params)
+	return args.Get(0), args.Error(1)
+}
+
+// IsConnected returns the IsConnected expectation
+func (m *MockDBConnector) IsConnected(ctx context.Context) bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+// GetServerInfo returns the server info, which may be nil, and error of the GetServerInfo expectation
+func (m *MockDBConnector) GetServerInfo(ctx context.Context) (*connectors.ServerInfo, error) {
+	args := m.Called(ctx)
+	info, _ := args.Get(0).(*connectors.ServerInfo)
+	return info, args.Error(1)
+}
@@ -0,0 +1,501 @@
+package connectortest
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matches reports whether doc matches a MongoDB query filter. With fold, strings compare regardless of case.
+func matches(doc, filter map[string]interface{}, fold bool) (bool, error) {
+	for key, condition := range filter {
+		var ok bool
+		var err error
+		switch key {
+		case "$or", "$and", "$nor":
+			ok, err = matchesClauses(doc, key, condition, fold)
+		case "$comment":
+			ok = true
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported query operator %s", key)
+			}
+			value, exists := lookup(doc, key)
+			ok, err = matchesField(value, exists, condition, fold)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchesClauses reports whether doc matches any ($or), all ($and) or none ($nor) of the filters of clauses
+func matchesClauses(doc map[string]interface{}, operator string, clauses interface{}, fold bool) (bool, error) {
+	list, ok := values(clauses)
+	if !ok || len(list) == 0 {
+		return false, fmt.Errorf("%s must be a nonempty array", operator)
+	}
+	matched := 0
+	for _, clause := range list {
+		filter, ok := clause.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s must hold documents", operator)
+		}
+		ok, err := matches(doc, filter, fold)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+	switch operator {
+	case "$or":
+		return matched > 0, nil
+	case "$and":
+		return matched == len(list), nil
+	default:
+		return matched == 0, nil
+	}
+}
+
+// matchesField reports whether a field, holding value when it exists, meets condition: a value it must
+// equal, a regular expression or a document of query operators
+func matchesField(value interface{}, exists bool, condition interface{}, fold bool) (bool, error) {
+	switch c := condition.(type) {
+	case primitive.Regex:
+		return matchesRegex(value, c.Pattern, c.Options)
+	case *regexp.Regexp:
+		return matchesRegex(value, c.String(), "")
+	}
+	ops, isOperator := operators(condition)
+	if !isOperator {
+		return equalOrContains(value, condition, fold), nil
+	}
+
+	for op, operand := range ops {
+		var ok bool
+		var err error
+		switch op {
+		case "$eq":
+			ok = equalOrContains(value, operand, fold)
+		case "$ne":
+			ok = !equalOrContains(value, operand, fold)
+		case "$in", "$nin":
+			list, isList := values(operand)
+			if !isList {
+				return false, fmt.Errorf("%s needs an array", op)
+			}
+			for _, candidate := range list {
+				if equalOrContains(value, candidate, fold) {
+					ok = true
+					break
+				}
+			}
+			ok = ok == (op == "$in")
+		case "$exists":
+			ok = exists == truthy(operand)
+		case "$gt", "$gte", "$lt", "$lte":
+			order, comparable := compare(value, operand)
+			ok = comparable && map[string]bool{"$gt": order > 0, "$gte": order >= 0, "$lt": order < 0, "$lte": order <= 0}[op]
+		case "$not":
+			ok, err = matchesField(value, exists, operand, fold)
+			ok = !ok
+		case "$regex":
+			pattern, _ := operand.(string)
+			options, _ := ops["$options"].(string)
+			ok, err = matchesRegex(value, pattern, options)
+		case "$options":
+			ok = true
+		case "$all":
+			list, isList := values(operand)
+			if !isList {
+				return false, fmt.Errorf("$all needs an array")
+			}
+			ok = true
+			for _, wanted := range list {
+				ok = ok && equalOrContains(value, wanted, fold)
+			}
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", op)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchesRegex reports whether value is a string matching pattern, or an array holding one, under the
+// MongoDB regular expression options i, m and s
+func matchesRegex(value interface{}, pattern, options string) (bool, error) {
+	flags := ""
+	for _, option := range options {
+		if strings.ContainsRune("ims", option) {
+			flags += string(option)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid $regex: %w", err)
+	}
+	if list, ok := values(value); ok {
+		for _, item := range list {
+			if s, ok := item.(string); ok && re.MatchString(s) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	s, ok := value.(string)
+	return ok && re.MatchString(s), nil
+}
+
+// operators returns condition as a document of query operators, when all its keys start with $
+func operators(condition interface{}) (map[string]interface{}, bool) {
+	ops, ok := condition.(map[string]interface{})
+	if !ok || len(ops) == 0 {
+		return nil, false
+	}
+	for key := range ops {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return ops, true
+}
+
+// equalOrContains reports whether value equals wanted or, being an array, holds an element equal to it. A
+// null wanted matches a missing field.
+func equalOrContains(value, wanted interface{}, fold bool) bool {
+	if equal(value, wanted, fold) {
+		return true
+	}
+	if list, ok := values(value); ok {
+		for _, item := range list {
+			if equal(item, wanted, fold) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equal reports whether two values are the same BSON value: numbers of any Go type compare by value, dates by
+// instant, and with fold strings regardless of case
+func equal(a, b interface{}, fold bool) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	if x, ok := dateOf(a); ok {
+		y, ok := dateOf(b)
+		return ok && x.Equal(y)
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		return ok && (x == y || (fold && strings.EqualFold(x, y)))
+	}
+	if x, ok := values(a); ok {
+		y, ok := values(b)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i], fold) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := a.(map[string]interface{}); ok {
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			if other, ok := y[key]; !ok || !equal(value, other, fold) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders two values of the same kind, numbers, strings or dates, reporting false for others
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		return cmp(x < y, x > y), true
+	}
+	if x, ok := dateOf(a); ok {
+		y, ok := dateOf(b)
+		if !ok {
+			return 0, false
+		}
+		return cmp(x.Before(y), x.After(y)), true
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
+
+// cmp returns -1 when less, 1 when greater and 0 otherwise
+func cmp(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// sortRank orders values of different types the way MongoDB sorts them
+func sortRank(value interface{}) int {
+	if value == nil {
+		return 0
+	}
+	if _, ok := number(value); ok {
+		return 1
+	}
+	if _, ok := dateOf(value); ok {
+		return 7
+	}
+	switch value.(type) {
+	case string:
+		return 2
+	case map[string]interface{}:
+		return 3
+	case primitive.ObjectID:
+		return 5
+	case bool:
+		return 6
+	}
+	if _, ok := values(value); ok {
+		return 4
+	}
+	return 8
+}
+
+// sortDocuments sorts docs in place by a sort of find: a bson.D, or a map whose fields apply in name order,
+// each 1 for ascending or -1 for descending
+func sortDocuments(docs []map[string]interface{}, spec interface{}) {
+	var keys bson.D
+	switch s := spec.(type) {
+	case bson.D:
+		keys = s
+	case map[string]interface{}:
+		for key, direction := range s {
+			keys = append(keys, bson.E{Key: key, Value: direction})
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	default:
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			x, _ := lookup(docs[i], key.Key)
+			y, _ := lookup(docs[j], key.Key)
+			order := cmp(sortRank(x) < sortRank(y), sortRank(x) > sortRank(y))
+			if order == 0 {
+				order, _ = compare(x, y)
+			}
+			if direction, _ := number(key.Value); direction < 0 {
+				order = -order
+			}
+			if order != 0 {
+				return order < 0
+			}
+		}
+		return false
+	})
+}
+
+// applyUpdate applies the update operators of update to doc at now. $setOnInsert applies only when inserting,
+// the document being one an upsert inserts.
+func applyUpdate(doc, update map[string]interface{}, inserting bool, now time.Time) error {
+	if len(update) == 0 {
+		return fmt.Errorf("update document must contain atomic operators")
+	}
+	for op, fields := range update {
+		assignments, ok := fields.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("update document must contain atomic operators, not %s", op)
+		}
+		for path, value := range assignments {
+			switch op {
+			case "$set":
+				setPath(doc, path, cloneValue(value))
+			case "$setOnInsert":
+				if inserting {
+					setPath(doc, path, cloneValue(value))
+				}
+			case "$unset":
+				unsetPath(doc, path)
+			case "$currentDate":
+				// Dates are stored to the millisecond
+				setPath(doc, path, now.UTC().Truncate(time.Millisecond))
+			case "$inc":
+				by, ok := number(value)
+				current, _ := lookup(doc, path)
+				base, isNumber := number(current)
+				if !ok || (current != nil && !isNumber) {
+					return fmt.Errorf("cannot $inc %s", path)
+				}
+				setPath(doc, path, base+by)
+			default:
+				return fmt.Errorf("unsupported update operator %s", op)
+			}
+		}
+	}
+	return nil
+}
+
+// lookup returns the value at a dotted path of doc, and whether it exists
+func lookup(doc map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, field := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath sets the value at a dotted path of doc, creating the documents on the way
+func setPath(doc map[string]interface{}, path string, value interface{}) {
+	fields := strings.Split(path, ".")
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := doc[field].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			doc[field] = next
+		}
+		doc = next
+	}
+	doc[fields[len(fields)-1]] = value
+}
+
+// unsetPath removes the value at a dotted path of doc
+func unsetPath(doc map[string]interface{}, path string) {
+	fields := strings.Split(path, ".")
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := doc[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		doc = next
+	}
+	delete(doc, fields[len(fields)-1])
+}
+
+// number returns a value of any Go numeric type as a float64
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64:
+		return float64(reflect.ValueOf(v).Int()), true
+	case uint, uint8, uint16, uint32, uint64:
+		return float64(reflect.ValueOf(v).Uint()), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// dateOf returns a time.Time or primitive.DateTime as a time.Time
+func dateOf(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case primitive.DateTime:
+		return v.Time(), true
+	}
+	return time.Time{}, false
+}
+
+// values returns the elements of a slice or array value other than a byte slice
+func values(value interface{}) ([]interface{}, bool) {
+	if list, ok := value.([]interface{}); ok {
+		return list, true
+	}
+	v := reflect.ValueOf(value)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	list := make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+	return list, true
+}
+
+// truthy reports whether an $exists operand asks for the field to exist
+func truthy(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	n, ok := number(value)
+	return ok && n != 0
+}
+
+// cloneDocument returns a copy of doc sharing none of its documents or arrays
+func cloneDocument(doc map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		copied[key] = cloneValue(value)
+	}
+	return copied
+}
+
+// cloneValue returns a copy of a document or array, or value itself for others
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return cloneDocument(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = cloneValue(item)
+		}
+		return copied
+	case []string:
+		return append([]string(nil), v...)
+	}
+	return value
+}
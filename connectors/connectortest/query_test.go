@@ -0,0 +1,107 @@
+package connectortest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMatches(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	doc := map[string]interface{}{
+		"key":     "Feature.Flag",
+		"status":  "pending",
+		"count":   int32(3),
+		"tags":    []interface{}{"a", "b"},
+		"owner":   map[string]interface{}{"team": "search"},
+		"expires": now,
+	}
+
+	tests := []struct {
+		name   string
+		filter map[string]interface{}
+		fold   bool
+		want   bool
+	}{
+		{"empty", map[string]interface{}{}, false, true},
+		{"equal", map[string]interface{}{"status": "pending"}, false, true},
+		{"numbers of any type", map[string]interface{}{"count": 3.0}, false, true},
+		{"case", map[string]interface{}{"key": "feature.flag"}, false, false},
+		{"folded case", map[string]interface{}{"key": "feature.flag"}, true, true},
+		{"dotted path", map[string]interface{}{"owner.team": "search"}, false, true},
+		{"array element", map[string]interface{}{"tags": "b"}, false, true},
+		{"missing equals nil", map[string]interface{}{"deleted": nil}, false, true},
+		{"$ne", map[string]interface{}{"status": map[string]interface{}{"$ne": "approved"}}, false, true},
+		{"$in", map[string]interface{}{"status": map[string]interface{}{"$in": []string{"approved", "pending"}}}, false, true},
+		{"$nin", map[string]interface{}{"status": map[string]interface{}{"$nin": []string{"pending"}}}, false, false},
+		{"$exists", map[string]interface{}{"deleted": map[string]interface{}{"$exists": false}}, false, true},
+		{"range", map[string]interface{}{"count": map[string]interface{}{"$gt": 1, "$lte": int64(3)}}, false, true},
+		{"dates", map[string]interface{}{"expires": map[string]interface{}{"$lt": now.Add(time.Second)}}, false, true},
+		{"primitive dates", map[string]interface{}{"expires": map[string]interface{}{"$gte": primitive.NewDateTimeFromTime(now)}}, false, true},
+		{"$not of a missing field", map[string]interface{}{"deleted": map[string]interface{}{"$not": map[string]interface{}{"$lte": now}}}, false, true},
+		{"$regex", map[string]interface{}{"key": map[string]interface{}{"$regex": "^feature", "$options": "i"}}, false, true},
+		{"primitive.Regex", map[string]interface{}{"key": primitive.Regex{Pattern: "flag$"}}, false, false},
+		{"$all", map[string]interface{}{"tags": map[string]interface{}{"$all": []interface{}{"a", "b"}}}, false, true},
+		{"$or", map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"status": "approved"},
+			map[string]interface{}{"count": 3},
+		}}, false, true},
+		{"$nor", map[string]interface{}{"$nor": []interface{}{map[string]interface{}{"count": 3}}}, false, false},
+		{"embedded document", map[string]interface{}{"owner": map[string]interface{}{"team": "search"}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := matches(doc, tt.filter, tt.fold)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+
+	_, err := matches(doc, map[string]interface{}{"count": map[string]interface{}{"$mod": []int{2, 1}}}, false)
+	assert.EqualError(t, err, "unsupported query operator $mod")
+}
+
+func TestApplyUpdate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	doc := map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2}, "n": int32(4)}
+	update := map[string]interface{}{
+		"$set":         map[string]interface{}{"b.d": "x"},
+		"$setOnInsert": map[string]interface{}{"created": true},
+		"$unset":       map[string]interface{}{"a": ""},
+		"$currentDate": map[string]interface{}{"updated": true},
+		"$inc":         map[string]interface{}{"n": 1, "m": 2},
+	}
+	require.NoError(t, applyUpdate(doc, update, false, now))
+	assert.Equal(t, map[string]interface{}{
+		"b":       map[string]interface{}{"c": 2, "d": "x"},
+		"n":       5.0,
+		"m":       2.0,
+		"updated": now.Truncate(time.Millisecond),
+	}, doc)
+
+	require.NoError(t, applyUpdate(doc, update, true, now))
+	assert.Equal(t, true, doc["created"])
+
+	assert.Error(t, applyUpdate(doc, map[string]interface{}{"a": 1}, false, now))
+	assert.EqualError(t, applyUpdate(doc, map[string]interface{}{"$rename": map[string]interface{}{"a": "z"}}, false, now), "unsupported update operator $rename")
+}
+
+func TestSortDocuments(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"name": "b", "rank": 2},
+		{"name": "a", "rank": 2},
+		{"name": "c", "rank": 1},
+		{"name": "d"},
+	}
+	sortDocuments(docs, bson.D{{Key: "rank", Value: -1}, {Key: "name", Value: 1}})
+	var names []string
+	for _, doc := range docs {
+		names = append(names, doc["name"].(string))
+	}
+	// A missing field sorts before every value
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names)
+}
@@ -0,0 +1,239 @@
+package connectors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Dialect spells the parts of a SQL statement that differ between the SQL databases, so that a statement
+// can be built once for all of them
+type Dialect interface {
+	// Placeholder returns the nth bind parameter of a statement, counting from 1
+	Placeholder(n int) string
+
+	// QuoteIdent quotes a table or column name
+	QuoteIdent(name string) string
+
+	// UpsertClause returns the clause that turns an INSERT into an upsert, applying the assignments to the
+	// row whose conflict columns already hold the inserted values
+	UpsertClause(conflict []string, assignments ...string) string
+
+	// Excluded returns the value an upsert tried to insert into column, for use in its assignments
+	Excluded(column string) string
+
+	// LimitOffset returns the clause paging a SELECT, or "" when limit is not positive
+	LimitOffset(limit, offset int) string
+
+	// NowFunc returns the expression of the current timestamp
+	NowFunc() string
+
+	// UTCNowFunc returns the expression of the current UTC timestamp without a time zone, to compare with
+	// the UTC times a statement binds
+	UTCNowFunc() string
+
+	// Explain returns the statement reporting the plan of statement as JSON; analyze runs the statement to
+	// report actual row counts and timings
+	Explain(statement string, analyze bool) (string, error)
+}
+
+// MySQLDialect is the Dialect of MySQL
+type MySQLDialect struct{}
+
+// Placeholder returns ?, as MySQL binds parameters by position
+func (MySQLDialect) Placeholder(int) string { return "?" }
+
+// QuoteIdent quotes name in backticks
+func (MySQLDialect) QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// UpsertClause returns an ON DUPLICATE KEY UPDATE clause, which applies to any unique key so the conflict
+// columns are not named
+func (MySQLDialect) UpsertClause(conflict []string, assignments ...string) string {
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+}
+
+// Excluded returns VALUES(column)
+func (MySQLDialect) Excluded(column string) string { return "VALUES(" + column + ")" }
+
+// LimitOffset returns a LIMIT clause, with OFFSET when offset is positive
+func (MySQLDialect) LimitOffset(limit, offset int) string { return limitOffset(limit, offset) }
+
+// NowFunc returns NOW()
+func (MySQLDialect) NowFunc() string { return "NOW()" }
+
+// UTCNowFunc returns UTC_TIMESTAMP()
+func (MySQLDialect) UTCNowFunc() string { return "UTC_TIMESTAMP()" }
+
+// Explain returns EXPLAIN FORMAT=JSON. MySQL reports EXPLAIN ANALYZE only as a tree, so analyze is refused.
+func (MySQLDialect) Explain(statement string, analyze bool) (string, error) {
+	if analyze {
+		return "", errors.New("MySQL cannot report EXPLAIN ANALYZE as JSON")
+	}
+	if multipleStatements(statement, true) {
+		return "", errMultipleStatements
+	}
+	return "EXPLAIN FORMAT=JSON " + statement, nil
+}
+
+// PostgreSQLDialect is the Dialect of PostgreSQL
+type PostgreSQLDialect struct{}
+
+// Placeholder returns $n
+func (PostgreSQLDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+// QuoteIdent quotes name in double quotes
+func (PostgreSQLDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// UpsertClause returns an ON CONFLICT DO UPDATE clause
+func (PostgreSQLDialect) UpsertClause(conflict []string, assignments ...string) string {
+	return "ON CONFLICT (" + strings.Join(conflict, ", ") + ") DO UPDATE SET " + strings.Join(assignments, ", ")
+}
+
+// Excluded returns EXCLUDED.column
+func (PostgreSQLDialect) Excluded(column string) string { return "EXCLUDED." + column }
+
+// LimitOffset returns a LIMIT clause, with OFFSET when offset is positive
+func (PostgreSQLDialect) LimitOffset(limit, offset int) string { return limitOffset(limit, offset) }
+
+// NowFunc returns CURRENT_TIMESTAMP
+func (PostgreSQLDialect) NowFunc() string { return "CURRENT_TIMESTAMP" }
+
+// UTCNowFunc returns CURRENT_TIMESTAMP at the UTC time zone, a timestamp without time zone
+func (PostgreSQLDialect) UTCNowFunc() string { return "(CURRENT_TIMESTAMP AT TIME ZONE 'UTC')" }
+
+// Explain returns EXPLAIN (FORMAT JSON), with ANALYZE when analyze is set
+func (PostgreSQLDialect) Explain(statement string, analyze bool) (string, error) {
+	// Without bind parameters lib/pq sends the statement with the simple protocol, which runs every
+	// statement in it after the explained one
+	if multipleStatements(statement, false) {
+		return "", errMultipleStatements
+	}
+	if analyze {
+		return "EXPLAIN (ANALYZE, FORMAT JSON) " + statement, nil
+	}
+	return "EXPLAIN (FORMAT JSON) " + statement, nil
+}
+
+// errMultipleStatements refuses to explain more than one statement, as only the first would be explained
+// and the others would run
+var errMultipleStatements = errors.New("explain accepts a single statement")
+
+// multipleStatements reports whether statement holds a semicolon followed by another statement, outside
+// string literals, quoted identifiers and comments. The bodies of MySQL /*! */ and /*+ */ comments are
+// statement text, since MySQL runs them, and PostgreSQL block comments nest.
+func multipleStatements(statement string, mysql bool) bool {
+	runes := []rune(statement)
+	at := func(i int, r rune) bool { return i < len(runes) && runes[i] == r }
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ';':
+			return strings.TrimSpace(string(runes[i+1:])) != ""
+		case (mysql && r == '#') || (r == '-' && at(i+1, '-') && (!mysql || i+2 == len(runes) || unicode.IsSpace(runes[i+2]))):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && at(i+1, '*'):
+			if mysql && (at(i+2, '!') || at(i+2, '+') || (at(i+2, 'M') && at(i+3, '!'))) {
+				i += 2
+				continue
+			}
+			depth := 1
+			for i += 2; i < len(runes) && depth > 0; {
+				switch {
+				case runes[i] == '*' && at(i+1, '/'):
+					depth--
+					i += 2
+				case !mysql && runes[i] == '/' && at(i+1, '*'):
+					depth++
+					i += 2
+				default:
+					i++
+				}
+			}
+			i--
+		case r == '\'' || r == '"' || (mysql && r == '`'):
+			// Backslashes escape in MySQL strings and PostgreSQL E'' strings; doubled quotes escape themselves,
+			// which the loop reads as a string closed and another opened
+			backslashes := (mysql && r != '`') || (r == '\'' && i > 0 && (runes[i-1] == 'E' || runes[i-1] == 'e') && !(i > 1 && isIdentRune(runes[i-2])))
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if backslashes && runes[i] == '\\' {
+					i++
+				}
+			}
+		case r == '$' && !mysql && !(i > 0 && isIdentRune(runes[i-1])):
+			// A dollar-quoted string such as $$...$$ or $tag$...$tag$; $1 is a bind parameter, and a $ inside
+			// an identifier is part of it
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || runes[end] == '_' || (end > i+1 && unicode.IsDigit(runes[end]))) {
+				end++
+			}
+			if !at(end, '$') {
+				continue
+			}
+			tag := string(runes[i : end+1])
+			if closing := strings.Index(string(runes[end+1:]), tag); closing >= 0 {
+				i = end + len([]rune(string(runes[end+1:])[:closing])) + len([]rune(tag))
+			} else {
+				i = len(runes)
+			}
+		}
+	}
+	return false
+}
+
+// isIdentRune reports whether r may continue an unquoted identifier
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// limitOffset returns the LIMIT and OFFSET clause shared by MySQL and PostgreSQL
+func limitOffset(limit, offset int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if offset > 0 {
+		return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+	}
+	return fmt.Sprintf("LIMIT %d", limit)
+}
+
+// DialectFor returns the Dialect of a database type, reporting false for types that do not speak SQL
+func DialectFor(dbType string) (Dialect, bool) {
+	switch dbType {
+	case "mysql":
+		return MySQLDialect{}, true
+	case "postgresql":
+		return PostgreSQLDialect{}, true
+	}
+	return nil, false
+}
+
+// Bind rewrites the ? bind parameters of query as the placeholders of the dialect, numbering them in
+// order. Question marks inside quoted strings and identifiers are left alone.
+func Bind(d Dialect, query string) string {
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString(d.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
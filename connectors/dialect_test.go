@@ -0,0 +1,98 @@
+package connectors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialects(t *testing.T) {
+	mysql, postgres := MySQLDialect{}, PostgreSQLDialect{}
+
+	assert.Equal(t, "?", mysql.Placeholder(3))
+	assert.Equal(t, "$3", postgres.Placeholder(3))
+
+	assert.Equal(t, "`maker_id`", mysql.QuoteIdent("maker_id"))
+	assert.Equal(t, "`a``b`", mysql.QuoteIdent("a`b"))
+	assert.Equal(t, `"maker_id"`, postgres.QuoteIdent("maker_id"))
+	assert.Equal(t, `"a""b"`, postgres.QuoteIdent(`a"b`))
+
+	assert.Equal(t, "ON DUPLICATE KEY UPDATE config_value = VALUES(config_value), updated_at = NOW()",
+		mysql.UpsertClause([]string{"config_key"}, "config_value = "+mysql.Excluded("config_value"), "updated_at = "+mysql.NowFunc()))
+	assert.Equal(t, "ON CONFLICT (config_key) DO UPDATE SET config_value = EXCLUDED.config_value, updated_at = CURRENT_TIMESTAMP",
+		postgres.UpsertClause([]string{"config_key"}, "config_value = "+postgres.Excluded("config_value"), "updated_at = "+postgres.NowFunc()))
+
+	explain, err := mysql.Explain("SELECT 1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "EXPLAIN FORMAT=JSON SELECT 1", explain)
+	_, err = mysql.Explain("SELECT 1", true)
+	assert.EqualError(t, err, "MySQL cannot report EXPLAIN ANALYZE as JSON")
+	explain, _ = postgres.Explain("SELECT 1", false)
+	assert.Equal(t, "EXPLAIN (FORMAT JSON) SELECT 1", explain)
+	explain, _ = postgres.Explain("SELECT 1", true)
+	assert.Equal(t, "EXPLAIN (ANALYZE, FORMAT JSON) SELECT 1", explain)
+
+	for _, d := range []Dialect{mysql, postgres} {
+		assert.Equal(t, "", d.LimitOffset(0, 20))
+		assert.Equal(t, "LIMIT 10", d.LimitOffset(10, 0))
+		assert.Equal(t, "LIMIT 10 OFFSET 20", d.LimitOffset(10, 20))
+	}
+}
+
+func TestExplainRefusesSeveralStatements(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		dialect   Dialect
+		statement string
+		several   bool
+	}{
+		{"one", PostgreSQLDialect{}, "SELECT 1", false},
+		{"trailing semicolon", PostgreSQLDialect{}, "SELECT 1; \n", false},
+		{"two", PostgreSQLDialect{}, "SELECT 1; DELETE FROM users", true},
+		{"semicolon in string", PostgreSQLDialect{}, "SELECT 'a;b', \"c;d\" FROM t", false},
+		{"doubled quote", PostgreSQLDialect{}, "SELECT 'it''s;' FROM t", false},
+		{"backslash ends standard string", PostgreSQLDialect{}, `SELECT name'a\'; DELETE FROM users; --'`, true},
+		{"escape string", PostgreSQLDialect{}, `SELECT E'a\'; DELETE FROM users'`, false},
+		{"line comment", PostgreSQLDialect{}, "SELECT 1 -- ; DELETE\n", false},
+		{"quote in line comment", PostgreSQLDialect{}, "SELECT 1 -- it's\n; DELETE FROM users", true},
+		{"nested comment", PostgreSQLDialect{}, "SELECT 1 /* /* */ ' */; DELETE FROM users; -- '", true},
+		{"dollar quote", PostgreSQLDialect{}, "SELECT $tag$;$tag$, $1", false},
+		{"dollar in identifier", PostgreSQLDialect{}, "SELECT x$y$ FROM t; DELETE FROM users; -- $y$", true},
+		{"mysql backslash escape", MySQLDialect{}, `SELECT 'a\';' FROM t`, false},
+		{"mysql hash comment", MySQLDialect{}, "SELECT 1 # ;\n", false},
+		{"mysql double dash without space", MySQLDialect{}, "SELECT 1 --1; DELETE FROM users", true},
+		{"mysql executable comment", MySQLDialect{}, "SELECT 1 /*!; DELETE FROM users */", true},
+		{"mysql comments do not nest", MySQLDialect{}, "SELECT 1 /* /* */ ' */; DELETE FROM users; -- '", false},
+		{"mysql backtick", MySQLDialect{}, "SELECT `a;b` FROM t", false},
+	} {
+		_, err := tt.dialect.Explain(tt.statement, false)
+		if tt.several {
+			assert.EqualError(t, err, "explain accepts a single statement", tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	d, ok := DialectFor("mysql")
+	assert.True(t, ok)
+	assert.Equal(t, MySQLDialect{}, d)
+
+	d, ok = DialectFor("postgresql")
+	assert.True(t, ok)
+	assert.Equal(t, PostgreSQLDialect{}, d)
+
+	_, ok = DialectFor("mongodb")
+	assert.False(t, ok)
+
+	assert.Equal(t, MySQLDialect{}, NewMySQLConnector(&ConnectionConfig{}).Dialect())
+	assert.Equal(t, PostgreSQLDialect{}, NewPostgreSQLConnector(&ConnectionConfig{}).Dialect())
+}
+
+func TestBind(t *testing.T) {
+	query := "UPDATE t SET a = ?, b = '?', `c?` = ? WHERE d = ?"
+	assert.Equal(t, query, Bind(MySQLDialect{}, query))
+	assert.Equal(t, "UPDATE t SET a = $1, b = '?', `c?` = $2 WHERE d = $3", Bind(PostgreSQLDialect{}, query))
+	assert.Equal(t, `SELECT 'it''s?' FROM "x?" WHERE a = $1`, Bind(PostgreSQLDialect{}, `SELECT 'it''s?' FROM "x?" WHERE a = ?`))
+}
@@ -0,0 +1,116 @@
+package connectors
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlConfig returns the MySQL driver configuration of a connection. The driver formats it into a DSN its
+// parser reads back whatever the credentials hold, such as a password containing "@" or "/".
+func (c *ConnectionConfig) mysqlConfig() *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = c.Username
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = fmt.Sprintf("%s:%d", c.Host, c.Port)
+	cfg.DBName = c.Database
+	return cfg
+}
+
+// mysqlCharsetPattern matches the charset DSN parameter, a comma-separated list of character set names the
+// driver tries with SET NAMES
+var mysqlCharsetPattern = regexp.MustCompile(`^[A-Za-z0-9_]+(,[A-Za-z0-9_]+)*$`)
+
+// mysqlURIConfig parses the MySQL DSN of the URI. A client may choose the URI, so it refuses the options that
+// widen what the connection can do: multiStatements, which multi_statements and the server's
+// allow_multi_statements control; allowAllFiles, which lets the server read any file of this host with LOAD
+// DATA LOCAL INFILE; and session variables, other than charset.
+func (c *ConnectionConfig) mysqlURIConfig() (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(c.URI)
+	if err != nil {
+		return nil, fmt.Errorf("uri is not a valid MySQL DSN: %w", err)
+	}
+	var problems []string
+	if cfg.MultiStatements {
+		problems = append(problems, "uri must not set multiStatements; set multi_statements instead")
+	}
+	if cfg.AllowAllFiles {
+		problems = append(problems, "uri must not set allowAllFiles")
+	}
+	params := make([]string, 0, len(cfg.Params))
+	for param := range cfg.Params {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		if param == "charset" && mysqlCharsetPattern.MatchString(cfg.Params[param]) {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("uri must not set the session variable %s", param))
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// postgresPairs returns the key=value pairs of a PostgreSQL connection string, keys and values alternating
+func (c *ConnectionConfig) postgresPairs() []string {
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	return []string{
+		"host", c.Host,
+		"port", strconv.Itoa(c.Port),
+		"user", c.Username,
+		"password", c.Password,
+		"dbname", c.Database,
+		"sslmode", sslMode,
+	}
+}
+
+// keyValueEscaper escapes the characters that end a quoted value of a PostgreSQL connection string
+var keyValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// keyValueDSN joins alternating keys and values into a PostgreSQL connection string. Values that are empty
+// or hold whitespace, quotes or backslashes are single-quoted, with quotes and backslashes escaped.
+func keyValueDSN(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(pairs[i])
+		b.WriteByte('=')
+		value := pairs[i+1]
+		if value != "" && !strings.ContainsAny(value, " \t\n\r\f\v'\\") {
+			b.WriteString(value)
+			continue
+		}
+		b.WriteByte('\'')
+		b.WriteString(keyValueEscaper.Replace(value))
+		b.WriteByte('\'')
+	}
+	return b.String()
+}
+
+// mongoURI returns the mongodb:// URI of a connection with its credentials percent-encoded, so a password
+// containing ":" or "@" does not end the user information early. A username without a password is kept
+// for setups that authenticate without one.
+func (c *ConnectionConfig) mongoURI() string {
+	u := url.URL{Scheme: "mongodb", Host: fmt.Sprintf("%s:%d", c.Host, c.Port), Path: "/" + c.Database}
+	switch {
+	case c.Username != "" && c.Password != "":
+		u.User = url.UserPassword(c.Username, c.Password)
+	case c.Username != "":
+		u.User = url.User(c.Username)
+	}
+	return u.String()
+}
@@ -0,0 +1,137 @@
+package connectors
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"db-connectors/logging"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// awkwardPasswords are passwords that end or split an unescaped DSN or URI early
+var awkwardPasswords = []string{
+	"p@ssword",
+	"pass:word",
+	"pass/word",
+	"pass word",
+	"it's",
+	`say "hi"`,
+	`back\slash`,
+	"pässwörd✓",
+	`@:/ '"\?#%`,
+}
+
+// parseKeyValueDSN reads a PostgreSQL key=value connection string the way libpq does: values may be
+// single-quoted, and a backslash escapes the next character
+func parseKeyValueDSN(t *testing.T, dsn string) map[string]string {
+	pairs := map[string]string{}
+	for dsn = strings.TrimLeft(dsn, " "); dsn != ""; dsn = strings.TrimLeft(dsn, " ") {
+		key, rest, ok := strings.Cut(dsn, "=")
+		require.True(t, ok, "missing = in %q", dsn)
+
+		var value strings.Builder
+		quoted := strings.HasPrefix(rest, "'")
+		if quoted {
+			rest = rest[1:]
+		}
+		i := 0
+		for ; i < len(rest); i++ {
+			c := rest[i]
+			if c == '\\' && i+1 < len(rest) {
+				i++
+				value.WriteByte(rest[i])
+				continue
+			}
+			if (quoted && c == '\'') || (!quoted && c == ' ') {
+				break
+			}
+			value.WriteByte(c)
+		}
+		if quoted {
+			require.Less(t, i, len(rest), "unterminated quote in %q", dsn)
+			i++
+		}
+		pairs[key] = value.String()
+		dsn = rest[i:]
+	}
+	return pairs
+}
+
+func TestMySQLDSNEscaping(t *testing.T) {
+	for _, password := range awkwardPasswords {
+		config := &ConnectionConfig{Host: "db", Port: 3306, Username: "app", Password: password, Database: "orders"}
+		for _, dsn := range []string{mustConnectionString(t, config, "mysql"), NewMySQLConnector(config).dsn()} {
+			parsed, err := mysql.ParseDSN(dsn)
+			require.NoError(t, err, dsn)
+			assert.Equal(t, "app", parsed.User)
+			assert.Equal(t, password, parsed.Passwd)
+			assert.Equal(t, "db:3306", parsed.Addr)
+			assert.Equal(t, "orders", parsed.DBName)
+		}
+	}
+
+	// The connector's session settings survive the escaping
+	parsed, err := mysql.ParseDSN(NewMySQLConnector(&ConnectionConfig{Host: "db", Port: 3306, Password: "p@ss/word", Database: "orders"}).dsn())
+	require.NoError(t, err)
+	assert.True(t, parsed.ParseTime)
+	assert.Equal(t, time.UTC, parsed.Loc)
+	assert.Equal(t, "'+00:00'", parsed.Params["time_zone"])
+	assert.Equal(t, DefaultConnectTimeout, parsed.Timeout)
+}
+
+func TestPostgreSQLDSNEscaping(t *testing.T) {
+	for _, password := range awkwardPasswords {
+		config := &ConnectionConfig{Host: "db", Port: 5432, Username: "app user", Password: password, Database: "orders", Schema: "billing"}
+		for _, dsn := range []string{mustConnectionString(t, config, "postgresql"), NewPostgreSQLConnector(config).dsn()} {
+			pairs := parseKeyValueDSN(t, dsn)
+			assert.Equal(t, "app user", pairs["user"], dsn)
+			assert.Equal(t, password, pairs["password"], dsn)
+			assert.Equal(t, "orders", pairs["dbname"], dsn)
+			assert.Equal(t, "disable", pairs["sslmode"], dsn)
+		}
+		assert.Equal(t, "billing", parseKeyValueDSN(t, NewPostgreSQLConnector(config).dsn())["search_path"])
+	}
+
+	assert.Equal(t, `host=db port=5432 user=app password='it\'s a \\ test' dbname=orders sslmode=disable`,
+		mustConnectionString(t, &ConnectionConfig{Host: "db", Port: 5432, Username: "app", Password: `it's a \ test`, Database: "orders"}, "postgresql"))
+}
+
+func TestMongoURIEscaping(t *testing.T) {
+	for _, password := range awkwardPasswords {
+		config := &ConnectionConfig{Host: "db", Port: 27017, Username: "app@corp", Password: password, Database: "orders"}
+		for _, uri := range []string{mustConnectionString(t, config, "mongodb"), NewMongoDBConnector(config).uri()} {
+			parsed, err := connstring.ParseAndValidate(uri)
+			require.NoError(t, err, uri)
+			assert.Equal(t, "app@corp", parsed.Username)
+			assert.Equal(t, password, parsed.Password)
+			assert.Equal(t, []string{"db:27017"}, parsed.Hosts)
+			assert.Equal(t, "orders", parsed.Database)
+		}
+	}
+
+	assert.Equal(t, "mongodb://app%40corp:pass%3Aw%2Frd%40@db:27017/orders",
+		mustConnectionString(t, &ConnectionConfig{Host: "db", Port: 27017, Username: "app@corp", Password: "pass:w/rd@", Database: "orders"}, "mongodb"))
+	assert.Equal(t, "mongodb://reader@db:27017/orders",
+		mustConnectionString(t, &ConnectionConfig{Host: "db", Port: 27017, Username: "reader", Database: "orders"}, "mongodb"))
+}
+
+func TestEscapedDSNsRedacted(t *testing.T) {
+	config := &ConnectionConfig{Host: "db", Port: 5432, Username: "app", Password: `s3cr@t:/ 'quoted' \ü`, Database: "orders"}
+	for _, dbType := range []string{"mysql", "postgresql", "mongodb"} {
+		redacted := logging.RedactDSN(mustConnectionString(t, config, dbType))
+		assert.Contains(t, redacted, logging.Redacted, dbType)
+		assert.NotContains(t, redacted, "s3cr", dbType)
+		assert.NotContains(t, redacted, "quoted", dbType)
+	}
+}
+
+func mustConnectionString(t *testing.T, config *ConnectionConfig, dbType string) string {
+	dsn, err := config.GetConnectionString(dbType)
+	require.NoError(t, err)
+	return dsn
+}
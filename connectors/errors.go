@@ -0,0 +1,165 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// ErrUnsupportedOperation is returned by Execute for operations the connector does not implement
+var ErrUnsupportedOperation = errors.New("unsupported operation")
+
+// ErrNotFound is returned by lookups of a single document or row, such as the MongoDB findOne operation,
+// that match nothing
+var ErrNotFound = errors.New("no matching document or row")
+
+// ErrorClass categorizes connection failures so callers can tell which setting is wrong
+type ErrorClass string
+
+const (
+	ErrorClassDNS             ErrorClass = "dns_failure"
+	ErrorClassHostUnreachable ErrorClass = "host_unreachable"
+	ErrorClassAuth            ErrorClass = "auth_failure"
+	ErrorClassDatabaseMissing ErrorClass = "database_missing"
+	ErrorClassTimeout         ErrorClass = "timeout"
+	ErrorClassUnknown         ErrorClass = "unknown"
+)
+
+// MySQL server error numbers used for classification
+const (
+	mysqlErrDBAccessDenied  = 1044
+	mysqlErrAccessDenied    = 1045
+	mysqlErrUnknownDatabase = 1049
+	mysqlErrDuplicateEntry  = 1062
+)
+
+// PostgreSQL SQLSTATE codes used for classification
+const (
+	pqErrInvalidAuthorization = "28000"
+	pqErrInvalidPassword      = "28P01"
+	pqErrInvalidCatalogName   = "3D000"
+	pqErrUniqueViolation      = "23505"
+)
+
+// mongoErrAuthenticationFailed is the MongoDB server error code for failed authentication
+const mongoErrAuthenticationFailed = 18
+
+// ClassifyError inspects a (possibly wrapped) driver error and reports what kind of failure it is
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrAccessDenied, mysqlErrDBAccessDenied:
+			return ErrorClassAuth
+		case mysqlErrUnknownDatabase:
+			return ErrorClassDatabaseMissing
+		}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch string(pqErr.Code) {
+		case pqErrInvalidPassword, pqErrInvalidAuthorization:
+			return ErrorClassAuth
+		case pqErrInvalidCatalogName:
+			return ErrorClassDatabaseMissing
+		}
+	}
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == mongoErrAuthenticationFailed {
+		return ErrorClassAuth
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ErrorClassTimeout
+		}
+		return ErrorClassDNS
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return ErrorClassHostUnreachable
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ErrorClassHostUnreachable
+	}
+
+	// The MongoDB driver flattens handshake and server selection failures into strings
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "AuthenticationFailed"), strings.Contains(msg, "auth error"):
+		return ErrorClassAuth
+	case strings.Contains(msg, "no such host"):
+		return ErrorClassDNS
+	case strings.Contains(msg, "connection refused"):
+		return ErrorClassHostUnreachable
+	case strings.Contains(msg, "server selection error"), strings.Contains(msg, "i/o timeout"):
+		return ErrorClassTimeout
+	}
+
+	return ErrorClassUnknown
+}
+
+// Description explains the failure in terms of which connection setting to check
+func (c ErrorClass) Description() string {
+	switch c {
+	case ErrorClassDNS:
+		return "host name could not be resolved - check the host"
+	case ErrorClassHostUnreachable:
+		return "host refused or is unreachable - check the host and port"
+	case ErrorClassAuth:
+		return "authentication failed - check the username and password"
+	case ErrorClassDatabaseMissing:
+		return "database does not exist - check the database name"
+	case ErrorClassTimeout:
+		return "timed out reaching the server - check the host, port and network access"
+	default:
+		return "unexpected error"
+	}
+}
+
+// IsDuplicateKey reports whether a (possibly wrapped) driver error is a unique key violation:
+// MySQL error 1062, PostgreSQL SQLSTATE 23505 or MongoDB error 11000
+func IsDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDuplicateEntry
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code) == pqErrUniqueViolation
+	}
+	return err != nil && mongo.IsDuplicateKeyError(err)
+}
+
+// isTopologyError reports whether a MongoDB operation failed because its client has no server to send it
+// to: no server could be selected, or the client was disconnected. Such operations were never sent.
+func isTopologyError(err error) bool {
+	var selection topology.ServerSelectionError
+	return errors.As(err, &selection) ||
+		errors.Is(err, topology.ErrServerSelectionTimeout) ||
+		errors.Is(err, topology.ErrTopologyClosed) ||
+		errors.Is(err, mongo.ErrClientDisconnected)
+}
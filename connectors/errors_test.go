@@ -0,0 +1,153 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{
+			name: "nil error",
+			err:  nil,
+			want: "",
+		},
+		{
+			name: "mysql access denied",
+			err:  fmt.Errorf("failed to ping MySQL: %w", &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'root'@'localhost'"}),
+			want: ErrorClassAuth,
+		},
+		{
+			name: "mysql database access denied",
+			err:  &mysql.MySQLError{Number: 1044, Message: "Access denied for user 'app'@'%' to database 'secret'"},
+			want: ErrorClassAuth,
+		},
+		{
+			name: "mysql unknown database",
+			err:  fmt.Errorf("failed to ping MySQL: %w", &mysql.MySQLError{Number: 1049, Message: "Unknown database 'missing'"}),
+			want: ErrorClassDatabaseMissing,
+		},
+		{
+			name: "postgres invalid password",
+			err:  fmt.Errorf("failed to ping PostgreSQL: %w", &pq.Error{Code: "28P01", Message: "password authentication failed for user \"app\""}),
+			want: ErrorClassAuth,
+		},
+		{
+			name: "postgres missing role",
+			err:  &pq.Error{Code: "28000", Message: "role \"ghost\" does not exist"},
+			want: ErrorClassAuth,
+		},
+		{
+			name: "postgres missing database",
+			err:  fmt.Errorf("failed to ping PostgreSQL: %w", &pq.Error{Code: "3D000", Message: "database \"missing\" does not exist"}),
+			want: ErrorClassDatabaseMissing,
+		},
+		{
+			name: "mongodb authentication failed command error",
+			err:  fmt.Errorf("failed to ping MongoDB: %w", mongo.CommandError{Code: 18, Name: "AuthenticationFailed", Message: "Authentication failed."}),
+			want: ErrorClassAuth,
+		},
+		{
+			name: "mongodb flattened auth error",
+			err:  errors.New("connection() error occurred during connection handshake: auth error: sasl conversation error: unable to authenticate using mechanism \"SCRAM-SHA-256\": (AuthenticationFailed) Authentication failed."),
+			want: ErrorClassAuth,
+		},
+		{
+			name: "dns lookup failure",
+			err:  fmt.Errorf("failed to ping MySQL: %w", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "db.invalid", IsNotFound: true}}),
+			want: ErrorClassDNS,
+		},
+		{
+			name: "dns lookup timeout",
+			err:  &net.DNSError{Err: "i/o timeout", Name: "db.example.com", IsTimeout: true},
+			want: ErrorClassTimeout,
+		},
+		{
+			name: "mongodb flattened dns failure",
+			err:  errors.New("server selection error: lookup mongo.invalid: no such host"),
+			want: ErrorClassDNS,
+		},
+		{
+			name: "context deadline exceeded",
+			err:  fmt.Errorf("failed to ping PostgreSQL: %w", context.DeadlineExceeded),
+			want: ErrorClassTimeout,
+		},
+		{
+			name: "connection refused",
+			err:  fmt.Errorf("failed to ping MySQL: %w", &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}),
+			want: ErrorClassHostUnreachable,
+		},
+		{
+			name: "host unreachable",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.EHOSTUNREACH}},
+			want: ErrorClassHostUnreachable,
+		},
+		{
+			name: "mongodb server selection timeout",
+			err:  errors.New("server selection error: context deadline exceeded, current topology: { Type: Unknown }"),
+			want: ErrorClassTimeout,
+		},
+		{
+			name: "unrecognized error",
+			err:  errors.New("something else went wrong"),
+			want: ErrorClassUnknown,
+		},
+		{
+			name: "unrelated mysql error",
+			err:  &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"},
+			want: ErrorClassUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ClassifyError(tt.err))
+		})
+	}
+}
+
+func TestErrorClass_Description(t *testing.T) {
+	assert.Contains(t, ErrorClassDNS.Description(), "host")
+	assert.Contains(t, ErrorClassHostUnreachable.Description(), "port")
+	assert.Contains(t, ErrorClassAuth.Description(), "password")
+	assert.Contains(t, ErrorClassDatabaseMissing.Description(), "database name")
+	assert.Contains(t, ErrorClassTimeout.Description(), "network")
+	assert.Equal(t, "unexpected error", ErrorClassUnknown.Description())
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	assert.True(t, IsDuplicateKey(fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'config_key'"})))
+	assert.True(t, IsDuplicateKey(&pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}))
+	assert.True(t, IsDuplicateKey(mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}))
+
+	assert.False(t, IsDuplicateKey(&mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}))
+	assert.False(t, IsDuplicateKey(&pq.Error{Code: "42P01", Message: "relation does not exist"}))
+	assert.False(t, IsDuplicateKey(errors.New("connection reset")))
+	assert.False(t, IsDuplicateKey(nil))
+}
+
+func TestIsTopologyError(t *testing.T) {
+	assert.True(t, isTopologyError(topology.ServerSelectionError{Wrapped: context.DeadlineExceeded}))
+	assert.True(t, isTopologyError(fmt.Errorf("find: %w", topology.ErrServerSelectionTimeout)))
+	assert.True(t, isTopologyError(topology.ErrTopologyClosed))
+	assert.True(t, isTopologyError(fmt.Errorf("count: %w", mongo.ErrClientDisconnected)))
+
+	assert.False(t, isTopologyError(mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}))
+	assert.False(t, isTopologyError(context.Canceled))
+	assert.False(t, isTopologyError(nil))
+}
@@ -0,0 +1,138 @@
+package connectors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidExtendedJSON is returned by Execute for a MongoDB parameter holding a malformed $oid or $date
+var ErrInvalidExtendedJSON = errors.New("invalid extended JSON")
+
+// extendedJSONParams are the MongoDB parameters whose documents may hold Extended JSON values
+var extendedJSONParams = []string{"filter", "update", "document", "documents", "replacement", "pipeline", "operations"}
+
+// normalizeExtendedJSON returns params with the Extended JSON v2 values of their documents, {"$oid": "..."}
+// and {"$date": ...}, converted to the ObjectIDs and times the driver encodes as BSON. With coerce_dates set,
+// strings holding RFC 3339 times are converted too. params itself is left as it is.
+func normalizeExtendedJSON(params map[string]interface{}) (map[string]interface{}, error) {
+	coerceDates, _ := params["coerce_dates"].(bool)
+	var normalized map[string]interface{}
+	for _, name := range extendedJSONParams {
+		value, ok := params[name]
+		if !ok {
+			continue
+		}
+		converted, err := fromExtendedJSON(value, coerceDates)
+		if err != nil {
+			return nil, fmt.Errorf("%w in %s: %v", ErrInvalidExtendedJSON, name, err)
+		}
+		if normalized == nil {
+			normalized = make(map[string]interface{}, len(params))
+			for key, value := range params {
+				normalized[key] = value
+			}
+		}
+		normalized[name] = converted
+	}
+	if normalized == nil {
+		return params, nil
+	}
+	return normalized, nil
+}
+
+// fromExtendedJSON converts the $oid and $date wrappers within value, copying the maps and slices holding them
+func fromExtendedJSON(value interface{}, coerceDates bool) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 1 {
+			if oid, ok := v["$oid"]; ok {
+				return objectIDOf(oid)
+			}
+			if date, ok := v["$date"]; ok {
+				return dateOf(date)
+			}
+		}
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			c, err := fromExtendedJSON(item, coerceDates)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = c
+		}
+		return converted, nil
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			c, err := fromExtendedJSON(item, coerceDates)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = c
+		}
+		return converted, nil
+	case string:
+		if coerceDates {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// objectIDOf converts the value of a $oid, 24 hexadecimal digits
+func objectIDOf(value interface{}) (primitive.ObjectID, error) {
+	hex, ok := value.(string)
+	if !ok {
+		return primitive.NilObjectID, fmt.Errorf("$oid must be a string, not %T", value)
+	}
+	oid, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("$oid %q is not 24 hexadecimal digits", hex)
+	}
+	return oid, nil
+}
+
+// dateOf converts the value of a $date: an RFC 3339 time in relaxed form, or milliseconds since the epoch
+// as a number or, in canonical form, {"$numberLong": "..."}
+func dateOf(value interface{}) (time.Time, error) {
+	var ms int64
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("$date %q is not an RFC 3339 time", v)
+		}
+		return t.UTC(), nil
+	case float64:
+		ms = int64(v)
+	case int:
+		ms = int64(v)
+	case int64:
+		ms = v
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("$date %s is not a whole number of milliseconds", v)
+		}
+		ms = n
+	case map[string]interface{}:
+		long, ok := v["$numberLong"].(string)
+		n, err := strconv.ParseInt(long, 10, 64)
+		if !ok || len(v) != 1 || err != nil {
+			return time.Time{}, errors.New(`$date must be a string, a number or {"$numberLong": "..."}`)
+		}
+		ms = n
+	default:
+		return time.Time{}, fmt.Errorf("$date must be a string or a number, not %T", value)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
@@ -0,0 +1,105 @@
+package connectors
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decodeParams decodes params the way /execute receives them
+func decodeParams(t *testing.T, data string) map[string]interface{} {
+	var params map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(data), &params))
+	return params
+}
+
+func TestNormalizeExtendedJSON(t *testing.T) {
+	params := decodeParams(t, `{
+		"collection": "orders",
+		"filter": {
+			"_id": {"$in": [{"$oid": "64b7f0c2a1b2c3d4e5f60718"}, {"$oid": "64b7f0c2a1b2c3d4e5f60719"}]},
+			"created_at": {"$gte": {"$date": "2024-01-01T00:00:00Z"}, "$lt": {"$date": {"$numberLong": "1706745600000"}}},
+			"$or": [{"status": "open"}, {"shipped_at": {"$date": 1704067200000}}],
+			"note": "2024-01-01T00:00:00Z"
+		},
+		"limit": 10
+	}`)
+	normalized, err := normalizeExtendedJSON(params)
+	require.NoError(t, err)
+
+	oid, _ := primitive.ObjectIDFromHex("64b7f0c2a1b2c3d4e5f60718")
+	filter := normalized["filter"].(map[string]interface{})
+	assert.Equal(t, oid, filter["_id"].(map[string]interface{})["$in"].([]interface{})[0])
+	created := filter["created_at"].(map[string]interface{})
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), created["$gte"])
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), created["$lt"])
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), filter["$or"].([]interface{})[1].(map[string]interface{})["shipped_at"])
+	assert.Equal(t, "2024-01-01T00:00:00Z", filter["note"], "plain strings stay strings without coerce_dates")
+	assert.Equal(t, float64(10), normalized["limit"])
+
+	// The parameters received are left as they are
+	assert.Equal(t, map[string]interface{}{"$oid": "64b7f0c2a1b2c3d4e5f60718"}, params["filter"].(map[string]interface{})["_id"].(map[string]interface{})["$in"].([]interface{})[0])
+
+	// Without Extended JSON parameters the map is used as it is
+	plain := map[string]interface{}{"collection": "orders"}
+	same, err := normalizeExtendedJSON(plain)
+	require.NoError(t, err)
+	assert.Equal(t, plain, same)
+}
+
+func TestExtendedJSONRoundTrip(t *testing.T) {
+	// Encoded as BSON and back as relaxed Extended JSON, the values are the ObjectID and date they named
+	filter := `{"_id":{"$oid":"64b7f0c2a1b2c3d4e5f60718"},"created_at":{"$gte":{"$date":"2024-01-01T00:00:00Z"},"$lt":{"$date":"2024-02-01T12:30:00.5Z"}},"tags":{"$all":["a","b"]}}`
+	normalized, err := normalizeExtendedJSON(decodeParams(t, `{"filter": `+filter+`}`))
+	require.NoError(t, err)
+
+	data, err := bson.Marshal(normalized["filter"])
+	require.NoError(t, err)
+	var decoded bson.D
+	require.NoError(t, bson.Unmarshal(data, &decoded))
+	_, isOID := decoded.Map()["_id"].(primitive.ObjectID)
+	assert.True(t, isOID, "_id is stored as an ObjectID")
+
+	relaxed, err := bson.MarshalExtJSON(normalized["filter"], false, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, filter, string(relaxed))
+}
+
+func TestExtendedJSONUpdatesAndDocuments(t *testing.T) {
+	normalized, err := normalizeExtendedJSON(decodeParams(t, `{
+		"update": {"$set": {"owner": {"$oid": "64b7f0c2a1b2c3d4e5f60718"}, "due": "2024-03-01T09:00:00+02:00"}},
+		"documents": [{"at": {"$date": "2024-01-01T00:00:00Z"}}],
+		"operations": [{"deleteOne": {"filter": {"_id": {"$oid": "64b7f0c2a1b2c3d4e5f60719"}}}}],
+		"coerce_dates": true
+	}`))
+	require.NoError(t, err)
+
+	set := normalized["update"].(map[string]interface{})["$set"].(map[string]interface{})
+	assert.IsType(t, primitive.ObjectID{}, set["owner"])
+	assert.Equal(t, time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), set["due"], "coerce_dates converts RFC 3339 strings")
+	assert.IsType(t, time.Time{}, normalized["documents"].([]interface{})[0].(map[string]interface{})["at"])
+	models, err := bulkWriteModels(normalized["operations"].([]interface{}))
+	require.NoError(t, err)
+	assert.Len(t, models, 1)
+}
+
+func TestExtendedJSONInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		params  string
+		message string
+	}{
+		{`{"filter": {"_id": {"$oid": "xyz"}}}`, `invalid extended JSON in filter: $oid "xyz" is not 24 hexadecimal digits`},
+		{`{"filter": {"_id": {"$oid": 7}}}`, `invalid extended JSON in filter: $oid must be a string, not float64`},
+		{`{"document": {"at": {"$date": "yesterday"}}}`, `invalid extended JSON in document: $date "yesterday" is not an RFC 3339 time`},
+		{`{"update": {"$set": {"at": {"$date": {"$numberLong": "soon"}}}}}`, `invalid extended JSON in update: $date must be a string, a number or {"$numberLong": "..."}`},
+	} {
+		_, err := normalizeExtendedJSON(decodeParams(t, tc.params))
+		assert.ErrorIs(t, err, ErrInvalidExtendedJSON, tc.params)
+		assert.EqualError(t, err, tc.message)
+	}
+}
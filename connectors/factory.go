@@ -0,0 +1,63 @@
+package connectors
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Driver creates an unconnected connector from a connection configuration. Drivers that
+// have no use for the options, such as a logger, may ignore them.
+type Driver func(config *ConnectionConfig, opts ...Option) DBConnector
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// RegisterDriver makes a connector type available to New under name. The built-in mysql,
+// postgresql and mongodb drivers register themselves; programs importing this package can
+// register their own before serving requests. It panics if name is registered twice or
+// driver is nil.
+func RegisterDriver(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("connectors: RegisterDriver driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("connectors: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers returns the names of the registered drivers in sorted order
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsRegistered reports whether a driver is registered under name
+func IsRegistered(name string) bool {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	_, ok := drivers[name]
+	return ok
+}
+
+// New creates an unconnected connector using the driver registered under name
+func New(name string, config *ConnectionConfig, opts ...Option) (DBConnector, error) {
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type: %s", name)
+	}
+	return driver(config, opts...), nil
+}
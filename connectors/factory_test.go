@@ -0,0 +1,66 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubConnector is a minimal connector of a custom driver
+type stubConnector struct {
+	config *ConnectionConfig
+}
+
+func (s *stubConnector) Connect(ctx context.Context) error    { return nil }
+func (s *stubConnector) Ping(ctx context.Context) error       { return nil }
+func (s *stubConnector) Close(ctx context.Context) error      { return nil }
+func (s *stubConnector) GetType() string                      { return "stub" }
+func (s *stubConnector) IsConnected(ctx context.Context) bool { return false }
+func (s *stubConnector) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+func (s *stubConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	return nil, nil
+}
+func (s *stubConnector) GetServerInfo(ctx context.Context) (*ServerInfo, error) { return nil, nil }
+
+func TestBuiltInDriversAreRegistered(t *testing.T) {
+	assert.Subset(t, Drivers(), []string{"mongodb", "mysql", "postgresql"})
+
+	config := &ConnectionConfig{Host: "localhost", Port: 5432, Database: "testdb"}
+	for _, name := range []string{"mysql", "postgresql", "mongodb"} {
+		assert.True(t, IsRegistered(name))
+		connector, err := New(name, config)
+		require.NoError(t, err)
+		assert.Equal(t, name, connector.GetType())
+	}
+
+	assert.False(t, IsRegistered("oracle"))
+	_, err := New("oracle", config)
+	assert.EqualError(t, err, "unsupported database type: oracle")
+}
+
+func TestRegisterDriver(t *testing.T) {
+	RegisterDriver("stub", func(config *ConnectionConfig, opts ...Option) DBConnector {
+		return &stubConnector{config: config}
+	})
+	t.Cleanup(func() {
+		driversMu.Lock()
+		delete(drivers, "stub")
+		driversMu.Unlock()
+	})
+
+	config := &ConnectionConfig{Host: "kv.internal", Port: 7000}
+	connector, err := New("stub", config)
+	require.NoError(t, err)
+	assert.Same(t, config, connector.(*stubConnector).config)
+	assert.Contains(t, Drivers(), "stub")
+
+	assert.PanicsWithValue(t, "connectors: RegisterDriver called twice for driver stub", func() {
+		RegisterDriver("stub", func(config *ConnectionConfig, opts ...Option) DBConnector { return nil })
+	})
+	assert.Panics(t, func() { RegisterDriver("nil", nil) })
+}
@@ -4,8 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"db-connectors/logging"
+)
+
+// Default connection pool settings applied by all connectors
+const (
+	DefaultMaxOpenConns    = 25
+	DefaultMaxIdleConns    = 25
+	DefaultConnMaxLifetime = 5 * time.Minute
 )
 
+// DefaultProbeTimeout bounds the ping of IsConnected unless WithProbeTimeout sets another
+const DefaultProbeTimeout = 2 * time.Second
+
+// DefaultConnectTimeout bounds dialing the database server unless WithConnectTimeout sets another
+const DefaultConnectTimeout = 5 * time.Second
+
 // DBConnector defines the interface that all database connectors must implement
 type DBConnector interface {
 	// Connect establishes a connection to the database
@@ -14,8 +33,8 @@ type DBConnector interface {
 	// Ping tests the connection to the database
 	Ping(ctx context.Context) error
 	
-	// Close closes the database connection
-	Close() error
+	// Close closes the database connection, giving up waiting once ctx is done
+	Close(ctx context.Context) error
 	
 	// GetType returns the type of database (mysql, postgres, mongodb)
 	GetType() string
@@ -26,51 +45,218 @@ type DBConnector interface {
 	// Execute runs a command/query (for MongoDB and other operations)
 	Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error)
 	
-	// IsConnected returns whether the connection is active
-	IsConnected() bool
+	// IsConnected returns whether the connection is active, pinging it within ctx and the probe timeout
+	IsConnected(ctx context.Context) bool
+	
+	// GetServerInfo returns version and session details of the connected server
+	GetServerInfo(ctx context.Context) (*ServerInfo, error)
+}
+
+// SQLConnector is implemented by connectors backed by database/sql
+type SQLConnector interface {
+	DBConnector
+
+	// DB returns the underlying connection pool, or nil before Connect
+	DB() *sql.DB
+
+	// Dialect returns the SQL dialect statements for the database must be written in
+	Dialect() Dialect
+}
+
+// Reconnector is implemented by connectors whose client does not recover on its own once it loses the
+// server, such as MongoDB's after a primary steps down. database/sql pools redial by themselves.
+type Reconnector interface {
+	DBConnector
+
+	// Reconnect replaces the connection with a new one and closes the old one
+	Reconnect(ctx context.Context) error
+}
+
+// closeContext runs close, returning ctx's error instead when ctx is done first. The close carries on in
+// the background, as database/sql pools wait for running statements to finish.
+func closeContext(ctx context.Context, close func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ServerInfo describes the server a connector is talking to
+type ServerInfo struct {
+	Version     string       `json:"version"`
+	CurrentUser string       `json:"current_user,omitempty"`
+	TimeZone    string       `json:"time_zone,omitempty"`
+	TLS         bool         `json:"tls"`
+	Pool        PoolSettings `json:"pool"`
+}
+
+// PoolSettings reports the effective connection pool configuration
+type PoolSettings struct {
+	MaxOpenConns           int `json:"max_open_conns"`
+	MaxIdleConns           int `json:"max_idle_conns"`
+	ConnMaxLifetimeSeconds int `json:"conn_max_lifetime_seconds"`
+}
+
+// defaultPoolSettings returns the pool settings applied by the connectors
+func defaultPoolSettings() PoolSettings {
+	return PoolSettings{
+		MaxOpenConns:           DefaultMaxOpenConns,
+		MaxIdleConns:           DefaultMaxIdleConns,
+		ConnMaxLifetimeSeconds: int(DefaultConnMaxLifetime.Seconds()),
+	}
 }
 
 // ConnectionConfig holds database connection configuration
 type ConnectionConfig struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Database string `yaml:"database"`
-	SSLMode  string `yaml:"ssl_mode,omitempty"`
+	Host     string `yaml:"host" json:"host"`
+	Port     int    `yaml:"port" json:"port"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	Database string `yaml:"database" json:"database"`
+	Schema   string `yaml:"schema,omitempty" json:"schema,omitempty"` // PostgreSQL search_path; a MySQL schema is its database
+	SSLMode  string `yaml:"ssl_mode,omitempty" json:"ssl_mode,omitempty"`
+	// Connection URI or DSN used instead of the fields above, such as a mongodb+srv:// string. A MySQL DSN gets
+	// the session settings of the fields.
+	URI string `yaml:"uri,omitempty" json:"uri,omitempty"`
+	// Labels such as environment or team, attached to logs, metrics and config change events of the connection
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// Let a MySQL query run several statements separated by semicolons, which widens what an injected
+	// string can do; a URI sets it with multiStatements=true instead
+	MultiStatements bool `yaml:"multi_statements,omitempty" json:"multi_statements,omitempty"`
+}
+
+// uriSchemes lists the URI schemes each database type connects with. MySQL DSNs have no scheme, and
+// PostgreSQL also takes key=value connection strings.
+var uriSchemes = map[string][]string{
+	"mysql":      {""},
+	"postgresql": {"postgres", "postgresql", ""},
+	"mongodb":    {"mongodb", "mongodb+srv"},
+}
+
+// uriSchemePattern matches the scheme of a URI
+var uriSchemePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*)://`)
+
+// PostgreSQLSSLModes lists the sslmode values accepted by PostgreSQL
+var PostgreSQLSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// maxDatabaseNameLength is the shortest name limit of the supported databases (MySQL and MongoDB allow 64 characters)
+const maxDatabaseNameLength = 64
+
+// databaseNamePattern allows the characters that every supported database accepts in an unquoted name
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_$-]+$`)
+
+// ValidationError lists every problem found in a connection configuration
+type ValidationError struct {
+	Problems []string
 }
 
-// Validate checks if the connection configuration is valid
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validate checks if the connection configuration is valid, reporting all problems at once
 func (c *ConnectionConfig) Validate() error {
-	if c.Host == "" {
-		return fmt.Errorf("host is required")
-	}
-	if c.Port <= 0 || c.Port > 65535 {
-		return fmt.Errorf("port must be between 1 and 65535")
+	return c.validate(true)
+}
+
+// ValidateServer checks the configuration of a connection to the server as a whole,
+// such as one that lists databases, where the database name is optional
+func (c *ConnectionConfig) ValidateServer() error {
+	return c.validate(false)
+}
+
+// validate checks the discrete fields, which a URI takes the place of, unless a URI is set
+func (c *ConnectionConfig) validate(requireDatabase bool) error {
+	var problems []string
+	if c.URI == "" {
+		if c.Host == "" {
+			problems = append(problems, "host is required")
+		}
+		if c.Port <= 0 || c.Port > 65535 {
+			problems = append(problems, "port must be between 1 and 65535")
+		}
 	}
 	if c.Database == "" {
-		return fmt.Errorf("database name is required")
+		if requireDatabase && c.URI == "" {
+			problems = append(problems, "database name is required")
+		}
+	} else if err := ValidateName("database", c.Database); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Schema != "" {
+		if err := ValidateName("schema", c.Schema); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	problems = append(problems, labelProblems(c.Labels)...)
+	// ssl_mode is only used by PostgreSQL
+	if c.SSLMode != "" && !slices.Contains(PostgreSQLSSLModes, c.SSLMode) {
+		problems = append(problems, fmt.Sprintf("ssl_mode must be one of %s", strings.Join(PostgreSQLSSLModes, ", ")))
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// CheckURI checks that the scheme of the URI, if one is set, is one the database type connects with. A MySQL
+// DSN must also parse and leave out the options mysqlURIConfig refuses.
+func (c *ConnectionConfig) CheckURI(dbType string) error {
+	if c.URI == "" {
+		return nil
+	}
+	schemes, ok := uriSchemes[dbType]
+	if !ok {
+		return fmt.Errorf("uri is not supported for database type %s", dbType)
+	}
+	var scheme string
+	if match := uriSchemePattern.FindStringSubmatch(c.URI); match != nil {
+		scheme = strings.ToLower(match[1])
+	}
+	if slices.Contains(schemes, scheme) {
+		if dbType == "mysql" {
+			_, err := c.mysqlURIConfig()
+			return err
+		}
+		return nil
+	}
+	if scheme == "" {
+		return fmt.Errorf("uri of a %s database must start with %s://", dbType, strings.Join(schemes, ":// or "))
+	}
+	return fmt.Errorf("uri scheme %s does not match database type %s", scheme, dbType)
+}
+
+// RedactedURI returns the URI with its password replaced, for logs and responses
+func (c *ConnectionConfig) RedactedURI() string {
+	return logging.RedactDSN(c.URI)
+}
+
+// ValidateName checks a database or schema name, kind naming which in the error
+func ValidateName(kind, name string) error {
+	switch {
+	case len(name) > maxDatabaseNameLength:
+		return fmt.Errorf("%s name must be at most %d characters", kind, maxDatabaseNameLength)
+	case !databaseNamePattern.MatchString(name):
+		return fmt.Errorf("%s name may only contain letters, digits, '_', '$' and '-'", kind)
 	}
 	return nil
 }
 
-// GetConnectionString generates a connection string for the specified database type
+// GetConnectionString generates a connection string for the specified database type, escaping the
+// credentials as each format requires
 func (c *ConnectionConfig) GetConnectionString(dbType string) (string, error) {
 	switch dbType {
 	case "mysql":
-		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", c.Username, c.Password, c.Host, c.Port, c.Database), nil
+		return c.mysqlConfig().FormatDSN(), nil
 	case "postgresql":
-		sslMode := c.SSLMode
-		if sslMode == "" {
-			sslMode = "disable"
-		}
-		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", 
-			c.Host, c.Port, c.Username, c.Password, c.Database, sslMode), nil
+		return keyValueDSN(c.postgresPairs()...), nil
 	case "mongodb":
-		if c.Username != "" && c.Password != "" {
-			return fmt.Sprintf("mongodb://%s:%s@%s:%d/%s", c.Username, c.Password, c.Host, c.Port, c.Database), nil
-		}
-		return fmt.Sprintf("mongodb://%s:%d/%s", c.Host, c.Port, c.Database), nil
+		return c.mongoURI(), nil
 	default:
 		return "", fmt.Errorf("unsupported database type: %s", dbType)
 	}
@@ -78,9 +264,9 @@ func (c *ConnectionConfig) GetConnectionString(dbType string) (string, error) {
 
 // DatabaseConfig represents configuration for all supported databases
 type DatabaseConfig struct {
-	MySQL      *ConnectionConfig `yaml:"mysql,omitempty"`
-	PostgreSQL *ConnectionConfig `yaml:"postgresql,omitempty"`
-	MongoDB    *ConnectionConfig `yaml:"mongodb,omitempty"`
+	MySQL      *ConnectionConfig `yaml:"mysql,omitempty" json:"mysql,omitempty"`
+	PostgreSQL *ConnectionConfig `yaml:"postgresql,omitempty" json:"postgresql,omitempty"`
+	MongoDB    *ConnectionConfig `yaml:"mongodb,omitempty" json:"mongodb,omitempty"`
 }
 
 // GetConfig returns the connection configuration for the specified database type
@@ -106,34 +292,9 @@ func (dc *DatabaseConfig) GetConfig(dbType string) (*ConnectionConfig, error) {
 	}
 }
 
-// ConnectorRegistry manages all available database connectors
-type ConnectorRegistry struct {
-	connectors map[string]DBConnector
-}
-
-// NewConnectorRegistry creates a new connector registry
-func NewConnectorRegistry() *ConnectorRegistry {
-	return &ConnectorRegistry{
-		connectors: make(map[string]DBConnector),
-	}
-}
-
-// Register adds a connector to the registry
-func (cr *ConnectorRegistry) Register(name string, connector DBConnector) {
-	cr.connectors[name] = connector
-}
-
-// Get retrieves a connector by name
-func (cr *ConnectorRegistry) Get(name string) (DBConnector, bool) {
-	connector, exists := cr.connectors[name]
-	return connector, exists
-}
-
-// List returns all registered connector names
-func (cr *ConnectorRegistry) List() []string {
-	names := make([]string, 0, len(cr.connectors))
-	for name := range cr.connectors {
-		names = append(names, name)
-	}
-	return names
+// NewConnector creates an unconnected connector for the given database type.
+//
+// Deprecated: use New, which also creates connectors of registered custom drivers.
+func NewConnector(dbType string, config *ConnectionConfig, opts ...Option) (DBConnector, error) {
+	return New(dbType, config, opts...)
 }
@@ -0,0 +1,97 @@
+package connectors
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+)
+
+// ConnectionLabel is the label naming a connection: the name of a connection profile, or the label an
+// inline request gives its connection
+const ConnectionLabel = "connection"
+
+// Limits of label keys and values, which end up in logs, metrics and events
+const (
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 128
+)
+
+// labelKeyPattern allows keys usable as metric label names
+var labelKeyPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// labelValuePattern allows printable ASCII, keeping control characters out of log lines
+var labelValuePattern = regexp.MustCompile(`^[\x20-\x7e]+$`)
+
+// Labeled is implemented by connectors that carry the labels of their connection
+type Labeled interface {
+	Labels() map[string]string
+}
+
+// LabelsOf returns the labels of a connector, or nil when it has none
+func LabelsOf(connector DBConnector) map[string]string {
+	if labeled, ok := connector.(Labeled); ok {
+		return labeled.Labels()
+	}
+	return nil
+}
+
+// ValidateLabelKey checks a label key: lowercase letters, digits and '_', not starting with a digit
+func ValidateLabelKey(key string) error {
+	if len(key) > maxLabelKeyLength || !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("label key %q must be at most %d lowercase letters, digits and '_', not starting with a digit", key, maxLabelKeyLength)
+	}
+	return nil
+}
+
+// ValidateLabelValue checks the value of a label: printable ASCII of at most 128 characters
+func ValidateLabelValue(key, value string) error {
+	if len(value) > maxLabelValueLength || !labelValuePattern.MatchString(value) {
+		return fmt.Errorf("label %s must be 1 to %d printable ASCII characters", key, maxLabelValueLength)
+	}
+	return nil
+}
+
+// labelProblems reports the invalid keys and values of labels, in key order
+func labelProblems(labels map[string]string) []string {
+	var problems []string
+	for _, key := range sortedLabelKeys(labels) {
+		if err := ValidateLabelKey(key); err != nil {
+			problems = append(problems, err.Error())
+		} else if err := ValidateLabelValue(key, labels[key]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// WithConnectionLabel returns a copy of labels naming the connection name
+func WithConnectionLabel(labels map[string]string, name string) map[string]string {
+	copied := make(map[string]string, len(labels)+1)
+	for key, value := range labels {
+		copied[key] = value
+	}
+	copied[ConnectionLabel] = name
+	return copied
+}
+
+// labeledLogger returns logger with labels attached to every record as a "labels" group
+func labeledLogger(logger *slog.Logger, labels map[string]string) *slog.Logger {
+	if len(labels) == 0 {
+		return logger
+	}
+	attrs := make([]any, 0, len(labels))
+	for _, key := range sortedLabelKeys(labels) {
+		attrs = append(attrs, slog.String(key, labels[key]))
+	}
+	return logger.With(slog.Group("labels", attrs...))
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,107 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"db-connectors/logging"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelsOnStatementLogs(t *testing.T) {
+	statements := NewStatementLogger(StatementLogOptions{MetricLabels: []string{"environment", ConnectionLabel}})
+	statements.now = steppingClock(0, 20*time.Millisecond)
+	var buf bytes.Buffer
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	logger := logging.New(logging.Options{Level: "debug", Format: logging.FormatJSON, Output: &buf})
+	config := &ConnectionConfig{Host: "db", Port: 3306, Labels: map[string]string{"environment": "staging", "team": "payments", ConnectionLabel: "orders"}}
+	connector := NewMySQLConnector(config, WithLogger(logger), WithStatementLogger(statements))
+	connector.db = db
+
+	mock.ExpectExec("DELETE FROM carts").WillReturnResult(sqlmock.NewResult(0, 2))
+	_, err = connector.Execute(context.Background(), "delete", map[string]interface{}{"query": "DELETE FROM carts"})
+	require.NoError(t, err)
+
+	records := statementLogs(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, map[string]interface{}{"connection": "orders", "environment": "staging", "team": "payments"}, records[0]["labels"])
+
+	// Only the metric labels break the counters down
+	stats := statements.Stats()
+	require.Len(t, stats.Series, 1)
+	assert.Equal(t, StatementSeries{
+		Labels:     map[string]string{"environment": "staging", ConnectionLabel: "orders"},
+		Statements: 1,
+		SlowestMs:  20,
+	}, stats.Series[0])
+	assert.Equal(t, map[string]string{"environment": "staging", "team": "payments", ConnectionLabel: "orders"}, LabelsOf(connector))
+}
+
+func TestStatementSeries(t *testing.T) {
+	statements := NewStatementLogger(StatementLogOptions{SlowThreshold: time.Second, MetricLabels: []string{"environment"}})
+	statements.now = steppingClock(0, 2*time.Second, 0, time.Millisecond, 0, time.Millisecond)
+	logger := logging.Discard()
+
+	statements.beginSQL(logger, map[string]string{"environment": "prod", "team": "a"}, "query", "SELECT 1", 0).end(context.Background(), -1, nil)
+	statements.beginSQL(logger, map[string]string{"environment": "prod", "team": "b"}, "query", "SELECT 1", 0).end(context.Background(), -1, fmt.Errorf("boom"))
+	statements.beginSQL(logger, nil, "query", "SELECT 1", 0).end(context.Background(), -1, nil)
+
+	stats := statements.Stats()
+	assert.Equal(t, int64(3), stats.Statements)
+	assert.Equal(t, []StatementSeries{
+		// Connections without the label share a series
+		{Labels: map[string]string{}, Statements: 1, SlowestMs: 1},
+		{Labels: map[string]string{"environment": "prod"}, Statements: 2, Failed: 1, Slow: 1, SlowestMs: 2000},
+	}, stats.Series)
+
+	// Without metric labels only the totals are kept
+	assert.Empty(t, NewStatementLogger(StatementLogOptions{}).Stats().Series)
+}
+
+func TestStatementSeriesBounded(t *testing.T) {
+	statements := NewStatementLogger(StatementLogOptions{MetricLabels: []string{ConnectionLabel}})
+	logger := logging.Discard()
+	for i := 0; i < maxStatementSeries+10; i++ {
+		labels := map[string]string{ConnectionLabel: fmt.Sprintf("client-%d", i)}
+		statements.beginSQL(logger, labels, "query", "SELECT 1", 0).end(context.Background(), -1, nil)
+	}
+	stats := statements.Stats()
+	assert.Equal(t, int64(maxStatementSeries+10), stats.Statements)
+	assert.Len(t, stats.Series, maxStatementSeries)
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabelKey("environment"))
+	assert.NoError(t, ValidateLabelKey("_team_2"))
+	assert.Error(t, ValidateLabelKey("Environment"))
+	assert.Error(t, ValidateLabelKey("2nd"))
+	assert.Error(t, ValidateLabelKey("cost-center"))
+	assert.Error(t, ValidateLabelKey(strings.Repeat("a", maxLabelKeyLength+1)))
+
+	assert.NoError(t, ValidateLabelValue("team", "Payments / EU"))
+	assert.EqualError(t, ValidateLabelValue("team", ""), "label team must be 1 to 128 printable ASCII characters")
+	assert.Error(t, ValidateLabelValue("team", "line\nbreak"))
+	assert.Error(t, ValidateLabelValue("team", strings.Repeat("a", maxLabelValueLength+1)))
+
+	config := &ConnectionConfig{Host: "db", Port: 3306, Database: "orders", Labels: map[string]string{"Team": "a", "purpose": ""}}
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `label key "Team" must be`)
+	assert.Contains(t, err.Error(), "label purpose must be 1 to 128 printable ASCII characters")
+}
+
+func TestWithConnectionLabel(t *testing.T) {
+	labels := map[string]string{"team": "payments"}
+	assert.Equal(t, map[string]string{"team": "payments", ConnectionLabel: "orders"}, WithConnectionLabel(labels, "orders"))
+	assert.Equal(t, map[string]string{"team": "payments"}, labels)
+	assert.Equal(t, map[string]string{ConnectionLabel: "orders"}, WithConnectionLabel(nil, "orders"))
+}
@@ -0,0 +1,76 @@
+package connectors
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reconnect backoff of LISTEN connections, doubling from the minimum up to the maximum
+const (
+	minListenReconnect = time.Second
+	maxListenReconnect = time.Minute
+)
+
+// listenPingInterval is how often an idle LISTEN connection is pinged, so a connection lost without
+// notice is found out and reconnected
+const listenPingInterval = 90 * time.Second
+
+// Notification is a notification received on a LISTEN channel
+type Notification struct {
+	Channel string
+	Payload string
+	// Resync is set, without a payload, once the listener has reconnected after losing its connection.
+	// Notifications sent while it was disconnected are lost, so whatever they keep current has to be
+	// checked in full.
+	Resync bool
+}
+
+// Listener is implemented by connectors that receive notifications pushed by the database, such as
+// PostgreSQL's LISTEN/NOTIFY
+type Listener interface {
+	DBConnector
+
+	// Listen passes the notifications of channel to handle until ctx is done, reconnecting on its own
+	// whenever the connection is lost. It returns an error only when it cannot listen on channel.
+	Listen(ctx context.Context, channel string, handle func(Notification)) error
+}
+
+// notificationListener is the part of pq.Listener that Listen uses, replaced in tests
+type notificationListener interface {
+	Listen(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Ping() error
+	Close() error
+}
+
+// newPQListener opens a pq.Listener on its own connection, outside the connection pool
+func newPQListener(dsn string, onEvent pq.EventCallbackType) notificationListener {
+	return pq.NewListener(dsn, minListenReconnect, maxListenReconnect, onEvent)
+}
+
+// listen passes the notifications of listener to handle until ctx is done or listener is closed
+func listen(ctx context.Context, listener notificationListener, channel string, handle func(Notification)) error {
+	ping := time.NewTicker(listenPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n, ok := <-listener.NotificationChannel():
+			if !ok {
+				return nil
+			}
+			// pq sends nil once it has reconnected
+			if n == nil {
+				handle(Notification{Channel: channel, Resync: true})
+				continue
+			}
+			handle(Notification{Channel: n.Channel, Payload: n.Extra})
+		case <-ping.C:
+			// A failed ping means the connection is already being reestablished
+			_ = listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"db-connectors/logging"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeListener stands in for pq.Listener, delivering what is sent on notify
+type fakeListener struct {
+	notify    chan *pq.Notification
+	listenErr error
+	dsn       string
+	channel   string
+	closed    chan struct{}
+}
+
+func newFakeListener() *fakeListener {
+	return &fakeListener{notify: make(chan *pq.Notification), closed: make(chan struct{})}
+}
+
+func (l *fakeListener) Listen(channel string) error {
+	l.channel = channel
+	return l.listenErr
+}
+
+func (l *fakeListener) NotificationChannel() <-chan *pq.Notification { return l.notify }
+
+func (l *fakeListener) Ping() error { return nil }
+
+func (l *fakeListener) Close() error {
+	select {
+	case <-l.closed:
+	default:
+		close(l.closed)
+	}
+	return nil
+}
+
+func newListeningPostgreSQL(listener *fakeListener) *PostgreSQLConnector {
+	connector := NewPostgreSQLConnector(&ConnectionConfig{Host: "db", Port: 5432, Database: "app"}, WithLogger(logging.Discard()))
+	connector.newListener = func(dsn string, onEvent pq.EventCallbackType) notificationListener {
+		listener.dsn = dsn
+		return listener
+	}
+	return connector
+}
+
+func TestPostgreSQLListen(t *testing.T) {
+	listener := newFakeListener()
+	connector := newListeningPostgreSQL(listener)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	received := make(chan Notification)
+	done := make(chan error)
+	go func() {
+		done <- connector.Listen(ctx, "allconfig_changes", func(n Notification) { received <- n })
+	}()
+
+	listener.notify <- &pq.Notification{Channel: "allconfig_changes", Extra: `{"key": "feature.flag"}`}
+	assert.Equal(t, Notification{Channel: "allconfig_changes", Payload: `{"key": "feature.flag"}`}, <-received)
+	assert.Equal(t, "allconfig_changes", listener.channel)
+	assert.Equal(t, connector.dsn(), listener.dsn)
+
+	// pq sends nil once it has reconnected
+	listener.notify <- nil
+	assert.Equal(t, Notification{Channel: "allconfig_changes", Resync: true}, <-received)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Listen did not return once ctx was done")
+	}
+	select {
+	case <-listener.closed:
+	default:
+		t.Fatal("listener was not closed")
+	}
+}
+
+func TestPostgreSQLListenClosed(t *testing.T) {
+	listener := newFakeListener()
+	connector := newListeningPostgreSQL(listener)
+
+	// A closed notification channel ends listening
+	close(listener.notify)
+	require.NoError(t, connector.Listen(context.Background(), "allconfig_changes", func(Notification) {
+		t.Fatal("unexpected notification")
+	}))
+}
+
+func TestPostgreSQLListenFails(t *testing.T) {
+	listener := newFakeListener()
+	listener.listenErr = errors.New("permission denied")
+	connector := newListeningPostgreSQL(listener)
+
+	err := connector.Listen(context.Background(), "allconfig_changes", func(Notification) {})
+	assert.EqualError(t, err, "failed to listen on allconfig_changes: permission denied")
+}
+
+func TestPostgreSQLIsListener(t *testing.T) {
+	var connector DBConnector = NewPostgreSQLConnector(&ConnectionConfig{})
+	_, ok := connector.(Listener)
+	assert.True(t, ok)
+
+	connector = NewMySQLConnector(&ConnectionConfig{})
+	_, ok = connector.(Listener)
+	assert.False(t, ok)
+}
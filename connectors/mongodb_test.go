@@ -2,11 +2,17 @@ package connectors
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MongoDBConnectorTestSuite defines the test suite for MongoDB connector
@@ -225,7 +231,7 @@ func TestMongoDBIsConnectedWithoutConnection(t *testing.T) {
 	connector := NewMongoDBConnector(config)
 
 	// Should return false when not connected
-	assert.False(t, connector.IsConnected())
+	assert.False(t, connector.IsConnected(context.Background()))
 }
 
 // TestClose tests the Close method
@@ -238,7 +244,7 @@ func TestMongoDBClose(t *testing.T) {
 	connector := NewMongoDBConnector(config)
 
 	// Should not error even if not connected
-	err := connector.Close()
+	err := connector.Close(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -306,6 +312,36 @@ func TestMongoDBConnectorTestSuite(t *testing.T) {
 	suite.Run(t, new(MongoDBConnectorTestSuite))
 }
 
+// TestBulkWriteModels tests converting bulkWrite operations into driver write models
+func TestBulkWriteModels(t *testing.T) {
+	filter := map[string]interface{}{"config_key": "feature.flag"}
+	update := map[string]interface{}{"$set": map[string]interface{}{"config_value": "on"}}
+
+	models, err := bulkWriteModels([]interface{}{
+		map[string]interface{}{"insertOne": map[string]interface{}{"document": filter}},
+		map[string]interface{}{"updateOne": map[string]interface{}{"filter": filter, "update": update, "upsert": true}},
+		map[string]interface{}{"deleteMany": map[string]interface{}{"filter": filter}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, models, 3)
+	assert.IsType(t, &mongo.InsertOneModel{}, models[0])
+	upsert := models[1].(*mongo.UpdateOneModel)
+	assert.True(t, *upsert.Upsert)
+	assert.Equal(t, filter, upsert.Filter)
+	assert.IsType(t, &mongo.DeleteManyModel{}, models[2])
+
+	for name, operation := range map[string]interface{}{
+		"unknown write":    map[string]interface{}{"dropCollection": map[string]interface{}{}},
+		"two writes":       map[string]interface{}{"insertOne": map[string]interface{}{"document": filter}, "deleteOne": map[string]interface{}{"filter": filter}},
+		"missing filter":   map[string]interface{}{"updateOne": map[string]interface{}{"update": update}},
+		"missing document": map[string]interface{}{"insertOne": map[string]interface{}{}},
+		"not a map":        "insertOne",
+	} {
+		_, err := bulkWriteModels([]interface{}{operation})
+		assert.Error(t, err, name)
+	}
+}
+
 // Benchmark tests
 func BenchmarkMongoDBConnectorCreation(b *testing.B) {
 	config := &ConnectionConfig{
@@ -334,3 +370,158 @@ func BenchmarkMongoDBGetType(b *testing.B) {
 		_ = connector.GetType()
 	}
 }
+
+// unreachableDial returns a dial function counting its calls that hands out clients of a server that
+// never answers, so their operations fail server selection quickly
+func unreachableDial(t *testing.T, calls *int32) func(context.Context, *options.ClientOptions) (*mongo.Client, error) {
+	return func(ctx context.Context, _ *options.ClientOptions) (*mongo.Client, error) {
+		atomic.AddInt32(calls, 1)
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(50*time.Millisecond))
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Disconnect(context.Background()) })
+		return client, nil
+	}
+}
+
+func newReconnectingConnector(t *testing.T, calls *int32) *MongoDBConnector {
+	connector := NewMongoDBConnector(&ConnectionConfig{Host: "127.0.0.1", Port: 1, Database: "app"})
+	connector.dial = unreachableDial(t, calls)
+	connector.reconnectBackoff = time.Millisecond
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector
+}
+
+func TestCollationOf(t *testing.T) {
+	assert.Nil(t, collationOf(map[string]interface{}{"collection": "allconfig"}))
+	assert.Equal(t, &options.Collation{Locale: "en", Strength: 2}, collationOf(map[string]interface{}{
+		"collation": map[string]interface{}{"locale": "en", "strength": 2},
+	}))
+	// As decoded from a JSON request
+	assert.Equal(t, &options.Collation{Locale: "fr", Strength: 1}, collationOf(map[string]interface{}{
+		"collation": map[string]interface{}{"locale": "fr", "strength": 1.0},
+	}))
+}
+
+func TestIndexModel(t *testing.T) {
+	_, err := indexModel(map[string]interface{}{"collection": "allconfig"})
+	assert.EqualError(t, err, "index is required for createIndex")
+
+	model, err := indexModel(map[string]interface{}{
+		"index":   map[string]interface{}{"config_key": 1},
+		"options": map[string]interface{}{"unique": true, "name": "config_key_1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"config_key": 1}, model.Keys)
+	assert.True(t, *model.Options.Unique)
+	assert.Equal(t, "config_key_1", *model.Options.Name)
+	assert.Nil(t, model.Options.ExpireAfterSeconds)
+
+	// As decoded from a JSON request
+	model, err = indexModel(map[string]interface{}{
+		"index":   map[string]interface{}{"expires_at": 1.0},
+		"options": map[string]interface{}{"expireAfterSeconds": 0.0},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), *model.Options.ExpireAfterSeconds)
+	assert.Nil(t, model.Options.Unique)
+}
+
+func TestMongoDBReconnectsOnTopologyError(t *testing.T) {
+	var calls int32
+	connector := newReconnectingConnector(t, &calls)
+
+	_, err := connector.Execute(context.Background(), "count", map[string]interface{}{"collection": "allconfig"})
+	assert.True(t, isTopologyError(err), "%v", err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls), "one reconnect, then the operation runs again")
+
+	err = connector.Ping(context.Background())
+	assert.True(t, isTopologyError(err), "%v", err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	// Other failures are returned as they are
+	_, err = connector.Execute(context.Background(), "count", map[string]interface{}{})
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestMongoDBReconnectReplacesClient(t *testing.T) {
+	var calls int32
+	connector := newReconnectingConnector(t, &calls)
+	old, _ := connector.conn()
+
+	require.NoError(t, connector.Reconnect(context.Background()))
+	client, db := connector.conn()
+	assert.NotSame(t, old, client)
+	assert.Equal(t, "app", db.Name())
+	assert.ErrorIs(t, old.Ping(context.Background(), nil), mongo.ErrClientDisconnected)
+}
+
+func TestMongoDBConcurrentReconnectsShareOne(t *testing.T) {
+	var calls int32
+	connector := newReconnectingConnector(t, &calls)
+	failed, _ := connector.conn()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, connector.reconnect(context.Background(), failed))
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestMongoDBReconnectGivesUp(t *testing.T) {
+	var calls int32
+	connector := newReconnectingConnector(t, &calls)
+	connector.dial = func(context.Context, *options.ClientOptions) (*mongo.Client, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("connection refused")
+	}
+
+	err := connector.Reconnect(context.Background())
+	assert.EqualError(t, err, "failed to reconnect to MongoDB after 3 attempts: connection refused")
+	assert.EqualValues(t, 1+mongoReconnectAttempts, atomic.LoadInt32(&calls))
+
+	// A canceled caller stops backing off
+	connector.reconnectBackoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, connector.Reconnect(ctx), context.Canceled)
+}
+
+func TestMongoDBCloseAndProbeHonorContext(t *testing.T) {
+	var calls int32
+	connector := newReconnectingConnector(t, &calls)
+	connector.probeTimeout = time.Hour
+
+	// The probe gives up with its caller rather than waiting out its own timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.False(t, connector.IsConnected(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	connector.Close(ctx)
+	assert.Less(t, time.Since(start), time.Second)
+	client, _ := connector.conn()
+	assert.ErrorIs(t, client.Ping(context.Background(), nil), mongo.ErrClientDisconnected)
+}
+
+func TestDecodeOne(t *testing.T) {
+	doc, err := decodeOne(mongo.NewSingleResultFromDocument(map[string]interface{}{"config_key": "feature.flag"}, nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "feature.flag", doc["config_key"])
+
+	_, err = decodeOne(mongo.NewSingleResultFromDocument(map[string]interface{}{}, mongo.ErrNoDocuments, nil))
+	assert.Same(t, ErrNotFound, err)
+
+	_, err = decodeOne(mongo.NewSingleResultFromDocument(map[string]interface{}{}, errors.New("connection reset"), nil))
+	assert.EqualError(t, err, "failed to execute findOne: connection reset")
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"time"
 
+	"db-connectors/logging"
+
 	_ "github.com/go-sql-driver/mysql"
 )
 
@@ -13,24 +16,41 @@ import (
 type MySQLConnector struct {
 	config *ConnectionConfig
 	db     *sql.DB
+	logger *slog.Logger
+
+	statements     *StatementLogger
+	probeTimeout   time.Duration
+	connectTimeout time.Duration
+	authFailures
+}
+
+func init() {
+	RegisterDriver("mysql", func(config *ConnectionConfig, opts ...Option) DBConnector {
+		return NewMySQLConnector(config, opts...)
+	})
 }
 
 // NewMySQLConnector creates a new MySQL connector
-func NewMySQLConnector(config *ConnectionConfig) *MySQLConnector {
+func NewMySQLConnector(config *ConnectionConfig, opts ...Option) *MySQLConnector {
+	o := applyOptions("mysql", opts)
 	return &MySQLConnector{
 		config: config,
+		logger: labeledLogger(o.logger, config.Labels),
+
+		statements:     o.statements,
+		probeTimeout:   o.probeTimeout,
+		connectTimeout: o.connectTimeout,
 	}
 }
 
 // Connect establishes a connection to MySQL
 func (m *MySQLConnector) Connect(ctx context.Context) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
-		m.config.Username,
-		m.config.Password,
-		m.config.Host,
-		m.config.Port,
-		m.config.Database,
-	)
+	if err := m.config.CheckURI("mysql"); err != nil {
+		return err
+	}
+	dsn := m.dsn()
+	m.logger.DebugContext(ctx, "connecting", "dsn", logging.RedactDSN(dsn))
+	start := time.Now()
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
@@ -38,9 +58,9 @@ func (m *MySQLConnector) Connect(ctx context.Context) error {
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(DefaultMaxOpenConns)
+	db.SetMaxIdleConns(DefaultMaxIdleConns)
+	db.SetConnMaxLifetime(DefaultConnMaxLifetime)
 
 	// Test the connection
 	if err := db.PingContext(ctx); err != nil {
@@ -48,25 +68,53 @@ func (m *MySQLConnector) Connect(ctx context.Context) error {
 	}
 
 	m.db = db
+	m.logger.DebugContext(ctx, "connected", "host", m.config.Host, "database", m.config.Database, "duration", time.Since(start))
 	return nil
 }
 
+// dsn returns the data source name of the connection. The session runs in UTC so NOW() and TIMESTAMP
+// columns read back the same instant whatever the server's time zone, and DATETIME values parse as UTC.
+// A configured URI takes the place of the address, credentials and database, and gets the same settings.
+func (m *MySQLConnector) dsn() string {
+	cfg := m.config.mysqlConfig()
+	if m.config.URI != "" {
+		// Connect refuses a URI that does not parse with CheckURI first
+		if parsed, err := m.config.mysqlURIConfig(); err == nil {
+			cfg = parsed
+		}
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	cfg.Params["time_zone"] = "'+00:00'"
+	cfg.Timeout = m.connectTimeout
+	cfg.MultiStatements = m.config.MultiStatements
+	return cfg.FormatDSN()
+}
+
 // Ping tests the connection to MySQL
 func (m *MySQLConnector) Ping(ctx context.Context) error {
 	if m.db == nil {
 		return fmt.Errorf("MySQL connection not established")
 	}
-	return m.db.PingContext(ctx)
+	return m.observe(m.db.PingContext(ctx))
 }
 
-// Close closes the MySQL connection
-func (m *MySQLConnector) Close() error {
+// Close closes the MySQL connection pool, returning early when ctx is done before running statements finish
+func (m *MySQLConnector) Close(ctx context.Context) error {
 	if m.db != nil {
-		return m.db.Close()
+		return closeContext(ctx, m.db.Close)
 	}
 	return nil
 }
 
+// Labels returns the labels of the connection
+func (m *MySQLConnector) Labels() map[string]string {
+	return m.config.Labels
+}
+
 // GetType returns the database type
 func (m *MySQLConnector) GetType() string {
 	return "mysql"
@@ -77,23 +125,35 @@ func (m *MySQLConnector) Query(ctx context.Context, query string, args ...interf
 	if m.db == nil {
 		return nil, fmt.Errorf("MySQL connection not established")
 	}
-	return m.db.QueryContext(ctx, query, args...)
+	stmt := m.statements.beginSQL(m.logger, m.config.Labels, "query", query, len(args))
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	// Rows are read after Query returns, so the duration is that of the first response and the count is unknown
+	stmt.end(ctx, -1, err)
+	return rows, m.observe(err)
 }
 
 // Execute runs a command/query (for compatibility with interface)
 func (m *MySQLConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	result, err := m.execute(ctx, operation, params)
+	return result, m.observe(err)
+}
+
+// execute runs the operation of Execute
+func (m *MySQLConnector) execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
 	if m.db == nil {
 		return nil, fmt.Errorf("MySQL connection not established")
 	}
 
 	switch operation {
-	case "insert", "update", "delete":
+	case "insert", "update", "delete", "execute":
 		if query, ok := params["query"].(string); ok {
 			args := make([]interface{}, 0)
 			if argsList, ok := params["args"].([]interface{}); ok {
 				args = argsList
 			}
+			stmt := m.statements.beginSQL(m.logger, m.config.Labels, operation, query, len(args))
 			result, err := m.db.ExecContext(ctx, query, args...)
+			stmt.end(ctx, sqlResultRows(result), err)
 			if err != nil {
 				return nil, err
 			}
@@ -109,19 +169,61 @@ func (m *MySQLConnector) Execute(ctx context.Context, operation string, params m
 			return m.Query(ctx, query, args...)
 		}
 		return nil, fmt.Errorf("query parameter required for operation: %s", operation)
+	case "call":
+		if query, ok := params["query"].(string); ok {
+			args, _ := params["args"].([]interface{})
+			return m.call(ctx, query, args)
+		}
+		return nil, fmt.Errorf("query parameter required for operation: %s", operation)
 	default:
-		return nil, fmt.Errorf("unsupported operation: %s", operation)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedOperation, operation)
 	}
 }
 
+// DB returns the underlying MySQL connection pool
+func (m *MySQLConnector) DB() *sql.DB {
+	return m.db
+}
+
+// Dialect returns the SQL dialect of the connector
+func (m *MySQLConnector) Dialect() Dialect {
+	return MySQLDialect{}
+}
+
 // IsConnected returns whether the connection is active
-func (m *MySQLConnector) IsConnected() bool {
+func (m *MySQLConnector) IsConnected(ctx context.Context) bool {
 	if m.db == nil {
 		return false
 	}
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.probeTimeout)
 	defer cancel()
 	
 	return m.Ping(ctx) == nil
 }
+
+// GetServerInfo returns version and session details of the MySQL server
+func (m *MySQLConnector) GetServerInfo(ctx context.Context) (*ServerInfo, error) {
+	if m.db == nil {
+		return nil, fmt.Errorf("MySQL connection not established")
+	}
+
+	info := &ServerInfo{Pool: defaultPoolSettings()}
+	row := m.db.QueryRowContext(ctx, "SELECT VERSION(), CURRENT_USER(), @@session.time_zone, @@system_time_zone")
+	var sessionZone, systemZone string
+	if err := row.Scan(&info.Version, &info.CurrentUser, &sessionZone, &systemZone); err != nil {
+		return nil, fmt.Errorf("failed to query MySQL server info: %w", err)
+	}
+	info.TimeZone = sessionZone
+	if sessionZone == "SYSTEM" {
+		info.TimeZone = systemZone
+	}
+
+	// Ssl_cipher is empty for unencrypted sessions
+	var variable, cipher string
+	if err := m.db.QueryRowContext(ctx, "SHOW SESSION STATUS LIKE 'Ssl_cipher'").Scan(&variable, &cipher); err == nil {
+		info.TLS = cipher != ""
+	}
+
+	return info, nil
+}
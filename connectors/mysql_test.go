@@ -97,7 +97,7 @@ func TestMySQLConnectionString(t *testing.T) {
 				Username: "root",
 				Database: "testdb",
 			},
-			expected: "root:@tcp(localhost:3306)/testdb",
+			expected: "root@tcp(localhost:3306)/testdb",
 		},
 	}
 
@@ -199,6 +199,18 @@ func (suite *MySQLConnectorTestSuite) TestExecute() {
 			},
 			wantErr: false,
 		},
+		{
+			name:      "execute operation (DDL)",
+			operation: "execute",
+			params: map[string]interface{}{
+				"query": "CREATE TABLE test (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(100))",
+			},
+			setupMock: func() {
+				suite.mock.ExpectExec("CREATE TABLE test").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: false,
+		},
 		{
 			name:      "operation without query",
 			operation: "select",
@@ -268,13 +280,13 @@ func (suite *MySQLConnectorTestSuite) TestPingError() {
 // TestIsConnected tests the IsConnected method
 func (suite *MySQLConnectorTestSuite) TestIsConnected() {
 	// Without connection
-	assert.False(suite.T(), suite.connector.IsConnected())
+	assert.False(suite.T(), suite.connector.IsConnected(context.Background()))
 
 	// With mock connection
 	suite.connector.db = suite.db
 	suite.mock.ExpectPing()
 	
-	assert.True(suite.T(), suite.connector.IsConnected())
+	assert.True(suite.T(), suite.connector.IsConnected(context.Background()))
 	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
 }
 
@@ -286,7 +298,7 @@ func (suite *MySQLConnectorTestSuite) TestClose() {
 	// Set up expectation for close
 	suite.mock.ExpectClose()
 
-	err := suite.connector.Close()
+	err := suite.connector.Close(context.Background())
 
 	assert.NoError(suite.T(), err)
 	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
@@ -0,0 +1,50 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// call runs a statement returning any number of result sets, such as CALL proc(...), reading all of them
+// up to the result size limit of ctx. The warnings are read on the same connection right after, since
+// SHOW WARNINGS reports those of the last statement of its session.
+func (m *MySQLConnector) call(ctx context.Context, query string, args []interface{}) (*CallResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stmt := m.statements.beginSQL(m.logger, m.config.Labels, "call", query, len(args))
+	result, rowCount, err := readResultSets(ctx, cancel, conn, query, args)
+	stmt.end(ctx, rowCount, err)
+	if err != nil {
+		return nil, err
+	}
+	if result.Warnings, err = readWarnings(ctx, conn); err != nil {
+		return nil, fmt.Errorf("failed to read warnings: %w", err)
+	}
+	return result, nil
+}
+
+// readWarnings lists the warnings of the last statement run on conn
+func readWarnings(ctx context.Context, conn *sql.Conn) ([]SQLWarning, error) {
+	rows, err := conn.QueryContext(ctx, "SHOW WARNINGS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	warnings := []SQLWarning{}
+	for rows.Next() {
+		var w SQLWarning
+		if err := rows.Scan(&w.Level, &w.Code, &w.Message); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings, rows.Err()
+}
@@ -0,0 +1,85 @@
+package connectors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCallConnector returns a MySQL connector running its statements on a sqlmock database
+func newCallConnector(t *testing.T) (*MySQLConnector, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	connector := NewMySQLConnector(&ConnectionConfig{Host: "localhost", Port: 3306, Database: "shop"})
+	connector.db = db
+	return connector, mock
+}
+
+func TestMySQLCall(t *testing.T) {
+	connector, mock := newCallConnector(t)
+	orders := sqlmock.NewRows([]string{"id", "status"}).AddRow(1, []byte("paid")).AddRow(2, "shipped")
+	totals := sqlmock.NewRows([]string{"total"}).AddRow(42.5)
+	mock.ExpectQuery("CALL order_report").WithArgs(int64(7)).WillReturnRows(orders, totals)
+	mock.ExpectQuery("SHOW WARNINGS").WillReturnRows(sqlmock.NewRows([]string{"Level", "Code", "Message"}).
+		AddRow("Warning", 1265, "Data truncated for column 'status' at row 1"))
+
+	result, err := connector.Execute(context.Background(), "call", map[string]interface{}{
+		"query": "CALL order_report(?)",
+		"args":  []interface{}{int64(7)},
+	})
+	require.NoError(t, err)
+	called := result.(*CallResult)
+	require.Len(t, called.ResultSets, 2)
+	assert.Equal(t, "id", called.ResultSets[0].Columns[0].Name())
+	assert.Equal(t, []map[string]interface{}{
+		{"id": int64(1), "status": "paid"},
+		{"id": int64(2), "status": "shipped"},
+	}, called.ResultSets[0].Rows)
+	assert.Equal(t, []map[string]interface{}{{"total": 42.5}}, called.ResultSets[1].Rows)
+	assert.Equal(t, []SQLWarning{{Level: "Warning", Code: 1265, Message: "Data truncated for column 'status' at row 1"}}, called.Warnings)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLCallEmptyResultSets(t *testing.T) {
+	connector, mock := newCallConnector(t)
+	mock.ExpectQuery("CALL cleanup").WillReturnRows(sqlmock.NewRows([]string{"id"}), sqlmock.NewRows(nil))
+	mock.ExpectQuery("SHOW WARNINGS").WillReturnRows(sqlmock.NewRows([]string{"Level", "Code", "Message"}))
+
+	called, err := connector.call(context.Background(), "CALL cleanup()", nil)
+	require.NoError(t, err)
+	// A set without rows is kept, while the status without columns is not a result set
+	require.Len(t, called.ResultSets, 1)
+	assert.Empty(t, called.ResultSets[0].Rows)
+	assert.NotNil(t, called.Warnings)
+	assert.Empty(t, called.Warnings)
+}
+
+func TestMySQLCallResultSizeLimit(t *testing.T) {
+	connector, mock := newCallConnector(t)
+	first := sqlmock.NewRows([]string{"note"}).AddRow("short")
+	second := sqlmock.NewRows([]string{"note"}).AddRow("a note well past the limit of the whole result")
+	mock.ExpectQuery("CALL notes").WillReturnRows(first, second)
+
+	// The limit counts the rows of every result set
+	_, err := connector.call(ContextWithMaxResultBytes(context.Background(), 40), "CALL notes()", nil)
+	var tooLarge *ResultTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, 2, tooLarge.Rows)
+}
+
+func TestMySQLMultiStatementsDSN(t *testing.T) {
+	config := &ConnectionConfig{Host: "db", Port: 3306, Username: "app", Database: "orders"}
+	parsed, err := mysql.ParseDSN(NewMySQLConnector(config).dsn())
+	require.NoError(t, err)
+	assert.False(t, parsed.MultiStatements, "multi-statements are off unless configured")
+
+	config.MultiStatements = true
+	parsed, err = mysql.ParseDSN(NewMySQLConnector(config).dsn())
+	require.NoError(t, err)
+	assert.True(t, parsed.MultiStatements)
+}
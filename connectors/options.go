@@ -0,0 +1,67 @@
+package connectors
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures optional connector settings
+type Option func(*connectorOptions)
+
+type connectorOptions struct {
+	logger         *slog.Logger
+	probeTimeout   time.Duration
+	connectTimeout time.Duration
+	statements     *StatementLogger
+}
+
+// WithLogger sets the logger used for connection and statement debug output
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *connectorOptions) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithProbeTimeout bounds the ping of IsConnected; zero or less keeps DefaultProbeTimeout
+func WithProbeTimeout(timeout time.Duration) Option {
+	return func(o *connectorOptions) {
+		if timeout > 0 {
+			o.probeTimeout = timeout
+		}
+	}
+}
+
+// WithConnectTimeout bounds dialing the database server, set as the driver's own connect timeout; zero
+// or less keeps DefaultConnectTimeout
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *connectorOptions) {
+		if timeout > 0 {
+			o.connectTimeout = timeout
+		}
+	}
+}
+
+// WithStatementLogger sets the logger timing the statements a connector runs, so connectors sharing it
+// share its counters; nil keeps a logger of the connector's own with the default slow threshold
+func WithStatementLogger(statements *StatementLogger) Option {
+	return func(o *connectorOptions) {
+		if statements != nil {
+			o.statements = statements
+		}
+	}
+}
+
+// applyOptions resolves connector options for a database type
+func applyOptions(dbType string, opts []Option) connectorOptions {
+	o := connectorOptions{logger: slog.Default(), probeTimeout: DefaultProbeTimeout, connectTimeout: DefaultConnectTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.logger = o.logger.With("db_type", dbType)
+	if o.statements == nil {
+		o.statements = NewStatementLogger(StatementLogOptions{})
+	}
+	return o
+}
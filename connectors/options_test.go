@@ -0,0 +1,81 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"db-connectors/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestWithLoggerRedactsConnectionString(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(logging.Options{Level: "debug", Output: &buf})
+
+	connector := NewMySQLConnector(&ConnectionConfig{
+		Host:     "127.0.0.1",
+		Port:     1,
+		Username: "app",
+		Password: "s3cret",
+		Database: "testdb",
+	}, WithLogger(logger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	connector.Connect(ctx)
+
+	output := buf.String()
+	assert.Contains(t, output, "connecting db_type=mysql")
+	assert.Contains(t, output, "app:***@tcp(127.0.0.1:1)/testdb")
+	assert.NotContains(t, output, "s3cret")
+}
+
+func TestApplyOptionsDefaultsToSlogDefault(t *testing.T) {
+	o := applyOptions("postgresql", nil)
+	assert.NotNil(t, o.logger)
+
+	o = applyOptions("mongodb", []Option{WithLogger(nil)})
+	assert.NotNil(t, o.logger)
+}
+
+func TestWithProbeTimeout(t *testing.T) {
+	assert.Equal(t, DefaultProbeTimeout, applyOptions("mysql", nil).probeTimeout)
+	assert.Equal(t, time.Second, applyOptions("mysql", []Option{WithProbeTimeout(time.Second)}).probeTimeout)
+	assert.Equal(t, DefaultProbeTimeout, applyOptions("mysql", []Option{WithProbeTimeout(0)}).probeTimeout)
+}
+
+func TestWithConnectTimeout(t *testing.T) {
+	assert.Equal(t, DefaultConnectTimeout, applyOptions("mysql", nil).connectTimeout)
+	assert.Equal(t, 1500*time.Millisecond, applyOptions("mysql", []Option{WithConnectTimeout(1500 * time.Millisecond)}).connectTimeout)
+	assert.Equal(t, DefaultConnectTimeout, applyOptions("mysql", []Option{WithConnectTimeout(-time.Second)}).connectTimeout)
+}
+
+func TestConnectTimeoutDialSettings(t *testing.T) {
+	config := &ConnectionConfig{Host: "db", Port: 5432, Username: "app", Password: "secret", Database: "app"}
+
+	mysqlConnector := NewMySQLConnector(config, WithConnectTimeout(1500*time.Millisecond))
+	assert.Contains(t, mysqlConnector.dsn(), "&timeout=1.5s")
+	assert.Contains(t, NewMySQLConnector(config).dsn(), "&timeout=5s")
+
+	// connect_timeout is whole seconds, rounded up
+	postgresConnector := NewPostgreSQLConnector(config, WithConnectTimeout(1500*time.Millisecond))
+	assert.Contains(t, postgresConnector.dsn(), " connect_timeout=2")
+	assert.Contains(t, NewPostgreSQLConnector(config).dsn(), " connect_timeout=5")
+
+	mongoConnector := NewMongoDBConnector(config, WithConnectTimeout(1500*time.Millisecond))
+	var dialed *options.ClientOptions
+	mongoConnector.dial = func(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+		dialed = opts
+		return nil, errors.New("unreachable")
+	}
+	assert.Error(t, mongoConnector.Connect(context.Background()))
+	require.NotNil(t, dialed)
+	assert.Equal(t, 1500*time.Millisecond, *dialed.ConnectTimeout)
+}
@@ -4,39 +4,57 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
 	"time"
 
-	_ "github.com/lib/pq"
+	"db-connectors/logging"
+
+	"github.com/lib/pq"
 )
 
 // PostgreSQLConnector implements DBConnector for PostgreSQL
 type PostgreSQLConnector struct {
 	config *ConnectionConfig
 	db     *sql.DB
+	logger *slog.Logger
+
+	statements     *StatementLogger
+	probeTimeout   time.Duration
+	connectTimeout time.Duration
+	authFailures
+	newListener    func(dsn string, onEvent pq.EventCallbackType) notificationListener
+}
+
+func init() {
+	RegisterDriver("postgresql", func(config *ConnectionConfig, opts ...Option) DBConnector {
+		return NewPostgreSQLConnector(config, opts...)
+	})
 }
 
 // NewPostgreSQLConnector creates a new PostgreSQL connector
-func NewPostgreSQLConnector(config *ConnectionConfig) *PostgreSQLConnector {
+func NewPostgreSQLConnector(config *ConnectionConfig, opts ...Option) *PostgreSQLConnector {
+	o := applyOptions("postgresql", opts)
 	return &PostgreSQLConnector{
 		config: config,
+		logger: labeledLogger(o.logger, config.Labels),
+
+		statements:     o.statements,
+		probeTimeout:   o.probeTimeout,
+		connectTimeout: o.connectTimeout,
+		newListener:    newPQListener,
 	}
 }
 
 // Connect establishes a connection to PostgreSQL
 func (p *PostgreSQLConnector) Connect(ctx context.Context) error {
-	sslMode := p.config.SSLMode
-	if sslMode == "" {
-		sslMode = "disable"
-	}
-
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		p.config.Host,
-		p.config.Port,
-		p.config.Username,
-		p.config.Password,
-		p.config.Database,
-		sslMode,
-	)
+	if err := p.config.CheckURI("postgresql"); err != nil {
+		return err
+	}
+	dsn := p.dsn()
+	p.logger.DebugContext(ctx, "connecting", "dsn", logging.RedactDSN(dsn))
+	start := time.Now()
 
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
@@ -44,9 +62,9 @@ func (p *PostgreSQLConnector) Connect(ctx context.Context) error {
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(DefaultMaxOpenConns)
+	db.SetMaxIdleConns(DefaultMaxIdleConns)
+	db.SetConnMaxLifetime(DefaultConnMaxLifetime)
 
 	// Test the connection
 	if err := db.PingContext(ctx); err != nil {
@@ -54,25 +72,49 @@ func (p *PostgreSQLConnector) Connect(ctx context.Context) error {
 	}
 
 	p.db = db
+	p.logger.DebugContext(ctx, "connected", "host", p.config.Host, "database", p.config.Database, "duration", time.Since(start))
 	return nil
 }
 
+// dsn returns the connection string of the connection. The session runs in UTC so CURRENT_TIMESTAMP is
+// stored in TIMESTAMP columns as UTC; connect_timeout is in whole seconds, rounded up. A schema becomes
+// the search_path of every session of the pool, so unqualified names resolve in it. A configured URI is
+// used as it is.
+func (p *PostgreSQLConnector) dsn() string {
+	if p.config.URI != "" {
+		return p.config.URI
+	}
+	pairs := append(p.config.postgresPairs(),
+		"timezone", "UTC",
+		"connect_timeout", strconv.Itoa(int(math.Ceil(p.connectTimeout.Seconds()))),
+	)
+	if p.config.Schema != "" {
+		pairs = append(pairs, "search_path", p.config.Schema)
+	}
+	return keyValueDSN(pairs...)
+}
+
 // Ping tests the connection to PostgreSQL
 func (p *PostgreSQLConnector) Ping(ctx context.Context) error {
 	if p.db == nil {
 		return fmt.Errorf("PostgreSQL connection not established")
 	}
-	return p.db.PingContext(ctx)
+	return p.observe(p.db.PingContext(ctx))
 }
 
-// Close closes the PostgreSQL connection
-func (p *PostgreSQLConnector) Close() error {
+// Close closes the PostgreSQL connection pool, returning early when ctx is done before running statements finish
+func (p *PostgreSQLConnector) Close(ctx context.Context) error {
 	if p.db != nil {
-		return p.db.Close()
+		return closeContext(ctx, p.db.Close)
 	}
 	return nil
 }
 
+// Labels returns the labels of the connection
+func (p *PostgreSQLConnector) Labels() map[string]string {
+	return p.config.Labels
+}
+
 // GetType returns the database type
 func (p *PostgreSQLConnector) GetType() string {
 	return "postgresql"
@@ -83,11 +125,21 @@ func (p *PostgreSQLConnector) Query(ctx context.Context, query string, args ...i
 	if p.db == nil {
 		return nil, fmt.Errorf("PostgreSQL connection not established")
 	}
-	return p.db.QueryContext(ctx, query, args...)
+	stmt := p.statements.beginSQL(p.logger, p.config.Labels, "query", query, len(args))
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	// Rows are read after Query returns, so the duration is that of the first response and the count is unknown
+	stmt.end(ctx, -1, err)
+	return rows, p.observe(err)
 }
 
 // Execute runs a command/query (for compatibility with interface)
 func (p *PostgreSQLConnector) Execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
+	result, err := p.execute(ctx, operation, params)
+	return result, p.observe(err)
+}
+
+// execute runs the operation of Execute
+func (p *PostgreSQLConnector) execute(ctx context.Context, operation string, params map[string]interface{}) (interface{}, error) {
 	if p.db == nil {
 		return nil, fmt.Errorf("PostgreSQL connection not established")
 	}
@@ -99,7 +151,9 @@ func (p *PostgreSQLConnector) Execute(ctx context.Context, operation string, par
 			if argsList, ok := params["args"].([]interface{}); ok {
 				args = argsList
 			}
+			stmt := p.statements.beginSQL(p.logger, p.config.Labels, operation, query, len(args))
 			result, err := p.db.ExecContext(ctx, query, args...)
+			stmt.end(ctx, sqlResultRows(result), err)
 			if err != nil {
 				return nil, err
 			}
@@ -115,19 +169,92 @@ func (p *PostgreSQLConnector) Execute(ctx context.Context, operation string, par
 			return p.Query(ctx, query, args...)
 		}
 		return nil, fmt.Errorf("query parameter required for operation: %s", operation)
+	case "call":
+		if routine, ok := params["routine"].(string); ok {
+			routineType, _ := params["routine_type"].(string)
+			if routineType == "" {
+				routineType = RoutineProcedure
+			}
+			args, _ := params["args"].([]interface{})
+			return p.call(ctx, routine, routineType, args)
+		}
+		return nil, fmt.Errorf("routine parameter required for operation: %s", operation)
 	default:
-		return nil, fmt.Errorf("unsupported operation: %s", operation)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedOperation, operation)
 	}
 }
 
+// DB returns the underlying PostgreSQL connection pool
+func (p *PostgreSQLConnector) DB() *sql.DB {
+	return p.db
+}
+
+// Dialect returns the SQL dialect of the connector
+func (p *PostgreSQLConnector) Dialect() Dialect {
+	return PostgreSQLDialect{}
+}
+
 // IsConnected returns whether the connection is active
-func (p *PostgreSQLConnector) IsConnected() bool {
+func (p *PostgreSQLConnector) IsConnected(ctx context.Context) bool {
 	if p.db == nil {
 		return false
 	}
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, p.probeTimeout)
 	defer cancel()
 	
 	return p.Ping(ctx) == nil
 }
+
+// GetServerInfo returns version and session details of the PostgreSQL server
+func (p *PostgreSQLConnector) GetServerInfo(ctx context.Context) (*ServerInfo, error) {
+	if p.db == nil {
+		return nil, fmt.Errorf("PostgreSQL connection not established")
+	}
+
+	info := &ServerInfo{Pool: defaultPoolSettings()}
+	row := p.db.QueryRowContext(ctx, "SELECT version(), current_user, current_setting('TimeZone')")
+	if err := row.Scan(&info.Version, &info.CurrentUser, &info.TimeZone); err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL server info: %w", err)
+	}
+
+	// pg_stat_ssl may be unreadable for unprivileged users, in which case TLS is reported as off
+	var ssl bool
+	if err := p.db.QueryRowContext(ctx, "SELECT ssl FROM pg_stat_ssl WHERE pid = pg_backend_pid()").Scan(&ssl); err == nil {
+		info.TLS = ssl
+	}
+
+	return info, nil
+}
+
+// Listen passes the notifications sent to channel with NOTIFY to handle until ctx is done. It listens on
+// a connection of its own, which is reestablished whenever it is lost; handle then receives a
+// notification marked Resync, as notifications sent in between are lost.
+func (p *PostgreSQLConnector) Listen(ctx context.Context, channel string, handle func(Notification)) error {
+	if err := p.config.CheckURI("postgresql"); err != nil {
+		return err
+	}
+	listener := p.newListener(p.dsn(), func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			p.logger.Warn("listener disconnected", "channel", channel, "error", err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			p.logger.Warn("listener failed to connect", "channel", channel, "error", err)
+		case pq.ListenerEventReconnected:
+			p.logger.Info("listener reconnected", "channel", channel)
+		}
+	})
+	defer listener.Close()
+	// Listen blocks until the listener connects, so closing it is what stops waiting once ctx is done
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+
+	if err := listener.Listen(channel); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+	p.logger.DebugContext(ctx, "listening", "channel", channel)
+	return listen(ctx, listener, channel, handle)
+}
@@ -112,7 +112,8 @@ func TestPostgreSQLConnectionString(t *testing.T) {
 				Database: "testdb",
 				SSLMode:  "disable",
 			},
-			expected: "host=localhost port=5432 user=postgres password= dbname=testdb sslmode=disable",
+			// Unquoted, the empty password would take the next pair as its value
+			expected: "host=localhost port=5432 user=postgres password='' dbname=testdb sslmode=disable",
 		},
 	}
 
@@ -295,13 +296,13 @@ func (suite *PostgreSQLConnectorTestSuite) TestPingError() {
 // TestIsConnected tests the IsConnected method
 func (suite *PostgreSQLConnectorTestSuite) TestIsConnected() {
 	// Without connection
-	assert.False(suite.T(), suite.connector.IsConnected())
+	assert.False(suite.T(), suite.connector.IsConnected(context.Background()))
 
 	// With mock connection
 	suite.connector.db = suite.db
 	suite.mock.ExpectPing()
 	
-	assert.True(suite.T(), suite.connector.IsConnected())
+	assert.True(suite.T(), suite.connector.IsConnected(context.Background()))
 	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
 }
 
@@ -313,7 +314,7 @@ func (suite *PostgreSQLConnectorTestSuite) TestClose() {
 	// Set up expectation for close
 	suite.mock.ExpectClose()
 
-	err := suite.connector.Close()
+	err := suite.connector.Close(context.Background())
 
 	assert.NoError(suite.T(), err)
 	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
@@ -439,3 +440,14 @@ func BenchmarkPostgreSQLGetType(b *testing.B) {
 		_ = connector.GetType()
 	}
 }
+
+func TestPostgreSQLSearchPath(t *testing.T) {
+	config := &ConnectionConfig{Host: "db", Port: 5432, Username: "app", Password: "secret", Database: "app"}
+	assert.NotContains(t, NewPostgreSQLConnector(config).dsn(), "search_path")
+
+	config.Schema = "billing"
+	assert.Contains(t, NewPostgreSQLConnector(config).dsn(), " dbname=app ")
+	assert.Contains(t, NewPostgreSQLConnector(config).dsn(), " search_path=billing")
+	// MySQL's schema is the database it connects to
+	assert.NotContains(t, NewMySQLConnector(config).dsn(), "billing")
+}
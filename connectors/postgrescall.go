@@ -0,0 +1,223 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Routine types of the PostgreSQL call operation
+const (
+	RoutineProcedure = "procedure"
+	RoutineFunction  = "function"
+)
+
+// maxRoutineSuggestions bounds the similarly named routines a RoutineNotFoundError lists
+const maxRoutineSuggestions = 5
+
+// RoutineNotFoundError is returned by the PostgreSQL call operation when no routine of the requested type
+// has the name called, listing the similarly named routines the caller may have meant
+type RoutineNotFoundError struct {
+	Routine     string   // As called, schema-qualified when the call was
+	Type        string   // RoutineProcedure or RoutineFunction
+	OtherType   bool     // A routine of the other type has the name
+	Suggestions []string // Similarly named routines of the type, closest first
+}
+
+func (e *RoutineNotFoundError) Error() string {
+	message := fmt.Sprintf("%s %s does not exist", e.Type, e.Routine)
+	if e.OtherType {
+		other := RoutineFunction
+		if e.Type == RoutineFunction {
+			other = RoutineProcedure
+		}
+		return fmt.Sprintf("%s; it is a %s, call it with routine_type %s", message, other, other)
+	}
+	if len(e.Suggestions) > 0 {
+		message += "; did you mean " + strings.Join(e.Suggestions, ", ") + "?"
+	}
+	return message
+}
+
+// Unwrap makes a missing routine match ErrNotFound
+func (e *RoutineNotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// call invokes a stored procedure or function with args bound positionally, after checking that it exists.
+// A procedure returns its OUT parameters as a single row and a function the rows it returns.
+func (p *PostgreSQLConnector) call(ctx context.Context, routine, routineType string, args []interface{}) (*CallResult, error) {
+	if routineType != RoutineProcedure && routineType != RoutineFunction {
+		return nil, fmt.Errorf("routine_type must be %s or %s, got %q", RoutineProcedure, RoutineFunction, routineType)
+	}
+	schema, name := splitRoutineName(routine)
+	if err := p.checkRoutine(ctx, schema, name, routineType); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	query := routineStatement(schema, name, routineType, len(args))
+	stmt := p.statements.beginSQL(p.logger, p.config.Labels, "call", query, len(args))
+	result, rowCount, err := readResultSets(ctx, cancel, p.db, query, args)
+	stmt.end(ctx, rowCount, err)
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = []SQLWarning{}
+	return result, nil
+}
+
+// splitRoutineName splits a routine called as schema.name; a name without a schema is looked up in the
+// schemas of the search path
+func splitRoutineName(routine string) (schema, name string) {
+	if schema, name, ok := strings.Cut(routine, "."); ok {
+		return schema, name
+	}
+	return "", routine
+}
+
+// routineStatement returns the statement invoking a routine with n args bound positionally: CALL for a
+// procedure and SELECT * FROM for a function, so that the columns of either are those of its result
+func routineStatement(schema, name, routineType string, n int) string {
+	d := PostgreSQLDialect{}
+	target := d.QuoteIdent(name)
+	if schema != "" {
+		target = d.QuoteIdent(schema) + "." + target
+	}
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = d.Placeholder(i + 1)
+	}
+	invocation := target + "(" + strings.Join(placeholders, ", ") + ")"
+	if routineType == RoutineFunction {
+		return "SELECT * FROM " + invocation
+	}
+	return "CALL " + invocation
+}
+
+// checkRoutine returns a *RoutineNotFoundError unless a routine of the type is named name in schema, or in
+// the search path when schema is empty. Only the routines the user may see are listed by
+// information_schema, so a routine the user has no privilege on is reported missing too.
+func (p *PostgreSQLConnector) checkRoutine(ctx context.Context, schema, name, routineType string) error {
+	scope, scopeArgs := routineScope(schema)
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT DISTINCT lower(routine_type) FROM information_schema.routines WHERE routine_name = $1 AND "+scope,
+		append([]interface{}{name}, scopeArgs...)...)
+	if err != nil {
+		return fmt.Errorf("failed to look up routine %s: %w", name, err)
+	}
+	types, err := scanStrings(rows)
+	if err != nil {
+		return fmt.Errorf("failed to look up routine %s: %w", name, err)
+	}
+	notFound := &RoutineNotFoundError{Routine: name, Type: routineType, Suggestions: []string{}}
+	if schema != "" {
+		notFound.Routine = schema + "." + name
+	}
+	for _, t := range types {
+		if t == routineType {
+			return nil
+		}
+		notFound.OtherType = true
+	}
+	if notFound.OtherType {
+		return notFound
+	}
+
+	rows, err = p.db.QueryContext(ctx,
+		"SELECT DISTINCT routine_name FROM information_schema.routines WHERE lower(routine_type) = $1 AND "+scope,
+		append([]interface{}{routineType}, scopeArgs...)...)
+	if err != nil {
+		return fmt.Errorf("failed to list routines: %w", err)
+	}
+	names, err := scanStrings(rows)
+	if err != nil {
+		return fmt.Errorf("failed to list routines: %w", err)
+	}
+	for _, similar := range similarNames(name, names, maxRoutineSuggestions) {
+		if schema != "" {
+			similar = schema + "." + similar
+		}
+		notFound.Suggestions = append(notFound.Suggestions, similar)
+	}
+	return notFound
+}
+
+// routineScope returns the condition restricting information_schema.routines to schema, bound to $2, or to
+// the schemas of the search path when schema is empty, along with its args
+func routineScope(schema string) (string, []interface{}) {
+	if schema == "" {
+		return "routine_schema::text = ANY(current_schemas(false)::text[])", nil
+	}
+	return "routine_schema = $2", []interface{}{schema}
+}
+
+// scanStrings reads the single string column of rows, closing them
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// similarNames returns up to limit of the candidates that name is a misspelling of, ignoring case: those a
+// few edits away and those containing name, closest first
+func similarNames(name string, candidates []string, limit int) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+	target := strings.ToLower(name)
+	maxDistance := max(2, len([]rune(target))/3)
+	var matches []match
+	for _, candidate := range candidates {
+		lower := strings.ToLower(candidate)
+		distance := editDistance(target, lower)
+		if distance <= maxDistance || strings.Contains(lower, target) {
+			matches = append(matches, match{candidate, distance})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+	names := make([]string, 0, min(len(matches), limit))
+	for _, m := range matches[:min(len(matches), limit)] {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// editDistance returns the Levenshtein distance between a and b: the fewest characters inserted, deleted or
+// substituted to turn one into the other
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
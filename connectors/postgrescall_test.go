@@ -0,0 +1,108 @@
+package connectors
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRoutineConnector returns a PostgreSQL connector running its statements on a sqlmock database
+func newRoutineConnector(t *testing.T) (*PostgreSQLConnector, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	connector := NewPostgreSQLConnector(&ConnectionConfig{Host: "localhost", Port: 5432, Database: "shop"})
+	connector.db = db
+	return connector, mock
+}
+
+func TestRoutineStatement(t *testing.T) {
+	assert.Equal(t, `CALL "billing"."close_month"($1, $2)`, routineStatement("billing", "close_month", RoutineProcedure, 2))
+	assert.Equal(t, `SELECT * FROM "order_totals"($1)`, routineStatement("", "order_totals", RoutineFunction, 1))
+	assert.Equal(t, `CALL "refresh"()`, routineStatement("", "refresh", RoutineProcedure, 0))
+	// Names are quoted, so they cannot close the call early
+	assert.Equal(t, `CALL "x""(); DROP TABLE t; --"()`, routineStatement("", `x"(); DROP TABLE t; --`, RoutineProcedure, 0))
+}
+
+func TestSimilarNames(t *testing.T) {
+	candidates := []string{"close_month", "close_months_v2", "CloseMonth", "open_month", "refresh_orders", "close_year"}
+	assert.Equal(t, []string{"close_month", "CloseMonth"}, similarNames("clse_month", candidates, 5))
+	assert.Equal(t, []string{"close_month", "close_months_v2"}, similarNames("close_month", candidates[:2], 5))
+	assert.Equal(t, []string{"refresh_orders"}, similarNames("refresh", candidates, 5))
+	assert.Equal(t, []string{"close_month"}, similarNames("clse_month", candidates, 1))
+	assert.Empty(t, similarNames("reconcile", candidates, 5))
+
+	assert.Equal(t, 0, editDistance("month", "month"))
+	assert.Equal(t, 1, editDistance("clse", "close"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+	assert.Equal(t, 5, editDistance("", "héllo"))
+}
+
+func TestPostgreSQLCallProcedure(t *testing.T) {
+	connector, mock := newRoutineConnector(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DISTINCT lower(routine_type) FROM information_schema.routines WHERE routine_name = $1 AND routine_schema = $2")).
+		WithArgs("close_month", "billing").WillReturnRows(sqlmock.NewRows([]string{"lower"}).AddRow("procedure"))
+	// OUT parameters come back as a single row
+	mock.ExpectQuery(regexp.QuoteMeta(`CALL "billing"."close_month"($1, $2)`)).WithArgs("2024-05", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"closed"}).AddRow(int64(42)))
+
+	result, err := connector.Execute(context.Background(), "call", map[string]interface{}{
+		"routine": "billing.close_month",
+		"args":    []interface{}{"2024-05", nil},
+	})
+	require.NoError(t, err)
+	called := result.(*CallResult)
+	require.Len(t, called.ResultSets, 1)
+	assert.Equal(t, []map[string]interface{}{{"closed": int64(42)}}, called.ResultSets[0].Rows)
+	assert.Empty(t, called.Warnings)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLCallFunction(t *testing.T) {
+	connector, mock := newRoutineConnector(t)
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE routine_name = $1 AND routine_schema::text = ANY(current_schemas(false)::text[])")).
+		WithArgs("order_totals").WillReturnRows(sqlmock.NewRows([]string{"lower"}).AddRow("function"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "order_totals"($1)`)).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "total"}).AddRow("2024-05-01", 10.5).AddRow("2024-05-02", 3.25))
+
+	called, err := connector.call(context.Background(), "order_totals", RoutineFunction, []interface{}{int64(7)})
+	require.NoError(t, err)
+	require.Len(t, called.ResultSets, 1)
+	assert.Len(t, called.ResultSets[0].Rows, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLCallRoutineNotFound(t *testing.T) {
+	connector, mock := newRoutineConnector(t)
+	mock.ExpectQuery("SELECT DISTINCT lower\\(routine_type\\)").WithArgs("clse_month", "billing").
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DISTINCT routine_name FROM information_schema.routines WHERE lower(routine_type) = $1 AND routine_schema = $2")).
+		WithArgs("procedure", "billing").
+		WillReturnRows(sqlmock.NewRows([]string{"routine_name"}).AddRow("close_months").AddRow("close_month").AddRow("audit"))
+
+	_, err := connector.call(context.Background(), "billing.clse_month", RoutineProcedure, nil)
+	var notFound *RoutineNotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, []string{"billing.close_month", "billing.close_months"}, notFound.Suggestions)
+	assert.EqualError(t, err, "procedure billing.clse_month does not exist; did you mean billing.close_month, billing.close_months?")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLCallWrongRoutineType(t *testing.T) {
+	connector, mock := newRoutineConnector(t)
+	mock.ExpectQuery("SELECT DISTINCT lower\\(routine_type\\)").WithArgs("order_totals").
+		WillReturnRows(sqlmock.NewRows([]string{"lower"}).AddRow("function"))
+
+	// The other type is named rather than listing suggestions, and nothing runs
+	_, err := connector.call(context.Background(), "order_totals", RoutineProcedure, nil)
+	assert.EqualError(t, err, "procedure order_totals does not exist; it is a function, call it with routine_type function")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = connector.call(context.Background(), "order_totals", "trigger", nil)
+	assert.EqualError(t, err, `routine_type must be procedure or function, got "trigger"`)
+}
@@ -0,0 +1,54 @@
+package connectors
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// AuthWatcher is implemented by connectors that notice when the database rejects their credentials. Once a
+// password is rotated, a pool keeps working on the connections it already has and fails as it dials new
+// ones with the old credentials, so the connector needs rebuilding with the current ones.
+type AuthWatcher interface {
+	DBConnector
+
+	// NeedsReauth reports whether the database rejected the credentials of the connector as it connected
+	NeedsReauth() bool
+}
+
+// authFailures marks a connector as needing re-authentication once the database rejects its credentials.
+// The mark stays, as the connector's credentials do.
+type authFailures struct {
+	failed atomic.Bool
+}
+
+// observe marks the connector when err is a rejection of its credentials, returning err
+func (f *authFailures) observe(err error) error {
+	if IsCredentialFailure(err) {
+		f.failed.Store(true)
+	}
+	return err
+}
+
+// NeedsReauth reports whether the database rejected the credentials of the connector as it connected
+func (f *authFailures) NeedsReauth() bool {
+	return f.failed.Load()
+}
+
+// IsCredentialFailure reports whether err is MySQL's 1045 or PostgreSQL's 28P01 or 28000, which only the
+// handshake of a new connection returns, whether the pool dials it for a ping or for a statement. Statements
+// the database refuses to an authenticated user, such as USE of a database it may not access (1044), leave
+// the credentials trusted, so a client cannot make every request rebuild the pool.
+func IsCredentialFailure(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrAccessDenied
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pqErrInvalidPassword || pqErr.Code == pqErrInvalidAuthorization
+	}
+	return false
+}
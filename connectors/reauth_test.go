@@ -0,0 +1,54 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLNeedsReauth(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+	connector := NewMySQLConnector(&ConnectionConfig{Host: "localhost", Port: 3306, Database: "shop"})
+	connector.db = db
+	var _ AuthWatcher = connector
+
+	// Other failures leave the credentials trusted
+	mock.ExpectQuery("SELECT 1").WillReturnError(errors.New("connection reset by peer"))
+	_, err = connector.Query(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	assert.False(t, connector.NeedsReauth())
+
+	// So do statements refused to the authenticated user, which any client can send
+	mock.ExpectQuery("SHOW TABLES FROM otherdb").WillReturnError(&mysql.MySQLError{Number: 1044, Message: "Access denied for user 'app'@'%' to database 'otherdb'"})
+	_, err = connector.Query(context.Background(), "SHOW TABLES FROM otherdb")
+	require.Error(t, err)
+	assert.False(t, connector.NeedsReauth())
+
+	denied := &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'app'@'%'"}
+	mock.ExpectExec("DELETE FROM orders").WillReturnError(denied)
+	_, err = connector.Execute(context.Background(), "delete", map[string]interface{}{"query": "DELETE FROM orders"})
+	assert.ErrorIs(t, err, denied)
+	assert.True(t, connector.NeedsReauth())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLNeedsReauth(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+	connector := NewPostgreSQLConnector(&ConnectionConfig{Host: "localhost", Port: 5432, Database: "shop"})
+	connector.db = db
+
+	mock.ExpectPing().WillReturnError(&pq.Error{Code: "28P01", Message: "password authentication failed for user \"app\""})
+	assert.Error(t, connector.Ping(context.Background()))
+	assert.True(t, connector.NeedsReauth())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
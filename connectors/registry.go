@@ -0,0 +1,235 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrConnectorNotFound is returned for names that are not in a ConnectorRegistry
+var ErrConnectorNotFound = errors.New("connector not found")
+
+// ConnectorRecord is a registered connector together with its registry metadata
+type ConnectorRecord struct {
+	Name         string
+	Connector    DBConnector
+	Host         string // Connection target without credentials; empty when not registered with a config
+	Port         int
+	Database     string
+	URI          string // Connection URI with its password redacted
+	Labels       map[string]string
+	RegisteredAt time.Time
+	LastPing     time.Time // Last successful ping; zero until one succeeds
+
+	LastKeepAlive  time.Time // Last keepalive ping, whether it succeeded or not; zero until one runs
+	KeepAliveError string    // Error of the last keepalive ping; empty while the connector is healthy
+	UnhealthySince time.Time // When a keepalive ping or the circuit breaker last found the connector unhealthy; zero while healthy
+}
+
+// HealthChange reports a registered connector turning unhealthy, or healthy again
+type HealthChange struct {
+	Name    string
+	Type    string
+	Labels  map[string]string
+	Healthy bool
+	Err     error // Why the connector turned unhealthy; nil when it is healthy again
+	At      time.Time
+}
+
+// ConnectorRegistry manages all available database connectors
+type ConnectorRegistry struct {
+	mu         sync.RWMutex
+	connectors map[string]*ConnectorRecord
+	now        func() time.Time
+	onHealth   func(HealthChange) // Called outside the lock with each change of health; nil calls nothing
+}
+
+// NewConnectorRegistry creates a new connector registry
+func NewConnectorRegistry() *ConnectorRegistry {
+	return &ConnectorRegistry{
+		connectors: make(map[string]*ConnectorRecord),
+		now:        time.Now,
+	}
+}
+
+// Register adds a connector to the registry
+func (cr *ConnectorRegistry) Register(name string, connector DBConnector) {
+	cr.RegisterWithConfig(name, connector, nil)
+}
+
+// RegisterWithConfig adds a connector along with the configuration it connects with;
+// only the host, port, database, redacted URI and labels are kept
+func (cr *ConnectorRegistry) RegisterWithConfig(name string, connector DBConnector, config *ConnectionConfig) {
+	record := &ConnectorRecord{Name: name, Connector: connector, RegisteredAt: cr.now()}
+	if config != nil {
+		record.Host, record.Port, record.Database = config.Host, config.Port, config.Database
+		record.URI = config.RedactedURI()
+		record.Labels = config.Labels
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.connectors[name] = record
+}
+
+// Replace swaps the connector of a registered name for a rebuilt one, keeping the rest of its record, and
+// returns the connector it replaced for the caller to close
+func (cr *ConnectorRegistry) Replace(name string, connector DBConnector) (DBConnector, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	record, exists := cr.connectors[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrConnectorNotFound, name)
+	}
+	replaced := record.Connector
+	record.Connector = connector
+	return replaced, nil
+}
+
+// Get retrieves a connector by name
+func (cr *ConnectorRegistry) Get(name string) (DBConnector, bool) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	record, exists := cr.connectors[name]
+	if !exists {
+		return nil, false
+	}
+	return record.Connector, true
+}
+
+// List returns all registered connector names in sorted order
+func (cr *ConnectorRegistry) List() []string {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	names := make([]string, 0, len(cr.connectors))
+	for name := range cr.connectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Records returns a copy of every registered connector's record, sorted by name
+func (cr *ConnectorRegistry) Records() []ConnectorRecord {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	records := make([]ConnectorRecord, 0, len(cr.connectors))
+	for _, record := range cr.connectors {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records
+}
+
+// Record returns a copy of the named connector's record
+func (cr *ConnectorRegistry) Record(name string) (ConnectorRecord, bool) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	record, exists := cr.connectors[name]
+	if !exists {
+		return ConnectorRecord{}, false
+	}
+	return *record, true
+}
+
+// MarkPinged records a successful ping of the named connector
+func (cr *ConnectorRegistry) MarkPinged(name string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if record, exists := cr.connectors[name]; exists {
+		record.LastPing = cr.now()
+	}
+}
+
+// MarkKeepAlive records a keepalive ping of the named connector, which marks it unhealthy when err is set
+// and healthy again once a ping succeeds
+func (cr *ConnectorRegistry) MarkKeepAlive(name string, err error) {
+	cr.mu.Lock()
+	record, exists := cr.connectors[name]
+	if !exists {
+		cr.mu.Unlock()
+		return
+	}
+	record.LastKeepAlive = cr.now()
+	record.KeepAliveError = ""
+	if err != nil {
+		record.KeepAliveError = err.Error()
+	} else {
+		record.LastPing = record.LastKeepAlive
+	}
+	change, changed := cr.markHealth(record, err)
+	cr.mu.Unlock()
+	if changed {
+		cr.healthChanged(change)
+	}
+}
+
+// MarkHealth marks the named connector unhealthy when err is set and healthy otherwise, as its circuit
+// breaker opens and closes. Unknown names are ignored.
+func (cr *ConnectorRegistry) MarkHealth(name string, err error) {
+	cr.mu.Lock()
+	record, exists := cr.connectors[name]
+	if !exists {
+		cr.mu.Unlock()
+		return
+	}
+	change, changed := cr.markHealth(record, err)
+	cr.mu.Unlock()
+	if changed {
+		cr.healthChanged(change)
+	}
+}
+
+// markHealth updates the health of record, reporting whether it changed; callers hold the lock
+func (cr *ConnectorRegistry) markHealth(record *ConnectorRecord, err error) (HealthChange, bool) {
+	healthy := err == nil
+	if healthy == record.UnhealthySince.IsZero() {
+		return HealthChange{}, false
+	}
+	now := cr.now()
+	if healthy {
+		record.UnhealthySince = time.Time{}
+	} else {
+		record.UnhealthySince = now
+	}
+	return HealthChange{
+		Name:    record.Name,
+		Type:    record.Connector.GetType(),
+		Labels:  record.Labels,
+		Healthy: healthy,
+		Err:     err,
+		At:      now,
+	}, true
+}
+
+// OnHealthChange sets the function called with each change of health of a registered connector
+func (cr *ConnectorRegistry) OnHealthChange(fn func(HealthChange)) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.onHealth = fn
+}
+
+// healthChanged passes a change of health on to the function set by OnHealthChange
+func (cr *ConnectorRegistry) healthChanged(change HealthChange) {
+	cr.mu.RLock()
+	fn := cr.onHealth
+	cr.mu.RUnlock()
+	if fn != nil {
+		fn(change)
+	}
+}
+
+// Remove closes the named connector and evicts it from the registry. The connector is evicted
+// even when closing it fails; ErrConnectorNotFound is returned for unknown names. ctx bounds the close.
+func (cr *ConnectorRegistry) Remove(ctx context.Context, name string) error {
+	cr.mu.Lock()
+	record, exists := cr.connectors[name]
+	delete(cr.connectors, name)
+	cr.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrConnectorNotFound, name)
+	}
+	return record.Connector.Close(ctx)
+}
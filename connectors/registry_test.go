@@ -0,0 +1,162 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closingConnector records whether Close was called
+type closingConnector struct {
+	stubConnector
+	closed   bool
+	closeErr error
+}
+
+func (c *closingConnector) Close(ctx context.Context) error {
+	c.closed = true
+	return c.closeErr
+}
+
+func TestConnectorRegistryRecords(t *testing.T) {
+	registry := NewConnectorRegistry()
+	registeredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	registry.now = func() time.Time { return registeredAt }
+
+	registry.RegisterWithConfig("reporting", &stubConnector{}, &ConnectionConfig{
+		Host:     "mysql.internal",
+		Port:     3306,
+		Username: "report",
+		Password: "secret",
+		Database: "reports",
+		Labels:   map[string]string{"team": "finance"},
+	})
+	registry.Register("cache", &stubConnector{})
+	assert.Equal(t, []string{"cache", "reporting"}, registry.List())
+
+	records := registry.Records()
+	require.Len(t, records, 2)
+	assert.Equal(t, "cache", records[0].Name)
+	assert.Empty(t, records[0].Host)
+	assert.Equal(t, "mysql.internal", records[1].Host)
+	assert.Equal(t, 3306, records[1].Port)
+	assert.Equal(t, "reports", records[1].Database)
+	assert.Empty(t, records[1].URI)
+	assert.Equal(t, map[string]string{"team": "finance"}, records[1].Labels)
+	assert.Equal(t, registeredAt, records[1].RegisteredAt)
+	assert.True(t, records[1].LastPing.IsZero())
+
+	pingedAt := registeredAt.Add(time.Minute)
+	registry.now = func() time.Time { return pingedAt }
+	registry.MarkPinged("reporting")
+	registry.MarkPinged("unknown")
+	record, ok := registry.Record("reporting")
+	require.True(t, ok)
+	assert.Equal(t, pingedAt, record.LastPing)
+
+	// Records are copies
+	records[1].Host = "changed"
+	record, _ = registry.Record("reporting")
+	assert.Equal(t, "mysql.internal", record.Host)
+
+	_, ok = registry.Record("unknown")
+	assert.False(t, ok)
+}
+
+func TestConnectorRegistryKeepAlive(t *testing.T) {
+	registry := NewConnectorRegistry()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+	registry.Register("primary", &stubConnector{})
+
+	registry.MarkKeepAlive("primary", errors.New("invalid connection"))
+	record, _ := registry.Record("primary")
+	assert.Equal(t, now, record.LastKeepAlive)
+	assert.Equal(t, "invalid connection", record.KeepAliveError)
+	assert.True(t, record.LastPing.IsZero(), "a failed keepalive is not a successful ping")
+
+	now = now.Add(time.Minute)
+	registry.MarkKeepAlive("primary", nil)
+	registry.MarkKeepAlive("unknown", nil)
+	record, _ = registry.Record("primary")
+	assert.Equal(t, now, record.LastKeepAlive)
+	assert.Equal(t, now, record.LastPing)
+	assert.Empty(t, record.KeepAliveError)
+}
+
+func TestConnectorRegistryHealthChanges(t *testing.T) {
+	registry := NewConnectorRegistry()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+	registry.RegisterWithConfig("primary", &stubConnector{}, &ConnectionConfig{Labels: map[string]string{"team": "payments"}})
+	var changes []HealthChange
+	registry.OnHealthChange(func(change HealthChange) { changes = append(changes, change) })
+
+	// Only changes of health are reported, whether seen by keepalive pings or the circuit breaker
+	down := errors.New("connection refused")
+	registry.MarkKeepAlive("primary", nil)
+	registry.MarkKeepAlive("primary", down)
+	registry.MarkHealth("primary", down)
+	record, _ := registry.Record("primary")
+	assert.Equal(t, now, record.UnhealthySince)
+
+	now = now.Add(time.Minute)
+	registry.MarkHealth("primary", nil)
+	registry.MarkKeepAlive("primary", nil)
+	registry.MarkHealth("unknown", down)
+	record, _ = registry.Record("primary")
+	assert.True(t, record.UnhealthySince.IsZero())
+
+	require.Len(t, changes, 2)
+	assert.Equal(t, HealthChange{Name: "primary", Type: "stub", Labels: map[string]string{"team": "payments"}, Err: down, At: now.Add(-time.Minute)}, changes[0])
+	assert.True(t, changes[1].Healthy)
+	assert.NoError(t, changes[1].Err)
+	assert.Equal(t, now, changes[1].At)
+}
+
+func TestConnectorRegistryRemove(t *testing.T) {
+	registry := NewConnectorRegistry()
+	connector := &closingConnector{}
+	registry.Register("primary", connector)
+
+	require.NoError(t, registry.Remove(context.Background(), "primary"))
+	assert.True(t, connector.closed)
+	_, exists := registry.Get("primary")
+	assert.False(t, exists)
+
+	err := registry.Remove(context.Background(), "primary")
+	assert.True(t, errors.Is(err, ErrConnectorNotFound))
+
+	// A connector that fails to close is evicted anyway
+	failing := &closingConnector{closeErr: errors.New("close failed")}
+	registry.Register("failing", failing)
+	assert.EqualError(t, registry.Remove(context.Background(), "failing"), "close failed")
+	assert.Empty(t, registry.List())
+}
+
+func TestConnectorRegistryReplace(t *testing.T) {
+	registry := NewConnectorRegistry()
+	old, rebuilt := &closingConnector{}, &closingConnector{}
+	registry.RegisterWithConfig("primary", old, &ConnectionConfig{Host: "db", Port: 3306})
+	registry.MarkPinged("primary")
+	before, _ := registry.Record("primary")
+
+	replaced, err := registry.Replace("primary", rebuilt)
+	require.NoError(t, err)
+	assert.Same(t, old, replaced)
+	assert.False(t, old.closed)
+
+	// The record keeps its metadata
+	after, _ := registry.Record("primary")
+	assert.Same(t, rebuilt, after.Connector)
+	assert.Equal(t, "db", after.Host)
+	assert.Equal(t, before.RegisteredAt, after.RegisteredAt)
+	assert.Equal(t, before.LastPing, after.LastPing)
+
+	_, err = registry.Replace("unknown", rebuilt)
+	assert.ErrorIs(t, err, ErrConnectorNotFound)
+}
@@ -0,0 +1,93 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ResultSet is one of the results returned by a statement, such as each SELECT run by a stored procedure
+type ResultSet struct {
+	Columns []*sql.ColumnType
+	Rows    []map[string]interface{}
+}
+
+// SQLWarning is a note, warning or error the server raised while running a statement, as listed by
+// SHOW WARNINGS
+type SQLWarning struct {
+	Level   string `json:"level"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// CallResult is the result of the call operation: every result set the routine returned, in order, and the
+// warnings it raised, which only MySQL reports
+type CallResult struct {
+	ResultSets []ResultSet
+	Warnings   []SQLWarning
+}
+
+// sqlQuerier is satisfied by *sql.DB, *sql.Conn and *sql.Tx
+type sqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// readResultSets runs query on db and reads every result set it returns, along with the rows read in all.
+// Rows going over the result size limit call cancel, so that the server stops producing the rest.
+func readResultSets(ctx context.Context, cancel context.CancelFunc, db sqlQuerier, query string, args []interface{}) (*CallResult, int64, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer rows.Close()
+
+	size := NewResultSize(MaxResultBytesFromContext(ctx))
+	result := &CallResult{ResultSets: []ResultSet{}}
+	var count int64
+	for {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return nil, count, err
+		}
+		// Statements without rows, such as the status a procedure returns last, have no columns
+		if len(types) > 0 {
+			set := ResultSet{Columns: types, Rows: []map[string]interface{}{}}
+			for rows.Next() {
+				row, err := scanRow(rows, types)
+				if err != nil {
+					return nil, count, err
+				}
+				if err := size.Add(row); err != nil {
+					cancel()
+					return nil, count, err
+				}
+				set.Rows = append(set.Rows, row)
+				count++
+			}
+			result.ResultSets = append(result.ResultSets, set)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	return result, count, rows.Err()
+}
+
+// scanRow reads the current row as a column-name map, converting []byte values to strings
+func scanRow(rows *sql.Rows, types []*sql.ColumnType) (map[string]interface{}, error) {
+	values := make([]interface{}, len(types))
+	pointers := make([]interface{}, len(types))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	row := make(map[string]interface{}, len(types))
+	for i, t := range types {
+		if b, ok := values[i].([]byte); ok {
+			values[i] = string(b)
+		}
+		row[t.Name()] = values[i]
+	}
+	return row, nil
+}
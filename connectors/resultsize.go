@@ -0,0 +1,134 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ResultTooLargeError is returned when the rows of a query result grow past the size limit of its context
+type ResultTooLargeError struct {
+	Limit int64 // Bytes allowed
+	Rows  int   // Rows read, including the one going over the limit
+	Bytes int64 // Approximate JSON size of the rows read
+}
+
+func (e *ResultTooLargeError) Error() string {
+	return fmt.Sprintf("query result exceeds the limit of %d bytes: read %d rows of about %d bytes", e.Limit, e.Rows, e.Bytes)
+}
+
+type maxResultBytesKey struct{}
+
+// ContextWithMaxResultBytes returns a context limiting the results read with it to about limit bytes of
+// JSON; zero or less is unlimited
+func ContextWithMaxResultBytes(ctx context.Context, limit int64) context.Context {
+	return context.WithValue(ctx, maxResultBytesKey{}, limit)
+}
+
+// MaxResultBytesFromContext returns the result size limit of ctx, zero or less when results are unlimited
+func MaxResultBytesFromContext(ctx context.Context) int64 {
+	limit, _ := ctx.Value(maxResultBytesKey{}).(int64)
+	return limit
+}
+
+// ResultSize adds up the approximate JSON size of the rows of a result as they are read
+type ResultSize struct {
+	limit int64
+	rows  int
+	bytes int64
+}
+
+// NewResultSize returns a ResultSize allowing limit bytes; zero or less is unlimited
+func NewResultSize(limit int64) *ResultSize {
+	return &ResultSize{limit: limit}
+}
+
+// Add counts a row, returning a *ResultTooLargeError once the rows read exceed the limit
+func (s *ResultSize) Add(row map[string]interface{}) error {
+	s.rows++
+	s.bytes += encodedSize(row)
+	if s.limit > 0 && s.bytes > s.limit {
+		return &ResultTooLargeError{Limit: s.limit, Rows: s.rows, Bytes: s.bytes}
+	}
+	return nil
+}
+
+// encodedSize estimates the JSON size of a value without encoding the common types
+func encodedSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 4
+	case string:
+		return int64(len(v)) + 2
+	case []byte:
+		return int64(len(v))*4/3 + 4
+	case bool:
+		return 5
+	case int:
+		return int64(len(strconv.Itoa(v)))
+	case int32:
+		return int64(len(strconv.FormatInt(int64(v), 10)))
+	case int64:
+		return int64(len(strconv.FormatInt(v, 10)))
+	case float64:
+		return int64(len(strconv.FormatFloat(v, 'g', -1, 64)))
+	case time.Time:
+		return 32
+	case map[string]interface{}:
+		return mapSize(v)
+	case primitive.M:
+		return mapSize(v)
+	case []interface{}:
+		return sliceSize(v)
+	case primitive.A:
+		return sliceSize(v)
+	}
+	if encoded, err := json.Marshal(value); err == nil {
+		return int64(len(encoded))
+	}
+	return int64(len(fmt.Sprint(value)))
+}
+
+func mapSize(m map[string]interface{}) int64 {
+	size := int64(2)
+	for key, value := range m {
+		size += int64(len(key)) + 4 + encodedSize(value)
+	}
+	return size
+}
+
+func sliceSize(values []interface{}) int64 {
+	size := int64(2)
+	for _, value := range values {
+		size += encodedSize(value) + 1
+	}
+	return size
+}
+
+// readCursor decodes the documents of cursor up to the result size limit of ctx. The cursor is closed
+// either way, which stops the server producing the documents not read.
+func readCursor(ctx context.Context, cursor *mongo.Cursor) ([]map[string]interface{}, error) {
+	defer cursor.Close(context.Background())
+
+	size := NewResultSize(MaxResultBytesFromContext(ctx))
+	var results []map[string]interface{}
+	for cursor.Next(ctx) {
+		var doc map[string]interface{}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode results: %w", err)
+		}
+		if err := size.Add(doc); err != nil {
+			return nil, err
+		}
+		results = append(results, doc)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode results: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,83 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestResultSize(t *testing.T) {
+	size := NewResultSize(120)
+	row := map[string]interface{}{"id": 1, "name": strings.Repeat("x", 30)}
+	require.NoError(t, size.Add(row))
+	require.NoError(t, size.Add(row))
+
+	err := size.Add(row)
+	var tooLarge *ResultTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, &ResultTooLargeError{Limit: 120, Rows: 3, Bytes: 3 * encodedSize(row)}, tooLarge)
+
+	// Without a limit every row is accepted
+	unlimited := NewResultSize(0)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, unlimited.Add(row))
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	values := []interface{}{
+		nil,
+		"hello",
+		int64(42),
+		3.5,
+		true,
+		time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		map[string]interface{}{"a": "b", "n": []interface{}{1, 2, 3}},
+		primitive.M{"nested": primitive.M{"tags": primitive.A{"x", "y"}}},
+		struct {
+			Name string `json:"name"`
+		}{Name: "ada"},
+	}
+	for _, value := range values {
+		encoded, err := json.Marshal(value)
+		require.NoError(t, err)
+		// Estimates stay within a few bytes per value of the real encoding
+		assert.InDelta(t, len(encoded), encodedSize(value), 12, "%v", value)
+	}
+}
+
+func TestMaxResultBytesContext(t *testing.T) {
+	assert.Zero(t, MaxResultBytesFromContext(context.Background()))
+	assert.Equal(t, int64(4096), MaxResultBytesFromContext(ContextWithMaxResultBytes(context.Background(), 4096)))
+}
+
+func TestReadCursor(t *testing.T) {
+	docs := make([]interface{}, 1000)
+	for i := range docs {
+		docs[i] = bson.M{"i": int32(i), "payload": strings.Repeat("x", 80)}
+	}
+
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	require.NoError(t, err)
+	results, err := readCursor(context.Background(), cursor)
+	require.NoError(t, err)
+	assert.Len(t, results, 1000)
+	assert.Equal(t, int32(999), results[999]["i"])
+
+	cursor, err = mongo.NewCursorFromDocuments(docs, nil, nil)
+	require.NoError(t, err)
+	_, err = readCursor(ContextWithMaxResultBytes(context.Background(), 1000), cursor)
+	var tooLarge *ResultTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, 10, tooLarge.Rows)
+	// Reading stopped at the limit and the cursor was closed
+	assert.False(t, cursor.Next(context.Background()))
+}
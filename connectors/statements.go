@@ -0,0 +1,269 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"db-connectors/logging"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultSlowStatementThreshold is how long a statement runs before it is logged as slow
+const DefaultSlowStatementThreshold = time.Second
+
+// maxStatementText is the longest statement text logged; longer statements are truncated
+const maxStatementText = 1000
+
+// maxStatementSeries bounds the label combinations statements are counted by; statements of further
+// combinations are only counted in the totals
+const maxStatementSeries = 100
+
+// StatementStats counts the statements run through connectors sharing a StatementLogger
+type StatementStats struct {
+	Statements      int64             `json:"statements"`
+	Failed          int64             `json:"failed"`
+	Slow            int64             `json:"slow"`                        // Ran for longer than the slow threshold
+	SlowestMs       int64             `json:"slowest_ms"`                  // Longest statement so far
+	SlowThresholdMs int64             `json:"slow_threshold_ms,omitempty"` // Zero when slow statements are not reported
+	Series          []StatementSeries `json:"series,omitempty"`            // Counts by the values of the metric labels
+}
+
+// StatementSeries counts the statements of connections sharing the values of the metric labels
+type StatementSeries struct {
+	Labels     map[string]string `json:"labels"` // Metric labels the connections have
+	Statements int64             `json:"statements"`
+	Failed     int64             `json:"failed"`
+	Slow       int64             `json:"slow"`
+	SlowestMs  int64             `json:"slowest_ms"`
+}
+
+// StatementLogOptions configures a StatementLogger
+type StatementLogOptions struct {
+	SlowThreshold time.Duration // Zero keeps DefaultSlowStatementThreshold; negative reports no statement as slow
+	HideText      bool          // Leave SQL text out of the logs
+	// Connection labels the counters are broken down by. Only these keys become metric labels, bounding
+	// the series to the combinations of their values.
+	MetricLabels []string
+}
+
+// StatementLogger logs the statements connectors run with their durations, rows and errors: every
+// statement at debug level, and those running longer than the slow threshold at warn level. Statement
+// text is logged without argument values, with credentials redacted, and can be left out entirely.
+type StatementLogger struct {
+	slowThreshold time.Duration // Zero or less reports no statement as slow
+	logText       bool
+	metricLabels  []string
+	now           func() time.Time
+
+	totals statementCounters
+
+	mu     sync.Mutex // Guards series
+	series map[string]*statementCounters
+}
+
+// statementCounters counts statements
+type statementCounters struct {
+	labels     map[string]string
+	statements atomic.Int64
+	failed     atomic.Int64
+	slow       atomic.Int64
+	slowest    atomic.Int64 // Nanoseconds
+}
+
+// NewStatementLogger creates a statement logger
+func NewStatementLogger(opts StatementLogOptions) *StatementLogger {
+	if opts.SlowThreshold == 0 {
+		opts.SlowThreshold = DefaultSlowStatementThreshold
+	}
+	return &StatementLogger{
+		slowThreshold: opts.SlowThreshold,
+		logText:       !opts.HideText,
+		metricLabels:  opts.MetricLabels,
+		now:           time.Now,
+		series:        make(map[string]*statementCounters),
+	}
+}
+
+// Stats reports how many statements ran, failed and were slow, in total and by the values of the metric
+// labels
+func (s *StatementLogger) Stats() StatementStats {
+	stats := StatementStats{
+		Statements: s.totals.statements.Load(),
+		Failed:     s.totals.failed.Load(),
+		Slow:       s.totals.slow.Load(),
+		SlowestMs:  time.Duration(s.totals.slowest.Load()).Milliseconds(),
+	}
+	if s.slowThreshold > 0 {
+		stats.SlowThresholdMs = s.slowThreshold.Milliseconds()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.series))
+	for key := range s.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c := s.series[key]
+		stats.Series = append(stats.Series, StatementSeries{
+			Labels:     c.labels,
+			Statements: c.statements.Load(),
+			Failed:     c.failed.Load(),
+			Slow:       c.slow.Load(),
+			SlowestMs:  time.Duration(c.slowest.Load()).Milliseconds(),
+		})
+	}
+	return stats
+}
+
+// seriesOf returns the counters of the metric label values of a connection, nil when no metric labels
+// are set or the series are all taken
+func (s *StatementLogger) seriesOf(labels map[string]string) *statementCounters {
+	if len(s.metricLabels) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(s.metricLabels))
+	var key strings.Builder
+	for _, name := range s.metricLabels {
+		if value, ok := labels[name]; ok {
+			values[name] = value
+		}
+		key.WriteString(labels[name])
+		key.WriteByte(0)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.series[key.String()]
+	if !ok && len(s.series) < maxStatementSeries {
+		c = &statementCounters{labels: values}
+		s.series[key.String()] = c
+	}
+	return c
+}
+
+// count adds a statement to the counters
+func (c *statementCounters) count(elapsed time.Duration, failed, slow bool) {
+	c.statements.Add(1)
+	if failed {
+		c.failed.Add(1)
+	}
+	if slow {
+		c.slow.Add(1)
+	}
+	for {
+		slowest := c.slowest.Load()
+		if int64(elapsed) <= slowest || c.slowest.CompareAndSwap(slowest, int64(elapsed)) {
+			return
+		}
+	}
+}
+
+// statement is a statement being run, logged by end
+type statement struct {
+	log    *StatementLogger
+	logger *slog.Logger
+	labels map[string]string // Of the connection running the statement
+	attrs  []any
+	start  time.Time
+}
+
+// beginSQL starts timing a SQL statement; its argument values are never logged, only their count
+func (s *StatementLogger) beginSQL(logger *slog.Logger, labels map[string]string, operation, query string, args int) *statement {
+	attrs := []any{"operation", operation}
+	if s.logText {
+		attrs = append(attrs, "sql", truncateStatement(logging.RedactSQL(query)))
+	}
+	return s.begin(logger, labels, append(attrs, "args", args))
+}
+
+// beginMongo starts timing a MongoDB operation, logged by its collection rather than its filter or
+// documents
+func (s *StatementLogger) beginMongo(logger *slog.Logger, labels map[string]string, operation string, collection interface{}) *statement {
+	return s.begin(logger, labels, []any{"operation", operation, "collection", collection})
+}
+
+func (s *StatementLogger) begin(logger *slog.Logger, labels map[string]string, attrs []any) *statement {
+	return &statement{log: s, logger: logger, labels: labels, attrs: attrs, start: s.now()}
+}
+
+// end logs a statement and counts it; rows below zero are unknown, and rows of a failed statement are left out
+func (st *statement) end(ctx context.Context, rows int64, err error) {
+	s := st.log
+	elapsed := s.now().Sub(st.start)
+	slow := s.slowThreshold > 0 && elapsed > s.slowThreshold
+	s.totals.count(elapsed, err != nil, slow)
+	addStatementTiming(ctx, elapsed)
+	if series := s.seriesOf(st.labels); series != nil {
+		series.count(elapsed, err != nil, slow)
+	}
+
+	attrs := append(st.attrs, "duration_ms", elapsed.Milliseconds())
+	if rows >= 0 && err == nil {
+		attrs = append(attrs, "rows", rows)
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	if slow {
+		st.logger.WarnContext(ctx, "slow statement", append(attrs, "slow_threshold_ms", s.slowThreshold.Milliseconds())...)
+		return
+	}
+	st.logger.DebugContext(ctx, "statement", attrs...)
+}
+
+// truncateStatement shortens statement text to maxStatementText bytes without splitting a character
+func truncateStatement(text string) string {
+	if len(text) <= maxStatementText {
+		return text
+	}
+	cut := maxStatementText
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
+
+// sqlResultRows returns the rows affected by a SQL write, or -1 when the driver does not report them
+func sqlResultRows(result sql.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return rows
+}
+
+// mongoResultRows returns the documents read or written by a MongoDB operation, or -1 when its result
+// does not say
+func mongoResultRows(result interface{}) int64 {
+	switch r := result.(type) {
+	case []map[string]interface{}:
+		return int64(len(r))
+	case map[string]interface{}:
+		return 1
+	case *mongo.InsertOneResult:
+		return 1
+	case *mongo.InsertManyResult:
+		return int64(len(r.InsertedIDs))
+	case *mongo.UpdateResult:
+		return r.ModifiedCount + r.UpsertedCount
+	case *mongo.DeleteResult:
+		return r.DeletedCount
+	case *mongo.BulkWriteResult:
+		return r.InsertedCount + r.ModifiedCount + r.UpsertedCount + r.DeletedCount
+	default:
+		return -1
+	}
+}
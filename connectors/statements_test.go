@@ -0,0 +1,154 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"db-connectors/logging"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// steppingClock returns a clock that moves forward by the next of steps every time it is read, so a
+// statement lasts the step read when it ends
+func steppingClock(steps ...time.Duration) func() time.Time {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		if len(steps) > 0 {
+			now = now.Add(steps[0])
+			steps = steps[1:]
+		}
+		return now
+	}
+}
+
+// statementLogs returns the JSON log records written to buf
+func statementLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+	return records
+}
+
+func newTimedMySQL(t *testing.T, statements *StatementLogger, buf *bytes.Buffer) (*MySQLConnector, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	logger := logging.New(logging.Options{Level: "debug", Format: logging.FormatJSON, Output: buf})
+	connector := NewMySQLConnector(&ConnectionConfig{Host: "db", Port: 3306}, WithLogger(logger), WithStatementLogger(statements))
+	connector.db = db
+	return connector, mock
+}
+
+func TestStatementLogging(t *testing.T) {
+	statements := NewStatementLogger(StatementLogOptions{SlowThreshold: time.Second})
+	statements.now = steppingClock(0, 250*time.Millisecond, 0, 1500*time.Millisecond, 0, 30*time.Millisecond)
+	var buf bytes.Buffer
+	connector, mock := newTimedMySQL(t, statements, &buf)
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT id FROM orders").WithArgs("secret-value").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := connector.Query(ctx, "SELECT id FROM orders WHERE token = ?", "secret-value")
+	require.NoError(t, err)
+	rows.Close()
+
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 3))
+	_, err = connector.Execute(ctx, "update", map[string]interface{}{"query": "UPDATE orders SET status = 'shipped'"})
+	require.NoError(t, err)
+
+	mock.ExpectExec("DELETE FROM orders").WillReturnError(errors.New("lock wait timeout"))
+	_, err = connector.Execute(ctx, "delete", map[string]interface{}{"query": "DELETE FROM orders"})
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	records := statementLogs(t, &buf)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, "DEBUG", records[0]["level"])
+	assert.Equal(t, "statement", records[0]["msg"])
+	assert.Equal(t, "query", records[0]["operation"])
+	assert.Equal(t, "SELECT id FROM orders WHERE token = ?", records[0]["sql"])
+	assert.Equal(t, float64(1), records[0]["args"])
+	assert.Equal(t, float64(250), records[0]["duration_ms"])
+	assert.NotContains(t, records[0], "rows")
+	assert.NotContains(t, buf.String(), "secret-value")
+
+	assert.Equal(t, "WARN", records[1]["level"])
+	assert.Equal(t, "slow statement", records[1]["msg"])
+	assert.Equal(t, "update", records[1]["operation"])
+	assert.Equal(t, float64(1500), records[1]["duration_ms"])
+	assert.Equal(t, float64(3), records[1]["rows"])
+	assert.Equal(t, float64(1000), records[1]["slow_threshold_ms"])
+	assert.Equal(t, "mysql", records[1]["db_type"])
+
+	assert.Equal(t, "DEBUG", records[2]["level"])
+	assert.Equal(t, float64(30), records[2]["duration_ms"])
+	assert.Equal(t, "lock wait timeout", records[2]["error"])
+	assert.NotContains(t, records[2], "rows")
+
+	assert.Equal(t, StatementStats{Statements: 3, Failed: 1, Slow: 1, SlowestMs: 1500, SlowThresholdMs: 1000}, statements.Stats())
+}
+
+func TestStatementTextHidden(t *testing.T) {
+	statements := NewStatementLogger(StatementLogOptions{SlowThreshold: -1, HideText: true})
+	statements.now = steppingClock(0, time.Hour)
+	var buf bytes.Buffer
+	connector, mock := newTimedMySQL(t, statements, &buf)
+
+	mock.ExpectExec("INSERT INTO patients").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err := connector.Execute(context.Background(), "insert", map[string]interface{}{"query": "INSERT INTO patients (name) VALUES ('Jane Doe')"})
+	require.NoError(t, err)
+
+	// Without a threshold nothing is slow, however long it runs
+	records := statementLogs(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "statement", records[0]["msg"])
+	assert.NotContains(t, records[0], "sql")
+	assert.NotContains(t, buf.String(), "Jane Doe")
+	assert.Equal(t, StatementStats{Statements: 1, SlowestMs: time.Hour.Milliseconds()}, statements.Stats())
+}
+
+func TestStatementLoggerDefaults(t *testing.T) {
+	assert.Equal(t, DefaultSlowStatementThreshold, NewStatementLogger(StatementLogOptions{}).slowThreshold)
+	assert.NotNil(t, applyOptions("mysql", nil).statements)
+
+	statements := NewStatementLogger(StatementLogOptions{})
+	assert.Same(t, statements, applyOptions("mysql", []Option{WithStatementLogger(statements)}).statements)
+}
+
+func TestStatementTextRedactedAndTruncated(t *testing.T) {
+	statements := NewStatementLogger(StatementLogOptions{SlowThreshold: time.Second})
+	var buf bytes.Buffer
+	logger := logging.New(logging.Options{Level: "debug", Format: logging.FormatJSON, Output: &buf})
+
+	statements.beginSQL(logger, nil, "execute", "CREATE USER app IDENTIFIED BY 'hunter2'", 0).end(context.Background(), 0, nil)
+	statements.beginSQL(logger, nil, "query", "SELECT '"+strings.Repeat("é", maxStatementText)+"'", 0).end(context.Background(), -1, nil)
+
+	records := statementLogs(t, &buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "CREATE USER app IDENTIFIED BY '"+logging.Redacted+"'", records[0]["sql"])
+	text := records[1]["sql"].(string)
+	assert.True(t, strings.HasSuffix(text, "…"))
+	assert.LessOrEqual(t, len(text), maxStatementText+len("…"))
+	assert.NotContains(t, text, "�")
+}
+
+func TestMongoResultRows(t *testing.T) {
+	assert.Equal(t, int64(2), mongoResultRows([]map[string]interface{}{{}, {}}))
+	assert.Equal(t, int64(1), mongoResultRows(map[string]interface{}{"_id": 1}))
+	assert.Equal(t, int64(3), mongoResultRows(&mongo.InsertManyResult{InsertedIDs: []interface{}{1, 2, 3}}))
+	assert.Equal(t, int64(2), mongoResultRows(&mongo.UpdateResult{MatchedCount: 5, ModifiedCount: 1, UpsertedCount: 1}))
+	assert.Equal(t, int64(4), mongoResultRows(&mongo.DeleteResult{DeletedCount: 4}))
+	assert.Equal(t, int64(-1), mongoResultRows(int64(9)))
+}
@@ -0,0 +1,40 @@
+package connectors
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// StatementTimings adds up the time the statements run with a context spend in the database, as
+// reported by the connectors' statement loggers; statements running at once are each counted in full
+type StatementTimings struct {
+	statements atomic.Int64
+	elapsed    atomic.Int64 // Nanoseconds
+}
+
+// statementTimingsKey stores the StatementTimings of a context
+type statementTimingsKey struct{}
+
+// WithStatementTimings returns ctx carrying timings, which the statements run with it are added to
+func WithStatementTimings(ctx context.Context, timings *StatementTimings) context.Context {
+	return context.WithValue(ctx, statementTimingsKey{}, timings)
+}
+
+// addStatementTiming counts a statement that ran for elapsed with the timings of ctx, if it carries any
+func addStatementTiming(ctx context.Context, elapsed time.Duration) {
+	if timings, ok := ctx.Value(statementTimingsKey{}).(*StatementTimings); ok && timings != nil {
+		timings.statements.Add(1)
+		timings.elapsed.Add(int64(elapsed))
+	}
+}
+
+// Statements returns how many statements were counted
+func (t *StatementTimings) Statements() int64 {
+	return t.statements.Load()
+}
+
+// Elapsed returns the time the statements counted ran for
+func (t *StatementTimings) Elapsed() time.Duration {
+	return time.Duration(t.elapsed.Load())
+}
@@ -0,0 +1,41 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementTimings(t *testing.T) {
+	statements := NewStatementLogger(StatementLogOptions{})
+	statements.now = steppingClock(0, 40*time.Millisecond, 0, 15*time.Millisecond, 0, time.Second)
+	var buf bytes.Buffer
+	connector, mock := newTimedMySQL(t, statements, &buf)
+	var timings StatementTimings
+	ctx := WithStatementTimings(context.Background(), &timings)
+
+	mock.ExpectQuery("SELECT id FROM orders").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := connector.Query(ctx, "SELECT id FROM orders")
+	require.NoError(t, err)
+	rows.Close()
+
+	// Failed statements count too
+	mock.ExpectExec("DELETE FROM orders").WillReturnError(errors.New("lock wait timeout"))
+	_, err = connector.Execute(ctx, "delete", map[string]interface{}{"query": "DELETE FROM orders"})
+	require.Error(t, err)
+
+	// Statements run without the timings are left out
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = connector.Execute(context.Background(), "update", map[string]interface{}{"query": "UPDATE orders SET status = 'shipped'"})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, int64(2), timings.Statements())
+	assert.Equal(t, 55*time.Millisecond, timings.Elapsed())
+}
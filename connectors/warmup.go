@@ -0,0 +1,38 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// WarmUp opens n connections of a connected SQL connector's pool at once and returns them to it idle, so
+// that the first requests do not wait for connections to be dialed. Connections already idle count towards
+// n. Connectors not backed by database/sql are left as they are. It returns how many connections were held,
+// which is less than n when one failed to open.
+func WarmUp(ctx context.Context, connector DBConnector, n int) (int, error) {
+	sqlConnector, ok := connector.(SQLConnector)
+	if !ok || n <= 0 {
+		return 0, nil
+	}
+	db := sqlConnector.DB()
+	if db == nil {
+		return 0, fmt.Errorf("%s connection not established", connector.GetType())
+	}
+
+	// Holding every connection until n are open makes the pool dial new ones rather than hand out the same
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for len(conns) < n {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return len(conns), fmt.Errorf("failed to open connection %d of %d: %w", len(conns)+1, n, err)
+		}
+		conns = append(conns, conn)
+	}
+	return len(conns), nil
+}
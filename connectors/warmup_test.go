@@ -0,0 +1,42 @@
+package connectors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmUp(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxIdleConns(DefaultMaxIdleConns)
+	connector := &MySQLConnector{db: db}
+
+	opened, err := WarmUp(context.Background(), connector, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, opened)
+	assert.Equal(t, 3, db.Stats().Idle, "the connections are returned to the pool idle")
+
+	// Idle connections count towards n
+	_, err = WarmUp(context.Background(), connector, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, db.Stats().OpenConnections)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = WarmUp(ctx, connector, 5)
+	assert.ErrorContains(t, err, "failed to open connection")
+
+	opened, err = WarmUp(context.Background(), &MySQLConnector{}, 1)
+	assert.EqualError(t, err, "mysql connection not established")
+	assert.Zero(t, opened)
+
+	// Connectors not backed by database/sql are left as they are
+	opened, err = WarmUp(context.Background(), &stubConnector{}, 3)
+	assert.NoError(t, err)
+	assert.Zero(t, opened)
+}
@@ -8,6 +8,9 @@ echo "🚀 Building Database Connectors for Production Deployment..."
 # Configuration
 APP_NAME="db-connectors"
 VERSION="1.0.0"
+COMMIT=$(git rev-parse --short HEAD 2>/dev/null || echo unknown)
+BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+LDFLAGS="-s -w -X main.Version=${VERSION} -X main.Commit=${COMMIT} -X main.BuildDate=${BUILD_DATE}"
 BUILD_DIR="deploy"
 ARCHIVE_NAME="${APP_NAME}-v${VERSION}.tar.gz"
 
@@ -23,7 +26,7 @@ go mod tidy
 # Build optimized binary for Linux
 echo "🔨 Building optimized binary for Linux..."
 CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build \
-  -ldflags="-s -w -X main.Version=${VERSION}" \
+  -ldflags="${LDFLAGS}" \
   -o ${APP_NAME}-linux cmd/main.go
 
 # Create deployment structure
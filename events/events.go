@@ -0,0 +1,227 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"db-connectors/logging"
+)
+
+// Operations of a config change
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// Event describes a config change applied to an allconfig table. Values are only sent as hashes, so
+// consumers can tell whether a value changed without being trusted with it.
+type Event struct {
+	Table             string            `json:"table"`
+	Key               string            `json:"key"`
+	Operation         string            `json:"operation"`                // create, update or delete
+	OldValueHash      string            `json:"old_value_hash,omitempty"` // Hex SHA-256 of the value before the change; empty for creates
+	NewValueHash      string            `json:"new_value_hash,omitempty"` // Hex SHA-256 of the value after the change; empty for deletes
+	Actor             string            `json:"actor,omitempty"`          // Maker of the change
+	ApprovalRequestID string            `json:"approval_request_id,omitempty"`
+	ApprovedBy        string            `json:"approved_by,omitempty"`  // Checker of a change applied by approval
+	RequestID         string            `json:"request_id,omitempty"`   // ID of the API request that applied the change
+	OperationID       string            `json:"operation_id,omitempty"` // ID of the batch or import operation that applied the change
+	Labels            map[string]string `json:"labels,omitempty"`       // Labels of the connection the change was written through
+	Timestamp         time.Time         `json:"timestamp"`
+}
+
+// Publisher delivers events to downstream consumers
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event) error
+	Close() error
+}
+
+// Nop discards every event
+type Nop struct{}
+
+func (Nop) Publish(ctx context.Context, events ...Event) error { return nil }
+func (Nop) Close() error                                       { return nil }
+
+// Memory keeps published events in memory, for tests
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemory returns an empty in-memory publisher
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(ctx context.Context, events ...Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *Memory) Close() error { return nil }
+
+// Events returns the events published so far, in order
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+// ErrClosed is returned when closing an Async publisher twice
+var ErrClosed = errors.New("event publisher is closed")
+
+// Options configures an Async publisher
+type Options struct {
+	BufferSize     int           // Events waiting to be published before new ones are dropped
+	BatchSize      int           // Most events handed to the publisher at once
+	PublishTimeout time.Duration // Time allowed to publish one batch
+	Logger         *slog.Logger  // Receives publishing failures; nil discards them
+}
+
+// Default option values
+const (
+	DefaultBufferSize     = 1024
+	DefaultBatchSize      = 100
+	DefaultPublishTimeout = 10 * time.Second
+)
+
+// withDefaults fills unset options with default values
+func (o Options) withDefaults() Options {
+	if o.BufferSize <= 0 {
+		o.BufferSize = DefaultBufferSize
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.PublishTimeout <= 0 {
+		o.PublishTimeout = DefaultPublishTimeout
+	}
+	if o.Logger == nil {
+		o.Logger = logging.Discard()
+	}
+	return o
+}
+
+// Stats counts the events handled by an Async publisher
+type Stats struct {
+	Published int64 `json:"published"`
+	Failed    int64 `json:"failed"`  // Handed to the publisher, which returned an error
+	Dropped   int64 `json:"dropped"` // Not published because the buffer was full or the publisher closed
+	Pending   int   `json:"pending"`
+}
+
+// Async publishes events in the background through a bounded buffer. Callers never wait on the
+// publisher: events arriving while the buffer is full are dropped and counted.
+type Async struct {
+	publisher Publisher
+	opts      Options
+	queue     chan Event
+	done      chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	published atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+}
+
+// NewAsync starts publishing events through publisher
+func NewAsync(publisher Publisher, opts Options) *Async {
+	opts = opts.withDefaults()
+	a := &Async{
+		publisher: publisher,
+		opts:      opts,
+		queue:     make(chan Event, opts.BufferSize),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Publish queues events for publishing, dropping those that do not fit in the buffer
+func (a *Async) Publish(events ...Event) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, event := range events {
+		if a.closed {
+			a.dropped.Add(1)
+			continue
+		}
+		select {
+		case a.queue <- event:
+		default:
+			a.dropped.Add(1)
+		}
+	}
+}
+
+// Stats reports how many events were published, failed and dropped
+func (a *Async) Stats() Stats {
+	return Stats{
+		Published: a.published.Load(),
+		Failed:    a.failed.Load(),
+		Dropped:   a.dropped.Load(),
+		Pending:   len(a.queue),
+	}
+}
+
+// Close stops accepting events, publishes those already queued until ctx is done, and closes the
+// publisher
+func (a *Async) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrClosed
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return errors.Join(ctx.Err(), a.publisher.Close())
+	}
+	return a.publisher.Close()
+}
+
+// run publishes queued events in batches until the queue is closed and drained
+func (a *Async) run() {
+	defer close(a.done)
+	batch := make([]Event, 0, a.opts.BatchSize)
+	for event := range a.queue {
+		batch = append(batch[:0], event)
+	fill:
+		for len(batch) < a.opts.BatchSize {
+			select {
+			case next, ok := <-a.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+		a.publish(batch)
+	}
+}
+
+func (a *Async) publish(batch []Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.PublishTimeout)
+	defer cancel()
+	if err := a.publisher.Publish(ctx, batch...); err != nil {
+		a.failed.Add(int64(len(batch)))
+		a.opts.Logger.Warn("failed to publish config change events", "events", len(batch), "error", err)
+		return
+	}
+	a.published.Add(int64(len(batch)))
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingPublisher waits for release before publishing each batch, and fails while err is set
+type blockingPublisher struct {
+	Memory
+	release chan struct{}
+	err     error
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, events ...Event) error {
+	<-p.release
+	if p.err != nil {
+		return p.err
+	}
+	return p.Memory.Publish(ctx, events...)
+}
+
+func keyed(keys ...string) []Event {
+	events := make([]Event, len(keys))
+	for i, key := range keys {
+		events[i] = Event{Table: "allconfig", Key: key, Operation: OperationUpdate}
+	}
+	return events
+}
+
+func TestAsyncPublishes(t *testing.T) {
+	memory := NewMemory()
+	async := NewAsync(memory, Options{BatchSize: 2})
+	async.Publish(keyed("a", "b", "c")...)
+	async.Publish(keyed("d")...)
+
+	require.NoError(t, async.Close(context.Background()))
+	assert.Equal(t, keyed("a", "b", "c", "d"), memory.Events())
+	assert.Equal(t, Stats{Published: 4}, async.Stats())
+
+	// Events published after closing are dropped
+	async.Publish(keyed("e")...)
+	assert.Equal(t, Stats{Published: 4, Dropped: 1}, async.Stats())
+	assert.ErrorIs(t, async.Close(context.Background()), ErrClosed)
+}
+
+func TestAsyncDropsWhenFull(t *testing.T) {
+	publisher := &blockingPublisher{release: make(chan struct{})}
+	async := NewAsync(publisher, Options{BufferSize: 2, BatchSize: 1})
+
+	// The first event is taken off the queue and held by the publisher, two more fill the buffer
+	async.Publish(keyed("a")...)
+	require.Eventually(t, func() bool { return async.Stats().Pending == 0 }, time.Second, time.Millisecond)
+	async.Publish(keyed("b", "c", "d")...)
+	assert.Equal(t, Stats{Dropped: 1, Pending: 2}, async.Stats())
+
+	close(publisher.release)
+	require.NoError(t, async.Close(context.Background()))
+	assert.Equal(t, keyed("a", "b", "c"), publisher.Events())
+	assert.Equal(t, Stats{Published: 3, Dropped: 1}, async.Stats())
+}
+
+func TestAsyncCountsFailures(t *testing.T) {
+	publisher := &blockingPublisher{release: make(chan struct{}), err: errors.New("broker unavailable")}
+	close(publisher.release)
+	async := NewAsync(publisher, Options{})
+	async.Publish(keyed("a", "b")...)
+
+	require.NoError(t, async.Close(context.Background()))
+	assert.Empty(t, publisher.Events())
+	assert.Equal(t, Stats{Failed: 2}, async.Stats())
+}
+
+func TestAsyncCloseTimeout(t *testing.T) {
+	publisher := &blockingPublisher{release: make(chan struct{})}
+	defer close(publisher.release)
+	async := NewAsync(publisher, Options{})
+	async.Publish(keyed("a")...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, async.Close(ctx), context.DeadlineExceeded)
+}
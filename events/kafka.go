@@ -0,0 +1,119 @@
+package events
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms accepted by NewSASLMechanism
+var SASLMechanisms = []string{"plain", "scram-sha-256", "scram-sha-512"}
+
+// KafkaOptions configures a KafkaPublisher
+type KafkaOptions struct {
+	Brokers      []string
+	Topic        string
+	TLS          *tls.Config    // nil connects in plaintext
+	SASL         sasl.Mechanism // nil connects without authentication
+	WriteTimeout time.Duration  // Time allowed to write to a broker, defaults to 10 seconds
+}
+
+// KafkaPublisher writes events as JSON messages to a Kafka topic. Messages are keyed by table and config
+// key, so the changes of one config stay in order on one partition.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher returns a publisher writing to the topic on the brokers; it connects on first use
+func NewKafkaPublisher(opts KafkaOptions) (*KafkaPublisher, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka brokers are required")
+	}
+	if opts.Topic == "" {
+		return nil, fmt.Errorf("kafka topic is required")
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(opts.Brokers...),
+		Topic:        opts.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		WriteTimeout: opts.WriteTimeout,
+		Transport:    &kafka.Transport{TLS: opts.TLS, SASL: opts.SASL},
+	}}, nil
+}
+
+// Publish writes the events, returning once the brokers acknowledged all of them
+func (p *KafkaPublisher) Publish(ctx context.Context, events ...Event) error {
+	messages := make([]kafka.Message, len(events))
+	for i, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		messages[i] = kafka.Message{Key: []byte(event.Table + "/" + event.Key), Value: value, Time: event.Timestamp}
+	}
+	if err := p.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to write to kafka topic %s: %w", p.writer.Topic, err)
+	}
+	return nil
+}
+
+// Close flushes pending writes and closes the connections to the brokers
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// NewSASLMechanism returns the SASL mechanism of the name, one of SASLMechanisms
+func NewSASLMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch strings.ToLower(name) {
+	case "plain":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	}
+	return nil, fmt.Errorf("unsupported SASL mechanism: %q, must be one of: %s", name, strings.Join(SASLMechanisms, ", "))
+}
+
+// ClientTLSConfig builds the TLS configuration for connecting to brokers. Brokers are verified against
+// the CA in caFile, or the system roots when it is empty; certFile and keyFile, when set, hold the client
+// certificate.
+func ClientTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("a client certificate requires both a certificate file and a key file")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKafkaPublisher(t *testing.T) {
+	_, err := NewKafkaPublisher(KafkaOptions{Topic: "config-changes"})
+	assert.EqualError(t, err, "kafka brokers are required")
+	_, err = NewKafkaPublisher(KafkaOptions{Brokers: []string{"kafka:9092"}})
+	assert.EqualError(t, err, "kafka topic is required")
+
+	publisher, err := NewKafkaPublisher(KafkaOptions{Brokers: []string{"kafka:9092"}, Topic: "config-changes"})
+	require.NoError(t, err)
+	assert.Equal(t, "config-changes", publisher.writer.Topic)
+	assert.NoError(t, publisher.Close())
+}
+
+func TestNewSASLMechanism(t *testing.T) {
+	for _, name := range SASLMechanisms {
+		mechanism, err := NewSASLMechanism(name, "app", "secret")
+		require.NoError(t, err, name)
+		assert.NotNil(t, mechanism, name)
+	}
+	mechanism, err := NewSASLMechanism("SCRAM-SHA-512", "app", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "SCRAM-SHA-512", mechanism.Name())
+
+	_, err = NewSASLMechanism("gssapi", "app", "secret")
+	assert.EqualError(t, err, `unsupported SASL mechanism: "gssapi", must be one of: plain, scram-sha-256, scram-sha-512`)
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	config, err := ClientTLSConfig("", "", "", true)
+	require.NoError(t, err)
+	assert.True(t, config.InsecureSkipVerify)
+	assert.Nil(t, config.RootCAs)
+
+	dir := t.TempDir()
+	_, err = ClientTLSConfig(filepath.Join(dir, "missing.pem"), "", "", false)
+	assert.ErrorContains(t, err, "failed to read CA file")
+
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0o600))
+	_, err = ClientTLSConfig(empty, "", "", false)
+	assert.ErrorContains(t, err, "no certificates found in CA file")
+
+	_, err = ClientTLSConfig("", "client.pem", "", false)
+	assert.EqualError(t, err, "a client certificate requires both a certificate file and a key file")
+	_, err = ClientTLSConfig("", filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"), false)
+	assert.ErrorContains(t, err, "failed to load client certificate")
+}
@@ -0,0 +1,32 @@
+#!/bin/bash
+
+# Database Connectors - Fetch Swagger UI
+# Downloads the swagger-ui-dist release named in api/swaggerui/VERSION into api/swaggerui, where the server
+# embeds it and serves it from /docs/assets. Set SWAGGER_UI_TARBALL to a local copy or mirror of the npm
+# tarball where the registry is unreachable.
+set -e
+
+ASSETS_DIR="$(cd "$(dirname "$0")" && pwd)/api/swaggerui"
+SWAGGER_UI_VERSION=$(tr -d '[:space:]' < "${ASSETS_DIR}/VERSION")
+TARBALL="${SWAGGER_UI_TARBALL:-https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-${SWAGGER_UI_VERSION}.tgz}"
+FILES="swagger-ui.css swagger-ui-bundle.js swagger-ui-standalone-preset.js favicon-32x32.png favicon-16x16.png LICENSE"
+
+if [ -f "${ASSETS_DIR}/swagger-ui-bundle.js" ] && [ "$1" != "-f" ]; then
+    echo "✅ Swagger UI ${SWAGGER_UI_VERSION} already in ${ASSETS_DIR} (-f fetches it again)"
+    exit 0
+fi
+
+echo "📦 Fetching Swagger UI ${SWAGGER_UI_VERSION} from ${TARBALL}..."
+WORK_DIR=$(mktemp -d)
+trap 'rm -rf "${WORK_DIR}"' EXIT
+
+if [ -f "${TARBALL}" ]; then
+    tar -xzf "${TARBALL}" -C "${WORK_DIR}"
+else
+    curl -fsSL "${TARBALL}" | tar -xz -C "${WORK_DIR}"
+fi
+
+for file in ${FILES}; do
+    cp "${WORK_DIR}/package/${file}" "${ASSETS_DIR}/"
+done
+echo "✅ Swagger UI ${SWAGGER_UI_VERSION} saved to ${ASSETS_DIR}"
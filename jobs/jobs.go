@@ -0,0 +1,406 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of a job
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Finished reports whether the state is terminal
+func (s State) Finished() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCancelled
+}
+
+var (
+	// ErrNotFound is returned for unknown or expired job IDs
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull is returned when the job queue has no free slot
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrNotFinished is returned when the result of an unfinished job is requested
+	ErrNotFinished = errors.New("job has not finished")
+	// ErrNoResult is returned when a finished job has no result to read
+	ErrNoResult = errors.New("job did not produce a result")
+	// ErrClosed is returned when submitting to a closed manager
+	ErrClosed = errors.New("job manager is closed")
+)
+
+// Options configures a Manager
+type Options struct {
+	Workers        int           // Number of jobs run concurrently
+	QueueSize      int           // Jobs waiting for a worker before Submit fails
+	MaxResultRows  int           // Rows a job may store before it fails
+	MaxResultBytes int64         // Encoded result bytes a job may store before it fails
+	ResultTTL      time.Duration // How long finished jobs and their results are kept
+	JobTimeout     time.Duration // Maximum run time of a single job
+	SpoolDir       string        // Directory for spooled results; empty keeps results in memory
+}
+
+// Default option values
+const (
+	DefaultWorkers        = 4
+	DefaultQueueSize      = 100
+	DefaultMaxResultRows  = 1000000
+	DefaultMaxResultBytes = 256 << 20
+	DefaultResultTTL      = time.Hour
+	DefaultJobTimeout     = time.Hour
+)
+
+// withDefaults fills unset options with default values
+func (o Options) withDefaults() Options {
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+	if o.MaxResultRows <= 0 {
+		o.MaxResultRows = DefaultMaxResultRows
+	}
+	if o.MaxResultBytes <= 0 {
+		o.MaxResultBytes = DefaultMaxResultBytes
+	}
+	if o.ResultTTL <= 0 {
+		o.ResultTTL = DefaultResultTTL
+	}
+	if o.JobTimeout <= 0 {
+		o.JobTimeout = DefaultJobTimeout
+	}
+	return o
+}
+
+// RunFunc does the work of a job, writing any result rows to w
+type RunFunc func(ctx context.Context, w ResultWriter) error
+
+// Status is a snapshot of a job
+type Status struct {
+	ID           string            `json:"id"`
+	State        State             `json:"state"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	SubmittedAt  time.Time         `json:"submitted_at"`
+	StartedAt    *time.Time        `json:"started_at,omitempty"`
+	FinishedAt   *time.Time        `json:"finished_at,omitempty"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`
+	RowCount     int               `json:"row_count"`
+	RowsAffected *int64            `json:"rows_affected,omitempty"`
+	ResultBytes  int64             `json:"result_bytes"`
+	DurationMs   float64           `json:"duration_ms,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// job is the mutable state of a submitted job, guarded by Manager.mu
+type job struct {
+	status Status
+	run    RunFunc
+	ctx    context.Context
+	cancel context.CancelFunc
+	result *resultStore
+}
+
+// Manager runs jobs on a bounded worker pool and keeps their results until they expire
+type Manager struct {
+	opts  Options
+	queue chan *job
+	now   func() time.Time
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	closed bool
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+}
+
+// NewManager starts a job manager with its worker pool and expiry loop
+func NewManager(opts Options) *Manager {
+	opts = opts.withDefaults()
+	m := &Manager{
+		opts:  opts,
+		queue: make(chan *job, opts.QueueSize),
+		now:   time.Now,
+		jobs:  make(map[string]*job),
+		stop:  make(chan struct{}),
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+
+	m.wg.Add(1)
+	go m.expireLoop()
+
+	return m
+}
+
+// Submit queues a job and returns its initial status
+func (m *Manager) Submit(labels map[string]string, run RunFunc) (Status, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		status: Status{
+			ID:          newJobID(),
+			State:       StateQueued,
+			Labels:      labels,
+			SubmittedAt: m.now(),
+		},
+		run:    run,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		cancel()
+		return Status{}, ErrClosed
+	}
+
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return Status{}, ErrQueueFull
+	}
+
+	m.jobs[j.status.ID] = j
+	return j.status, nil
+}
+
+// Get returns the status of a job
+func (m *Manager) Get(id string) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Status{}, ErrNotFound
+	}
+	return j.status, nil
+}
+
+// List returns the status of all known jobs, newest first
+func (m *Manager) List() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		statuses = append(statuses, j.status)
+	}
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].SubmittedAt.After(statuses[k].SubmittedAt)
+	})
+	return statuses
+}
+
+// Cancel stops a queued or running job. Cancelling a finished job is a no-op.
+func (m *Manager) Cancel(id string) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Status{}, ErrNotFound
+	}
+
+	j.cancel()
+	// Queued jobs finish immediately; running jobs finish when their RunFunc returns
+	if j.status.State == StateQueued {
+		m.finishLocked(j, StateCancelled, context.Canceled)
+	}
+	return j.status, nil
+}
+
+// OpenResult opens the stored result of a succeeded job as JSON Lines
+func (m *Manager) OpenResult(id string) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !j.status.State.Finished() {
+		return nil, ErrNotFinished
+	}
+	if j.status.State != StateSucceeded || j.result == nil {
+		return nil, ErrNoResult
+	}
+	return j.result.open()
+}
+
+// Close cancels all jobs, stops the workers and removes stored results
+func (m *Manager) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	for _, j := range m.jobs {
+		j.cancel()
+	}
+	close(m.stop)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, j := range m.jobs {
+		if j.result != nil {
+			j.result.remove()
+		}
+		delete(m.jobs, id)
+	}
+}
+
+// worker runs queued jobs until the manager is closed
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case j := <-m.queue:
+			m.runJob(j)
+		}
+	}
+}
+
+// runJob executes a single job and records its outcome
+func (m *Manager) runJob(j *job) {
+	m.mu.Lock()
+	if j.status.State != StateQueued {
+		// Cancelled while waiting in the queue
+		m.mu.Unlock()
+		return
+	}
+	started := m.now()
+	j.status.State = StateRunning
+	j.status.StartedAt = &started
+	m.mu.Unlock()
+
+	result, err := newResultStore(m.opts, j.status.ID)
+	if err == nil {
+		m.mu.Lock()
+		j.result = result
+		m.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(j.ctx, m.opts.JobTimeout)
+		err = m.runSafely(ctx, j.run, &resultWriter{manager: m, job: j, store: result})
+		cancel()
+		if closeErr := result.finish(); err == nil {
+			err = closeErr
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil:
+		m.finishLocked(j, StateSucceeded, nil)
+	case j.ctx.Err() != nil:
+		m.finishLocked(j, StateCancelled, err)
+	default:
+		m.finishLocked(j, StateFailed, err)
+	}
+}
+
+// runSafely converts a panicking RunFunc into an error
+func (m *Manager) runSafely(ctx context.Context, run RunFunc, w ResultWriter) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return run(ctx, w)
+}
+
+// finishLocked moves a job to a terminal state; m.mu must be held
+func (m *Manager) finishLocked(j *job, state State, err error) {
+	finished := m.now()
+	expires := finished.Add(m.opts.ResultTTL)
+	j.status.State = state
+	j.status.FinishedAt = &finished
+	j.status.ExpiresAt = &expires
+	if j.status.StartedAt != nil {
+		j.status.DurationMs = float64(finished.Sub(*j.status.StartedAt).Microseconds()) / 1000
+	}
+	if err != nil {
+		j.status.Error = err.Error()
+	}
+	if state != StateSucceeded && j.result != nil {
+		// Partial results of failed or cancelled jobs are never served
+		j.result.remove()
+		j.result = nil
+	}
+	j.cancel()
+}
+
+// expireLoop periodically removes expired jobs
+func (m *Manager) expireLoop() {
+	defer m.wg.Done()
+
+	interval := m.opts.ResultTTL / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.expire()
+		}
+	}
+}
+
+// expire removes finished jobs whose TTL has passed, returning how many were removed
+func (m *Manager) expire() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	removed := 0
+	for id, j := range m.jobs {
+		if j.status.ExpiresAt == nil || now.Before(*j.status.ExpiresAt) {
+			continue
+		}
+		if j.result != nil {
+			j.result.remove()
+		}
+		delete(m.jobs, id)
+		removed++
+	}
+	return removed
+}
+
+// newJobID returns a random job identifier
+func newJobID() string {
+	bytes := make([]byte, 12)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,270 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForState polls until the job reaches the wanted state
+func waitForState(t *testing.T, m *Manager, id string, want State) Status {
+	t.Helper()
+	var status Status
+	require.Eventually(t, func() bool {
+		var err error
+		status, err = m.Get(id)
+		return err == nil && status.State == want
+	}, 2*time.Second, 5*time.Millisecond, "job %s never reached state %s", id, want)
+	return status
+}
+
+// blockingRun returns a RunFunc that signals when it starts and blocks until released or cancelled
+func blockingRun(started chan<- struct{}, release <-chan struct{}) RunFunc {
+	return func(ctx context.Context, w ResultWriter) error {
+		close(started)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	m := NewManager(Options{Workers: 1})
+	defer m.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first, err := m.Submit(map[string]string{"operation": "query"}, blockingRun(started, release))
+	require.NoError(t, err)
+	<-started
+	waitForState(t, m, first.ID, StateRunning)
+
+	// The only worker is busy, so the next job waits in the queue
+	second, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		w.SetColumns([]string{"id", "name"})
+		if err := w.WriteRow(map[string]interface{}{"id": 1, "name": "alpha"}); err != nil {
+			return err
+		}
+		return w.WriteRow(map[string]interface{}{"id": 2, "name": "beta, gamma"})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StateQueued, second.State)
+
+	_, err = m.OpenResult(second.ID)
+	assert.ErrorIs(t, err, ErrNotFinished)
+
+	close(release)
+	status := waitForState(t, m, second.ID, StateSucceeded)
+	assert.Equal(t, 2, status.RowCount)
+	assert.NotNil(t, status.StartedAt)
+	assert.NotNil(t, status.FinishedAt)
+	assert.NotNil(t, status.ExpiresAt)
+	assert.Positive(t, status.ResultBytes)
+
+	first = waitForState(t, m, first.ID, StateSucceeded)
+	assert.Equal(t, "query", first.Labels["operation"])
+
+	result, err := m.OpenResult(second.ID)
+	require.NoError(t, err)
+	lines, err := io.ReadAll(result)
+	require.NoError(t, err)
+	result.Close()
+	assert.Equal(t, "{\"id\":1,\"name\":\"alpha\"}\n{\"id\":2,\"name\":\"beta, gamma\"}\n", string(lines))
+
+	result, err = m.OpenResult(second.ID)
+	require.NoError(t, err)
+	var csvOut bytes.Buffer
+	require.NoError(t, result.WriteCSV(&csvOut))
+	result.Close()
+	assert.Equal(t, "id,name\n1,alpha\n2,\"beta, gamma\"\n", csvOut.String())
+
+	assert.Len(t, m.List(), 2)
+}
+
+func TestJobFailure(t *testing.T) {
+	m := NewManager(Options{})
+	defer m.Close()
+
+	status, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		return errors.New("syntax error near SELEC")
+	})
+	require.NoError(t, err)
+
+	status = waitForState(t, m, status.ID, StateFailed)
+	assert.Equal(t, "syntax error near SELEC", status.Error)
+
+	_, err = m.OpenResult(status.ID)
+	assert.ErrorIs(t, err, ErrNoResult)
+}
+
+func TestJobPanicIsReportedAsFailure(t *testing.T) {
+	m := NewManager(Options{})
+	defer m.Close()
+
+	status, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		panic("boom")
+	})
+	require.NoError(t, err)
+
+	status = waitForState(t, m, status.ID, StateFailed)
+	assert.Contains(t, status.Error, "boom")
+}
+
+func TestJobCancellation(t *testing.T) {
+	m := NewManager(Options{Workers: 1})
+	defer m.Close()
+
+	started := make(chan struct{})
+	running, err := m.Submit(nil, blockingRun(started, nil))
+	require.NoError(t, err)
+	<-started
+
+	ran := false
+	queued, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		ran = true
+		return nil
+	})
+	require.NoError(t, err)
+
+	// A queued job is cancelled immediately and never runs
+	status, err := m.Cancel(queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateCancelled, status.State)
+
+	// A running job is cancelled through its context
+	_, err = m.Cancel(running.ID)
+	require.NoError(t, err)
+	status = waitForState(t, m, running.ID, StateCancelled)
+	assert.Equal(t, context.Canceled.Error(), status.Error)
+
+	// Give the worker a chance to pick up the cancelled job from the queue
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, ran)
+
+	_, err = m.Cancel("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestJobTimeout(t *testing.T) {
+	m := NewManager(Options{JobTimeout: 20 * time.Millisecond})
+	defer m.Close()
+
+	status, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+
+	status = waitForState(t, m, status.ID, StateFailed)
+	assert.Equal(t, context.DeadlineExceeded.Error(), status.Error)
+}
+
+func TestJobResultCaps(t *testing.T) {
+	m := NewManager(Options{MaxResultRows: 2, MaxResultBytes: 1 << 20})
+	defer m.Close()
+
+	status, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		for i := 0; i < 3; i++ {
+			if err := w.WriteRow(map[string]interface{}{"i": i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	status = waitForState(t, m, status.ID, StateFailed)
+	assert.Contains(t, status.Error, ErrResultTooLarge.Error())
+	assert.Equal(t, 2, status.RowCount)
+
+	small := NewManager(Options{MaxResultBytes: 10})
+	defer small.Close()
+	status, err = small.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		return w.WriteRow(map[string]interface{}{"payload": "more than ten bytes"})
+	})
+	require.NoError(t, err)
+	status = waitForState(t, small, status.ID, StateFailed)
+	assert.Contains(t, status.Error, "bytes")
+}
+
+func TestJobExpiry(t *testing.T) {
+	spoolDir := t.TempDir()
+	m := NewManager(Options{ResultTTL: time.Hour, SpoolDir: spoolDir})
+	defer m.Close()
+
+	var mu sync.Mutex
+	now := time.Now()
+	m.mu.Lock()
+	m.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	m.mu.Unlock()
+
+	status, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error {
+		return w.WriteRow(map[string]interface{}{"id": 1})
+	})
+	require.NoError(t, err)
+	waitForState(t, m, status.ID, StateSucceeded)
+
+	files, err := filepath.Glob(filepath.Join(spoolDir, "job-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// Not yet expired
+	assert.Equal(t, 0, m.expire())
+	_, err = m.OpenResult(status.ID)
+	assert.NoError(t, err)
+
+	mu.Lock()
+	now = now.Add(time.Hour + time.Second)
+	mu.Unlock()
+
+	assert.Equal(t, 1, m.expire())
+	_, err = m.Get(status.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = m.OpenResult(status.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = os.Stat(files[0])
+	assert.True(t, os.IsNotExist(err), "spool file should be removed on expiry")
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+	m := NewManager(Options{Workers: 1, QueueSize: 1})
+	defer m.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	_, err := m.Submit(nil, blockingRun(started, release))
+	require.NoError(t, err)
+	<-started
+
+	_, err = m.Submit(nil, func(ctx context.Context, w ResultWriter) error { return nil })
+	require.NoError(t, err)
+
+	_, err = m.Submit(nil, func(ctx context.Context, w ResultWriter) error { return nil })
+	assert.ErrorIs(t, err, ErrQueueFull)
+}
+
+func TestSubmitAfterClose(t *testing.T) {
+	m := NewManager(Options{})
+	m.Close()
+
+	_, err := m.Submit(nil, func(ctx context.Context, w ResultWriter) error { return nil })
+	assert.ErrorIs(t, err, ErrClosed)
+}
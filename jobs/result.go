@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ErrResultTooLarge is returned when a job writes more than its result caps allow
+var ErrResultTooLarge = errors.New("job result exceeds the configured size limit")
+
+// ResultWriter receives the output of a running job
+type ResultWriter interface {
+	// SetColumns fixes the column order used for CSV output
+	SetColumns(columns []string)
+	// WriteRow appends a row to the stored result
+	WriteRow(row map[string]interface{}) error
+	// SetRowsAffected records the affected row count of a write statement
+	SetRowsAffected(n int64)
+}
+
+// resultStore holds a job result as JSON Lines, in memory or spooled to a file
+type resultStore struct {
+	maxRows  int
+	maxBytes int64
+
+	buf  *bytes.Buffer
+	file *os.File
+	path string
+	out  *bufio.Writer
+
+	columns  []string
+	seen     map[string]bool
+	fixed    bool
+	rows     int
+	bytes    int64
+	finished bool
+}
+
+// newResultStore creates an empty result store for a job
+func newResultStore(opts Options, jobID string) (*resultStore, error) {
+	s := &resultStore{
+		maxRows:  opts.MaxResultRows,
+		maxBytes: opts.MaxResultBytes,
+		seen:     make(map[string]bool),
+	}
+
+	if opts.SpoolDir == "" {
+		s.buf = &bytes.Buffer{}
+		s.out = bufio.NewWriter(s.buf)
+		return s, nil
+	}
+
+	if err := os.MkdirAll(opts.SpoolDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	file, err := os.CreateTemp(opts.SpoolDir, "job-"+jobID+"-*.jsonl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	s.file = file
+	s.path = file.Name()
+	s.out = bufio.NewWriter(file)
+	return s, nil
+}
+
+// setColumns fixes the CSV column order
+func (s *resultStore) setColumns(columns []string) {
+	s.columns = append([]string(nil), columns...)
+	s.fixed = true
+}
+
+// writeRow encodes a row as one JSON line, enforcing the size caps
+func (s *resultStore) writeRow(row map[string]interface{}) (int64, error) {
+	if s.rows >= s.maxRows {
+		return 0, fmt.Errorf("%w: more than %d rows", ErrResultTooLarge, s.maxRows)
+	}
+
+	line, err := json.Marshal(row)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode result row: %w", err)
+	}
+	line = append(line, '\n')
+	if s.bytes+int64(len(line)) > s.maxBytes {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrResultTooLarge, s.maxBytes)
+	}
+
+	if _, err := s.out.Write(line); err != nil {
+		return 0, fmt.Errorf("failed to store result row: %w", err)
+	}
+	s.rows++
+	s.bytes += int64(len(line))
+
+	if !s.fixed {
+		// Collect the union of keys for CSV output; keys within a row are sorted for stable order
+		keys := make([]string, 0, len(row))
+		for key := range row {
+			if !s.seen[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s.seen[key] = true
+			s.columns = append(s.columns, key)
+		}
+	}
+	return int64(len(line)), nil
+}
+
+// finish flushes buffered output and closes the spool file
+func (s *resultStore) finish() error {
+	if s.finished {
+		return nil
+	}
+	s.finished = true
+	if err := s.out.Flush(); err != nil {
+		return fmt.Errorf("failed to flush result: %w", err)
+	}
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("failed to close spool file: %w", err)
+		}
+	}
+	return nil
+}
+
+// open returns a reader over the stored JSON Lines
+func (s *resultStore) open() (*Result, error) {
+	result := &Result{Columns: s.columns, Rows: s.rows}
+	if s.file == nil {
+		result.ReadCloser = io.NopCloser(bytes.NewReader(s.buf.Bytes()))
+		return result, nil
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spooled result: %w", err)
+	}
+	result.ReadCloser = file
+	return result, nil
+}
+
+// remove discards the stored result
+func (s *resultStore) remove() {
+	s.finish()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+	s.buf = nil
+}
+
+// Result is a stored job result encoded as JSON Lines
+type Result struct {
+	io.ReadCloser
+	Columns []string // Column order for CSV output
+	Rows    int
+}
+
+// WriteCSV converts the JSON Lines result to CSV with a header row
+func (r *Result) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(r.Columns); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	record := make([]string, len(r.Columns))
+	for {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read result row: %w", err)
+		}
+
+		for i, column := range r.Columns {
+			record[i] = csvValue(row[column])
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// csvValue formats a decoded JSON value as a CSV field
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		// Nested objects and arrays are kept as JSON
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// resultWriter is the ResultWriter handed to a RunFunc
+type resultWriter struct {
+	manager *Manager
+	job     *job
+	store   *resultStore
+}
+
+func (w *resultWriter) SetColumns(columns []string) {
+	w.store.setColumns(columns)
+}
+
+func (w *resultWriter) WriteRow(row map[string]interface{}) error {
+	if err := w.job.ctx.Err(); err != nil {
+		return err
+	}
+	n, err := w.store.writeRow(row)
+	if err != nil {
+		return err
+	}
+
+	w.manager.mu.Lock()
+	w.job.status.RowCount++
+	w.job.status.ResultBytes += n
+	w.manager.mu.Unlock()
+	return nil
+}
+
+func (w *resultWriter) SetRowsAffected(n int64) {
+	w.manager.mu.Lock()
+	w.job.status.RowsAffected = &n
+	w.manager.mu.Unlock()
+}
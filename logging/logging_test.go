@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"db-connectors/requestid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugSuppressedAtInfoLevel(t *testing.T) {
+	for _, format := range []string{FormatConsole, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(Options{Level: "info", Format: format, Output: &buf})
+
+			logger.Debug("connecting", "dsn", "user:***@tcp(localhost:3306)/db")
+			assert.Empty(t, buf.String())
+
+			logger.Info("request", "status", 200)
+			assert.Contains(t, buf.String(), "request")
+		})
+	}
+}
+
+func TestDebugWrittenAtDebugLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Options{Level: "debug", Output: &buf})
+
+	logger.Debug("query", "sql", "SELECT 1")
+	assert.Contains(t, buf.String(), "DEBUG query sql=\"SELECT 1\"")
+}
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Options{Level: "info", Format: "json", AppName: "test-app", Output: &buf})
+
+	logger.Info("request", "method", "POST", "status", 201)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "request", record["msg"])
+	assert.Equal(t, "test-app", record["app"])
+	assert.Equal(t, "POST", record["method"])
+	assert.Equal(t, float64(201), record["status"])
+}
+
+func TestConsoleFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Options{Level: "info", AppName: "test-app", Output: &buf}).
+		With("db_type", "mysql").
+		WithGroup("pool")
+
+	logger.Warn("slow", "open", 3, slog.Group("wait", "count", 2))
+
+	line := buf.String()
+	assert.True(t, strings.HasSuffix(line, "\n"))
+	assert.Contains(t, line, "WARN  slow app=test-app db_type=mysql pool.open=3 pool.wait.count=2")
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("debug"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("info"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel("WARN"))
+	assert.Equal(t, slog.LevelError, ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel(""))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("verbose"))
+}
+
+func TestDiscard(t *testing.T) {
+	assert.False(t, Discard().Enabled(context.Background(), slog.LevelError))
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Options{Level: "info", Format: FormatJSON, Output: &buf}).With("db_type", "mysql")
+
+	logger.InfoContext(requestid.NewContext(context.Background(), "req-1"), "query")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "req-1", record["request_id"])
+	assert.Equal(t, "mysql", record["db_type"])
+
+	buf.Reset()
+	logger.Info("no request")
+	assert.NotContains(t, buf.String(), "request_id")
+}
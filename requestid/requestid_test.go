@@ -0,0 +1,36 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	id := New()
+	assert.Len(t, id, 32)
+	assert.True(t, Valid(id))
+	assert.NotEqual(t, id, New())
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("req-123"))
+	assert.True(t, Valid("0f8fad5b-d9cb-469f-a165-70867728950e"))
+	assert.True(t, Valid("trace:span.1_a"))
+
+	assert.False(t, Valid(""))
+	assert.False(t, Valid("has space"))
+	assert.False(t, Valid("line\nbreak"))
+	assert.False(t, Valid("quote\""))
+	assert.False(t, Valid(strings.Repeat("a", maxLength+1)))
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, FromContext(ctx))
+
+	ctx = NewContext(ctx, "abc")
+	assert.Equal(t, "abc", FromContext(ctx))
+}
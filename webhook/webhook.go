@@ -0,0 +1,99 @@
+// Package webhook posts JSON notifications to HTTP endpoints, such as the alerting webhook told about
+// connections turning unhealthy
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"db-connectors/logging"
+)
+
+// Defaults of a webhook client
+const (
+	DefaultTimeout       = 5 * time.Second
+	DefaultRetries       = 2
+	DefaultRetryInterval = time.Second
+)
+
+// Options configures a Client
+type Options struct {
+	URL           string
+	Headers       map[string]string // Sent with every post, such as an Authorization token
+	Timeout       time.Duration     // Of each attempt; zero keeps the default
+	Retries       int               // Further attempts after a failed one; zero keeps the default, negative makes none
+	RetryInterval time.Duration     // Between attempts, doubling after each; zero keeps the default
+}
+
+// Client posts JSON payloads to one URL
+type Client struct {
+	opts   Options
+	client *http.Client
+}
+
+// New returns a client posting to opts.URL, which must be an http or https URL
+func New(opts Options) (*Client, error) {
+	req, err := http.NewRequest(http.MethodPost, opts.URL, nil)
+	if err != nil || req.URL.Host == "" || req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid webhook URL %q: must be an http or https URL", logging.RedactDSN(opts.URL))
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultRetries
+	}
+	opts.Retries = max(opts.Retries, 0)
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	return &Client{opts: opts, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+// Post sends payload as JSON, retrying failed attempts until ctx is done. Responses other than 2xx fail.
+func (c *Client) Post(ctx context.Context, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	interval := c.opts.RetryInterval
+	for attempt := 0; ; attempt++ {
+		err = c.post(ctx, body)
+		if err == nil || attempt == c.opts.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// post makes one attempt at posting body
+func (c *Client) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range c.opts.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPost(t *testing.T) {
+	var body map[string]interface{}
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := New(Options{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	require.NoError(t, err)
+	require.NoError(t, client.Post(context.Background(), map[string]string{"event": "connection_unhealthy"}))
+	assert.Equal(t, map[string]interface{}{"event": "connection_unhealthy"}, body)
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+}
+
+func TestPostRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := New(Options{URL: server.URL, RetryInterval: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, client.Post(context.Background(), map[string]string{}))
+	assert.Equal(t, int32(3), attempts.Load())
+
+	// The last failure is returned once the retries run out
+	attempts.Store(0)
+	client, err = New(Options{URL: server.URL, Retries: -1})
+	require.NoError(t, err)
+	assert.EqualError(t, client.Post(context.Background(), map[string]string{}), "webhook responded 502 Bad Gateway")
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestNewRejectsInvalidURL(t *testing.T) {
+	for _, url := range []string{"", "alerts.internal/hook", "ftp://alerts.internal/hook", "https://"} {
+		_, err := New(Options{URL: url})
+		assert.Error(t, err, url)
+	}
+}